@@ -4,8 +4,6 @@ go 1.15
 
 require (
 	github.com/BurntSushi/toml v0.3.1
-	github.com/blakesmith/ar v0.0.0-20190502131153-809d4375e1fb
-	github.com/holocm/libpackagebuild v1.1.1
 	github.com/ogier/pflag v0.0.1
 	github.com/surma/gocpio v1.0.2-0.20160926205914-fcb68777e7dc
 )
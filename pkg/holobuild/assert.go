@@ -0,0 +1,148 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+	"github.com/holocm/holo-build/pkg/pkgimport"
+)
+
+//CheckError is returned by Run() when the package was built successfully, but
+//does not satisfy the [[check]] sections of its package definition. The
+//package is not written in this case.
+type CheckError struct {
+	Failures []error
+}
+
+//Error implements the builtin/error interface.
+func (e CheckError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for idx, err := range e.Failures {
+		msgs[idx] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+//parseCheck validates a [[check]] section.
+func parseCheck(data CheckSection, ec *ErrorCollector, entryIdx int) (check build.PackageCheck, isValid bool) {
+	entryDesc := fmt.Sprintf("check %d", entryIdx)
+	isValid = true
+	if data.PathExists == "" && data.PathMissing == "" && data.ScriptContains == "" {
+		ec.Addf("%s is invalid: needs at least one of \"pathExists\", \"pathMissing\" or \"scriptContains\"", entryDesc)
+		isValid = false
+	}
+	if data.PathExists != "" {
+		isValid = validatePath(data.PathExists, ec, "check", entryIdx) && isValid
+	}
+	if data.PathMissing != "" {
+		isValid = validatePath(data.PathMissing, ec, "check", entryIdx) && isValid
+	}
+	if data.Mode != "" {
+		if data.PathExists == "" {
+			ec.Addf("%s is invalid: \"mode\" can only be given together with \"pathExists\"", entryDesc)
+			isValid = false
+		}
+		errorCount := len(ec.Errors)
+		check.Mode = parseFileMode(data.Mode, 0, ec, entryDesc)
+		check.HasMode = true
+		isValid = isValid && len(ec.Errors) == errorCount
+	}
+	check.PathExists = data.PathExists
+	check.PathMissing = data.PathMissing
+	check.ScriptContains = data.ScriptContains
+	return check, isValid
+}
+
+//runChecks verifies the generated package against pkg.Checks. The package is
+//read back with pkgimport.Import(), so that the checks see what ends up in the
+//package file rather than what was put into the generator. Formats that
+//cannot be imported produce a warning instead.
+func runChecks(pkg *build.Package, format string, pkgBytes []byte) (warnings []string, err error) {
+	if len(pkg.Checks) == 0 {
+		return nil, nil
+	}
+	switch format {
+	case "debian", "pacman", "rpm":
+	default:
+		return []string{fmt.Sprintf("[[check]] sections are not evaluated for package format \"%s\" (only for debian, pacman and rpm)", format)}, nil
+	}
+	imported, err := pkgimport.Import(pkgBytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read back generated package for [[check]] sections: %s", err.Error())
+	}
+
+	nodes := make(map[string]filesystem.Node)
+	imported.Package.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		nodes[absolutePath] = node
+		return nil
+	})
+	var scripts []string
+	for _, action := range imported.Package.Actions {
+		scripts = append(scripts, action.Content)
+	}
+	packagePath := func(p string) string {
+		if pkg.PathPrefix == "" {
+			return p
+		}
+		return path.Join(pkg.PathPrefix, p)
+	}
+
+	var failures []error
+	for _, check := range pkg.Checks {
+		if check.PathExists != "" {
+			p := packagePath(check.PathExists)
+			node, exists := nodes[p]
+			switch {
+			case !exists:
+				failures = append(failures, fmt.Errorf("check failed: %s does not exist in the package", p))
+			case check.HasMode && node.FileModeForArchive(false) != uint32(check.Mode):
+				failures = append(failures, fmt.Errorf("check failed: %s has mode %04o instead of %04o", p, node.FileModeForArchive(false), uint32(check.Mode)))
+			}
+		}
+		if check.PathMissing != "" {
+			p := packagePath(check.PathMissing)
+			if _, exists := nodes[p]; exists {
+				failures = append(failures, fmt.Errorf("check failed: %s exists in the package", p))
+			}
+		}
+		if check.ScriptContains != "" {
+			found := false
+			for _, script := range scripts {
+				if strings.Contains(script, check.ScriptContains) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				failures = append(failures, fmt.Errorf("check failed: no maintainer script contains %q", check.ScriptContains))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return nil, CheckError{failures}
+	}
+	return nil, nil
+}
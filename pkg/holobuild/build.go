@@ -0,0 +1,289 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//KnownHoloPlugins contains the IDs of the Holo plugins that are distributed
+//with Holo itself. CheckHoloPlugins() warns about other plugin IDs unless they
+//are declared explicitly.
+var KnownHoloPlugins = []string{"files", "run-scripts", "ssh-keys", "users-groups"}
+
+//findHoloPlugins returns the IDs of the Holo plugins that provision entries
+//in this package, together with the first path below
+///usr/share/holo/$plugin_id for each of them.
+func findHoloPlugins(pkg *build.Package) map[string]string {
+	plugins := make(map[string]string)
+	pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+		if strings.HasPrefix(path, "/usr/share/holo/") {
+			//extract the plugin ID from the path
+			pathParts := strings.Split(path, "/")
+			if len(pathParts) > 5 {
+				//NOTE: not > 4, but > 5, since we only want entries that are
+				//strictly below, rather than at, "/usr/share/holo/$plugin_id"
+				if _, exists := plugins[pathParts[4]]; !exists {
+					plugins[pathParts[4]] = path
+				}
+			}
+		}
+		return nil
+	})
+	return plugins
+}
+
+//CheckHoloPlugins returns warnings for plugin IDs that DoMagicalHoloIntegration
+//would derive from paths below /usr/share/holo, but that are neither in
+//KnownHoloPlugins nor in `additionalPlugins`. This catches typos like
+///usr/share/holo/file/..., which would otherwise silently add a requirement
+//on a nonexistent package "holo-file". Plugin IDs for which the package
+//already requires "holo-$plugin_id" are assumed to be intentional.
+func CheckHoloPlugins(pkg *build.Package, additionalPlugins []string) []string {
+	knownPlugins := append(append([]string(nil), KnownHoloPlugins...), additionalPlugins...)
+	plugins := findHoloPlugins(pkg)
+
+	pluginIDs := make([]string, 0, len(plugins))
+	for pluginID := range plugins {
+		pluginIDs = append(pluginIDs, pluginID)
+	}
+	sort.Strings(pluginIDs)
+
+	var warnings []string
+OUTER:
+	for _, pluginID := range pluginIDs {
+		for _, knownID := range knownPlugins {
+			if pluginID == knownID {
+				continue OUTER
+			}
+		}
+		for _, rel := range pkg.Requires {
+			if rel.RelatedPackage == "holo-"+pluginID {
+				continue OUTER
+			}
+		}
+
+		msg := fmt.Sprintf("unknown Holo plugin \"%s\" for %s (the package will require \"holo-%s\")",
+			pluginID, plugins[pluginID], pluginID)
+		if suggestion := suggestHoloPlugin(pluginID, knownPlugins); suggestion != "" {
+			msg += fmt.Sprintf(", did you mean \"%s\"?", suggestion)
+		}
+		warnings = append(warnings, msg)
+	}
+	return warnings
+}
+
+//validateHoloPathPrefix rejects packages that are relocated with a PathPrefix
+//while containing resources for Holo plugins: Holo only looks for them below
+///usr/share/holo, so the relocated resources would never be provisioned.
+func validateHoloPathPrefix(pkg *build.Package) []error {
+	if path.Clean("/"+pkg.PathPrefix) == "/" {
+		return nil
+	}
+	plugins := findHoloPlugins(pkg)
+	pluginIDs := make([]string, 0, len(plugins))
+	for pluginID := range plugins {
+		pluginIDs = append(pluginIDs, pluginID)
+	}
+	sort.Strings(pluginIDs)
+
+	var errs []error
+	for _, pluginID := range pluginIDs {
+		errs = append(errs, fmt.Errorf("cannot relocate %s below path prefix \"%s\": Holo only looks for resources below /usr/share/holo",
+			plugins[pluginID], pkg.PathPrefix))
+	}
+	return errs
+}
+
+//suggestHoloPlugin returns the known plugin ID that is closest to the given
+//unknown plugin ID, or "" if none of them is close enough to be a typo.
+func suggestHoloPlugin(pluginID string, knownPlugins []string) string {
+	const maxDistance = 2
+	best, bestDistance := "", maxDistance+1
+	for _, knownID := range knownPlugins {
+		distance := editDistance(pluginID, knownID)
+		if distance < bestDistance {
+			best, bestDistance = knownID, distance
+		}
+	}
+	return best
+}
+
+//editDistance computes the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	//only keep two rows of the distance matrix
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+//expectedHoloResourceMode returns the mode that Holo plugins expect for
+//entries below /usr/share/holo (0755 for directories and executable files
+//like scripts for holo-run-scripts, and 0644 for other files), and the
+//metadata of the given node. Symlinks are not checked, so ok is false for
+//them.
+func expectedHoloResourceMode(node filesystem.Node) (mode os.FileMode, metadata *filesystem.NodeMetadata, ok bool) {
+	switch n := node.(type) {
+	case *filesystem.Directory:
+		return 0755, &n.Metadata, true
+	case *filesystem.RegularFile:
+		if n.Metadata.Mode&0111 != 0 {
+			return 0755, &n.Metadata, true
+		}
+		return 0644, &n.Metadata, true
+	default:
+		return 0, nil, false
+	}
+}
+
+//isRootID returns whether the given owner or group refers to root.
+func isRootID(id *filesystem.IntOrString) bool {
+	return id == nil || (id.Str == "" && id.Int == 0) || id.Str == "root"
+}
+
+//describeID describes an owner or group in a warning message.
+func describeID(id *filesystem.IntOrString) string {
+	if id.Str != "" {
+		return fmt.Sprintf("\"%s\"", id.Str)
+	}
+	return fmt.Sprintf("%d", id.Int)
+}
+
+//CheckHoloResources returns warnings for directories and regular files below
+///usr/share/holo that are not owned by root:root, or whose mode is not the
+//one expected by Holo plugins (0755 for directories and executable files,
+//0644 for other files). Such files are usually misconfigured, and would be
+//deployed with the wrong ownership by Holo. NormalizeHoloResources() can be
+//used to fix them instead.
+func CheckHoloResources(pkg *build.Package) []string {
+	var warnings []string
+	pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+		if !strings.HasPrefix(path, "/usr/share/holo/") {
+			return nil
+		}
+		expectedMode, metadata, ok := expectedHoloResourceMode(node)
+		if !ok {
+			return nil
+		}
+
+		var problems []string
+		if !isRootID(metadata.Owner) {
+			problems = append(problems, "owner "+describeID(metadata.Owner))
+		}
+		if !isRootID(metadata.Group) {
+			problems = append(problems, "group "+describeID(metadata.Group))
+		}
+		if metadata.Mode != expectedMode {
+			problems = append(problems, fmt.Sprintf("mode %04o", metadata.Mode))
+		}
+		if len(problems) > 0 {
+			warnings = append(warnings, fmt.Sprintf(
+				"Holo resource %s has %s (expected owner root, group root and mode %04o)",
+				path, strings.Join(problems, ", "), expectedMode))
+		}
+		return nil
+	})
+	return warnings
+}
+
+//NormalizeHoloResources changes the ownership of all directories and regular
+//files below /usr/share/holo to root:root, and their mode to the one expected
+//by Holo plugins (see CheckHoloResources).
+func NormalizeHoloResources(pkg *build.Package) {
+	pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+		if !strings.HasPrefix(path, "/usr/share/holo/") {
+			return nil
+		}
+		expectedMode, metadata, ok := expectedHoloResourceMode(node)
+		if ok {
+			metadata.Owner = nil
+			metadata.Group = nil
+			metadata.Mode = expectedMode
+		}
+		return nil
+	})
+}
+
+//DoMagicalHoloIntegration makes the implicit "holo apply" setup script and the
+//implicit "holo-$PLUGIN" dependencies explicit.
+func DoMagicalHoloIntegration(pkg *build.Package) {
+	//does this package need to provision stuff with Holo plugins?
+	plugins := findHoloPlugins(pkg)
+	if len(plugins) == 0 {
+		return
+	}
+
+	//it does -> sort list of plugins for reproducibility...
+	pluginIDs := make([]string, 0, len(plugins))
+	for pluginID := range plugins {
+		pluginIDs = append(pluginIDs, pluginID)
+	}
+	sort.Strings(pluginIDs)
+
+	//add all these Holo plugins to the list of requirements...
+	for _, pluginID := range pluginIDs {
+		depName := "holo-" + pluginID
+		hasDep := false
+		for _, rel := range pkg.Requires {
+			if rel.RelatedPackage == depName {
+				hasDep = true
+				break
+			}
+		}
+		if !hasDep {
+			pkg.Requires = append(pkg.Requires, build.PackageRelation{RelatedPackage: depName})
+		}
+	}
+
+	//...and run `holo apply` during setup/cleanup
+	pkg.PrependActions(
+		build.PackageAction{Type: build.SetupAction, Content: "holo apply"},
+		build.PackageAction{Type: build.CleanupAction, Content: "holo apply"},
+	)
+}
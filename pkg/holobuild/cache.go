@@ -0,0 +1,137 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//buildCache stores generated packages in Options.CacheDirectory, so that
+//packages whose inputs have not changed are not built again. The cache key is
+//a digest of the holo-build version, all options that affect the generated
+//package, and the digests of all inputs as recorded by the inputRecorder.
+//
+//All methods can be called on a nil cache, in which case nothing is cached.
+type buildCache struct {
+	Path string
+}
+
+//newBuildCache returns the cache entry for the package described by the
+//given options and inputs, or nil if Options.CacheDirectory is not set.
+func newBuildCache(opts Options, inputs *inputRecorder) (*buildCache, error) {
+	if opts.CacheDirectory == "" {
+		return nil, nil
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "holo-build %s\n", opts.BuilderVersion)
+	fmt.Fprintf(hash, "format %s\n", opts.Format)
+	fmt.Fprintf(hash, "architecture %s\n", opts.Architecture)
+	fmt.Fprintf(hash, "prefix %s\n", opts.PathPrefix)
+	for _, name := range sortedDefineNames(opts.Defines) {
+		fmt.Fprintf(hash, "define %s=%q\n", name, opts.Defines[name])
+	}
+	//the version does not appear in the inputs if it was given separately
+	if opts.Version != nil {
+		fmt.Fprintf(hash, "version %s %d\n", *opts.Version, opts.Version.Release)
+	}
+	if opts.NormalizeHoloResources {
+		fmt.Fprintf(hash, "normalize-holo-resources\n")
+	}
+	if opts.HologramProvides {
+		fmt.Fprintf(hash, "hologram-provides\n")
+	}
+	//multi-threaded xz compression yields a different result than a single
+	//thread (but the same for any number of threads)
+	if opts.Jobs > 1 {
+		fmt.Fprintf(hash, "parallel-compression\n")
+	}
+	//for RPM packages, the signature is embedded in the package
+	if opts.SignCommand != "" {
+		fmt.Fprintf(hash, "sign-command %s\n", opts.SignCommand)
+	}
+	for _, material := range inputs.Materials {
+		fmt.Fprintf(hash, "input %s %s\n", material.URI, material.Digest["sha256"])
+	}
+	if opts.PacmanGroupDatabase != "" {
+		file, err := os.Open(opts.PacmanGroupDatabase)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read package group database: %s", err.Error())
+		}
+		defer file.Close()
+		fmt.Fprintf(hash, "pacman-group-db ")
+		_, err = io.Copy(hash, file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read package group database: %s", err.Error())
+		}
+	}
+
+	key := hex.EncodeToString(hash.Sum(nil))
+	return &buildCache{Path: filepath.Join(opts.CacheDirectory, key)}, nil
+}
+
+//Load returns the cached package, or false if there is none.
+func (c *buildCache) Load() ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	pkgBytes, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return nil, false
+	}
+	return pkgBytes, true
+}
+
+//Store puts the given package into the cache. The cache entry is written
+//atomically, so that concurrent builds never see an incomplete package.
+func (c *buildCache) Store(pkgBytes []byte) error {
+	if c == nil {
+		return nil
+	}
+	dir := filepath.Dir(c.Path)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(pkgBytes)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), c.Path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
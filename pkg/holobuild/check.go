@@ -0,0 +1,120 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//outputChecker describes a command that inspects a generated package without
+//modifying it. The path to the package is appended to the given arguments.
+type outputChecker struct {
+	Program string
+	Args    []string
+}
+
+//outputCheckers lists the checkers for each package format. Checkers whose
+//program is not installed are skipped silently.
+var outputCheckers = map[string][]outputChecker{
+	"debian": {{Program: "dpkg-deb", Args: []string{"--info"}}},
+	"pacman": {{Program: "bsdtar", Args: []string{"-tf"}}},
+	"rpm":    {{Program: "rpm", Args: []string{"-K", "--nosignature"}}},
+	"tar":    {{Program: "bsdtar", Args: []string{"-tf"}}},
+	"freebsd": {
+		{Program: "bsdtar", Args: []string{"-tf"}},
+		{Program: "pkg", Args: []string{"info", "-F"}},
+	},
+}
+
+//CheckOutput runs the native tools for the given package format (if they are
+//installed) against the generated package, and returns their complaints as a
+//list of warning messages.
+func CheckOutput(pkgBytes []byte, format string, pkgFileName string) []string {
+	checkers := outputCheckers[format]
+	if len(checkers) == 0 {
+		return nil
+	}
+
+	//the checkers need the package in a file; keep the original file name
+	//since some tools deduce the format from the extension
+	tempDir, err := ioutil.TempDir("", "holo-build-check-")
+	if err != nil {
+		return []string{"cannot check output: " + err.Error()}
+	}
+	defer os.RemoveAll(tempDir)
+	if pkgFileName == "-" || pkgFileName == "" {
+		pkgFileName = "package"
+	}
+	pkgPath := filepath.Join(tempDir, filepath.Base(pkgFileName))
+	err = ioutil.WriteFile(pkgPath, pkgBytes, 0600)
+	if err != nil {
+		return []string{"cannot check output: " + err.Error()}
+	}
+
+	var warnings []string
+	for _, checker := range checkers {
+		warnings = append(warnings, checker.run(pkgPath)...)
+	}
+	return warnings
+}
+
+func (c outputChecker) run(pkgPath string) []string {
+	programPath, err := exec.LookPath(c.Program)
+	if err != nil {
+		return nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(programPath, append(c.Args, pkgPath)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+
+	//on success, only report what the tool printed on stderr; on failure, the
+	//explanation may be on stdout (e.g. `rpm -K` prints "NOT OK" there)
+	complaints := strings.TrimSpace(stderr.String())
+	if err != nil && complaints == "" {
+		complaints = strings.TrimSpace(stdout.String())
+	}
+	if err == nil && complaints == "" {
+		return nil
+	}
+
+	command := strings.Join(append([]string{c.Program}, c.Args...), " ")
+	var warnings []string
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("`%s` failed on the generated package: %s", command, err.Error()))
+	} else {
+		warnings = append(warnings, fmt.Sprintf("`%s` reported problems with the generated package:", command))
+	}
+	if complaints != "" {
+		for _, line := range strings.Split(complaints, "\n") {
+			warnings = append(warnings, "    "+line)
+		}
+	}
+	return warnings
+}
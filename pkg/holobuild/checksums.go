@@ -0,0 +1,203 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+)
+
+//checksumAlgorithm describes a type of checksum sidecar file (see
+//Options.Checksums).
+type checksumAlgorithm struct {
+	//Tag is the name of the algorithm in the output of `sha256sum --tag` etc.
+	Tag string
+	Sum func(data []byte) []byte
+}
+
+var checksumAlgorithms = map[string]checksumAlgorithm{
+	"sha256": {"SHA256", func(data []byte) []byte {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}},
+	"md5": {"MD5", func(data []byte) []byte {
+		sum := md5.Sum(data)
+		return sum[:]
+	}},
+	"b2": {"BLAKE2b", func(data []byte) []byte {
+		sum := blake2bSum512(data)
+		return sum[:]
+	}},
+}
+
+//Checksum is a digest of the generated package (see Options.Checksums).
+type Checksum struct {
+	//Algorithm is the name of the algorithm as given in Options.Checksums.
+	Algorithm string
+	//Tag is the name of the algorithm as used by `sha256sum --tag` etc.
+	//("SHA256", "MD5" or "BLAKE2b").
+	Tag string
+	//Digest is the checksum in hexadecimal notation.
+	Digest string
+}
+
+//ValidateChecksumAlgorithms returns an error if one of the given checksum
+//algorithms is not supported. Supported algorithms are "sha256", "md5" and
+//"b2" (BLAKE2b-512, as computed by b2sum(1)).
+func ValidateChecksumAlgorithms(algorithms []string) error {
+	for _, algorithm := range algorithms {
+		if _, exists := checksumAlgorithms[algorithm]; !exists {
+			return fmt.Errorf("invalid checksum algorithm: '%s'", algorithm)
+		}
+	}
+	return nil
+}
+
+//computeChecksums computes the given checksums of the package.
+func computeChecksums(algorithms []string, pkgBytes []byte) []Checksum {
+	result := make([]Checksum, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		a := checksumAlgorithms[algorithm]
+		result = append(result, Checksum{
+			Algorithm: algorithm,
+			Tag:       a.Tag,
+			Digest:    hex.EncodeToString(a.Sum(pkgBytes)),
+		})
+	}
+	return result
+}
+
+//writeChecksumFiles writes a sidecar file for each checksum next to the
+//package file at pkgPath, e.g. "foo_1.0-1_any.deb.sha256". The file format is
+//the same as for sha256sum(1) etc., so the package can be checked with
+//`sha256sum -c foo_1.0-1_any.deb.sha256` in the same directory.
+func writeChecksumFiles(checksums []Checksum, pkgPath string, mode os.FileMode) error {
+	for _, checksum := range checksums {
+		content := fmt.Sprintf("%s  %s\n", checksum.Digest, filepath.Base(pkgPath))
+		err := writeFileWithMode(pkgPath+"."+checksum.Algorithm, []byte(content), mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BLAKE2b (RFC 7693)
+
+var blake2bIV = [8]uint64{
+	0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+	0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
+}
+
+var blake2bSigma = [10][16]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+}
+
+//blake2bSum512 computes the unkeyed BLAKE2b-512 digest of the given data (as
+//printed by b2sum(1)). This is implemented here to avoid a dependency on
+//golang.org/x/crypto for this single use.
+func blake2bSum512(data []byte) [64]byte {
+	h := blake2bIV
+	h[0] ^= 0x01010000 ^ 64 //no key, 64 bytes of output
+
+	var (
+		block [128]byte
+		t     uint64
+	)
+	for {
+		n := copy(block[:], data)
+		data = data[n:]
+		t += uint64(n)
+		isLast := len(data) == 0
+		if isLast {
+			for idx := n; idx < len(block); idx++ {
+				block[idx] = 0
+			}
+		}
+		blake2bCompress(&h, &block, t, isLast)
+		if isLast {
+			break
+		}
+	}
+
+	var sum [64]byte
+	for idx, value := range h {
+		binary.LittleEndian.PutUint64(sum[8*idx:], value)
+	}
+	return sum
+}
+
+func blake2bCompress(h *[8]uint64, block *[128]byte, t uint64, isLast bool) {
+	var m [16]uint64
+	for idx := range m {
+		m[idx] = binary.LittleEndian.Uint64(block[8*idx:])
+	}
+
+	var v [16]uint64
+	copy(v[:8], h[:])
+	copy(v[8:], blake2bIV[:])
+	v[12] ^= t //the upper half of the 128-bit counter stays zero
+	if isLast {
+		v[14] = ^v[14]
+	}
+
+	g := func(a, b, c, d int, x, y uint64) {
+		v[a] += v[b] + x
+		v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+		v[a] += v[b] + y
+		v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+	}
+	for round := 0; round < 12; round++ {
+		s := &blake2bSigma[round%10]
+		g(0, 4, 8, 12, m[s[0]], m[s[1]])
+		g(1, 5, 9, 13, m[s[2]], m[s[3]])
+		g(2, 6, 10, 14, m[s[4]], m[s[5]])
+		g(3, 7, 11, 15, m[s[6]], m[s[7]])
+		g(0, 5, 10, 15, m[s[8]], m[s[9]])
+		g(1, 6, 11, 12, m[s[10]], m[s[11]])
+		g(2, 7, 8, 13, m[s[12]], m[s[13]])
+		g(3, 4, 9, 14, m[s[14]], m[s[15]])
+	}
+
+	for idx := range h {
+		h[idx] ^= v[idx] ^ v[idx+8]
+	}
+}
@@ -0,0 +1,83 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//compressionExtensions contains the acceptable values for `compress` in
+//[[file]] sections, and the extension that is appended to the file's path for
+//each of them.
+var compressionExtensions = map[string]string{
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+//compressFileContent compresses the content of a file (as returned by
+//parseFileContent or runContentCommand) with the given method. The output
+//only depends on the input, so that packages stay reproducible: The gzip
+//header does not contain a file name or timestamp (like `gzip -n`).
+func compressFileContent(content []byte, provider filesystem.ContentProvider, method string) ([]byte, error) {
+	if provider != nil {
+		reader, _, err := provider()
+		if err != nil {
+			return nil, err
+		}
+		content, err = ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	switch method {
+	case "gzip":
+		//cannot fail since the compression level is valid
+		gzw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		_, err := gzw.Write(content)
+		if err != nil {
+			gzw.Close()
+			return nil, err
+		}
+		err = gzw.Close()
+		if err != nil {
+			return nil, err
+		}
+	case "zstd":
+		//there is no "compress/zstd" package, so use the binary (same as
+		//in filesystem.ToTarZstdArchive)
+		err := filesystem.CompressWithProgram(&buf, func(w io.Writer) error {
+			_, err := w.Write(content)
+			return err
+		}, "zstd", "--compress", "--stdout", "--quiet", "-19")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,341 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//This file contains the evaluator for the `when` conditions of [[file]],
+//[[directory]], [[symlink]], [[action]] and [[trigger]] sections. The
+//grammar is:
+//
+//    condition  = and { "||" and }
+//    and        = unary { "&&" unary }
+//    unary      = "!" unary | "(" condition ")" | "true" | "false" | comparison
+//    comparison = operand ( "==" | "!=" ) operand
+//    operand    = variable | string
+//
+//Variables are `format` (the package format that is being built, or empty if
+//none is selected), `arch` (the architecture of the package) and the names
+//given in ParseOptions.Defines. Strings are enclosed in double or single
+//quotes and have no escape sequences. When a string is compared with `format`
+//or `arch`, it must be a known format or architecture name, and architectures
+//are compared after resolving synonyms (e.g. "amd64" is equal to "x86_64").
+//
+//The condition is evaluated while it is parsed, so all comparisons are
+//checked even if they do not affect the result.
+
+//conditionEnv contains the values of the variables in a condition.
+type conditionEnv struct {
+	Format       string
+	Architecture build.Architecture
+	Defines      map[string]string
+}
+
+//conditionError is an error in a condition, with the column (counted in
+//characters, starting at 1) where it was found.
+type conditionError struct {
+	Column  int
+	Message string
+}
+
+//Error implements the error interface.
+func (e conditionError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Message)
+}
+
+//conditionToken is a token of a condition. Kind is one of "(", ")", "!",
+//"&&", "||", "==", "!=", "variable", "string" or "end".
+type conditionToken struct {
+	Kind   string
+	Value  string
+	Column int
+}
+
+//String describes the token for error messages.
+func (t conditionToken) String() string {
+	switch t.Kind {
+	case "end":
+		return "end of condition"
+	case "variable":
+		return fmt.Sprintf("%q", t.Value)
+	case "string":
+		return fmt.Sprintf("string %q", t.Value)
+	default:
+		return fmt.Sprintf("%q", t.Kind)
+	}
+}
+
+var defineNameRx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+//ValidateDefineName checks whether the given name can be used for a variable
+//in ParseOptions.Defines.
+func ValidateDefineName(name string) error {
+	switch {
+	case !defineNameRx.MatchString(name):
+		return fmt.Errorf("cannot define %q: variable names must start with a letter or underscore and contain only letters, digits and underscores", name)
+	case name == "format" || name == "arch" || name == "true" || name == "false":
+		return fmt.Errorf("cannot define %q: this name is reserved", name)
+	}
+	return nil
+}
+
+//sortedDefineNames returns the names of the given variables in a
+//reproducible order.
+func sortedDefineNames(defines map[string]string) []string {
+	names := make([]string, 0, len(defines))
+	for name := range defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//matchesCondition evaluates the `when` condition of an entry. Entries without
+//a condition are always included. Errors are reported in `ec`.
+func matchesCondition(condition string, env conditionEnv, ec *ErrorCollector, entryDesc string) bool {
+	result, err := evaluateCondition(condition, env)
+	if err != nil {
+		ec.Addf("%s is invalid: error in \"when\" condition at %s", entryDesc, err.Error())
+		return false
+	}
+	return result
+}
+
+//evaluateCondition evaluates a `when` condition. An empty condition is true.
+func evaluateCondition(condition string, env conditionEnv) (bool, error) {
+	if strings.TrimSpace(condition) == "" {
+		return true, nil
+	}
+	tokens, err := tokenizeCondition(condition)
+	if err != nil {
+		return false, err
+	}
+	p := &conditionParser{tokens: tokens, env: env}
+	result, err := p.parseOr()
+	if err == nil {
+		if token := p.next(); token.Kind != "end" {
+			err = unexpectedToken(token, `"&&", "||" or end of condition`)
+		}
+	}
+	return result, err
+}
+
+//tokenizeCondition splits a condition into tokens. The last token is always
+//of kind "end".
+func tokenizeCondition(condition string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	runes := []rune(condition)
+	for idx := 0; idx < len(runes); {
+		r := runes[idx]
+		column := idx + 1
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			idx++
+		case r == '(' || r == ')':
+			tokens = append(tokens, conditionToken{Kind: string(r), Column: column})
+			idx++
+		case r == '!' || r == '=' || r == '&' || r == '|':
+			if idx+1 < len(runes) {
+				switch op := string(runes[idx : idx+2]); op {
+				case "==", "!=", "&&", "||":
+					tokens = append(tokens, conditionToken{Kind: op, Column: column})
+					idx += 2
+					continue
+				}
+			}
+			if r != '!' {
+				return nil, conditionError{column, fmt.Sprintf("unexpected %q (did you mean %q?)", string(r), string([]rune{r, r}))}
+			}
+			tokens = append(tokens, conditionToken{Kind: "!", Column: column})
+			idx++
+		case r == '"' || r == '\'':
+			end := idx + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, conditionError{column, "unterminated string"}
+			}
+			tokens = append(tokens, conditionToken{Kind: "string", Value: string(runes[idx+1 : end]), Column: column})
+			idx = end + 1
+		case r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z'):
+			end := idx + 1
+			for end < len(runes) && (runes[end] == '_' || (runes[end] >= 'A' && runes[end] <= 'Z') || (runes[end] >= 'a' && runes[end] <= 'z') || (runes[end] >= '0' && runes[end] <= '9')) {
+				end++
+			}
+			tokens = append(tokens, conditionToken{Kind: "variable", Value: string(runes[idx:end]), Column: column})
+			idx = end
+		default:
+			return nil, conditionError{column, fmt.Sprintf("unexpected character %q", string(r))}
+		}
+	}
+	return append(tokens, conditionToken{Kind: "end", Column: len(runes) + 1}), nil
+}
+
+func unexpectedToken(token conditionToken, expected string) error {
+	return conditionError{token.Column, fmt.Sprintf("expected %s, found %s", expected, token.String())}
+}
+
+//conditionParser is a recursive-descent parser for the grammar described at
+//the top of this file.
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+	env    conditionEnv
+}
+
+func (p *conditionParser) peek() conditionToken {
+	return p.tokens[p.pos]
+}
+
+func (p *conditionParser) next() conditionToken {
+	token := p.tokens[p.pos]
+	if token.Kind != "end" {
+		p.pos++
+	}
+	return token
+}
+
+func (p *conditionParser) parseOr() (bool, error) {
+	result, err := p.parseAnd()
+	for err == nil && p.peek().Kind == "||" {
+		p.next()
+		var other bool
+		other, err = p.parseAnd()
+		result = result || other
+	}
+	return result, err
+}
+
+func (p *conditionParser) parseAnd() (bool, error) {
+	result, err := p.parseUnary()
+	for err == nil && p.peek().Kind == "&&" {
+		p.next()
+		var other bool
+		other, err = p.parseUnary()
+		result = result && other
+	}
+	return result, err
+}
+
+func (p *conditionParser) parseUnary() (bool, error) {
+	token := p.next()
+	switch token.Kind {
+	case "!":
+		result, err := p.parseUnary()
+		return !result, err
+	case "(":
+		result, err := p.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if closing := p.next(); closing.Kind != ")" {
+			return false, unexpectedToken(closing, `"&&", "||" or ")"`)
+		}
+		return result, nil
+	case "variable":
+		if token.Value == "true" || token.Value == "false" {
+			return token.Value == "true", nil
+		}
+		return p.parseComparison(token)
+	case "string":
+		return p.parseComparison(token)
+	default:
+		return false, unexpectedToken(token, "a comparison")
+	}
+}
+
+func (p *conditionParser) parseComparison(left conditionToken) (bool, error) {
+	op := p.next()
+	if op.Kind != "==" && op.Kind != "!=" {
+		return false, unexpectedToken(op, `"==" or "!="`)
+	}
+	right := p.next()
+	if right.Kind != "variable" && right.Kind != "string" {
+		return false, unexpectedToken(right, "a variable or string")
+	}
+	equal, err := p.compare(left, right)
+	return equal == (op.Kind == "=="), err
+}
+
+//compare checks whether both operands have the same value.
+func (p *conditionParser) compare(left, right conditionToken) (bool, error) {
+	leftValue, err := p.value(left)
+	if err != nil {
+		return false, err
+	}
+	rightValue, err := p.value(right)
+	if err != nil {
+		return false, err
+	}
+
+	for _, pair := range [][2]conditionToken{{left, right}, {right, left}} {
+		variable, other := pair[0], pair[1]
+		if variable.Kind != "variable" {
+			continue
+		}
+		otherValue := rightValue
+		if other == left {
+			otherValue = leftValue
+		}
+		switch variable.Value {
+		case "arch":
+			arch, ok := archMap[otherValue]
+			if !ok {
+				return false, conditionError{other.Column, fmt.Sprintf("unknown architecture %q", otherValue)}
+			}
+			return arch == p.env.Architecture, nil
+		case "format":
+			if GeneratorFactoryFor(otherValue) == nil {
+				return false, conditionError{other.Column, fmt.Sprintf("unknown package format %q", otherValue)}
+			}
+			return otherValue == p.env.Format, nil
+		}
+	}
+	return leftValue == rightValue, nil
+}
+
+//value returns the value of an operand.
+func (p *conditionParser) value(token conditionToken) (string, error) {
+	if token.Kind == "string" {
+		return token.Value, nil
+	}
+	switch token.Value {
+	case "format":
+		return p.env.Format, nil
+	case "arch":
+		return canonicalArchNames[p.env.Architecture], nil
+	case "true", "false":
+		return "", conditionError{token.Column, fmt.Sprintf("%q cannot be compared", token.Value)}
+	}
+	value, exists := p.env.Defines[token.Value]
+	if !exists {
+		return "", conditionError{token.Column, fmt.Sprintf("unknown variable %q (not defined with --define)", token.Value)}
+	}
+	return value, nil
+}
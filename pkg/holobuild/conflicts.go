@@ -0,0 +1,332 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+	"github.com/holocm/holo-build/pkg/pkgimport"
+)
+
+//This file contains the implementation of `holo-build check-conflicts`, which
+//predicts file conflicts between packages before they are installed.
+
+//ConflictCandidate is a package whose paths are checked by CheckConflicts()
+//and CheckInstalledConflicts().
+type ConflictCandidate struct {
+	//Source is the package definition or package file that the package was
+	//read from.
+	Source  string
+	Package *build.Package
+}
+
+//magic numbers of the package formats that pkgimport.Import() understands
+//(Debian packages are ar archives, Pacman packages are compressed with xz or
+//zstd)
+var packageMagics = [][]byte{
+	[]byte("!<arch>\n"),
+	{0xed, 0xab, 0xee, 0xdb},
+	{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00},
+	{0x28, 0xb5, 0x2f, 0xfd},
+}
+
+//ReadConflictCandidate reads a package definition (only its metadata and
+//the paths of its entries, see ParseMetadataOnly), or a Debian, Pacman or RPM
+//package that was built by holo-build.
+func ReadConflictCandidate(fileName string, opts ParseOptions) (ConflictCandidate, []error) {
+	result := ConflictCandidate{Source: fileName}
+	if !isURL(fileName) {
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return result, []error{err}
+		}
+		for _, magic := range packageMagics {
+			if !bytes.HasPrefix(data, magic) {
+				continue
+			}
+			imported, err := pkgimport.Import(data)
+			if err != nil {
+				return result, []error{fmt.Errorf("cannot import %s: %s", fileName, err.Error())}
+			}
+			result.Package = imported.Package
+			return result, nil
+		}
+	}
+
+	opts.Mode = ParseMetadataOnly
+	//warnings about the package definition are not relevant for conflicts
+	pkg, _, errs := ParsePackageDefinitionFiles([]string{fileName}, opts)
+	result.Package = pkg
+	return result, errs
+}
+
+//FileOwner is a package that claims a path (see FileConflict).
+type FileOwner struct {
+	//Package is the name of the package.
+	Package string
+	//Source is ConflictCandidate.Source, or empty for installed packages.
+	Source string
+}
+
+//String returns a description like "foo (from foo.pkg.toml)".
+func (o FileOwner) String() string {
+	if o.Source == "" {
+		return "installed package " + o.Package
+	}
+	return fmt.Sprintf("%s (from %s)", o.Package, o.Source)
+}
+
+//FileConflict is a path that is claimed by more than one package.
+type FileConflict struct {
+	Path   string
+	Owners []FileOwner
+}
+
+//String returns a description like "/etc/foo.conf is claimed by foo (from
+//foo.pkg.toml) and bar (from bar.pkg.toml)".
+func (c FileConflict) String() string {
+	owners := make([]string, len(c.Owners))
+	for idx, owner := range c.Owners {
+		owners[idx] = owner.String()
+	}
+	last := len(owners) - 1
+	if last == 0 {
+		return fmt.Sprintf("%s is claimed by %s", c.Path, owners[0])
+	}
+	return fmt.Sprintf("%s is claimed by %s and %s", c.Path, strings.Join(owners[:last], ", "), owners[last])
+}
+
+//declaresConflict returns whether the package cannot be installed together
+//with the package of the given name (or takes over its files), because it
+//conflicts with, replaces or supersedes it.
+func declaresConflict(pkg *build.Package, name string) bool {
+	for _, rels := range [][]build.PackageRelation{pkg.Conflicts, pkg.Replaces, pkg.Supersedes} {
+		for _, rel := range rels {
+			if rel.RelatedPackage == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//canShareFiles returns false if the two packages would fight over the same
+//path, i.e. unless they are the same package (e.g. a package definition and
+//the package built from it), or one of them declares a conflict with the
+//other.
+func canShareFiles(a, b *build.Package) bool {
+	return a.Name == b.Name || declaresConflict(a, b.Name) || declaresConflict(b, a.Name)
+}
+
+//pathClaim is an entry in a package as seen by CheckConflicts().
+type pathClaim struct {
+	Candidate   ConflictCandidate
+	IsDirectory bool
+}
+
+//CheckConflicts returns all paths that are claimed by more than one of the
+//given packages, sorted by path. Directories may be shared by any number of
+//packages, but other entries (regular files and symlinks) conflict with
+//every other entry at the same path, unless both packages can share files
+//(because they are the same package, or one of them conflicts with, replaces
+//or supersedes the other).
+func CheckConflicts(candidates []ConflictCandidate) []FileConflict {
+	claims := make(map[string][]pathClaim)
+	for _, candidate := range candidates {
+		candidate.Package.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+			_, isDir := node.(*filesystem.Directory)
+			claims[absolutePath] = append(claims[absolutePath], pathClaim{candidate, isDir})
+			return nil
+		})
+	}
+
+	paths := make([]string, 0, len(claims))
+	for path := range claims {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var result []FileConflict
+	for _, path := range paths {
+		pathClaims := claims[path]
+		isInvolved := make([]bool, len(pathClaims))
+		for i := range pathClaims {
+			for j := i + 1; j < len(pathClaims); j++ {
+				a, b := pathClaims[i], pathClaims[j]
+				if (a.IsDirectory && b.IsDirectory) || canShareFiles(a.Candidate.Package, b.Candidate.Package) {
+					continue
+				}
+				isInvolved[i] = true
+				isInvolved[j] = true
+			}
+		}
+
+		conflict := FileConflict{Path: path}
+		for idx, claim := range pathClaims {
+			if isInvolved[idx] {
+				conflict.Owners = append(conflict.Owners, FileOwner{claim.Candidate.Package.Name, claim.Candidate.Source})
+			}
+		}
+		if len(conflict.Owners) > 0 {
+			result = append(result, conflict)
+		}
+	}
+	return result
+}
+
+//installedFileOwnerQuery describes a command that prints the names of the
+//installed packages owning the path that is appended to the given arguments.
+//It exits with status 1 if the path is not owned by any package.
+type installedFileOwnerQuery struct {
+	Program string
+	Args    []string
+	//Parse extracts the package names from the output.
+	Parse func(output string) []string
+}
+
+var installedFileOwnerQueries = map[string]installedFileOwnerQuery{
+	//output looks like "foo, bar:amd64: /etc/foo.conf" (and "diversion by
+	//... from/to: ..." for diverted files, which we skip)
+	"debian": {"dpkg-query", []string{"--search", "--"}, func(output string) []string {
+		var result []string
+		for _, line := range strings.Split(output, "\n") {
+			idx := strings.Index(line, ": /")
+			if idx < 0 || strings.HasPrefix(line, "diversion by ") {
+				continue
+			}
+			for _, name := range strings.Split(line[:idx], ", ") {
+				result = append(result, strings.SplitN(name, ":", 2)[0])
+			}
+		}
+		return result
+	}},
+	"pacman": {"pacman", []string{"-Qqo", "--"}, strings.Fields},
+	"rpm":    {"rpm", []string{"-qf", "--queryformat", "%{NAME}\\n", "--"}, strings.Fields},
+}
+
+//queryInstalledFileOwners returns the names of the installed packages that
+//own the given path.
+func queryInstalledFileOwners(query installedFileOwnerQuery, path string) ([]string, error) {
+	cmd := exec.Command(query.Program, append(query.Args, path)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return nil, nil //not owned by any package
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot find owner of %s: %s failed: %s\n%s",
+			path, query.Program, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	return query.Parse(stdout.String()), nil
+}
+
+//CheckInstalledConflicts returns all paths in the given packages that are
+//owned by installed packages, according to the package database of the given
+//package format (using `dpkg-query --search`, `pacman -Qo` or `rpm -qf`),
+//sorted by path. Like in CheckConflicts(), directories may be shared, and
+//installed packages that can share files with a package are skipped (in
+//particular, older versions of the same package).
+func CheckInstalledConflicts(candidates []ConflictCandidate, format string) ([]FileConflict, error) {
+	query, exists := installedFileOwnerQueries[format]
+	if !exists {
+		return nil, fmt.Errorf("cannot check for conflicts with installed packages for package format \"%s\" (only \"debian\", \"pacman\" and \"rpm\" are supported)", format)
+	}
+	_, err := exec.LookPath(query.Program)
+	if err != nil {
+		return nil, fmt.Errorf("cannot check for conflicts with installed packages: %s not found", query.Program)
+	}
+
+	conflicts := make(map[string]*FileConflict)
+	ownersCache := make(map[string][]string)
+	for _, candidate := range candidates {
+		err := candidate.Package.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+			if _, isDir := node.(*filesystem.Directory); isDir {
+				return nil
+			}
+			//only paths that exist can be owned by installed packages
+			if _, err := os.Lstat(absolutePath); err != nil {
+				return nil
+			}
+			owners, cached := ownersCache[absolutePath]
+			if !cached {
+				var err error
+				owners, err = queryInstalledFileOwners(query, absolutePath)
+				if err != nil {
+					return err
+				}
+				ownersCache[absolutePath] = owners
+			}
+
+			var conflictingOwners []FileOwner
+			for _, owner := range owners {
+				if !canShareFiles(candidate.Package, &build.Package{Name: owner}) {
+					conflictingOwners = append(conflictingOwners, FileOwner{Package: owner})
+				}
+			}
+			if len(conflictingOwners) == 0 {
+				return nil
+			}
+			conflict := conflicts[absolutePath]
+			if conflict == nil {
+				conflict = &FileConflict{Path: absolutePath}
+				conflicts[absolutePath] = conflict
+			}
+			for _, owner := range conflictingOwners {
+				if !containsOwner(conflict.Owners, owner) {
+					conflict.Owners = append(conflict.Owners, owner)
+				}
+			}
+			conflict.Owners = append(conflict.Owners, FileOwner{candidate.Package.Name, candidate.Source})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]FileConflict, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		result = append(result, *conflict)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+func containsOwner(owners []FileOwner, owner FileOwner) bool {
+	for _, o := range owners {
+		if o == owner {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"os"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//DefaultsSection only needs a nice exported name for the TOML parser to
+//produce more meaningful error messages on malformed input data.
+type DefaultsSection struct {
+	FileMode      string      `explain:"Mode bits for [[file]] sections without mode" default:"\"0644\""`                //see FileSection.Mode
+	DirectoryMode string      `explain:"Mode bits for [[directory]] sections without mode" default:"\"0755\""`           //see FileSection.Mode
+	Owner         interface{} `explain:"Owner for [[file]] and [[directory]] sections without owner" default:"\"root\""` //see FileSection.Owner
+	Group         interface{} `explain:"Group for [[file]] and [[directory]] sections without group" default:"\"root\""` //see FileSection.Group
+}
+
+//fsDefaults contains the parsed contents of the [defaults] section.
+type fsDefaults struct {
+	FileMode      os.FileMode
+	DirectoryMode os.FileMode
+	Owner         *filesystem.IntOrString
+	Group         *filesystem.IntOrString
+}
+
+func parseDefaults(d DefaultsSection, ec *ErrorCollector) fsDefaults {
+	entryDesc := "section [defaults]"
+	return fsDefaults{
+		FileMode:      parseFileMode(d.FileMode, 0644, ec, entryDesc),
+		DirectoryMode: parseFileMode(d.DirectoryMode, 0755, ec, entryDesc),
+		Owner:         parseUserOrGroupRef(d.Owner, ec, entryDesc),
+		Group:         parseUserOrGroupRef(d.Group, ec, entryDesc),
+	}
+}
+
+//resolveOwnership fills in the owner and group of all FS entries that do not
+//have an explicit owner or group. Entries below a directory with an owner or
+//group inherit it from the closest such directory. Otherwise, entries that
+//were defined explicitly (i.e. that are contained in `explicit`) use the
+//owner/group from the [defaults] section. Implicitly created directories and
+//other generated entries stay owned by root in this case.
+//
+//This must run after all [[file]] and [[directory]] sections have been
+//inserted into the package.
+func resolveOwnership(pkg *build.Package, defaults fsDefaults, explicit map[filesystem.Node]bool) {
+	var visit func(dir *filesystem.Directory, owner, group *filesystem.IntOrString)
+	visit = func(dir *filesystem.Directory, owner, group *filesystem.IntOrString) {
+		for _, node := range dir.Entries {
+			var metadata *filesystem.NodeMetadata
+			switch n := node.(type) {
+			case *filesystem.Directory:
+				metadata = &n.Metadata
+			case *filesystem.RegularFile:
+				metadata = &n.Metadata
+			default:
+				//symlinks only get an owner or group when one is given explicitly
+				continue
+			}
+
+			if metadata.Owner == nil {
+				metadata.Owner = inheritedRef(owner, defaults.Owner, explicit[node])
+			}
+			if metadata.Group == nil {
+				metadata.Group = inheritedRef(group, defaults.Group, explicit[node])
+			}
+
+			if subdir, ok := node.(*filesystem.Directory); ok {
+				visit(subdir, metadata.Owner, metadata.Group)
+			}
+		}
+	}
+	visit(pkg.FSRoot, nil, nil)
+}
+
+//inheritedRef is a helper for resolveOwnership that chooses between an
+//inherited and a default owner/group.
+func inheritedRef(inherited, fromDefaults *filesystem.IntOrString, isExplicit bool) *filesystem.IntOrString {
+	ref := inherited
+	if ref == nil && isExplicit {
+		ref = fromDefaults
+	}
+	if ref == nil {
+		return nil
+	}
+	//copy the value, so that later modifications of one node's metadata do
+	//not affect the others
+	value := *ref
+	return &value
+}
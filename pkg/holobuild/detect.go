@@ -0,0 +1,125 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//formatsByDistributionID maps values of ID and ID_LIKE from os-release(5) to
+//package formats.
+var formatsByDistributionID = map[string]string{
+	"arch":    "pacman",
+	"debian":  "debian",
+	"fedora":  "rpm",
+	"freebsd": "freebsd",
+	"mageia":  "rpm",
+	"suse":    "rpm",
+}
+
+//packageManagers is used by DetectFormat() when the distribution is not
+//recognized. The order matters since some distributions ship rpm as a
+//regular tool next to their native package manager.
+var packageManagers = []struct {
+	Path   string
+	Format string
+}{
+	{"/usr/bin/pacman", "pacman"},
+	{"/usr/bin/dpkg", "debian"},
+	{"/usr/bin/rpm", "rpm"},
+	{"/usr/sbin/pkg", "freebsd"},
+}
+
+//DetectFormat selects the package format that is native to the host system.
+//The distribution is identified through os-release(5). If it is not known, the
+//presence of the native package manager is checked instead.
+//
+//If the environment variable HOLO_ROOT_DIR is set, the host system's files are
+//looked up below this directory instead of below "/" (for use in tests).
+func DetectFormat() (string, error) {
+	rootDir := os.Getenv("HOLO_ROOT_DIR")
+	if rootDir == "" {
+		rootDir = "/"
+	}
+
+	distIDs, err := readDistributionIDs(rootDir)
+	if err != nil {
+		return "", err
+	}
+	for _, distID := range distIDs {
+		if format, exists := formatsByDistributionID[distID]; exists {
+			return format, nil
+		}
+	}
+
+	for _, pm := range packageManagers {
+		fi, err := os.Stat(filepath.Join(rootDir, pm.Path))
+		if err == nil && !fi.IsDir() {
+			return pm.Format, nil
+		}
+	}
+
+	return "", fmt.Errorf(
+		"cannot select a package format for this distribution (distribution IDs: %s); use --format to choose one",
+		strings.Join(distIDs, ", "),
+	)
+}
+
+//readDistributionIDs returns the values of ID and ID_LIKE from os-release(5),
+//in this order.
+func readDistributionIDs(rootDir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(rootDir, "etc/os-release"))
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(rootDir, "usr/lib/os-release"))
+	}
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var id, idLike string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(fields) != 2 {
+			continue //also skips empty lines and comments
+		}
+		value := strings.Trim(fields[1], `"'`)
+		switch fields[0] {
+		case "ID":
+			id = value
+		case "ID_LIKE":
+			idLike = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(id + " " + idLike), nil
+}
@@ -18,15 +18,17 @@
 *
 *******************************************************************************/
 
-package main
+package holobuild
 
 import (
 	"bytes"
+	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/BurntSushi/toml"
-	"github.com/holocm/libpackagebuild/filesystem"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
 )
 
 //This file contains the parts of parser.go relating to the support for entity
@@ -34,26 +36,30 @@ import (
 //process, these definitions are converted into an file entry in the package
 //containing the entity definition file, so that other parts of holo-build do
 //not need to know about entity definitions at all.
+//
+//With `entityMode = "native"`, the definitions are instead converted into a
+//pre-setup script that calls groupadd(8) and useradd(8) directly, so that the
+//package does not depend on holo-users-groups.
 
 //UserSection only needs a nice exported name for the TOML parser to
 //produce more meaningful error messages on malformed input data.
 type UserSection struct {
-	Name    string   `toml:"name"`
-	Comment string   `toml:"comment"`
-	UID     uint32   `toml:"uid"`
-	System  bool     `toml:"system"`
-	Home    string   `toml:"home"`
-	Group   string   `toml:"group"`
-	Groups  []string `toml:"groups"`
-	Shell   string   `toml:"shell"`
+	Name    string   `toml:"name" explain:"Name of the user" required:"true"`
+	Comment string   `toml:"comment" explain:"Comment (GECOS field) of the user"`
+	UID     uint32   `toml:"uid" explain:"Numeric ID of the user (chosen automatically if not given)"`
+	System  bool     `toml:"system" explain:"Create a system user"`
+	Home    string   `toml:"home" explain:"Home directory of the user"`
+	Group   string   `toml:"group" explain:"Name of the primary group of the user"`
+	Groups  []string `toml:"groups" explain:"Names of supplementary groups of the user"`
+	Shell   string   `toml:"shell" explain:"Login shell of the user"`
 }
 
 //GroupSection only needs a nice exported name for the TOML parser to
 //produce more meaningful error messages on malformed input data.
 type GroupSection struct {
-	Name   string `toml:"name"`
-	Gid    uint32 `toml:"gid"`
-	System bool   `toml:"system"`
+	Name   string `toml:"name" explain:"Name of the group" required:"true"`
+	Gid    uint32 `toml:"gid" explain:"Numeric ID of the group (chosen automatically if not given)"`
+	System bool   `toml:"system" explain:"Create a system group"`
 }
 
 //this regexp copied from useradd(8) manpage
@@ -75,6 +81,10 @@ func parseUserOrGroupRef(value interface{}, ec *ErrorCollector, entryDesc string
 		if val >= 1<<32 {
 			ec.Addf("%s is invalid: user or group ID \"%d\" does not fit in uint32", entryDesc, val)
 		}
+		//(uid_t)-1 means "unchanged" to chown(2), so files cannot be owned by it
+		if val == 1<<32-1 {
+			ec.Addf("%s is invalid: user or group ID \"%d\" is reserved", entryDesc, val)
+		}
 		return &filesystem.IntOrString{Int: uint32(val)}
 	case string:
 		if !userOrGroupRx.MatchString(val) {
@@ -89,7 +99,7 @@ func parseUserOrGroupRef(value interface{}, ec *ErrorCollector, entryDesc string
 
 var definitionFileRx = regexp.MustCompile(`^/usr/share/holo/users-groups/[^/]+.toml$`)
 
-func compileEntityDefinitions(pkg PackageSection, groups []GroupSection, users []UserSection, ec *ErrorCollector) (node filesystem.Node, path string) {
+func compileEntityDefinitions(pkg PackageSection, groups []GroupSection, users []UserSection, parseMode ParseMode, ec *ErrorCollector) (node filesystem.Node, path string) {
 	//only add an entity definition file if it is required
 	if len(groups) == 0 && len(users) == 0 {
 		return nil, ""
@@ -104,15 +114,17 @@ func compileEntityDefinitions(pkg PackageSection, groups []GroupSection, users [
 		ec.Addf("\"%s\" is not an acceptable definition file (should look like \"/usr/share/holo/users-groups/01-foo.toml\")", path)
 		path = "" //indicate broken path to caller
 	default:
-		WarnDeprecatedKey("package.definitionFile")
+		ec.warnDeprecatedKey("package.definitionFile")
 	}
 
-	//validate users/groups
-	for idx, group := range groups {
-		validateGroup(group, ec, idx)
-	}
-	for idx, user := range users {
-		validateUser(user, ec, idx)
+	validateEntities(groups, users, ec)
+
+	//the contents of the definition file are not needed for describing the
+	//package
+	if parseMode == ParseMetadataOnly {
+		return &filesystem.RegularFile{
+			Metadata: filesystem.NodeMetadata{Mode: 0644},
+		}, path
 	}
 
 	//encode into a definition file
@@ -129,7 +141,7 @@ func compileEntityDefinitions(pkg PackageSection, groups []GroupSection, users [
 
 	//toml.Encode does not support the omitempty flag yet, so remove unset fields manually
 	pruneRx := regexp.MustCompile(`(?m:^\s*[a-z]+ = (?:0|""|false)$)\n`)
-	content := pruneRx.ReplaceAllString(string(buf.Bytes()), "")
+	content := pruneRx.ReplaceAll(buf.Bytes(), nil)
 
 	return &filesystem.RegularFile{
 		Content:  content,
@@ -137,6 +149,84 @@ func compileEntityDefinitions(pkg PackageSection, groups []GroupSection, users [
 	}, path
 }
 
+//compileEntityScript is the alternative to compileEntityDefinitions for
+//`entityMode = "native"`. It renders the users and groups into a shell script
+//that creates them (unless they exist already) before the package's files are
+//installed.
+func compileEntityScript(pkg PackageSection, groups []GroupSection, users []UserSection, ec *ErrorCollector) string {
+	if pkg.DefinitionFile != "" {
+		ec.Addf("\"package.definitionFile\" cannot be used with entityMode = \"native\"")
+	}
+	validateEntities(groups, users, ec)
+
+	//groups go first since users may refer to them
+	var lines []string
+	for _, group := range groups {
+		cmd := []string{"groupadd"}
+		if group.System {
+			cmd = append(cmd, "--system")
+		}
+		if group.Gid != 0 {
+			cmd = append(cmd, "--gid", strconv.FormatUint(uint64(group.Gid), 10))
+		}
+		cmd = append(cmd, shellQuote(group.Name))
+		lines = append(lines, fmt.Sprintf("getent group %s >/dev/null || %s",
+			shellQuote(group.Name), strings.Join(cmd, " "),
+		))
+	}
+	for _, user := range users {
+		cmd := []string{"useradd"}
+		if user.System {
+			cmd = append(cmd, "--system")
+		}
+		if user.UID != 0 {
+			cmd = append(cmd, "--uid", strconv.FormatUint(uint64(user.UID), 10))
+		}
+		if user.Comment != "" {
+			cmd = append(cmd, "--comment", shellQuote(user.Comment))
+		}
+		if user.Home != "" {
+			cmd = append(cmd, "--home-dir", shellQuote(user.Home))
+		}
+		if user.Group != "" {
+			cmd = append(cmd, "--gid", shellQuote(user.Group))
+		}
+		if len(user.Groups) > 0 {
+			cmd = append(cmd, "--groups", shellQuote(strings.Join(user.Groups, ",")))
+		}
+		if user.Shell != "" {
+			cmd = append(cmd, "--shell", shellQuote(user.Shell))
+		}
+		cmd = append(cmd, shellQuote(user.Name))
+		lines = append(lines, fmt.Sprintf("getent passwd %s >/dev/null || %s",
+			shellQuote(user.Name), strings.Join(cmd, " "),
+		))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+//strings that can be used in a shell script without quoting
+var shellSafeRx = regexp.MustCompile(`^[A-Za-z0-9_./:,=+@%-]+$`)
+
+//shellQuote quotes the given string for use as a single word in a shell
+//script, if necessary.
+func shellQuote(str string) string {
+	if shellSafeRx.MatchString(str) {
+		return str
+	}
+	return "'" + strings.Replace(str, "'", `'\''`, -1) + "'"
+}
+
+func validateEntities(groups []GroupSection, users []UserSection, ec *ErrorCollector) {
+	for idx, group := range groups {
+		validateGroup(group, ec, idx)
+	}
+	for idx, user := range users {
+		validateUser(user, ec, idx)
+	}
+}
+
 func validateGroup(group GroupSection, ec *ErrorCollector, entryIdx int) {
 	//check group name
 	switch {
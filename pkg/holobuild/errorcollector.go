@@ -18,7 +18,7 @@
 *
 *******************************************************************************/
 
-package main
+package holobuild
 
 import (
 	"errors"
@@ -27,9 +27,10 @@ import (
 
 //ErrorCollector is a wrapper around []error that simplifies code where
 //multiple errors can happen and need to be aggregated for collective display
-//in an error display.
+//in an error display. Non-fatal problems are collected in Warnings.
 type ErrorCollector struct {
-	Errors []error
+	Errors   []error
+	Warnings []string
 }
 
 //Add adds an error to this collector. If nil is given, nothing happens, so you
@@ -60,3 +61,9 @@ func (c *ErrorCollector) Addf(format string, args ...interface{}) {
 		c.Errors = append(c.Errors, errors.New(format))
 	}
 }
+
+//Warnf adds a warning to this collector by passing the arguments into
+//fmt.Sprintf(). Warnings do not count as errors.
+func (c *ErrorCollector) Warnf(format string, args ...interface{}) {
+	c.Warnings = append(c.Warnings, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,172 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//This file contains support for package definitions that are fetched over
+//HTTP(S) (see Options.InputFileName). For those, the base directory of the
+//sections is the URL of the directory containing the package definition, and
+//all paths in them (`contentFrom`, `scriptFrom`, `include` etc.) are resolved
+//relative to that URL.
+
+//fetchTimeout limits how long fetchURL() waits for a response.
+const fetchTimeout = 60 * time.Second
+
+//isURL returns whether the given path (or base directory) is an HTTP(S) URL.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+//resolvePath resolves a path from a package definition relative to the base
+//directory of the section containing it. If the base directory is a URL,
+//absolute paths are resolved relative to that URL as well, so that a package
+//definition from a URL cannot read local files.
+func resolvePath(baseDirectory, path string) string {
+	if isURL(baseDirectory) {
+		base, err := url.Parse(baseDirectory)
+		if err != nil {
+			return path //cannot happen since the URL was fetched successfully
+		}
+		ref, err := url.Parse(path)
+		if err != nil {
+			//report the error when the path is read
+			return baseDirectory + path
+		}
+		return base.ResolveReference(ref).String()
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDirectory, path)
+}
+
+//urlDirectory returns the URL of the directory containing the document at
+//the given URL, e.g. "https://example.org/defs/" for
+//"https://example.org/defs/foo.toml".
+func urlDirectory(u string) string {
+	return resolvePath(u, "./")
+}
+
+//definitionDirectory returns the base directory for sections in the package
+//definition at the given path or URL.
+func definitionDirectory(fileName string) string {
+	if isURL(fileName) {
+		return urlDirectory(fileName)
+	}
+	return filepath.Dir(fileName)
+}
+
+//readPathOrURL reads the file at the given path, or downloads it if the path
+//is a URL.
+func readPathOrURL(fileName string) ([]byte, error) {
+	if isURL(fileName) {
+		return fetchURL(fileName)
+	}
+	return ioutil.ReadFile(fileName)
+}
+
+//fetchURL downloads the document at the given HTTP(S) URL.
+func fetchURL(u string) ([]byte, error) {
+	client := http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", u, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+//readReferencedFile reads a file that is referenced by a package definition
+//(e.g. with `scriptFrom`), after it has been resolved with resolvePath().
+//Downloaded files are recorded in `inputs`; local files are recorded by the
+//caller with inputRecorder.RecordFile().
+func readReferencedFile(path string, inputs *inputRecorder) ([]byte, error) {
+	data, err := readPathOrURL(path)
+	if err != nil || !isURL(path) {
+		return data, err
+	}
+	inputs.RecordBlob(path, data)
+	return data, nil
+}
+
+//fetchContentFrom downloads the file for a `contentFrom` URL. If the file's
+//checksum is known from `contentFromSha256` and a cache directory is given,
+//the download is cached there, keyed by the URL and the checksum. Only
+//downloads with the expected checksum are put into the cache (the checksum is
+//reported by verifyContentDigest).
+func fetchContentFrom(u, expectedSHA256, cacheDirectory string, inputs *inputRecorder) ([]byte, error) {
+	if cacheDirectory == "" || !sha256Rx.MatchString(expectedSHA256) {
+		return readReferencedFile(u, inputs)
+	}
+	key := sha256.Sum256([]byte(u + "\n" + strings.ToLower(expectedSHA256)))
+	cachePath := filepath.Join(cacheDirectory, hex.EncodeToString(key[:]))
+
+	//a cache entry is only used if it is intact
+	data, err := ioutil.ReadFile(cachePath)
+	if err == nil && checkSHA256(u, data, expectedSHA256) == nil {
+		inputs.RecordBlob(u, data)
+		return data, nil
+	}
+
+	data, err = readReferencedFile(u, inputs)
+	if err != nil || checkSHA256(u, data, expectedSHA256) != nil {
+		return data, err
+	}
+	err = os.MkdirAll(cacheDirectory, 0755)
+	if err == nil {
+		err = writeFileAtomically(cachePath, data, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot write %s to download cache: %s", u, err.Error())
+	}
+	return data, nil
+}
+
+//checkSHA256 implements Options.InputSHA256.
+func checkSHA256(name string, data []byte, expected string) error {
+	sum := sha256.Sum256(data)
+	return compareSHA256(name, sum[:], expected)
+}
+
+//compareSHA256 is like checkSHA256, but takes the SHA-256 digest of the data
+//instead of the data itself.
+func compareSHA256(name string, sum []byte, expected string) error {
+	actual := hex.EncodeToString(sum)
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch for %s: expected SHA-256 %s, got %s", name, strings.ToLower(expected), actual)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build gofuzz
+// +build gofuzz
+
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bytes"
+
+	"github.com/BurntSushi/toml"
+)
+
+//Fuzz is the entry point for go-fuzz (see "Fuzzing" in test/README.md). It
+//parses the input as a package definition and describes the resulting
+//package in every supported format.
+func Fuzz(data []byte) int {
+	//package definitions with `include` would make the fuzzer read arbitrary
+	//files, so reject those early
+	var includes struct {
+		Include []string
+	}
+	_, err := toml.Decode(string(data), &includes)
+	if err != nil {
+		return 0
+	}
+	if len(includes.Include) > 0 {
+		return -1
+	}
+
+	pkg, _, errs := ParsePackageDefinition(bytes.NewReader(data), ParseOptions{Mode: ParseMetadataOnly})
+	if len(errs) > 0 {
+		return 0
+	}
+	for _, format := range Formats {
+		generator := GeneratorFactoryFor(format)(pkg)
+		generator.Validate()
+		generator.RecommendedFileName()
+	}
+	return 1
+}
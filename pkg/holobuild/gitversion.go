@@ -0,0 +1,127 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//PackageVersion contains the parts of a package's version that can be
+//replaced with ParseOptions.Version (e.g. by the result of VersionFromGit).
+type PackageVersion struct {
+	Version           string
+	PrereleaseType    build.PrereleaseType
+	PrereleaseVersion uint
+	Release           uint
+}
+
+//String formats the version like in `git describe` tags, e.g. "1.2-beta.3"
+//for version 1.2, beta 3 (the release is not included).
+func (v PackageVersion) String() string {
+	if v.PrereleaseType == build.PrereleaseTypeNone {
+		return v.Version
+	}
+	return fmt.Sprintf("%s-%s.%d", v.Version, v.PrereleaseType, v.PrereleaseVersion)
+}
+
+//`git describe --long` output looks like "$TAG-$COUNT-g$HASH", optionally
+//followed by "-dirty"
+var gitDescribeRx = regexp.MustCompile(`^(.+)-([0-9]+)-g[0-9a-f]+$`)
+
+//acceptable tags look like "v1.2.0", "1.2.0", "v1.2.0-beta.3" or
+//"v1.2.0-alpha"; the version part must match versionRx
+var gitTagRx = regexp.MustCompile(`^v?((?:0|[1-9][0-9]*)(?:\.(?:0|[1-9][0-9]*))*)(?:[-~.]?(alpha|beta)(?:\.?([1-9][0-9]*))?)?$`)
+
+//VersionFromGit derives a package version from `git describe` in the git
+//repository containing the given directory. The most recent tag that looks
+//like a version number (e.g. "v1.2.0" or "1.2.0-beta.3") provides the
+//version and prerelease version. The number of commits since this tag is
+//added to the release (i.e. the release is 1 if the tag points to HEAD). For
+//tags of prereleases without a number (e.g. "v1.2.0-beta"), the number of
+//commits since the tag is added to the prerelease version instead.
+//
+//The returned bool is true if the working tree has uncommitted changes, in
+//which case the package contents do not match the version exactly.
+func VersionFromGit(directory string) (PackageVersion, bool, error) {
+	var result PackageVersion
+
+	cmd := exec.Command("git", "-C", directory, "describe", "--tags", "--long", "--dirty",
+		"--match", "v[0-9]*", "--match", "[0-9]*")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return result, false, fmt.Errorf("cannot determine version from git: %s", msg)
+	}
+
+	description := strings.TrimSpace(stdout.String())
+	dirty := strings.HasSuffix(description, "-dirty")
+	description = strings.TrimSuffix(description, "-dirty")
+	match := gitDescribeRx.FindStringSubmatch(description)
+	if match == nil {
+		return result, false, fmt.Errorf("cannot determine version from git: unexpected output from `git describe`: %q", description)
+	}
+	tag := match[1]
+	commitCount, err := strconv.ParseUint(match[2], 10, 32)
+	if err != nil {
+		return result, false, fmt.Errorf("cannot determine version from git: %s", err.Error())
+	}
+
+	tagMatch := gitTagRx.FindStringSubmatch(tag)
+	if tagMatch == nil {
+		return result, false, fmt.Errorf("cannot determine version from git: tag %q does not look like a version number (e.g. \"v1.2.0\" or \"v1.2.0-beta.3\")", tag)
+	}
+	result.Version = tagMatch[1]
+	result.Release = 1
+	switch tagMatch[2] {
+	case "alpha":
+		result.PrereleaseType = build.PrereleaseTypeAlpha
+	case "beta":
+		result.PrereleaseType = build.PrereleaseTypeBeta
+	}
+
+	switch {
+	case result.PrereleaseType == build.PrereleaseTypeNone:
+		result.Release += uint(commitCount)
+	case tagMatch[3] == "":
+		result.PrereleaseVersion = 1 + uint(commitCount)
+	default:
+		prereleaseVersion, err := strconv.ParseUint(tagMatch[3], 10, 32)
+		if err != nil {
+			return result, false, fmt.Errorf("cannot determine version from git: invalid prerelease version in tag %q", tag)
+		}
+		result.PrereleaseVersion = uint(prereleaseVersion)
+		result.Release += uint(commitCount)
+	}
+	return result, dirty, nil
+}
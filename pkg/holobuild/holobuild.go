@@ -0,0 +1,939 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+//Package holobuild contains the functionality of the holo-build command-line
+//tool in a form that can be embedded into other programs. Most callers will
+//only need Run(), which covers the whole process from parsing the package
+//definition to writing the package file.
+package holobuild
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/debian"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/freebsd"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/nix"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/oci"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/pacman"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/rpm"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/tarball"
+	"github.com/holocm/holo-build/pkg/pkgimport"
+)
+
+//Options contains the parameters for Run().
+type Options struct {
+	//Format is the package format to generate ("debian", "pacman", "rpm",
+	//"freebsd", "oci-layer", "tar", "makeself" or "nix").
+	Format string
+	//Architecture overrides the architecture from the package definition if
+	//not empty. It is ignored by RunAllArchitectures().
+	Architecture string
+	//Defines contains the values of variables for `when` conditions in the
+	//package definition (see ParseOptions.Defines).
+	Defines map[string]string
+	//Input is where the package definition is read from. If nil, the package
+	//definition is read from the file at InputFileName.
+	Input io.Reader
+	//InputFileName is the path to the package definition. Relative
+	//`contentFrom` paths are resolved relative to its directory, or relative
+	//to the working directory if empty (unless BaseDirectory is set).
+	//
+	//InputFileName may also be an HTTP(S) URL. In this case, all paths in the
+	//package definition (including absolute paths) are resolved relative to
+	//this URL and downloaded as well, unless BaseDirectory is set.
+	//`contentFromCommand` is not allowed in such package definitions.
+	InputFileName string
+	//InputSHA256, if not empty, is the expected SHA-256 checksum (in
+	//hexadecimal) of the package definition. This cannot be combined with
+	//AdditionalInputFileNames.
+	InputSHA256 string
+	//AdditionalInputFileNames are paths to further package definitions that
+	//are merged with the one at InputFileName into a single package (see
+	//ParsePackageDefinitionFiles). This cannot be combined with Input.
+	AdditionalInputFileNames []string
+	//BaseDirectory, if not empty, is where relative paths in the package
+	//definitions (`contentFrom`, `scriptFrom`, `include` etc.) are resolved,
+	//instead of the directory of InputFileName (or the working directory).
+	//Paths in included definitions are still resolved relative to the
+	//directory of the included file.
+	BaseDirectory string
+	//OutputFileName is the path where the package will be written. If "-",
+	//the package is written to standard output. If empty or a directory, the
+	//package is written into the working directory or into that directory
+	//(respectively) using its recommended file name.
+	OutputFileName string
+	//NoOutput stops Run() from writing the package anywhere. It is still
+	//returned in Result.Contents.
+	NoOutput bool
+	//FilenameOnly stops Run() after validation, so that only
+	//Result.FileName is filled. The package definition is parsed with
+	//ParseMetadataOnly, so files referenced by it need not exist.
+	FilenameOnly bool
+	//ValidateOnly stops Run() after validation, so that only Result.Package
+	//and Result.FileName are filled. Unlike FilenameOnly, files referenced by
+	//the package definition are read, so that missing files are reported.
+	ValidateOnly bool
+	//PlanOnly stops Run() before the package is rendered, so that only
+	//Result.Package, Result.FileName and Result.Plan are filled. This is only
+	//supported for package formats whose generator implements build.Planner.
+	PlanOnly bool
+	//Plan, if not nil, is rendered into the package instead of the plan that
+	//the generator computes from the package definition (see
+	//build.Planner.Render). This is only supported for package formats whose
+	//generator implements build.Planner. The build cache is not used.
+	Plan *build.Plan
+	//AllowExec allows `contentFromCommand` in [[file]] sections. The
+	//commands are run with sh(1) while the package definition is parsed.
+	AllowExec bool
+	//AllowNetwork allows `contentFrom` in [[file]] sections to refer to an
+	//HTTP(S) URL (see ParseOptions.AllowNetwork). If CacheDirectory is set,
+	//downloads are cached in its "downloads" subdirectory.
+	AllowNetwork bool
+	//Force allows to overwrite an existing output file with different
+	//contents.
+	Force bool
+	//OutputMode is the mode of the package file and of the files written next
+	//to it (checksums, signature and provenance attestation). It is applied
+	//regardless of the umask. If zero, DefaultOutputMode is used.
+	OutputMode os.FileMode
+	//AtomicWrite makes Run() write the package into a temporary file next to
+	//the target and rename it to the target afterwards, so that an
+	//interrupted build does not leave a truncated package behind.
+	AtomicWrite bool
+	//IfChanged allows to overwrite an existing output file with different
+	//contents like Force, but unlike Force, an existing output file with
+	//identical contents is left untouched (and Result.WasWritten is false).
+	IfChanged bool
+	//OutputByDigest names the package file after the SHA-256 digest of its
+	//contents (in hexadecimal, followed by the usual extension, e.g.
+	//"3a7bd3e2...e0e7.deb") instead of the recommended file name, for
+	//content-addressed artifact stores. OutputFileName may only be empty or
+	//refer to a directory, and RepositoryDirectory may not be set.
+	OutputByDigest bool
+	//PathPrefix relocates all files in the package below this absolute path.
+	PathPrefix string
+	//CheckOutput enables checking the action scripts with `sh -n` (see
+	//LintActions()) and the generated package with native tools (see
+	//CheckOutput()).
+	CheckOutput bool
+	//RepositoryDirectory, if not empty, is a local repository into which the
+	//package is written (instead of OutputFileName). The repository's index is
+	//updated afterwards: Packages and Packages.gz for a flat Debian
+	//repository, or the database of repo-add(8) resp. createrepo_c(8) for
+	//pacman resp. RPM repositories.
+	RepositoryDirectory string
+	//Jobs is the number of threads for compressing the package with xz (for
+	//formats that use xz, see filesystem.XZArguments), and the number of
+	//files that are read in parallel to compute their digests (see
+	//build.Package.Jobs). The package is the same for all values greater
+	//than 1.
+	Jobs int
+	//Progress, if not nil, receives progress information for each phase of
+	//the build (see NewVerboseReporter and NewJSONProgressReporter).
+	Progress build.ProgressReporter
+	//PacmanGroupDatabase, if not empty, is the path to a file listing the
+	//members of package groups in the output format of `pacman -Sg`. Pacman
+	//packages with requirements on package groups then look them up there
+	//instead of calling pacman (see pacman.ReadGroupDatabase).
+	PacmanGroupDatabase string
+	//ExecAfter contains shell commands that are run after the package has
+	//been written, with "{}" replaced by the path to the package (see
+	//RunHooks). They are not run if NoOutput is set, and cannot be combined
+	//with writing the package to standard output.
+	ExecAfter []string
+	//Checksums contains the checksum algorithms ("sha256", "md5" or "b2")
+	//that are computed for the generated package (see Result.Checksums). For
+	//each of them, a sidecar file like "foo_1.0-1_any.deb.sha256" is written
+	//next to the package.
+	Checksums []string
+	//Provenance enables writing a provenance attestation for the generated
+	//package into a sidecar file like "foo_1.0-1_any.deb.intoto.json". The
+	//attestation is an in-toto statement with a SLSA provenance predicate
+	//that lists the digests of all input files.
+	Provenance bool
+	//BuilderVersion is the version of the application using this package,
+	//for inclusion in the provenance attestation and in the keys of the
+	//build cache.
+	BuilderVersion string
+	//CacheDirectory, if not empty, is a directory where generated packages
+	//are cached. The cache key is computed from BuilderVersion, the options
+	//that affect the generated package, and the digests of the package
+	//definition and all files referenced by it. If there is a cached package
+	//for the same key, it is used instead of building the package again.
+	CacheDirectory string
+	//HoloPlugins contains the IDs of Holo plugins in addition to
+	//KnownHoloPlugins that may provision entries below /usr/share/holo (see
+	//CheckHoloPlugins).
+	HoloPlugins []string
+	//NormalizeHoloResources makes all directories and regular files below
+	///usr/share/holo owned by root:root with the modes expected by Holo (see
+	//NormalizeHoloResources()). Otherwise, deviations are reported in
+	//Result.Warnings (see CheckHoloResources()).
+	NormalizeHoloResources bool
+	//Version, if not nil, replaces the version, prerelease version and
+	//release from the package definition (see ParseOptions.Version).
+	Version *PackageVersion
+	//VersionFromGit sets Version to the result of VersionFromGit() for the
+	//directory containing the package definition (or BaseDirectory, if set).
+	//If the working tree has uncommitted changes, a warning is reported in
+	//Result.Warnings. This is not supported by Convert().
+	VersionFromGit bool
+	//SignCommand, if not empty, is a shell command that signs the package
+	//(see SignWithCommand). For RPM packages, it receives the header section
+	//and must print a binary OpenPGP signature, which is embedded in the
+	//package. For all other formats, it receives the whole package, and its
+	//output is written into a sidecar file like "foo_1.0-1_any.deb.sig".
+	SignCommand string
+	//HologramProvides enables build.Package.HologramProvides for the package,
+	//in addition to the "hologramProvides" key in the package definition.
+	HologramProvides bool
+}
+
+//Result contains the results of Run().
+type Result struct {
+	//Package is the package as parsed from the definition.
+	Package *build.Package
+	//FileName is the path where the package was (or would have been) written.
+	FileName string
+	//FileNameComponents are the parts of the recommended file name for the
+	//package (see build.Generator.RecommendedFileNameComponents). They are
+	//filled even if FileName was chosen differently, e.g. with
+	//Options.OutputFileName.
+	FileNameComponents build.FileNameComponents
+	//Contents is the generated package (empty if Options.FilenameOnly,
+	//Options.ValidateOnly or Options.PlanOnly is set).
+	Contents []byte
+	//Plan describes the package if Options.PlanOnly is set.
+	Plan *build.Plan
+	//WasWritten is false if the package was not written to a file, or if the
+	//file already existed with identical contents.
+	WasWritten bool
+	//Warnings contains non-fatal problems in the package definition (e.g.
+	//deprecated keys), problems found by Options.CheckOutput, validation
+	//problems with build.SeverityWarning, and problems with Holo resources
+	//(see CheckHoloPlugins and CheckHoloResources).
+	Warnings []string
+	//Checksums contains the checksums requested by Options.Checksums.
+	Checksums []Checksum
+	//FromCache is true if Contents was taken from Options.CacheDirectory
+	//instead of building the package.
+	FromCache bool
+}
+
+//DefinitionError is returned by Run() when the package definition is invalid.
+//It contains all problems that were found, so that they can be displayed all
+//at once.
+type DefinitionError struct {
+	Errors []error
+	//Validation is true if the package definition could be parsed, and all
+	//problems were found while validating it (e.g. because a value is not
+	//acceptable for the selected package format).
+	Validation bool
+}
+
+//Error implements the builtin/error interface.
+func (e DefinitionError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for idx, err := range e.Errors {
+		msgs[idx] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+//withSuffix appends the given suffix to the message of the given error. If it
+//is a *build.ValidationError, the result is one as well (with the same Field,
+//Path, Severity and Format).
+func withSuffix(err error, suffix string) error {
+	if valErr, ok := err.(*build.ValidationError); ok {
+		result := *valErr
+		result.Message += suffix
+		return &result
+	}
+	return errors.New(err.Error() + suffix)
+}
+
+//WriteError is returned by Run() when the package was built successfully, but
+//it (or one of the files written next to it, like checksum files) could not
+//be written.
+type WriteError struct {
+	Err error
+}
+
+//Error implements the builtin/error interface.
+func (e WriteError) Error() string {
+	return e.Err.Error()
+}
+
+//Unwrap returns the underlying error.
+func (e WriteError) Unwrap() error {
+	return e.Err
+}
+
+//parseInput reads the package definition(s) as specified by the given Options.
+//Warnings and errors in the package definition are returned as []string and
+//[]error, other errors as error.
+func parseInput(opts Options, inputs *inputRecorder) (*build.Package, []string, []error, error) {
+	parseOpts := ParseOptions{
+		BaseDirectory: opts.BaseDirectory,
+		Architecture:  opts.Architecture,
+		Format:        opts.Format,
+		Defines:       opts.Defines,
+		AllowExec:     opts.AllowExec,
+		AllowNetwork:  opts.AllowNetwork,
+		Version:       opts.Version,
+	}
+	if opts.CacheDirectory != "" {
+		parseOpts.DownloadCacheDirectory = filepath.Join(opts.CacheDirectory, "downloads")
+	}
+	if opts.FilenameOnly {
+		parseOpts.Mode = ParseMetadataOnly
+	}
+
+	if len(opts.AdditionalInputFileNames) > 0 {
+		if opts.Input != nil || opts.InputFileName == "" {
+			return nil, nil, nil, errors.New("additional input files can only be merged with an input file")
+		}
+		if opts.InputSHA256 != "" {
+			return nil, nil, nil, errors.New("the checksum of the input cannot be checked when additional input files are given")
+		}
+		fileNames := append([]string{opts.InputFileName}, opts.AdditionalInputFileNames...)
+		pkg, warnings, errs := parsePackageDefinitionFiles(fileNames, parseOpts, inputs)
+		return pkg, warnings, errs, nil
+	}
+
+	input := opts.Input
+	if parseOpts.BaseDirectory == "" && opts.InputFileName != "" {
+		parseOpts.BaseDirectory = definitionDirectory(opts.InputFileName)
+	}
+	switch {
+	case input != nil:
+		//use opts.Input as-is
+	case opts.InputFileName == "":
+		return nil, nil, nil, errors.New("no input given")
+	case isURL(opts.InputFileName):
+		data, err := fetchURL(opts.InputFileName)
+		if err != nil {
+			return nil, nil, nil, DefinitionError{Errors: []error{err}}
+		}
+		input = bytes.NewReader(data)
+	default:
+		file, err := os.Open(opts.InputFileName)
+		if err != nil {
+			return nil, nil, nil, DefinitionError{Errors: []error{err}}
+		}
+		defer file.Close()
+		input = file
+	}
+	inputName := opts.InputFileName
+	if opts.Input != nil || inputName == "" {
+		inputName = "-"
+	}
+	if opts.InputSHA256 != "" {
+		data, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		err = checkSHA256(inputName, data, opts.InputSHA256)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		input = bytes.NewReader(data)
+	}
+	pkg, warnings, errs := parsePackageDefinition(input, inputName, parseOpts, inputs)
+	return pkg, warnings, errs, nil
+}
+
+//Formats contains the names of all package formats supported by
+//GeneratorFactoryFor().
+var Formats = []string{"debian", "pacman", "rpm", "freebsd", "oci-layer", "tar", "makeself", "nix"}
+
+//GeneratorFactoryFor returns the generator factory for the given package
+//format, or nil if the format is not supported.
+func GeneratorFactoryFor(format string) build.GeneratorFactory {
+	switch format {
+	case "debian":
+		return debian.GeneratorFactory
+	case "oci-layer":
+		return oci.GeneratorFactory
+	case "pacman":
+		return pacman.GeneratorFactory
+	case "rpm":
+		return rpm.GeneratorFactory
+	case "freebsd":
+		return freebsd.GeneratorFactory
+	case "tar":
+		return tarball.GeneratorFactory
+	case "makeself":
+		return tarball.InstallerGeneratorFactory
+	case "nix":
+		return nix.GeneratorFactory
+	default:
+		return nil
+	}
+}
+
+//SupportedFormats returns the names of all package formats supported by
+//GeneratorFactoryFor(). Unlike Formats, the result may be modified by the
+//caller.
+func SupportedFormats() []string {
+	return append([]string(nil), Formats...)
+}
+
+//Capabilities returns the optional features that the given package format
+//supports (see build.Capabilities).
+func Capabilities(format string) (build.Capabilities, error) {
+	factory := GeneratorFactoryFor(format)
+	if factory == nil {
+		return build.Capabilities{}, fmt.Errorf("unknown package format %q", format)
+	}
+	reporter, ok := factory(nil).(build.CapabilityReporter)
+	if !ok {
+		return build.Capabilities{}, fmt.Errorf("cannot report capabilities for package format %q", format)
+	}
+	return reporter.Capabilities(), nil
+}
+
+//setJobs sets the number of compression threads for generators that support
+//this option.
+func setJobs(generator build.Generator, jobs int) {
+	switch g := generator.(type) {
+	case *debian.Generator:
+		g.Jobs = jobs
+	case *pacman.Generator:
+		g.Jobs = jobs
+	case *freebsd.Generator:
+		g.Jobs = jobs
+	case *tarball.Generator:
+		g.Jobs = jobs
+	case *tarball.InstallerGenerator:
+		g.Jobs = jobs
+	}
+}
+
+//Run parses a package definition, validates it, and builds and writes the
+//package, as specified by the given Options. If the package definition is
+//invalid, a DefinitionError is returned. If the package cannot be written, a
+//WriteError is returned.
+func Run(opts Options) (Result, error) {
+	var result Result
+
+	generatorFactory := GeneratorFactoryFor(opts.Format)
+	if generatorFactory == nil {
+		return result, fmt.Errorf("invalid package format: '%s'", opts.Format)
+	}
+
+	//read package definition
+	if opts.Progress != nil {
+		opts.Progress.BeginPhase(build.PhaseParse)
+	}
+	var warnings []string
+	if opts.VersionFromGit {
+		if isURL(opts.InputFileName) && opts.BaseDirectory == "" {
+			return result, errors.New("cannot determine version from git for a package definition from a URL")
+		}
+		directory := opts.BaseDirectory
+		if directory == "" {
+			directory = filepath.Dir(opts.InputFileName) //"." for standard input
+		}
+		version, dirty, err := VersionFromGit(directory)
+		if err != nil {
+			return result, err
+		}
+		opts.Version = &version
+		if dirty {
+			warnings = append(warnings, fmt.Sprintf(
+				"the git working tree has uncommitted changes, so the package contents may not match version %s-%d",
+				version, version.Release))
+		}
+	}
+	var inputs *inputRecorder
+	if opts.Provenance || opts.CacheDirectory != "" {
+		inputs = newInputRecorder()
+	}
+	pkg, parseWarnings, errs, err := parseInput(opts, inputs)
+	if err != nil {
+		return result, err
+	}
+	warnings = append(warnings, parseWarnings...)
+	if pkg != nil {
+		pkg.PathPrefix = opts.PathPrefix
+		pkg.Progress = opts.Progress
+		pkg.Jobs = opts.Jobs
+	}
+	if opts.Progress != nil {
+		fileCount := 0
+		if pkg != nil {
+			fileCount = pkg.RegularFileCount()
+		}
+		opts.Progress.EndPhase(build.PhaseParse, fileCount)
+	}
+	result, err = buildPackage(opts, generatorFactory, pkg, errs, true, inputs)
+	result.Warnings = append(warnings, result.Warnings...)
+	return result, err
+}
+
+//Convert imports a package file that was generated by holo-build (given in
+//Options.InputFileName), and builds and writes it in the package format
+//specified by the given Options, like Run() does. Warnings about parts of the
+//package that could not be imported are reported in Result.Warnings.
+func Convert(opts Options) (Result, error) {
+	generatorFactory := GeneratorFactoryFor(opts.Format)
+	if generatorFactory == nil {
+		return Result{}, fmt.Errorf("invalid package format: '%s'", opts.Format)
+	}
+
+	if opts.Progress != nil {
+		opts.Progress.BeginPhase(build.PhaseParse)
+	}
+	data, err := ioutil.ReadFile(opts.InputFileName)
+	if err != nil {
+		return Result{}, err
+	}
+	var inputs *inputRecorder
+	if opts.Provenance || opts.CacheDirectory != "" {
+		inputs = newInputRecorder()
+		inputs.RecordBlob(opts.InputFileName, data)
+	}
+	imported, err := pkgimport.Import(data)
+	if err != nil {
+		return Result{}, fmt.Errorf("cannot import %s: %s", opts.InputFileName, err.Error())
+	}
+	pkg := imported.Package
+	pkg.PathPrefix = opts.PathPrefix
+	pkg.Progress = opts.Progress
+	pkg.Jobs = opts.Jobs
+	var errs []error
+	if opts.Architecture != "" {
+		var ok bool
+		pkg.ArchitectureInput = opts.Architecture
+		pkg.Architecture, ok = archMap[opts.Architecture]
+		if !ok {
+			errs = append(errs, fmt.Errorf("Invalid package architecture \"%s\"", opts.Architecture))
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress.EndPhase(build.PhaseParse, pkg.RegularFileCount())
+	}
+
+	//the Holo integration was already applied when the original package was
+	//built, and is contained in the imported actions
+	result, err := buildPackage(opts, generatorFactory, pkg, errs, false, inputs)
+	result.Warnings = append(imported.Warnings, result.Warnings...)
+	return result, err
+}
+
+//buildPackage contains the common part of Run() and Convert(): It validates
+//the package, and builds and writes it. `inputs` is only needed if
+//Options.Provenance or Options.CacheDirectory is set.
+func buildPackage(opts Options, generatorFactory build.GeneratorFactory, pkg *build.Package, errs []error, holoIntegration bool, inputs *inputRecorder) (Result, error) {
+	result := Result{Package: pkg}
+
+	err := ValidateChecksumAlgorithms(opts.Checksums)
+	if err != nil {
+		return result, err
+	}
+
+	//validate package
+	generator := generatorFactory(pkg)
+	setJobs(generator, opts.Jobs)
+	if g, ok := generator.(*pacman.Generator); ok && opts.PacmanGroupDatabase != "" {
+		resolver, err := pacman.ReadGroupDatabase(opts.PacmanGroupDatabase)
+		if err != nil {
+			return result, fmt.Errorf("cannot read package group database: %s", err.Error())
+		}
+		g.GroupResolver = resolver
+	}
+	embeddedSignature := opts.SignCommand != "" && setSigner(generator, opts.SignCommand)
+	if pkg != nil && opts.HologramProvides {
+		pkg.HologramProvides = true
+	}
+	parseErrorCount := len(errs)
+	if pkg != nil {
+		endPhase := pkg.BeginPhase(build.PhaseValidate)
+		relWarnings, relErrs := validateRelations(pkg, opts.Format)
+		result.Warnings = append(result.Warnings, relWarnings...)
+		errs = append(errs, relErrs...)
+		//the Nix generator translates Holo resources into NixOS options instead
+		if opts.Format != "nix" {
+			errs = append(errs, validateHoloPathPrefix(pkg)...)
+		}
+		if holoIntegration && opts.Format != "nix" {
+			result.Warnings = append(result.Warnings, CheckHoloPlugins(pkg, opts.HoloPlugins)...)
+			if opts.NormalizeHoloResources {
+				NormalizeHoloResources(pkg)
+			} else {
+				result.Warnings = append(result.Warnings, CheckHoloResources(pkg)...)
+			}
+		}
+		//file contents are unknown with ParseMetadataOnly
+		if !opts.FilenameOnly {
+			errs = append(errs, validateSizeLimits(pkg)...)
+		}
+		for _, err := range generator.Validate() {
+			//warnings do not stop the build
+			if valErr, ok := err.(*build.ValidationError); ok && valErr.Severity == build.SeverityWarning {
+				result.Warnings = append(result.Warnings, valErr.Message)
+			} else {
+				errs = append(errs, err)
+			}
+		}
+		endPhase()
+	}
+	if len(errs) > 0 {
+		return result, DefinitionError{Errors: errs, Validation: parseErrorCount == 0}
+	}
+
+	//choose output file name
+	result.FileName = generator.RecommendedFileName()
+	result.FileNameComponents = generator.RecommendedFileNameComponents()
+	if opts.FilenameOnly || opts.ValidateOnly {
+		return result, nil
+	}
+	if opts.OutputByDigest {
+		err := checkOutputByDigest(opts)
+		if err != nil {
+			return result, err
+		}
+	}
+	switch {
+	case opts.RepositoryDirectory != "":
+		result.FileName = filepath.Join(opts.RepositoryDirectory, result.FileName)
+	case opts.OutputFileName == "":
+		//use recommended file name in working directory
+	case opts.OutputFileName == "-":
+		result.FileName = "-"
+		if len(opts.ExecAfter) > 0 {
+			return result, errors.New("cannot run post-build hooks when the package is written to standard output")
+		}
+		if len(opts.Checksums) > 0 {
+			return result, errors.New("cannot write checksum files when the package is written to standard output")
+		}
+		if opts.Provenance {
+			return result, errors.New("cannot write provenance attestation when the package is written to standard output")
+		}
+		if opts.SignCommand != "" && !embeddedSignature {
+			return result, errors.New("cannot write signature file when the package is written to standard output (only RPM packages can embed signatures)")
+		}
+	default:
+		//use opts.OutputFileName directly if a file, or choose it inside there if a directory
+		fi, err := os.Stat(opts.OutputFileName)
+		if err == nil && fi.Mode().IsDir() {
+			result.FileName = filepath.Join(opts.OutputFileName, result.FileName)
+		} else {
+			result.FileName = opts.OutputFileName
+		}
+	}
+
+	//check action scripts before Holo integration adds its own, if requested
+	if opts.CheckOutput {
+		result.Warnings = append(result.Warnings, LintActions(pkg)...)
+	}
+
+	//build package (NixOS modules do not use Holo, the Nix generator renders
+	//the entity definitions for holo-users-groups by itself)
+	if holoIntegration && opts.Format != "nix" {
+		DoMagicalHoloIntegration(pkg)
+	}
+	if opts.PlanOnly {
+		planner, ok := generator.(build.Planner)
+		if !ok {
+			return result, fmt.Errorf("cannot show plan for %s: not supported for package format \"%s\"", result.FileName, opts.Format)
+		}
+		result.Plan, err = planner.Plan()
+		if err != nil {
+			return result, fmt.Errorf("cannot build %s: %w", result.FileName, err)
+		}
+		return result, nil
+	}
+	var (
+		pkgBytes  []byte
+		fromCache bool
+	)
+	if opts.Plan != nil {
+		//the build cache is not used since it only knows the package
+		//definition, not the plan
+		planner, ok := generator.(build.Planner)
+		if !ok {
+			return result, fmt.Errorf("cannot build %s from a plan: not supported for package format \"%s\"", result.FileName, opts.Format)
+		}
+		pkgBytes, err = planner.Render(opts.Plan)
+		if err != nil {
+			return result, fmt.Errorf("cannot build %s from plan: %w", result.FileName, err)
+		}
+	} else {
+		cache, err := newBuildCache(opts, inputs)
+		if err != nil {
+			return result, err
+		}
+		pkgBytes, fromCache = cache.Load()
+		if fromCache {
+			//the index of a Debian repository needs the control file, which is
+			//only complete after the package has been prepared for building
+			if planner, ok := generator.(build.Planner); ok && opts.RepositoryDirectory != "" {
+				_, err = planner.Plan()
+				if err != nil {
+					return result, fmt.Errorf("cannot build %s: %w", result.FileName, err)
+				}
+			}
+		} else {
+			pkgBytes, err = generator.Build()
+			if err != nil {
+				return result, fmt.Errorf("cannot build %s: %w", result.FileName, err)
+			}
+			err = cache.Store(pkgBytes)
+			if err != nil {
+				return result, fmt.Errorf("cannot write %s to build cache: %s", result.FileName, err.Error())
+			}
+		}
+	}
+	result.Contents = pkgBytes
+	result.FromCache = fromCache
+	err = checkPackageSize(pkg, pkgBytes)
+	if err != nil {
+		return result, fmt.Errorf("cannot build %s: %s", result.FileName, err.Error())
+	}
+	if opts.OutputByDigest {
+		result.FileName = digestFileName(result.FileName, result.FileNameComponents.Extension, pkgBytes)
+	}
+
+	//verify [[check]] sections before anything is written
+	checkWarnings, err := runChecks(pkg, opts.Format, pkgBytes)
+	result.Warnings = append(result.Warnings, checkWarnings...)
+	if err != nil {
+		return result, err
+	}
+	result.Checksums = computeChecksums(opts.Checksums, pkgBytes)
+
+	//check package with native tools, if requested
+	if opts.CheckOutput {
+		result.Warnings = append(result.Warnings, CheckOutput(pkgBytes, opts.Format, result.FileName)...)
+	}
+
+	//write package
+	if opts.NoOutput {
+		return result, nil
+	}
+	if opts.RepositoryDirectory != "" {
+		err := os.MkdirAll(opts.RepositoryDirectory, 0755)
+		if err != nil {
+			return result, WriteError{err}
+		}
+	}
+	endPhase := pkg.BeginPhase(build.PhaseWrite)
+	result.WasWritten, err = WriteOutput(pkgBytes, result.FileName, opts)
+	endPhase()
+	if err != nil {
+		return result, WriteError{fmt.Errorf("cannot write %s: %s", result.FileName, err.Error())}
+	}
+	err = writeChecksumFiles(result.Checksums, result.FileName, opts.outputMode())
+	if err != nil {
+		return result, WriteError{fmt.Errorf("cannot write checksums for %s: %s", result.FileName, err.Error())}
+	}
+	if opts.SignCommand != "" && !embeddedSignature {
+		signature, err := SignWithCommand(opts.SignCommand, pkgBytes)
+		if err != nil {
+			return result, fmt.Errorf("cannot sign %s: %s", result.FileName, err.Error())
+		}
+		err = writeSignatureFile(signature, result.FileName, opts.outputMode())
+		if err != nil {
+			return result, WriteError{fmt.Errorf("cannot write signature for %s: %s", result.FileName, err.Error())}
+		}
+	}
+	if opts.Provenance {
+		err = writeProvenance(opts, inputs, result.FileName, pkgBytes)
+		if err != nil {
+			return result, WriteError{fmt.Errorf("cannot write provenance attestation for %s: %s", result.FileName, err.Error())}
+		}
+	}
+	if opts.RepositoryDirectory != "" {
+		err = updateRepository(opts.Format, opts.RepositoryDirectory, result.FileName, pkgBytes, generator)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, RunHooks(opts.ExecAfter, result.FileName)
+}
+
+//RunAllArchitectures is like Run(), but builds one package for each
+//architecture that the selected package format supports (except for
+//architecture-independent packages). Since multiple packages are written,
+//Options.OutputFileName may only be empty or refer to a directory.
+//
+//If one of the builds fails, the results of the previous builds are returned
+//along with the error.
+func RunAllArchitectures(opts Options) ([]Result, error) {
+	generatorFactory := GeneratorFactoryFor(opts.Format)
+	if generatorFactory == nil {
+		return nil, fmt.Errorf("invalid package format: '%s'", opts.Format)
+	}
+	if !opts.NoOutput && !opts.FilenameOnly && opts.RepositoryDirectory == "" {
+		switch opts.OutputFileName {
+		case "":
+			//use recommended file names in working directory
+		case "-":
+			return nil, errors.New("cannot write packages for multiple architectures to standard output")
+		default:
+			fi, err := os.Stat(opts.OutputFileName)
+			if err != nil || !fi.Mode().IsDir() {
+				return nil, fmt.Errorf("cannot write packages for multiple architectures to %s: not a directory", opts.OutputFileName)
+			}
+		}
+	}
+
+	//the package definition is parsed once per architecture, so it needs to
+	//be buffered (files can just be read again)
+	var blob []byte
+	if opts.Input != nil {
+		var err error
+		blob, err = ioutil.ReadAll(opts.Input)
+		if err != nil {
+			return nil, err
+		}
+	} else if opts.InputFileName == "" {
+		return nil, errors.New("no input given")
+	}
+
+	//build in a reproducible order
+	archNames := generatorFactory(nil).SupportedArchitectures()
+	archs := make([]build.Architecture, 0, len(archNames))
+	for arch := range archNames {
+		if arch != build.ArchitectureAny {
+			archs = append(archs, arch)
+		}
+	}
+	sort.Slice(archs, func(i, j int) bool { return archs[i] < archs[j] })
+
+	results := make([]Result, 0, len(archs))
+	for _, arch := range archs {
+		archOpts := opts
+		if blob != nil {
+			archOpts.Input = bytes.NewReader(blob)
+		}
+		archOpts.Architecture = archNames[arch]
+		result, err := Run(archOpts)
+		if err != nil {
+			if defErr, ok := err.(DefinitionError); ok {
+				errs := make([]error, len(defErr.Errors))
+				for idx, err := range defErr.Errors {
+					errs[idx] = withSuffix(err, fmt.Sprintf(" (for architecture %s)", archOpts.Architecture))
+				}
+				err = DefinitionError{Errors: errs, Validation: defErr.Validation}
+			}
+			if checkErr, ok := err.(CheckError); ok {
+				errs := make([]error, len(checkErr.Failures))
+				for idx, err := range checkErr.Failures {
+					errs[idx] = withSuffix(err, fmt.Sprintf(" (for architecture %s)", archOpts.Architecture))
+				}
+				err = CheckError{errs}
+			}
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+//ValidateAllFormats is like Run() with Options.ValidateOnly, but validates the
+//package definition for each format in Formats (Options.Format is ignored).
+//Problems that only occur with some formats are marked with the names of
+//these formats, so that all problems can be reported in a single
+//DefinitionError. Warnings are returned in the same way.
+func ValidateAllFormats(opts Options) ([]string, error) {
+	opts.ValidateOnly = true
+
+	//the package definition is parsed once per format, so it needs to be
+	//buffered (files can just be read again)
+	var blob []byte
+	if opts.Input != nil {
+		var err error
+		blob, err = ioutil.ReadAll(opts.Input)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		messages         []string
+		errorByMessage   = make(map[string]error)
+		formatsByError   = make(map[string][]string)
+		warnings         []string
+		formatsByWarning = make(map[string][]string)
+		validation       = true
+	)
+	for _, format := range Formats {
+		formatOpts := opts
+		formatOpts.Format = format
+		if blob != nil {
+			formatOpts.Input = bytes.NewReader(blob)
+		}
+		result, err := Run(formatOpts)
+		for _, warning := range result.Warnings {
+			if _, exists := formatsByWarning[warning]; !exists {
+				warnings = append(warnings, warning)
+			}
+			formatsByWarning[warning] = append(formatsByWarning[warning], format)
+		}
+		if err == nil {
+			continue
+		}
+		defErr, ok := err.(DefinitionError)
+		if !ok {
+			return nil, err
+		}
+		validation = validation && defErr.Validation
+		for _, err := range defErr.Errors {
+			msg := err.Error()
+			if _, exists := formatsByError[msg]; !exists {
+				messages = append(messages, msg)
+				errorByMessage[msg] = err
+			}
+			formatsByError[msg] = append(formatsByError[msg], format)
+		}
+	}
+	for idx, warning := range warnings {
+		formats := formatsByWarning[warning]
+		if len(formats) != len(Formats) {
+			warnings[idx] = fmt.Sprintf("%s (for format %s)", warning, strings.Join(formats, ", "))
+		}
+	}
+	if len(messages) == 0 {
+		return warnings, nil
+	}
+
+	errs := make([]error, len(messages))
+	for idx, msg := range messages {
+		formats := formatsByError[msg]
+		if len(formats) == len(Formats) {
+			errs[idx] = errorByMessage[msg]
+		} else {
+			errs[idx] = withSuffix(errorByMessage[msg], fmt.Sprintf(" (for format %s)", strings.Join(formats, ", ")))
+		}
+	}
+	return warnings, DefinitionError{Errors: errs, Validation: validation}
+}
@@ -0,0 +1,53 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+//RunHooks runs the given shell commands (see Options.ExecAfter) in order,
+//with each occurrence of "{}" replaced by the given file name. The standard
+//output and standard error of the commands are forwarded to those of this
+//process. If a command fails, the remaining commands are not run.
+func RunHooks(commands []string, fileName string) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	shellPath, err := exec.LookPath("sh")
+	if err != nil {
+		return fmt.Errorf("cannot run post-build hooks: %s", err.Error())
+	}
+	for _, command := range commands {
+		script := strings.Replace(command, "{}", shellQuote(fileName), -1)
+		cmd := exec.Command(shellPath, "-c", script)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("post-build hook %q failed: %s", command, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,483 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+)
+
+//This file contains the parts of parser.go relating to `include`, and to
+//merging package definitions from multiple input files. Package
+//definitions can include other package definitions (e.g. for metadata and
+//directories that are shared between many packages). The included definitions
+//are merged in the order in which they are given, and the including
+//definition is merged last. When merging a definition into another:
+//
+//* Fields in [package] that the definition sets replace the previous value,
+//  except for relations (`requires` etc.) which are appended.
+//* Fields in [defaults] and [debian] that the definition sets replace the
+//  previous value.
+//* [[file]], [[directory]] and [[symlink]] sections replace previous entries
+//  with the same path (and the same `architectures` filter).
+//* [[user]] and [[group]] sections replace previous entries with the same name.
+//* [[action]], [[trigger]], [[service]] and [[alternative]] sections are
+//  appended.
+//
+//Each definition is only included once, even if multiple definitions include
+//it.
+
+//sectionSource records where a section was defined. An empty FileName denotes
+//the package definition that was given to ParsePackageDefinition().
+type sectionSource struct {
+	//FileName is the path of the included file (for error messages).
+	FileName string
+	//BaseDirectory is where relative `contentFrom` paths are resolved.
+	BaseDirectory string
+}
+
+//includeFrame is an entry in the stack of package definitions that are being
+//decoded, for detecting include cycles.
+type includeFrame struct {
+	FileName     string
+	AbsolutePath string
+}
+
+//definitionDecoder holds the state of decodeDefinition().
+type definitionDecoder struct {
+	//included contains the absolute paths of all definitions that have been
+	//included so far, so that two definitions can include a common definition
+	//without duplicating its [[action]] sections.
+	included map[string]bool
+	//inputs records the digests of all included definitions (may be nil).
+	inputs *inputRecorder
+}
+
+//decodeDefinition decodes a package definition, and recursively resolves and
+//merges its includes. The returned set contains the keys in [package] that
+//were set by the definition or by its includes. The digests of the included
+//definitions are recorded in `inputs` (if not nil).
+func decodeDefinition(blob []byte, source sectionSource, inputs *inputRecorder) (*PackageDefinition, map[string]bool, error) {
+	d := definitionDecoder{included: make(map[string]bool), inputs: inputs}
+	var stack []includeFrame
+	if source.FileName != "" {
+		absPath, err := filepath.Abs(source.FileName)
+		if err != nil {
+			return nil, nil, err
+		}
+		stack = append(stack, includeFrame{source.FileName, absPath})
+	}
+	return d.decode(blob, source, stack)
+}
+
+//decode implements decodeDefinition().
+func (d *definitionDecoder) decode(blob []byte, source sectionSource, stack []includeFrame) (*PackageDefinition, map[string]bool, error) {
+	var p PackageDefinition
+	md, err := toml.Decode(string(blob), &p)
+	if err != nil {
+		if source.FileName != "" {
+			return nil, nil, fmt.Errorf("cannot parse %s: %s", source.FileName, err.Error())
+		}
+		return nil, nil, err
+	}
+
+	//remember which fields in [package] were given explicitly
+	ownKeys := make(map[string]bool)
+	packageType := reflect.TypeOf(p.Package)
+	for _, key := range md.Keys() {
+		if len(key) != 2 || key[0] != "package" {
+			continue
+		}
+		//match field names case-insensitively like the TOML decoder does
+		for idx := 0; idx < packageType.NumField(); idx++ {
+			if strings.EqualFold(packageType.Field(idx).Name, key[1]) {
+				ownKeys[packageType.Field(idx).Name] = true
+			}
+		}
+	}
+
+	p.setSource(source)
+	if len(p.Include) == 0 {
+		return &p, ownKeys, nil
+	}
+
+	result := &PackageDefinition{}
+	resultKeys := make(map[string]bool)
+	for _, includePath := range p.Include {
+		if includePath == "" {
+			return nil, nil, errors.New("Invalid include: empty path")
+		}
+		fileName := resolvePath(source.BaseDirectory, includePath)
+		absPath := fileName
+		if !isURL(fileName) {
+			var err error
+			absPath, err = filepath.Abs(fileName)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		//detect include cycles
+		for idx, frame := range stack {
+			if frame.AbsolutePath == absPath {
+				var names []string
+				for _, f := range stack[idx:] {
+					names = append(names, f.FileName)
+				}
+				return nil, nil, fmt.Errorf("include cycle detected: %s -> %s", strings.Join(names, " -> "), fileName)
+			}
+		}
+		if d.included[absPath] {
+			continue
+		}
+		d.included[absPath] = true
+
+		included, err := readPathOrURL(fileName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot include %s: %s", fileName, err.Error())
+		}
+		if !utf8.Valid(included) {
+			return nil, nil, fmt.Errorf("cannot include %s: package definition is not valid UTF-8", fileName)
+		}
+		d.inputs.RecordBlob(fileName, included)
+		frames := append(append([]includeFrame(nil), stack...), includeFrame{fileName, absPath})
+		includedSource := sectionSource{FileName: fileName, BaseDirectory: definitionDirectory(fileName)}
+		sub, subKeys, err := d.decode(included, includedSource, frames)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.merge(sub, subKeys)
+		for key := range subKeys {
+			resultKeys[key] = true
+		}
+	}
+
+	p.Include = nil
+	result.merge(&p, ownKeys)
+	for key := range ownKeys {
+		resultKeys[key] = true
+	}
+	return result, resultKeys, nil
+}
+
+//setSource records the given source in all sections that need it.
+func (p *PackageDefinition) setSource(source sectionSource) {
+	for idx := range p.File {
+		p.File[idx].source = source
+	}
+	for idx := range p.Directory {
+		p.Directory[idx].source = source
+	}
+	for idx := range p.Symlink {
+		p.Symlink[idx].source = source
+	}
+	for idx := range p.Action {
+		p.Action[idx].source = source
+	}
+	for idx := range p.Trigger {
+		p.Trigger[idx].source = source
+	}
+	for idx := range p.Manpage {
+		p.Manpage[idx].source = source
+	}
+}
+
+//merge merges the definition `other` into this one, as described at the top
+//of this file. `otherKeys` are the fields in other.Package that were given
+//explicitly.
+func (p *PackageDefinition) merge(other *PackageDefinition, otherKeys map[string]bool) {
+	dst := reflect.ValueOf(&p.Package).Elem()
+	src := reflect.ValueOf(&other.Package).Elem()
+	for idx := 0; idx < dst.NumField(); idx++ {
+		if !otherKeys[dst.Type().Field(idx).Name] {
+			continue
+		}
+		if dst.Field(idx).Kind() == reflect.Slice {
+			dst.Field(idx).Set(reflect.ValueOf(appendUnique(
+				dst.Field(idx).Interface().([]string),
+				src.Field(idx).Interface().([]string),
+			)))
+		} else {
+			dst.Field(idx).Set(src.Field(idx))
+		}
+	}
+
+	mergeTable(&p.Defaults, other.Defaults)
+	mergeTable(&p.Debian, other.Debian)
+	mergeTable(&p.Pacman, other.Pacman)
+
+	//FS entries replace each other across types (e.g. a symlink can replace a
+	//file from an included definition)
+	for _, entry := range other.File {
+		p.removeFSEntry(entry.Path, entry.Architectures, entry.ExcludeFormats, entry.When)
+		p.File = append(p.File, entry)
+	}
+	for _, entry := range other.Directory {
+		p.removeFSEntry(entry.Path, entry.Architectures, entry.ExcludeFormats, entry.When)
+		p.Directory = append(p.Directory, entry)
+	}
+	for _, entry := range other.Symlink {
+		p.removeFSEntry(entry.Path, entry.Architectures, entry.ExcludeFormats, entry.When)
+		p.Symlink = append(p.Symlink, entry)
+	}
+
+	for _, user := range other.User {
+		users := p.User[:0]
+		for _, u := range p.User {
+			if u.Name != user.Name {
+				users = append(users, u)
+			}
+		}
+		p.User = append(users, user)
+	}
+	for _, group := range other.Group {
+		groups := p.Group[:0]
+		for _, g := range p.Group {
+			if g.Name != group.Name {
+				groups = append(groups, g)
+			}
+		}
+		p.Group = append(groups, group)
+	}
+
+	p.Action = append(p.Action, other.Action...)
+	p.Trigger = append(p.Trigger, other.Trigger...)
+	p.Service = append(p.Service, other.Service...)
+	p.Alternative = append(p.Alternative, other.Alternative...)
+	p.Manpage = append(p.Manpage, other.Manpage...)
+	p.DependencyMapping = append(p.DependencyMapping, other.DependencyMapping...)
+	p.Check = append(p.Check, other.Check...)
+}
+
+//mergeTable merges a table like [defaults] from an included definition into
+//this one. `dst` is a pointer to this definition's table. Fields that are set
+//in `src` take precedence.
+func mergeTable(dst, src interface{}) {
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src)
+	for idx := 0; idx < dstValue.NumField(); idx++ {
+		if !srcValue.Field(idx).IsZero() {
+			dstValue.Field(idx).Set(srcValue.Field(idx))
+		}
+	}
+}
+
+//removeFSEntry removes all [[file]], [[directory]] and [[symlink]] sections
+//with the given path and the given architectures, excludeFormats and when
+//filters.
+func (p *PackageDefinition) removeFSEntry(path string, architectures, excludeFormats []string, when string) {
+	matches := func(otherPath string, otherArchitectures, otherExcludeFormats []string, otherWhen string) bool {
+		return otherPath == path &&
+			strings.Join(otherArchitectures, ",") == strings.Join(architectures, ",") &&
+			strings.Join(otherExcludeFormats, ",") == strings.Join(excludeFormats, ",") &&
+			otherWhen == when
+	}
+
+	files := p.File[:0]
+	for _, entry := range p.File {
+		if !matches(entry.Path, entry.Architectures, entry.ExcludeFormats, entry.When) {
+			files = append(files, entry)
+		}
+	}
+	p.File = files
+
+	dirs := p.Directory[:0]
+	for _, entry := range p.Directory {
+		if !matches(entry.Path, entry.Architectures, entry.ExcludeFormats, entry.When) {
+			dirs = append(dirs, entry)
+		}
+	}
+	p.Directory = dirs
+
+	symlinks := p.Symlink[:0]
+	for _, entry := range p.Symlink {
+		if !matches(entry.Path, entry.Architectures, entry.ExcludeFormats, entry.When) {
+			symlinks = append(symlinks, entry)
+		}
+	}
+	p.Symlink = symlinks
+}
+
+//appendUnique appends those values to the list that are not in it yet. This
+//is used for relations, so that a definition can repeat a relation from an
+//included definition without causing a warning about duplicate entries.
+func appendUnique(list []string, values []string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+//addErrorsFrom moves the errors and warnings from the given collector into
+//this one, and attributes them to the file that the section came from.
+func (c *ErrorCollector) addErrorsFrom(other *ErrorCollector, source sectionSource) {
+	for _, err := range other.Errors {
+		if source.FileName != "" {
+			err = fmt.Errorf("%s (in %s)", err.Error(), source.FileName)
+		}
+		c.Add(err)
+	}
+	for _, warning := range other.Warnings {
+		if source.FileName != "" {
+			warning = fmt.Sprintf("%s (in %s)", warning, source.FileName)
+		}
+		c.Warnings = append(c.Warnings, warning)
+	}
+}
+
+//inputMerger merges the package definitions from multiple input files (see
+//ParsePackageDefinitionFiles). Unlike with `include`, no input takes
+//precedence over another, so conflicting values are reported as errors.
+type inputMerger struct {
+	Result PackageDefinition
+	Errors ErrorCollector
+	//origins contains the file names where [package], [defaults] and
+	//[debian] fields, users and groups were defined (with keys like
+	//"package.name", "defaults.owner", "user.foo" or "group.bar")
+	origins map[string]string
+}
+
+func newInputMerger() *inputMerger {
+	return &inputMerger{origins: make(map[string]string)}
+}
+
+//Merge merges a package definition into the result. `keys` are the fields in
+//p.Package that were given explicitly.
+func (m *inputMerger) Merge(p *PackageDefinition, keys map[string]bool, fileName string) {
+	dst := reflect.ValueOf(&m.Result.Package).Elem()
+	src := reflect.ValueOf(&p.Package).Elem()
+	for idx := 0; idx < dst.NumField(); idx++ {
+		fieldName := dst.Type().Field(idx).Name
+		if !keys[fieldName] {
+			continue
+		}
+		if dst.Field(idx).Kind() == reflect.Slice {
+			dst.Field(idx).Set(reflect.ValueOf(appendUnique(
+				dst.Field(idx).Interface().([]string),
+				src.Field(idx).Interface().([]string),
+			)))
+			continue
+		}
+
+		key := "package." + strings.ToLower(fieldName[:1]) + fieldName[1:]
+		if origin, exists := m.origins[key]; exists {
+			if !reflect.DeepEqual(dst.Field(idx).Interface(), src.Field(idx).Interface()) {
+				m.Errors.Addf("Conflicting values for \"%s\": %s in %s, but %s in %s",
+					key, formatValue(dst.Field(idx)), origin, formatValue(src.Field(idx)), fileName)
+			}
+			continue
+		}
+		m.origins[key] = fileName
+		dst.Field(idx).Set(src.Field(idx))
+	}
+
+	m.mergeTable("defaults", &m.Result.Defaults, p.Defaults, fileName)
+	m.mergeTable("debian", &m.Result.Debian, p.Debian, fileName)
+	m.mergeTable("pacman", &m.Result.Pacman, p.Pacman, fileName)
+
+	//duplicate FS entries are reported when they are inserted into the package
+	m.Result.File = append(m.Result.File, p.File...)
+	m.Result.Directory = append(m.Result.Directory, p.Directory...)
+	m.Result.Symlink = append(m.Result.Symlink, p.Symlink...)
+	m.Result.Action = append(m.Result.Action, p.Action...)
+	m.Result.Trigger = append(m.Result.Trigger, p.Trigger...)
+	m.Result.Service = append(m.Result.Service, p.Service...)
+	m.Result.Alternative = append(m.Result.Alternative, p.Alternative...)
+	m.Result.Manpage = append(m.Result.Manpage, p.Manpage...)
+	m.Result.DependencyMapping = append(m.Result.DependencyMapping, p.DependencyMapping...)
+	m.Result.Check = append(m.Result.Check, p.Check...)
+
+	for _, user := range p.User {
+		if m.checkUnique("user", user.Name, fileName) {
+			m.Result.User = append(m.Result.User, user)
+		}
+	}
+	for _, group := range p.Group {
+		if m.checkUnique("group", group.Name, fileName) {
+			m.Result.Group = append(m.Result.Group, group)
+		}
+	}
+}
+
+//mergeTable merges a table like [defaults] from another input file into the
+//corresponding table of the result. `dst` is a pointer to the result's table. Unlike in [package], fields
+//count as given if they are not empty.
+func (m *inputMerger) mergeTable(tableName string, dst, src interface{}, fileName string) {
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src)
+	for idx := 0; idx < dstValue.NumField(); idx++ {
+		if srcValue.Field(idx).IsZero() {
+			continue
+		}
+		fieldName := dstValue.Type().Field(idx).Name
+		key := tableName + "." + strings.ToLower(fieldName[:1]) + fieldName[1:]
+		if origin, exists := m.origins[key]; exists {
+			if !reflect.DeepEqual(dstValue.Field(idx).Interface(), srcValue.Field(idx).Interface()) {
+				m.Errors.Addf("Conflicting values for \"%s\": %s in %s, but %s in %s",
+					key, formatValue(dstValue.Field(idx)), origin, formatValue(srcValue.Field(idx)), fileName)
+			}
+			continue
+		}
+		m.origins[key] = fileName
+		dstValue.Field(idx).Set(srcValue.Field(idx))
+	}
+}
+
+//checkUnique reports an error if a user or group with the same name was
+//defined in another file.
+func (m *inputMerger) checkUnique(entityType, name, fileName string) bool {
+	//nameless entities are reported by validateEntities()
+	if name == "" {
+		return true
+	}
+	key := entityType + "." + name
+	if origin, exists := m.origins[key]; exists && origin != fileName {
+		m.Errors.Addf("%s \"%s\" is defined in both %s and %s", entityType, name, origin, fileName)
+		return false
+	}
+	m.origins[key] = fileName
+	return true
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String {
+		return fmt.Sprintf("%q", v.String())
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
@@ -0,0 +1,86 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//actionTypeNames is used to refer to action types in warning messages.
+var actionTypeNames = map[uint]string{
+	build.SetupAction:           "setup",
+	build.CleanupAction:         "cleanup",
+	build.PreSetupAction:        "pre-setup",
+	build.PreCleanupAction:      "pre-cleanup",
+	build.PreTransactionAction:  "pre-transaction",
+	build.PostTransactionAction: "post-transaction",
+	build.VerifyAction:          "verify",
+}
+
+//LintActions checks the syntax of the package's action and trigger scripts
+//with `sh -n` (if a shell is available), and returns its complaints as a list
+//of warning messages. Scripts for other interpreters are not checked.
+func LintActions(pkg *build.Package) []string {
+	shellPath, err := exec.LookPath("sh")
+	if err != nil {
+		return nil
+	}
+
+	var warnings []string
+	for _, action := range pkg.Actions {
+		if action.Interpreter == "" {
+			warnings = append(warnings, lintShellScript(shellPath, action.Content, actionTypeNames[action.Type]+" script")...)
+		}
+	}
+	for idx, trigger := range pkg.Triggers {
+		if trigger.Interpreter == "" {
+			warnings = append(warnings, lintShellScript(shellPath, trigger.Content, fmt.Sprintf("script of trigger %d", idx))...)
+		}
+	}
+	return warnings
+}
+
+func lintShellScript(shellPath, script, desc string) []string {
+	//pass the script with -c instead of on stdin, so that the error messages
+	//refer to "sh" instead of the full path of the shell
+	var stderr bytes.Buffer
+	cmd := exec.Command(shellPath, "-n", "-c", script, "sh")
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	complaints := strings.TrimSpace(stderr.String())
+	if complaints == "" {
+		complaints = err.Error()
+	}
+	warnings := []string{desc + " has invalid shell syntax:"}
+	for _, line := range strings.Split(complaints, "\n") {
+		warnings = append(warnings, "    "+line)
+	}
+	return warnings
+}
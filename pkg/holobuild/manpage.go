@@ -0,0 +1,99 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//This file contains the parts of parser.go relating to [[manpage]] sections.
+//Like entity definitions, these are converted into file entries early on, so
+//that the rest of holo-build only sees regular [[file]] sections.
+
+//ManpageSection only needs a nice exported name for the TOML parser to
+//produce more meaningful error messages on malformed input data.
+type ManpageSection struct {
+	Name        string        `explain:"Name of the manual page, e.g. \"foo\"" required:"true"`
+	Section     string        `explain:"Section of the manual page, e.g. \"1\" or \"3p\"" required:"true"`
+	ContentFrom string        `explain:"Path of the manual page source (resolved relative to the package definition)" required:"true"`
+	Compress    string        `explain:"Compression method (\"gzip\", \"zstd\" or \"none\")" default:"\"gzip\""`
+	source      sectionSource //see FileSection
+}
+
+//manual page sections are a digit, optionally followed by a suffix like in
+//"3p" or "3ssl"
+var manpageSectionRx = regexp.MustCompile(`^[1-9][a-z]*$`)
+
+//manpageFileSections converts [[manpage]] sections into [[file]] sections
+//that install the manual pages below /usr/share/man. Invalid sections are
+//reported in `ec` and skipped.
+func manpageFileSections(manpages []ManpageSection, ec *ErrorCollector) []FileSection {
+	var result []FileSection
+	for idx, manpage := range manpages {
+		sectionEC := &ErrorCollector{}
+		entryDesc := fmt.Sprintf("manpage \"%s(%s)\"", manpage.Name, manpage.Section)
+
+		switch {
+		case manpage.Name == "":
+			sectionEC.Addf("manpage %d is invalid: missing \"name\" attribute", idx)
+		case strings.Contains(manpage.Name, "/") || strings.HasPrefix(manpage.Name, "."):
+			sectionEC.Addf("%s is invalid: name may not contain slashes or start with a dot", entryDesc)
+		case checkCharacters(manpage.Name) != "":
+			sectionEC.Addf("%s is invalid: name %s", entryDesc, checkCharacters(manpage.Name))
+		}
+		if !manpageSectionRx.MatchString(manpage.Section) {
+			sectionEC.Addf("%s is invalid: section must be a digit from 1 to 9, optionally followed by lowercase letters (e.g. \"1\" or \"3p\")", entryDesc)
+		}
+		if manpage.ContentFrom == "" {
+			sectionEC.Addf("%s is invalid: missing \"contentFrom\" attribute", entryDesc)
+		}
+
+		compress := manpage.Compress
+		switch compress {
+		case "":
+			compress = "gzip"
+		case "none":
+			compress = ""
+		case "gzip", "zstd":
+			//acceptable as-is
+		default:
+			sectionEC.Addf("%s is invalid: unknown compression method \"%s\" (must be \"gzip\", \"zstd\" or \"none\")", entryDesc, compress)
+		}
+
+		if len(sectionEC.Errors) > 0 {
+			ec.addErrorsFrom(sectionEC, manpage.source)
+			continue
+		}
+		result = append(result, FileSection{
+			Path:        fmt.Sprintf("/usr/share/man/man%s/%s.%s", manpage.Section[:1], manpage.Name, manpage.Section),
+			ContentFrom: manpage.ContentFrom,
+			Mode:        "0644",
+			Owner:       int64(0), //not "root", which would be applied with chown(1) at install time
+			Group:       int64(0),
+			Compress:    compress,
+			Doc:         true,
+			source:      manpage.source,
+		})
+	}
+	return result
+}
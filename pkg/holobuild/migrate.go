@@ -0,0 +1,256 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/pkgimport"
+)
+
+//canonicalArchNames contains the architecture names that MigrateDefinition
+//uses instead of their synonyms in archMap (the names used by Arch Linux).
+var canonicalArchNames = map[build.Architecture]string{
+	build.ArchitectureAny:     "any",
+	build.ArchitectureI386:    "i686",
+	build.ArchitectureX86_64:  "x86_64",
+	build.ArchitectureARMv5:   "arm",
+	build.ArchitectureARMv6h:  "armv6h",
+	build.ArchitectureARMv7h:  "armv7h",
+	build.ArchitectureAArch64: "aarch64",
+}
+
+var (
+	//matches "[section]" and "[[section]]" lines
+	tableHeaderRx = regexp.MustCompile(`^\s*\[(\[)?\s*([A-Za-z0-9_.-]+)\s*\]\]?\s*(?:#.*)?$`)
+	//matches the first line of "key = value"
+	keyValueRx = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)\s*=\s*(.*)$`)
+	//matches basic strings and literal strings on a single line
+	stringLiteralRx = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'[^']*'`)
+)
+
+//MigrateDefinition rewrites a package definition to use the current schema:
+//
+//- `setupScript` and `cleanupScript` in the [package] section are replaced by
+//  [[action]] sections (before all existing ones, to keep the order of the
+//  scripts).
+//- Architecture names in `package.architecture` and in the `architectures` of
+//  file system entries are replaced by their canonical synonyms.
+//
+//The definition is rewritten line by line, so comments and formatting are
+//preserved except for the moved keys. Deprecated keys that cannot be replaced
+//automatically are reported as warnings. If nothing needs to be migrated, the
+//definition is returned unchanged.
+func MigrateDefinition(blob []byte) (result []byte, warnings []string, err error) {
+	lines := strings.Split(string(blob), "\n")
+
+	var (
+		out            []string
+		table          string
+		firstActionIdx = -1 //index in `out` of the first [[action]] header
+		scripts        = make(map[string]string)
+	)
+	for idx := 0; idx < len(lines); idx++ {
+		line := lines[idx]
+		if match := tableHeaderRx.FindStringSubmatch(line); match != nil {
+			table = match[2]
+			if match[1] != "" && table == "action" && firstActionIdx < 0 {
+				firstActionIdx = len(out)
+			}
+			out = append(out, line)
+			continue
+		}
+		match := keyValueRx.FindStringSubmatch(line)
+		if match == nil {
+			out = append(out, line)
+			continue
+		}
+		key, value := match[1], match[2]
+		end := findValueEnd(lines, idx, value)
+		valueLines := lines[idx : end+1]
+		idx = end
+
+		//match keys case-insensitively like the TOML decoder does
+		switch {
+		case table == "package" && strings.EqualFold(key, "setupScript"):
+			scripts["setup"] = strings.Join(append([]string{value}, valueLines[1:]...), "\n")
+		case table == "package" && strings.EqualFold(key, "cleanupScript"):
+			scripts["cleanup"] = strings.Join(append([]string{value}, valueLines[1:]...), "\n")
+		case table == "package" && strings.EqualFold(key, "definitionFile"):
+			warnings = append(warnings, "The 'package.definitionFile' key is deprecated and cannot be migrated automatically.")
+			out = append(out, valueLines...)
+		case table == "package" && strings.EqualFold(key, "architecture"),
+			(table == "file" || table == "directory" || table == "symlink") && strings.EqualFold(key, "architectures"):
+			for _, valueLine := range valueLines {
+				out = append(out, stringLiteralRx.ReplaceAllStringFunc(valueLine, canonicalArchLiteral))
+			}
+		default:
+			out = append(out, valueLines...)
+		}
+	}
+
+	//insert the [[action]] sections for the former scripts
+	var actionLines []string
+	for _, actionType := range []string{"setup", "cleanup"} {
+		if value, exists := scripts[actionType]; exists {
+			actionLines = append(actionLines,
+				"[[action]]",
+				fmt.Sprintf("on = %q", actionType),
+				"script = "+value,
+				"",
+			)
+		}
+	}
+	if len(actionLines) > 0 {
+		if firstActionIdx >= 0 {
+			out = append(out[:firstActionIdx], append(actionLines, out[firstActionIdx:]...)...)
+		} else {
+			//append at the end, but keep the final newline at the very end
+			trailer := []string{}
+			if len(out) > 0 && out[len(out)-1] == "" {
+				out, trailer = out[:len(out)-1], []string{""}
+			}
+			if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+				out = append(out, "")
+			}
+			out = append(out, actionLines[:len(actionLines)-1]...)
+			out = append(out, trailer...)
+		}
+	}
+
+	result = []byte(strings.Join(out, "\n"))
+	var p PackageDefinition
+	_, err = toml.Decode(string(result), &p)
+	if err != nil {
+		return nil, warnings, fmt.Errorf("cannot migrate package definition: result would not be valid TOML: %s", err.Error())
+	}
+	return result, warnings, nil
+}
+
+//findValueEnd returns the index of the last line of the value that starts in
+//lines[idx] (which can span multiple lines for multi-line strings and arrays).
+func findValueEnd(lines []string, idx int, value string) int {
+	var delimiter string
+	switch {
+	case strings.HasPrefix(value, `"""`):
+		delimiter = `"""`
+	case strings.HasPrefix(value, `'''`):
+		delimiter = `'''`
+	case strings.HasPrefix(value, "["):
+		delimiter = "]"
+	default:
+		return idx
+	}
+
+	if strings.Contains(value[len(delimiter):], delimiter) {
+		return idx
+	}
+	for end := idx + 1; end < len(lines); end++ {
+		if strings.Contains(lines[end], delimiter) {
+			return end
+		}
+	}
+	//unterminated value (the TOML decoder will complain about it)
+	return len(lines) - 1
+}
+
+//canonicalArchLiteral replaces a quoted architecture name by its canonical
+//synonym (with the same quotes).
+func canonicalArchLiteral(literal string) string {
+	quote := literal[:1]
+	name := literal[1 : len(literal)-1]
+	arch, ok := archMap[name]
+	if !ok {
+		//unknown architectures are reported by the parser
+		return literal
+	}
+	return quote + canonicalArchNames[arch] + quote
+}
+
+//RenderMigrationDiff renders the changes made by MigrateDefinition as a
+//unified diff that can be applied with patch(1).
+func RenderMigrationDiff(fileName string, oldBlob, newBlob []byte) string {
+	ops := pkgimport.DiffLines(
+		strings.Split(strings.TrimSuffix(string(oldBlob), "\n"), "\n"),
+		strings.Split(strings.TrimSuffix(string(newBlob), "\n"), "\n"),
+	)
+
+	//count the lines of each file that precede each operation
+	oldLineNo := make([]int, len(ops)+1)
+	newLineNo := make([]int, len(ops)+1)
+	for idx, op := range ops {
+		oldLineNo[idx+1], newLineNo[idx+1] = oldLineNo[idx], newLineNo[idx]
+		if !strings.HasPrefix(op, "+") {
+			oldLineNo[idx+1]++
+		}
+		if !strings.HasPrefix(op, "-") {
+			newLineNo[idx+1]++
+		}
+	}
+
+	const contextLines = 3
+	lines := []string{"--- " + fileName, "+++ " + fileName}
+	for idx := 0; idx < len(ops); {
+		if strings.HasPrefix(ops[idx], " ") {
+			idx++
+			continue
+		}
+		//found a change -> the hunk includes all following changes that are
+		//separated by at most 2*contextLines unchanged lines
+		lastChange := idx
+		for k := idx + 1; k < len(ops) && k-lastChange <= 2*contextLines+1; k++ {
+			if !strings.HasPrefix(ops[k], " ") {
+				lastChange = k
+			}
+		}
+		start := idx - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := lastChange + 1 + contextLines
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		lines = append(lines, fmt.Sprintf("@@ -%s +%s @@",
+			hunkRange(oldLineNo[start], oldLineNo[end]),
+			hunkRange(newLineNo[start], newLineNo[end]),
+		))
+		for _, op := range ops[start:end] {
+			lines = append(lines, op[:1]+op[2:])
+		}
+		idx = end
+	}
+	return strings.Join(lines, "\n")
+}
+
+//hunkRange renders the line range of a hunk for RenderMigrationDiff.
+func hunkRange(startLineNo, endLineNo int) string {
+	count := endLineNo - startLineNo
+	if count == 0 {
+		return fmt.Sprintf("%d,0", startLineNo)
+	}
+	return fmt.Sprintf("%d,%d", startLineNo+1, count)
+}
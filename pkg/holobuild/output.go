@@ -0,0 +1,167 @@
+/*******************************************************************************
+*
+* Copyright 2016 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//DefaultOutputMode is the mode of the package file (and the files written
+//next to it) if Options.OutputMode is not set.
+const DefaultOutputMode os.FileMode = 0644
+
+//outputMode returns the mode for the package file (see Options.OutputMode).
+func (opts Options) outputMode() os.FileMode {
+	if opts.OutputMode == 0 {
+		return DefaultOutputMode
+	}
+	return opts.OutputMode
+}
+
+//WriteOutput will write the generated package to a file (or stdout) if
+//required. If the given file name is "-", stdout will be written to.
+//If the given file name is empty, a name is chosen automatically.
+//
+//An existing file is only overwritten as permitted by opts.Force and
+//opts.IfChanged. The package file gets the mode from opts.OutputMode
+//regardless of the umask (also when an existing file is overwritten), and is
+//written atomically if opts.AtomicWrite is set.
+func WriteOutput(pkgBytes []byte, pkgFile string, opts Options) (wasWritten bool, e error) {
+	//print on stdout does not require additional logic
+	if pkgFile == "-" {
+		_, err := os.Stdout.Write(pkgBytes)
+		return false, err
+	}
+
+	//only write file if content has changed
+	if !opts.Force {
+		fileHandle, err := os.Open(pkgFile)
+		if err == nil {
+			defer fileHandle.Close()
+			equal, err := readerEqualTo(fileHandle, pkgBytes)
+			if equal || err != nil {
+				return false, err
+			}
+			if !opts.IfChanged {
+				return true, errors.New("file already exists and has different contents; won't overwrite without --force")
+			}
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+
+	if opts.AtomicWrite {
+		return true, writeFileAtomically(pkgFile, pkgBytes, opts.outputMode())
+	}
+	return true, writeFileWithMode(pkgFile, pkgBytes, opts.outputMode())
+}
+
+//checkOutputByDigest checks that Options.OutputByDigest is compatible with
+//the other options.
+func checkOutputByDigest(opts Options) error {
+	switch opts.OutputFileName {
+	case "":
+		//use working directory
+	case "-":
+		return errors.New("cannot name the package by its digest when it is written to standard output")
+	default:
+		fi, err := os.Stat(opts.OutputFileName)
+		if err != nil || !fi.Mode().IsDir() {
+			return fmt.Errorf("cannot name the package by its digest when writing to %s: not a directory", opts.OutputFileName)
+		}
+	}
+	if opts.RepositoryDirectory != "" {
+		return errors.New("cannot name the package by its digest when placing it in a repository")
+	}
+	return nil
+}
+
+//digestFileName implements Options.OutputByDigest by replacing the file name
+//in the given package path with the SHA-256 digest of the package contents.
+func digestFileName(pkgPath, extension string, pkgBytes []byte) string {
+	sum := sha256.Sum256(pkgBytes)
+	return filepath.Join(filepath.Dir(pkgPath), hex.EncodeToString(sum[:])+extension)
+}
+
+//writeFileWithMode is like ioutil.WriteFile, but the file gets exactly the
+//given mode, even if the umask is more permissive or the file already exists.
+func writeFileWithMode(path string, contents []byte, mode os.FileMode) error {
+	err := ioutil.WriteFile(path, contents, mode)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+//writeFileAtomically writes a file by replacing it with a temporary file, so
+//that readers never observe a partially written file.
+func writeFileAtomically(path string, contents []byte, mode os.FileMode) (returnedErr error) {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if returnedErr != nil {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}
+	}()
+
+	_, err = tmpFile.Write(contents)
+	if err != nil {
+		return err
+	}
+	err = tmpFile.Chmod(mode)
+	if err != nil {
+		return err
+	}
+	err = tmpFile.Sync()
+	if err != nil {
+		return err
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+//Return true if the reader contains exactly the given byte string.
+func readerEqualTo(r io.Reader, str []byte) (bool, error) {
+	buf := make([]byte, len(str))
+	_, err := io.ReadFull(r, buf)
+	switch err {
+	case io.ErrUnexpectedEOF:
+		return false, nil
+	case nil:
+		return bytes.Equal(buf, str), nil
+	default:
+		return false, err
+	}
+}
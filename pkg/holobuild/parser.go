@@ -0,0 +1,1450 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//PackageDefinition only needs a nice exported name for the TOML parser to
+//produce more meaningful error messages on malformed input data.
+//
+//The `explain` tags (and the optional `required`, `default` and `deprecated`
+//tags) on this struct and the section structs are rendered by ExplainSchema.
+type PackageDefinition struct {
+	Include     []string             `explain:"Further package definitions that are merged into this one (resolved relative to this file)"` //see include.go
+	Package     PackageSection       `explain:"Global properties of the package" required:"true"`
+	Defaults    DefaultsSection      `explain:"Default values for [[file]] and [[directory]] sections"` //see defaults.go
+	Debian      DebianSection        `explain:"Properties that only apply to Debian packages"`
+	Pacman      PacmanSection        `explain:"Properties that only apply to Pacman packages"`
+	File        []FileSection        `explain:"A file to be added to the package"`
+	Directory   []DirectorySection   `explain:"A directory to be added to the package"`
+	Symlink     []SymlinkSection     `explain:"A symbolic link to be added to the package"`
+	Action      []ActionSection      `explain:"A script that runs when the package is installed or removed"`
+	Trigger     []TriggerSection     `explain:"A script that runs when files or packages of other packages change"`
+	Service     []ServiceSection     `explain:"A systemd unit that is enabled and (re)started by the package"`
+	Alternative []AlternativeSection `explain:"An alternative for a link managed by update-alternatives(8)"`
+	User        []UserSection        `explain:"A user account to be provisioned when the package is installed"` //see entities.go
+	Group       []GroupSection       `explain:"A group to be provisioned when the package is installed"`        //see entities.go
+	Manpage     []ManpageSection     `explain:"A manual page to be installed below /usr/share/man"`             //see manpage.go
+
+	DependencyMapping []DependencyMappingSection `explain:"The packages that satisfy a dependency found by package.autoRequires"`
+	Check             []CheckSection             `explain:"An assertion about the generated package that is verified after the build"` //see assert.go
+}
+
+//PackageSection only needs a nice exported name for the TOML parser to produce
+//more meaningful error messages on malformed input data.
+type PackageSection struct {
+	Name           string   `explain:"Name of the package" required:"true"`
+	Version        string   `explain:"Version of the package, as dot-separated numbers" required:"true"`
+	Alpha          uint     `explain:"Marks the version as an alpha prerelease"`
+	Beta           uint     `explain:"Marks the version as a beta prerelease"`
+	Release        uint     `explain:"Release number, to be incremented when the package changes but the version does not" default:"1"`
+	Epoch          uint     `explain:"Epoch, to be incremented when the version numbering changes"`
+	Description    string   `explain:"Short description of the package"`
+	Author         string   `explain:"Maintainer of the package, as \"Name <email>\""`
+	Architecture   string   `explain:"Architecture of the package" default:"\"any\""`
+	Requires       []string `explain:"Packages that this package requires, optionally with version constraints"`
+	Provides       []string `explain:"Virtual packages that this package provides"`
+	Conflicts      []string `explain:"Packages that cannot be installed together with this package"`
+	Replaces       []string `explain:"Packages that this package replaces"`
+	Supersedes     []string `explain:"Packages that this package is the successor of, which are added to provides, conflicts and replaces"`
+	SetupScript    string   `explain:"Script that runs after the package is installed or upgraded" deprecated:"use an [[action]] with on = \"setup\" instead"`
+	CleanupScript  string   `explain:"Script that runs after the package is removed" deprecated:"use an [[action]] with on = \"cleanup\" instead"`
+	DefinitionFile string   `explain:"Path of the file that contains the [[user]] and [[group]] sections in the package" deprecated:"will be removed in the next major release"` //see compileEntityDefinitions
+	EntityMode     string   `explain:"How [[user]] and [[group]] sections are provisioned (\"holo\" or \"native\")" default:"\"holo\""`                                          //see compileEntityDefinitions and compileEntityScript
+
+	Strict           bool `explain:"Reject symlinks with targets outside the package and suspicious file modes"` //see processSymlinkTargets and checkFileMode
+	RelativeSymlinks bool `explain:"Rewrite absolute symlink targets into relative ones"`                        //see processSymlinkTargets
+	AutoProvides     bool `explain:"Add Provides entries for the shared libraries and pkg-config files in the package"`
+	AutoRequires     bool `explain:"Add Requires entries for the interpreters and shared libraries that the files in the package need"`
+	HologramProvides bool `explain:"Add a virtual Provides entry like \"hologram(name) = version\" that identifies the package as a Holo hologram"`
+
+	MaxInstalledSize string `explain:"Fail the build if the installed size of the package exceeds this size, e.g. \"50MiB\""` //see parseSize and validateSizeLimits
+	MaxPackageSize   string `explain:"Fail the build if the package file exceeds this size, e.g. \"10MiB\""`                  //see parseSize and checkPackageSize
+}
+
+//DebianSection only needs a nice exported name for the TOML parser to produce
+//more meaningful error messages on malformed input data.
+type DebianSection struct {
+	MultiArch string `explain:"Value of the Multi-Arch field (\"no\", \"same\", \"foreign\" or \"allowed\")"`
+	Essential bool   `explain:"Mark the package as essential, so that it cannot be removed without force"`
+	Protected bool   `explain:"Mark the package as protected, so that it cannot be removed without force (requires dpkg 1.20.1)"`
+	Templates string `explain:"Contents of the debconf templates file"`
+	Config    string `explain:"The debconf config script (requires templates)"`
+}
+
+//PacmanSection only needs a nice exported name for the TOML parser to produce
+//more meaningful error messages on malformed input data. The keys are spelled
+//like the corresponding .PKGINFO fields.
+type PacmanSection struct {
+	XData   bool   `toml:"xdata" explain:"Write the xdata field (\"xdata = pkgtype=...\") into .PKGINFO, like makepkg since pacman 6.1"`
+	PkgType string `toml:"pkgtype" explain:"Package type for the xdata field (\"pkg\", \"split\" or \"debug\"); implies xdata" default:"\"pkg\""`
+	PkgBase string `toml:"pkgbase" explain:"Value of the pkgbase field" default:"the package name, without the \"-debug\" suffix for debug packages"`
+}
+
+//FileSection only needs a nice exported name for the TOML parser to produce
+//more meaningful error messages on malformed input data.
+type FileSection struct {
+	Path        string      `explain:"Absolute path of the file" required:"true"`
+	Content     string      `explain:"Content of the file (exactly one of content, contentFrom and contentFromCommand is required)"`
+	ContentFrom string      `explain:"Path of a file containing the content (resolved relative to the package definition)"`
+	Raw         bool        `explain:"Do not remove the common indentation from content"`
+	Mode        string      `explain:"Mode bits as an octal string, e.g. \"0600\"" default:"fileMode from [defaults], or \"0644\""` //TOML does not support octal number literals, so we have to write: mode = "0666"
+	AllowSetuid bool        `explain:"Allow setuid and setgid bits in mode, even in strict mode"`                                   //see checkFileMode
+	Owner       interface{} `explain:"Owner of the file, as a name or numeric ID" default:"owner from [defaults], or \"root\""`     //either string (name) or integer (ID)
+	Group       interface{} `explain:"Group of the file, as a name or numeric ID" default:"group from [defaults], or \"root\""`     //same
+	MTime       string      `toml:"mtime" explain:"Modification time as an RFC 3339 timestamp"`                                     //RFC 3339 timestamp, e.g. mtime = "2023-01-01T00:00:00Z"
+	//Architectures restricts this entry to packages built for these
+	//architectures (see matchesArchitectures).
+	Architectures []string `explain:"Only include this entry in packages for these architectures"`
+	//ExcludeFormats leaves this entry out of packages in these formats (see
+	//isExcludedFormat).
+	ExcludeFormats []string `explain:"Do not include this entry in packages in these formats"`
+	//When is evaluated by matchesCondition (see condition.go).
+	When string `explain:"Only include this entry if this condition is true, e.g. \"format == 'rpm' && arch == 'x86_64'\""`
+	//ContentFromCommand is only allowed with Options.AllowExec (see
+	//runContentCommand).
+	ContentFromCommand string `explain:"Shell command whose standard output is the content (requires --allow-exec)"`
+	//ContentFromSha256 is checked by verifyContentDigest.
+	ContentFromSha256 string `explain:"Expected SHA-256 checksum (as 64 hexadecimal digits) of the file referenced by contentFrom"`
+	//Compress is a key of compressionExtensions (see compressFileContent).
+	Compress string `explain:"Compress the content (\"gzip\" or \"zstd\") and append \".gz\" or \".zst\" to the path"`
+	//Doc, License and Config are only recorded by formats that support them
+	//(see filesystem.RegularFile).
+	Doc     bool `explain:"Mark the file as documentation (like %doc in RPM)"`
+	License bool `explain:"Mark the file as a license text (like %license in RPM)"`
+	Config  bool `explain:"Mark the file as a configuration file that keeps local modifications on upgrade (conffiles in Debian, %config in RPM)"`
+	//Verify is checked by parseVerifyAttributes. A nil slice (no `verify` key)
+	//is different from an empty list (verify nothing).
+	Verify []string `explain:"Attributes to check when verifying the installed package (like %verify in RPM)" default:"all attributes"`
+	//Sensitive files get sensitiveFileMode by default. Since other users
+	//cannot read them, `dump-package --redact-restricted` does not show their
+	//content.
+	Sensitive bool `explain:"Mark the file as containing secrets: The default mode becomes \"0600\", and modes giving access to other users are rejected"`
+	//source is filled by decodeDefinition (see include.go).
+	source sectionSource
+	//NOTE: We could use custom types implementing TextUnmarshaler for Mode,
+	//Owner and Group, but then toml.Decode would accept any primitive type.
+	//But for Mode, we need the type enforcement to prevent the "mode = 0666"
+	//error (which would be 666 in decimal = something else in octal). And for
+	//Owner and Group, we need to distinguish IDs from names using the type.
+}
+
+//DirectorySection only needs a nice exported name for the TOML parser to
+//produce more meaningful error messages on malformed input data.
+type DirectorySection struct {
+	Path           string      `explain:"Absolute path of the directory" required:"true"`
+	Mode           string      `explain:"Mode bits as an octal string, e.g. \"0700\"" default:"directoryMode from [defaults], or \"0755\""` //see above
+	Owner          interface{} `explain:"Owner of the directory, as a name or numeric ID" default:"owner from [defaults], or \"root\""`     //see above
+	Group          interface{} `explain:"Group of the directory, as a name or numeric ID" default:"group from [defaults], or \"root\""`     //see above
+	MTime          string      `toml:"mtime" explain:"Modification time as an RFC 3339 timestamp"`                                          //see above
+	Architectures  []string    `explain:"Only include this entry in packages for these architectures"`                                      //see above
+	ExcludeFormats []string    `explain:"Do not include this entry in packages in these formats"`                                           //see above
+	When           string      `explain:"Only include this entry if this condition is true, e.g. \"format == 'rpm' && arch == 'x86_64'\""`  //see above
+	source         sectionSource
+}
+
+//SymlinkSection only needs a nice exported name for the TOML parser to produce
+//more meaningful error messages on malformed input data.
+type SymlinkSection struct {
+	Path           string      `explain:"Absolute path of the symlink" required:"true"`
+	Target         string      `explain:"Target of the symlink" required:"true"`
+	KeepAbsolute   bool        `explain:"Do not rewrite an absolute target with package.relativeSymlinks"`                                 //see processSymlinkTargets
+	Owner          interface{} `explain:"Owner of the symlink, as a name or numeric ID" default:"\"root\""`                                //see FileSection
+	Group          interface{} `explain:"Group of the symlink, as a name or numeric ID" default:"\"root\""`                                //see FileSection
+	Architectures  []string    `explain:"Only include this entry in packages for these architectures"`                                     //see FileSection
+	ExcludeFormats []string    `explain:"Do not include this entry in packages in these formats"`                                          //see FileSection
+	When           string      `explain:"Only include this entry if this condition is true, e.g. \"format == 'rpm' && arch == 'x86_64'\""` //see FileSection
+	source         sectionSource
+}
+
+//ActionSection only needs a nice exported name for the TOML parser to produce
+//more meaningful error messages on malformed input data.
+type ActionSection struct {
+	On             string        `explain:"When the script runs (\"setup\", \"cleanup\", \"pre-setup\", \"pre-cleanup\", \"pre-transaction\", \"post-transaction\" or \"verify\")" required:"true"`
+	Script         string        `explain:"The script (exactly one of script and scriptFrom is required)"`
+	ScriptFrom     string        `explain:"Path of a file containing the script (resolved relative to the package definition)"`
+	Interpreter    string        `explain:"Absolute path of the interpreter for the script" default:"\"/bin/sh\""`
+	ExcludeFormats []string      `explain:"Do not include this action in packages in these formats"`
+	When           string        `explain:"Only include this action if this condition is true (see [[file]])"`
+	source         sectionSource //see FileSection
+}
+
+//TriggerSection only needs a nice exported name for the TOML parser to
+//produce more meaningful error messages on malformed input data.
+type TriggerSection struct {
+	Paths       []string      `explain:"Absolute paths whose changes activate the trigger (paths or packages is required)"`
+	Packages    []string      `explain:"Packages whose installation, upgrade or removal activates the trigger"`
+	Script      string        `explain:"The script (exactly one of script and scriptFrom is required)"`
+	ScriptFrom  string        `explain:"Path of a file containing the script (resolved relative to the package definition)"` //see ActionSection
+	Interpreter string        `explain:"Absolute path of the interpreter for the script" default:"\"/bin/sh\""`              //see ActionSection
+	When        string        `explain:"Only include this trigger if this condition is true (see [[file]])"`
+	source      sectionSource //see FileSection
+}
+
+//ServiceSection only needs a nice exported name for the TOML parser to
+//produce more meaningful error messages on malformed input data.
+type ServiceSection struct {
+	Unit             string `explain:"Name of the systemd unit, e.g. \"foo.service\"" required:"true"`
+	Enable           bool   `explain:"Enable the unit when the package is installed"`
+	RestartOnUpgrade bool   `explain:"Restart the unit when the package is upgraded"`
+}
+
+//AlternativeSection only needs a nice exported name for the TOML parser to
+//produce more meaningful error messages on malformed input data.
+type AlternativeSection struct {
+	Name     string `explain:"Name of the link group" default:"the file name of link"`
+	Link     string `explain:"Absolute path of the link that points to the chosen alternative" required:"true"`
+	Path     string `explain:"Absolute path of this alternative" required:"true"`
+	Priority int    `explain:"Priority of this alternative (the highest one is chosen automatically)" default:"0"`
+}
+
+//DependencyMappingSection only needs a nice exported name for the TOML parser
+//to produce more meaningful error messages on malformed input data.
+type DependencyMappingSection struct {
+	Dependency string `explain:"Interpreter or shared library, as an absolute path, file name or SONAME" required:"true"`
+	Debian     string `explain:"Name of the package that satisfies the dependency in Debian packages"`
+	Pacman     string `explain:"Name of the package that satisfies the dependency in Pacman packages"`
+	RPM        string `toml:"rpm" explain:"Name of the package (or capability) that satisfies the dependency in RPM packages"`
+}
+
+//CheckSection only needs a nice exported name for the TOML parser to produce
+//more meaningful error messages on malformed input data.
+type CheckSection struct {
+	PathExists     string `explain:"Absolute path of an entry that must be in the package"`
+	Mode           string `explain:"Permission bits (as octal number) that the entry at pathExists must have"`
+	PathMissing    string `explain:"Absolute path of an entry that may not be in the package"`
+	ScriptContains string `explain:"A string that must occur in one of the maintainer scripts of the package"`
+	When           string `explain:"Only verify this check if this condition is true (see [[file]])"`
+}
+
+//names of link groups for update-alternatives (also used as file names below
+///var/lib/dpkg/alternatives)
+var alternativeNameRx = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.+-]*$`)
+
+//systemd unit names, restricted to characters that need no quoting in shell
+//scripts (see systemd.unit(5) for the list of unit types)
+var unitNameRx = regexp.MustCompile(`^[a-zA-Z0-9:_.\\@-]+\.(?:service|socket|device|mount|automount|swap|target|path|timer|slice|scope)$`)
+
+//versions are dot-separated numbers like (0|[1-9][0-9]*) (this enforces no
+//trailing zeros)
+var versionRx = regexp.MustCompile(`^(?:0|[1-9][0-9]*)(?:\.(?:0|[1-9][0-9]*))*$`)
+
+//the author information should be in the form "Firstname Lastname <email.address@server.tld>"
+var authorRx = regexp.MustCompile(`^[^<>]+\s+<[^<>\s]+>$`)
+
+//upper bounds for values that would otherwise only be limited by the size of
+//the input (see validatePath, parseFileMode and the prerelease versions in
+//compilePackage); paths are limited like PATH_MAX on Linux
+const (
+	maxPathLength        = 4096
+	maxModeLength        = 32
+	maxPrereleaseVersion = 1<<32 - 1
+)
+
+//default mode for [[file]] sections with `sensitive = true`
+const sensitiveFileMode os.FileMode = 0600
+
+//map supported input strings for architecture to internal architecture enum;
+//the "BEGIN ARCH" and "END ARCH" comments are used by test/generate-architecture-tests.sh
+var archMap = map[string]build.Architecture{
+	//BEGIN ARCH
+	"aarch64": build.ArchitectureAArch64,
+	"all":     build.ArchitectureAny, //from Debian
+	"amd64":   build.ArchitectureX86_64,
+	"any":     build.ArchitectureAny,     //from Arch Linux
+	"arm":     build.ArchitectureARMv5,   //from Arch Linux
+	"arm64":   build.ArchitectureAArch64, //from Debian
+	"armel":   build.ArchitectureARMv5,   //from Debian
+	"armhf":   build.ArchitectureARMv7h,  //from Debian
+	"armv5tl": build.ArchitectureARMv5,   //from Mageia
+	"armv6h":  build.ArchitectureARMv6h,  //from Arch Linux
+	"armv6hl": build.ArchitectureARMv6h,  //from OpenSuse
+	"armv7h":  build.ArchitectureARMv7h,  //from Arch Linux
+	"armv7hl": build.ArchitectureARMv7h,  //from OpenSuse
+	"i386":    build.ArchitectureI386,
+	"i686":    build.ArchitectureI386,
+	"noarch":  build.ArchitectureAny, //from RPM
+	"x86_64":  build.ArchitectureX86_64,
+	//END ARCH
+}
+
+//ParseMode selects how much of a package definition is processed by
+//ParsePackageDefinition() and ParsePackageDefinitionFiles().
+type ParseMode int
+
+const (
+	//ParseFull processes the whole package definition, so that the resulting
+	//package can be built.
+	ParseFull ParseMode = iota
+	//ParseMetadataOnly only processes what is needed to describe the package,
+	//e.g. to choose its file name. Files referenced by `contentFrom` or
+	//`scriptFrom` are not read (and need not exist), `contentFromCommand` is
+	//not run, file contents are not compressed, and the entity definition
+	//file for holo-users-groups is left empty. Everything else is validated
+	//as with ParseFull. The resulting package cannot be built.
+	ParseMetadataOnly
+)
+
+//ParseOptions contains the settings for ParsePackageDefinition() and
+//ParsePackageDefinitionFiles(). The zero value is a valid configuration.
+type ParseOptions struct {
+	//BaseDirectory is where relative paths in the package definition
+	//(`contentFrom`, `include` etc.) are resolved. If empty, the working
+	//directory is used by ParsePackageDefinition(), and the directory of each
+	//file by ParsePackageDefinitionFiles().
+	BaseDirectory string
+	//Mode selects whether files referenced by the package definition are read.
+	Mode ParseMode
+	//Architecture replaces the architecture from the package definition if
+	//not empty.
+	Architecture string
+	//Format is the package format that is being built. Entries that list it
+	//in `excludeFormats` are left out. If empty, no entries are left out.
+	Format string
+	//Defines contains the values of variables for `when` conditions, in
+	//addition to the predefined variables `format` and `arch` (see
+	//condition.go). The names must be accepted by ValidateDefineName.
+	Defines map[string]string
+	//AllowExec allows `contentFromCommand` in [[file]] sections. The commands
+	//are run with sh(1) while the package definition is parsed.
+	AllowExec bool
+	//AllowNetwork allows `contentFrom` in [[file]] sections to refer to an
+	//HTTP(S) URL, which is downloaded while the package definition is
+	//parsed. (Package definitions that were themselves fetched from a URL can
+	//always refer to other URLs.)
+	AllowNetwork bool
+	//DownloadCacheDirectory, if not empty, is where files downloaded for
+	//`contentFrom` are cached. Only files with `contentFromSha256` are cached,
+	//keyed by their URL and checksum (see fetchContentFrom).
+	DownloadCacheDirectory string
+	//Version, if not nil, replaces the version, prerelease version and
+	//release from the package definition. The "version" field may then be
+	//omitted from the package definition.
+	Version *PackageVersion
+}
+
+//ParsePackageDefinition parses a package definition from the given input.
+//Non-fatal problems (e.g. deprecated keys) are returned as warnings.
+//
+//The operation is successful if the returned []error is empty.
+func ParsePackageDefinition(input io.Reader, opts ParseOptions) (*build.Package, []string, []error) {
+	return parsePackageDefinition(input, "-", opts, nil)
+}
+
+//parsePackageDefinition implements ParsePackageDefinition. The digests of all
+//input files are recorded in `inputs` (if not nil), with the given name for
+//the input itself.
+func parsePackageDefinition(input io.Reader, inputName string, opts ParseOptions, inputs *inputRecorder) (*build.Package, []string, []error) {
+	if opts.BaseDirectory == "" {
+		opts.BaseDirectory = "."
+	}
+
+	//read from input
+	blob, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	//the TOML parser would silently replace invalid UTF-8 sequences
+	if !utf8.Valid(blob) {
+		return nil, nil, []error{errors.New("package definition is not valid UTF-8")}
+	}
+	inputs.RecordBlob(inputName, blob)
+	p, _, err := decodeDefinition(blob, sectionSource{BaseDirectory: opts.BaseDirectory}, inputs)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	return compilePackage(p, opts, inputs)
+}
+
+//ParsePackageDefinitionFiles is like ParsePackageDefinition, but parses
+//multiple package definitions from the given files, and merges them into a
+//single package. Relative `contentFrom` paths are resolved relative to the
+//directory of the file containing them, unless ParseOptions.BaseDirectory is
+//set. Fields in the [package] section may be given in multiple files only if
+//they have the same value, except for package relations (`requires` etc.)
+//which are combined.
+//
+//The operation is successful if the returned []error is empty.
+func ParsePackageDefinitionFiles(fileNames []string, opts ParseOptions) (*build.Package, []string, []error) {
+	return parsePackageDefinitionFiles(fileNames, opts, nil)
+}
+
+//parsePackageDefinitionFiles implements ParsePackageDefinitionFiles. The
+//digests of all input files are recorded in `inputs` (if not nil).
+func parsePackageDefinitionFiles(fileNames []string, opts ParseOptions, inputs *inputRecorder) (*build.Package, []string, []error) {
+	m := newInputMerger()
+	for _, fileName := range fileNames {
+		blob, err := readPathOrURL(fileName)
+		if err != nil {
+			return nil, nil, []error{err}
+		}
+		//the TOML parser would silently replace invalid UTF-8 sequences
+		if !utf8.Valid(blob) {
+			return nil, nil, []error{fmt.Errorf("package definition %s is not valid UTF-8", fileName)}
+		}
+		inputs.RecordBlob(fileName, blob)
+		source := sectionSource{FileName: fileName, BaseDirectory: opts.BaseDirectory}
+		if opts.BaseDirectory == "" {
+			source.BaseDirectory = definitionDirectory(fileName)
+		}
+		p, keys, err := decodeDefinition(blob, source, inputs)
+		if err != nil {
+			return nil, nil, []error{err}
+		}
+		m.Merge(p, keys, fileName)
+	}
+	if len(m.Errors.Errors) > 0 {
+		return nil, nil, m.Errors.Errors
+	}
+	//all sections know their base directory from their source
+	opts.BaseDirectory = "."
+	return compilePackage(&m.Result, opts, inputs)
+}
+
+//compilePackage restructures the parsed data into a build.Package, and
+//validates it along the way.
+func compilePackage(p *PackageDefinition, opts ParseOptions, inputs *inputRecorder) (*build.Package, []string, []error) {
+	pkg := build.Package{
+		Name:              strings.TrimSpace(p.Package.Name),
+		Version:           strings.TrimSpace(p.Package.Version),
+		Release:           p.Package.Release,
+		Epoch:             p.Package.Epoch,
+		Description:       strings.TrimSpace(p.Package.Description),
+		Author:            strings.TrimSpace(p.Package.Author),
+		ArchitectureInput: p.Package.Architecture,
+		AutoProvides:      p.Package.AutoProvides,
+		AutoRequires:      p.Package.AutoRequires,
+		HologramProvides:  p.Package.HologramProvides,
+		Actions:           []build.PackageAction{},
+		FSRoot:            filesystem.NewDirectory(),
+	}
+	pkg.FSRoot.Implicit = true
+	pkg.Debian = build.DebianOptions{
+		MultiArch: strings.TrimSpace(p.Debian.MultiArch),
+		Essential: p.Debian.Essential,
+		Protected: p.Debian.Protected,
+		Templates: strings.TrimSpace(string(pruneIndentation([]byte(p.Debian.Templates)))),
+		Config:    strings.TrimSpace(string(pruneIndentation([]byte(p.Debian.Config)))),
+	}
+	pkg.Pacman = build.PacmanOptions{
+		PackageBase: strings.TrimSpace(p.Pacman.PkgBase),
+		PackageType: strings.TrimSpace(p.Pacman.PkgType),
+		XData:       p.Pacman.XData,
+	}
+
+	ec := &ErrorCollector{}
+	if script := strings.TrimSpace(p.Package.SetupScript); script != "" {
+		ec.warnDeprecatedKey("package.setupScript")
+		pkg.AppendActions(build.PackageAction{
+			Type:    build.SetupAction,
+			Content: script,
+		})
+	}
+
+	if script := strings.TrimSpace(p.Package.CleanupScript); script != "" {
+		ec.warnDeprecatedKey("package.cleanupScript")
+		pkg.AppendActions(build.PackageAction{
+			Type:    build.CleanupAction,
+			Content: script,
+		})
+	}
+
+	if opts.Version != nil {
+		pkg.Version = opts.Version.Version
+		pkg.Release = opts.Version.Release
+	}
+
+	//default value for Release is 1
+	if pkg.Release == 0 {
+		pkg.Release = 1
+	}
+
+	//do some basic validation on the package name and version since we're
+	//going to use these to construct a path
+	switch {
+	case pkg.Name == "":
+		ec.Addf("Missing package name")
+	case strings.ContainsAny(pkg.Name, "/\r\n"):
+		ec.Addf("Invalid package name \"%s\" (may not contain slashes or newlines)", pkg.Name)
+		pkg.Name = "" // don't complain about the broken value again in generator.Validate()
+	}
+	switch {
+	case pkg.Version == "":
+		ec.Addf("Missing package version")
+	case !versionRx.MatchString(pkg.Version):
+		ec.Addf("Invalid package version \"%s\" (must be a chain of numbers like \"1.2.0\" or \"20151104\")", pkg.Version)
+		pkg.Version = "" // don't complain about the broken value again in generator.Validate()
+	}
+	if strings.ContainsAny(pkg.Description, "\r\n") {
+		ec.Addf("Invalid package description \"%s\" (may not contain newlines)", pkg.Name)
+		pkg.Description = "" // don't complain about the broken value again in generator.Validate()
+	} else if problem := checkCharacters(pkg.Description); problem != "" {
+		ec.Addf("Invalid package description %q (%s)", pkg.Description, problem)
+		pkg.Description = ""
+	}
+	//the author field is not required (except for --debian), but if it is
+	//given, check the format
+	if problem := checkCharacters(pkg.Author); problem != "" {
+		ec.Addf("Invalid package author %q (%s)", pkg.Author, problem)
+	} else if pkg.Author != "" && !authorRx.MatchString(pkg.Author) {
+		ec.Addf("Invalid package author \"%s\" (should look like \"Jane Doe <jane.doe@example.org>\")", pkg.Author)
+	}
+
+	//validate/translate prerelease versions (the TOML decoder converts
+	//negative numbers into huge unsigned ones, so the upper bound also
+	//catches those)
+	for _, prerelease := range []struct {
+		key   string
+		value uint
+	}{{"alpha", p.Package.Alpha}, {"beta", p.Package.Beta}} {
+		if prerelease.value > maxPrereleaseVersion {
+			ec.Addf("Invalid %s version %d (must be between 0 and %d)", prerelease.key, int64(prerelease.value), maxPrereleaseVersion)
+		}
+	}
+	if opts.Version != nil {
+		pkg.PrereleaseType = opts.Version.PrereleaseType
+		pkg.PrereleaseVersion = opts.Version.PrereleaseVersion
+	} else if p.Package.Alpha != 0 {
+		if p.Package.Beta != 0 {
+			ec.Addf("Package cannot have both \"alpha\" and \"beta\" version")
+		}
+		pkg.PrereleaseType = build.PrereleaseTypeAlpha
+		pkg.PrereleaseVersion = p.Package.Alpha
+	} else if p.Package.Beta != 0 {
+		pkg.PrereleaseType = build.PrereleaseTypeBeta
+		pkg.PrereleaseVersion = p.Package.Beta
+	} else {
+		//these are the default values anyway, but let's be verbose about it
+		pkg.PrereleaseType = build.PrereleaseTypeNone
+		pkg.PrereleaseVersion = 0
+	}
+
+	//parse architecture string
+	if opts.Architecture != "" {
+		pkg.ArchitectureInput = opts.Architecture
+	}
+	if pkg.ArchitectureInput != "" {
+		var ok bool
+		pkg.Architecture, ok = archMap[pkg.ArchitectureInput]
+		if !ok {
+			ec.Addf("Invalid package architecture \"%s\"", pkg.ArchitectureInput)
+		}
+	}
+
+	//prepare evaluation of `when` conditions
+	for _, name := range sortedDefineNames(opts.Defines) {
+		ec.Add(ValidateDefineName(name))
+	}
+	condEnv := conditionEnv{Format: opts.Format, Architecture: pkg.Architecture, Defines: opts.Defines}
+
+	//parse relations to other packages
+	pkg.Requires = parseRelatedPackages("requires", p.Package.Requires, ec)
+	pkg.Provides = parseRelatedPackages("provides", p.Package.Provides, ec)
+	pkg.Conflicts = parseRelatedPackages("conflicts", p.Package.Conflicts, ec)
+	pkg.Replaces = parseRelatedPackages("replaces", p.Package.Replaces, ec)
+	pkg.Supersedes = parseRelatedPackages("supersedes", p.Package.Supersedes, ec)
+	for _, rel := range pkg.Supersedes {
+		if rel.RelatedPackage == pkg.Name {
+			ec.Addf("Package \"%s\" cannot supersede itself", pkg.Name)
+		}
+	}
+
+	//parse size limits
+	pkg.MaxInstalledSize = parseSize("maxInstalledSize", p.Package.MaxInstalledSize, ec)
+	pkg.MaxPackageSize = parseSize("maxPackageSize", p.Package.MaxPackageSize, ec)
+
+	//compile entity definitions into either a definition file for
+	//holo-users-groups, or a pre-setup script calling groupadd/useradd
+	switch p.Package.EntityMode {
+	case "", "holo":
+		entityNode, entityPath := compileEntityDefinitions(p.Package, p.Group, p.User, opts.Mode, ec)
+		if entityNode != nil && entityPath != "" {
+			ec.Add(pkg.InsertFSNode(entityPath, entityNode))
+		}
+	case "native":
+		script := compileEntityScript(p.Package, p.Group, p.User, ec)
+		if script != "" {
+			pkg.AppendActions(build.PackageAction{
+				Type:    build.PreSetupAction,
+				Content: script,
+			})
+		}
+	default:
+		ec.Addf("Invalid entity mode \"%s\" (must be \"holo\" or \"native\")", p.Package.EntityMode)
+	}
+
+	//parse and validate actions
+	for idx, actSection := range p.Action {
+		sectionEC := &ErrorCollector{}
+		sectionBaseDirectory := actSection.source.BaseDirectory
+		if sectionBaseDirectory == "" {
+			sectionBaseDirectory = opts.BaseDirectory
+		}
+		inputs.RecordFile(sectionBaseDirectory, actSection.ScriptFrom)
+		action, isValid := parseAction(actSection, sectionBaseDirectory, opts.Mode, inputs, sectionEC, idx)
+		actionDesc := fmt.Sprintf("action %d", idx)
+		if matchesCondition(actSection.When, condEnv, sectionEC, actionDesc) && !isExcludedFormat(actSection.ExcludeFormats, opts.Format, sectionEC, actionDesc) && isValid {
+			pkg.AppendActions(action)
+		}
+		ec.addErrorsFrom(sectionEC, actSection.source)
+	}
+
+	//parse and validate triggers
+	for idx, triggerSection := range p.Trigger {
+		sectionEC := &ErrorCollector{}
+		sectionBaseDirectory := triggerSection.source.BaseDirectory
+		if sectionBaseDirectory == "" {
+			sectionBaseDirectory = opts.BaseDirectory
+		}
+		inputs.RecordFile(sectionBaseDirectory, triggerSection.ScriptFrom)
+		trigger, isValid := parseTrigger(triggerSection, sectionBaseDirectory, opts.Mode, inputs, sectionEC, idx)
+		if matchesCondition(triggerSection.When, condEnv, sectionEC, fmt.Sprintf("trigger %d", idx)) && isValid {
+			pkg.Triggers = append(pkg.Triggers, trigger)
+		}
+		ec.addErrorsFrom(sectionEC, triggerSection.source)
+	}
+
+	//parse and validate systemd units
+	seenUnits := make(map[string]bool)
+	for idx, serviceSection := range p.Service {
+		unit := serviceSection.Unit
+		switch {
+		case unit == "":
+			ec.Addf("service %d is invalid: missing \"unit\" attribute", idx)
+		case !unitNameRx.MatchString(unit):
+			ec.Addf("service %d is invalid: %q is not a valid systemd unit name", idx, unit)
+		case seenUnits[unit]:
+			ec.Addf("service %d is invalid: unit %q is already declared in another service", idx, unit)
+		default:
+			seenUnits[unit] = true
+			pkg.Services = append(pkg.Services, build.PackageService{
+				Unit:             unit,
+				Enable:           serviceSection.Enable,
+				RestartOnUpgrade: serviceSection.RestartOnUpgrade,
+			})
+		}
+	}
+
+	//parse and validate alternatives
+	alternativeLinks := make(map[string]string)
+	seenAlternatives := make(map[string]bool)
+	for idx, altSection := range p.Alternative {
+		isValid := validateAlternativePath(altSection.Link, "link", ec, idx)
+		isValid = validateAlternativePath(altSection.Path, "path", ec, idx) && isValid
+		if !isValid {
+			continue
+		}
+		name := altSection.Name
+		if name == "" {
+			name = filepath.Base(altSection.Link)
+		}
+		switch {
+		case !alternativeNameRx.MatchString(name):
+			ec.Addf("alternative %d is invalid: %q is not a valid name", idx, name)
+		case altSection.Link == altSection.Path:
+			ec.Addf("alternative %d is invalid: link and path are identical", idx)
+		case alternativeLinks[name] != "" && alternativeLinks[name] != altSection.Link:
+			ec.Addf("alternative %d is invalid: name %q is already used for link %q", idx, name, alternativeLinks[name])
+		case seenAlternatives[name+"\x00"+altSection.Path]:
+			ec.Addf("alternative %d is invalid: path %q is already declared for %q", idx, altSection.Path, name)
+		default:
+			alternativeLinks[name] = altSection.Link
+			seenAlternatives[name+"\x00"+altSection.Path] = true
+			pkg.Alternatives = append(pkg.Alternatives, build.PackageAlternative{
+				Name:     name,
+				Link:     altSection.Link,
+				Path:     altSection.Path,
+				Priority: altSection.Priority,
+			})
+		}
+	}
+
+	//parse and validate dependency mappings
+	seenDependencies := make(map[string]bool)
+	for idx, mappingSection := range p.DependencyMapping {
+		dep := mappingSection.Dependency
+		switch {
+		case dep == "":
+			ec.Addf("dependencyMapping %d is invalid: missing \"dependency\" attribute", idx)
+		case seenDependencies[dep]:
+			ec.Addf("dependencyMapping %d is invalid: dependency %q is already mapped in another dependencyMapping", idx, dep)
+		default:
+			seenDependencies[dep] = true
+			pkg.DependencyMappings = append(pkg.DependencyMappings, build.DependencyMapping{
+				Dependency: dep,
+				Packages: map[string]string{
+					"debian": mappingSection.Debian,
+					"pacman": mappingSection.Pacman,
+					"rpm":    mappingSection.RPM,
+				},
+			})
+		}
+	}
+
+	//parse and validate checks (they are evaluated by Run() after the build)
+	for idx, checkSection := range p.Check {
+		check, isValid := parseCheck(checkSection, ec, idx)
+		if matchesCondition(checkSection.When, condEnv, ec, fmt.Sprintf("check %d", idx)) && isValid {
+			pkg.Checks = append(pkg.Checks, check)
+		}
+	}
+
+	//parse and validate FS entries
+	defaults := parseDefaults(p.Defaults, ec)
+	explicitNodes := make(map[filesystem.Node]bool)
+	for idx, dirSection := range p.Directory {
+		path := dirSection.Path
+		sectionEC := &ErrorCollector{}
+		isPathValid := validatePath(path, sectionEC, "directory", idx)
+
+		entryDesc := describeFSEntry("directory", path, idx)
+		dirNode := filesystem.NewDirectory()
+		dirNode.Metadata = filesystem.NodeMetadata{
+			Mode:  parseFileMode(dirSection.Mode, defaults.DirectoryMode, sectionEC, entryDesc),
+			Owner: parseUserOrGroupRef(dirSection.Owner, sectionEC, entryDesc),
+			Group: parseUserOrGroupRef(dirSection.Group, sectionEC, entryDesc),
+			MTime: parseMTime(dirSection.MTime, sectionEC, entryDesc),
+		}
+		checkFileMode(dirNode.Metadata.Mode, true, false, p.Package.Strict, sectionEC, entryDesc)
+		if isPathValid && matchesCondition(dirSection.When, condEnv, sectionEC, entryDesc) && !isExcludedFormat(dirSection.ExcludeFormats, opts.Format, sectionEC, entryDesc) && matchesArchitectures(dirSection.Architectures, pkg.Architecture, sectionEC, entryDesc) {
+			sectionEC.Add(pkg.InsertFSNode(path, dirNode))
+			explicitNodes[dirNode] = true
+		}
+		ec.addErrorsFrom(sectionEC, dirSection.source)
+	}
+
+	//compressedPaths maps the original paths of files with `compress` to the
+	//extension that was appended to them (see processSymlinkTargets)
+	compressedPaths := make(map[string]string)
+	fileSections := append(append([]FileSection(nil), p.File...), manpageFileSections(p.Manpage, ec)...)
+	for idx, fileSection := range fileSections {
+		path := fileSection.Path
+		sectionEC := &ErrorCollector{}
+		isPathValid := validatePath(path, sectionEC, "file", idx)
+
+		//relative paths in `contentFrom` refer to the file containing the section
+		sectionBaseDirectory := fileSection.source.BaseDirectory
+		if sectionBaseDirectory == "" {
+			sectionBaseDirectory = opts.BaseDirectory
+		}
+
+		inputs.RecordFile(sectionBaseDirectory, fileSection.ContentFrom)
+		entryDesc := describeFSEntry("file", path, idx)
+		var (
+			content         []byte
+			contentProvider filesystem.ContentProvider
+		)
+		if fileSection.ContentFromCommand != "" {
+			content = runContentCommand(fileSection, sectionBaseDirectory, opts.Mode, opts.AllowExec, inputs, sectionEC, entryDesc)
+		} else {
+			content, contentProvider = parseFileContent(fileSection, sectionBaseDirectory, opts, inputs, sectionEC, entryDesc)
+		}
+		verifyContentDigest(fileSection, content, contentProvider, opts.Mode, sectionEC, entryDesc)
+		compressExtension := ""
+		if fileSection.Compress != "" {
+			var exists bool
+			compressExtension, exists = compressionExtensions[fileSection.Compress]
+			if !exists {
+				sectionEC.Addf("%s is invalid: unknown compression method \"%s\" (must be \"gzip\" or \"zstd\")", entryDesc, fileSection.Compress)
+			} else if opts.Mode == ParseFull && len(sectionEC.Errors) == 0 {
+				var err error
+				content, err = compressFileContent(content, contentProvider, fileSection.Compress)
+				contentProvider = nil
+				if err != nil {
+					sectionEC.Addf("%s is invalid: cannot compress content: %s", entryDesc, err.Error())
+				}
+			}
+		}
+		defaultMode := defaults.FileMode
+		if fileSection.Sensitive {
+			defaultMode = sensitiveFileMode
+		}
+		node := &filesystem.RegularFile{
+			Content:         content,
+			ContentProvider: contentProvider,
+			Metadata: filesystem.NodeMetadata{
+				Mode:  parseFileMode(fileSection.Mode, defaultMode, sectionEC, entryDesc),
+				Owner: parseUserOrGroupRef(fileSection.Owner, sectionEC, entryDesc),
+				Group: parseUserOrGroupRef(fileSection.Group, sectionEC, entryDesc),
+				MTime: parseMTime(fileSection.MTime, sectionEC, entryDesc),
+			},
+			Documentation:    fileSection.Doc,
+			License:          fileSection.License,
+			Config:           fileSection.Config,
+			Sensitive:        fileSection.Sensitive,
+			VerifyAttributes: parseVerifyAttributes(fileSection.Verify, sectionEC, entryDesc),
+		}
+		checkFileMode(node.Metadata.Mode, false, fileSection.AllowSetuid, p.Package.Strict, sectionEC, entryDesc)
+		if fileSection.Sensitive && node.Metadata.Mode&0007 != 0 {
+			sectionEC.Addf("%s is invalid: mode \"%s\" gives other users access to a sensitive file", entryDesc, fileSection.Mode)
+		}
+		if isPathValid && matchesCondition(fileSection.When, condEnv, sectionEC, entryDesc) && !isExcludedFormat(fileSection.ExcludeFormats, opts.Format, sectionEC, entryDesc) && matchesArchitectures(fileSection.Architectures, pkg.Architecture, sectionEC, entryDesc) {
+			sectionEC.Add(pkg.InsertFSNode(path+compressExtension, node))
+			explicitNodes[node] = true
+			if compressExtension != "" {
+				compressedPaths[path] = compressExtension
+			}
+		}
+		ec.addErrorsFrom(sectionEC, fileSection.source)
+	}
+
+	//owners/groups can only be inherited once all FS entries are known
+	resolveOwnership(&pkg, defaults, explicitNodes)
+
+	symlinks := make([]symlinkEntry, 0, len(p.Symlink))
+	for idx, symlinkSection := range p.Symlink {
+		path := symlinkSection.Path
+		sectionEC := &ErrorCollector{}
+		isPathValid := validatePath(path, sectionEC, "symlink", idx)
+
+		entryDesc := describeFSEntry("symlink", path, idx)
+		if symlinkSection.Target == "" {
+			sectionEC.Addf("%s is invalid: missing target", entryDesc)
+		} else if len(symlinkSection.Target) > maxPathLength {
+			sectionEC.Addf("%s is invalid: target is longer than %d bytes", entryDesc, maxPathLength)
+		} else if problem := checkCharacters(symlinkSection.Target); problem != "" {
+			sectionEC.Addf("%s is invalid: target %q %s", entryDesc, symlinkSection.Target, problem)
+		}
+
+		node := &filesystem.Symlink{
+			Target: normalizeSymlinkTarget(symlinkSection.Target),
+			Metadata: filesystem.NodeMetadata{
+				Mode:  0777,
+				Owner: parseUserOrGroupRef(symlinkSection.Owner, sectionEC, entryDesc),
+				Group: parseUserOrGroupRef(symlinkSection.Group, sectionEC, entryDesc),
+			},
+		}
+		if isPathValid && matchesCondition(symlinkSection.When, condEnv, sectionEC, entryDesc) && !isExcludedFormat(symlinkSection.ExcludeFormats, opts.Format, sectionEC, entryDesc) && matchesArchitectures(symlinkSection.Architectures, pkg.Architecture, sectionEC, entryDesc) {
+			sectionEC.Add(pkg.InsertFSNode(path, node))
+			symlinks = append(symlinks, symlinkEntry{path, node, symlinkSection})
+		}
+		ec.addErrorsFrom(sectionEC, symlinkSection.source)
+	}
+
+	//symlink targets can only be checked once all FS entries are known
+	processSymlinkTargets(&pkg, symlinks, compressedPaths, p.Package.Strict, p.Package.RelativeSymlinks, ec)
+
+	//alternative links are managed by the alternatives system, so they cannot
+	//be part of the package
+	if len(alternativeLinks) > 0 {
+		isLink := make(map[string]bool, len(alternativeLinks))
+		for _, link := range alternativeLinks {
+			isLink[link] = true
+		}
+		pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+			if isLink[path] {
+				ec.Addf("alternative link %q may not be part of the package", path)
+			}
+			return nil
+		})
+	}
+
+	return &pkg, ec.Warnings, ec.Errors
+}
+
+//relatedPackageRx and providesPackageRx are nearly identical, except that for a "provides" relation, only the operator "=" is acceptable
+var relatedPackageRx = regexp.MustCompile(`^([^\s<=>]+)\s*(?:(<=?|>=?|=)\s*([^\s<=>]+))?$`)
+var providesPackageRx = regexp.MustCompile(`^([^\s<=>]+)\s*(?:(=)\s*([^\s<=>]+))?$`)
+
+func parseRelatedPackages(relType string, specs []string, ec *ErrorCollector) []build.PackageRelation {
+	rels := make([]build.PackageRelation, 0, len(specs))
+	idxByName := make(map[string]int, len(specs))
+	isSeen := make(map[string]bool, len(specs))
+
+	for _, spec := range specs {
+		//ignore exact duplicates (other redundancies are reported by validateRelations)
+		if isSeen[spec] {
+			ec.Warnf("Duplicate entry \"%s\" in %s", spec, relType)
+			continue
+		}
+		isSeen[spec] = true
+
+		//which format to use?
+		rx := relatedPackageRx
+		if relType == "provides" {
+			rx = providesPackageRx
+		}
+
+		//check format of spec
+		match := rx.FindStringSubmatch(spec)
+		if match == nil {
+			ec.Addf("Invalid package reference in %s: \"%s\"", relType, spec)
+			continue
+		}
+
+		//do we have a relation to this package already?
+		name := match[1]
+		idx, exists := idxByName[name]
+		if !exists {
+			//no, add a new one and remember it for later additional constraints
+			idx = len(rels)
+			idxByName[name] = idx
+			rels = append(rels, build.PackageRelation{RelatedPackage: name})
+		}
+
+		//add version constraint if one was specified
+		if match[2] != "" {
+			constraint := build.VersionConstraint{Relation: match[2], Version: match[3]}
+			rels[idx].Constraints = append(rels[idx].Constraints, constraint)
+		}
+	}
+
+	return rels
+}
+
+//maps string values of "action.on" to internal enum values
+var actionTypeMap = map[string]uint{
+	"setup":            build.SetupAction,
+	"cleanup":          build.CleanupAction,
+	"pre-setup":        build.PreSetupAction,
+	"pre-cleanup":      build.PreCleanupAction,
+	"pre-transaction":  build.PreTransactionAction,
+	"post-transaction": build.PostTransactionAction,
+	"verify":           build.VerifyAction,
+}
+
+func parseAction(data ActionSection, baseDirectory string, parseMode ParseMode, inputs *inputRecorder, ec *ErrorCollector, entryIdx int) (action build.PackageAction, isValid bool) {
+	action.Type, isValid = actionTypeMap[data.On]
+	if !isValid {
+		if data.On == "" {
+			ec.Addf("action %d is invalid: missing or empty \"on\" attribute", entryIdx)
+		} else {
+			ec.Addf("action %d is invalid: unacceptable value \"%s\" for \"on\" attribute", entryIdx, data.On)
+		}
+	}
+
+	entryDesc := fmt.Sprintf("action %d", entryIdx)
+	action.Interpreter = data.Interpreter
+	action.Content, isValid = parseScript(data.Script, data.ScriptFrom, data.Interpreter, baseDirectory, parseMode, inputs, ec, entryDesc, isValid)
+	return
+}
+
+func parseTrigger(data TriggerSection, baseDirectory string, parseMode ParseMode, inputs *inputRecorder, ec *ErrorCollector, entryIdx int) (trigger build.PackageTrigger, isValid bool) {
+	isValid = true
+	if len(data.Paths) == 0 && len(data.Packages) == 0 {
+		ec.Addf("trigger %d is invalid: missing \"paths\" or \"packages\" attribute", entryIdx)
+		isValid = false
+	}
+	//trigger names may not contain whitespace since dpkg's triggers file and
+	//the trigger arguments of the postinst are whitespace-separated
+	for _, path := range data.Paths {
+		problem := ""
+		switch {
+		case !strings.HasPrefix(path, "/"):
+			problem = "must be an absolute path"
+		case strings.IndexFunc(path, unicode.IsSpace) >= 0:
+			problem = "may not contain whitespace"
+		default:
+			problem = checkCharacters(path)
+		}
+		if problem != "" {
+			ec.Addf("trigger %d is invalid: path %q %s", entryIdx, path, problem)
+			isValid = false
+		}
+	}
+	for _, pkgName := range data.Packages {
+		if pkgName == "" || strings.IndexFunc(pkgName, unicode.IsSpace) >= 0 || checkCharacters(pkgName) != "" {
+			ec.Addf("trigger %d is invalid: %q is not a valid package name", entryIdx, pkgName)
+			isValid = false
+		}
+	}
+
+	entryDesc := fmt.Sprintf("trigger %d", entryIdx)
+	trigger = build.PackageTrigger{
+		Paths:       data.Paths,
+		Packages:    data.Packages,
+		Interpreter: data.Interpreter,
+	}
+	trigger.Content, isValid = parseScript(data.Script, data.ScriptFrom, data.Interpreter, baseDirectory, parseMode, inputs, ec, entryDesc, isValid)
+	return
+}
+
+//parseScript validates the script and interpreter of an action or trigger,
+//and returns the script (which is read from `scriptFrom` if necessary).
+//isValid is passed through unless a problem is found.
+func parseScript(script, scriptFrom, interpreter, baseDirectory string, parseMode ParseMode, inputs *inputRecorder, ec *ErrorCollector, entryDesc string, isValid bool) (string, bool) {
+	if interpreter != "" {
+		if !strings.HasPrefix(interpreter, "/") {
+			ec.Addf("%s is invalid: interpreter \"%s\" must be an absolute path", entryDesc, interpreter)
+			isValid = false
+		} else if strings.IndexFunc(interpreter, unicode.IsSpace) >= 0 || checkCharacters(interpreter) != "" {
+			ec.Addf("%s is invalid: interpreter %q may not contain whitespace or control characters", entryDesc, interpreter)
+			isValid = false
+		}
+	}
+
+	if scriptFrom != "" {
+		if script != "" {
+			ec.Addf("%s is invalid: cannot use both `script` and `scriptFrom`", entryDesc)
+			return "", false
+		}
+		//like `contentFrom`, relative paths refer to the file containing the section
+		path := resolvePath(baseDirectory, scriptFrom)
+		//the script is not needed for choosing the file name
+		if parseMode == ParseMetadataOnly {
+			return "", isValid
+		}
+		buf, err := readReferencedFile(path, inputs)
+		if err != nil {
+			ec.Addf("%s is invalid: %s", entryDesc, err.Error())
+			return "", false
+		}
+		if !utf8.Valid(buf) {
+			ec.Addf("%s is invalid: %s is not valid UTF-8", entryDesc, scriptFrom)
+			return "", false
+		}
+		script = stripShebang(string(buf))
+	} else if interpreter != "" {
+		//unlike shell scripts, scripts for other interpreters (e.g. Python) may
+		//be sensitive to the indentation of the TOML string
+		script = string(pruneIndentation([]byte(script)))
+	}
+
+	script = strings.TrimSpace(script)
+	if script == "" {
+		if scriptFrom != "" {
+			ec.Addf("%s is invalid: %s is empty", entryDesc, scriptFrom)
+		} else {
+			ec.Addf("%s is invalid: missing or empty \"script\" attribute", entryDesc)
+		}
+		isValid = false
+	}
+	return script, isValid
+}
+
+//stripShebang removes the "#!" line from the start of a script file. Action
+//scripts are concatenated into the package's maintainer scripts, where the
+//shebang line would be meaningless.
+func stripShebang(script string) string {
+	if !strings.HasPrefix(script, "#!") {
+		return script
+	}
+	idx := strings.IndexByte(script, '\n')
+	if idx < 0 {
+		return ""
+	}
+	return script[idx+1:]
+}
+
+//matchesArchitectures evaluates the `architectures` filter of a file,
+//directory or symlink entry. Entries without a filter are always included.
+//Note that architecture-independent packages only include entries whose
+//filter lists "any" (or one of its synonyms).
+func matchesArchitectures(archNames []string, pkgArch build.Architecture, ec *ErrorCollector, entryDesc string) bool {
+	if len(archNames) == 0 {
+		return true
+	}
+	result := false
+	for _, archName := range archNames {
+		arch, ok := archMap[archName]
+		if !ok {
+			ec.Addf("%s is invalid: unknown architecture \"%s\"", entryDesc, archName)
+			continue
+		}
+		if arch == pkgArch {
+			result = true
+		}
+	}
+	return result
+}
+
+//isExcludedFormat evaluates the `excludeFormats` filter of an entry. The
+//format names are checked even if no format is given (i.e. if the package
+//definition is parsed without building a package), in which case no entries
+//are excluded.
+func isExcludedFormat(formats []string, format string, ec *ErrorCollector, entryDesc string) bool {
+	result := false
+	for _, f := range formats {
+		if GeneratorFactoryFor(f) == nil {
+			ec.Addf("%s is invalid: unknown package format \"%s\" in \"excludeFormats\"", entryDesc, f)
+			continue
+		}
+		if f == format {
+			result = true
+		}
+	}
+	return result
+}
+
+//describeFSEntry returns the description of a [[directory]], [[file]] or
+//[[symlink]] section that is used in error messages. Overly long paths (which
+//validatePath rejects) are not repeated in every error message.
+func describeFSEntry(entryType, path string, entryIdx int) string {
+	if len(path) > maxPathLength {
+		return fmt.Sprintf("%s %d", entryType, entryIdx)
+	}
+	return fmt.Sprintf("%s \"%s\"", entryType, path)
+}
+
+//path is the path to be validated.
+//entryType and entryIdx are used for error messages and describe the entry.
+func validatePath(path string, ec *ErrorCollector, entryType string, entryIdx int) bool {
+	if path == "" {
+		ec.Addf("%s %d is invalid: missing \"path\" attribute", entryType, entryIdx)
+		return false
+	}
+	if len(path) > maxPathLength {
+		ec.Addf("%s %d is invalid: path is longer than %d bytes", entryType, entryIdx, maxPathLength)
+		return false
+	}
+	if !strings.HasPrefix(path, "/") {
+		ec.Addf("%s \"%s\" is invalid: must be an absolute path", entryType, path)
+		return false
+	}
+	if strings.HasSuffix(path, "/") {
+		ec.Addf("%s \"%s\" is invalid: trailing slash(es)", entryType, path)
+		return false
+	}
+	if problem := checkCharacters(path); problem != "" {
+		ec.Addf("%s %q is invalid: path %s", entryType, path, problem)
+		return false
+	}
+	return true
+}
+
+//validateAlternativePath validates the "link" or "path" attribute of an
+//[[alternative]] section. Since these paths are inserted into shell scripts
+//in single quotes, they may not contain single quotes.
+func validateAlternativePath(path, attribute string, ec *ErrorCollector, entryIdx int) bool {
+	switch {
+	case path == "":
+		ec.Addf("alternative %d is invalid: missing %q attribute", entryIdx, attribute)
+	case !strings.HasPrefix(path, "/"):
+		ec.Addf("alternative %d is invalid: %s %q must be an absolute path", entryIdx, attribute, path)
+	case strings.HasSuffix(path, "/"):
+		ec.Addf("alternative %d is invalid: %s %q has trailing slash(es)", entryIdx, attribute, path)
+	case strings.ContainsAny(path, "' \t"):
+		ec.Addf("alternative %d is invalid: %s %q may not contain whitespace or single quotes", entryIdx, attribute, path)
+	case checkCharacters(path) != "":
+		ec.Addf("alternative %d is invalid: %s %q %s", entryIdx, attribute, path, checkCharacters(path))
+	default:
+		return true
+	}
+	return false
+}
+
+//checkCharacters returns a description of the problem if the given string is
+//not valid UTF-8 or contains control characters (which would corrupt
+//line-based metadata files like md5sums, .PKGINFO or .MTREE), or "" otherwise.
+func checkCharacters(str string) string {
+	if !utf8.ValidString(str) {
+		return "must be valid UTF-8"
+	}
+	for _, r := range str {
+		if unicode.IsControl(r) {
+			return fmt.Sprintf("may not contain control characters like %q", r)
+		}
+	}
+	return ""
+}
+
+func parseFileMode(modeStr string, defaultMode os.FileMode, ec *ErrorCollector, entryDesc string) os.FileMode {
+	//default value
+	if modeStr == "" {
+		return defaultMode
+	}
+
+	//do not echo absurdly long mode strings into the error message
+	if len(modeStr) > maxModeLength {
+		ec.Addf("%s is invalid: mode is longer than %d characters", entryDesc, maxModeLength)
+		return defaultMode
+	}
+
+	//parse modeStr as uint in base 8 to uint32 (== os.FileMode)
+	value, err := strconv.ParseUint(modeStr, 8, 32)
+	if err != nil {
+		ec.Addf("%s is invalid: cannot parse mode \"%s\" (%s)", entryDesc, modeStr, err.Error())
+		return defaultMode
+	} else if value > 07777 {
+		ec.Addf("%s is invalid: mode \"%s\" is out of range (must be between 0000 and 7777)", entryDesc, modeStr)
+		return defaultMode
+	}
+	return os.FileMode(value)
+}
+
+//checkFileMode reports modes that almost always indicate a typo in the
+//package definition. These are reported as warnings, or as errors in strict
+//mode.
+func checkFileMode(mode os.FileMode, isDirectory, allowSetuid, strict bool, ec *ErrorCollector, entryDesc string) {
+	var problems []string
+	if mode&0002 != 0 && !(isDirectory && mode&01000 != 0) {
+		//world-writable directories are only acceptable with the sticky bit (like /tmp)
+		problems = append(problems, "makes it world-writable")
+	}
+	if !isDirectory && mode&06000 != 0 && !allowSetuid {
+		problems = append(problems, "sets the setuid/setgid bit without `allowSetuid = true`")
+	}
+	if isDirectory && (mode&0400 != 0 && mode&0100 == 0 || mode&0040 != 0 && mode&0010 == 0 || mode&0004 != 0 && mode&0001 == 0) {
+		problems = append(problems, "allows reading the directory without allowing to enter it")
+	}
+
+	for _, problem := range problems {
+		if strict {
+			ec.Addf("%s is invalid: mode %04o %s (not allowed with strict = true)", entryDesc, mode, problem)
+		} else {
+			ec.Warnf("%s has mode %04o which %s", entryDesc, mode, problem)
+		}
+	}
+}
+
+//verifyAttributes maps the acceptable values for `verify` in [[file]]
+//sections to the names used in filesystem.RegularFile.VerifyAttributes. The
+//aliases are the names used by %verify in RPM spec files.
+var verifyAttributes = map[string]string{
+	"digest":     "digest",
+	"filedigest": "digest",
+	"md5":        "digest",
+	"size":       "size",
+	"link":       "link",
+	"owner":      "owner",
+	"user":       "owner",
+	"group":      "group",
+	"mtime":      "mtime",
+	"mode":       "mode",
+	"rdev":       "rdev",
+	"caps":       "caps",
+}
+
+func parseVerifyAttributes(names []string, ec *ErrorCollector, entryDesc string) []string {
+	if names == nil {
+		return nil
+	}
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		attr, exists := verifyAttributes[name]
+		if !exists {
+			ec.Addf("%s is invalid: unknown attribute \"%s\" in `verify`", entryDesc, name)
+			continue
+		}
+		result = append(result, attr)
+	}
+	return result
+}
+
+func parseMTime(mtimeStr string, ec *ErrorCollector, entryDesc string) time.Time {
+	//default value (the zero time is rendered as the UNIX epoch)
+	if mtimeStr == "" {
+		return time.Time{}
+	}
+
+	value, err := time.Parse(time.RFC3339, mtimeStr)
+	if err != nil {
+		ec.Addf("%s is invalid: cannot parse mtime \"%s\" (must be a timestamp like \"2023-01-01T00:00:00Z\")", entryDesc, mtimeStr)
+		return time.Time{}
+	}
+	if value.Unix() < 0 || value.Unix() > 0x7FFFFFFF {
+		ec.Addf("%s is invalid: mtime \"%s\" is out of range (must be between 1970 and 2038)", entryDesc, mtimeStr)
+		return time.Time{}
+	}
+	return value
+}
+
+//runContentCommand runs the `contentFromCommand` of the given file section
+//with sh(1) in the given directory, and returns its standard output. The
+//command and a digest of its output are recorded in `inputs` (if not nil).
+func runContentCommand(fileSection FileSection, baseDirectory string, parseMode ParseMode, allowExec bool, inputs *inputRecorder, ec *ErrorCollector, entryDesc string) []byte {
+	command := fileSection.ContentFromCommand
+	if fileSection.Content != "" || fileSection.ContentFrom != "" {
+		ec.Addf("%s is invalid: cannot use `contentFromCommand` together with `content` or `contentFrom`", entryDesc)
+		return nil
+	}
+	if !allowExec {
+		ec.Addf("%s is invalid: `contentFromCommand` is only allowed with --allow-exec", entryDesc)
+		return nil
+	}
+	if isURL(baseDirectory) {
+		ec.Addf("%s is invalid: `contentFromCommand` cannot be used in package definitions from a URL", entryDesc)
+		return nil
+	}
+	if parseMode == ParseMetadataOnly {
+		return nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = baseDirectory
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := err.Error()
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			msg += ": " + output
+		}
+		ec.Addf("%s is invalid: command %q failed: %s", entryDesc, command, msg)
+		return nil
+	}
+	inputs.RecordCommand(command, baseDirectory, stdout.Bytes())
+	return stdout.Bytes()
+}
+
+//parseFileContent returns either the verbatim content of a file, or (for
+//`contentFrom`) a provider that reads the referenced file at build time.
+//Files from URLs are downloaded immediately instead.
+func parseFileContent(fileSection FileSection, baseDirectory string, opts ParseOptions, inputs *inputRecorder, ec *ErrorCollector, entryDesc string) ([]byte, filesystem.ContentProvider) {
+	content := fileSection.Content
+	contentFrom := fileSection.ContentFrom
+
+	//option 1: content given verbatim in "content" field
+	if content != "" {
+		if contentFrom != "" {
+			ec.Addf("%s is invalid: cannot use both `content` and `contentFrom`", entryDesc)
+		}
+		if fileSection.Raw {
+			return []byte(content), nil
+		}
+		return pruneIndentation([]byte(content)), nil
+	}
+
+	//option 2: content referenced in "contentFrom" field
+	if contentFrom == "" {
+		ec.Addf("%s is invalid: missing content", entryDesc)
+		return nil, nil
+	}
+	if isURL(contentFrom) {
+		if !isURL(baseDirectory) && !opts.AllowNetwork {
+			ec.Addf("%s is invalid: `contentFrom` may only refer to a URL with --allow-network", entryDesc)
+			return nil, nil
+		}
+	} else {
+		contentFrom = resolvePath(baseDirectory, contentFrom)
+	}
+	if opts.Mode == ParseMetadataOnly {
+		return nil, nil
+	}
+	if isURL(contentFrom) {
+		data, err := fetchContentFrom(contentFrom, fileSection.ContentFromSha256, opts.DownloadCacheDirectory, inputs)
+		if err != nil {
+			ec.Addf("%s is invalid: %s", entryDesc, err.Error())
+		}
+		return data, nil
+	}
+	provider, err := filesystem.NewFileContentProvider(contentFrom)
+	ec.Add(err)
+	return nil, provider
+}
+
+//sha256Rx matches the checksums accepted by `contentFromSha256`.
+var sha256Rx = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+//verifyContentDigest implements `contentFromSha256` by checking the contents
+//read by parseFileContent() against the expected SHA-256 checksum. This
+//happens before the contents are compressed.
+func verifyContentDigest(fileSection FileSection, content []byte, provider filesystem.ContentProvider, parseMode ParseMode, ec *ErrorCollector, entryDesc string) {
+	expected := fileSection.ContentFromSha256
+	switch {
+	case expected == "":
+		return
+	case fileSection.ContentFrom == "" || fileSection.Content != "" || fileSection.ContentFromCommand != "":
+		ec.Addf("%s is invalid: `contentFromSha256` can only be used with `contentFrom`", entryDesc)
+		return
+	case !sha256Rx.MatchString(expected):
+		ec.Addf("%s is invalid: `contentFromSha256` must be 64 hexadecimal digits", entryDesc)
+		return
+	case parseMode == ParseMetadataOnly || len(ec.Errors) > 0:
+		//contents were not read, or reading them failed
+		return
+	}
+
+	hash := sha256.New()
+	if provider == nil {
+		hash.Write(content)
+	} else {
+		r, _, err := provider()
+		if err == nil {
+			_, err = io.Copy(hash, r)
+			r.Close()
+		}
+		if err != nil {
+			ec.Addf("%s is invalid: %s", entryDesc, err.Error())
+			return
+		}
+	}
+	err := compareSHA256(fileSection.ContentFrom, hash.Sum(nil), expected)
+	if err != nil {
+		ec.Addf("%s is invalid: %s", entryDesc, err.Error())
+	}
+}
+
+func pruneIndentation(text []byte) []byte {
+	//split into lines for analysis
+	lines := bytes.Split(text, []byte{'\n'})
+
+	//use the indentation of the first non-empty line as a starting point for the longest common prefix
+	var prefix []byte
+	for _, line := range lines {
+		if len(line) != 0 {
+			lineWithoutIndentation := bytes.TrimLeft(line, "\t ")
+			prefix = line[:len(line)-len(lineWithoutIndentation)]
+			break
+		}
+	}
+
+	//find the longest common prefix (from the starting point, remove trailing
+	//characters until it *is* the longest common prefix)
+	for len(prefix) > 0 {
+		found := true
+		for _, line := range lines {
+			if len(line) == 0 {
+				continue
+			}
+			if !bytes.HasPrefix(line, prefix) {
+				//not the longest common prefix yet -> chop off one byte and retry
+				prefix = prefix[:len(prefix)-1]
+				found = false
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	//remove the longest common prefix from all non-empty lines
+	if len(prefix) == 0 {
+		return text //fast exit
+	}
+	for idx, line := range lines {
+		if len(line) > 0 {
+			lines[idx] = line[len(prefix):]
+		}
+	}
+	return bytes.Join(lines, []byte{'\n'})
+}
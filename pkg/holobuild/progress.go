@@ -0,0 +1,93 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//NewVerboseReporter returns a build.ProgressReporter that writes a
+//human-readable line into `w` whenever a phase of the build starts or ends.
+//This is used for `holo-build --verbose`.
+func NewVerboseReporter(w io.Writer) build.ProgressReporter {
+	return &verboseReporter{w, make(map[string]time.Time)}
+}
+
+type verboseReporter struct {
+	w         io.Writer
+	startedAt map[string]time.Time
+}
+
+//BeginPhase implements the build.ProgressReporter interface.
+func (r *verboseReporter) BeginPhase(phase string) {
+	r.startedAt[phase] = time.Now()
+	fmt.Fprintf(r.w, ":: %s...\n", phase)
+}
+
+//EndPhase implements the build.ProgressReporter interface.
+func (r *verboseReporter) EndPhase(phase string, fileCount int) {
+	duration := time.Since(r.startedAt[phase])
+	fmt.Fprintf(r.w, ":: %s finished after %s (%d files)\n", phase, duration.Round(time.Millisecond), fileCount)
+}
+
+//NewJSONProgressReporter returns a build.ProgressReporter that writes a JSON
+//object into `w` whenever a phase of the build starts or ends, one object
+//per line. This is used for `holo-build --progress=json`. For example:
+//
+//	{"event":"begin","phase":"compress"}
+//	{"event":"end","phase":"compress","files":1234,"seconds":0.25}
+func NewJSONProgressReporter(w io.Writer) build.ProgressReporter {
+	return &jsonProgressReporter{json.NewEncoder(w), make(map[string]time.Time)}
+}
+
+type jsonProgressReporter struct {
+	enc       *json.Encoder
+	startedAt map[string]time.Time
+}
+
+type jsonProgressEvent struct {
+	Event     string   `json:"event"`
+	Phase     string   `json:"phase"`
+	FileCount *int     `json:"files,omitempty"`
+	Seconds   *float64 `json:"seconds,omitempty"`
+}
+
+//BeginPhase implements the build.ProgressReporter interface.
+func (r *jsonProgressReporter) BeginPhase(phase string) {
+	r.startedAt[phase] = time.Now()
+	r.enc.Encode(jsonProgressEvent{Event: "begin", Phase: phase})
+}
+
+//EndPhase implements the build.ProgressReporter interface.
+func (r *jsonProgressReporter) EndPhase(phase string, fileCount int) {
+	seconds := time.Since(r.startedAt[phase]).Seconds()
+	r.enc.Encode(jsonProgressEvent{
+		Event:     "end",
+		Phase:     phase,
+		FileCount: &fileCount,
+		Seconds:   &seconds,
+	})
+}
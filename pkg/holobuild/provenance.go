@@ -0,0 +1,189 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+//inputRecorder records the digests of all files that a package definition
+//is read from (including included definitions and files referenced by
+//`contentFrom` and `scriptFrom`, and the output of commands from
+//`contentFromCommand`), for the provenance attestation (see
+//Options.Provenance) and for the key of the build cache (see
+//Options.CacheDirectory). All methods can be called on a nil recorder, in which
+//case nothing is recorded.
+type inputRecorder struct {
+	Materials []provenanceMaterial
+	seen      map[string]bool
+}
+
+func newInputRecorder() *inputRecorder {
+	return &inputRecorder{seen: make(map[string]bool)}
+}
+
+//RecordBlob records an input whose contents have already been read.
+func (r *inputRecorder) RecordBlob(name string, blob []byte) {
+	if r == nil || r.seen[name] {
+		return
+	}
+	r.seen[name] = true
+	sum := sha256.Sum256(blob)
+	r.Materials = append(r.Materials, provenanceMaterial{
+		URI:    name,
+		Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])},
+	})
+}
+
+//RecordFile records a file referenced by the package definition. Relative
+//paths are resolved like for `contentFrom`. Errors are ignored since missing
+//files are reported by the parser.
+func (r *inputRecorder) RecordFile(baseDirectory, path string) {
+	if r == nil || path == "" {
+		return
+	}
+	path = resolvePath(baseDirectory, path)
+	//downloaded files are recorded by readReferencedFile()
+	if isURL(path) || r.seen[path] {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return
+	}
+	r.seen[path] = true
+	r.Materials = append(r.Materials, provenanceMaterial{
+		URI:    path,
+		Digest: map[string]string{"sha256": hex.EncodeToString(hash.Sum(nil))},
+	})
+}
+
+//RecordCommand records the output of a command from `contentFromCommand`.
+//The command line and its working directory are recorded as the URI, so that
+//the attestation shows which commands were run.
+func (r *inputRecorder) RecordCommand(command, workingDirectory string, output []byte) {
+	r.RecordBlob(fmt.Sprintf("exec:%s (in %s)", command, workingDirectory), output)
+}
+
+//The provenance attestation is an in-toto statement
+//<https://github.com/in-toto/attestation/blob/main/spec/v0.1.0/statement.md>
+//with a SLSA provenance predicate <https://slsa.dev/provenance/v0.2>.
+const (
+	inTotoStatementType     = "https://in-toto.io/Statement/v0.1"
+	slsaProvenancePredicate = "https://slsa.dev/provenance/v0.2"
+	holoBuildBuildType      = "https://github.com/holocm/holo-build/buildtypes/package-definition/v1"
+)
+
+type provenanceStatement struct {
+	Type          string              `json:"_type"`
+	Subject       []provenanceSubject `json:"subject"`
+	PredicateType string              `json:"predicateType"`
+	Predicate     provenancePredicate `json:"predicate"`
+}
+
+type provenanceSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type provenancePredicate struct {
+	Builder    provenanceBuilder    `json:"builder"`
+	BuildType  string               `json:"buildType"`
+	Invocation provenanceInvocation `json:"invocation"`
+	Metadata   provenanceMetadata   `json:"metadata"`
+	Materials  []provenanceMaterial `json:"materials"`
+}
+
+type provenanceBuilder struct {
+	ID string `json:"id"`
+}
+
+type provenanceInvocation struct {
+	Parameters map[string]string `json:"parameters"`
+}
+
+type provenanceMetadata struct {
+	Reproducible bool `json:"reproducible"`
+}
+
+type provenanceMaterial struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+//writeProvenance writes the provenance attestation for the package at
+//pkgPath into a sidecar file like "foo_1.0-1_any.deb.intoto.json". The
+//attestation does not contain timestamps, so it is as reproducible as the
+//package itself.
+func writeProvenance(opts Options, inputs *inputRecorder, pkgPath string, pkgBytes []byte) error {
+	builderID := "https://github.com/holocm/holo-build"
+	if opts.BuilderVersion != "" {
+		builderID += "@" + opts.BuilderVersion
+	}
+	parameters := map[string]string{"format": opts.Format}
+	if opts.Architecture != "" {
+		parameters["architecture"] = opts.Architecture
+	}
+	if opts.PathPrefix != "" {
+		parameters["prefix"] = opts.PathPrefix
+	}
+	for name, value := range opts.Defines {
+		parameters["define."+name] = value
+	}
+	materials := inputs.Materials
+	if materials == nil {
+		materials = []provenanceMaterial{}
+	}
+
+	sum := sha256.Sum256(pkgBytes)
+	statement := provenanceStatement{
+		Type: inTotoStatementType,
+		Subject: []provenanceSubject{{
+			Name:   filepath.Base(pkgPath),
+			Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])},
+		}},
+		PredicateType: slsaProvenancePredicate,
+		Predicate: provenancePredicate{
+			Builder:    provenanceBuilder{ID: builderID},
+			BuildType:  holoBuildBuildType,
+			Invocation: provenanceInvocation{Parameters: parameters},
+			Metadata:   provenanceMetadata{Reproducible: true},
+			Materials:  materials,
+		},
+	}
+	buf, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileWithMode(pkgPath+".intoto.json", append(buf, '\n'), opts.outputMode())
+}
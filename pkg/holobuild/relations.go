@@ -0,0 +1,225 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//versionBound is one end of a versionInterval. If Version is empty, the
+//interval is unbounded on this end.
+type versionBound struct {
+	Version   string
+	Inclusive bool
+}
+
+//versionInterval is the set of versions that is accepted by a set of version
+//constraints.
+type versionInterval struct {
+	Lower versionBound
+	Upper versionBound
+	//compare is build.CompareVersions() for a fixed package format
+	compare func(a, b string) int
+}
+
+func newVersionInterval(format string, constraints []build.VersionConstraint) (versionInterval, error) {
+	//validate format once, so that errors can be ignored below
+	_, err := build.CompareVersions(format, "", "")
+	if err != nil {
+		return versionInterval{}, err
+	}
+
+	vi := versionInterval{compare: func(a, b string) int {
+		cmp, _ := build.CompareVersions(format, a, b)
+		return cmp
+	}}
+	for _, c := range constraints {
+		vi.restrict(c)
+	}
+	return vi, nil
+}
+
+//restrict reduces the interval to those versions that satisfy the given
+//constraint.
+func (vi *versionInterval) restrict(c build.VersionConstraint) {
+	bound := versionBound{Version: c.Version, Inclusive: strings.Contains(c.Relation, "=")}
+	if strings.HasPrefix(c.Relation, ">") || c.Relation == "=" {
+		if vi.compareLower(bound, vi.Lower) > 0 {
+			vi.Lower = bound
+		}
+	}
+	if strings.HasPrefix(c.Relation, "<") || c.Relation == "=" {
+		if vi.compareUpper(bound, vi.Upper) < 0 {
+			vi.Upper = bound
+		}
+	}
+}
+
+//compareLower returns a positive value if a is a stricter lower bound than b.
+func (vi versionInterval) compareLower(a, b versionBound) int {
+	switch {
+	case a.Version == "" && b.Version == "":
+		return 0
+	case a.Version == "":
+		return -1
+	case b.Version == "":
+		return 1
+	}
+	if cmp := vi.compare(a.Version, b.Version); cmp != 0 {
+		return cmp
+	}
+	//for the same version, ">" is stricter than ">="
+	return compareInclusivity(b, a)
+}
+
+//compareUpper returns a negative value if a is a stricter upper bound than b.
+func (vi versionInterval) compareUpper(a, b versionBound) int {
+	switch {
+	case a.Version == "" && b.Version == "":
+		return 0
+	case a.Version == "":
+		return 1
+	case b.Version == "":
+		return -1
+	}
+	if cmp := vi.compare(a.Version, b.Version); cmp != 0 {
+		return cmp
+	}
+	//for the same version, "<" is stricter than "<="
+	return compareInclusivity(a, b)
+}
+
+func compareInclusivity(a, b versionBound) int {
+	switch {
+	case a.Inclusive == b.Inclusive:
+		return 0
+	case a.Inclusive:
+		return 1
+	default:
+		return -1
+	}
+}
+
+//IsEmpty returns whether no version satisfies all constraints.
+func (vi versionInterval) IsEmpty() bool {
+	if vi.Lower.Version == "" || vi.Upper.Version == "" {
+		return false
+	}
+	cmp := vi.compare(vi.Lower.Version, vi.Upper.Version)
+	return cmp > 0 || (cmp == 0 && !(vi.Lower.Inclusive && vi.Upper.Inclusive))
+}
+
+//Equals returns whether both intervals contain the same versions.
+func (vi versionInterval) Equals(other versionInterval) bool {
+	return vi.compareLower(vi.Lower, other.Lower) == 0 && vi.compareUpper(vi.Upper, other.Upper) == 0
+}
+
+//IsSubsetOf returns whether every version in this interval is also contained
+//in the other interval.
+func (vi versionInterval) IsSubsetOf(other versionInterval) bool {
+	return vi.compareLower(vi.Lower, other.Lower) >= 0 && vi.compareUpper(vi.Upper, other.Upper) <= 0
+}
+
+func formatConstraints(rel build.PackageRelation) string {
+	strs := make([]string, len(rel.Constraints))
+	for idx, c := range rel.Constraints {
+		strs[idx] = fmt.Sprintf("\"%s %s %s\"", rel.RelatedPackage, c.Relation, c.Version)
+	}
+	return strings.Join(strs, ", ")
+}
+
+//validateRelations checks the version constraints of the package's
+//requirements for contradictions (returned as errors) and redundancies
+//(returned as warnings), using the version ordering of the given package format. It also
+//rejects packages that conflict with every acceptable version of one of their
+//requirements.
+//
+//Only requirements are checked for contradictions since all their constraints
+//must be satisfied at the same time. Each constraint on a conflict or
+//replacement stands on its own, e.g. `conflicts = ["foo < 1.0", "foo > 2.0"]`
+//conflicts with both old and new versions of foo.
+func validateRelations(pkg *build.Package, format string) ([]string, []error) {
+	//some formats ignore relations or do not have a well-defined version
+	//ordering, so there is nothing to check
+	_, err := build.CompareVersions(format, "", "")
+	if err != nil {
+		return nil, nil
+	}
+	ec := &ErrorCollector{}
+
+	required := make(map[string]versionInterval)
+	for _, rel := range pkg.Requires {
+		vi, err := newVersionInterval(format, rel.Constraints)
+		if err != nil {
+			ec.Add(err)
+			return ec.Warnings, ec.Errors
+		}
+		if vi.IsEmpty() {
+			ec.Addf("Contradictory version constraints in requires: %s cannot be satisfied at the same time", formatConstraints(rel))
+			continue
+		}
+		required[rel.RelatedPackage] = vi
+
+		//check if any constraint is implied by the others
+		constraints := rel.Constraints
+		for idx := 0; idx < len(constraints); {
+			others := make([]build.VersionConstraint, 0, len(constraints)-1)
+			others = append(others, constraints[:idx]...)
+			others = append(others, constraints[idx+1:]...)
+			othersVI, _ := newVersionInterval(format, others)
+			if !othersVI.Equals(vi) {
+				idx++
+				continue
+			}
+			c := constraints[idx]
+			ec.Warnf("Version constraint \"%s %s %s\" in requires is redundant", rel.RelatedPackage, c.Relation, c.Version)
+			//do not report the other half of a redundant pair
+			constraints = others
+		}
+	}
+
+	//superseded packages end up in conflicts as well (see FoldSupersedes)
+	checkExcluded := func(relType string, rels []build.PackageRelation) {
+		for _, rel := range rels {
+			requiredVI, exists := required[rel.RelatedPackage]
+			if !exists {
+				continue
+			}
+			isConflicting := len(rel.Constraints) == 0
+			for _, c := range rel.Constraints {
+				conflictVI, _ := newVersionInterval(format, []build.VersionConstraint{c})
+				if requiredVI.IsSubsetOf(conflictVI) {
+					isConflicting = true
+				}
+			}
+			if isConflicting {
+				ec.Addf("Package \"%s\" is required, but every acceptable version of it is also in %s", rel.RelatedPackage, relType)
+			}
+		}
+	}
+	checkExcluded("conflicts", pkg.Conflicts)
+	checkExcluded("supersedes", pkg.Supersedes)
+
+	return ec.Warnings, ec.Errors
+}
@@ -0,0 +1,191 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/debian"
+)
+
+//updateRepository updates the index of the local repository in repoDir after
+//the package file at pkgPath has been placed in there. The generator must be
+//the one that built the package.
+func updateRepository(format, repoDir, pkgPath string, pkgBytes []byte, generator build.Generator) error {
+	switch format {
+	case "debian":
+		g, ok := generator.(*debian.Generator)
+		if !ok {
+			return errors.New("cannot update Debian repository: unexpected generator type")
+		}
+		return updateDebianRepository(repoDir, pkgPath, pkgBytes, g)
+	case "pacman":
+		//the database is named after the repository directory, as expected by pacman.conf(5)
+		absRepoDir, err := filepath.Abs(repoDir)
+		if err != nil {
+			return err
+		}
+		dbPath := filepath.Join(repoDir, filepath.Base(absRepoDir)+".db.tar.gz")
+		return runRepositoryTool("pacman", []string{"repo-add"}, "--quiet", dbPath, pkgPath)
+	case "rpm":
+		return runRepositoryTool("RPM", []string{"createrepo_c", "createrepo"}, "--update", "--quiet", repoDir)
+	case "freebsd":
+		return runRepositoryTool("FreeBSD", []string{"pkg"}, "repo", "-q", repoDir)
+	case "oci-layer":
+		return errors.New("OCI image layers cannot be placed in a repository; push them to a container registry instead")
+	case "tar", "makeself", "nix":
+		return fmt.Errorf("there are no repositories for --format=%s", format)
+	default:
+		return fmt.Errorf("cannot update repository for unknown package format \"%s\"", format)
+	}
+}
+
+//runRepositoryTool runs the first of the given programs that is installed
+//with the given arguments.
+func runRepositoryTool(formatName string, programs []string, args ...string) error {
+	for _, program := range programs {
+		_, err := exec.LookPath(program)
+		if err != nil {
+			continue
+		}
+		output, err := exec.Command(program, args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("cannot update %s repository: %s failed: %s\n%s",
+				formatName, program, err.Error(), strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot update %s repository: %s not found", formatName, strings.Join(programs, " or "))
+}
+
+//updateDebianRepository maintains the Packages and Packages.gz files of a flat
+//Debian repository, as described in
+//<https://wiki.debian.org/DebianRepository/Format#Flat_Repository_Format>. The
+//existing index is updated in place, so the other packages in the repository
+//do not need to be read.
+func updateDebianRepository(repoDir, pkgPath string, pkgBytes []byte, generator *debian.Generator) error {
+	control, err := generator.ControlFile()
+	if err != nil {
+		return err
+	}
+	newStanza := debianIndexStanza(control, pkgPath, pkgBytes)
+
+	//read existing index, and replace previous entries for the same package
+	//version or file
+	indexPath := filepath.Join(repoDir, "Packages")
+	var stanzas []debianStanza
+	buf, err := ioutil.ReadFile(indexPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, text := range strings.Split(string(buf), "\n\n") {
+		stanza := debianStanza(strings.TrimSpace(text))
+		if stanza == "" {
+			continue
+		}
+		isSameFile := stanza.Field("Filename") == newStanza.Field("Filename")
+		isSameVersion := stanza.Field("Package") == newStanza.Field("Package") &&
+			stanza.Field("Version") == newStanza.Field("Version") &&
+			stanza.Field("Architecture") == newStanza.Field("Architecture")
+		if !isSameFile && !isSameVersion {
+			stanzas = append(stanzas, stanza)
+		}
+	}
+	stanzas = append(stanzas, newStanza)
+
+	//sort index reproducibly
+	sort.SliceStable(stanzas, func(i, j int) bool {
+		a, b := stanzas[i], stanzas[j]
+		if a.Field("Package") != b.Field("Package") {
+			return a.Field("Package") < b.Field("Package")
+		}
+		cmp, _ := build.CompareVersions("debian", a.Field("Version"), b.Field("Version"))
+		if cmp != 0 {
+			return cmp < 0
+		}
+		return a.Field("Architecture") < b.Field("Architecture")
+	})
+
+	texts := make([]string, len(stanzas))
+	for idx, stanza := range stanzas {
+		texts[idx] = string(stanza) + "\n"
+	}
+	index := []byte(strings.Join(texts, "\n"))
+
+	//write Packages and Packages.gz
+	var gzBuf bytes.Buffer
+	gzWriter := gzip.NewWriter(&gzBuf)
+	_, err = gzWriter.Write(index)
+	if err == nil {
+		err = gzWriter.Close()
+	}
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomically(indexPath, index, 0644)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(indexPath+".gz", gzBuf.Bytes(), 0644)
+}
+
+//debianIndexStanza returns the stanza for the Packages file of a flat Debian
+//repository, i.e. the control file of the package followed by its location,
+//size and checksums.
+func debianIndexStanza(control, pkgPath string, pkgBytes []byte) debianStanza {
+	md5sum := md5.Sum(pkgBytes)
+	sha1sum := sha1.Sum(pkgBytes)
+	sha256sum := sha256.Sum256(pkgBytes)
+	return debianStanza(strings.TrimSuffix(control, "\n") + "\n" + fmt.Sprintf(
+		"Filename: ./%s\nSize: %d\nMD5sum: %s\nSHA1: %s\nSHA256: %s",
+		filepath.Base(pkgPath), len(pkgBytes),
+		hex.EncodeToString(md5sum[:]), hex.EncodeToString(sha1sum[:]), hex.EncodeToString(sha256sum[:]),
+	))
+}
+
+//debianStanza is a paragraph from a Debian control file (without the trailing
+//newline).
+type debianStanza string
+
+//Field returns the value of the given single-line field, or "" if the field
+//does not exist.
+func (s debianStanza) Field(name string) string {
+	for _, line := range strings.Split(string(s), "\n") {
+		if strings.HasPrefix(line, name+":") {
+			return strings.TrimSpace(strings.TrimPrefix(line, name+":"))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,418 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/holocm/holo-build/pkg/pkgdump"
+)
+
+//This file contains the implementation of Options.RepositoryMetadata. The
+//metadata is derived from the built package (not from the package
+//definition), so that it shows exactly what a repository tool would see.
+
+//RepositoryMetadata renders the entry that a repository index would contain
+//for the given package file: the stanza of the Packages file for Debian
+//packages, the "desc" file in the repository database for Pacman packages
+//(as written by repo-add(8)), or the <package> element of primary.xml for RPM
+//packages (as written by createrepo_c(8)). The file name is only used for the
+//location of the package in the repository.
+func RepositoryMetadata(pkgBytes []byte, fileName string) (string, error) {
+	format, tree, err := pkgdump.Recognize(pkgBytes)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s: %s", fileName, err.Error())
+	}
+	switch format {
+	case pkgdump.FormatAr:
+		return debianRepositoryMetadata(tree, fileName)
+	case pkgdump.FormatRPM:
+		return rpmRepositoryMetadata(tree, fileName)
+	case pkgdump.FormatXZ, pkgdump.FormatZstd:
+		for tree.Format.IsCompression() && tree.Inner != nil {
+			tree = tree.Inner
+		}
+		if tree.Format == pkgdump.FormatTar {
+			return pacmanRepositoryMetadata(tree, pkgBytes, fileName)
+		}
+	}
+	return "", unsupportedRepositoryMetadata(fileName)
+}
+
+func unsupportedRepositoryMetadata(fileName string) error {
+	return fmt.Errorf("cannot show repository metadata for %s: only supported for Debian, Pacman and RPM packages", fileName)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Debian
+
+func debianRepositoryMetadata(tree *pkgdump.Tree, fileName string) (string, error) {
+	for _, entry := range tree.Entries {
+		if !strings.HasPrefix(entry.Name, "control.tar") {
+			continue
+		}
+		controlTar := entry.Content
+		for controlTar != nil && controlTar.Format.IsCompression() {
+			controlTar = controlTar.Inner
+		}
+		if controlTar == nil || controlTar.Format != pkgdump.FormatTar {
+			break
+		}
+		for _, file := range controlTar.Entries {
+			if strings.TrimPrefix(file.Name, "./") == "control" && file.Content != nil {
+				stanza := debianIndexStanza(string(file.Content.Data), fileName, tree.Data)
+				return string(stanza) + "\n", nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cannot show repository metadata for %s: control file not found", fileName)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Pacman
+
+//The fields of the "desc" file, in the order used by repo-add(8), with the
+//corresponding key in .PKGINFO (or "" for fields that are not taken from
+//there).
+var pacmanDescFields = []struct {
+	Field string
+	Key   string
+}{
+	{"FILENAME", ""},
+	{"NAME", "pkgname"},
+	{"BASE", "pkgbase"},
+	{"VERSION", "pkgver"},
+	{"DESC", "pkgdesc"},
+	{"GROUPS", "group"},
+	{"CSIZE", ""},
+	{"ISIZE", "size"},
+	{"MD5SUM", ""},
+	{"SHA256SUM", ""},
+	{"URL", "url"},
+	{"LICENSE", "license"},
+	{"ARCH", "arch"},
+	{"BUILDDATE", "builddate"},
+	{"PACKAGER", "packager"},
+	{"REPLACES", "replaces"},
+	{"CONFLICTS", "conflict"},
+	{"PROVIDES", "provides"},
+	{"DEPENDS", "depend"},
+	{"OPTDEPENDS", "optdepend"},
+	{"MAKEDEPENDS", "makedepend"},
+	{"CHECKDEPENDS", "checkdepend"},
+}
+
+func pacmanRepositoryMetadata(tree *pkgdump.Tree, pkgBytes []byte, fileName string) (string, error) {
+	var pkginfo *pkgdump.Tree
+	for _, entry := range tree.Entries {
+		if entry.Name == ".PKGINFO" {
+			pkginfo = entry.Content
+		}
+	}
+	if pkginfo == nil {
+		//not a Pacman package, but e.g. a tarball
+		return "", unsupportedRepositoryMetadata(fileName)
+	}
+
+	values := make(map[string][]string)
+	for _, line := range strings.Split(string(pkginfo.Data), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " = ", 2)
+		if len(fields) == 2 {
+			values[fields[0]] = append(values[fields[0]], fields[1])
+		}
+	}
+	md5sum := md5.Sum(pkgBytes)
+	sha256sum := sha256.Sum256(pkgBytes)
+	values["FILENAME"] = []string{filepath.Base(fileName)}
+	values["CSIZE"] = []string{strconv.Itoa(len(pkgBytes))}
+	values["MD5SUM"] = []string{hex.EncodeToString(md5sum[:])}
+	values["SHA256SUM"] = []string{hex.EncodeToString(sha256sum[:])}
+
+	//like repo-add, skip fields without values
+	var b strings.Builder
+	for _, f := range pacmanDescFields {
+		key := f.Key
+		if key == "" {
+			key = f.Field
+		}
+		if len(values[key]) == 0 || values[key][0] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%%%s%%\n%s\n\n", f.Field, strings.Join(values[key], "\n"))
+	}
+	return b.String(), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RPM
+
+//Tags in the RPM header, see [LSB,25.2.4] (only the ones that appear in
+//primary.xml).
+const (
+	rpmtagName            = 1000
+	rpmtagVersion         = 1001
+	rpmtagRelease         = 1002
+	rpmtagEpoch           = 1003
+	rpmtagSummary         = 1004
+	rpmtagDescription     = 1005
+	rpmtagBuildTime       = 1006
+	rpmtagBuildHost       = 1007
+	rpmtagSize            = 1009
+	rpmtagVendor          = 1011
+	rpmtagLicense         = 1014
+	rpmtagPackager        = 1015
+	rpmtagGroup           = 1016
+	rpmtagURL             = 1020
+	rpmtagArch            = 1022
+	rpmtagFileModes       = 1030
+	rpmtagSourceRPM       = 1044
+	rpmtagArchiveSize     = 1046
+	rpmtagProvideName     = 1047
+	rpmtagRequireFlags    = 1048
+	rpmtagRequireName     = 1049
+	rpmtagRequireVersion  = 1050
+	rpmtagConflictFlags   = 1053
+	rpmtagConflictName    = 1054
+	rpmtagConflictVersion = 1055
+	rpmtagObsoleteName    = 1090
+	rpmtagProvideFlags    = 1112
+	rpmtagProvideVersion  = 1113
+	rpmtagObsoleteFlags   = 1114
+	rpmtagObsoleteVersion = 1115
+	rpmtagDirIndexes      = 1116
+	rpmtagBaseNames       = 1117
+	rpmtagDirNames        = 1118
+)
+
+//rpmHeaderFields provides access to the fields of an RPM header section.
+type rpmHeaderFields map[uint32]pkgdump.Field
+
+func (h rpmHeaderFields) String(tag uint32) string {
+	if len(h[tag].Strings) == 0 {
+		return ""
+	}
+	return h[tag].Strings[0]
+}
+
+func (h rpmHeaderFields) Integer(tag uint32) int64 {
+	if len(h[tag].Integers) == 0 {
+		return 0
+	}
+	return h[tag].Integers[0]
+}
+
+//RPMSENSE flags that are relevant for primary.xml
+const (
+	rpmsenseLess       = 0x02
+	rpmsenseGreater    = 0x04
+	rpmsenseEqual      = 0x08
+	rpmsensePrereq     = 0x40
+	rpmsenseScriptPre  = 0x200
+	rpmsenseScriptPost = 0x400
+)
+
+var rpmsenseFlagNames = map[int64]string{
+	rpmsenseLess:                    "LT",
+	rpmsenseLess | rpmsenseEqual:    "LE",
+	rpmsenseEqual:                   "EQ",
+	rpmsenseGreater | rpmsenseEqual: "GE",
+	rpmsenseGreater:                 "GT",
+}
+
+//createrepo_c only lists files in primary.xml that match this check, the
+//remaining ones go into filelists.xml
+func isPrimaryFile(path string) bool {
+	return strings.HasPrefix(path, "/etc/") || strings.Contains(path, "bin/") || path == "/usr/lib/sendmail"
+}
+
+func rpmRepositoryMetadata(tree *pkgdump.Tree, fileName string) (string, error) {
+	h := make(rpmHeaderFields)
+	for _, section := range tree.Sections {
+		if section.Name == "signature" {
+			//fallback for the archive size
+			for _, field := range section.Fields {
+				if field.Tag == 1007 { //PAYLOADSIZE
+					h[rpmtagArchiveSize] = field
+				}
+			}
+		}
+	}
+	for _, section := range tree.Sections {
+		if section.Name == "header" {
+			for _, field := range section.Fields {
+				h[field.Tag] = field
+			}
+		}
+	}
+	if h.String(rpmtagName) == "" {
+		return "", fmt.Errorf("cannot show repository metadata for %s: NAME tag not found", fileName)
+	}
+	headerStart, headerEnd, err := rpmHeaderRange(tree.Data)
+	if err != nil {
+		return "", fmt.Errorf("cannot show repository metadata for %s: %s", fileName, err.Error())
+	}
+
+	var b strings.Builder
+	b.WriteString("<package type=\"rpm\">\n")
+	fmt.Fprintf(&b, "  <name>%s</name>\n", xmlEscape(h.String(rpmtagName)))
+	fmt.Fprintf(&b, "  <arch>%s</arch>\n", xmlEscape(h.String(rpmtagArch)))
+	fmt.Fprintf(&b, "  <version epoch=\"%d\" ver=\"%s\" rel=\"%s\"/>\n",
+		h.Integer(rpmtagEpoch), xmlEscape(h.String(rpmtagVersion)), xmlEscape(h.String(rpmtagRelease)))
+	sha256sum := sha256.Sum256(tree.Data)
+	fmt.Fprintf(&b, "  <checksum type=\"sha256\" pkgid=\"YES\">%s</checksum>\n", hex.EncodeToString(sha256sum[:]))
+	fmt.Fprintf(&b, "  <summary>%s</summary>\n", xmlEscape(h.String(rpmtagSummary)))
+	fmt.Fprintf(&b, "  <description>%s</description>\n", xmlEscape(h.String(rpmtagDescription)))
+	fmt.Fprintf(&b, "  <packager>%s</packager>\n", xmlEscape(h.String(rpmtagPackager)))
+	fmt.Fprintf(&b, "  <url>%s</url>\n", xmlEscape(h.String(rpmtagURL)))
+	//the file time is the mtime of the package file in the repository, which
+	//is not known yet; show the build time instead
+	fmt.Fprintf(&b, "  <time file=\"%d\" build=\"%d\"/>\n", h.Integer(rpmtagBuildTime), h.Integer(rpmtagBuildTime))
+	fmt.Fprintf(&b, "  <size package=\"%d\" installed=\"%d\" archive=\"%d\"/>\n",
+		len(tree.Data), h.Integer(rpmtagSize), h.Integer(rpmtagArchiveSize))
+	fmt.Fprintf(&b, "  <location href=\"%s\"/>\n", xmlEscape(filepath.Base(fileName)))
+	b.WriteString("  <format>\n")
+	fmt.Fprintf(&b, "    <rpm:license>%s</rpm:license>\n", xmlEscape(h.String(rpmtagLicense)))
+	fmt.Fprintf(&b, "    <rpm:vendor>%s</rpm:vendor>\n", xmlEscape(h.String(rpmtagVendor)))
+	fmt.Fprintf(&b, "    <rpm:group>%s</rpm:group>\n", xmlEscape(h.String(rpmtagGroup)))
+	fmt.Fprintf(&b, "    <rpm:buildhost>%s</rpm:buildhost>\n", xmlEscape(h.String(rpmtagBuildHost)))
+	fmt.Fprintf(&b, "    <rpm:sourcerpm>%s</rpm:sourcerpm>\n", xmlEscape(h.String(rpmtagSourceRPM)))
+	fmt.Fprintf(&b, "    <rpm:header-range start=\"%d\" end=\"%d\"/>\n", headerStart, headerEnd)
+	h.writeRelations(&b, "provides", rpmtagProvideName, rpmtagProvideFlags, rpmtagProvideVersion)
+	h.writeRelations(&b, "requires", rpmtagRequireName, rpmtagRequireFlags, rpmtagRequireVersion)
+	h.writeRelations(&b, "conflicts", rpmtagConflictName, rpmtagConflictFlags, rpmtagConflictVersion)
+	h.writeRelations(&b, "obsoletes", rpmtagObsoleteName, rpmtagObsoleteFlags, rpmtagObsoleteVersion)
+
+	dirNames := h[rpmtagDirNames].Strings
+	dirIndexes := h[rpmtagDirIndexes].Integers
+	modes := h[rpmtagFileModes].Integers
+	for idx, baseName := range h[rpmtagBaseNames].Strings {
+		if idx >= len(dirIndexes) || dirIndexes[idx] < 0 || dirIndexes[idx] >= int64(len(dirNames)) {
+			return "", fmt.Errorf("cannot show repository metadata for %s: invalid DIRINDEXES", fileName)
+		}
+		path := dirNames[dirIndexes[idx]] + baseName
+		if !isPrimaryFile(path) {
+			continue
+		}
+		if idx < len(modes) && modes[idx]&0170000 == 0040000 {
+			fmt.Fprintf(&b, "    <file type=\"dir\">%s</file>\n", xmlEscape(path))
+		} else {
+			fmt.Fprintf(&b, "    <file>%s</file>\n", xmlEscape(path))
+		}
+	}
+	b.WriteString("  </format>\n")
+	b.WriteString("</package>\n")
+	return b.String(), nil
+}
+
+//writeRelations renders a relation list like <rpm:requires>. Like
+//createrepo_c, requirements on rpmlib() features are skipped.
+func (h rpmHeaderFields) writeRelations(b *strings.Builder, element string, namesTag, flagsTag, versionsTag uint32) {
+	names := h[namesTag].Strings
+	flags := h[flagsTag].Integers
+	versions := h[versionsTag].Strings
+
+	var entries []string
+	for idx, name := range names {
+		if element == "requires" && strings.HasPrefix(name, "rpmlib(") {
+			continue
+		}
+		entry := fmt.Sprintf("<rpm:entry name=\"%s\"", xmlEscape(name))
+		var flag int64
+		if idx < len(flags) {
+			flag = flags[idx]
+		}
+		if flagName, ok := rpmsenseFlagNames[flag&(rpmsenseLess|rpmsenseGreater|rpmsenseEqual)]; ok && idx < len(versions) && versions[idx] != "" {
+			epoch, version, release := splitRPMVersion(versions[idx])
+			entry += fmt.Sprintf(" flags=\"%s\" epoch=\"%s\" ver=\"%s\"", flagName, epoch, xmlEscape(version))
+			if release != "" {
+				entry += fmt.Sprintf(" rel=\"%s\"", xmlEscape(release))
+			}
+		}
+		if element == "requires" && flag&(rpmsensePrereq|rpmsenseScriptPre|rpmsenseScriptPost) != 0 {
+			entry += " pre=\"1\""
+		}
+		entries = append(entries, entry+"/>")
+	}
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "    <rpm:%s>\n", element)
+	for _, entry := range entries {
+		fmt.Fprintf(b, "      %s\n", entry)
+	}
+	fmt.Fprintf(b, "    </rpm:%s>\n", element)
+}
+
+//splitRPMVersion splits a version like "2:1.0-1" into epoch, version and
+//release. The epoch defaults to "0", like in createrepo_c.
+func splitRPMVersion(fullVersion string) (epoch, version, release string) {
+	epoch = "0"
+	if idx := strings.Index(fullVersion, ":"); idx >= 0 {
+		epoch, fullVersion = fullVersion[:idx], fullVersion[idx+1:]
+	}
+	version = fullVersion
+	if idx := strings.LastIndex(fullVersion, "-"); idx >= 0 {
+		version, release = fullVersion[:idx], fullVersion[idx+1:]
+	}
+	return
+}
+
+//rpmHeaderRange returns the byte range of the header section in an RPM
+//package, as shown in <rpm:header-range>.
+func rpmHeaderRange(data []byte) (start, end uint64, err error) {
+	//the lead has a fixed size, and the signature section is aligned to 8 bytes
+	sectionEnd := func(offset uint64) (uint64, error) {
+		if uint64(len(data)) < offset+16 {
+			return 0, errors.New("unexpected end of file in RPM header")
+		}
+		entryCount := binary.BigEndian.Uint32(data[offset+8 : offset+12])
+		dataSize := binary.BigEndian.Uint32(data[offset+12 : offset+16])
+		return offset + 16 + 16*uint64(entryCount) + uint64(dataSize), nil
+	}
+	start, err = sectionEnd(96)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start%8 != 0 {
+		start += 8 - start%8
+	}
+	end, err = sectionEnd(start)
+	return start, end, err
+}
+
+//xmlEscape escapes text for inclusion in XML elements and attributes.
+func xmlEscape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text)) //cannot fail when writing into a strings.Builder
+	return b.String()
+}
@@ -0,0 +1,243 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//schemaProbe is the smallest valid package definition. ExplainSchema
+//validates it (and the same with each of schemaSectionProbes appended) with
+//every generator, to find out which restrictions each package format imposes.
+const schemaProbe = `
+[package]
+name = "probe"
+version = "1.0"
+`
+
+//schemaSectionProbes contains a minimal instance of those sections that some
+//package formats do not support (as indicated by ValidationError.Field).
+var schemaSectionProbes = map[string]string{
+	"action":  "[[action]]\non = \"setup\"\nscript = \"true\"\n",
+	"trigger": "[[trigger]]\npaths = [\"/etc\"]\nscript = \"true\"\n",
+	"service": "[[service]]\nunit = \"probe.service\"\n",
+}
+
+//ExplainSchema writes a description of the package definition format to the
+//given writer. The sections and keys are taken from PackageDefinition and its
+//section types (see the `explain` tags there), and the restrictions of the
+//individual package formats are found by asking their generators, so that the
+//description cannot drift from what the parser and the generators accept.
+func ExplainSchema(w io.Writer) error {
+	constraints, err := collectFormatConstraints()
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	defType := reflect.TypeOf(PackageDefinition{})
+	//top-level keys come before the first section (just like in TOML)
+	for idx := 0; idx < defType.NumField(); idx++ {
+		field := defType.Field(idx)
+		if sectionType(field.Type) == nil {
+			explainKey(&b, "", field, "", constraints)
+		}
+	}
+	for idx := 0; idx < defType.NumField(); idx++ {
+		field := defType.Field(idx)
+		secType := sectionType(field.Type)
+		if secType == nil {
+			continue
+		}
+		name := schemaKeyName(field)
+		header := "[" + name + "]"
+		if field.Type.Kind() == reflect.Slice {
+			header = "[[" + name + "]]"
+		}
+		if field.Tag.Get("required") == "true" {
+			header += " (required)"
+		}
+		fmt.Fprintf(&b, "%s\n    %s\n", header, field.Tag.Get("explain"))
+		for _, line := range constraints[name] {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+		b.WriteString("\n")
+
+		for idx := 0; idx < secType.NumField(); idx++ {
+			explainKey(&b, name+".", secType.Field(idx), "    ", constraints)
+		}
+	}
+
+	_, err = io.WriteString(w, strings.TrimSuffix(b.String(), "\n"))
+	return err
+}
+
+//explainKey renders the description of a single key for ExplainSchema.
+func explainKey(b *strings.Builder, prefix string, field reflect.StructField, indent string, constraints map[string][]string) {
+	//skip internal fields like FileSection.source
+	if field.PkgPath != "" {
+		return
+	}
+	name := schemaKeyName(field)
+
+	attrs := []string{schemaTypeName(field.Type)}
+	if field.Tag.Get("required") == "true" {
+		attrs = append(attrs, "required")
+	}
+	if value := field.Tag.Get("default"); value != "" {
+		attrs = append(attrs, "default: "+value)
+	}
+	fmt.Fprintf(b, "%s%s (%s)\n", indent, name, strings.Join(attrs, ", "))
+	fmt.Fprintf(b, "%s    %s\n", indent, field.Tag.Get("explain"))
+	if reason := field.Tag.Get("deprecated"); reason != "" {
+		fmt.Fprintf(b, "%s    DEPRECATED: %s\n", indent, reason)
+	}
+	for _, line := range constraints[prefix+name] {
+		fmt.Fprintf(b, "%s    %s\n", indent, line)
+	}
+	b.WriteString("\n")
+}
+
+//sectionType returns the type of the section struct if the given field type
+//describes a [section] or [[section]], or nil for a plain key.
+func sectionType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		return t
+	}
+	return nil
+}
+
+//schemaKeyName returns the TOML key for the given struct field.
+func schemaKeyName(field reflect.StructField) string {
+	if name := field.Tag.Get("toml"); name != "" {
+		return name
+	}
+	//the TOML decoder matches keys case-insensitively, but the documented
+	//spelling is camelCase
+	r, size := utf8.DecodeRuneInString(field.Name)
+	return string(unicode.ToLower(r)) + field.Name[size:]
+}
+
+//schemaTypeName describes the TOML type that the parser accepts for a field
+//of the given type.
+func schemaTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "unsigned integer"
+	case reflect.Interface:
+		//see FileSection.Owner
+		return "string or integer"
+	case reflect.Slice:
+		return "array of " + schemaTypeName(t.Elem()) + "s"
+	default:
+		panic("no schema type name for " + t.String())
+	}
+}
+
+//collectFormatConstraints returns descriptions of the restrictions that the
+//package formats impose, indexed by the key (e.g. "package.author") or section
+//(e.g. "trigger") that they refer to.
+func collectFormatConstraints() (map[string][]string, error) {
+	result := make(map[string][]string)
+
+	//which architectures are accepted for which format?
+	archNames := make([]string, 0, len(archMap))
+	for name := range archMap {
+		archNames = append(archNames, name)
+	}
+	sort.Strings(archNames)
+	for _, format := range Formats {
+		supported := GeneratorFactoryFor(format)(nil).SupportedArchitectures()
+		var accepted []string
+		for _, name := range archNames {
+			if _, ok := supported[archMap[name]]; ok {
+				accepted = append(accepted, name)
+			}
+		}
+		result["package.architecture"] = append(result["package.architecture"],
+			fmt.Sprintf("%s: %s", format, strings.Join(accepted, ", ")))
+	}
+
+	//which fields are required and which sections are rejected by which format?
+	sections := make([]string, 0, len(schemaSectionProbes))
+	for section := range schemaSectionProbes {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, format := range Formats {
+		errs, err := validateSchemaProbe(format, schemaProbe)
+		if err != nil {
+			return nil, err
+		}
+		for _, valErr := range errs {
+			if valErr.Field != "" {
+				result[valErr.Field] = append(result[valErr.Field], format+": "+valErr.Message)
+			}
+		}
+
+		for _, section := range sections {
+			errs, err := validateSchemaProbe(format, schemaProbe+schemaSectionProbes[section])
+			if err != nil {
+				return nil, err
+			}
+			for _, valErr := range errs {
+				if valErr.Field == section {
+					result[section] = append(result[section], format+": "+valErr.Message)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+//validateSchemaProbe parses the given package definition and returns the
+//problems that the generator for the given format finds in it.
+func validateSchemaProbe(format, definition string) ([]*build.ValidationError, error) {
+	pkg, _, errs := ParsePackageDefinition(strings.NewReader(definition), ParseOptions{Mode: ParseMetadataOnly})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("cannot parse probe for schema: %s", errs[0].Error())
+	}
+	var result []*build.ValidationError
+	for _, err := range GeneratorFactoryFor(format)(pkg).Validate() {
+		if valErr, ok := err.(*build.ValidationError); ok {
+			result = append(result, valErr)
+		}
+	}
+	return result, nil
+}
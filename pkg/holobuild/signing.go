@@ -0,0 +1,81 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/rpm"
+)
+
+//SignWithCommand runs the given shell command (see Options.SignCommand) with
+//the data to be signed on its standard input, and returns its standard output
+//as the signature.
+func SignWithCommand(command string, data []byte) ([]byte, error) {
+	shellPath, err := exec.LookPath("sh")
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(shellPath, "-c", command)
+	cmd.Stdin = bytes.NewReader(data)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, fmt.Errorf("signing command %q failed: %s", command, err.Error())
+		}
+		return nil, fmt.Errorf("signing command %q failed: %s: %s", command, err.Error(), msg)
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("signing command %q did not produce a signature", command)
+	}
+	return stdout.Bytes(), nil
+}
+
+//setSigner prepares the generator for Options.SignCommand. For RPM packages,
+//the signature is embedded in the package, so true is returned. For all other
+//formats, the package is signed after it has been written, and the signature
+//is written next to it (see writeSignatureFile).
+func setSigner(generator build.Generator, command string) bool {
+	g, ok := generator.(*rpm.Generator)
+	if !ok {
+		return false
+	}
+	g.Signer = func(headerSection []byte) ([]byte, error) {
+		return SignWithCommand(command, headerSection)
+	}
+	return true
+}
+
+//writeSignatureFile writes the signature from Options.SignCommand into a
+//sidecar file next to the package file at pkgPath, e.g.
+//"foo_1.0-1_any.deb.sig".
+func writeSignatureFile(signature []byte, pkgPath string, mode os.FileMode) error {
+	return writeFileWithMode(pkgPath+".sig", signature, mode)
+}
@@ -0,0 +1,158 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+var sizeRx = regexp.MustCompile(`^([0-9]+)\s*(B|kB|KiB|MB|MiB|GB|GiB)?$`)
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"kB":  1000,
+	"KiB": 1 << 10,
+	"MB":  1000 * 1000,
+	"MiB": 1 << 20,
+	"GB":  1000 * 1000 * 1000,
+	"GiB": 1 << 30,
+}
+
+//parseSize parses a size limit like "50MiB" from the [package] section.
+//Empty strings are parsed into 0 (no limit).
+func parseSize(key, value string, ec *ErrorCollector) int64 {
+	if value == "" {
+		return 0
+	}
+	match := sizeRx.FindStringSubmatch(value)
+	if match == nil {
+		ec.Addf("Invalid %s \"%s\" (must be a size like \"50MiB\")", key, value)
+		return 0
+	}
+	number, err := strconv.ParseInt(match[1], 10, 64)
+	unit := sizeUnits[match[2]]
+	if err != nil || number > (1<<62)/unit {
+		ec.Addf("Invalid %s \"%s\" (too large)", key, value)
+		return 0
+	}
+	return number * unit
+}
+
+//formatSize renders a size in bytes in a human-readable way, e.g. "1.5 MiB".
+func formatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	units := []string{"KiB", "MiB", "GiB"}
+	value := float64(size) / 1024
+	idx := 0
+	for value >= 1024 && idx < len(units)-1 {
+		value /= 1024
+		idx++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[idx])
+}
+
+//validateSizeLimits checks the installed size of the package against
+//pkg.MaxInstalledSize. This happens during validation, so the installed size
+//does not include the files that are added by the generator or by the Holo
+//integration (which are usually tiny anyway).
+func validateSizeLimits(pkg *build.Package) []error {
+	if pkg.MaxInstalledSize == 0 {
+		return nil
+	}
+	size := pkg.FSRoot.InstalledSizeInBytes()
+	if size <= pkg.MaxInstalledSize {
+		return nil
+	}
+	return []error{&build.ValidationError{
+		Field:   "package.maxInstalledSize",
+		Message: fmt.Sprintf("Installed size of the package (%s) exceeds maxInstalledSize (%s)", formatSize(size), formatSize(pkg.MaxInstalledSize)),
+	}}
+}
+
+//checkPackageSize checks the size of the generated package against
+//pkg.MaxPackageSize.
+func checkPackageSize(pkg *build.Package, pkgBytes []byte) error {
+	size := int64(len(pkgBytes))
+	if pkg.MaxPackageSize == 0 || size <= pkg.MaxPackageSize {
+		return nil
+	}
+	return fmt.Errorf("size of the package (%s) exceeds maxPackageSize (%s)", formatSize(size), formatSize(pkg.MaxPackageSize))
+}
+
+//SizeReport describes the size of a package, and which files contribute the
+//most to it. It is shown by `holo-build --print-size-report`.
+type SizeReport struct {
+	InstalledSize int64
+	PackageSize   int64
+	LargestFiles  []SizeReportFile
+}
+
+//SizeReportFile appears in SizeReport.LargestFiles.
+type SizeReportFile struct {
+	Path string
+	Size int64
+}
+
+//NewSizeReport prepares a SizeReport for a package that has been built by
+//Run() or Convert(). At most `count` files are listed.
+func NewSizeReport(result Result, count int) SizeReport {
+	pkg := result.Package
+	report := SizeReport{
+		InstalledSize: pkg.FSRoot.InstalledSizeInBytes(),
+		PackageSize:   int64(len(result.Contents)),
+	}
+	pkg.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		if file, ok := node.(*filesystem.RegularFile); ok {
+			report.LargestFiles = append(report.LargestFiles, SizeReportFile{absolutePath, file.ContentSize()})
+		}
+		return nil
+	})
+
+	//the walk is in path order, so files of the same size stay in path order
+	sort.SliceStable(report.LargestFiles, func(i, j int) bool {
+		return report.LargestFiles[i].Size > report.LargestFiles[j].Size
+	})
+	if len(report.LargestFiles) > count {
+		report.LargestFiles = report.LargestFiles[:count]
+	}
+	return report
+}
+
+//String renders the report in a human-readable way.
+func (r SizeReport) String() string {
+	result := fmt.Sprintf("installed size: %s\npackage size: %s\n", formatSize(r.InstalledSize), formatSize(r.PackageSize))
+	if len(r.LargestFiles) > 0 {
+		result += "largest files:\n"
+		for _, file := range r.LargestFiles {
+			result += fmt.Sprintf("%10s  %s\n", formatSize(file.Size), file.Path)
+		}
+	}
+	return result
+}
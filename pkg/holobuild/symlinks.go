@@ -0,0 +1,115 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package holobuild
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//symlinkEntry remembers a symlink node together with its path and its
+//definition, for use by processSymlinkTargets.
+type symlinkEntry struct {
+	Path    string
+	Node    *filesystem.Symlink
+	Section SymlinkSection
+}
+
+//normalizeSymlinkTarget removes redundant slashes as well as "." and ".."
+//components from the given symlink target. Leading ".." components of
+//relative targets are retained since they cannot be resolved without
+//knowing the symlink's location.
+func normalizeSymlinkTarget(target string) string {
+	if target == "" {
+		return ""
+	}
+	return path.Clean(target)
+}
+
+//resolveSymlinkTarget returns the absolute path that the given symlink points
+//to, and whether resolving the target had to go above the root directory.
+func resolveSymlinkTarget(linkPath, target string) (resolved string, escapesRoot bool) {
+	if path.IsAbs(target) {
+		return path.Clean(target), false
+	}
+	joined := path.Dir(linkPath) + "/" + target
+	depth := 0
+	for _, component := range strings.Split(joined, "/") {
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			depth--
+			if depth < 0 {
+				escapesRoot = true
+				depth = 0
+			}
+		default:
+			depth++
+		}
+	}
+	return path.Clean(joined), escapesRoot
+}
+
+//processSymlinkTargets checks the targets of all symlinks once the package's
+//file system is complete. In strict mode, targets outside the package are
+//rejected. If `makeRelative` is set, absolute targets are rewritten into
+//relative ones (except for those symlinks that opted out with `keepAbsolute`).
+//Targets referring to the original path of a compressed file (the keys of
+//`compressedPaths`) are changed to refer to the compressed file instead.
+func processSymlinkTargets(pkg *build.Package, links []symlinkEntry, compressedPaths map[string]string, strict, makeRelative bool, ec *ErrorCollector) {
+	//collect all paths in the package (including implicit directories)
+	pathsInPackage := make(map[string]bool)
+	ec.Add(pkg.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		pathsInPackage[absolutePath] = true
+		return nil
+	}))
+
+	for _, link := range links {
+		target := link.Node.Target
+		if target == "" {
+			continue //already reported by the parser
+		}
+
+		resolved, escapesRoot := resolveSymlinkTarget(link.Path, target)
+		if extension, exists := compressedPaths[resolved]; exists && !pathsInPackage[resolved] {
+			target += extension
+			resolved += extension
+			link.Node.Target = target
+		}
+		if escapesRoot {
+			ec.Warnf("symlink \"%s\" has target \"%s\" which goes above the root directory", link.Path, target)
+		}
+		if strict && !pathsInPackage[resolved] {
+			ec.Addf("symlink \"%s\" is invalid: target \"%s\" is not in the package (not allowed with strict = true)", link.Path, target)
+		}
+
+		if makeRelative && path.IsAbs(target) && !link.Section.KeepAbsolute {
+			//cannot fail since both paths are absolute
+			relTarget, _ := filepath.Rel(path.Dir(link.Path), resolved)
+			link.Node.Target = relTarget
+		}
+	}
+}
@@ -18,20 +18,10 @@
 *
 *******************************************************************************/
 
-package main
+package holobuild
 
-import (
-	"fmt"
-	"os"
-)
-
-//ShowWarning prints a warning message on stderr.
-func ShowWarning(msg string) {
-	fmt.Fprintf(os.Stderr, "\x1b[33m\x1b[1m>>\x1b[0m %s\n", msg)
-}
-
-//WarnDeprecatedKey prints a warning message to inform the user that she has
-//used a deprecated key in her package definition.
-func WarnDeprecatedKey(key string) {
-	ShowWarning("The '" + key + "' key is deprecated. See `man 1 holo-build` for details.")
+//warnDeprecatedKey adds a warning to inform the user that they have used a
+//deprecated key in their package definition.
+func (c *ErrorCollector) warnDeprecatedKey(key string) {
+	c.Warnf("The '%s' key is deprecated. See `man 1 holo-build` for details.", key)
 }
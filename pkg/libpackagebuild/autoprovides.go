@@ -0,0 +1,151 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/holocm/holo-build/pkg/libpackagebuild/elfinfo"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//SharedLibrary describes a shared library in the package (see
+//SharedLibraries).
+type SharedLibrary struct {
+	//Path is the absolute path of the library in the package.
+	Path string
+	//SOName is the library's DT_SONAME entry, e.g. "libfoo.so.1".
+	SOName string
+	//Is64Bit is true for 64-bit libraries.
+	Is64Bit bool
+}
+
+//PkgConfigModule describes a pkg-config file in the package (see
+//PkgConfigModules).
+type PkgConfigModule struct {
+	//Path is the absolute path of the .pc file in the package.
+	Path string
+	//Name is the name of the module as given to pkg-config, i.e. the file name
+	//without the ".pc" suffix.
+	Name string
+	//Version is the value of the "Version" field (with variables expanded),
+	//or empty if the file does not have one.
+	Version string
+}
+
+var (
+	//matches files in /lib, /usr/lib, /usr/local/lib and their variants for
+	//multilib and multiarch (e.g. /usr/lib64 or /usr/lib/x86_64-linux-gnu)
+	libraryPathRx = regexp.MustCompile(`^/(?:usr/(?:local/)?)?lib(?:32|64|x32)?(?:/[a-z0-9_]+-linux-[a-z0-9_]+)?/[^/]+\.so(?:\.[^/]*)?$`)
+	//matches .pc files in the pkg-config search path
+	pkgConfigPathRx = regexp.MustCompile(`^/usr/(?:local/)?(?:lib(?:32|64|x32)?(?:/[a-z0-9_]+-linux-[a-z0-9_]+)?|share)/pkgconfig/[^/]+\.pc$`)
+	//matches variable definitions and fields in .pc files
+	pkgConfigVariableRx = regexp.MustCompile(`^([A-Za-z0-9_.]+)\s*=\s*(.*)$`)
+	pkgConfigFieldRx    = regexp.MustCompile(`^([A-Za-z0-9_.]+)\s*:\s*(.*)$`)
+	pkgConfigRefRx      = regexp.MustCompile(`\$\{([A-Za-z0-9_.]+)\}`)
+)
+
+//SharedLibraries returns the shared libraries in the package's library
+//directories (e.g. /usr/lib), if AutoProvides is set. Files without a SONAME
+//(e.g. plugins) and files that are not ELF files at all are skipped. This must
+//be called after PrepareBuild() or Relocate().
+func (p *Package) SharedLibraries() ([]SharedLibrary, error) {
+	if !p.AutoProvides {
+		return nil, nil
+	}
+
+	var result []SharedLibrary
+	err := p.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		file, ok := node.(*filesystem.RegularFile)
+		if !ok || !libraryPathRx.MatchString(absolutePath) {
+			return nil
+		}
+		r, err := file.OpenContent()
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %s", absolutePath, err.Error())
+		}
+		defer r.Close()
+		info, err := elfinfo.Inspect(r)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %s", absolutePath, err.Error())
+		}
+		if info != nil && info.SOName != "" {
+			result = append(result, SharedLibrary{
+				Path:    absolutePath,
+				SOName:  info.SOName,
+				Is64Bit: info.Is64Bit,
+			})
+		}
+		return nil
+	})
+	return result, err
+}
+
+//PkgConfigModules returns the pkg-config modules in the package's pkg-config
+//directories (e.g. /usr/lib/pkgconfig), if AutoProvides is set. This must be
+//called after PrepareBuild() or Relocate().
+func (p *Package) PkgConfigModules() ([]PkgConfigModule, error) {
+	if !p.AutoProvides {
+		return nil, nil
+	}
+
+	var result []PkgConfigModule
+	err := p.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		file, ok := node.(*filesystem.RegularFile)
+		if !ok || !pkgConfigPathRx.MatchString(absolutePath) {
+			return nil
+		}
+		r, err := file.OpenContent()
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %s", absolutePath, err.Error())
+		}
+		defer r.Close()
+
+		module := PkgConfigModule{
+			Path: absolutePath,
+			Name: strings.TrimSuffix(path.Base(absolutePath), ".pc"),
+		}
+		variables := make(map[string]string)
+		expand := func(value string) string {
+			return pkgConfigRefRx.ReplaceAllStringFunc(value, func(ref string) string {
+				return variables[ref[2:len(ref)-1]]
+			})
+		}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if match := pkgConfigVariableRx.FindStringSubmatch(line); match != nil {
+				variables[match[1]] = expand(match[2])
+			} else if match := pkgConfigFieldRx.FindStringSubmatch(line); match != nil && match[1] == "Version" {
+				module.Version = expand(match[2])
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("cannot read %s: %s", absolutePath, err.Error())
+		}
+		result = append(result, module)
+		return nil
+	})
+	return result, err
+}
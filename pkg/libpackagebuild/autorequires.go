@@ -0,0 +1,225 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/holocm/holo-build/pkg/libpackagebuild/elfinfo"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//FileDependency describes something that a file in the package needs at
+//runtime (see FileDependencies).
+type FileDependency struct {
+	//Path is the absolute path of the file in the package that has this
+	//dependency.
+	Path string
+	//Interpreter is the interpreter from a shebang line (e.g.
+	//"/usr/bin/python3", or just "python3" for "#!/usr/bin/env python3") or
+	//the program interpreter of an ELF executable (e.g.
+	//"/lib64/ld-linux-x86-64.so.2"). It is empty for library dependencies.
+	Interpreter string
+	//Library is the SONAME of a shared library that an ELF file is linked
+	//against (e.g. "libc.so.6"). It is empty for interpreter dependencies.
+	Library string
+	//Is64Bit is true if the dependency comes from a 64-bit ELF file.
+	Is64Bit bool
+}
+
+//Name returns the Interpreter or Library.
+func (d FileDependency) Name() string {
+	if d.Library != "" {
+		return d.Library
+	}
+	return d.Interpreter
+}
+
+//DependencyMapping overrides the package name that generators use for a
+//FileDependency when AutoRequires is set.
+type DependencyMapping struct {
+	//Dependency is matched against the FileDependency.Name(), either in full
+	//(e.g. "/usr/bin/node") or by its file name (e.g. "node").
+	Dependency string
+	//Packages maps generator names ("debian", "pacman" and "rpm") to the name
+	//of the package that satisfies the dependency on this distribution.
+	Packages map[string]string
+}
+
+//FileDependencies scans the package's files for the interpreters and shared
+//libraries that they need, if AutoRequires is set. Shebang lines are only
+//considered for executable files. Dependencies that are satisfied by the
+//package itself are skipped. This must be called after PrepareBuild() or
+//Relocate().
+func (p *Package) FileDependencies() ([]FileDependency, error) {
+	if !p.AutoRequires {
+		return nil, nil
+	}
+
+	var (
+		result []FileDependency
+		//absolute paths and file names of everything in the package
+		ownPaths = make(map[string]bool)
+	)
+	err := p.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		ownPaths[absolutePath] = true
+		ownPaths[path.Base(absolutePath)] = true
+		file, ok := node.(*filesystem.RegularFile)
+		if !ok {
+			return nil
+		}
+		deps, err := scanFileDependencies(absolutePath, file)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %s", absolutePath, err.Error())
+		}
+		result = append(result, deps...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//a script may use an interpreter that is in the same package, and a
+	//program may be linked against a library that is in the same package
+	filtered := result[:0]
+	for _, dep := range result {
+		if dep.Library != "" && ownPaths[dep.Library] {
+			continue
+		}
+		if dep.Interpreter != "" && ownPaths[dep.Interpreter] {
+			continue
+		}
+		filtered = append(filtered, dep)
+	}
+	return filtered, nil
+}
+
+//scanFileDependencies reads the shebang line or ELF header of a single file.
+func scanFileDependencies(absolutePath string, file *filesystem.RegularFile) ([]FileDependency, error) {
+	r, err := file.OpenContent()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	br := bufio.NewReader(r)
+	header, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if elfinfo.IsELF(header) {
+		info, err := elfinfo.Inspect(br)
+		if err != nil {
+			return nil, err
+		}
+		var deps []FileDependency
+		if info.Interpreter != "" {
+			deps = append(deps, FileDependency{Path: absolutePath, Interpreter: info.Interpreter, Is64Bit: info.Is64Bit})
+		}
+		for _, lib := range info.Needed {
+			deps = append(deps, FileDependency{Path: absolutePath, Library: lib, Is64Bit: info.Is64Bit})
+		}
+		return deps, nil
+	}
+
+	//like rpmbuild, only look at the shebang lines of executable files
+	if !strings.HasPrefix(string(header), "#!") || file.Metadata.Mode&0111 == 0 {
+		return nil, nil
+	}
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	interpreter := fields[0]
+	//for "#!/usr/bin/env python3", the interesting dependency is "python3"
+	//(env itself is part of the essential tools on every distribution)
+	if path.Base(interpreter) == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = field
+				break
+			}
+		}
+		if interpreter == "" {
+			return nil, nil
+		}
+	}
+	return []FileDependency{{Path: absolutePath, Interpreter: interpreter}}, nil
+}
+
+//AddAutoRequires adds requirements for the package's FileDependencies (if
+//AutoRequires is set). Each dependency is translated into a package name by
+//the DependencyMappings for the given generator name, or else by the given
+//function, which is supplied by the generator and implements the conventions
+//of its distribution. Dependencies that are translated into an empty package
+//name are skipped. This must be called after PrepareBuild() or Relocate().
+func (p *Package) AddAutoRequires(generatorName string, translate func(FileDependency) string) error {
+	deps, err := p.FileDependencies()
+	if err != nil {
+		return err
+	}
+
+	for _, dep := range deps {
+		name, exists := p.mappedDependency(generatorName, dep)
+		if !exists {
+			name = translate(dep)
+		}
+		if name == "" || name == p.Name {
+			continue
+		}
+		isRequired := false
+		for _, rel := range p.Requires {
+			if rel.RelatedPackage == name {
+				isRequired = true
+				break
+			}
+		}
+		if !isRequired {
+			p.Requires = append(p.Requires, PackageRelation{RelatedPackage: name})
+		}
+	}
+	return nil
+}
+
+//mappedDependency finds the package name for the given dependency in the
+//DependencyMappings.
+func (p *Package) mappedDependency(generatorName string, dep FileDependency) (string, bool) {
+	for _, key := range []string{dep.Name(), path.Base(dep.Name())} {
+		for _, mapping := range p.DependencyMappings {
+			if mapping.Dependency != key {
+				continue
+			}
+			name, exists := mapping.Packages[generatorName]
+			if exists && name != "" {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,70 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package debian
+
+import (
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//alternativesPostinst returns the postinst snippet that registers the
+//package's alternatives, or "" if there are none.
+func alternativesPostinst(pkg *build.Package) string {
+	alts := pkg.RelocatedAlternatives()
+	if len(alts) == 0 {
+		return ""
+	}
+
+	lines := []string{`if [ "$1" = configure ] || [ "$1" = abort-upgrade ] || [ "$1" = abort-deconfigure ] || [ "$1" = abort-remove ]; then`}
+	for _, alt := range alts {
+		lines = append(lines, fmt.Sprintf("    update-alternatives --install '%s' '%s' '%s' %d", alt.Link, alt.Name, alt.Path, alt.Priority))
+	}
+	lines = append(lines, "fi")
+	return strings.Join(lines, "\n")
+}
+
+//alternativesPrerm returns the prerm snippet that unregisters the package's
+//alternatives, or "" if there are none.
+func alternativesPrerm(pkg *build.Package) string {
+	alts := pkg.RelocatedAlternatives()
+	if len(alts) == 0 {
+		return ""
+	}
+
+	lines := []string{`if [ "$1" = remove ] || [ "$1" = deconfigure ]; then`}
+	for _, alt := range alts {
+		lines = append(lines, fmt.Sprintf("    update-alternatives --remove '%s' '%s'", alt.Name, alt.Path))
+	}
+	lines = append(lines, "fi")
+	return strings.Join(lines, "\n")
+}
+
+//joinSnippets concatenates the non-empty ones of the given shell snippets.
+func joinSnippets(snippets ...string) string {
+	var nonEmpty []string
+	for _, snippet := range snippets {
+		if snippet != "" {
+			nonEmpty = append(nonEmpty, snippet)
+		}
+	}
+	return strings.Join(nonEmpty, "\n")
+}
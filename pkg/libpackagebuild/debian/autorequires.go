@@ -0,0 +1,59 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package debian
+
+import (
+	"path"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//dependencyPackages maps the file names of common interpreters and shared
+//libraries to the Debian packages that contain them. Interpreters in
+//essential packages (which are always installed) map to "".
+var dependencyPackages = map[string]string{
+	"sh":                    "",
+	"bash":                  "",
+	"dash":                  "",
+	"perl":                  "perl",
+	"python3":               "python3",
+	"ruby":                  "ruby",
+	"node":                  "nodejs",
+	"nodejs":                "nodejs",
+	"php":                   "php-cli",
+	"ld-linux.so.2":         "libc6",
+	"ld-linux.so.3":         "libc6",
+	"ld-linux-armhf.so.3":   "libc6",
+	"ld-linux-aarch64.so.1": "libc6",
+	"ld-linux-x86-64.so.2":  "libc6",
+	"libc.so.6":             "libc6",
+	"libdl.so.2":            "libc6",
+	"libm.so.6":             "libc6",
+	"libpthread.so.0":       "libc6",
+	"libresolv.so.2":        "libc6",
+	"librt.so.1":            "libc6",
+	"libutil.so.1":          "libc6",
+}
+
+//dependencyPackage translates a build.FileDependency into the name of the
+//package that satisfies it (see build.Package.AddAutoRequires).
+func dependencyPackage(dep build.FileDependency) string {
+	return dependencyPackages[path.Base(dep.Name())]
+}
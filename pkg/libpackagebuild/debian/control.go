@@ -0,0 +1,107 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package debian
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//controlMember describes a file in control.tar, except for the maintainer
+//scripts (see maintainerScripts).
+type controlMember struct {
+	Name string
+	Mode os.FileMode
+	//Required members are written even if they are empty. Other members are
+	//only written when the package uses the corresponding feature.
+	Required bool
+	//Content returns the contents of this member for the given package.
+	Content func(pkg *build.Package) (string, error)
+}
+
+//controlMembers lists the files in control.tar. Reference:
+//https://www.debian.org/doc/debian-policy/ch-controlfields.html and deb(5)
+var controlMembers = []controlMember{
+	{Name: "control", Mode: 0644, Required: true, Content: makeControlFile},
+	{Name: "md5sums", Mode: 0644, Required: true, Content: makeMD5SumsFile},
+	{Name: "conffiles", Mode: 0644, Content: makeConffilesFile},
+	{Name: "shlibs", Mode: 0644, Content: makeShlibsFile},
+	{Name: "triggers", Mode: 0644, Content: makeTriggersFile},
+	{Name: "templates", Mode: 0644, Content: makeTemplatesFile},
+	{Name: "config", Mode: 0755, Content: makeConfigScript},
+}
+
+func buildControlDir(pkg *build.Package) (*filesystem.Directory, error) {
+	//prepare a directory into which to put all these files
+	controlDir := filesystem.NewDirectory()
+
+	for _, member := range controlMembers {
+		contents, err := member.Content(pkg)
+		if err != nil {
+			return nil, err
+		}
+		if contents == "" && !member.Required {
+			continue
+		}
+		controlDir.Entries[member.Name] = &filesystem.RegularFile{
+			Content:  []byte(contents),
+			Metadata: filesystem.NodeMetadata{Mode: member.Mode},
+		}
+	}
+
+	writeMaintainerScripts(pkg, controlDir)
+	return controlDir, nil
+}
+
+//makeConffilesFile lists the files that are marked as configuration files
+//(see filesystem.RegularFile.Config). dpkg does not overwrite these on
+//upgrade if they were modified by the administrator.
+func makeConffilesFile(pkg *build.Package) (string, error) {
+	var lines []string
+	err := pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+		if file, ok := node.(*filesystem.RegularFile); ok && file.Config {
+			lines = append(lines, path+"\n")
+		}
+		return nil
+	})
+	return strings.Join(lines, ""), err
+}
+
+//validateConffilePaths warns about configuration files outside of /etc,
+//which is where Debian policy (section 10.7.2) expects all conffiles.
+func validateConffilePaths(pkg *build.Package) []error {
+	var errs []error
+	pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+		if file, ok := node.(*filesystem.RegularFile); ok && file.Config && !strings.HasPrefix(path, "/etc/") {
+			errs = append(errs, &build.ValidationError{
+				Path:     path,
+				Severity: build.SeverityWarning,
+				Format:   "Debian",
+				Message:  fmt.Sprintf("configuration file \"%s\" should be below /etc", path),
+			})
+		}
+		return nil
+	})
+	return errs
+}
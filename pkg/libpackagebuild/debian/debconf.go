@@ -0,0 +1,120 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package debian
+
+import (
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//Packages that ask questions during installation ship a "templates" file
+//with the questions and a "config" script that asks them. The snippets in
+//this file follow the ones that dh_installdebconf generates.
+//Reference: https://www.debian.org/doc/debian-policy/ap-pkg-debconf.html
+
+//makeTemplatesFile returns the "templates" control file, or "" if the package
+//does not use debconf.
+func makeTemplatesFile(pkg *build.Package) (string, error) {
+	if pkg.Debian.Templates == "" {
+		return "", nil
+	}
+	return strings.TrimSuffix(pkg.Debian.Templates, "\n") + "\n", nil
+}
+
+//makeConfigScript returns the "config" script, or "" if the package does not
+//have one. Scripts without a shebang line are prefixed with a shebang line and
+//the loading of the debconf module, so that they can use the db_* commands
+//right away. (The maintainer scripts do not load the debconf module, except
+//for the purge snippet in postrm.)
+func makeConfigScript(pkg *build.Package) (string, error) {
+	script := strings.TrimSuffix(pkg.Debian.Config, "\n")
+	switch {
+	case script == "":
+		return "", nil
+	case strings.HasPrefix(script, "#!"):
+		return script + "\n", nil
+	default:
+		return "#!/bin/sh\nset -e\n. /usr/share/debconf/confmodule\n\n" + script + "\n", nil
+	}
+}
+
+//validateDebconf checks the fields of build.DebianOptions that concern
+//debconf.
+func validateDebconf(pkg *build.Package) []error {
+	var errs []error
+	if pkg.Debian.Config != "" && pkg.Debian.Templates == "" {
+		errs = append(errs, &build.ValidationError{
+			Field:   "debian.config",
+			Format:  "Debian",
+			Message: "\"debian.config\" requires \"debian.templates\" (the config script can only ask questions from the templates file)",
+		})
+	}
+
+	//each paragraph of the templates file must declare a template and its type
+	for idx, paragraph := range strings.Split(pkg.Debian.Templates, "\n\n") {
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		var hasTemplate, hasType bool
+		for _, line := range strings.Split(paragraph, "\n") {
+			hasTemplate = hasTemplate || strings.HasPrefix(line, "Template:")
+			hasType = hasType || strings.HasPrefix(line, "Type:")
+		}
+		if !hasTemplate || !hasType {
+			errs = append(errs, &build.ValidationError{
+				Field:   "debian.templates",
+				Format:  "Debian",
+				Message: fmt.Sprintf("paragraph %d of \"debian.templates\" must contain a \"Template\" and a \"Type\" field", idx+1),
+			})
+		}
+	}
+	return errs
+}
+
+//debconfPostrm returns the postrm snippet that removes the package's answers
+//from the debconf database on purge, or "" if the package does not use
+//debconf.
+func debconfPostrm(pkg *build.Package) string {
+	if pkg.Debian.Templates == "" {
+		return ""
+	}
+	return strings.Join([]string{
+		`if [ "$1" = purge ] && [ -e /usr/share/debconf/confmodule ]; then`,
+		`    . /usr/share/debconf/confmodule`,
+		`    db_purge`,
+		`fi`,
+	}, "\n")
+}
+
+//addDebconfDependency adds a dependency on debconf, if the package has
+//debconf templates.
+func addDebconfDependency(pkg *build.Package) {
+	if pkg.Debian.Templates == "" {
+		return
+	}
+	for _, rel := range pkg.Requires {
+		if rel.RelatedPackage == "debconf" {
+			return
+		}
+	}
+	pkg.Requires = append(pkg.Requires, build.PackageRelation{RelatedPackage: "debconf"})
+}
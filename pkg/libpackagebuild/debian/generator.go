@@ -0,0 +1,595 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package debian provides a build.Generator for Debian packages.
+package debian
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//Generator is the build.Generator for Debian packages.
+type Generator struct {
+	Package *build.Package
+	//ControlCompression selects how the control.tar member is compressed. If
+	//empty, CompressionGZip is used.
+	ControlCompression Compression
+	//Jobs is the number of threads for compressing data.tar.xz. The result is
+	//the same for all values greater than 1 (see filesystem.XZArguments).
+	Jobs int
+
+	//state shared between Plan() and Render()
+	plan       *build.Plan
+	controlDir *filesystem.Directory
+}
+
+//Compression is an enumeration of compression methods for archive members.
+type Compression string
+
+const (
+	//CompressionGZip creates a member like "control.tar.gz".
+	CompressionGZip Compression = "gz"
+	//CompressionXZ creates a member like "control.tar.xz" (requires dpkg 1.17.6
+	//or newer).
+	CompressionXZ Compression = "xz"
+	//CompressionZstd creates a member like "control.tar.zst" (requires dpkg
+	//1.21.18 or newer).
+	CompressionZstd Compression = "zst"
+	//CompressionNone creates an uncompressed member like "control.tar".
+	CompressionNone Compression = "none"
+)
+
+//memberName returns the ar member name for a tar archive with this
+//compression, e.g. "control.tar.gz" for base name "control".
+func (c Compression) memberName(baseName string) string {
+	if c == CompressionNone {
+		return baseName + ".tar"
+	}
+	return baseName + ".tar." + string(c)
+}
+
+//writeTarArchive writes the given directory as a tar archive with this
+//compression.
+func (c Compression) writeTarArchive(w io.Writer, dir *filesystem.Directory) error {
+	switch c {
+	case CompressionGZip:
+		return dir.ToTarGZArchive(w, true, false)
+	case CompressionXZ:
+		return dir.ToTarXZArchive(w, true, false)
+	case CompressionZstd:
+		return dir.ToTarZstdArchive(w, true, false)
+	case CompressionNone:
+		return dir.ToTarArchive(w, true, false)
+	default:
+		return fmt.Errorf("unknown compression method \"%s\"", string(c))
+	}
+}
+
+//GeneratorFactory spawns Generator instances. It satisfies the build.GeneratorFactory type.
+func GeneratorFactory(pkg *build.Package) build.Generator {
+	return &Generator{Package: pkg}
+}
+
+var archMap = map[build.Architecture]string{
+	build.ArchitectureAny:    "all",
+	build.ArchitectureI386:   "i386",
+	build.ArchitectureX86_64: "amd64",
+	build.ArchitectureARMv5:  "armel",
+	// build.ArchitectureARMv6h is not supported by Debian
+	build.ArchitectureARMv7h:  "armhf",
+	build.ArchitectureAArch64: "arm64",
+}
+
+//SupportedArchitectures implements the build.Generator interface.
+func (g *Generator) SupportedArchitectures() map[build.Architecture]string {
+	return archMap
+}
+
+//Capabilities implements the build.CapabilityReporter interface.
+func (g *Generator) Capabilities() build.Capabilities {
+	return build.Capabilities{
+		Compressions: []string{"gzip", "xz", "zstd"}, //see ControlCompression
+		Actions:      true,
+		Triggers:     true,
+		Services:     true,
+		Alternatives: true,
+	}
+}
+
+//RecommendedFileName implements the build.Generator interface.
+func (g *Generator) RecommendedFileName() string {
+	c := g.RecommendedFileNameComponents()
+	return fmt.Sprintf("%s_%s_%s%s", c.Name, c.FullVersion, c.ArchString, c.Extension)
+}
+
+//RecommendedFileNameComponents implements the build.Generator interface.
+func (g *Generator) RecommendedFileNameComponents() build.FileNameComponents {
+	//this is called after Build(), so we can assume that package name,
+	//version, etc. were already validated
+	pkg := g.Package
+	return build.FileNameComponents{
+		Name:        pkg.Name,
+		FullVersion: fullVersionString(pkg),
+		ArchString:  archMap[pkg.Architecture],
+		Extension:   ".deb",
+	}
+}
+
+//Validate implements the build.Generator interface.
+func (g *Generator) Validate() []error {
+	pkg := g.Package
+
+	//reference: https://www.debian.org/doc/debian-policy/ch-controlfields.html
+	var nameRx = `[a-z0-9][a-z0-9+-.]+`
+	var versionRx = `[0-9][A-Za-z0-9.+:~-]*`
+	errs := pkg.ValidateWith(build.RegexSet{
+		PackageName:    nameRx,
+		PackageVersion: versionRx,
+		RelatedName:    nameRx,
+		RelatedVersion: "(?:[0-9]+:)?" + versionRx + "(?:-[1-9][0-9]*)?", //incl. release/epoch
+		FormatName:     "Debian",
+	}, archMap)
+
+	if pkg.Author == "" {
+		errs = append(errs, &build.ValidationError{
+			Field:   "package.author",
+			Format:  "Debian",
+			Message: "The \"package.author\" field is required for Debian packages",
+		})
+	}
+
+	for _, rel := range pkg.Provides {
+		if len(rel.Constraints) > 0 {
+			errs = append(errs, &build.ValidationError{
+				Field:   "package.provides",
+				Format:  "Debian",
+				Message: fmt.Sprintf("version constraints on \"Provides: %s\" are not allowed for Debian packages", rel.RelatedPackage),
+			})
+		}
+	}
+
+	switch pkg.Debian.MultiArch {
+	case "", "no", "foreign", "allowed":
+		//ok
+	case "same":
+		//dpkg rejects this combination, since only architecture-specific
+		//packages can be co-installed for multiple architectures
+		if pkg.Architecture == build.ArchitectureAny {
+			errs = append(errs, &build.ValidationError{
+				Field:   "debian.multiArch",
+				Format:  "Debian",
+				Message: "\"Multi-Arch: same\" is not allowed for packages with architecture \"all\"",
+			})
+		}
+	default:
+		errs = append(errs, &build.ValidationError{
+			Field:   "debian.multiArch",
+			Format:  "Debian",
+			Message: fmt.Sprintf("invalid value \"%s\" for \"Multi-Arch\" (must be \"no\", \"same\", \"foreign\" or \"allowed\")", pkg.Debian.MultiArch),
+		})
+	}
+
+	switch g.ControlCompression {
+	case "", CompressionGZip, CompressionXZ, CompressionZstd, CompressionNone:
+		//ok
+	default:
+		errs = append(errs, &build.ValidationError{
+			Format:  "Debian",
+			Message: fmt.Sprintf("unknown compression method \"%s\" for control.tar (must be \"gz\", \"xz\", \"zst\" or \"none\")", string(g.ControlCompression)),
+		})
+	}
+
+	errs = append(errs, validateDocumentationPaths(pkg)...)
+	errs = append(errs, validateConffilePaths(pkg)...)
+	errs = append(errs, validateDebconf(pkg)...)
+
+	//no reserved paths: the package metadata lives in control.tar, separately
+	//from the package contents in data.tar
+	return errs
+}
+
+//validateDocumentationPaths warns about files flagged as documentation or
+//license text that are not where Debian policy expects them (see sections
+//12.1 to 12.5). These are only warnings since dpkg does not care.
+func validateDocumentationPaths(pkg *build.Package) []error {
+	var errs []error
+	pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+		file, ok := node.(*filesystem.RegularFile)
+		if !ok {
+			return nil
+		}
+		switch {
+		case file.License && !strings.HasPrefix(path, "/usr/share/doc/"):
+			errs = append(errs, &build.ValidationError{
+				Path:     path,
+				Severity: build.SeverityWarning,
+				Format:   "Debian",
+				Message:  fmt.Sprintf("license file \"%s\" should be below /usr/share/doc (usually as /usr/share/doc/%s/copyright)", path, pkg.Name),
+			})
+		case file.Documentation && !strings.HasPrefix(path, "/usr/share/doc/") && !strings.HasPrefix(path, "/usr/share/man/") && !strings.HasPrefix(path, "/usr/share/info/"):
+			errs = append(errs, &build.ValidationError{
+				Path:     path,
+				Severity: build.SeverityWarning,
+				Format:   "Debian",
+				Message:  fmt.Sprintf("documentation file \"%s\" should be below /usr/share/doc, /usr/share/man or /usr/share/info", path),
+			})
+		}
+		return nil
+	})
+	return errs
+}
+
+func fullVersionString(pkg *build.Package) string {
+	var b strings.Builder
+
+	if pkg.Epoch > 0 {
+		fmt.Fprintf(&b, "%d:", pkg.Epoch)
+	}
+
+	b.WriteString(pkg.Version)
+
+	if pkg.PrereleaseType != build.PrereleaseTypeNone {
+		fmt.Fprintf(&b, "~%s.%d", pkg.PrereleaseType.String(), pkg.PrereleaseVersion)
+	}
+
+	fmt.Fprintf(&b, "-%d", pkg.Release)
+
+	return b.String()
+}
+
+type arArchiveEntry struct {
+	Name string
+	Data []byte
+}
+
+//Build implements the build.Generator interface.
+func (g *Generator) Build() ([]byte, error) {
+	plan, err := g.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return g.Render(plan)
+}
+
+//Plan implements the build.Planner interface.
+func (g *Generator) Plan() (*build.Plan, error) {
+	if g.plan != nil {
+		return g.plan, nil
+	}
+
+	pkg := g.Package
+	err := pkg.PrepareBuild()
+	if err != nil {
+		return nil, err
+	}
+	addServicesDependency(pkg)
+	addDebconfDependency(pkg)
+	//dpkg does not have transaction scripts, so run these actions together
+	//with the other setup actions
+	pkg.FoldTransactionActions()
+	//Debian policy (section 7.6.2) replaces a package with the
+	//Conflicts+Replaces+Provides triplet; Provides stays unversioned for the
+	//benefit of older dpkg versions
+	pkg.FoldSupersedes("", true)
+	pkg.AddHologramProvides("hologram-"+pkg.Name, "")
+
+	//read every file once to compute its digests
+	err = pkg.ComputeDigests()
+	if err != nil {
+		return nil, err
+	}
+	err = pkg.AddAutoRequires("debian", dependencyPackage)
+	if err != nil {
+		return nil, err
+	}
+
+	//assemble the metadata files for control.tar
+	controlDir, err := buildControlDir(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &build.Plan{Format: "debian"}
+	control, err := makeControlFile(pkg)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(control, "\n"), "\n") {
+		//continuation lines (e.g. in the Description) belong to the previous field
+		if strings.HasPrefix(line, " ") && len(plan.Metadata) > 0 {
+			plan.Metadata[len(plan.Metadata)-1].Value += "\n" + line
+			continue
+		}
+		fields := strings.SplitN(line, ": ", 2)
+		if len(fields) == 2 {
+			plan.Metadata = append(plan.Metadata, build.PlanValue{Key: fields[0], Value: fields[1]})
+		}
+	}
+
+	controlArchive, err := build.NewPlanArchive(g.compression().memberName("control"), controlDir, nil)
+	if err != nil {
+		return nil, err
+	}
+	dataArchive, err := build.NewPlanArchive("data.tar.xz", pkg.FSRoot, nil)
+	if err != nil {
+		return nil, err
+	}
+	plan.Archives = []build.PlanArchive{controlArchive, dataArchive}
+
+	g.plan = plan
+	g.controlDir = controlDir
+	return plan, nil
+}
+
+//Render implements the build.Planner interface.
+func (g *Generator) Render(plan *build.Plan) ([]byte, error) {
+	//prepare the package (if not done yet) to have the file contents ready
+	_, err := g.Plan()
+	if err != nil {
+		return nil, err
+	}
+	if plan.Format != "debian" {
+		return nil, fmt.Errorf("cannot render a plan for format \"%s\" as a Debian package", plan.Format)
+	}
+	compression := g.compression()
+	controlArchive, err := plan.Archive(compression.memberName("control"))
+	if err != nil {
+		return nil, err
+	}
+	dataArchive, err := plan.Archive("data.tar.xz")
+	if err != nil {
+		return nil, err
+	}
+
+	//the control file is rendered from the metadata values in the plan (the
+	//other control files are taken as they are, like the package contents)
+	controlFiles := g.controlDir.ShallowCopy()
+	controlFiles.Entries["control"] = &filesystem.RegularFile{
+		Content:  []byte(renderControlFile(plan.Metadata)),
+		Metadata: filesystem.NodeMetadata{Mode: 0644},
+	}
+	controlDir, err := controlArchive.ToDirectory(controlFiles, "/control")
+	if err != nil {
+		return nil, err
+	}
+	pkg := g.Package
+	dataDir, err := dataArchive.ToDirectory(pkg.FSRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	//compress data.tar.xz
+	var dataTar bytes.Buffer
+	endPhase := pkg.BeginPhase(build.PhaseCompress)
+	//dpkg cannot unpack PAX records, so large IDs and long link targets need
+	//to be encoded with GNU extensions
+	err = filesystem.CompressWithProgram(&dataTar, func(w io.Writer) error {
+		return dataDir.ToTarArchiveWithFormat(w, true, false, filesystem.TarFormatGNU)
+	}, "xz", filesystem.XZArguments(g.Jobs)...)
+	endPhase()
+	if err != nil {
+		return nil, err
+	}
+
+	var controlTar bytes.Buffer
+	err = compression.writeTarArchive(&controlTar, controlDir)
+	if err != nil {
+		return nil, err
+	}
+
+	//build ar archive
+	return buildArArchive([]arArchiveEntry{
+		{"debian-binary", []byte("2.0\n")},
+		{compression.memberName("control"), controlTar.Bytes()},
+		{"data.tar.xz", dataTar.Bytes()},
+	})
+}
+
+//renderControlFile renders the control file from the metadata values of a
+//build.Plan (see Plan()).
+func renderControlFile(values []build.PlanValue) string {
+	var b strings.Builder
+	for _, value := range values {
+		fmt.Fprintf(&b, "%s: %s\n", value.Key, value.Value)
+	}
+	return b.String()
+}
+
+func (g *Generator) compression() Compression {
+	if g.ControlCompression == "" {
+		return CompressionGZip
+	}
+	return g.ControlCompression
+}
+
+//ControlFile returns the contents of the control file in the package's
+//control.tar, e.g. for building the index of a repository. It should only be
+//called after Build().
+func (g *Generator) ControlFile() (string, error) {
+	return makeControlFile(g.Package)
+}
+
+func makeControlFile(pkg *build.Package) (string, error) {
+	//reference for this file:
+	//https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-binarycontrolfiles
+	contents := fmt.Sprintf("Package: %s\n", pkg.Name)
+	if pkg.Debian.Essential {
+		contents += "Essential: yes\n"
+	}
+	if pkg.Debian.Protected {
+		contents += "Protected: yes\n"
+	}
+	contents += fmt.Sprintf("Version: %s\n", fullVersionString(pkg))
+	contents += fmt.Sprintf("Architecture: %s\n", archMap[pkg.Architecture])
+	if pkg.Debian.MultiArch != "" {
+		contents += fmt.Sprintf("Multi-Arch: %s\n", pkg.Debian.MultiArch)
+	}
+	contents += fmt.Sprintf("Maintainer: %s\n", pkg.Author)
+	contents += fmt.Sprintf("Installed-Size: %d\n", pkg.FSRoot.InstalledSizeInBytes()/1024) // convert bytes to KiB
+	contents += "Section: misc\n"
+	contents += "Priority: optional\n"
+
+	//compile relations
+	rels, err := compilePackageRelations("Depends", pkg.Requires)
+	if err != nil {
+		return "", err
+	}
+	contents += rels
+
+	rels, err = compilePackageRelations("Provides", pkg.Provides)
+	if err != nil {
+		return "", err
+	}
+	contents += rels
+
+	rels, err = compilePackageRelations("Conflicts", pkg.Conflicts)
+	if err != nil {
+		return "", err
+	}
+	contents += rels
+
+	rels, err = compilePackageRelations("Replaces", pkg.Replaces)
+	if err != nil {
+		return "", err
+	}
+	contents += rels
+
+	//we have only one description field, which we use both as the synopsis and the extended description
+	desc := strings.TrimSpace(strings.Replace(pkg.Description, "\n", " ", -1))
+	if desc == "" {
+		desc = strings.TrimSpace(pkg.Name) //description field is strictly required
+	}
+	contents += fmt.Sprintf("Description: %s\n %s\n", desc, desc)
+	return contents, nil
+}
+
+func compilePackageRelations(relType string, rels []build.PackageRelation) (string, error) {
+	if len(rels) == 0 {
+		return "", nil
+	}
+
+	entries := make([]string, 0, len(rels))
+	//foreach related package...
+	for _, rel := range rels {
+		name := rel.RelatedPackage
+
+		//...compile constraints into a list like ">= 2.4, << 3.0" (operators "<" and ">" become "<<" and ">>" here)
+		if len(rel.Constraints) > 0 {
+			for _, c := range rel.Constraints {
+				operator := c.Relation
+				if operator == "<" {
+					operator = "<<"
+				}
+				if operator == ">" {
+					operator = ">>"
+				}
+				entries = append(entries, fmt.Sprintf("%s (%s %s)", name, operator, c.Version))
+			}
+		} else {
+			entries = append(entries, name)
+		}
+	}
+
+	return fmt.Sprintf("%s: %s\n", relType, strings.Join(entries, ", ")), nil
+}
+
+func makeMD5SumsFile(pkg *build.Package) (string, error) {
+	//calculate MD5 sums for all regular files in this package
+	var lines []string
+	err := pkg.WalkFSWithRelativePaths(func(path string, node filesystem.Node) error {
+		file, ok := node.(*filesystem.RegularFile)
+		if !ok {
+			return nil //look only at regular files
+		}
+		digest, err := file.MD5Digest()
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s\n", digest, path))
+		return nil
+	})
+	return strings.Join(lines, ""), err
+}
+
+//the members of a Debian package must appear in exactly this order, otherwise
+//dpkg-deb will reject the package
+var arMemberOrder = []string{"debian-binary", "control.tar", "data.tar"}
+
+func validateArMemberOrder(entries []arArchiveEntry) error {
+	if len(entries) != len(arMemberOrder) {
+		return fmt.Errorf("expected %d ar archive members, got %d", len(arMemberOrder), len(entries))
+	}
+	for idx, entry := range entries {
+		if entry.Name != arMemberOrder[idx] && !strings.HasPrefix(entry.Name, arMemberOrder[idx]+".") {
+			return fmt.Errorf("expected ar archive member %d to be %s, got %s", idx, arMemberOrder[idx], entry.Name)
+		}
+	}
+	return nil
+}
+
+const maxArMemberSize = 9999999999
+
+func buildArArchive(entries []arArchiveEntry) ([]byte, error) {
+	err := validateArMemberOrder(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	//we only need a very small subset of the ar archive format, so we can
+	//directly construct it without requiring an extra library
+	buf := bytes.NewBuffer([]byte("!<arch>\n"))
+
+	//most fields are static
+	headerFormat := "%-16s"
+	headerFormat += "0           " //modification time = UNIX timestamp 0 (for reproducability)
+	headerFormat += "0     "       //owner ID = root
+	headerFormat += "0     "       //group ID = root
+	headerFormat += "100644  "     //file mode = regular file, rw-r--r--
+	headerFormat += "%-10d"        //file size in bytes
+	headerFormat += "\x60\n"       //magic header separator
+
+	for _, entry := range entries {
+		//dpkg does not understand the GNU or BSD extensions for long names, so
+		//names must fit into the 16-byte name field; they also must not
+		//contain spaces (which would be mistaken for padding) or slashes
+		//(which GNU ar uses as name terminator)
+		if entry.Name == "" || len(entry.Name) > 16 || strings.ContainsAny(entry.Name, " /\n") {
+			return nil, fmt.Errorf("invalid ar archive member name: %q", entry.Name)
+		}
+		//the size field has 10 decimal digits
+		if int64(len(entry.Data)) > maxArMemberSize {
+			return nil, fmt.Errorf("ar archive member %s is too large (%d bytes, but at most %d bytes are allowed)", entry.Name, len(entry.Data), maxArMemberSize)
+		}
+
+		fmt.Fprintf(buf, headerFormat, entry.Name, len(entry.Data))
+		buf.Write(entry.Data)
+		//pad data to 2-byte boundary
+		if len(entry.Data)%2 == 1 {
+			buf.Write([]byte{'\n'})
+		}
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,135 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package debian
+
+import (
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//maintainerScript describes the skeleton of one of the maintainer scripts
+//that dpkg calls during installation, upgrade and removal. Reference:
+//https://www.debian.org/doc/debian-policy/ch-maintainerscripts.html
+type maintainerScript struct {
+	Name string
+	//ActionType selects the package's actions that go into this script.
+	ActionType uint
+	//ActionArgs are the values of $1 for which the actions are run. For
+	//example, dpkg calls postrm with "upgrade" during an upgrade, where the
+	//cleanup actions must not run.
+	ActionArgs []string
+	//Prologue (optional) returns shell code that runs before the actions,
+	//regardless of $1.
+	Prologue func(pkg *build.Package) string
+	//Epilogue (optional) returns shell code that runs after the actions,
+	//regardless of $1. This is where generated snippets go; they need to check
+	//$1 themselves.
+	Epilogue func(pkg *build.Package) string
+}
+
+//maintainerScripts lists the maintainer scripts in the order in which dpkg
+//runs them. The arguments are chosen such that each action runs exactly once
+//per installation, upgrade or removal, like on the other package formats.
+var maintainerScripts = []maintainerScript{
+	{
+		Name:       "preinst",
+		ActionType: build.PreSetupAction,
+		ActionArgs: []string{"install", "upgrade"},
+	},
+	{
+		Name:       "postinst",
+		ActionType: build.SetupAction,
+		ActionArgs: []string{"configure"},
+		Prologue:   triggersPostinst,
+		Epilogue: func(pkg *build.Package) string {
+			return joinSnippets(alternativesPostinst(pkg), servicesPostinst(pkg))
+		},
+	},
+	{
+		Name:       "prerm",
+		ActionType: build.PreCleanupAction,
+		ActionArgs: []string{"remove"},
+		Epilogue: func(pkg *build.Package) string {
+			return joinSnippets(servicesPrerm(pkg), alternativesPrerm(pkg))
+		},
+	},
+	{
+		Name:       "postrm",
+		ActionType: build.CleanupAction,
+		//not "purge": dpkg calls postrm with "remove" before "purge"
+		ActionArgs: []string{"remove"},
+		Epilogue: func(pkg *build.Package) string {
+			return joinSnippets(servicesPostrm(pkg), debconfPostrm(pkg))
+		},
+	},
+}
+
+//writeMaintainerScripts writes all maintainer scripts that have any content
+//into the control directory.
+func writeMaintainerScripts(pkg *build.Package, controlDir *filesystem.Directory) {
+	for _, script := range maintainerScripts {
+		content := script.Render(pkg)
+		if content == "" {
+			continue
+		}
+		controlDir.Entries[script.Name] = &filesystem.RegularFile{
+			Content:  []byte(content),
+			Metadata: filesystem.NodeMetadata{Mode: 0755},
+		}
+	}
+}
+
+//Render returns the contents of this maintainer script for the given package,
+//or "" if the script would not do anything. The script aborts on the first
+//failing command (as required by the Debian policy), and runs the package's
+//actions only if it was called with one of the ActionArgs.
+//
+//The actions are always run by bash, since the skeleton needs a shell. Actions
+//with a different interpreter are wrapped accordingly (see Package.Script).
+func (s maintainerScript) Render(pkg *build.Package) string {
+	var parts []string
+	if s.Prologue != nil {
+		if prologue := s.Prologue(pkg); prologue != "" {
+			parts = append(parts, prologue)
+		}
+	}
+	if actions := pkg.Script(s.ActionType); actions != "" {
+		conditions := make([]string, len(s.ActionArgs))
+		for idx, arg := range s.ActionArgs {
+			conditions[idx] = fmt.Sprintf(`[ "$1" = %s ]`, arg)
+		}
+		//the actions are not indented, because that would break their
+		//here-documents
+		parts = append(parts, fmt.Sprintf("if %s; then\n%s\nfi", strings.Join(conditions, " || "), actions))
+	}
+	if s.Epilogue != nil {
+		if epilogue := s.Epilogue(pkg); epilogue != "" {
+			parts = append(parts, epilogue)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+
+	return "#!/bin/bash\nset -e\n\n" + strings.Join(parts, "\n\n") + "\n\nexit 0\n"
+}
@@ -0,0 +1,140 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package debian
+
+import (
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//The snippets in this file follow the maintainer script snippets that
+//dh_installsystemd generates.
+
+//servicesPostinst returns the postinst snippet for the package's systemd
+//units, or "" if there are none.
+func servicesPostinst(pkg *build.Package) string {
+	if len(pkg.Services) == 0 {
+		return ""
+	}
+
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	add(`if [ "$1" = configure ] || [ "$1" = abort-upgrade ] || [ "$1" = abort-deconfigure ] || [ "$1" = abort-remove ]; then`)
+	for _, svc := range pkg.Services {
+		add("    deb-systemd-helper unmask '%s' >/dev/null || true", svc.Unit)
+		if svc.Enable {
+			//was-enabled is true on first installation, and otherwise
+			//respects the administrator's decision to disable the unit
+			add("    if deb-systemd-helper --quiet was-enabled '%s'; then", svc.Unit)
+			add("        deb-systemd-helper enable '%s' >/dev/null || true", svc.Unit)
+			add("    else")
+			add("        deb-systemd-helper update-state '%s' >/dev/null || true", svc.Unit)
+			add("    fi")
+		} else {
+			add("    deb-systemd-helper update-state '%s' >/dev/null || true", svc.Unit)
+		}
+	}
+	add("    if [ -d /run/systemd/system ]; then")
+	add("        systemctl --system daemon-reload >/dev/null || true")
+	for _, svc := range pkg.Services {
+		//$2 is the previously configured version, i.e. empty on first installation
+		switch {
+		case svc.Enable && svc.RestartOnUpgrade:
+			add(`        if [ -z "$2" ]; then`)
+			add("            deb-systemd-invoke start '%s' >/dev/null || true", svc.Unit)
+			add("        else")
+			add("            deb-systemd-invoke try-restart '%s' >/dev/null || true", svc.Unit)
+			add("        fi")
+		case svc.Enable:
+			add(`        if [ -z "$2" ]; then`)
+			add("            deb-systemd-invoke start '%s' >/dev/null || true", svc.Unit)
+			add("        fi")
+		case svc.RestartOnUpgrade:
+			add(`        if [ -n "$2" ]; then`)
+			add("            deb-systemd-invoke try-restart '%s' >/dev/null || true", svc.Unit)
+			add("        fi")
+		}
+	}
+	add("    fi")
+	add("fi")
+	return strings.Join(lines, "\n")
+}
+
+//servicesPrerm returns the prerm snippet for the package's systemd units, or
+//"" if there are none.
+func servicesPrerm(pkg *build.Package) string {
+	if len(pkg.Services) == 0 {
+		return ""
+	}
+
+	lines := []string{`if [ -d /run/systemd/system ] && [ "$1" = remove ]; then`}
+	for _, svc := range pkg.Services {
+		lines = append(lines, fmt.Sprintf("    deb-systemd-invoke stop '%s' >/dev/null || true", svc.Unit))
+	}
+	lines = append(lines, "fi")
+	return strings.Join(lines, "\n")
+}
+
+//servicesPostrm returns the postrm snippet for the package's systemd units, or
+//"" if there are none.
+func servicesPostrm(pkg *build.Package) string {
+	if len(pkg.Services) == 0 {
+		return ""
+	}
+
+	lines := []string{
+		"if [ -d /run/systemd/system ]; then",
+		"    systemctl --system daemon-reload >/dev/null || true",
+		"fi",
+		//on purge, deb-systemd-helper may already have been removed
+		"if [ -x /usr/bin/deb-systemd-helper ]; then",
+		`    if [ "$1" = remove ]; then`,
+	}
+	for _, svc := range pkg.Services {
+		lines = append(lines, fmt.Sprintf("        deb-systemd-helper mask '%s' >/dev/null || true", svc.Unit))
+	}
+	lines = append(lines, `    elif [ "$1" = purge ]; then`)
+	for _, svc := range pkg.Services {
+		lines = append(lines,
+			fmt.Sprintf("        deb-systemd-helper purge '%s' >/dev/null || true", svc.Unit),
+			fmt.Sprintf("        deb-systemd-helper unmask '%s' >/dev/null || true", svc.Unit),
+		)
+	}
+	lines = append(lines, "    fi", "fi")
+	return strings.Join(lines, "\n")
+}
+
+//addServicesDependency adds a dependency on the package that provides
+//deb-systemd-helper, if the package has systemd units.
+func addServicesDependency(pkg *build.Package) {
+	if len(pkg.Services) == 0 {
+		return
+	}
+	for _, rel := range pkg.Requires {
+		if rel.RelatedPackage == "init-system-helpers" {
+			return
+		}
+	}
+	pkg.Requires = append(pkg.Requires, build.PackageRelation{RelatedPackage: "init-system-helpers"})
+}
@@ -0,0 +1,76 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package debian
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//Debian packages do not use Provides entries for shared libraries. Instead,
+//the "shlibs" control file tells dpkg-shlibdeps which package (and which
+//version of it) other packages need to depend on when they link against one
+//of the package's libraries. There is no equivalent for pkg-config files.
+//Reference: https://www.debian.org/doc/debian-policy/ch-sharedlibs.html
+
+var (
+	//matches "libfoo.so.1" and "libfoo.so.1.2"
+	sonameWithSuffixVersionRx = regexp.MustCompile(`^(.+)\.so\.([^/]+)$`)
+	//matches "libfoo-1.2.so"
+	sonameWithInfixVersionRx = regexp.MustCompile(`^(.+)-([0-9][^/-]*)\.so$`)
+)
+
+//makeShlibsFile returns the "shlibs" control file for the package's shared
+//libraries, or "" if there are none (see build.Package.SharedLibraries).
+func makeShlibsFile(pkg *build.Package) (string, error) {
+	libs, err := pkg.SharedLibraries()
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	seen := make(map[string]bool)
+	for _, lib := range libs {
+		name, version := splitSOName(lib.SOName)
+		if name == "" || seen[lib.SOName] {
+			continue
+		}
+		seen[lib.SOName] = true
+		lines = append(lines, fmt.Sprintf("%s %s %s (>= %s)\n", name, version, pkg.Name, fullVersionString(pkg)))
+	}
+	return strings.Join(lines, ""), nil
+}
+
+//splitSOName splits a SONAME into the library name and version in the same
+//way as dpkg-shlibdeps, e.g. "libfoo.so.1" into "libfoo" and "1", or
+//"libfoo-1.2.so" into "libfoo" and "1.2". For SONAMEs without a version,
+//empty strings are returned.
+func splitSOName(soname string) (name, version string) {
+	if match := sonameWithSuffixVersionRx.FindStringSubmatch(soname); match != nil {
+		return match[1], match[2]
+	}
+	if match := sonameWithInfixVersionRx.FindStringSubmatch(soname); match != nil {
+		return match[1], match[2]
+	}
+	return "", ""
+}
@@ -0,0 +1,79 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package debian
+
+import (
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//triggerNames returns the dpkg trigger names that activate the given trigger.
+//dpkg does not have triggers for package names, so these are approximated by
+//the package's documentation directory, which every Debian package contains.
+func triggerNames(trigger build.PackageTrigger) []string {
+	names := append([]string(nil), trigger.Paths...)
+	for _, pkgName := range trigger.Packages {
+		names = append(names, "/usr/share/doc/"+pkgName)
+	}
+	return names
+}
+
+//makeTriggersFile returns the "triggers" control file that declares the
+//package's interest in the trigger names, or "" if the package has no
+//triggers.
+func makeTriggersFile(pkg *build.Package) (string, error) {
+	var (
+		interests []string
+		seen      = make(map[string]bool)
+	)
+	for _, trigger := range pkg.Triggers {
+		for _, name := range triggerNames(trigger) {
+			if !seen[name] {
+				seen[name] = true
+				interests = append(interests, "interest-noawait "+name+"\n")
+			}
+		}
+	}
+	return strings.Join(interests, ""), nil
+}
+
+//triggersPostinst returns the postinst snippet that runs the trigger scripts
+//when dpkg calls postinst with "triggered" (and exits afterwards, so that the
+//rest of postinst only runs for the other arguments), or "" if the package
+//has no triggers.
+func triggersPostinst(pkg *build.Package) string {
+	if len(pkg.Triggers) == 0 {
+		return ""
+	}
+
+	script := "if [ \"$1\" = triggered ]; then\n"
+	for _, trigger := range pkg.Triggers {
+		names := triggerNames(trigger)
+		patterns := make([]string, len(names))
+		for idx, name := range names {
+			//$2 is a space-separated list of the activated trigger names
+			patterns[idx] = fmt.Sprintf(`*" %s "*`, name)
+		}
+		script += fmt.Sprintf("    case \" $2 \" in %s)\n%s\n    ;;\n    esac\n", strings.Join(patterns, "|"), trigger.Script())
+	}
+	return script + "    exit 0\nfi"
+}
@@ -0,0 +1,106 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package elfinfo extracts the metadata from ELF binaries and shared libraries
+//that generators need to compute automatic package relations.
+package elfinfo
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+//Info contains the metadata of an ELF file.
+type Info struct {
+	//Is64Bit is true for ELFCLASS64 files, and false for ELFCLASS32 files.
+	Is64Bit bool
+	//SOName is the DT_SONAME entry of a shared library (e.g. "libfoo.so.1"),
+	//or empty if the file does not have one.
+	SOName string
+	//Interpreter is the program interpreter from the PT_INTERP header of a
+	//dynamically linked executable (e.g. "/lib64/ld-linux-x86-64.so.2"), or
+	//empty if the file does not have one.
+	Interpreter string
+	//Needed contains the DT_NEEDED entries, i.e. the SONAMEs of the shared
+	//libraries that the file is linked against (e.g. "libc.so.6").
+	Needed []string
+}
+
+//magic is the start of every ELF file.
+var magic = []byte(elf.ELFMAG)
+
+//IsELF checks whether the given file contents start with the ELF magic
+//number.
+func IsELF(header []byte) bool {
+	return bytes.HasPrefix(header, magic)
+}
+
+//Inspect reads the ELF file from the given reader. If the contents are not an
+//ELF file at all, (nil, nil) is returned. Malformed ELF files result in an
+//error.
+func Inspect(r io.Reader) (*Info, error) {
+	//check the magic number before reading everything into memory
+	header := make([]byte, len(magic))
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && !IsELF(header)) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(append(header[:n], rest...)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := &Info{Is64Bit: f.Class == elf.ELFCLASS64}
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP {
+			interp, err := ioutil.ReadAll(prog.Open())
+			if err != nil {
+				return nil, err
+			}
+			info.Interpreter = strings.TrimRight(string(interp), "\x00")
+		}
+	}
+	//statically linked executables do not have a dynamic section
+	if f.Section(".dynamic") != nil {
+		sonames, err := f.DynString(elf.DT_SONAME)
+		if err != nil {
+			return nil, err
+		}
+		if len(sonames) > 0 {
+			info.SOName = sonames[0]
+		}
+		info.Needed, err = f.DynString(elf.DT_NEEDED)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
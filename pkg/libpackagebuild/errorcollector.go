@@ -59,3 +59,14 @@ func (c *errorCollector) Addf(format string, args ...interface{}) {
 		c.Errors = append(c.Errors, errors.New(format))
 	}
 }
+
+//addValidationError adds a ValidationError with SeverityError to this
+//collector. The message is formatted like for Addf().
+func (c *errorCollector) addValidationError(field, path, formatName, format string, args ...interface{}) {
+	c.Errors = append(c.Errors, &ValidationError{
+		Field:   field,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+		Format:  formatName,
+	})
+}
@@ -0,0 +1,125 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package filesystem
+
+import "fmt"
+
+//ConflictPolicy is an argument for Directory.Merge that decides what happens
+//when both directory trees contain an entry at the same path.
+type ConflictPolicy int
+
+const (
+	//ConflictError makes Directory.Merge fail on the first conflicting entry.
+	ConflictError ConflictPolicy = iota
+	//ConflictKeepFirst keeps the entry from the directory that is being
+	//merged into, and discards the conflicting entry from the other one.
+	ConflictKeepFirst
+	//ConflictOverwrite replaces the entry from the directory that is being
+	//merged into with the conflicting entry from the other one.
+	ConflictOverwrite
+	//ConflictMergeDirectories merges the contents of directories that exist
+	//in both trees recursively (keeping the metadata of the first one), but
+	//fails on all other conflicts.
+	ConflictMergeDirectories
+)
+
+func (p ConflictPolicy) String() string {
+	switch p {
+	case ConflictError:
+		return "error"
+	case ConflictKeepFirst:
+		return "keep-first"
+	case ConflictOverwrite:
+		return "overwrite"
+	case ConflictMergeDirectories:
+		return "merge-directories"
+	default:
+		return fmt.Sprintf("ConflictPolicy(%d)", int(p))
+	}
+}
+
+//ParseConflictPolicy is the inverse of ConflictPolicy.String().
+func ParseConflictPolicy(input string) (ConflictPolicy, error) {
+	for _, p := range []ConflictPolicy{ConflictError, ConflictKeepFirst, ConflictOverwrite, ConflictMergeDirectories} {
+		if p.String() == input {
+			return p, nil
+		}
+	}
+	return ConflictError, fmt.Errorf("unknown conflict policy: %q", input)
+}
+
+//Merge moves all entries from the `other` directory tree into this one. The
+//`other` tree must not be used anymore afterwards. The metadata of this
+//directory itself is not changed.
+//
+//Implicitly created directories (see Directory.Implicit) never conflict with
+//other directories: Their contents are merged recursively, and an explicit
+//directory's metadata wins over an implicit one's. All other entries that
+//exist in both trees are resolved according to the given policy.
+//
+//If an error is returned, it names the conflicting path (relative to this
+//directory, but with a leading slash), and this directory is unchanged.
+func (d *Directory) Merge(other *Directory, policy ConflictPolicy) error {
+	//check for conflicts before changing anything
+	err := d.merge(other, policy, "", false)
+	if err != nil {
+		return err
+	}
+	return d.merge(other, policy, "", true)
+}
+
+func (d *Directory) merge(other *Directory, policy ConflictPolicy, location string, apply bool) error {
+	//process entries in sorted order to report conflicts reproducibly
+	for _, name := range other.sortedNames() {
+		path := location + "/" + name
+		entryOld, exists := d.Entries[name]
+		entryNew := other.Entries[name]
+		if !exists {
+			if apply {
+				d.Entries[name] = entryNew
+			}
+			continue
+		}
+
+		dirOld, ok1 := entryOld.(*Directory)
+		dirNew, ok2 := entryNew.(*Directory)
+		bothDirs := ok1 && ok2
+		switch {
+		case bothDirs && (dirOld.Implicit || dirNew.Implicit || policy == ConflictMergeDirectories):
+			if apply && dirOld.Implicit && !dirNew.Implicit {
+				dirOld.Metadata = dirNew.Metadata
+				dirOld.Implicit = false
+			}
+			err := dirOld.merge(dirNew, policy, path, apply)
+			if err != nil {
+				return err
+			}
+		case policy == ConflictKeepFirst:
+			//nothing to do
+		case policy == ConflictOverwrite:
+			if apply {
+				d.Entries[name] = entryNew
+			}
+		default:
+			return fmt.Errorf("cannot merge %s: duplicate entry", path)
+		}
+	}
+	return nil
+}
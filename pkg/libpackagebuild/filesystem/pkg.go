@@ -22,14 +22,17 @@
 package filesystem
 
 import (
+	"bytes"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"sort"
+	"time"
 )
 
 //Node instances represent an entry in the file system (such as a file or a
@@ -45,10 +48,13 @@ type Node interface {
 	//InstalledSizeInBytes approximates the apparent size of the given
 	//directory and everything in it, as calculated by `du -s --apparent-size`,
 	//but in a filesystem-independent way.
-	InstalledSizeInBytes() int
+	InstalledSizeInBytes() int64
 	//FileModeForArchive returns the file mode of this Node as stored in a
 	//tar or CPIO archive.
 	FileModeForArchive(includingFileType bool) uint32
+	//ModTime returns the modification time of this Node as stored in a tar or
+	//CPIO archive.
+	ModTime() time.Time
 	//Walk visits all the nodes below this Node (including itself) and calls
 	//the given callback at each node. It is guaranteed that the callback for a
 	//node is called after the callback of its parent node (if any).
@@ -85,6 +91,9 @@ type NodeMetadata struct {
 	Mode  os.FileMode
 	Owner *IntOrString
 	Group *IntOrString
+	//MTime is the modification time of the node. If not set, the UNIX epoch
+	//is used (for reproducability).
+	MTime time.Time
 }
 
 //UID returns Owner.Int if it is set.
@@ -103,11 +112,20 @@ func (m *NodeMetadata) GID() uint32 {
 	return 0
 }
 
+//ModTime returns MTime if it is set, or the UNIX epoch otherwise.
+func (m *NodeMetadata) ModTime() time.Time {
+	if m.MTime.IsZero() {
+		return time.Unix(0, 0)
+	}
+	return m.MTime
+}
+
 //PostponeUnmaterializable generates an addition to the package's setup script
 //to handle metadata at install-time that cannot be materialized at build-time
 //(namely owners/groups identified by name which cannot be resolved into
-//numeric IDs at build time).
-func (m *NodeMetadata) postponeUnmaterializable(path string) (additionalSetupScript string) {
+//numeric IDs at build time). For symlinks, the generated commands change the
+//ownership of the link itself rather than that of its target.
+func (m *NodeMetadata) postponeUnmaterializable(path string, isSymlink bool) (additionalSetupScript string) {
 	var ownerStr, groupStr string
 	if m.Owner != nil && m.Owner.Str != "" {
 		ownerStr = m.Owner.Str
@@ -118,14 +136,19 @@ func (m *NodeMetadata) postponeUnmaterializable(path string) (additionalSetupScr
 		m.Group = nil
 	}
 
+	flags := ""
+	if isSymlink {
+		flags = "-h "
+	}
+
 	if ownerStr != "" {
 		if groupStr != "" {
-			return fmt.Sprintf("chown %s:%s %s\n", ownerStr, groupStr, path)
+			return fmt.Sprintf("chown %s%s:%s %s\n", flags, ownerStr, groupStr, path)
 		}
-		return fmt.Sprintf("chown %s %s\n", ownerStr, path)
+		return fmt.Sprintf("chown %s%s %s\n", flags, ownerStr, path)
 	}
 	if groupStr != "" {
-		return fmt.Sprintf("chgrp %s %s\n", groupStr, path)
+		return fmt.Sprintf("chgrp %s%s %s\n", flags, groupStr, path)
 	}
 	return ""
 }
@@ -193,10 +216,23 @@ func (d *Directory) Insert(entry Node, relPath []string, location string) error
 	return subdir.Insert(entry, relPath[1:], location+"/"+subname)
 }
 
+//ShallowCopy returns a copy of this directory that shares its entries with
+//this directory. Entries can be added, replaced or removed in the copy without
+//affecting this directory (but changes to the entries themselves are visible
+//in both).
+func (d *Directory) ShallowCopy() *Directory {
+	result := *d
+	result.Entries = make(map[string]Node, len(d.Entries))
+	for name, entry := range d.Entries {
+		result.Entries[name] = entry
+	}
+	return &result
+}
+
 //InstalledSizeInBytes implements the Node interface.
-func (d *Directory) InstalledSizeInBytes() int {
+func (d *Directory) InstalledSizeInBytes() int64 {
 	//sum over all entries
-	sum := 0
+	var sum int64
 	for _, entry := range d.Entries {
 		sum += entry.InstalledSizeInBytes()
 	}
@@ -212,6 +248,11 @@ func (d *Directory) FileModeForArchive(includingFileType bool) uint32 {
 	return uint32(d.Metadata.Mode) & 07777
 }
 
+//ModTime implements the Node interface.
+func (d *Directory) ModTime() time.Time {
+	return d.Metadata.ModTime()
+}
+
 //Walk implements the Node interface.
 func (d *Directory) Walk(absolutePath string, callback func(string, Node) error) error {
 	err := callback(absolutePath, d)
@@ -223,23 +264,8 @@ func (d *Directory) Walk(absolutePath string, callback func(string, Node) error)
 	}
 
 	//walk through entries in reproducible, sorted order
-	names := make([]string, 0, len(d.Entries))
-	for name := range d.Entries {
-		names = append(names, name)
-	}
-	sort.Strings(names)
-	for _, name := range names {
-		entry := d.Entries[name]
-		var nextPath string
-		switch absolutePath {
-		case "":
-			nextPath = name
-		case "/":
-			nextPath = "/" + name
-		default:
-			nextPath = absolutePath + "/" + name
-		}
-		err = entry.Walk(nextPath, callback)
+	for _, name := range d.sortedNames() {
+		err = d.Entries[name].Walk(joinPath(absolutePath, name), callback)
 		if err != nil && err != filepath.SkipDir {
 			return err
 		}
@@ -249,7 +275,7 @@ func (d *Directory) Walk(absolutePath string, callback func(string, Node) error)
 
 //PostponeUnmaterializable implements the Node interface.
 func (d *Directory) PostponeUnmaterializable(absolutePath string) string {
-	script := d.Metadata.postponeUnmaterializable(absolutePath)
+	script := d.Metadata.postponeUnmaterializable(absolutePath, false)
 
 	d.Walk(absolutePath, func(path string, node Node) error {
 		if node == d {
@@ -267,8 +293,78 @@ func (d *Directory) PostponeUnmaterializable(absolutePath string) string {
 
 //RegularFile is a type of Node that represents regular files.
 type RegularFile struct {
-	Content  string
-	Metadata NodeMetadata
+	Content []byte
+	//If ContentProvider is not nil, it is used to obtain the file's contents
+	//instead of Content. This allows to read large files only when the
+	//package is built, rather than keeping them in memory.
+	ContentProvider ContentProvider
+	Metadata        NodeMetadata
+	//Documentation and License mark this file as documentation or as a
+	//license text, for generators whose package format can record that (e.g.
+	//the %doc and %license flags in RPM).
+	Documentation bool
+	License       bool
+	//Config marks this file as a configuration file whose local modifications
+	//are preserved on upgrade (e.g. conffiles in Debian, %config in RPM).
+	Config bool
+	//Sensitive marks this file as containing secrets. It is packaged like any
+	//other file, but descriptions of the package (see build.Plan) only
+	//contain its size and checksum, and mark it as sensitive.
+	Sensitive bool
+	//VerifyAttributes lists the attributes of this file that are checked when
+	//the installed package is verified (e.g. with `rpm -V`): "digest", "size",
+	//"link", "owner", "group", "mtime", "mode", "rdev" and "caps". If nil, all
+	//attributes are checked.
+	VerifyAttributes []string
+	digestCache      *digestCache
+}
+
+//ContentProvider lazily supplies the contents of a RegularFile. Each call
+//returns a new reader for the contents (which the caller must close), and the
+//size of the contents in bytes.
+type ContentProvider func() (io.ReadCloser, int64, error)
+
+//NewFileContentProvider returns a ContentProvider that reads the file at the
+//given path. The file's size is determined immediately, so that errors like
+//a missing file are reported right away instead of when the package is
+//built.
+//
+//Only regular files are read lazily. Everything else (e.g. character devices
+//or named pipes) does not have a meaningful size, and is therefore read into
+//memory immediately.
+func NewFileContentProvider(path string) (ContentProvider, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return func() (io.ReadCloser, int64, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+		}, nil
+	}
+	size := fi.Size()
+
+	return func() (io.ReadCloser, int64, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		//detect if the file was changed since we looked at it (otherwise
+		//the archive writers would produce corrupted output)
+		fi, err := file.Stat()
+		if err == nil && fi.Size() != size {
+			err = fmt.Errorf("%s has changed size from %d to %d bytes during the build", path, size, fi.Size())
+		}
+		if err != nil {
+			file.Close()
+			return nil, 0, err
+		}
+		return file, size, nil
+	}, nil
 }
 
 //Insert implements the Node interface.
@@ -280,8 +376,8 @@ func (f *RegularFile) Insert(entry Node, relPath []string, location string) erro
 }
 
 //InstalledSizeInBytes implements the Node interface.
-func (f *RegularFile) InstalledSizeInBytes() int {
-	return len(f.Content)
+func (f *RegularFile) InstalledSizeInBytes() int64 {
+	return f.ContentSize()
 }
 
 //FileModeForArchive implements the Node interface.
@@ -292,6 +388,11 @@ func (f *RegularFile) FileModeForArchive(includingFileType bool) uint32 {
 	return uint32(f.Metadata.Mode) & 07777
 }
 
+//ModTime implements the Node interface.
+func (f *RegularFile) ModTime() time.Time {
+	return f.Metadata.ModTime()
+}
+
 //Walk implements the Node interface.
 func (f *RegularFile) Walk(absolutePath string, callback func(string, Node) error) error {
 	return callback(absolutePath, f)
@@ -299,38 +400,130 @@ func (f *RegularFile) Walk(absolutePath string, callback func(string, Node) erro
 
 //PostponeUnmaterializable implements the Node interface.
 func (f *RegularFile) PostponeUnmaterializable(absolutePath string) string {
-	return f.Metadata.postponeUnmaterializable(absolutePath)
+	return f.Metadata.postponeUnmaterializable(absolutePath, false)
 }
 
-//MD5Digest returns the MD5 digest of this file's contents.
-func (f *RegularFile) MD5Digest() string {
-	//the following is equivalent to sum := md5.Sum([]byte(f.Content)),
-	//but also is backwards-compatible to Go 1.1
-	digest := md5.New()
-	digest.Write([]byte(f.Content))
-	sum := digest.Sum(nil)
+//ContentSize returns the size of this file's contents in bytes.
+func (f *RegularFile) ContentSize() int64 {
+	if f.ContentProvider == nil {
+		return int64(len(f.Content))
+	}
+	r, size, err := f.ContentProvider()
+	if err != nil {
+		return 0 //the error will be reported by OpenContent()
+	}
+	r.Close()
+	return size
+}
+
+//OpenContent returns a reader for this file's contents. The caller must close
+//the reader when done.
+func (f *RegularFile) OpenContent() (io.ReadCloser, error) {
+	if f.ContentProvider == nil {
+		return ioutil.NopCloser(bytes.NewReader(f.Content)), nil
+	}
+	r, _, err := f.ContentProvider()
+	return r, err
+}
+
+//copyContentTo streams this file's contents into the given writer.
+func (f *RegularFile) copyContentTo(w io.Writer) error {
+	r, err := f.OpenContent()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	closeErr := r.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
 
-	return hex.EncodeToString(sum[:])
+//Digests contains the digests of a RegularFile's contents, as hex strings.
+type Digests struct {
+	MD5    string
+	SHA256 string
+}
+
+//Digests returns the digests of this file's contents. All digests are
+//computed in a single pass over the contents, and the result is cached, so
+//that multiple generators building from the same file do not need to read it
+//again.
+//
+//The cache is invalidated when Content is replaced by a different slice, or
+//when ContentProvider is set or unset. If the file's contents are changed in
+//any other way (e.g. by modifying Content in place, or by replacing one
+//ContentProvider by another), InvalidateDigests() must be called.
+func (f *RegularFile) Digests() (Digests, error) {
+	if f.digestCache != nil && f.digestCache.isValidFor(f) {
+		return f.digestCache.Digests, nil
+	}
+
+	md5digest := md5.New()
+	sha256digest := sha256.New()
+	err := f.copyContentTo(io.MultiWriter(md5digest, sha256digest))
+	if err != nil {
+		return Digests{}, err
+	}
+
+	result := Digests{
+		MD5:    hex.EncodeToString(md5digest.Sum(nil)),
+		SHA256: hex.EncodeToString(sha256digest.Sum(nil)),
+	}
+	f.digestCache = &digestCache{
+		Digests:     result,
+		content:     f.Content,
+		hasProvider: f.ContentProvider != nil,
+	}
+	return result, nil
+}
+
+//InvalidateDigests discards the cached result of Digests().
+func (f *RegularFile) InvalidateDigests() {
+	f.digestCache = nil
+}
+
+//MD5Digest returns the MD5 digest of this file's contents.
+func (f *RegularFile) MD5Digest() (string, error) {
+	d, err := f.Digests()
+	return d.MD5, err
 }
 
 //SHA256Digest returns the SHA256 digest of this file's contents.
-func (f *RegularFile) SHA256Digest() string {
-	//the following is equivalent to sum := sha256.Sum([]byte(f.Content)),
-	//but also is backwards-compatible to Go 1.1
-	digest := sha256.New()
-	digest.Write([]byte(f.Content))
-	sum := digest.Sum(nil)
+func (f *RegularFile) SHA256Digest() (string, error) {
+	d, err := f.Digests()
+	return d.SHA256, err
+}
 
-	return hex.EncodeToString(sum[:])
+type digestCache struct {
+	Digests
+	//what the digests were computed from
+	content     []byte
+	hasProvider bool
+}
+
+func (c *digestCache) isValidFor(f *RegularFile) bool {
+	if c.hasProvider || f.ContentProvider != nil {
+		return c.hasProvider && f.ContentProvider != nil
+	}
+	//compare slice identity, not contents (that would be as expensive as
+	//computing the digests)
+	if len(c.content) != len(f.Content) {
+		return false
+	}
+	return len(c.content) == 0 || &c.content[0] == &f.Content[0]
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // Symlink
 //
 
-//Symlink is a type of Node that represents symbolic links,
+//Symlink is a type of Node that represents symbolic links. The Mode in its
+//Metadata is ignored since symlinks always have mode 0777.
 type Symlink struct {
-	Target string
+	Target   string
+	Metadata NodeMetadata
 }
 
 //Insert implements the Node interface.
@@ -342,8 +535,8 @@ func (s *Symlink) Insert(entry Node, relPath []string, location string) error {
 }
 
 //InstalledSizeInBytes implements the Node interface.
-func (s *Symlink) InstalledSizeInBytes() int {
-	return len(s.Target)
+func (s *Symlink) InstalledSizeInBytes() int64 {
+	return int64(len(s.Target))
 }
 
 //FileModeForArchive implements the Node interface.
@@ -354,6 +547,11 @@ func (s *Symlink) FileModeForArchive(includingFileType bool) uint32 {
 	return 0777
 }
 
+//ModTime implements the Node interface.
+func (s *Symlink) ModTime() time.Time {
+	return s.Metadata.ModTime()
+}
+
 //Walk implements the Node interface.
 func (s *Symlink) Walk(absolutePath string, callback func(string, Node) error) error {
 	return callback(absolutePath, s)
@@ -361,5 +559,5 @@ func (s *Symlink) Walk(absolutePath string, callback func(string, Node) error) e
 
 //PostponeUnmaterializable implements the Node interface.
 func (s *Symlink) PostponeUnmaterializable(absolutePath string) string {
-	return ""
+	return s.Metadata.postponeUnmaterializable(absolutePath, true)
 }
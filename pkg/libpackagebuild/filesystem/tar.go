@@ -0,0 +1,236 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package filesystem
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ToTarArchive creates a TAR archive containing this directory and all the
+//filesystem entries in it.
+//
+//With `leadingDot = true`, generate entry paths like `./foo/bar.conf`.
+//With `leadingDot = false`, generate entry paths like `foo/bar.conf`.
+//
+//With `skipRootDirectory = true`, don't generate an entry for the root
+//directory in the resulting package.
+func (d *Directory) ToTarArchive(w io.Writer, leadingDot, skipRootDirectory bool) error {
+	return d.ToTarArchiveWithFormat(w, leadingDot, skipRootDirectory, TarFormatPAX)
+}
+
+//ToTarArchiveWithFormat is like ToTarArchive, but selects how headers that
+//do not fit into a plain USTAR header are encoded (see WriteTarHeader).
+func (d *Directory) ToTarArchiveWithFormat(w io.Writer, leadingDot, skipRootDirectory bool, format TarFormat) error {
+	tw := tar.NewWriter(w)
+
+	err := d.Walk(".", func(path string, node Node) error {
+		if !leadingDot {
+			path = strings.TrimPrefix(path, "./")
+		}
+		if skipRootDirectory && path == "." {
+			return nil
+		}
+
+		var err error
+		switch n := node.(type) {
+		case *Directory:
+			err = WriteTarHeaderWithFormat(tw, format, &tar.Header{
+				Name:     path + "/",
+				Typeflag: tar.TypeDir,
+				Mode:     int64(n.FileModeForArchive(false)),
+				Uid:      int(n.Metadata.UID()),
+				Gid:      int(n.Metadata.GID()),
+				ModTime:  n.ModTime(),
+			})
+		case *RegularFile:
+			err = WriteTarHeaderWithFormat(tw, format, &tar.Header{
+				Name:     path,
+				Size:     n.ContentSize(),
+				Typeflag: tar.TypeReg,
+				Mode:     int64(n.FileModeForArchive(false)),
+				Uid:      int(n.Metadata.UID()),
+				Gid:      int(n.Metadata.GID()),
+				ModTime:  n.ModTime(),
+			})
+		case *Symlink:
+			err = WriteTarHeaderWithFormat(tw, format, &tar.Header{
+				Name:     path,
+				Typeflag: tar.TypeSymlink,
+				Mode:     int64(n.FileModeForArchive(false)),
+				Linkname: n.Target,
+				Uid:      int(n.Metadata.UID()),
+				Gid:      int(n.Metadata.GID()),
+				ModTime:  n.ModTime(),
+			})
+		default:
+			panic("unreachable")
+		}
+		if err != nil {
+			return err
+		}
+		if n, ok := node.(*RegularFile); ok {
+			return n.copyContentTo(tw)
+		}
+		return nil
+	})
+	if err != nil {
+		tw.Close()
+		return err
+	}
+
+	return tw.Close()
+}
+
+//TarFormat selects how WriteTarHeaderWithFormat encodes headers that do not
+//fit into a plain USTAR header, e.g. because of long link targets, or user or
+//group IDs above 2097151 (the largest number that fits into the octal fields).
+type TarFormat int
+
+const (
+	//TarFormatPAX encodes such headers with PAX records. This is the default.
+	TarFormatPAX TarFormat = iota
+	//TarFormatGNU encodes such headers with GNU extensions (base-256 numbers,
+	//and extra entries for long names and link targets). This format is
+	//required for Debian packages since dpkg does not understand PAX records.
+	TarFormatGNU
+)
+
+//WriteTarHeader writes the given header into the given tar writer, using
+//TarFormatPAX. All tar archives generated by libpackagebuild use this
+//function (or WriteTarHeaderWithFormat), so that their headers are encoded
+//consistently and reproducibly: Headers are written as plain USTAR headers
+//where possible, and with PAX records otherwise (e.g. for long link targets
+//or large IDs). To avoid PAX records that depend on the build environment,
+//the ModTime is rounded to full seconds, and the AccessTime and ChangeTime
+//are not recorded. (archive/tar writes PAX records sorted by key.)
+func WriteTarHeader(tw *tar.Writer, hdr *tar.Header) error {
+	return WriteTarHeaderWithFormat(tw, TarFormatPAX, hdr)
+}
+
+//WriteTarHeaderWithFormat is like WriteTarHeader, but uses the given format
+//for headers that do not fit into a plain USTAR header.
+func WriteTarHeaderWithFormat(tw *tar.Writer, format TarFormat, hdr *tar.Header) error {
+	switch format {
+	case TarFormatGNU:
+		//archive/tar chooses the first of the allowed formats that can
+		//represent the header, so this still yields USTAR where possible
+		hdr.Format = tar.FormatUSTAR | tar.FormatGNU
+	default:
+		hdr.Format = tar.FormatPAX
+	}
+	hdr.ModTime = hdr.ModTime.Round(time.Second)
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+	return tw.WriteHeader(hdr)
+}
+
+//ToTarGZArchive is identical to ToTarArchive, but GZip-compresses the result.
+func (d *Directory) ToTarGZArchive(w io.Writer, leadingDot, skipRootDirectory bool) error {
+	gzw := gzip.NewWriter(w)
+
+	err := d.ToTarArchive(gzw, leadingDot, skipRootDirectory)
+	if err != nil {
+		gzw.Close()
+		return err
+	}
+	return gzw.Close()
+}
+
+//ToTarXZArchive is identical to ToTarArchive, but XZ-compresses the result.
+func (d *Directory) ToTarXZArchive(w io.Writer, leadingDot, skipRootDirectory bool) error {
+	return d.ToParallelTarXZArchive(w, leadingDot, skipRootDirectory, 1)
+}
+
+//ToParallelTarXZArchive is like ToTarXZArchive, but uses the given number of
+//threads for compression (see XZArguments).
+func (d *Directory) ToParallelTarXZArchive(w io.Writer, leadingDot, skipRootDirectory bool, jobs int) error {
+	//since we don't have a "compress/xz" package, use the "xz" binary instead
+	return CompressWithProgram(w, func(tarWriter io.Writer) error {
+		return d.ToTarArchive(tarWriter, leadingDot, skipRootDirectory)
+	}, "xz", XZArguments(jobs)...)
+}
+
+//xzBlockSize is the size of the blocks that are compressed independently of
+//each other. It is fixed (instead of letting xz choose it based on the
+//compression preset) since the result depends on it.
+const xzBlockSize = "8MiB"
+
+//XZArguments returns the arguments for xz(1) to compress standard input with
+//the given number of threads. For a single thread (or less), this is a plain
+//"xz --compress" that works with every xz version. For more threads, the
+//input is split into blocks of a fixed size that are compressed by the
+//multi-threaded encoder. Since its output depends only on the block size, and
+//not on the number of threads, the result is identical for all values of jobs
+//greater than 1 (but differs from the result for a single thread). This
+//requires xz 5.4 or newer: older versions switch to the single-threaded
+//encoder when they reduce the number of threads to 1 because of the memory
+//usage limit.
+func XZArguments(jobs int) []string {
+	if jobs <= 1 {
+		return []string{"--compress"}
+	}
+	return []string{"--compress", "--threads=" + strconv.Itoa(jobs), "--block-size=" + xzBlockSize}
+}
+
+//ToTarZstdArchive is identical to ToTarArchive, but Zstandard-compresses the
+//result.
+func (d *Directory) ToTarZstdArchive(w io.Writer, leadingDot, skipRootDirectory bool) error {
+	//same as above: there is no "compress/zstd" package, so use the binary
+	return CompressWithProgram(w, func(tarWriter io.Writer) error {
+		return d.ToTarArchive(tarWriter, leadingDot, skipRootDirectory)
+	}, "zstd", "--compress", "--stdout", "--quiet")
+}
+
+//CompressWithProgram runs the given compression program, feeds everything that
+//the `write` callback writes into its standard input, and copies its standard
+//output into `w`. The uncompressed data is streamed into the compressor, so it
+//never needs to be held in memory completely.
+func CompressWithProgram(w io.Writer, write func(io.Writer) error, program string, args ...string) error {
+	cmd := exec.Command(program, args...)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	err = write(stdin)
+	closeErr := stdin.Close()
+	waitErr := cmd.Wait()
+	switch {
+	case err != nil:
+		return err
+	case closeErr != nil:
+		return closeErr
+	default:
+		return waitErr
+	}
+}
@@ -0,0 +1,122 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+//WalkFiltered is like Walk, but only visits nodes for which the predicate
+//returns true. When the predicate rejects a directory, the entries below it
+//are skipped as well. This directory itself is always visited.
+func (d *Directory) WalkFiltered(absolutePath string, predicate func(absolutePath string, node Node) bool, callback func(absolutePath string, node Node) error) error {
+	return d.Walk(absolutePath, func(path string, node Node) error {
+		if node != d && !predicate(path, node) {
+			return filepath.SkipDir
+		}
+		return callback(path, node)
+	})
+}
+
+//Transform calls the given function for each node below this directory
+//(recursively, in the same order as Walk). The node is replaced by the
+//returned node, or removed from its parent directory if nil is returned. When
+//the returned node is a directory, the transformation continues with its
+//entries. The function may also modify the given node (e.g. its metadata) in
+//place and return it unchanged.
+//
+//If the function returns an error, the transformation stops, and the error is
+//returned. Nodes that have already been transformed stay transformed.
+func (d *Directory) Transform(absolutePath string, transform func(absolutePath string, node Node) (Node, error)) error {
+	for _, name := range d.sortedNames() {
+		path := joinPath(absolutePath, name)
+		node, err := transform(path, d.Entries[name])
+		if err != nil {
+			return err
+		}
+		if node == nil {
+			delete(d.Entries, name)
+			continue
+		}
+		d.Entries[name] = node
+
+		if subdir, ok := node.(*Directory); ok {
+			err := subdir.Transform(path, transform)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//Remove removes the entry at the given path (relative to this directory, in
+//the same format as for Insert) including all entries below it, and returns
+//the removed entry. The `location` is used for error messages, in the same
+//way as for Insert.
+func (d *Directory) Remove(relPath []string, location string) (Node, error) {
+	if len(relPath) == 0 {
+		return nil, errors.New("cannot remove a directory from itself")
+	}
+
+	subname := relPath[0]
+	subentry, exists := d.Entries[subname]
+	if !exists {
+		return nil, fmt.Errorf("%s does not exist", joinPath(location, subname))
+	}
+
+	if len(relPath) == 1 {
+		delete(d.Entries, subname)
+		return subentry, nil
+	}
+
+	subdir, ok := subentry.(*Directory)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a directory", joinPath(location, subname))
+	}
+	return subdir.Remove(relPath[1:], joinPath(location, subname))
+}
+
+//sortedNames returns the names of all entries in this directory in sorted
+//order, to allow for reproducible traversals.
+func (d *Directory) sortedNames() []string {
+	names := make([]string, 0, len(d.Entries))
+	for name := range d.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//joinPath returns the path of the entry with the given name in the directory
+//at the given path.
+func joinPath(dirPath, name string) string {
+	switch dirPath {
+	case "":
+		return name
+	case "/":
+		return "/" + name
+	default:
+		return dirPath + "/" + name
+	}
+}
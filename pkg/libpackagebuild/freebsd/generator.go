@@ -0,0 +1,269 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package freebsd provides a build.Generator for packages for pkg(8), the
+//package manager of FreeBSD.
+package freebsd
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//Generator is the build.Generator for FreeBSD packages.
+type Generator struct {
+	Package *build.Package
+	//Jobs is the number of threads used by xz (see filesystem.XZArguments).
+	Jobs int
+}
+
+//GeneratorFactory spawns Generator instances. It satisfies the build.GeneratorFactory type.
+func GeneratorFactory(pkg *build.Package) build.Generator {
+	return &Generator{Package: pkg}
+}
+
+//The values are the architecture part of the package ABI (e.g.
+//"FreeBSD:13:amd64"). FreeBSD does not support ARMv5 anymore.
+var archMap = map[build.Architecture]string{
+	build.ArchitectureAny:     "*",
+	build.ArchitectureI386:    "i386",
+	build.ArchitectureX86_64:  "amd64",
+	build.ArchitectureARMv6h:  "armv6",
+	build.ArchitectureARMv7h:  "armv7",
+	build.ArchitectureAArch64: "aarch64",
+}
+
+//SupportedArchitectures implements the build.Generator interface.
+func (g *Generator) SupportedArchitectures() map[build.Architecture]string {
+	return archMap
+}
+
+//Capabilities implements the build.CapabilityReporter interface.
+func (g *Generator) Capabilities() build.Capabilities {
+	return build.Capabilities{
+		Compressions: []string{"xz"},
+		Actions:      true,
+	}
+}
+
+//RecommendedFileName implements the build.Generator interface.
+func (g *Generator) RecommendedFileName() string {
+	c := g.RecommendedFileNameComponents()
+	return fmt.Sprintf("%s-%s%s", c.Name, c.FullVersion, c.Extension)
+}
+
+//RecommendedFileNameComponents implements the build.Generator interface.
+func (g *Generator) RecommendedFileNameComponents() build.FileNameComponents {
+	//this is called after Build(), so we can assume that package name,
+	//version, etc. were already validated
+	pkg := g.Package
+	return build.FileNameComponents{
+		Name:        pkg.Name,
+		FullVersion: fullVersionString(pkg),
+		Extension:   ".pkg",
+	}
+}
+
+//fullVersionString renders the version in the format used by the FreeBSD
+//ports tree, i.e. "$PORTVERSION_$PORTREVISION,$PORTEPOCH".
+func fullVersionString(pkg *build.Package) string {
+	var b strings.Builder
+
+	b.WriteString(pkg.Version)
+
+	//pkg(8) sorts "alpha" and "beta" before the empty string
+	if pkg.PrereleaseType != build.PrereleaseTypeNone {
+		fmt.Fprintf(&b, ".%s%d", pkg.PrereleaseType.String(), pkg.PrereleaseVersion)
+	}
+
+	fmt.Fprintf(&b, "_%d", pkg.Release)
+
+	if pkg.Epoch > 0 {
+		fmt.Fprintf(&b, ",%d", pkg.Epoch)
+	}
+	return b.String()
+}
+
+//Validate implements the build.Generator interface.
+func (g *Generator) Validate() []error {
+	nameRx := `[a-zA-Z0-9][a-zA-Z0-9._+-]*`
+	errs := g.Package.ValidateWith(build.RegexSet{
+		PackageName:    nameRx,
+		PackageVersion: `[a-zA-Z0-9.+]+`,
+		RelatedName:    nameRx,
+		RelatedVersion: `[a-zA-Z0-9.+_,]+`,
+		FormatName:     "FreeBSD",
+	}, archMap)
+	if len(g.Package.Triggers) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "trigger", Format: "FreeBSD", Message: "triggers are not supported for FreeBSD packages"})
+	}
+	if len(g.Package.Services) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "service", Format: "FreeBSD", Message: "FreeBSD does not use systemd"})
+	}
+
+	//pkg(8) reads the metadata files from the top level of the archive
+	return append(errs, g.Package.ValidateReservedPaths("FreeBSD", func(absolutePath string) bool {
+		return path.Dir(absolutePath) == "/" && strings.HasPrefix(path.Base(absolutePath), "+")
+	})...)
+}
+
+//Build implements the build.Generator interface.
+func (g *Generator) Build() ([]byte, error) {
+	pkg := g.Package
+	//there is no alternatives system, so install the preferred alternatives
+	//as plain symlinks
+	err := pkg.InsertAlternativeSymlinks()
+	if err != nil {
+		return nil, err
+	}
+	//there are no transaction scripts, so run these actions together with
+	//the other setup actions
+	pkg.FoldTransactionActions()
+	//pkg(8) only records the names of provided packages
+	pkg.FoldSupersedes("", true)
+	pkg.AddHologramProvides("hologram-"+pkg.Name, "")
+	err = pkg.PrepareBuild()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := buildManifest(pkg)
+	if err != nil {
+		return nil, err
+	}
+	compactManifest, err := manifest.compact().encode()
+	if err != nil {
+		return nil, err
+	}
+	fullManifest, err := manifest.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	endPhase := pkg.BeginPhase(build.PhaseCompress)
+	err = filesystem.CompressWithProgram(&buf, func(w io.Writer) error {
+		return writeArchive(w, pkg, compactManifest, fullManifest)
+	}, "xz", filesystem.XZArguments(g.Jobs)...)
+	endPhase()
+	return buf.Bytes(), err
+}
+
+//writeArchive writes the package archive. Unlike in other package formats, the
+//paths of the package contents are absolute, and only those directories are
+//included that belong to the package.
+func writeArchive(w io.Writer, pkg *build.Package, compactManifest, fullManifest []byte) error {
+	tw := tar.NewWriter(w)
+	timestamp := time.Unix(0, 0)
+
+	//the manifests must come first, in this order
+	for _, entry := range []struct {
+		Name    string
+		Content []byte
+	}{
+		{"+COMPACT_MANIFEST", compactManifest},
+		{"+MANIFEST", fullManifest},
+	} {
+		err := filesystem.WriteTarHeader(tw, &tar.Header{
+			Name:     entry.Name,
+			Size:     int64(len(entry.Content)),
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Uname:    "root",
+			Gname:    "wheel",
+			ModTime:  timestamp,
+		})
+		if err == nil {
+			_, err = tw.Write(entry.Content)
+		}
+		if err != nil {
+			tw.Close()
+			return err
+		}
+	}
+
+	err := pkg.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		hdr := &tar.Header{
+			Name:    absolutePath,
+			Mode:    int64(node.FileModeForArchive(false)),
+			ModTime: node.ModTime(),
+		}
+		var file *filesystem.RegularFile
+		switch n := node.(type) {
+		case *filesystem.Directory:
+			if n.Implicit {
+				return nil
+			}
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+			setOwnership(hdr, n.Metadata)
+		case *filesystem.RegularFile:
+			file = n
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = n.ContentSize()
+			setOwnership(hdr, n.Metadata)
+		case *filesystem.Symlink:
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = n.Target
+			setOwnership(hdr, n.Metadata)
+		}
+
+		err := filesystem.WriteTarHeader(tw, hdr)
+		if err != nil || file == nil {
+			return err
+		}
+		r, err := file.OpenContent()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, r)
+		closeErr := r.Close()
+		if err != nil {
+			return err
+		}
+		return closeErr
+	})
+	if err != nil {
+		tw.Close()
+		return err
+	}
+	return tw.Close()
+}
+
+//setOwnership fills the owner and group in the tar header. pkg(8) prefers the
+//names over the numeric IDs, and the group with GID 0 is called "wheel" on
+//FreeBSD.
+func setOwnership(hdr *tar.Header, m filesystem.NodeMetadata) {
+	hdr.Uid = int(m.UID())
+	hdr.Gid = int(m.GID())
+	if hdr.Uid == 0 {
+		hdr.Uname = "root"
+	}
+	if hdr.Gid == 0 {
+		hdr.Gname = "wheel"
+	}
+}
@@ -0,0 +1,183 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package freebsd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//manifest is the structure of the +MANIFEST file. pkg(8) reads UCL, which is
+//a superset of JSON. The fields in the second block are left out of the
+//+COMPACT_MANIFEST.
+type manifest struct {
+	Name         string                `json:"name"`
+	Origin       string                `json:"origin"`
+	Version      string                `json:"version"`
+	Comment      string                `json:"comment"`
+	Maintainer   string                `json:"maintainer"`
+	WWW          string                `json:"www"`
+	ABI          string                `json:"abi"`
+	Prefix       string                `json:"prefix"`
+	FlatSize     int64                 `json:"flatsize"`
+	LicenseLogic string                `json:"licenselogic"`
+	Description  string                `json:"desc"`
+	Categories   []string              `json:"categories"`
+	Deps         map[string]dependency `json:"deps,omitempty"`
+	Provides     []string              `json:"provides,omitempty"`
+	Conflicts    []string              `json:"conflicts,omitempty"`
+	//ShlibsProvided lists the SONAMEs of the package's shared libraries.
+	ShlibsProvided []string `json:"shlibs_provided,omitempty"`
+
+	Files       map[string]string `json:"files,omitempty"`
+	Directories map[string]string `json:"directories,omitempty"`
+	Scripts     map[string]string `json:"scripts,omitempty"`
+}
+
+type dependency struct {
+	Origin  string `json:"origin"`
+	Version string `json:"version"`
+}
+
+func buildManifest(pkg *build.Package) (*manifest, error) {
+	//pkg(8) requires a comment (the one-line description)
+	comment := pkg.Description
+	if comment == "" {
+		comment = pkg.Name
+	}
+	maintainer := pkg.Author
+	if maintainer == "" {
+		maintainer = "Unknown Packager"
+	}
+
+	m := &manifest{
+		Name: pkg.Name,
+		//there is no port in the ports tree for packages built by holo-build
+		Origin:       "holo/" + pkg.Name,
+		Version:      fullVersionString(pkg),
+		Comment:      comment,
+		Maintainer:   maintainer,
+		WWW:          "",
+		ABI:          "FreeBSD:*:" + archMap[pkg.Architecture],
+		Prefix:       "/",
+		FlatSize:     pkg.FSRoot.InstalledSizeInBytes(),
+		LicenseLogic: "single",
+		Description:  comment,
+		Categories:   []string{"holo"},
+	}
+
+	//pkg(8) records the version of a dependency, but does not enforce it, so
+	//only exact version constraints are carried over
+	if len(pkg.Requires) > 0 {
+		m.Deps = make(map[string]dependency)
+		for _, rel := range pkg.Requires {
+			dep := dependency{Origin: "holo/" + rel.RelatedPackage, Version: "*"}
+			for _, c := range rel.Constraints {
+				if c.Relation == "=" {
+					dep.Version = c.Version
+				}
+			}
+			m.Deps[rel.RelatedPackage] = dep
+		}
+	}
+	//there is no equivalent for Replaces
+	for _, rel := range pkg.Provides {
+		m.Provides = append(m.Provides, rel.RelatedPackage)
+	}
+	for _, rel := range pkg.Conflicts {
+		m.Conflicts = append(m.Conflicts, rel.RelatedPackage)
+	}
+	//pkg(8) resolves dependencies on shared libraries by SONAME, and has no
+	//equivalent for pkg-config files
+	libs, err := pkg.SharedLibraries()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, lib := range libs {
+		if !seen[lib.SOName] {
+			seen[lib.SOName] = true
+			m.ShlibsProvided = append(m.ShlibsProvided, lib.SOName)
+		}
+	}
+
+	//list the package contents with their checksums (hash type 1 is a
+	//hex-encoded SHA-256 digest; for symlinks, the digest of the target)
+	m.Files = make(map[string]string)
+	m.Directories = make(map[string]string)
+	err = pkg.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		switch n := node.(type) {
+		case *filesystem.Directory:
+			if !n.Implicit {
+				m.Directories[absolutePath] = "y"
+			}
+		case *filesystem.RegularFile:
+			digest, err := n.SHA256Digest()
+			if err != nil {
+				return err
+			}
+			m.Files[absolutePath] = "1$" + digest
+		case *filesystem.Symlink:
+			digest := sha256.Sum256([]byte(n.Target))
+			m.Files[absolutePath] = "1$" + hex.EncodeToString(digest[:])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.Scripts = make(map[string]string)
+	for scriptName, actionType := range map[string]uint{
+		"pre-install":    build.PreSetupAction,
+		"post-install":   build.SetupAction,
+		"pre-deinstall":  build.PreCleanupAction,
+		"post-deinstall": build.CleanupAction,
+	} {
+		if script := pkg.Script(actionType); script != "" {
+			m.Scripts[scriptName] = script
+		}
+	}
+
+	return m, nil
+}
+
+//compact returns a copy of this manifest with the fields that do not belong
+//into the +COMPACT_MANIFEST removed.
+func (m *manifest) compact() *manifest {
+	result := *m
+	result.Files = nil
+	result.Directories = nil
+	result.Scripts = nil
+	return &result
+}
+
+func (m *manifest) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(m)
+	return buf.Bytes(), err
+}
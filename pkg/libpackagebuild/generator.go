@@ -0,0 +1,121 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package build
+
+//Generator is a generic interface for the package generator implementations.
+//One Generator exists for every target package format (e.g. pacman, dpkg, RPM)
+//supported by libpackagebuild.
+//
+//A generator should take the package to be built as a struct field like this:
+//
+//	type DebianGenerator struct {
+//		Package *Package
+//		//... other fields ...
+//	}
+//
+//Each generator implementation should also provide a function of type
+//GeneratorFactory, see below.
+type Generator interface {
+	//Validate performs additional validations on the package that are specific
+	//to the concrete generator. For example, if the package format imposes
+	//restrictions on the format of certain fields (names, versions, etc.), they
+	//should be checked here.
+	//
+	//If the package is valid, an empty slice is to be returned. Otherwise, the
+	//returned errors should be of type *ValidationError, so that callers can
+	//tell which part of the package definition they refer to.
+	Validate() []error
+	//Build produces the final package (usually a compressed tar file) in the
+	//return argument. The package must be built reproducibly; such that every
+	//run (even across systems) produces an identical result. For example, no
+	//timestamps or generator version information may be included.
+	//
+	//Build should call pkg.PrepareBuild() to execute some common preparation steps.
+	Build() ([]byte, error)
+	//Generate the recommended file name for this package. Distributions usually
+	//have guidelines for this sort of thing. The string returned must be a plain
+	//file name without any slashes.
+	RecommendedFileName() string
+	//RecommendedFileNameComponents returns the parts that RecommendedFileName()
+	//is made of, so that callers can work with them without having to parse
+	//the file name.
+	RecommendedFileNameComponents() FileNameComponents
+	//SupportedArchitectures returns the architectures that this generator can
+	//build packages for, mapped to the names that the package format uses for
+	//them. The map must not be modified by the caller. This must work even if
+	//the generator was created without a package.
+	SupportedArchitectures() map[Architecture]string
+}
+
+//FileNameComponents contains the parts of the file name recommended by
+//Generator.RecommendedFileName(). How they are joined together depends on the
+//package format.
+type FileNameComponents struct {
+	//Name is the package name.
+	Name string `json:"name"`
+	//FullVersion is the version string as it appears in the file name,
+	//including epoch and release where the package format puts them there
+	//(e.g. "1:2.0-1" for Debian packages).
+	FullVersion string `json:"version"`
+	//ArchString is the architecture as it appears in the file name (e.g.
+	//"amd64" for Debian packages, but "x86_64" for pacman packages). Empty
+	//if the package format does not put the architecture in the file name.
+	ArchString string `json:"arch,omitempty"`
+	//Extension is the file name extension including the leading dot (e.g.
+	//".deb" or ".pkg.tar.xz").
+	Extension string `json:"extension"`
+}
+
+//GeneratorFactory is a type of function that creates generators.
+type GeneratorFactory func(*Package) Generator
+
+//CapabilityReporter is implemented by generators that can describe which
+//optional features their package format supports. Like
+//SupportedArchitectures(), Capabilities() must work even if the generator was
+//created without a package.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+//Capabilities describes the optional features of a package format, so that
+//callers can check for them before building a package instead of relying on
+//validation errors.
+type Capabilities struct {
+	//Compressions lists the compression methods that are used for the package
+	//or for parts of it (e.g. "xz" or "zstd"), including the ones that can be
+	//selected with generator-specific options.
+	Compressions []string
+	//Actions is true if the package can contain setup and cleanup scripts
+	//(see Package.Actions).
+	Actions bool
+	//Triggers is true if the package can contain triggers (see
+	//Package.Triggers).
+	Triggers bool
+	//Services is true if the package can manage systemd units (see
+	//Package.Services).
+	Services bool
+	//Alternatives is true if Package.Alternatives are registered with the
+	//alternatives system of the distribution. Otherwise, only the preferred
+	//alternative for each link is installed as a symlink.
+	Alternatives bool
+	//EmbeddedSignature is true if the package can contain its own signature.
+	//Otherwise, signatures need to be stored next to the package.
+	EmbeddedSignature bool
+}
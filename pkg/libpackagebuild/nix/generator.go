@@ -0,0 +1,383 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package nix provides a build.Generator that renders packages as NixOS
+//modules. This is experimental and intended to help with migrating holograms
+//to NixOS.
+package nix
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//Generator is the build.Generator for NixOS modules. Files below /etc are
+//rendered into `environment.etc`, all other entries into
+//`systemd.tmpfiles.rules`, and entity definitions for holo-users-groups into
+//`users.users` and `users.groups`. Setup scripts become activation scripts.
+//Package relations and cleanup scripts are ignored.
+type Generator struct {
+	Package *build.Package
+}
+
+//GeneratorFactory spawns Generator instances. It satisfies the build.GeneratorFactory type.
+func GeneratorFactory(pkg *build.Package) build.Generator {
+	return &Generator{Package: pkg}
+}
+
+//The values are the system names used by Nix. A module for ArchitectureAny
+//applies to every system.
+var archMap = map[build.Architecture]string{
+	build.ArchitectureAny:     "any",
+	build.ArchitectureI386:    "i686-linux",
+	build.ArchitectureX86_64:  "x86_64-linux",
+	build.ArchitectureARMv5:   "armv5tel-linux",
+	build.ArchitectureARMv6h:  "armv6l-linux",
+	build.ArchitectureARMv7h:  "armv7l-linux",
+	build.ArchitectureAArch64: "aarch64-linux",
+}
+
+//SupportedArchitectures implements the build.Generator interface.
+func (g *Generator) SupportedArchitectures() map[build.Architecture]string {
+	return archMap
+}
+
+//Capabilities implements the build.CapabilityReporter interface.
+func (g *Generator) Capabilities() build.Capabilities {
+	//setup scripts become activation scripts
+	return build.Capabilities{
+		Actions: true,
+	}
+}
+
+//RecommendedFileName implements the build.Generator interface.
+func (g *Generator) RecommendedFileName() string {
+	c := g.RecommendedFileNameComponents()
+	return fmt.Sprintf("%s-%s-%s%s", c.Name, c.FullVersion, c.ArchString, c.Extension)
+}
+
+//RecommendedFileNameComponents implements the build.Generator interface.
+func (g *Generator) RecommendedFileNameComponents() build.FileNameComponents {
+	//this is called after Build(), so we can assume that package name,
+	//version, etc. were already validated
+	pkg := g.Package
+	return build.FileNameComponents{
+		Name:        pkg.Name,
+		FullVersion: fullVersionString(pkg),
+		ArchString:  archMap[pkg.Architecture],
+		Extension:   ".nix",
+	}
+}
+
+func fullVersionString(pkg *build.Package) string {
+	var b strings.Builder
+
+	if pkg.Epoch > 0 {
+		fmt.Fprintf(&b, "%d:", pkg.Epoch)
+	}
+
+	b.WriteString(pkg.Version)
+
+	if pkg.PrereleaseType != build.PrereleaseTypeNone {
+		fmt.Fprintf(&b, "~%s.%d", pkg.PrereleaseType.String(), pkg.PrereleaseVersion)
+	}
+
+	fmt.Fprintf(&b, "-%d", pkg.Release)
+	return b.String()
+}
+
+//Validate implements the build.Generator interface.
+func (g *Generator) Validate() []error {
+	errs := g.Package.ValidateWith(build.RegexSet{
+		PackageName:    `[a-zA-Z0-9][a-zA-Z0-9._+-]*`,
+		PackageVersion: `[a-zA-Z0-9._+~]+`,
+		//relations are ignored, so accept anything that the parser accepts
+		RelatedName:    `.+`,
+		RelatedVersion: `.+`,
+		FormatName:     "Nix",
+	}, archMap)
+
+	//NixOS rebuilds the whole system instead of reacting to changes of packages
+	if len(g.Package.Triggers) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "trigger", Format: "Nix", Message: "NixOS modules cannot contain triggers"})
+	}
+	if len(g.Package.Services) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "service", Format: "Nix", Message: "NixOS modules cannot manage systemd units (use systemd.services instead)"})
+	}
+	return errs
+}
+
+//entity definition files, as written by holo-build for holo-users-groups
+var definitionFileRx = regexp.MustCompile(`^/usr/share/holo/users-groups/[^/]+\.toml$`)
+
+type entityDefinitions struct {
+	Group []struct {
+		Name   string `toml:"name"`
+		Gid    uint32 `toml:"gid"`
+		System bool   `toml:"system"`
+	} `toml:"group"`
+	User []struct {
+		Name    string   `toml:"name"`
+		Comment string   `toml:"comment"`
+		UID     uint32   `toml:"uid"`
+		System  bool     `toml:"system"`
+		Home    string   `toml:"home"`
+		Group   string   `toml:"group"`
+		Groups  []string `toml:"groups"`
+		Shell   string   `toml:"shell"`
+	} `toml:"user"`
+}
+
+//Build implements the build.Generator interface.
+func (g *Generator) Build() ([]byte, error) {
+	pkg := g.Package
+	//there is no alternatives system, so install the preferred alternatives
+	//as plain symlinks
+	err := pkg.InsertAlternativeSymlinks()
+	if err != nil {
+		return nil, err
+	}
+	//there are no transaction scripts, so run these actions together with
+	//the other setup actions
+	pkg.FoldTransactionActions()
+	//PrepareBuild() is not used since it would replace owners and groups
+	//given by name with a setup script, but NixOS can handle them directly
+	err = pkg.Relocate()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		etc      []string
+		tmpfiles []string //already rendered as Nix strings
+		entities []entityDefinitions
+	)
+	err = pkg.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		if absolutePath == "/" {
+			return nil
+		}
+		switch node := node.(type) {
+		case *filesystem.Directory:
+			if !node.Implicit {
+				tmpfiles = append(tmpfiles, quote(fmt.Sprintf("d %s %04o %s %s -",
+					absolutePath, node.Metadata.Mode, ownerString(node.Metadata.Owner), ownerString(node.Metadata.Group),
+				)))
+			}
+		case *filesystem.RegularFile:
+			content, err := readContent(absolutePath, node)
+			if err != nil {
+				return err
+			}
+			switch {
+			case definitionFileRx.MatchString(pkg.UnprefixedPath(absolutePath)):
+				var defs entityDefinitions
+				_, err := toml.Decode(content, &defs)
+				if err != nil {
+					return fmt.Errorf("cannot read entity definitions from %s: %s", absolutePath, err.Error())
+				}
+				entities = append(entities, defs)
+			case strings.HasPrefix(absolutePath, "/etc/"):
+				etc = append(etc, renderEtcEntry(absolutePath, node, content))
+			default:
+				if node.Metadata.Owner != nil || node.Metadata.Group != nil {
+					return fmt.Errorf("cannot render %s: owners and groups are only supported for files below /etc", absolutePath)
+				}
+				//the file lives in the Nix store and is symlinked into place
+				rule := strings.TrimSuffix(quote(fmt.Sprintf("L+ %s - - - - ", absolutePath)), `"`)
+				tmpfiles = append(tmpfiles, fmt.Sprintf(`%s${pkgs.writeTextFile { name = %s; text = %s; executable = %t; }}"`,
+					rule, quote(path.Base(absolutePath)), quote(content), node.Metadata.Mode&0111 != 0,
+				))
+			}
+		case *filesystem.Symlink:
+			if node.Metadata.Owner != nil || node.Metadata.Group != nil {
+				return fmt.Errorf("cannot render %s: owners and groups are not supported for symlinks", absolutePath)
+			}
+			tmpfiles = append(tmpfiles, quote(fmt.Sprintf("L+ %s - - - - %s", absolutePath, node.Target)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//render the module
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# NixOS module generated by holo-build from the package definition of %s %s.\n", pkg.Name, fullVersionString(pkg))
+	if pkg.Description != "" {
+		fmt.Fprintf(&buf, "# %s\n", pkg.Description)
+	}
+	buf.WriteString("{ config, lib, pkgs, ... }:\n\n{\n")
+
+	if pkg.Architecture != build.ArchitectureAny {
+		system := quote(archMap[pkg.Architecture])
+		fmt.Fprintf(&buf, "  assertions = [\n    {\n      assertion = pkgs.stdenv.hostPlatform.system == %s;\n", system)
+		fmt.Fprintf(&buf, "      message = %s;\n    }\n  ];\n\n", quote(fmt.Sprintf("%s can only be used on %s", pkg.Name, archMap[pkg.Architecture])))
+	}
+
+	if len(etc) > 0 {
+		buf.WriteString("  environment.etc = {\n")
+		for _, entry := range etc {
+			buf.WriteString(entry)
+		}
+		buf.WriteString("  };\n\n")
+	}
+
+	if len(tmpfiles) > 0 {
+		buf.WriteString("  systemd.tmpfiles.rules = [\n")
+		for _, rule := range tmpfiles {
+			fmt.Fprintf(&buf, "    %s\n", rule)
+		}
+		buf.WriteString("  ];\n\n")
+	}
+
+	for _, defs := range entities {
+		for _, group := range defs.Group {
+			fmt.Fprintf(&buf, "  users.groups.%s = {", quote(group.Name))
+			if group.Gid != 0 {
+				fmt.Fprintf(&buf, " gid = %d; ", group.Gid)
+			}
+			buf.WriteString("};\n")
+		}
+		for _, user := range defs.User {
+			fmt.Fprintf(&buf, "  users.users.%s = {\n", quote(user.Name))
+			//useradd(8) only assigns UIDs below 1000 to system users
+			if user.System || (user.UID != 0 && user.UID < 1000) {
+				buf.WriteString("    isSystemUser = true;\n")
+			} else {
+				buf.WriteString("    isNormalUser = true;\n")
+			}
+			if user.UID != 0 {
+				fmt.Fprintf(&buf, "    uid = %d;\n", user.UID)
+			}
+			if user.Comment != "" {
+				fmt.Fprintf(&buf, "    description = %s;\n", quote(user.Comment))
+			}
+			if user.Home != "" {
+				fmt.Fprintf(&buf, "    home = %s;\n", quote(user.Home))
+			}
+			//NixOS requires a primary group, and useradd(8) would create a
+			//group with the same name as the user
+			primaryGroup := user.Group
+			if primaryGroup == "" {
+				primaryGroup = user.Name
+			}
+			fmt.Fprintf(&buf, "    group = %s;\n", quote(primaryGroup))
+			if len(user.Groups) > 0 {
+				quoted := make([]string, len(user.Groups))
+				for idx, group := range user.Groups {
+					quoted[idx] = quote(group)
+				}
+				fmt.Fprintf(&buf, "    extraGroups = [ %s ];\n", strings.Join(quoted, " "))
+			}
+			if user.Shell != "" {
+				fmt.Fprintf(&buf, "    shell = %s;\n", quote(user.Shell))
+			}
+			buf.WriteString("  };\n")
+			if user.Group == "" {
+				fmt.Fprintf(&buf, "  users.groups.%s = { };\n", quote(user.Name))
+			}
+		}
+		buf.WriteString("\n")
+	}
+
+	//NixOS runs activation scripts on every activation, so unlike with other
+	//formats, the scripts need to be idempotent
+	script := strings.TrimSpace(pkg.Script(build.PreSetupAction) + "\n" + pkg.Script(build.SetupAction))
+	if script != "" {
+		fmt.Fprintf(&buf, "  system.activationScripts.%s = lib.stringAfter [ \"users\" \"groups\" ] %s;\n\n", quote(pkg.Name), quote(script+"\n"))
+	}
+
+	result := bytes.TrimSuffix(buf.Bytes(), []byte("\n\n"))
+	return append(result, []byte("\n}\n")...), nil
+}
+
+func readContent(absolutePath string, file *filesystem.RegularFile) (string, error) {
+	r, err := file.OpenContent()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(content) || bytes.IndexByte(content, 0) != -1 {
+		return "", errors.New("cannot render " + absolutePath + ": Nix strings cannot contain binary data")
+	}
+	return string(content), nil
+}
+
+func renderEtcEntry(absolutePath string, file *filesystem.RegularFile, content string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "    %s = {\n", quote(strings.TrimPrefix(absolutePath, "/etc/")))
+	fmt.Fprintf(&buf, "      text = %s;\n", quote(content))
+	fmt.Fprintf(&buf, "      mode = \"%04o\";\n", file.Metadata.Mode)
+	if owner := file.Metadata.Owner; owner != nil {
+		if owner.Str != "" {
+			fmt.Fprintf(&buf, "      user = %s;\n", quote(owner.Str))
+		} else {
+			fmt.Fprintf(&buf, "      uid = %d;\n", owner.Int)
+		}
+	}
+	if group := file.Metadata.Group; group != nil {
+		if group.Str != "" {
+			fmt.Fprintf(&buf, "      group = %s;\n", quote(group.Str))
+		} else {
+			fmt.Fprintf(&buf, "      gid = %d;\n", group.Int)
+		}
+	}
+	buf.WriteString("    };\n")
+	return buf.String()
+}
+
+//ownerString formats an owner or group for a tmpfiles.d(5) rule.
+func ownerString(val *filesystem.IntOrString) string {
+	switch {
+	case val == nil:
+		return "-"
+	case val.Str != "":
+		return val.Str
+	default:
+		return fmt.Sprintf("%d", val.Int)
+	}
+}
+
+var quoteReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	`${`, `\${`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+//quote renders a string literal in the Nix language.
+func quote(str string) string {
+	return `"` + quoteReplacer.Replace(str) + `"`
+}
@@ -0,0 +1,294 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package oci provides a build.Generator for OCI image layers, which can be
+//appended to container images instead of installing a system package.
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//Generator is the build.Generator for OCI image layers. Since there is no
+//package manager involved, package relations are ignored, and packages with
+//setup or cleanup scripts cannot be built.
+//
+//The result is an OCI image layout (as defined by the OCI Image Format
+//Specification) in a tar archive, containing the layer itself and a minimal
+//image manifest and configuration referencing it.
+type Generator struct {
+	Package *build.Package
+}
+
+//GeneratorFactory spawns Generator instances. It satisfies the build.GeneratorFactory type.
+func GeneratorFactory(pkg *build.Package) build.Generator {
+	return &Generator{Package: pkg}
+}
+
+//platform describes an architecture in the format of the OCI image config.
+type platform struct {
+	Architecture string
+	Variant      string
+}
+
+//ArchitectureAny maps to an empty platform since a layer without compiled
+//binaries can be appended to images for any platform.
+var platformMap = map[build.Architecture]platform{
+	build.ArchitectureAny:     {},
+	build.ArchitectureI386:    {"386", ""},
+	build.ArchitectureX86_64:  {"amd64", ""},
+	build.ArchitectureARMv5:   {"arm", "v5"},
+	build.ArchitectureARMv6h:  {"arm", "v6"},
+	build.ArchitectureARMv7h:  {"arm", "v7"},
+	build.ArchitectureAArch64: {"arm64", ""},
+}
+
+//archMap contains the architecture names used in file names.
+var archMap = map[build.Architecture]string{
+	build.ArchitectureAny:     "any",
+	build.ArchitectureI386:    "386",
+	build.ArchitectureX86_64:  "amd64",
+	build.ArchitectureARMv5:   "armv5",
+	build.ArchitectureARMv6h:  "armv6",
+	build.ArchitectureARMv7h:  "armv7",
+	build.ArchitectureAArch64: "arm64",
+}
+
+//SupportedArchitectures implements the build.Generator interface.
+func (g *Generator) SupportedArchitectures() map[build.Architecture]string {
+	return archMap
+}
+
+//Capabilities implements the build.CapabilityReporter interface.
+func (g *Generator) Capabilities() build.Capabilities {
+	return build.Capabilities{
+		Compressions: []string{"gzip"},
+	}
+}
+
+//RecommendedFileName implements the build.Generator interface.
+func (g *Generator) RecommendedFileName() string {
+	c := g.RecommendedFileNameComponents()
+	return fmt.Sprintf("%s-%s-%s%s", c.Name, c.FullVersion, c.ArchString, c.Extension)
+}
+
+//RecommendedFileNameComponents implements the build.Generator interface.
+func (g *Generator) RecommendedFileNameComponents() build.FileNameComponents {
+	//this is called after Build(), so we can assume that package name,
+	//version, etc. were already validated
+	pkg := g.Package
+	return build.FileNameComponents{
+		Name:        pkg.Name,
+		FullVersion: fullVersionString(pkg),
+		ArchString:  archMap[pkg.Architecture],
+		Extension:   ".oci.tar",
+	}
+}
+
+func fullVersionString(pkg *build.Package) string {
+	var b strings.Builder
+
+	if pkg.Epoch > 0 {
+		fmt.Fprintf(&b, "%d:", pkg.Epoch)
+	}
+
+	b.WriteString(pkg.Version)
+
+	if pkg.PrereleaseType != build.PrereleaseTypeNone {
+		fmt.Fprintf(&b, "~%s.%d", pkg.PrereleaseType.String(), pkg.PrereleaseVersion)
+	}
+
+	fmt.Fprintf(&b, "-%d", pkg.Release)
+	return b.String()
+}
+
+//Validate implements the build.Generator interface.
+func (g *Generator) Validate() []error {
+	errs := g.Package.ValidateWith(build.RegexSet{
+		PackageName:    `[a-zA-Z0-9][a-zA-Z0-9._+-]*`,
+		PackageVersion: `[a-zA-Z0-9._+~]+`,
+		//relations are ignored, so accept anything that the parser accepts
+		RelatedName:    `.+`,
+		RelatedVersion: `.+`,
+		FormatName:     "OCI",
+	}, archMap)
+
+	//there is nothing that could execute scripts
+	if len(g.Package.Actions) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "action", Format: "OCI", Message: "OCI image layers cannot contain setup or cleanup scripts"})
+	}
+	if len(g.Package.Triggers) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "trigger", Format: "OCI", Message: "OCI image layers cannot contain triggers"})
+	}
+	if len(g.Package.Services) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "service", Format: "OCI", Message: "OCI image layers cannot manage systemd units"})
+	}
+	return errs
+}
+
+//Build implements the build.Generator interface.
+func (g *Generator) Build() ([]byte, error) {
+	pkg := g.Package
+	//there is no alternatives system, so install the preferred alternatives
+	//as plain symlinks
+	err := pkg.InsertAlternativeSymlinks()
+	if err != nil {
+		return nil, err
+	}
+	err = pkg.PrepareBuild()
+	if err != nil {
+		return nil, err
+	}
+
+	//PrepareBuild() may have added a setup script for file ownership that
+	//cannot be represented in the archive
+	if len(pkg.Actions) > 0 {
+		return nil, errors.New("OCI image layers cannot contain setup or cleanup scripts (note that owners and groups must be given as numeric IDs)")
+	}
+
+	//build the layer, and compute the digest of the uncompressed layer on the
+	//way (the "DiffID" in the image config)
+	var layer bytes.Buffer
+	diffIDHash := sha256.New()
+	gzw := gzip.NewWriter(&layer)
+	endPhase := pkg.BeginPhase(build.PhaseCompress)
+	err = pkg.FSRoot.ToTarArchive(io.MultiWriter(gzw, diffIDHash), false, true)
+	if err == nil {
+		err = gzw.Close()
+	}
+	endPhase()
+	if err != nil {
+		return nil, err
+	}
+
+	//build the image config
+	p := platformMap[pkg.Architecture]
+	config, err := json.Marshal(imageConfig{
+		Architecture: p.Architecture,
+		Variant:      p.Variant,
+		OS:           "linux",
+		RootFS: imageRootFS{
+			Type:    "layers",
+			DiffIDs: []string{digestOf(diffIDHash)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//build the image manifest
+	configDesc := newDescriptor(mediaTypeConfig, config)
+	layerDesc := newDescriptor(mediaTypeLayer, layer.Bytes())
+	manifest, err := json.Marshal(imageManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeManifest,
+		Config:        configDesc,
+		Layers:        []descriptor{layerDesc},
+		Annotations: map[string]string{
+			"org.opencontainers.image.title":       pkg.Name,
+			"org.opencontainers.image.version":     fullVersionString(pkg),
+			"org.opencontainers.image.description": pkg.Description,
+			"org.opencontainers.image.authors":     pkg.Author,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//build the index, which is the entrypoint into the image layout
+	manifestDesc := newDescriptor(mediaTypeManifest, manifest)
+	manifestDesc.Annotations = map[string]string{
+		"org.opencontainers.image.ref.name": fullVersionString(pkg),
+	}
+	index, err := json.Marshal(imageIndex{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeIndex,
+		Manifests:     []descriptor{manifestDesc},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//assemble the image layout
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	entries := []struct {
+		Name    string
+		Content []byte
+	}{
+		{"oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)},
+		{"index.json", index},
+		{"blobs/", nil},
+		{"blobs/sha256/", nil},
+		{blobPath(configDesc), config},
+		{blobPath(layerDesc), layer.Bytes()},
+		{blobPath(manifestDesc), manifest},
+	}
+	for _, entry := range entries {
+		err := writeTarEntry(tw, entry.Name, entry.Content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tw.Close()
+	return buf.Bytes(), err
+}
+
+func writeTarEntry(tw *tar.Writer, name string, content []byte) error {
+	timestamp := time.Unix(0, 0)
+	hdr := &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(content)),
+		ModTime:  timestamp,
+	}
+	if strings.HasSuffix(name, "/") {
+		hdr.Typeflag = tar.TypeDir
+		hdr.Mode = 0755
+	}
+	err := filesystem.WriteTarHeader(tw, hdr)
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(content)
+	return err
+}
+
+func digestOf(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func blobPath(d descriptor) string {
+	return "blobs/sha256/" + strings.TrimPrefix(d.Digest, "sha256:")
+}
@@ -0,0 +1,79 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package oci
+
+import "crypto/sha256"
+
+//The media types from the OCI Image Format Specification that are used by
+//this generator.
+const (
+	mediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeLayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+//descriptor references a blob in the image layout.
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+func newDescriptor(mediaType string, content []byte) descriptor {
+	h := sha256.New()
+	h.Write(content)
+	return descriptor{
+		MediaType: mediaType,
+		Digest:    digestOf(h),
+		Size:      int64(len(content)),
+	}
+}
+
+//imageIndex is the structure of index.json in the image layout.
+type imageIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []descriptor `json:"manifests"`
+}
+
+//imageManifest is the structure of an image manifest.
+type imageManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        descriptor        `json:"config"`
+	Layers        []descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+//imageConfig is the structure of an image config. Only the fields that a
+//single layer can provide are included.
+type imageConfig struct {
+	Architecture string      `json:"architecture,omitempty"`
+	Variant      string      `json:"variant,omitempty"`
+	OS           string      `json:"os"`
+	RootFS       imageRootFS `json:"rootfs"`
+}
+
+type imageRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
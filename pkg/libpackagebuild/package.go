@@ -0,0 +1,739 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//Architecture is an enum that describes the target architecture for this
+//package (or "any" for packages without compiled binaries).
+type Architecture uint
+
+const (
+	// ArchitectureAny = no compiled binaries (default value!)
+	ArchitectureAny Architecture = iota
+	// ArchitectureI386 = i386
+	ArchitectureI386
+	// ArchitectureX86_64 = x86_64
+	ArchitectureX86_64
+	// ArchitectureARMv5 = ARMv5
+	ArchitectureARMv5
+	// ArchitectureARMv6h = ARMv6h (hardfloat)
+	ArchitectureARMv6h
+	// ArchitectureARMv7h = ARMv7h (hardfloat)
+	ArchitectureARMv7h
+	// ArchitectureAArch64 = AArch64 (ARMv8 64-bit)
+	ArchitectureAArch64
+)
+
+//PrereleaseType is an enum that describes whether the package is an alpha, beta or final release.
+type PrereleaseType uint
+
+const (
+	//PrereleaseTypeNone indicates a final release that does not have "alpha" or "beta" added to its version number.
+	PrereleaseTypeNone PrereleaseType = iota
+	//PrereleaseTypeAlpha indicates an alpha release.
+	PrereleaseTypeAlpha
+	//PrereleaseTypeBeta indicates a beta release.
+	PrereleaseTypeBeta
+)
+
+func (pt PrereleaseType) String() string {
+	switch pt {
+	case PrereleaseTypeNone:
+		return "none"
+	case PrereleaseTypeAlpha:
+		return "alpha"
+	case PrereleaseTypeBeta:
+		return "beta"
+	}
+	panic(fmt.Sprintf("unexpected value for PrereleaseType: %d", uint(pt)))
+}
+
+//Package contains all information about a single package. This representation
+//will be passed into the generator backends.
+type Package struct {
+	//Name is the package name.
+	Name string
+	//Version is the version for the package contents. This field shall contain
+	//only numbered versions separated by dots (e.g. "1.0" or "0.9.184.5" or
+	//"2020.10.05"). Other version strings cannot be guaranteed to generate valid
+	//outputs for all package formats. To specify an alpha or beta version, set
+	//the PrereleaseType and PrereleaseVersion fields. For instance,
+	//"1.2.0-beta.1" shall be encoded as (.Version = "1.2.0",
+	//.PrereleaseType = PrereleaseTypeBeta, .PrereleaseVersion = 1).
+	Version string
+	//PrereleaseType specifies whether this package is an alpha, beta or a final
+	//release.
+	PrereleaseType PrereleaseType
+	//PrereleaseVersion is a counter of prereleases of a given type.
+	//(.PrereleaseType = PrereleaseTypeAlpha, .PrereleaseVersion = 5) will append
+	//"alpha.5" to the package's version (with a separator appropriate for a
+	//given package format). The value in this field is ignored when
+	//.PrereleaseType is PrereleaseTypeNone.
+	PrereleaseVersion uint
+	//Release is a counter that can be increased when the same version of one
+	//package needs to be rebuilt. The default value shall be 1.
+	Release uint
+	//Epoch is a counter that can be increased when the version of a newer
+	//package is smaller than the previous version, thus breaking normal
+	//version comparison logic. This is usually only necessary when changing to
+	//a different version numbering scheme. The default value is 0, which
+	//usually results in the epoch not being shown in the combined version
+	//string at all.
+	Epoch uint
+	//Description is the optional package description.
+	Description string
+	//Author contains the package's author's name and mail address in the form
+	//"Firstname Lastname <email.address@server.tld>", if this information is
+	//available.
+	Author string
+	//Architecture specifies the target architecture of this package.
+	Architecture Architecture
+	//ArchitectureInput contains the raw architecture string specified by the
+	//user (used only for error messages).
+	ArchitectureInput string
+	//Requires contains a list of other packages that are required dependencies
+	//for this package and thus must be installed together with this package.
+	//This is called "Depends" by some package managers.
+	Requires []PackageRelation
+	//Provides contains a list of packages that this package provides features
+	//of (or virtual packages whose capabilities it implements).
+	Provides []PackageRelation
+	//Conflicts contains a list of other packages that cannot be installed at
+	//the same time as this package.
+	Conflicts []PackageRelation
+	//Replaces contains a list of obsolete packages that are replaced by this
+	//package. Upon performing a system upgrade, the obsolete packages will be
+	//automatically replaced by this package.
+	Replaces []PackageRelation
+	//Supersedes contains a list of packages that this package is the
+	//successor of (usually because it was renamed). Generators expand this
+	//into Provides, Conflicts and Replaces entries according to the
+	//conventions of their package format (see FoldSupersedes()).
+	Supersedes []PackageRelation
+	//Actions contains a list of actions that can be executed while the package
+	//manager runs.
+	Actions []PackageAction
+	//Triggers contains a list of actions that are executed when other
+	//packages (or files in certain paths) are installed, upgraded or removed.
+	Triggers []PackageTrigger
+	//Services contains a list of systemd units whose state is managed by the
+	//package's maintainer scripts.
+	Services []PackageService
+	//Alternatives contains a list of entries for the alternatives system of
+	//the distribution (update-alternatives).
+	Alternatives []PackageAlternative
+	//AutoProvides enables the generation of Provides entries for the shared
+	//libraries and pkg-config files in the package (see SharedLibraries() and
+	//PkgConfigModules()), in the conventions of each package format.
+	AutoProvides bool
+	//AutoRequires enables the generation of Requires entries for the
+	//interpreters and shared libraries that the package's files need (see
+	//FileDependencies() and AddAutoRequires()).
+	AutoRequires bool
+	//HologramProvides enables a virtual Provides entry that identifies the
+	//package as a Holo hologram independently of its name (see
+	//AddHologramProvides()).
+	HologramProvides bool
+	//DependencyMappings overrides the package names that AddAutoRequires()
+	//chooses for individual dependencies.
+	DependencyMappings []DependencyMapping
+	//Debian contains properties that are only used for Debian packages.
+	Debian DebianOptions
+	//Pacman contains properties that are only used for Pacman packages.
+	Pacman PacmanOptions
+	//MaxInstalledSize and MaxPackageSize are optional limits (in bytes) for
+	//the installed size of the package (see Directory.InstalledSizeInBytes)
+	//and for the size of the generated package file. Zero means no limit. The
+	//generators do not enforce these limits; this is up to the caller.
+	MaxInstalledSize int64
+	MaxPackageSize   int64
+	//Checks contains assertions about the generated package. Like the size
+	//limits above, the generators do not evaluate them; this is up to the
+	//caller.
+	Checks []PackageCheck
+	//FSRoot represents the root directory of the package's file system, and
+	//contains all other files and directories recursively.
+	FSRoot *filesystem.Directory
+	//PathPrefix is an optional absolute path (e.g. "/opt/myorg"). If given,
+	//all entries in FSRoot will be relocated below this path at build time.
+	//Absolute symlink targets that point to entries inside the package are
+	//relocated in the same way.
+	PathPrefix string
+	//Progress optionally receives progress information while the package is
+	//being built (see BeginPhase).
+	Progress ProgressReporter
+	//Jobs is the number of files that ComputeDigests() reads at the same
+	//time. Values below 2 mean that files are read one after another.
+	Jobs int
+	//isRelocated is set by PrepareBuild() when PathPrefix has been applied.
+	isRelocated bool
+}
+
+//DebianOptions contains the properties of a Package that only exist in the
+//control archive of Debian packages.
+type DebianOptions struct {
+	//MultiArch is the value of the "Multi-Arch" field ("no", "same",
+	//"foreign" or "allowed"), or empty to omit the field.
+	MultiArch string
+	//Essential marks the package as essential, i.e. dpkg refuses to remove
+	//it unless forced to.
+	Essential bool
+	//Protected marks the package as protected, i.e. dpkg refuses to remove it
+	//unless forced to (like Essential, but without requiring that the package
+	//is always installed). This requires dpkg 1.20.1 or newer.
+	Protected bool
+	//Templates is the contents of the debconf "templates" file, or empty if
+	//the package does not use debconf.
+	Templates string
+	//Config is the debconf "config" script, which asks the questions from
+	//Templates before the package is unpacked. If it does not start with a
+	//shebang line, a skeleton that loads the debconf module is added.
+	Config string
+}
+
+//PacmanOptions contains the properties of a Package that only appear in the
+//.PKGINFO file of Pacman packages.
+type PacmanOptions struct {
+	//PackageBase is the value of the "pkgbase" field, i.e. the name of the
+	//PKGBUILD that the package is built from. If empty, the package name is
+	//used, without the "-debug" suffix for debug packages.
+	PackageBase string
+	//PackageType is the value of "pkgtype" in the "xdata" field ("pkg",
+	//"split" or "debug"). If not empty, the "xdata" field is written.
+	PackageType string
+	//XData causes the "xdata" field to be written even if PackageType is
+	//empty, with "pkgtype=pkg". makepkg writes this field since version 6.1.
+	XData bool
+}
+
+//PackageRelation declares a relation to another package. For the related
+//package, any number of version constraints may be given. For example, the
+//following snippet makes a Package require any version of package "foo", and
+//at least version 2.1.2 (but less than version 3.0) of package "bar".
+//
+//    pkg.Requires := []PackageRelation{
+//        PackageRelation { "foo", nil },
+//        PackageRelation { "bar", []VersionConstraint{
+//            VersionConstraint { ">=", "2.1.2" },
+//            VersionConstraint { "<",  "3.0"   },
+//        }
+//    }
+type PackageRelation struct {
+	RelatedPackage string
+	Constraints    []VersionConstraint
+}
+
+//VersionConstraint is used by the PackageRelation struct to specify version
+//constraints for a related package.
+type VersionConstraint struct {
+	//Relation is one of "<", "<=", "=", ">=" or ">".
+	Relation string
+	//Version is the version on the right side of the Relation, e.g. "1.2.3-1"
+	//or "2:20151024-1.1".  This field is not structured further in this level
+	//since the acceptable version format may depend on the package generator
+	//used.
+	Version string
+}
+
+//PackageAction describes an action that can be executed by the package manager
+//at various points during its execution.
+type PackageAction struct {
+	//Type determines when this action will be run. Acceptable values include
+	//`SetupAction`, `CleanupAction`, `PreSetupAction`, `PreCleanupAction`,
+	//`PreTransactionAction`, `PostTransactionAction` and `VerifyAction`.
+	Type uint
+	//Content is a shell script that will be executed when the action is run.
+	Content string
+	//Interpreter is the absolute path of the program that runs Content, or
+	//empty if Content is a shell script.
+	Interpreter string
+}
+
+//PackageTrigger describes an action that is executed by the package manager
+//after other packages, or files below certain paths, have been installed,
+//upgraded or removed.
+type PackageTrigger struct {
+	//Paths contains the absolute paths of files or directories whose changes
+	//activate the trigger. For directories, all files below it are watched.
+	Paths []string
+	//Packages contains the names of packages whose installation, upgrade or
+	//removal activates the trigger.
+	Packages []string
+	//Content is the script that will be executed when the trigger is
+	//activated.
+	Content string
+	//Interpreter is the absolute path of the program that runs Content, or
+	//empty if Content is a shell script.
+	Interpreter string
+}
+
+//Script returns the trigger's script as a shell script. If the trigger has an
+//Interpreter, the script is passed to it on stdin.
+func (t PackageTrigger) Script() string {
+	if t.Interpreter == "" {
+		return t.Content
+	}
+	return wrapScript(t.Content, t.Interpreter)
+}
+
+//PackageService describes a systemd unit that is enabled when the package is
+//installed, restarted when it is upgraded, and disabled when it is removed.
+//Generators translate this into the respective conventions of the
+//distribution, e.g. deb-systemd-helper for Debian packages.
+type PackageService struct {
+	//Unit is the name of the systemd unit, e.g. "foo.service".
+	Unit string
+	//Enable causes the unit to be enabled and started when the package is
+	//installed for the first time.
+	Enable bool
+	//RestartOnUpgrade causes the unit to be restarted (if it is running) when
+	//the package is upgraded.
+	RestartOnUpgrade bool
+}
+
+//PackageAlternative describes a candidate for a generic path (e.g.
+///usr/bin/editor) that is managed by the alternatives system of the
+//distribution. Generators for package formats without an alternatives system
+//can use InsertAlternativeSymlinks() as a fallback.
+type PackageAlternative struct {
+	//Name identifies the link group, e.g. "editor".
+	Name string
+	//Link is the generic path, e.g. "/usr/bin/editor".
+	Link string
+	//Path is the path that Link points to if this alternative is selected,
+	//e.g. "/usr/bin/vim".
+	Path string
+	//Priority decides which alternative is selected automatically.
+	Priority int
+}
+
+//PackageCheck is an assertion about the generated package (see
+//Package.Checks). All non-empty fields must hold for the check to pass. Paths
+//are given as in FSRoot, i.e. without the PathPrefix.
+type PackageCheck struct {
+	//PathExists is a path that must be an entry in the package.
+	PathExists string
+	//Mode, if HasMode is true, is the mode that the entry at PathExists must
+	//have.
+	Mode    os.FileMode
+	HasMode bool
+	//PathMissing is a path that may not be an entry in the package.
+	PathMissing string
+	//ScriptContains is a string that must occur in one of the package's
+	//maintainer scripts.
+	ScriptContains string
+}
+
+const (
+	//SetupAction is an acceptable value for `PackageAction.Type`. Setup
+	//actions run immediately after the package has been installed or upgraded
+	//on a system.
+	SetupAction = iota
+	//CleanupAction is an acceptable value for `PackageAction.Type`. Cleanup
+	//actions run immediately after the package has been removed from a system.
+	CleanupAction
+	//PreSetupAction is an acceptable value for `PackageAction.Type`. Pre-setup
+	//actions run immediately before the package is installed or upgraded on a
+	//system, i.e. before the package's files are extracted.
+	PreSetupAction
+	//PreCleanupAction is an acceptable value for `PackageAction.Type`.
+	//Pre-cleanup actions run immediately before the package is removed from a
+	//system, i.e. while the package's files are still in place.
+	PreCleanupAction
+	//PreTransactionAction is an acceptable value for `PackageAction.Type`.
+	//Pre-transaction actions run before the package manager starts to install
+	//any of the packages in the transaction that installs or upgrades this
+	//package. Generators for package formats without transaction scripts can
+	//use FoldTransactionActions() as a fallback.
+	PreTransactionAction
+	//PostTransactionAction is an acceptable value for `PackageAction.Type`.
+	//Post-transaction actions run after the package manager has installed all
+	//packages in the transaction that installs or upgrades this package.
+	PostTransactionAction
+	//VerifyAction is an acceptable value for `PackageAction.Type`. Verify
+	//actions run when the installed package is verified (e.g. with `rpm -V`).
+	//Generators for package formats that have other scripts, but no verify
+	//scripts, ignore them.
+	VerifyAction
+)
+
+//PrepareBuild executes common preparation steps. This should be called by each
+//generator's Build() implementation.
+func (p *Package) PrepareBuild() error {
+	err := p.Relocate()
+	if err != nil {
+		return err
+	}
+	script := p.FSRoot.PostponeUnmaterializable("/")
+	if script != "" {
+		script = strings.TrimSuffix(script, "\n")
+		p.PrependActions(PackageAction{Type: SetupAction, Content: script})
+	}
+	return nil
+}
+
+//Relocate moves all entries in p.FSRoot below p.PathPrefix. This is part of
+//PrepareBuild(), and only needs to be called directly by generators that do
+//not call PrepareBuild() because they can represent owners and groups by name.
+func (p *Package) Relocate() error {
+	prefix := p.cleanPathPrefix()
+	if prefix == "/" || p.isRelocated {
+		return nil
+	}
+
+	//collect all paths in the package, to decide which symlink targets point
+	//into the package
+	paths := make(map[string]bool)
+	p.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		paths[absolutePath] = true
+		return nil
+	})
+
+	//the old root directory becomes the directory at the prefix path
+	oldRoot := p.FSRoot
+	p.FSRoot = filesystem.NewDirectory()
+	p.FSRoot.Implicit = true
+	err := p.InsertFSNode(prefix, oldRoot)
+	if err != nil {
+		p.FSRoot = oldRoot
+		return err
+	}
+	p.isRelocated = true
+
+	oldRoot.Walk("/", func(absolutePath string, node filesystem.Node) error {
+		link, ok := node.(*filesystem.Symlink)
+		if ok && strings.HasPrefix(link.Target, "/") && paths[path.Clean(link.Target)] {
+			link.Target = path.Join(prefix, link.Target)
+		}
+		return nil
+	})
+	return nil
+}
+
+func (p *Package) cleanPathPrefix() string {
+	return path.Clean("/" + p.PathPrefix)
+}
+
+//UnprefixedPath takes an absolute or relative path from the package's file
+//system, and removes the PathPrefix from it if PrepareBuild() has relocated the
+//FSRoot. Generators can use this to apply rules that depend on the original
+//location of a file.
+func (p *Package) UnprefixedPath(fsPath string) string {
+	if !p.isRelocated {
+		return fsPath
+	}
+	prefix := p.cleanPathPrefix()
+	if strings.HasPrefix(fsPath, "/") {
+		return strings.TrimPrefix(fsPath, prefix)
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(fsPath, strings.TrimPrefix(prefix, "/")), "/")
+}
+
+//InsertAlternativeSymlinks is a fallback for package formats without an
+//alternatives system: For each link in p.Alternatives, a symlink to the path
+//with the highest priority is inserted into the package. This must be called
+//before PrepareBuild() or Relocate().
+func (p *Package) InsertAlternativeSymlinks() error {
+	best := make(map[string]PackageAlternative)
+	var links []string
+	for _, alt := range p.Alternatives {
+		other, exists := best[alt.Link]
+		if !exists {
+			links = append(links, alt.Link)
+		}
+		if !exists || alt.Priority > other.Priority {
+			best[alt.Link] = alt
+		}
+	}
+	for _, link := range links {
+		err := p.InsertFSNode(link, &filesystem.Symlink{Target: best[link].Path})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//FoldTransactionActions is a fallback for package formats without transaction
+//scripts: Pre-transaction actions are turned into pre-setup actions that run
+//before the existing ones, and post-transaction actions are turned into setup
+//actions that run after the existing ones.
+func (p *Package) FoldTransactionActions() {
+	var preTransaction, others, postTransaction []PackageAction
+	for _, action := range p.Actions {
+		switch action.Type {
+		case PreTransactionAction:
+			action.Type = PreSetupAction
+			preTransaction = append(preTransaction, action)
+		case PostTransactionAction:
+			action.Type = SetupAction
+			postTransaction = append(postTransaction, action)
+		default:
+			others = append(others, action)
+		}
+	}
+	p.Actions = append(append(preTransaction, others...), postTransaction...)
+}
+
+//FoldSupersedes expands the Supersedes list into Provides, Conflicts and
+//Replaces entries. The version constraints of each superseded package are
+//copied into the Conflicts and Replaces entries. The Provides entries have the
+//given version (or no version if it is empty, for package formats that do not
+//support versioned provides). Conflicts entries are only added if
+//withConflicts is true, since some package formats imply them for replaced
+//packages. Packages that are already in the respective list are not added
+//again.
+func (p *Package) FoldSupersedes(providesVersion string, withConflicts bool) {
+	for _, rel := range p.Supersedes {
+		provided := PackageRelation{RelatedPackage: rel.RelatedPackage}
+		if providesVersion != "" {
+			provided.Constraints = []VersionConstraint{{Relation: "=", Version: providesVersion}}
+		}
+		p.Provides = appendRelation(p.Provides, provided)
+		if withConflicts {
+			p.Conflicts = appendRelation(p.Conflicts, rel)
+		}
+		p.Replaces = appendRelation(p.Replaces, rel)
+	}
+	p.Supersedes = nil
+}
+
+//AddHologramProvides adds the Provides entry for HologramProvides, if it is
+//set. Since the naming conventions for virtual packages differ between package
+//formats, the name of the provided package is given by the caller (e.g.
+//"hologram(foo)" for RPM or "hologram-foo" for Debian). The Provides entry has
+//the given version (or no version if it is empty, for package formats that do
+//not support versioned provides).
+func (p *Package) AddHologramProvides(name, version string) {
+	if !p.HologramProvides {
+		return
+	}
+	provided := PackageRelation{RelatedPackage: name}
+	if version != "" {
+		provided.Constraints = []VersionConstraint{{Relation: "=", Version: version}}
+	}
+	p.Provides = appendRelation(p.Provides, provided)
+}
+
+//appendRelation appends the relation to the list, unless the list already
+//contains a relation to the same package.
+func appendRelation(rels []PackageRelation, rel PackageRelation) []PackageRelation {
+	for _, other := range rels {
+		if other.RelatedPackage == rel.RelatedPackage {
+			return rels
+		}
+	}
+	return append(rels, rel)
+}
+
+//RelocatedAlternatives returns p.Alternatives with the PathPrefix applied to
+//each Link, and to each Path that refers to a file in the package (like
+//Relocate() does for symlink targets). This must be called after
+//PrepareBuild() or Relocate().
+func (p *Package) RelocatedAlternatives() []PackageAlternative {
+	prefix := p.cleanPathPrefix()
+	if prefix == "/" {
+		return p.Alternatives
+	}
+
+	paths := make(map[string]bool)
+	p.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		paths[absolutePath] = true
+		return nil
+	})
+	result := make([]PackageAlternative, len(p.Alternatives))
+	for idx, alt := range p.Alternatives {
+		alt.Link = path.Join(prefix, alt.Link)
+		if relocatedPath := path.Join(prefix, alt.Path); paths[relocatedPath] {
+			alt.Path = relocatedPath
+		}
+		result[idx] = alt
+	}
+	return result
+}
+
+//PrependActions prepends elements to p.Actions.
+func (p *Package) PrependActions(actions ...PackageAction) {
+	p.Actions = append(actions, p.Actions...)
+}
+
+//AppendActions appends elements to p.Actions.
+func (p *Package) AppendActions(actions ...PackageAction) {
+	p.Actions = append(p.Actions, actions...)
+}
+
+//Script returns the concatenation of the scripts for all actions of the given
+//type, as a shell script. Actions with an Interpreter are run by passing their
+//script to the interpreter on stdin.
+func (p *Package) Script(actionType uint) string {
+	var scripts []string
+	for _, action := range p.Actions {
+		if action.Type != actionType {
+			continue
+		}
+		if action.Interpreter == "" {
+			scripts = append(scripts, action.Content)
+		} else {
+			scripts = append(scripts, wrapScript(action.Content, action.Interpreter))
+		}
+	}
+	return strings.TrimSpace(strings.Join(scripts, "\n"))
+}
+
+//ScriptWithInterpreter is like Script, but if all actions of the given type
+//use the same Interpreter, their scripts are returned unwrapped together with
+//that interpreter, so that package formats that can choose the interpreter of
+//their scripts can use it directly. Otherwise, it returns Script(actionType)
+//and an empty interpreter, which denotes the format's default shell.
+func (p *Package) ScriptWithInterpreter(actionType uint) (script, interpreter string) {
+	var scripts []string
+	for _, action := range p.Actions {
+		if action.Type != actionType {
+			continue
+		}
+		if action.Interpreter == "" || (len(scripts) > 0 && action.Interpreter != interpreter) {
+			return p.Script(actionType), ""
+		}
+		interpreter = action.Interpreter
+		scripts = append(scripts, action.Content)
+	}
+	return strings.TrimSpace(strings.Join(scripts, "\n")), interpreter
+}
+
+//wrapScript embeds a script for the given interpreter into a shell script
+//using a here-document.
+func wrapScript(script, interpreter string) string {
+	delimiter := "HOLO_SCRIPT_END"
+	lines := strings.Split(script, "\n")
+	for containsString(lines, delimiter) {
+		delimiter += "_"
+	}
+	return fmt.Sprintf("%s <<'%s'\n%s\n%s", interpreter, delimiter, script, delimiter)
+}
+
+func containsString(list []string, value string) bool {
+	for _, elem := range list {
+		if elem == value {
+			return true
+		}
+	}
+	return false
+}
+
+//InsertFSNode inserts a filesystem.Node into the package's FSRoot at the given
+//absolute path.
+func (p *Package) InsertFSNode(absolutePath string, entry filesystem.Node) error {
+	relPath, err := filepath.Rel("/", absolutePath)
+	if err != nil {
+		return err
+	}
+	err = p.FSRoot.Insert(entry, strings.Split(relPath, "/"), "/")
+	if err != nil {
+		return fmt.Errorf("failed to insert \"%s\" into the package file system: %s", absolutePath, err.Error())
+	}
+	return nil
+}
+
+//RemoveFSNode removes the entry at the given absolute path (including all
+//entries below it) from the package's filesystem, and returns it.
+func (p *Package) RemoveFSNode(absolutePath string) (filesystem.Node, error) {
+	relPath, err := filepath.Rel("/", absolutePath)
+	if err != nil {
+		return nil, err
+	}
+	node, err := p.FSRoot.Remove(strings.Split(relPath, "/"), "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove \"%s\" from the package file system: %s", absolutePath, err.Error())
+	}
+	return node, nil
+}
+
+//WalkFSWithAbsolutePaths wraps the FSRoot.Wrap function, yielding absolute
+//paths (with a leading slash) to the callback.
+func (p *Package) WalkFSWithAbsolutePaths(callback func(absolutePath string, node filesystem.Node) error) error {
+	return p.FSRoot.Walk("/", callback)
+}
+
+//ComputeDigests computes the digests of all regular files in this package
+//(see filesystem.RegularFile.Digests). Generators call this before they need
+//the digests, so that each file is read only once, and so that read errors
+//are reported before any archive is written. Up to p.Jobs files are read in
+//parallel. If multiple files cannot be read, the error for the first of them
+//(in the order of WalkFSWithAbsolutePaths) is returned.
+func (p *Package) ComputeDigests() error {
+	endPhase := p.BeginPhase(PhasePayload)
+	defer endPhase()
+
+	var (
+		paths []string
+		files []*filesystem.RegularFile
+	)
+	p.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		if file, ok := node.(*filesystem.RegularFile); ok {
+			paths = append(paths, absolutePath)
+			files = append(files, file)
+		}
+		return nil
+	})
+
+	//each worker only writes into the slots of the files it has taken, so
+	//the results do not depend on the scheduling of the workers
+	errs := make([]error, len(files))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < p.Jobs || worker == 0; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				_, errs[idx] = files[idx].Digests()
+			}
+		}()
+	}
+	for idx := range files {
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+
+	for idx, err := range errs {
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %s", paths[idx], err.Error())
+		}
+	}
+	return nil
+}
+
+//WalkFSWithRelativePaths wraps the FSRoot.Wrap function, yielding paths
+//relative to the FSRoot (without leading slash) to the callback. The FSRoot
+//itself will be visited with `relativePath = ""`.
+func (p *Package) WalkFSWithRelativePaths(callback func(relativePath string, node filesystem.Node) error) error {
+	return p.FSRoot.Walk("", callback)
+}
@@ -0,0 +1,63 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package pacman
+
+import (
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//addAutoProvides adds Provides entries for the package's shared libraries in
+//the same form as makepkg, e.g. "libfoo.so=1-64" for "libfoo.so.1". makepkg
+//does not generate Provides entries for pkg-config files and neither do we.
+//Libraries with a SONAME that does not end in ".so.<version>" are skipped.
+func addAutoProvides(pkg *build.Package) error {
+	libs, err := pkg.SharedLibraries()
+	if err != nil {
+		return err
+	}
+
+	for _, lib := range libs {
+		idx := strings.Index(lib.SOName, ".so.")
+		if idx < 0 {
+			continue
+		}
+		name := lib.SOName[:idx+3]
+		version := lib.SOName[idx+4:] + "-32"
+		if lib.Is64Bit {
+			version = lib.SOName[idx+4:] + "-64"
+		}
+
+		exists := false
+		for _, rel := range pkg.Provides {
+			if rel.RelatedPackage == name && len(rel.Constraints) == 1 && rel.Constraints[0].Version == version {
+				exists = true
+			}
+		}
+		if !exists {
+			pkg.Provides = append(pkg.Provides, build.PackageRelation{
+				RelatedPackage: name,
+				Constraints:    []build.VersionConstraint{{Relation: "=", Version: version}},
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package pacman
+
+import (
+	"path"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//dependencyPackages maps the file names of common interpreters and shared
+//libraries to the Arch Linux packages that contain them.
+var dependencyPackages = map[string]string{
+	"sh":                    "bash",
+	"bash":                  "bash",
+	"perl":                  "perl",
+	"python":                "python",
+	"python3":               "python",
+	"ruby":                  "ruby",
+	"node":                  "nodejs",
+	"php":                   "php",
+	"ld-linux.so.2":         "glibc",
+	"ld-linux-armhf.so.3":   "glibc",
+	"ld-linux-aarch64.so.1": "glibc",
+	"ld-linux-x86-64.so.2":  "glibc",
+	"libc.so.6":             "glibc",
+	"libdl.so.2":            "glibc",
+	"libm.so.6":             "glibc",
+	"libpthread.so.0":       "glibc",
+	"libresolv.so.2":        "glibc",
+	"librt.so.1":            "glibc",
+	"libutil.so.1":          "glibc",
+}
+
+//dependencyPackage translates a build.FileDependency into the name of the
+//package that satisfies it (see build.Package.AddAutoRequires).
+func dependencyPackage(dep build.FileDependency) string {
+	return dependencyPackages[path.Base(dep.Name())]
+}
@@ -0,0 +1,511 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package pacman provides a build.Generator for Pacman packages (as used by Arch Linux).
+package pacman
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//Generator is the build.Generator for Pacman packages (as used by Arch Linux
+//and derivatives).
+type Generator struct {
+	Package *build.Package
+	//Jobs is the number of threads used by xz (see filesystem.XZArguments).
+	Jobs int
+	//GroupResolver resolves requirements on package groups. If nil, a shared
+	//PacmanGroupResolver is used.
+	GroupResolver GroupResolver
+
+	//state shared between Plan() and Render()
+	plan *build.Plan
+}
+
+//GeneratorFactory spawns Generator instances. It satisfies the build.GeneratorFactory type.
+func GeneratorFactory(pkg *build.Package) build.Generator {
+	return &Generator{Package: pkg}
+}
+
+var archMap = map[build.Architecture]string{
+	build.ArchitectureAny:     "any",
+	build.ArchitectureI386:    "i686",
+	build.ArchitectureX86_64:  "x86_64",
+	build.ArchitectureARMv5:   "arm",
+	build.ArchitectureARMv6h:  "armv6h",
+	build.ArchitectureARMv7h:  "armv7h",
+	build.ArchitectureAArch64: "aarch64",
+}
+
+//SupportedArchitectures implements the build.Generator interface.
+func (g *Generator) SupportedArchitectures() map[build.Architecture]string {
+	return archMap
+}
+
+//Capabilities implements the build.CapabilityReporter interface.
+func (g *Generator) Capabilities() build.Capabilities {
+	return build.Capabilities{
+		Compressions: []string{"xz"},
+		Actions:      true,
+		Triggers:     true,
+		Services:     true,
+	}
+}
+
+//RecommendedFileName implements the build.Generator interface.
+func (g *Generator) RecommendedFileName() string {
+	c := g.RecommendedFileNameComponents()
+	return fmt.Sprintf("%s-%s-%s%s", c.Name, c.FullVersion, c.ArchString, c.Extension)
+}
+
+//RecommendedFileNameComponents implements the build.Generator interface.
+func (g *Generator) RecommendedFileNameComponents() build.FileNameComponents {
+	//this is called after Build(), so we can assume that package name,
+	//version, etc. were already validated
+	pkg := g.Package
+	return build.FileNameComponents{
+		Name:        pkg.Name,
+		FullVersion: fullVersionString(pkg),
+		ArchString:  archMap[pkg.Architecture],
+		Extension:   ".pkg.tar.xz",
+	}
+}
+
+//Validate implements the build.Generator interface.
+func (g *Generator) Validate() []error {
+	var nameRx = `[a-z0-9@._+][a-z0-9@._+-]*`
+	var versionRx = `[a-zA-Z0-9._]+`
+	errs := g.Package.ValidateWith(build.RegexSet{
+		PackageName:    nameRx,
+		PackageVersion: versionRx,
+		RelatedName:    "(?:except:)?(?:group:)?" + nameRx,
+		RelatedVersion: "(?:[0-9]+:)?" + versionRx + "(?:-[1-9][0-9]*)?", //incl. release/epoch
+		FormatName:     "pacman",
+	}, archMap)
+
+	errs = append(errs, g.validatePacmanOptions(nameRx)...)
+
+	//metadata files like .PKGINFO and .MTREE live next to the package
+	//contents, and pacman ignores all other top-level dotfiles as well
+	return append(errs, g.Package.ValidateReservedPaths("pacman", isTopLevelDotfile)...)
+}
+
+//debugPathPrefixes are the directories where makepkg puts the contents of
+//debug packages.
+var debugPathPrefixes = []string{"/usr/lib/debug/", "/usr/src/debug/"}
+
+//validatePacmanOptions checks the fields of build.PacmanOptions.
+func (g *Generator) validatePacmanOptions(nameRx string) []error {
+	var errs []error
+	pkg := g.Package
+	switch pkg.Pacman.PackageType {
+	case "", "pkg", "split", "debug":
+	default:
+		errs = append(errs, &build.ValidationError{
+			Field:   "pacman.pkgtype",
+			Format:  "Pacman",
+			Message: fmt.Sprintf("invalid value \"%s\" for \"pkgtype\" (must be \"pkg\", \"split\" or \"debug\")", pkg.Pacman.PackageType),
+		})
+	}
+	if pkg.Pacman.PackageBase != "" && !regexp.MustCompile("^"+nameRx+"$").MatchString(pkg.Pacman.PackageBase) {
+		errs = append(errs, &build.ValidationError{
+			Field:   "pacman.pkgbase",
+			Format:  "Pacman",
+			Message: fmt.Sprintf("invalid value \"%s\" for \"pkgbase\" (not a valid package name)", pkg.Pacman.PackageBase),
+		})
+	}
+	if pkg.Pacman.PackageType != "debug" {
+		return errs
+	}
+
+	//makepkg names debug packages "$pkgbase-debug" and only puts detached
+	//symbols and sources into them
+	if pkg.Name != "" && !strings.HasSuffix(pkg.Name, "-debug") {
+		errs = append(errs, &build.ValidationError{
+			Field:   "package.name",
+			Format:  "Pacman",
+			Message: fmt.Sprintf("package name \"%s\" must end in \"-debug\" for \"pkgtype = debug\"", pkg.Name),
+		})
+	}
+	pkg.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		if _, isDir := node.(*filesystem.Directory); isDir || isTopLevelDotfile(absolutePath) {
+			return nil
+		}
+		for _, prefix := range debugPathPrefixes {
+			if strings.HasPrefix(absolutePath, prefix) {
+				return nil
+			}
+		}
+		errs = append(errs, &build.ValidationError{
+			Path:     absolutePath,
+			Severity: build.SeverityWarning,
+			Format:   "Pacman",
+			Message:  fmt.Sprintf("debug package contains \"%s\", which should be below /usr/lib/debug or /usr/src/debug", absolutePath),
+		})
+		return nil
+	})
+	return errs
+}
+
+func isTopLevelDotfile(absolutePath string) bool {
+	return path.Dir(absolutePath) == "/" && strings.HasPrefix(path.Base(absolutePath), ".")
+}
+
+//Build implements the build.Generator interface.
+func (g *Generator) Build() ([]byte, error) {
+	plan, err := g.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return g.Render(plan)
+}
+
+//Plan implements the build.Planner interface.
+func (g *Generator) Plan() (*build.Plan, error) {
+	if g.plan != nil {
+		return g.plan, nil
+	}
+
+	pkg := g.Package
+	//there is no alternatives system, so install the preferred alternatives
+	//as plain symlinks
+	err := pkg.InsertAlternativeSymlinks()
+	if err != nil {
+		return nil, err
+	}
+	//there are no transaction scripts, so run these actions together with
+	//the other setup actions
+	pkg.FoldTransactionActions()
+	//versioned provides allow the new package to satisfy versioned
+	//requirements on the old one
+	pkg.FoldSupersedes(fullVersionString(pkg), true)
+	pkg.AddHologramProvides("hologram-"+pkg.Name, fullVersionString(pkg))
+	err = pkg.PrepareBuild()
+	if err != nil {
+		return nil, err
+	}
+
+	//add alpm hooks for triggers
+	err = writeHooks(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	//read every file once to compute its digests
+	err = pkg.ComputeDigests()
+	if err != nil {
+		return nil, err
+	}
+	err = addAutoProvides(pkg)
+	if err != nil {
+		return nil, err
+	}
+	err = pkg.AddAutoRequires("pacman", dependencyPackage)
+	if err != nil {
+		return nil, err
+	}
+
+	//write .PKGINFO
+	err = writePKGINFO(pkg, g.groupResolver())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write .PKGINFO: %w", err)
+	}
+
+	//write .INSTALL
+	writeINSTALL(pkg)
+
+	//write mtree
+	err = writeMTREE(pkg)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write .MTREE: %s", err.Error())
+	}
+
+	//the metadata files are part of the package contents, so the metadata
+	//values can be taken from .PKGINFO directly
+	plan := &build.Plan{Format: "pacman"}
+	pkginfo := pkg.FSRoot.Entries[".PKGINFO"].(*filesystem.RegularFile)
+	for _, line := range strings.Split(string(pkginfo.Content), "\n") {
+		fields := strings.SplitN(line, " = ", 2)
+		if len(fields) == 2 && !strings.HasPrefix(line, "#") {
+			plan.Metadata = append(plan.Metadata, build.PlanValue{Key: fields[0], Value: fields[1]})
+		}
+	}
+	archive, err := build.NewPlanArchive(g.RecommendedFileName(), pkg.FSRoot, func(absolutePath string, node filesystem.Node) bool {
+		return absolutePath != "/"
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan.Archives = []build.PlanArchive{archive}
+
+	g.plan = plan
+	return plan, nil
+}
+
+//Render implements the build.Planner interface.
+func (g *Generator) Render(plan *build.Plan) ([]byte, error) {
+	//prepare the package (if not done yet) to have the file contents ready
+	_, err := g.Plan()
+	if err != nil {
+		return nil, err
+	}
+	if plan.Format != "pacman" {
+		return nil, fmt.Errorf("cannot render a plan for format \"%s\" as a Pacman package", plan.Format)
+	}
+	archive, err := plan.Archive(g.RecommendedFileName())
+	if err != nil {
+		return nil, err
+	}
+
+	//.PKGINFO is rendered from the metadata values in the plan, and .MTREE
+	//from the resulting archive members (the other metadata files are taken
+	//as they are, like the package contents)
+	pkg := g.Package
+	contents := pkg.FSRoot.ShallowCopy()
+	contents.Entries[".PKGINFO"] = &filesystem.RegularFile{
+		Content:  []byte(renderPKGINFO(plan.Metadata)),
+		Metadata: filesystem.NodeMetadata{Mode: 0644},
+	}
+	root, err := archive.ToDirectory(contents, "/.PKGINFO", "/.MTREE")
+	if err != nil {
+		return nil, err
+	}
+	if mtree, ok := root.Entries[".MTREE"].(*filesystem.RegularFile); ok {
+		mtree.Content, err = makeMTREE(root)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to write .MTREE: %s", err.Error())
+		}
+	}
+
+	//compress package
+	var buf bytes.Buffer
+	endPhase := pkg.BeginPhase(build.PhaseCompress)
+	err = root.ToParallelTarXZArchive(&buf, false, true, g.Jobs)
+	endPhase()
+	return buf.Bytes(), err
+}
+
+//renderPKGINFO renders .PKGINFO from the metadata values of a build.Plan (see
+//Plan()).
+func renderPKGINFO(values []build.PlanValue) string {
+	var b strings.Builder
+	b.WriteString(pkginfoHeader)
+	for _, value := range values {
+		fmt.Fprintf(&b, "%s = %s\n", value.Key, value.Value)
+	}
+	return b.String()
+}
+
+func fullVersionString(pkg *build.Package) string {
+	var b strings.Builder
+
+	if pkg.Epoch > 0 {
+		fmt.Fprintf(&b, "%d:", pkg.Epoch)
+	}
+
+	b.WriteString(pkg.Version)
+
+	if pkg.PrereleaseType != build.PrereleaseTypeNone {
+		fmt.Fprintf(&b, "%s.%d", pkg.PrereleaseType.String(), pkg.PrereleaseVersion)
+	}
+
+	fmt.Fprintf(&b, "-%d", pkg.Release)
+
+	return b.String()
+}
+
+//pkginfoHeader is the comment at the start of .PKGINFO.
+const pkginfoHeader = "# Generated by holo-build\n"
+
+func writePKGINFO(pkg *build.Package, resolver GroupResolver) error {
+	//normalize package description like makepkg does
+	desc := regexp.MustCompile(`\s+`).ReplaceAllString(strings.TrimSpace(pkg.Description), " ")
+
+	//generate .PKGINFO
+	contents := pkginfoHeader
+	contents += fmt.Sprintf("pkgname = %s\n", pkg.Name)
+	contents += fmt.Sprintf("pkgbase = %s\n", packageBase(pkg))
+	//makepkg writes this right after pkgbase since pacman 6.1
+	if pkg.Pacman.XData || pkg.Pacman.PackageType != "" {
+		contents += fmt.Sprintf("xdata = pkgtype=%s\n", packageType(pkg))
+	}
+	contents += fmt.Sprintf("pkgver = %s\n", fullVersionString(pkg))
+	contents += fmt.Sprintf("pkgdesc = %s\n", desc)
+	contents += "url = \n"
+	contents += fmt.Sprintf("builddate = %d\n", buildDate(pkg))
+	if pkg.Author == "" {
+		contents += "packager = Unknown Packager\n"
+	} else {
+		contents += fmt.Sprintf("packager = %s\n", pkg.Author)
+	}
+	contents += fmt.Sprintf("size = %d\n", pkg.FSRoot.InstalledSizeInBytes())
+	contents += fmt.Sprintf("arch = %s\n", archMap[pkg.Architecture])
+	contents += "license = custom:none\n"
+	replaces, err := compilePackageRequirements("replaces", pkg.Replaces, resolver)
+	if err != nil {
+		return err
+	}
+	conflicts, err := compilePackageRequirements("conflict", pkg.Conflicts, resolver)
+	if err != nil {
+		return err
+	}
+	provides, err := compilePackageRequirements("provides", pkg.Provides, resolver)
+	if err != nil {
+		return err
+	}
+	contents += replaces + conflicts + provides
+	contents += compileBackupMarkers(pkg)
+	requires, err := compilePackageRequirements("depend", pkg.Requires, resolver)
+	if err != nil {
+		return err
+	}
+	contents += requires
+
+	//we used holo-build to build this, so the build depends on this package
+	contents += "makedepend = holo-build\n"
+	//these makepkgopt are fabricated (well, duh) and describe the behavior of
+	//holo-build in terms of these options
+	contents += "makepkgopt = !strip\n"
+	contents += "makepkgopt = docs\n"
+	contents += "makepkgopt = libtool\n"
+	contents += "makepkgopt = staticlibs\n"
+	contents += "makepkgopt = emptydirs\n"
+	contents += "makepkgopt = !zipman\n"
+	contents += "makepkgopt = !purge\n"
+	contents += "makepkgopt = !upx\n"
+	contents += "makepkgopt = !debug\n"
+
+	//write .PKGINFO
+	pkg.FSRoot.Entries[".PKGINFO"] = &filesystem.RegularFile{
+		Content:  []byte(contents),
+		Metadata: filesystem.NodeMetadata{Mode: 0644},
+	}
+	return nil
+}
+
+//packageBase returns the value for the "pkgbase" field in .PKGINFO.
+func packageBase(pkg *build.Package) string {
+	if pkg.Pacman.PackageBase != "" {
+		return pkg.Pacman.PackageBase
+	}
+	//holo-build does not have split packages, so each package is its own
+	//base, except for debug packages which makepkg names "$pkgbase-debug"
+	if packageType(pkg) == "debug" {
+		return strings.TrimSuffix(pkg.Name, "-debug")
+	}
+	return pkg.Name
+}
+
+//packageType returns the "pkgtype" value for the "xdata" field in .PKGINFO.
+func packageType(pkg *build.Package) string {
+	if pkg.Pacman.PackageType == "" {
+		return "pkg"
+	}
+	return pkg.Pacman.PackageType
+}
+
+//buildDate returns the newest modification time of all entries in the
+//package. Since unset modification times default to the UNIX epoch, this
+//keeps the package reproducible.
+func buildDate(pkg *build.Package) int64 {
+	var result int64
+	pkg.WalkFSWithRelativePaths(func(path string, node filesystem.Node) error {
+		if t := node.ModTime().Unix(); t > result {
+			result = t
+		}
+		return nil
+	})
+	return result
+}
+
+//compileBackupMarkers marks all regular files as backup files, except for
+//Holo resources and the hooks written by this generator. The Config flag of
+//filesystem.RegularFile is ignored since it would only mark a subset of these.
+func compileBackupMarkers(pkg *build.Package) string {
+	var lines []string
+	pkg.WalkFSWithRelativePaths(func(path string, node filesystem.Node) error {
+		if _, ok := node.(*filesystem.RegularFile); !ok {
+			return nil //look only at regular files
+		}
+		if !strings.HasPrefix(pkg.UnprefixedPath(path), "usr/share/holo/") && !isHookPath(pkg, path) {
+			lines = append(lines, fmt.Sprintf("backup = %s\n", path))
+		}
+		return nil
+	})
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
+
+func writeINSTALL(pkg *build.Package) {
+	//assemble the contents for the .INSTALL file
+	contents := ""
+	if script := pkg.Script(build.PreSetupAction); script != "" {
+		contents += fmt.Sprintf("pre_install() {\n%s\n}\npre_upgrade() {\npre_install\n}\n", script)
+	}
+	postInstall, postUpgrade, preRemove, postRemove := servicesSnippets(pkg)
+	setupScript := pkg.Script(build.SetupAction)
+	if postUpgrade == "" {
+		if setupScript != "" {
+			contents += fmt.Sprintf("post_install() {\n%s\n}\npost_upgrade() {\npost_install\n}\n", setupScript)
+		}
+	} else {
+		//systemd units are handled differently on installation and upgrade
+		if script := joinScripts(setupScript, postInstall); script != "" {
+			contents += fmt.Sprintf("post_install() {\n%s\n}\n", script)
+		}
+		contents += fmt.Sprintf("post_upgrade() {\n%s\n}\n", joinScripts(setupScript, postUpgrade))
+	}
+	if script := joinScripts(pkg.Script(build.PreCleanupAction), preRemove); script != "" {
+		contents += fmt.Sprintf("pre_remove() {\n%s\n}\n", script)
+	}
+	if script := joinScripts(pkg.Script(build.CleanupAction), postRemove); script != "" {
+		contents += fmt.Sprintf("post_remove() {\n%s\n}\n", script)
+	}
+
+	//do we need the .INSTALL file at all?
+	if contents == "" {
+		return
+	}
+
+	pkg.FSRoot.Entries[".INSTALL"] = &filesystem.RegularFile{
+		Content:  []byte(contents),
+		Metadata: filesystem.NodeMetadata{Mode: 0644},
+	}
+}
+
+func writeMTREE(pkg *build.Package) error {
+	contents, err := makeMTREE(pkg.FSRoot)
+	if err != nil {
+		return err
+	}
+
+	pkg.FSRoot.Entries[".MTREE"] = &filesystem.RegularFile{
+		Content:  contents,
+		Metadata: filesystem.NodeMetadata{Mode: 0644},
+	}
+	return nil
+}
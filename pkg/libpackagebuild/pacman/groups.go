@@ -0,0 +1,161 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package pacman
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+//GroupResolver resolves package groups (as referenced by "group:name" in
+//package relations) into the names of the packages in them.
+type GroupResolver interface {
+	ResolveGroup(groupName string) ([]string, error)
+}
+
+//GroupResolutionError is returned by GroupResolver implementations in this
+//package (and thus by Generator.Build()) when a package group cannot be
+//resolved.
+type GroupResolutionError struct {
+	//Group is the name of the package group.
+	Group string
+	//Reason describes why the group could not be resolved.
+	Reason string
+	//PacmanMissing is true if pacman is not installed on this host. A
+	//GroupResolver that does not need pacman (e.g. StaticGroupResolver)
+	//can be used instead.
+	PacmanMissing bool
+}
+
+//Error implements the builtin/error interface.
+func (e *GroupResolutionError) Error() string {
+	return fmt.Sprintf("Error resolving package group %q: %s", e.Group, e.Reason)
+}
+
+//PacmanGroupResolver is a GroupResolver that calls `pacman -Sqg`. Each group
+//is only resolved once, so the same resolver should be shared by all builds
+//in one process.
+type PacmanGroupResolver struct {
+	mutex sync.Mutex
+	cache map[string][]string
+}
+
+//ResolveGroup implements the GroupResolver interface.
+func (r *PacmanGroupResolver) ResolveGroup(groupName string) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if pkgs, ok := r.cache[groupName]; ok {
+		return pkgs, nil
+	}
+
+	//fail early with a clear error on build hosts without pacman
+	_, err := exec.LookPath("pacman")
+	if err != nil {
+		return nil, &GroupResolutionError{
+			Group:         groupName,
+			Reason:        "pacman is not installed",
+			PacmanMissing: true,
+		}
+	}
+
+	cmd := exec.Command("pacman", "-Sqg", groupName)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, &GroupResolutionError{Group: groupName, Reason: "pacman -Sqg failed: " + err.Error()}
+	}
+
+	pkgs := strings.Fields(string(out))
+	if r.cache == nil {
+		r.cache = make(map[string][]string)
+	}
+	r.cache[groupName] = pkgs
+	return pkgs, nil
+}
+
+//StaticGroupResolver is a GroupResolver that looks up package groups in a
+//fixed map, e.g. one that was read with ReadGroupDatabase(). This allows
+//building Pacman packages with group requirements on hosts without pacman.
+type StaticGroupResolver map[string][]string
+
+//ResolveGroup implements the GroupResolver interface.
+func (r StaticGroupResolver) ResolveGroup(groupName string) ([]string, error) {
+	pkgs, ok := r[groupName]
+	if !ok {
+		return nil, &GroupResolutionError{Group: groupName, Reason: "not found in group database"}
+	}
+	return pkgs, nil
+}
+
+//ReadGroupDatabase reads a StaticGroupResolver from a file that contains one
+//package per line, preceded by the name of its group, which is the output
+//format of `pacman -Sg`. Empty lines and lines starting with "#" are ignored.
+func ReadGroupDatabase(path string) (StaticGroupResolver, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make(StaticGroupResolver)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a group name and a package name", path, lineNo)
+		}
+		result[fields[0]] = append(result[fields[0]], fields[1])
+	}
+	return result, scanner.Err()
+}
+
+//MockGroupResolver is a GroupResolver for tests. It reads the package names
+//from the group name, e.g. group "foo-bar-baz" contains the packages "foo",
+//"bar" and "baz".
+type MockGroupResolver struct{}
+
+//ResolveGroup implements the GroupResolver interface.
+func (MockGroupResolver) ResolveGroup(groupName string) ([]string, error) {
+	return strings.Split(groupName, "-"), nil
+}
+
+//defaultGroupResolver is shared by all generators that do not have a
+//GroupResolver of their own.
+var defaultGroupResolver = &PacmanGroupResolver{}
+
+//groupResolver returns the GroupResolver for this generator.
+func (g *Generator) groupResolver() GroupResolver {
+	if g.GroupResolver != nil {
+		return g.GroupResolver
+	}
+	//mock implementation (for unit tests)
+	if os.Getenv("HOLO_MOCK") == "1" {
+		return MockGroupResolver{}
+	}
+	return defaultGroupResolver
+}
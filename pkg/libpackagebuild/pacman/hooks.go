@@ -0,0 +1,109 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package pacman
+
+import (
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//hookPaths returns the paths (relative to the root directory) of the alpm hook
+//file and of the script file for the trigger with the given index.
+func hookPaths(pkg *build.Package, idx int) (hookPath, scriptPath string) {
+	name := fmt.Sprintf("%s-trigger-%d", pkg.Name, idx)
+	return "usr/share/libalpm/hooks/" + name + ".hook", "usr/share/libalpm/scripts/" + name
+}
+
+//isHookPath returns whether the given path (relative to the root directory)
+//belongs to a file generated by writeHooks.
+func isHookPath(pkg *build.Package, relPath string) bool {
+	for idx := range pkg.Triggers {
+		hookPath, scriptPath := hookPaths(pkg, idx)
+		if relPath == hookPath || relPath == scriptPath {
+			return true
+		}
+	}
+	return false
+}
+
+//writeHooks adds an alpm hook for each trigger to the package, which runs the
+//trigger's script from a separate file after the transaction.
+func writeHooks(pkg *build.Package) error {
+	for idx, trigger := range pkg.Triggers {
+		hookPath, scriptPath := hookPaths(pkg, idx)
+
+		interpreter := trigger.Interpreter
+		if interpreter == "" {
+			interpreter = "/bin/sh"
+		}
+		err := pkg.InsertFSNode("/"+scriptPath, &filesystem.RegularFile{
+			Content:  []byte("#!" + interpreter + "\n" + trigger.Content + "\n"),
+			Metadata: filesystem.NodeMetadata{Mode: 0755},
+		})
+		if err != nil {
+			return err
+		}
+
+		err = pkg.InsertFSNode("/"+hookPath, &filesystem.RegularFile{
+			Content:  []byte(makeHook(pkg, idx, trigger, scriptPath)),
+			Metadata: filesystem.NodeMetadata{Mode: 0644},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func makeHook(pkg *build.Package, idx int, trigger build.PackageTrigger, scriptPath string) string {
+	var targets []string
+	for _, path := range trigger.Paths {
+		//alpm matches the targets against the file lists of packages, so
+		//directories need a wildcard to match the files below them
+		path = strings.TrimPrefix(path, "/")
+		targets = append(targets, path, path+"/*")
+	}
+
+	contents := ""
+	if len(targets) > 0 {
+		contents += makeHookTrigger("Path", targets)
+	}
+	if len(trigger.Packages) > 0 {
+		contents += makeHookTrigger("Package", trigger.Packages)
+	}
+	contents += "[Action]\n"
+	contents += fmt.Sprintf("Description = Running trigger %d of %s...\n", idx, pkg.Name)
+	contents += "When = PostTransaction\n"
+	contents += fmt.Sprintf("Exec = /%s\n", scriptPath)
+	return contents
+}
+
+func makeHookTrigger(hookType string, targets []string) string {
+	contents := "[Trigger]\n"
+	contents += fmt.Sprintf("Type = %s\n", hookType)
+	contents += "Operation = Install\nOperation = Upgrade\nOperation = Remove\n"
+	for _, target := range targets {
+		contents += fmt.Sprintf("Target = %s\n", target)
+	}
+	return contents + "\n"
+}
@@ -25,12 +25,12 @@ import (
 	"fmt"
 	"strings"
 
-	build "github.com/holocm/libpackagebuild"
-	"github.com/holocm/libpackagebuild/filesystem"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
 )
 
-//makeMTREE generates the mtree metadata archive for this package.
-func makeMTREE(pkg *build.Package) ([]byte, error) {
+//makeMTREE generates the mtree metadata archive for the package contents in
+//the given directory (not including the mtree archive itself).
+func makeMTREE(root *filesystem.Directory) ([]byte, error) {
 	//this implementation is not particularly clever w.r.t. the use of "/set",
 	//but we use some defaults here to maybe keep the result size down a bit
 	lines := []string{
@@ -38,9 +38,9 @@ func makeMTREE(pkg *build.Package) ([]byte, error) {
 		"/set type=file uid=0 gid=0 mode=644 time=0.0",
 	}
 
-	pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
-		//skip root directory
-		if path == "/" {
+	err := root.Walk("/", func(path string, node filesystem.Node) error {
+		//skip root directory and the mtree archive
+		if path == "/" || path == "/.MTREE" {
 			return nil
 		}
 
@@ -61,6 +61,9 @@ func makeMTREE(pkg *build.Package) ([]byte, error) {
 			if n.Metadata.Mode != 0644 { //mode 0644 is default
 				line += fmt.Sprintf(" mode=%o", n.Metadata.Mode)
 			}
+			if !n.Metadata.MTime.IsZero() { //time 0 is default
+				line += fmt.Sprintf(" time=%d.0", n.Metadata.MTime.Unix())
+			}
 		case *filesystem.RegularFile:
 			// type=file is default
 			if uid := n.Metadata.UID(); uid != 0 { //uid 0 is default
@@ -72,12 +75,29 @@ func makeMTREE(pkg *build.Package) ([]byte, error) {
 			if n.Metadata.Mode != 0644 { //mode 0644 is default
 				line += fmt.Sprintf(" mode=%o", n.Metadata.Mode)
 			}
+			if !n.Metadata.MTime.IsZero() { //time 0 is default
+				line += fmt.Sprintf(" time=%d.0", n.Metadata.MTime.Unix())
+			}
+			md5digest, err := n.MD5Digest()
+			if err != nil {
+				return err
+			}
+			sha256digest, err := n.SHA256Digest()
+			if err != nil {
+				return err
+			}
 			line += fmt.Sprintf(" size=%d md5digest=%s sha256digest=%s",
-				len([]byte(n.Content)), n.MD5Digest(), n.SHA256Digest(),
+				n.ContentSize(), md5digest, sha256digest,
 			)
 		case *filesystem.Symlink:
-			// uid=0 gid=0 is default
-			line += " type=link mode=777"
+			line += " type=link"
+			if uid := n.Metadata.UID(); uid != 0 { //uid 0 is default
+				line += fmt.Sprintf(" uid=%d", uid)
+			}
+			if gid := n.Metadata.GID(); gid != 0 { //gid 0 is default
+				line += fmt.Sprintf(" gid=%d", gid)
+			}
+			line += " mode=777"
 			//need to replace spaces in link target since spaces separate
 			line += " link=" + mtreeEscapeString(n.Target)
 		}
@@ -85,6 +105,9 @@ func makeMTREE(pkg *build.Package) ([]byte, error) {
 		lines = append(lines, line)
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	contents := strings.Join(lines, "\n") + "\n"
 
@@ -92,7 +115,7 @@ func makeMTREE(pkg *build.Package) ([]byte, error) {
 	var buf bytes.Buffer
 	w := gzip.NewWriter(&buf)
 
-	_, err := w.Write([]byte(contents))
+	_, err = w.Write([]byte(contents))
 	if err != nil {
 		return nil, err
 	}
@@ -21,12 +21,10 @@ package pacman
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
 	"sort"
 	"strings"
 
-	build "github.com/holocm/libpackagebuild"
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
 )
 
 //Renders package relations into .PKGINFO.
@@ -52,7 +50,7 @@ func compilePackageRelations(relType string, rels []build.PackageRelation) strin
 
 //Like compilePackageRelations, but resolve special syntax for requirements
 //(references to groups, exclusion of packages and groups).
-func compilePackageRequirements(relType string, rels []build.PackageRelation) (string, error) {
+func compilePackageRequirements(relType string, rels []build.PackageRelation, resolver GroupResolver) (string, error) {
 	//acceptRel marks which packages will be included in the result
 	//(e.g. "not:foo" sets acceptPkg["foo"] = false)
 	acceptPkg := make(map[string]bool, len(rels))
@@ -69,7 +67,7 @@ func compilePackageRequirements(relType string, rels []build.PackageRelation) (s
 
 		if isGroup {
 			//resolve groups
-			pkgs, err := resolvePackageGroup(name)
+			pkgs, err := resolver.ResolveGroup(name)
 			if err != nil {
 				return "", err
 			}
@@ -109,24 +107,6 @@ func compilePackageRequirements(relType string, rels []build.PackageRelation) (s
 	return compilePackageRelations(relType, prunedRels), nil
 }
 
-func resolvePackageGroup(groupName string) ([]string, error) {
-	//mock implementation (for unit tests): read package names from group name
-	//(e.g. "group:foo-bar-baz" contains packages "foo", "bar", "baz")
-	if value := os.Getenv("HOLO_MOCK"); value == "1" {
-		return strings.Split(groupName, "-"), nil
-	}
-
-	//actual implementation: call pacman to resolve package groups
-	cmd := exec.Command("pacman", "-Sqg", groupName)
-	cmd.Stderr = os.Stderr
-	out, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("Error resolving package group %q: %s", groupName, err.Error())
-	}
-
-	return strings.Fields(string(out)), nil
-}
-
 //implement sort.Sort interface for package relations
 type byRelatedPackage []build.PackageRelation
 
@@ -0,0 +1,65 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package pacman
+
+import (
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//servicesSnippets returns the snippets for the package's systemd units for the
+//post_install, post_upgrade, pre_remove and post_remove functions in .INSTALL.
+//All snippets are empty if there are no systemd units.
+func servicesSnippets(pkg *build.Package) (postInstall, postUpgrade, preRemove, postRemove string) {
+	if len(pkg.Services) == 0 {
+		return
+	}
+
+	var installLines, restartLines, removeLines []string
+	for _, svc := range pkg.Services {
+		if svc.Enable {
+			installLines = append(installLines, fmt.Sprintf("systemctl enable --now '%s' >/dev/null 2>&1 || true", svc.Unit))
+		}
+		if svc.RestartOnUpgrade {
+			restartLines = append(restartLines, fmt.Sprintf("systemctl try-restart '%s' >/dev/null 2>&1 || true", svc.Unit))
+		}
+		removeLines = append(removeLines, fmt.Sprintf("systemctl disable --now '%s' >/dev/null 2>&1 || true", svc.Unit))
+	}
+
+	daemonReload := "systemctl daemon-reload >/dev/null 2>&1 || true"
+	postInstall = strings.Join(installLines, "\n")
+	postUpgrade = strings.Join(append([]string{daemonReload}, restartLines...), "\n")
+	preRemove = strings.Join(removeLines, "\n")
+	postRemove = daemonReload
+	return
+}
+
+//joinScripts concatenates the non-empty ones of the given scripts.
+func joinScripts(scripts ...string) string {
+	var nonEmpty []string
+	for _, script := range scripts {
+		if script != "" {
+			nonEmpty = append(nonEmpty, script)
+		}
+	}
+	return strings.Join(nonEmpty, "\n")
+}
@@ -0,0 +1,242 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//Planner is implemented by generators that split Build() into two phases:
+//Plan() does all the preparation steps and describes the resulting package,
+//and Render() produces the bytes of the package. For such generators, Build()
+//is equivalent to calling Plan() and then Render() with the returned plan.
+type Planner interface {
+	//Plan describes the package that Build() would produce. The result is
+	//deterministic in the same way as the package itself. Calling Plan()
+	//multiple times returns the same plan.
+	Plan() (*Plan, error)
+	//Render produces the package described by the given plan, which is
+	//usually the one returned by Plan() (or a deserialized copy of it). The
+	//metadata values and archive members are taken from the plan. Only the
+	//contents of regular files are taken from the package, and they must
+	//match the sizes and digests in the plan.
+	Render(plan *Plan) ([]byte, error)
+}
+
+//Plan is a serializable description of a package, as produced by
+//Planner.Plan().
+type Plan struct {
+	//Format is the package format (e.g. "debian").
+	Format string `json:"format"`
+	//Metadata contains the metadata values of the package in the order in
+	//which they appear in the package (e.g. the fields of a Debian control
+	//file).
+	Metadata []PlanValue `json:"metadata"`
+	//Archives describes the archives in the package (e.g. control.tar and
+	//data.tar in a Debian package).
+	Archives []PlanArchive `json:"archives"`
+}
+
+//PlanValue is a metadata value in a Plan.
+type PlanValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+//PlanArchive describes an archive in a Plan.
+type PlanArchive struct {
+	Name    string       `json:"name"`
+	Members []PlanMember `json:"members"`
+}
+
+//PlanMember describes an archive member in a PlanArchive.
+type PlanMember struct {
+	//Path is the absolute path of the member, regardless of how the archive
+	//stores it (e.g. "./etc/foo" in a tar archive is shown as "/etc/foo").
+	Path string `json:"path"`
+	//Type is "directory", "file" or "symlink".
+	Type string `json:"type"`
+	//Mode is the file mode (without file type bits) in octal notation.
+	Mode  string `json:"mode"`
+	UID   uint32 `json:"uid"`
+	GID   uint32 `json:"gid"`
+	MTime int64  `json:"mtime"`
+	//Size and SHA256 are only set for regular files.
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	//Target is only set for symlinks.
+	Target string `json:"target,omitempty"`
+	//Sensitive is only set for regular files containing secrets (see
+	//filesystem.RegularFile.Sensitive).
+	Sensitive bool `json:"sensitive,omitempty"`
+}
+
+//NewPlanArchive describes an archive containing the given directory and
+//everything below it. Nodes for which the filter returns false are omitted
+//(but the nodes below them are not). If the filter is nil, all nodes are
+//included.
+func NewPlanArchive(name string, root *filesystem.Directory, filter func(absolutePath string, node filesystem.Node) bool) (PlanArchive, error) {
+	archive := PlanArchive{Name: name}
+	err := root.Walk("/", func(absolutePath string, node filesystem.Node) error {
+		if filter != nil && !filter(absolutePath, node) {
+			return nil
+		}
+
+		member := PlanMember{
+			Path:  absolutePath,
+			Mode:  fmt.Sprintf("%04o", node.FileModeForArchive(false)),
+			MTime: node.ModTime().Unix(),
+		}
+		switch n := node.(type) {
+		case *filesystem.Directory:
+			member.Type = "directory"
+			member.UID = n.Metadata.UID()
+			member.GID = n.Metadata.GID()
+		case *filesystem.RegularFile:
+			member.Type = "file"
+			member.UID = n.Metadata.UID()
+			member.GID = n.Metadata.GID()
+			member.Size = n.ContentSize()
+			digest, err := n.SHA256Digest()
+			if err != nil {
+				return fmt.Errorf("cannot read %s: %s", absolutePath, err.Error())
+			}
+			member.SHA256 = digest
+			member.Sensitive = n.Sensitive
+		case *filesystem.Symlink:
+			member.Type = "symlink"
+			member.UID = n.Metadata.UID()
+			member.GID = n.Metadata.GID()
+			member.Target = n.Target
+		}
+		archive.Members = append(archive.Members, member)
+		return nil
+	})
+	return archive, err
+}
+
+//Archive returns the archive with the given name.
+func (p *Plan) Archive(name string) (*PlanArchive, error) {
+	for idx := range p.Archives {
+		if p.Archives[idx].Name == name {
+			return &p.Archives[idx], nil
+		}
+	}
+	return nil, fmt.Errorf("plan does not contain the archive %s", name)
+}
+
+//ToDirectory builds the directory tree described by this archive. The
+//attributes of all members are taken from the plan, and the contents of
+//regular files are taken from the regular files at the same paths below
+//`contents`. Directories that are not members of the archive are created
+//implicitly (see filesystem.Directory.Implicit).
+//
+//The contents of regular files must match the sizes and digests in the plan,
+//except for the files whose absolute paths are listed in `derived`. These are
+//generated from the plan by the caller (e.g. a control file rendered from the
+//metadata values), so they change when the plan is changed.
+func (a *PlanArchive) ToDirectory(contents *filesystem.Directory, derived ...string) (*filesystem.Directory, error) {
+	root := filesystem.NewDirectory()
+	root.Implicit = true
+
+	for _, member := range a.Members {
+		mode, err := strconv.ParseUint(member.Mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mode for %s in plan: %q", member.Path, member.Mode)
+		}
+		metadata := filesystem.NodeMetadata{
+			Mode:  os.FileMode(mode),
+			Owner: &filesystem.IntOrString{Int: member.UID},
+			Group: &filesystem.IntOrString{Int: member.GID},
+		}
+		//leave the default modification time unset, as in the package
+		if member.MTime != 0 {
+			metadata.MTime = time.Unix(member.MTime, 0)
+		}
+
+		var node filesystem.Node
+		switch member.Type {
+		case "directory":
+			if member.Path == "/" {
+				root.Metadata = metadata
+				root.Implicit = false
+				continue
+			}
+			node = &filesystem.Directory{
+				Entries:  make(map[string]filesystem.Node),
+				Metadata: metadata,
+			}
+		case "file":
+			source, ok := lookupNode(contents, member.Path).(*filesystem.RegularFile)
+			if !ok {
+				return nil, fmt.Errorf("cannot find contents of %s", member.Path)
+			}
+			if !containsString(derived, member.Path) {
+				digest, err := source.SHA256Digest()
+				if err != nil {
+					return nil, fmt.Errorf("cannot read %s: %s", member.Path, err.Error())
+				}
+				if source.ContentSize() != member.Size || digest != member.SHA256 {
+					return nil, fmt.Errorf("contents of %s do not match the size and digest in the plan", member.Path)
+				}
+			}
+			//copy the file to keep its cached digests, so that it is not read
+			//again when the digests are needed for the archive
+			file := *source
+			file.Metadata = metadata
+			file.Sensitive = member.Sensitive
+			node = &file
+		case "symlink":
+			node = &filesystem.Symlink{
+				Target:   member.Target,
+				Metadata: metadata,
+			}
+		default:
+			return nil, fmt.Errorf("invalid type for %s in plan: %q", member.Path, member.Type)
+		}
+
+		err = root.Insert(node, strings.Split(strings.TrimPrefix(member.Path, "/"), "/"), "")
+		if err != nil {
+			return nil, fmt.Errorf("cannot insert %s: %s", member.Path, err.Error())
+		}
+	}
+
+	return root, nil
+}
+
+//lookupNode returns the node at the given absolute path below the given
+//directory, or nil if there is none.
+func lookupNode(root *filesystem.Directory, absolutePath string) filesystem.Node {
+	var node filesystem.Node = root
+	for _, name := range strings.Split(strings.TrimPrefix(absolutePath, "/"), "/") {
+		dir, ok := node.(*filesystem.Directory)
+		if !ok {
+			return nil
+		}
+		node = dir.Entries[name]
+	}
+	return node
+}
@@ -0,0 +1,75 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package build
+
+import "github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+
+//ProgressReporter receives progress information while a package is being
+//parsed and built, e.g. to display it to the user. See Package.Progress.
+type ProgressReporter interface {
+	//BeginPhase is called when the given phase starts (see the Phase...
+	//constants for the phases that are reported).
+	BeginPhase(phase string)
+	//EndPhase is called when the given phase ends. fileCount is the number of
+	//regular files in the package at that point.
+	EndPhase(phase string, fileCount int)
+}
+
+//Phases reported to a ProgressReporter. The parse, validate and write phases
+//are reported by the application using libpackagebuild, the other phases are
+//reported by the generators.
+const (
+	//PhaseParse is when the package definition is read.
+	PhaseParse = "parse"
+	//PhaseValidate is when the package is checked by Generator.Validate().
+	PhaseValidate = "validate"
+	//PhasePayload is when all files in the package are read to compute their
+	//digests (see Package.ComputeDigests).
+	PhasePayload = "payload"
+	//PhaseCompress is when the archive of the package contents is written
+	//and compressed.
+	PhaseCompress = "compress"
+	//PhaseWrite is when the finished package is written to disk.
+	PhaseWrite = "write"
+)
+
+//BeginPhase reports the start of the given phase to p.Progress, if set. The
+//returned function must be called when the phase has ended.
+func (p *Package) BeginPhase(phase string) (endPhase func()) {
+	if p.Progress == nil {
+		return func() {}
+	}
+	p.Progress.BeginPhase(phase)
+	return func() {
+		p.Progress.EndPhase(phase, p.RegularFileCount())
+	}
+}
+
+//RegularFileCount returns the number of regular files in the package.
+func (p *Package) RegularFileCount() int {
+	count := 0
+	p.FSRoot.Walk("/", func(absolutePath string, node filesystem.Node) error {
+		if _, ok := node.(*filesystem.RegularFile); ok {
+			count++
+		}
+		return nil
+	})
+	return count
+}
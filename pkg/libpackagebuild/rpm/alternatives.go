@@ -0,0 +1,54 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package rpm
+
+import (
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//alternativesPost returns the %post snippet that registers the package's
+//alternatives, or "" if there are none. Like in the scriptlets of Fedora
+//packages, this runs on every installation and upgrade.
+func alternativesPost(pkg *build.Package) string {
+	var lines []string
+	for _, alt := range pkg.RelocatedAlternatives() {
+		lines = append(lines, fmt.Sprintf("update-alternatives --install '%s' '%s' '%s' %d", alt.Link, alt.Name, alt.Path, alt.Priority))
+	}
+	return strings.Join(lines, "\n")
+}
+
+//alternativesPreun returns the %preun snippet that unregisters the package's
+//alternatives when the package is removed, or "" if there are none.
+func alternativesPreun(pkg *build.Package) string {
+	alts := pkg.RelocatedAlternatives()
+	if len(alts) == 0 {
+		return ""
+	}
+
+	lines := []string{"if [ $1 -eq 0 ]; then"}
+	for _, alt := range alts {
+		lines = append(lines, fmt.Sprintf("    update-alternatives --remove '%s' '%s'", alt.Name, alt.Path))
+	}
+	lines = append(lines, "fi")
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,65 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package rpm
+
+import (
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//addAutoProvides adds Provides entries for the package's shared libraries and
+//pkg-config modules, in the same form as the dependency generators of
+//rpmbuild, e.g. "libfoo.so.1()(64bit)" and "pkgconfig(foo) = 1.2".
+func addAutoProvides(pkg *build.Package) error {
+	libs, err := pkg.SharedLibraries()
+	if err != nil {
+		return err
+	}
+	for _, lib := range libs {
+		name := lib.SOName + "()"
+		if lib.Is64Bit {
+			name += "(64bit)"
+		}
+		addProvides(pkg, build.PackageRelation{RelatedPackage: name})
+	}
+
+	modules, err := pkg.PkgConfigModules()
+	if err != nil {
+		return err
+	}
+	for _, module := range modules {
+		rel := build.PackageRelation{RelatedPackage: "pkgconfig(" + module.Name + ")"}
+		if module.Version != "" {
+			rel.Constraints = []build.VersionConstraint{{Relation: "=", Version: module.Version}}
+		}
+		addProvides(pkg, rel)
+	}
+	return nil
+}
+
+//addProvides adds the given relation to pkg.Provides, unless a relation to
+//the same package is already there.
+func addProvides(pkg *build.Package, rel build.PackageRelation) {
+	for _, other := range pkg.Provides {
+		if other.RelatedPackage == rel.RelatedPackage {
+			return
+		}
+	}
+	pkg.Provides = append(pkg.Provides, rel)
+}
@@ -0,0 +1,44 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package rpm
+
+import (
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//dependencyCapability translates a build.FileDependency into a requirement
+//in the same form as the dependency generators of rpmbuild (see
+//build.Package.AddAutoRequires). RPM packages provide their files and the
+//SONAMEs of their libraries, so no table of package names is needed.
+func dependencyCapability(dep build.FileDependency) string {
+	if dep.Library != "" {
+		if dep.Is64Bit {
+			return dep.Library + "()(64bit)"
+		}
+		return dep.Library + "()"
+	}
+	//for "#!/usr/bin/env python3", guess the usual location
+	if !strings.HasPrefix(dep.Interpreter, "/") {
+		return "/usr/bin/" + dep.Interpreter
+	}
+	return dep.Interpreter
+}
@@ -0,0 +1,282 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package rpm provides a build.Generator for RPM packages.
+package rpm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Documentation for the RPM file format:
+//
+// [LSB] http://refspecs.linux-foundation.org/LSB_5.0.0/LSB-Core-generic/LSB-Core-generic/pkgformat.html
+// [RPM] http://www.rpm.org/max-rpm/s1-rpm-file-format-rpm-file-format.html
+//
+////////////////////////////////////////////////////////////////////////////////
+
+//Generator is the build.Generator for RPM packages.
+type Generator struct {
+	Package *build.Package
+	//Signer, if not nil, is used to add an OpenPGP signature of the header
+	//section to the signature section.
+	Signer HeaderSigner
+
+	//state shared between Plan() and Render()
+	plan *build.Plan
+}
+
+//GeneratorFactory spawns Generator instances. It satisfies the build.GeneratorFactory type.
+func GeneratorFactory(pkg *build.Package) build.Generator {
+	return &Generator{Package: pkg}
+}
+
+//Source for this data: `grep arch_canon /usr/lib/rpm/rpmrc`
+var archMap = map[build.Architecture]string{
+	build.ArchitectureAny:     "noarch",
+	build.ArchitectureI386:    "i686",
+	build.ArchitectureX86_64:  "x86_64",
+	build.ArchitectureARMv5:   "armv5tl",
+	build.ArchitectureARMv6h:  "armv6hl",
+	build.ArchitectureARMv7h:  "armv7hl",
+	build.ArchitectureAArch64: "aarch64",
+}
+var archIDMap = map[build.Architecture]uint16{
+	build.ArchitectureAny:     0,
+	build.ArchitectureI386:    1,
+	build.ArchitectureX86_64:  1,
+	build.ArchitectureARMv5:   12,
+	build.ArchitectureARMv6h:  12,
+	build.ArchitectureARMv7h:  12,
+	build.ArchitectureAArch64: 12,
+}
+
+//Validate implements the build.Generator interface.
+func (g *Generator) Validate() []error {
+	//TODO, (cannot find a reliable cross-distro source of truth for the
+	//acceptable format of package names and versions)
+	//
+	//There are no reserved paths: the package metadata lives in the header,
+	//separately from the package contents in the payload.
+	return nil
+}
+
+//SupportedArchitectures implements the build.Generator interface.
+func (g *Generator) SupportedArchitectures() map[build.Architecture]string {
+	return archMap
+}
+
+//Capabilities implements the build.CapabilityReporter interface.
+func (g *Generator) Capabilities() build.Capabilities {
+	return build.Capabilities{
+		Compressions:      []string{"lzma"},
+		Actions:           true,
+		Triggers:          true,
+		Services:          true,
+		Alternatives:      true,
+		EmbeddedSignature: true, //see Signer
+	}
+}
+
+//RecommendedFileName implements the build.Generator interface.
+func (g *Generator) RecommendedFileName() string {
+	c := g.RecommendedFileNameComponents()
+	return fmt.Sprintf("%s-%s.%s%s", c.Name, c.FullVersion, c.ArchString, c.Extension)
+}
+
+//RecommendedFileNameComponents implements the build.Generator interface.
+func (g *Generator) RecommendedFileNameComponents() build.FileNameComponents {
+	//this is called after Build(), so we can assume that package name,
+	//version, etc. were already validated
+	pkg := g.Package
+	return build.FileNameComponents{
+		Name:        pkg.Name,
+		FullVersion: fullVersionString(pkg),
+		ArchString:  archMap[pkg.Architecture],
+		Extension:   ".rpm",
+	}
+}
+
+func versionString(pkg *build.Package) string {
+	var b strings.Builder
+
+	if pkg.Epoch > 0 {
+		fmt.Fprintf(&b, "%d:", pkg.Epoch)
+	}
+
+	b.WriteString(pkg.Version)
+
+	if pkg.PrereleaseType != build.PrereleaseTypeNone {
+		fmt.Fprintf(&b, "~%s.%d", pkg.PrereleaseType.String(), pkg.PrereleaseVersion)
+	}
+
+	return b.String()
+}
+
+func fullVersionString(pkg *build.Package) string {
+	return fmt.Sprintf("%s-%d", versionString(pkg), pkg.Release)
+}
+
+//Build implements the build.Generator interface.
+func (g *Generator) Build() ([]byte, error) {
+	plan, err := g.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return g.Render(plan)
+}
+
+//Plan implements the build.Planner interface.
+func (g *Generator) Plan() (*build.Plan, error) {
+	if g.plan != nil {
+		return g.plan, nil
+	}
+
+	pkg := g.Package
+	//as recommended by the Fedora packaging guidelines, superseded packages
+	//are obsoleted and provided (Obsoletes implies the conflict)
+	pkg.FoldSupersedes(fullVersionString(pkg), false)
+	//same convention as for other virtual capabilities like "pkgconfig(foo)"
+	pkg.AddHologramProvides("hologram("+pkg.Name+")", fullVersionString(pkg))
+	err := pkg.PrepareBuild()
+	if err != nil {
+		return nil, err
+	}
+
+	//read every file once to compute its digests
+	err = pkg.ComputeDigests()
+	if err != nil {
+		return nil, err
+	}
+	err = addAutoProvides(pkg)
+	if err != nil {
+		return nil, err
+	}
+	err = pkg.AddAutoRequires("rpm", dependencyCapability)
+	if err != nil {
+		return nil, err
+	}
+
+	//the payload skips implicitly created directories (see writeCPIOArchive)
+	payload, err := build.NewPlanArchive("payload", pkg.FSRoot, func(absolutePath string, node filesystem.Node) bool {
+		n, ok := node.(*filesystem.Directory)
+		return !(ok && n.Implicit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//the header section depends on the size of the uncompressed payload, but
+	//not on its contents, so it can be prepared without writing the payload
+	header, err := makeHeader(pkg, cpioArchiveSize(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	g.plan = &build.Plan{
+		Format:   "rpm",
+		Metadata: header.PlanValues(),
+		Archives: []build.PlanArchive{payload},
+	}
+	return g.plan, nil
+}
+
+//Render implements the build.Planner interface.
+func (g *Generator) Render(plan *build.Plan) ([]byte, error) {
+	//prepare the package (if not done yet) to have the file contents ready
+	_, err := g.Plan()
+	if err != nil {
+		return nil, err
+	}
+	if plan.Format != "rpm" {
+		return nil, fmt.Errorf("cannot render a plan for format \"%s\" as an RPM package", plan.Format)
+	}
+	payloadArchive, err := plan.Archive("payload")
+	if err != nil {
+		return nil, err
+	}
+	root, err := payloadArchive.ToDirectory(g.Package.FSRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	//assemble CPIO-LZMA payload
+	endPhase := g.Package.BeginPhase(build.PhaseCompress)
+	payload, err := makePayload(root)
+	endPhase()
+	if err != nil {
+		return nil, err
+	}
+
+	//the header section is built from the metadata values in the plan, so its
+	//archive size must match the payload
+	archiveSize := planValue(plan.Metadata, "ARCHIVESIZE")
+	if archiveSize == "" {
+		archiveSize = planValue(plan.Metadata, "LONGARCHIVESIZE")
+	}
+	if archiveSize != strconv.FormatUint(payload.UncompressedSize, 10) {
+		return nil, fmt.Errorf("archive size in plan is %q, but the payload has %d bytes", archiveSize, payload.UncompressedSize)
+	}
+	header, err := newHeaderFromPlan(plan.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	//produce header sections in reverse order (since most of them depend on
+	//what comes after them)
+	headerSection := header.ToBinary(rpmtagHeaderImmutable)
+	signatureSection, err := makeSignatureSection(headerSection, payload, g.Signer)
+	if err != nil {
+		return nil, err
+	}
+	lead := newLead(plan.Metadata).ToBinary()
+
+	//combine everything with the correct alignment
+	combined1 := appendAlignedTo8Byte(lead, signatureSection)
+	combined2 := appendAlignedTo8Byte(combined1, headerSection)
+	return append(combined2, payload.Binary...), nil
+}
+
+//planValue returns the first metadata value with the given key, or the empty
+//string if there is none.
+func planValue(values []build.PlanValue, key string) string {
+	for _, value := range values {
+		if value.Key == key {
+			return value.Value
+		}
+	}
+	return ""
+}
+
+//According to [LSB, 25.2.2], "A Header structure shall be aligned to an 8 byte
+//boundary."
+func appendAlignedTo8Byte(a []byte, b []byte) []byte {
+	result := a
+	for len(result)%8 != 0 {
+		result = append(result, 0x00)
+	}
+	return append(result, b...)
+}
@@ -0,0 +1,681 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//rpmHeader represents an RPM header structure (as used in the signature section
+//and header section), as defined in [LSB, 25.2.2].
+type rpmHeader struct {
+	Records      []*rpmHeaderIndexRecord
+	Data         []byte
+	hasI18NTable bool
+}
+
+//rpmHeaderIndexRecord represents an index record in a RPM header structure, i.e.
+//a single key-value entry. The actual value is stored in the associated
+//rpmHeader.Data field. Defined in [LSB, 25.2.2.2].
+type rpmHeaderIndexRecord struct {
+	Tag    uint32
+	Type   uint32
+	Offset uint32
+	Count  uint32
+}
+
+//Binary representation of the header record. [LSB,25.2.2.1]
+type headerRecord struct {
+	Magic            [4]byte
+	Reserved         [4]byte
+	IndexRecordCount uint32
+	DataSize         uint32
+}
+
+//ToBinary serializes the given header.
+func (hdr *rpmHeader) ToBinary(regionTag uint32) []byte {
+	var buf bytes.Buffer
+
+	//write header record
+	actualDataSize := uint32(len(hdr.Data))
+	actualRecordCount := uint32(len(hdr.Records))
+	binary.Write(&buf, binary.BigEndian, &headerRecord{
+		Magic:            [4]byte{0x8E, 0xAD, 0xE8, 0x01},
+		Reserved:         [4]byte{0x00, 0x00, 0x00, 0x00},
+		IndexRecordCount: actualRecordCount + 1, //+1 for the region tag
+		DataSize:         actualDataSize + 16,   //+16 for the region tag
+	})
+
+	//write index record for region tag
+	//
+	//A "region" is defined nowhere in any kind of spec that I could find for
+	//RPM (i.e. neither in [LSB] nor [RPM]), but it's mentioned in the code of
+	//the rpm-org implementation where they have some validations for it.
+	//
+	//I don't fully grasp the meaning, but it appears that a region tag marks
+	//a set of header tags and data that are to be considered immutable, i.e.
+	//they may be used for validation purposes, such as calculating hash
+	//digests and signatures. I hope that I'm wrong, because this would imply
+	//that RPM has a concept of "metadata that's okay to manipulate even if the
+	//package is GPG-signed", which is insane even for RPM's standards.
+	//However, from what I've seen in the implementation, their regions always
+	//seem to span the whole header structure, therefore marking everything as
+	//immutable.
+	//
+	//We do the same thing. The index record for the region tag is at the
+	//*start* of the index record array, and its data is located at the *end*
+	//of the data area. The data is another index record that (using a negative
+	//offset into the data area) points back at the original index record. (I'm
+	//tempted to use the word "insane", but it feels like I use that word so
+	//often when talking about RPM that it has lost all meaning.)
+	binary.Write(&buf, binary.BigEndian, &rpmHeaderIndexRecord{
+		Tag:    regionTag,
+		Type:   rpmBinType,
+		Offset: actualDataSize,
+		Count:  16,
+	})
+
+	//write the actual index records
+	for _, ir := range hdr.Records {
+		binary.Write(&buf, binary.BigEndian, ir)
+	}
+
+	//write data
+	buf.Write(hdr.Data)
+
+	//write data for the region tag (see the wall of text above)
+	binary.Write(&buf, binary.BigEndian, &rpmHeaderIndexRecord{
+		Tag:    regionTag,
+		Type:   rpmBinType,
+		Offset: -(actualRecordCount + 1) * 16,
+		Count:  16,
+	})
+
+	return buf.Bytes()
+}
+
+//AddBinaryValue adds a value of type rpmBinType to this header.
+func (hdr *rpmHeader) AddBinaryValue(tag uint32, data []byte) {
+	hdr.Records = append(hdr.Records, &rpmHeaderIndexRecord{
+		Tag:    tag,
+		Type:   rpmBinType,
+		Offset: uint32(len(hdr.Data)),
+		Count:  uint32(len(data)),
+	})
+	hdr.Data = append(hdr.Data, data...)
+}
+
+//AddCharValue adds a value of type rpmCharType to this header.
+func (hdr *rpmHeader) AddCharValue(tag uint32, data []byte) {
+	//see near start of AddStringArrayValue() for rationale
+	if len(data) == 0 {
+		return
+	}
+
+	//no alignment needed for single bytes
+	hdr.Records = append(hdr.Records, &rpmHeaderIndexRecord{
+		Tag:    tag,
+		Type:   rpmCharType,
+		Offset: uint32(len(hdr.Data)),
+		Count:  uint32(len(data)),
+	})
+	hdr.Data = append(hdr.Data, data...)
+}
+
+//AddInt8Value adds a value of type rpmInt8Type to this header.
+func (hdr *rpmHeader) AddInt8Value(tag uint32, data []int8) {
+	//see near start of AddStringArrayValue() for rationale
+	if len(data) == 0 {
+		return
+	}
+
+	//no alignment needed for single bytes
+	hdr.Records = append(hdr.Records, &rpmHeaderIndexRecord{
+		Tag:    tag,
+		Type:   rpmInt8Type,
+		Offset: uint32(len(hdr.Data)),
+		Count:  uint32(len(data)),
+	})
+	for _, v := range data {
+		hdr.Data = append(hdr.Data, byte(v))
+	}
+}
+
+//AddInt16Value adds a value of type rpmInt16Type to this header.
+func (hdr *rpmHeader) AddInt16Value(tag uint32, data []int16) {
+	//see near start of AddStringArrayValue() for rationale
+	if len(data) == 0 {
+		return
+	}
+
+	//align to 2 bytes
+	if len(hdr.Data)%2 != 0 {
+		hdr.Data = append(hdr.Data, 0x00)
+	}
+
+	hdr.Records = append(hdr.Records, &rpmHeaderIndexRecord{
+		Tag:    tag,
+		Type:   rpmInt16Type,
+		Offset: uint32(len(hdr.Data)),
+		Count:  uint32(len(data)),
+	})
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, data)
+	hdr.Data = append(hdr.Data, buf.Bytes()...)
+}
+
+//AddInt32Value adds a value of type rpmInt32Type to this header.
+func (hdr *rpmHeader) AddInt32Value(tag uint32, data []int32) {
+	//see near start of AddStringArrayValue() for rationale
+	if len(data) == 0 {
+		return
+	}
+
+	//align to 4 bytes
+	for len(hdr.Data)%4 != 0 {
+		hdr.Data = append(hdr.Data, 0x00)
+	}
+
+	hdr.Records = append(hdr.Records, &rpmHeaderIndexRecord{
+		Tag:    tag,
+		Type:   rpmInt32Type,
+		Offset: uint32(len(hdr.Data)),
+		Count:  uint32(len(data)),
+	})
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, data)
+	hdr.Data = append(hdr.Data, buf.Bytes()...)
+}
+
+//AddInt64Value adds a value of type rpmInt64Type to this header.
+func (hdr *rpmHeader) AddInt64Value(tag uint32, data []int64) {
+	//see near start of AddStringArrayValue() for rationale
+	if len(data) == 0 {
+		return
+	}
+
+	//align to 8 bytes
+	for len(hdr.Data)%8 != 0 {
+		hdr.Data = append(hdr.Data, 0x00)
+	}
+
+	hdr.Records = append(hdr.Records, &rpmHeaderIndexRecord{
+		Tag:    tag,
+		Type:   rpmInt64Type,
+		Offset: uint32(len(hdr.Data)),
+		Count:  uint32(len(data)),
+	})
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, data)
+	hdr.Data = append(hdr.Data, buf.Bytes()...)
+}
+
+//AddStringValue adds a value of type rpmStringType or rpmI18NStringType to
+//this header.
+func (hdr *rpmHeader) AddStringValue(tag uint32, data string, i18n bool) {
+	var recordType uint32 = rpmStringType
+	if i18n {
+		recordType = rpmI18NStringType
+		//I18N strings require an I18N table listing the available locales;
+		//initialize that if needed
+		if !hdr.hasI18NTable {
+			hdr.AddStringArrayValue(rpmtagHeaderI18NTable, []string{"C"})
+			hdr.hasI18NTable = true
+		}
+	}
+
+	hdr.Records = append(hdr.Records, &rpmHeaderIndexRecord{
+		Tag:    tag,
+		Type:   recordType,
+		Offset: uint32(len(hdr.Data)),
+		Count:  1,
+	})
+	hdr.Data = append(append(hdr.Data, []byte(data)...), 0x00)
+}
+
+//AddStringArrayValue adds a value of type rpmStringArrayType to this header.
+func (hdr *rpmHeader) AddStringArrayValue(tag uint32, data []string) {
+	//skip the tag entirely if it does not contain any data (even if the tag
+	//may be listed as "required"); e.g. in metapackages without filesystem
+	//entries, none of the filesystem metadata tags may be written (this is
+	//because RPM's dataLength() function returns failure if 0 strings were
+	//read, even if there were legitimately 0 strings)
+	if len(data) == 0 {
+		return
+	}
+
+	hdr.Records = append(hdr.Records, &rpmHeaderIndexRecord{
+		Tag:    tag,
+		Type:   rpmStringArrayType,
+		Offset: uint32(len(hdr.Data)),
+		Count:  uint32(len(data)),
+	})
+	for _, str := range data {
+		hdr.Data = append(append(hdr.Data, []byte(str)...), 0x00)
+	}
+}
+
+//PlanValues describes the values in this header section for a build.Plan. The
+//keys are the tag names from rpmHeaderTags, and arrays are described by one
+//value per element. The I18N table is omitted since AddStringValue() adds it
+//implicitly.
+func (hdr *rpmHeader) PlanValues() []build.PlanValue {
+	var result []build.PlanValue
+	for _, ir := range hdr.Records {
+		if ir.Tag == rpmtagHeaderI18NTable {
+			continue
+		}
+		key := rpmHeaderTags[ir.Tag].Name
+		data := hdr.Data[ir.Offset:]
+		for idx := 0; idx < int(ir.Count); idx++ {
+			var value string
+			switch ir.Type {
+			case rpmCharType, rpmInt8Type:
+				value = strconv.FormatUint(uint64(data[idx]), 10)
+			case rpmInt16Type:
+				value = strconv.FormatUint(uint64(binary.BigEndian.Uint16(data[2*idx:])), 10)
+			case rpmInt32Type:
+				value = strconv.FormatUint(uint64(binary.BigEndian.Uint32(data[4*idx:])), 10)
+			case rpmInt64Type:
+				value = strconv.FormatUint(binary.BigEndian.Uint64(data[8*idx:]), 10)
+			case rpmStringType, rpmI18NStringType, rpmStringArrayType:
+				end := bytes.IndexByte(data, 0x00)
+				value = string(data[:end])
+				data = data[end+1:]
+			default:
+				panic("unreachable")
+			}
+			result = append(result, build.PlanValue{Key: key, Value: value})
+		}
+	}
+	return result
+}
+
+//newHeaderFromPlan builds a header section from values as described by
+//PlanValues(). Consecutive values with the same key are the elements of one
+//array.
+func newHeaderFromPlan(values []build.PlanValue) (*rpmHeader, error) {
+	hdr := &rpmHeader{}
+	for len(values) > 0 {
+		count := 1
+		for count < len(values) && values[count].Key == values[0].Key {
+			count++
+		}
+		key := values[0].Key
+		elements := make([]string, count)
+		for idx, value := range values[:count] {
+			elements[idx] = value.Value
+		}
+		values = values[count:]
+
+		tag, exists := rpmHeaderTagsByName[key]
+		if !exists {
+			return nil, fmt.Errorf("unknown RPM header tag in plan: %s", key)
+		}
+		switch tagType := rpmHeaderTags[tag].Type; tagType {
+		case rpmCharType:
+			ints, err := parsePlanIntegers(key, elements, 8)
+			if err != nil {
+				return nil, err
+			}
+			data := make([]byte, count)
+			for idx, v := range ints {
+				data[idx] = byte(v)
+			}
+			hdr.AddCharValue(tag, data)
+		case rpmInt8Type:
+			ints, err := parsePlanIntegers(key, elements, 8)
+			if err != nil {
+				return nil, err
+			}
+			data := make([]int8, count)
+			for idx, v := range ints {
+				data[idx] = int8(uint8(v))
+			}
+			hdr.AddInt8Value(tag, data)
+		case rpmInt16Type:
+			ints, err := parsePlanIntegers(key, elements, 16)
+			if err != nil {
+				return nil, err
+			}
+			data := make([]int16, count)
+			for idx, v := range ints {
+				data[idx] = int16(uint16(v))
+			}
+			hdr.AddInt16Value(tag, data)
+		case rpmInt32Type:
+			ints, err := parsePlanIntegers(key, elements, 32)
+			if err != nil {
+				return nil, err
+			}
+			data := make([]int32, count)
+			for idx, v := range ints {
+				data[idx] = int32(uint32(v))
+			}
+			hdr.AddInt32Value(tag, data)
+		case rpmInt64Type:
+			ints, err := parsePlanIntegers(key, elements, 64)
+			if err != nil {
+				return nil, err
+			}
+			data := make([]int64, count)
+			for idx, v := range ints {
+				data[idx] = int64(v)
+			}
+			hdr.AddInt64Value(tag, data)
+		case rpmStringType, rpmI18NStringType:
+			if count > 1 {
+				return nil, fmt.Errorf("RPM header tag %s in plan has %d values, but only one is allowed", key, count)
+			}
+			hdr.AddStringValue(tag, elements[0], tagType == rpmI18NStringType)
+		case rpmStringArrayType:
+			hdr.AddStringArrayValue(tag, elements)
+		}
+	}
+	return hdr, nil
+}
+
+//parsePlanIntegers parses the elements of an integer array in a plan.
+func parsePlanIntegers(key string, elements []string, bitSize int) ([]uint64, error) {
+	result := make([]uint64, len(elements))
+	for idx, element := range elements {
+		v, err := strconv.ParseUint(element, 10, bitSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for RPM header tag %s in plan: %q", key, element)
+		}
+		result[idx] = v
+	}
+	return result, nil
+}
+
+//List of known values for rpmHeaderIndexRecord.Type. [LSB,25.2.2.2.1]
+//
+//Note that we don't support writing all types; null is not needed for any
+//tag. Char and int8 are not needed for the tags that we generate ourselves,
+//but may appear in a plan (e.g. FILESTATES).
+const (
+	rpmNullType        = 0
+	rpmCharType        = 1
+	rpmInt8Type        = 2
+	rpmInt16Type       = 3
+	rpmInt32Type       = 4
+	rpmInt64Type       = 5 //reserved in [LSB], but used by rpm-org for the LONG* tags
+	rpmStringType      = 6
+	rpmBinType         = 7
+	rpmStringArrayType = 8
+	rpmI18NStringType  = 9
+)
+
+//List of known values for rpmHeaderIndexRecord.Tag. [LSB, 25.2.2.2.2 ff.]
+const (
+	rpmtagHeaderSignatures  = 62   //type: BIN
+	rpmtagHeaderImmutable   = 63   //type: BIN
+	rpmtagHeaderI18NTable   = 100  //type: STRING_ARRAY
+	rpmsigtagSize           = 1000 //type: INT32
+	rpmsigtagPayloadSize    = 1007 //type: INT32
+	rpmsigtagLongSize       = 270  //type: INT64
+	rpmsigtagLongArchSize   = 271  //type: INT64
+	rpmsigtagSHA1           = 269  //type: STRING
+	rpmsigtagMD5            = 1004 //type: BIN
+	rpmsigtagDSA            = 267  //type: BIN
+	rpmsigtagRSA            = 268  //type: BIN
+	rpmsigtagPGP            = 1002 //type: BIN
+	rpmsigtagGPG            = 1005 //type: BIN
+	rpmtagName              = 1000 //type: STRING
+	rpmtagVersion           = 1001 //type: STRING
+	rpmtagRelease           = 1002 //type: STRING
+	rpmtagSummary           = 1004 //type: I18NSTRING
+	rpmtagDescription       = 1005 //type: I18NSTRING
+	rpmtagSize              = 1009 //type: INT32
+	rpmtagLongSize          = 5009 //type: INT64
+	rpmtagDistribution      = 1010 //type: STRING
+	rpmtagVendor            = 1011 //type: STRING
+	rpmtagLicense           = 1014 //type: STRING
+	rpmtagPackager          = 1015 //type: STRING
+	rpmtagGroup             = 1016 //type: I18NSTRING
+	rpmtagURL               = 1020 //type: STRING
+	rpmtagOs                = 1021 //type: STRING
+	rpmtagArch              = 1022 //type: STRING
+	rpmtagSourceRPM         = 1044 //type: STRING
+	rpmtagArchiveSize       = 1046 //type: INT32
+	rpmtagLongArchiveSize   = 271  //type: INT64
+	rpmtagRPMVersion        = 1064 //type: STRING
+	rpmtagCookie            = 1094 //type: STRING
+	rpmtagDistURL           = 1123 //type: STRING
+	rpmtagPayloadFormat     = 1124 //type: STRING
+	rpmtagPayloadCompressor = 1125 //type: STRING
+	rpmtagPayloadFlags      = 1126 //type: STRING
+	rpmtagPreIn             = 1023 //type: STRING
+	rpmtagPostIn            = 1024 //type: STRING
+	rpmtagPreUn             = 1025 //type: STRING
+	rpmtagPostUn            = 1026 //type: STRING
+	rpmtagPreInProg         = 1085 //type: STRING
+	rpmtagPostInProg        = 1086 //type: STRING
+	rpmtagPreUnProg         = 1087 //type: STRING
+	rpmtagPostUnProg        = 1088 //type: STRING
+	rpmtagPreTrans          = 1151 //type: STRING
+	rpmtagPostTrans         = 1152 //type: STRING
+	rpmtagPreTransProg      = 1153 //type: STRING
+	rpmtagPostTransProg     = 1154 //type: STRING
+	rpmtagVerifyScript      = 1079 //type: STRING
+	rpmtagVerifyScriptProg  = 1091 //type: STRING
+	rpmtagOldFileNames      = 1027 //type: STRING_ARRAY
+	rpmtagFileSizes         = 1028 //type: INT32
+	rpmtagFileStates        = 1029 //type: CHAR
+	rpmtagLongFileSizes     = 5008 //type: INT64
+	rpmtagFileModes         = 1030 //type: INT16
+	rpmtagFileRdevs         = 1033 //type: INT16
+	rpmtagFileMtimes        = 1034 //type: INT32
+	rpmtagFileMD5s          = 1035 //type: STRING_ARRAY
+	rpmtagFileLinktos       = 1036 //type: STRING_ARRAY
+	rpmtagFileFlags         = 1037 //type: INT32
+	rpmtagFileVerifyFlags   = 1045 //type: INT32
+	rpmtagFileUserName      = 1039 //type: STRING_ARRAY
+	rpmtagFileGroupName     = 1040 //type: STRING_ARRAY
+	rpmtagFileDevices       = 1095 //type: INT32
+	rpmtagFileInodes        = 1096 //type: INT32
+	rpmtagFileLangs         = 1097 //type: STRING_ARRAY
+	rpmtagDirIndexes        = 1116 //type: INT32
+	rpmtagBasenames         = 1117 //type: STRING_ARRAY
+	rpmtagDirNames          = 1118 //type: STRING_ARRAY
+	rpmtagProvideName       = 1047 //type: STRING_ARRAY
+	rpmtagProvideFlags      = 1112 //type: INT32
+	rpmtagProvideVersion    = 1113 //type: STRING_ARRAY
+	rpmtagRequireName       = 1049 //type: STRING_ARRAY
+	rpmtagRequireFlags      = 1048 //type: INT32
+	rpmtagRequireVersion    = 1050 //type: STRING_ARRAY
+	rpmtagConflictName      = 1054 //type: STRING_ARRAY
+	rpmtagConflictFlags     = 1053 //type: INT32
+	rpmtagConflictVersion   = 1055 //type: STRING_ARRAY
+	rpmtagObsoleteName      = 1090 //type: STRING_ARRAY
+	rpmtagObsoleteFlags     = 1114 //type: INT32
+	rpmtagObsoleteVersion   = 1115 //type: STRING_ARRAY
+
+	rpmtagTriggerScripts             = 1065 //type: STRING_ARRAY
+	rpmtagTriggerName                = 1066 //type: STRING_ARRAY
+	rpmtagTriggerVersion             = 1067 //type: STRING_ARRAY
+	rpmtagTriggerFlags               = 1068 //type: INT32
+	rpmtagTriggerIndex               = 1069 //type: INT32
+	rpmtagTriggerScriptProg          = 1092 //type: STRING_ARRAY
+	rpmtagTransFileTriggerScripts    = 5076 //type: STRING_ARRAY
+	rpmtagTransFileTriggerScriptProg = 5077 //type: STRING_ARRAY
+	rpmtagTransFileTriggerName       = 5079 //type: STRING_ARRAY
+	rpmtagTransFileTriggerIndex      = 5080 //type: INT32
+	rpmtagTransFileTriggerVersion    = 5081 //type: STRING_ARRAY
+	rpmtagTransFileTriggerFlags      = 5082 //type: INT32
+	rpmtagTransFileTriggerPriorities = 5085 //type: INT32
+)
+
+//rpmHeaderTags contains the name and type of each tag that can appear in the
+//header section (but not in the signature section). The names are the ones
+//from RPMTAG_* in rpm-org, and are used in build.Plan.
+var rpmHeaderTags = map[uint32]struct {
+	Name string
+	Type uint32
+}{
+	rpmtagName:                       {"NAME", rpmStringType},
+	rpmtagVersion:                    {"VERSION", rpmStringType},
+	rpmtagRelease:                    {"RELEASE", rpmStringType},
+	rpmtagSummary:                    {"SUMMARY", rpmI18NStringType},
+	rpmtagDescription:                {"DESCRIPTION", rpmI18NStringType},
+	rpmtagSize:                       {"SIZE", rpmInt32Type},
+	rpmtagLongSize:                   {"LONGSIZE", rpmInt64Type},
+	rpmtagDistribution:               {"DISTRIBUTION", rpmStringType},
+	rpmtagVendor:                     {"VENDOR", rpmStringType},
+	rpmtagLicense:                    {"LICENSE", rpmStringType},
+	rpmtagPackager:                   {"PACKAGER", rpmStringType},
+	rpmtagGroup:                      {"GROUP", rpmI18NStringType},
+	rpmtagURL:                        {"URL", rpmStringType},
+	rpmtagOs:                         {"OS", rpmStringType},
+	rpmtagArch:                       {"ARCH", rpmStringType},
+	rpmtagSourceRPM:                  {"SOURCERPM", rpmStringType},
+	rpmtagArchiveSize:                {"ARCHIVESIZE", rpmInt32Type},
+	rpmtagLongArchiveSize:            {"LONGARCHIVESIZE", rpmInt64Type},
+	rpmtagRPMVersion:                 {"RPMVERSION", rpmStringType},
+	rpmtagCookie:                     {"COOKIE", rpmStringType},
+	rpmtagDistURL:                    {"DISTURL", rpmStringType},
+	rpmtagPayloadFormat:              {"PAYLOADFORMAT", rpmStringType},
+	rpmtagPayloadCompressor:          {"PAYLOADCOMPRESSOR", rpmStringType},
+	rpmtagPayloadFlags:               {"PAYLOADFLAGS", rpmStringType},
+	rpmtagPreIn:                      {"PREIN", rpmStringType},
+	rpmtagPostIn:                     {"POSTIN", rpmStringType},
+	rpmtagPreUn:                      {"PREUN", rpmStringType},
+	rpmtagPostUn:                     {"POSTUN", rpmStringType},
+	rpmtagPreInProg:                  {"PREINPROG", rpmStringType},
+	rpmtagPostInProg:                 {"POSTINPROG", rpmStringType},
+	rpmtagPreUnProg:                  {"PREUNPROG", rpmStringType},
+	rpmtagPostUnProg:                 {"POSTUNPROG", rpmStringType},
+	rpmtagPreTrans:                   {"PRETRANS", rpmStringType},
+	rpmtagPostTrans:                  {"POSTTRANS", rpmStringType},
+	rpmtagPreTransProg:               {"PRETRANSPROG", rpmStringType},
+	rpmtagPostTransProg:              {"POSTTRANSPROG", rpmStringType},
+	rpmtagVerifyScript:               {"VERIFYSCRIPT", rpmStringType},
+	rpmtagVerifyScriptProg:           {"VERIFYSCRIPTPROG", rpmStringType},
+	rpmtagOldFileNames:               {"OLDFILENAMES", rpmStringArrayType},
+	rpmtagFileSizes:                  {"FILESIZES", rpmInt32Type},
+	rpmtagFileStates:                 {"FILESTATES", rpmCharType},
+	rpmtagLongFileSizes:              {"LONGFILESIZES", rpmInt64Type},
+	rpmtagFileModes:                  {"FILEMODES", rpmInt16Type},
+	rpmtagFileRdevs:                  {"FILERDEVS", rpmInt16Type},
+	rpmtagFileMtimes:                 {"FILEMTIMES", rpmInt32Type},
+	rpmtagFileMD5s:                   {"FILEMD5S", rpmStringArrayType},
+	rpmtagFileLinktos:                {"FILELINKTOS", rpmStringArrayType},
+	rpmtagFileFlags:                  {"FILEFLAGS", rpmInt32Type},
+	rpmtagFileVerifyFlags:            {"FILEVERIFYFLAGS", rpmInt32Type},
+	rpmtagFileUserName:               {"FILEUSERNAME", rpmStringArrayType},
+	rpmtagFileGroupName:              {"FILEGROUPNAME", rpmStringArrayType},
+	rpmtagFileDevices:                {"FILEDEVICES", rpmInt32Type},
+	rpmtagFileInodes:                 {"FILEINODES", rpmInt32Type},
+	rpmtagFileLangs:                  {"FILELANGS", rpmStringArrayType},
+	rpmtagDirIndexes:                 {"DIRINDEXES", rpmInt32Type},
+	rpmtagBasenames:                  {"BASENAMES", rpmStringArrayType},
+	rpmtagDirNames:                   {"DIRNAMES", rpmStringArrayType},
+	rpmtagProvideName:                {"PROVIDENAME", rpmStringArrayType},
+	rpmtagProvideFlags:               {"PROVIDEFLAGS", rpmInt32Type},
+	rpmtagProvideVersion:             {"PROVIDEVERSION", rpmStringArrayType},
+	rpmtagRequireName:                {"REQUIRENAME", rpmStringArrayType},
+	rpmtagRequireFlags:               {"REQUIREFLAGS", rpmInt32Type},
+	rpmtagRequireVersion:             {"REQUIREVERSION", rpmStringArrayType},
+	rpmtagConflictName:               {"CONFLICTNAME", rpmStringArrayType},
+	rpmtagConflictFlags:              {"CONFLICTFLAGS", rpmInt32Type},
+	rpmtagConflictVersion:            {"CONFLICTVERSION", rpmStringArrayType},
+	rpmtagObsoleteName:               {"OBSOLETENAME", rpmStringArrayType},
+	rpmtagObsoleteFlags:              {"OBSOLETEFLAGS", rpmInt32Type},
+	rpmtagObsoleteVersion:            {"OBSOLETEVERSION", rpmStringArrayType},
+	rpmtagTriggerScripts:             {"TRIGGERSCRIPTS", rpmStringArrayType},
+	rpmtagTriggerName:                {"TRIGGERNAME", rpmStringArrayType},
+	rpmtagTriggerVersion:             {"TRIGGERVERSION", rpmStringArrayType},
+	rpmtagTriggerFlags:               {"TRIGGERFLAGS", rpmInt32Type},
+	rpmtagTriggerIndex:               {"TRIGGERINDEX", rpmInt32Type},
+	rpmtagTriggerScriptProg:          {"TRIGGERSCRIPTPROG", rpmStringArrayType},
+	rpmtagTransFileTriggerScripts:    {"TRANSFILETRIGGERSCRIPTS", rpmStringArrayType},
+	rpmtagTransFileTriggerScriptProg: {"TRANSFILETRIGGERSCRIPTPROG", rpmStringArrayType},
+	rpmtagTransFileTriggerName:       {"TRANSFILETRIGGERNAME", rpmStringArrayType},
+	rpmtagTransFileTriggerIndex:      {"TRANSFILETRIGGERINDEX", rpmInt32Type},
+	rpmtagTransFileTriggerVersion:    {"TRANSFILETRIGGERVERSION", rpmStringArrayType},
+	rpmtagTransFileTriggerFlags:      {"TRANSFILETRIGGERFLAGS", rpmInt32Type},
+	rpmtagTransFileTriggerPriorities: {"TRANSFILETRIGGERPRIORITIES", rpmInt32Type},
+}
+
+//rpmHeaderTagsByName is the reverse lookup table for rpmHeaderTags.
+var rpmHeaderTagsByName = func() map[string]uint32 {
+	result := make(map[string]uint32, len(rpmHeaderTags))
+	for tag, info := range rpmHeaderTags {
+		result[info.Name] = tag
+	}
+	return result
+}()
+
+//Values for rpmtagFileFlags, see [LSB,25.2.4.3.1].
+const (
+	rpmfileConfig    = (1 << 0)
+	rpmfileDoc       = (1 << 1)
+	rpmfileDoNotUse  = (1 << 2)
+	rpmfileMissingOK = (1 << 3)
+	rpmfileNoReplace = (1 << 4)
+	rpmfileSpecFile  = (1 << 5)
+	rpmfileGhost     = (1 << 6)
+	rpmfileLicense   = (1 << 7)
+	rpmfileReadme    = (1 << 8)
+	rpmfileExclude   = (1 << 9)
+)
+
+//Values for rpmtagFileVerifyFlags, see rpmVerifyAttrs_e in
+///usr/include/rpm/rpmfiles.h.
+var rpmverifyFlags = map[string]int32{
+	"digest": (1 << 0),
+	"size":   (1 << 1),
+	"link":   (1 << 2),
+	"owner":  (1 << 3),
+	"group":  (1 << 4),
+	"mtime":  (1 << 5),
+	"mode":   (1 << 6),
+	"rdev":   (1 << 7),
+	"caps":   (1 << 8),
+}
+
+//rpmverifyAll is the value of rpmtagFileVerifyFlags for files that are fully
+//verified.
+const rpmverifyAll = (1 << 9) - 1
+
+//Values for rpmtagRequireFlags, rpmtagConflictFlags, rpmtagProvideFlags, rpmtagObsoleteFlags. See [LSB,25.2.4.4.2].
+//
+//Note that "RPMSENSE" is copied from the spec, but is clearly a euphemism.
+//There is nothing in RPM that makes sense.
+const (
+	rpmsenseAny           = 0
+	rpmsenseLess          = 0x02
+	rpmsenseGreater       = 0x04
+	rpmsenseEqual         = 0x08
+	rpmsensePrereq        = 0x40
+	rpmsenseInterp        = 0x100
+	rpmsenseScriptPre     = 0x200
+	rpmsenseScriptPost    = 0x400
+	rpmsenseScriptPreUn   = 0x800
+	rpmsenseScriptPostUn  = 0x1000
+	rpmsenseTriggerIn     = 0x10000
+	rpmsenseTriggerPostUn = 0x40000
+	rpmsenseRpmlib        = 0x1000000
+)
@@ -23,7 +23,7 @@ import (
 	"bytes"
 	"encoding/binary"
 
-	build "github.com/holocm/libpackagebuild"
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
 )
 
 //rpmLead represents the RPM lead (the first header of an RPM file, before the
@@ -39,13 +39,21 @@ type rpmLead struct {
 	Reserved           [16]byte
 }
 
-//newLead creates a lead for the given package.
-func newLead(pkg *build.Package) *rpmLead {
+//newLead creates a lead for the package described by the given header values
+//(see rpmHeader.PlanValues()).
+func newLead(values []build.PlanValue) *rpmLead {
+	var architecture uint16
+	for arch, archString := range archMap {
+		if archString == planValue(values, "ARCH") {
+			architecture = archIDMap[arch]
+		}
+	}
+
 	lead := &rpmLead{
 		Magic:        [4]byte{0xed, 0xab, 0xee, 0xdb},
 		Version:      [2]byte{0x03, 0x00},
 		Type:         0, //binary package
-		Architecture: archIDMap[pkg.Architecture],
+		Architecture: architecture,
 		//NameVersionRelease initialized below
 		OperatingSystem: 1, //Linux
 		SignatureType:   5, //signature section follows
@@ -58,7 +66,7 @@ func newLead(pkg *build.Package) *rpmLead {
 	}
 
 	//initialize name-version-release string, but respect limited field size
-	nvr := []byte(pkg.Name + "-" + fullVersionString(pkg))
+	nvr := []byte(planValue(values, "NAME") + "-" + planValue(values, "VERSION") + "-" + planValue(values, "RELEASE"))
 	for idx := 0; idx < 65; idx++ {
 		if idx < len(nvr) {
 			lead.NameVersionRelease[idx] = nvr[idx]
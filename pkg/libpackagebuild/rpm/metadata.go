@@ -21,27 +21,37 @@ package rpm
 
 import (
 	"fmt"
+	"math"
 	"path/filepath"
 	"strings"
 
-	build "github.com/holocm/libpackagebuild"
-	"github.com/holocm/libpackagebuild/filesystem"
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
 )
 
-//makeHeaderSection produces the header section of an RPM header.
-func makeHeaderSection(pkg *build.Package, payload *rpmPayload) []byte {
+//makeHeader produces the header section of an RPM package whose uncompressed
+//payload has the given size.
+func makeHeader(pkg *build.Package, archiveSize uint64) (*rpmHeader, error) {
 	h := &rpmHeader{}
 
 	addPackageInformationTags(h, pkg)
-	h.AddInt32Value(rpmtagArchiveSize, []int32{int32(payload.UncompressedSize)})
+	if archiveSize > math.MaxUint32 {
+		h.AddInt64Value(rpmtagLongArchiveSize, []int64{int64(archiveSize)})
+	} else {
+		h.AddInt32Value(rpmtagArchiveSize, []int32{int32(uint32(archiveSize))})
+	}
 
 	addInstallationTags(h, pkg)
+	addTriggerTags(h, pkg)
 
-	addFileInformationTags(h, pkg)
+	err := addFileInformationTags(h, pkg)
+	if err != nil {
+		return nil, err
+	}
 
 	addDependencyInformationTags(h, pkg)
 
-	return h.ToBinary(rpmtagHeaderImmutable)
+	return h, nil
 }
 
 //see [LSB,25.2.4.1]
@@ -54,8 +64,12 @@ func addPackageInformationTags(h *rpmHeader, pkg *build.Package) {
 	descSplit := strings.SplitN(pkg.Description, "\n", 2)
 	h.AddStringValue(rpmtagSummary, descSplit[0], true)
 	h.AddStringValue(rpmtagDescription, pkg.Description, true)
-	sizeInBytes := int32(pkg.FSRoot.InstalledSizeInBytes())
-	h.AddInt32Value(rpmtagSize, []int32{sizeInBytes})
+	sizeInBytes := pkg.FSRoot.InstalledSizeInBytes()
+	if needsLongSizes(pkg) {
+		h.AddInt64Value(rpmtagLongSize, []int64{sizeInBytes})
+	} else {
+		h.AddInt32Value(rpmtagSize, []int32{int32(uint32(sizeInBytes))})
+	}
 
 	h.AddStringValue(rpmtagLicense, "None", false)
 
@@ -80,26 +94,67 @@ func addPackageInformationTags(h *rpmHeader, pkg *build.Package) {
 
 //see [LSB,25.2.4.2]
 func addInstallationTags(h *rpmHeader, pkg *build.Package) {
-	if script := pkg.Script(build.SetupAction); script != "" {
-		h.AddStringValue(rpmtagPostIn, script, false)
-		h.AddStringValue(rpmtagPostInProg, "/bin/sh", false)
+	script, interpreter := pkg.ScriptWithInterpreter(build.PreSetupAction)
+	addScriptTags(h, script, interpreter, rpmtagPreIn, rpmtagPreInProg)
+	script, interpreter = scriptWithSnippet(pkg, build.SetupAction, joinSnippets(alternativesPost(pkg), servicesPost(pkg)))
+	addScriptTags(h, script, interpreter, rpmtagPostIn, rpmtagPostInProg)
+	script, interpreter = scriptWithSnippet(pkg, build.PreCleanupAction, joinSnippets(servicesPreun(pkg), alternativesPreun(pkg)))
+	addScriptTags(h, script, interpreter, rpmtagPreUn, rpmtagPreUnProg)
+	script, interpreter = scriptWithSnippet(pkg, build.CleanupAction, servicesPostun(pkg))
+	addScriptTags(h, script, interpreter, rpmtagPostUn, rpmtagPostUnProg)
+	script, interpreter = pkg.ScriptWithInterpreter(build.PreTransactionAction)
+	addScriptTags(h, script, interpreter, rpmtagPreTrans, rpmtagPreTransProg)
+	script, interpreter = pkg.ScriptWithInterpreter(build.PostTransactionAction)
+	addScriptTags(h, script, interpreter, rpmtagPostTrans, rpmtagPostTransProg)
+	script, interpreter = pkg.ScriptWithInterpreter(build.VerifyAction)
+	addScriptTags(h, script, interpreter, rpmtagVerifyScript, rpmtagVerifyScriptProg)
+}
+
+//scriptWithSnippet returns the script for the given action type, followed by
+//the given shell snippet. If there is no snippet, the actions' interpreter is
+//used if they all agree on one.
+func scriptWithSnippet(pkg *build.Package, actionType uint, snippet string) (script, interpreter string) {
+	if snippet == "" {
+		return pkg.ScriptWithInterpreter(actionType)
 	}
-	if script := pkg.Script(build.CleanupAction); script != "" {
-		h.AddStringValue(rpmtagPostUn, script, false)
-		h.AddStringValue(rpmtagPostUnProg, "/bin/sh", false)
+	return strings.TrimSpace(pkg.Script(actionType) + "\n" + snippet), ""
+}
+
+//joinSnippets concatenates the non-empty ones of the given shell snippets.
+func joinSnippets(snippets ...string) string {
+	var nonEmpty []string
+	for _, snippet := range snippets {
+		if snippet != "" {
+			nonEmpty = append(nonEmpty, snippet)
+		}
 	}
+	return strings.Join(nonEmpty, "\n")
+}
+
+//addScriptTags adds the given script (if any) and the program that runs it,
+//which is /bin/sh unless another interpreter is given.
+func addScriptTags(h *rpmHeader, script, interpreter string, scriptTag, progTag uint32) {
+	if script == "" {
+		return
+	}
+	if interpreter == "" {
+		interpreter = "/bin/sh"
+	}
+	h.AddStringValue(scriptTag, script, false)
+	h.AddStringValue(progTag, interpreter, false)
 }
 
 //see [LSB,25.2.4.3]
-func addFileInformationTags(h *rpmHeader, pkg *build.Package) {
+func addFileInformationTags(h *rpmHeader, pkg *build.Package) error {
 	var (
-		sizes       []int32
+		sizes       []int64
 		modes       []int16
 		rdevs       []int16
 		mtimes      []int32
 		md5s        []string
 		linktos     []string
 		flags       []int32
+		verifyFlags []int32
 		ownerNames  []string
 		groupNames  []string
 		devices     []int32
@@ -109,11 +164,13 @@ func addFileInformationTags(h *rpmHeader, pkg *build.Package) {
 		basenames   []string
 		dirnames    []string
 		inodeNumber int32
+		//FILEVERIFYFLAGS is only written if any file is not fully verified
+		hasVerifyFlags bool
 	)
 
 	//collect attributes for all files in the archive
 	//(NOTE: This traversal works in the same way as the one in MakePayload.)
-	pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+	err := pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
 		//skip implicitly created directories (as rpmbuild-constructed CPIO
 		//archives apparently do)
 		if n, ok := node.(*filesystem.Directory); ok {
@@ -143,7 +200,7 @@ func addFileInformationTags(h *rpmHeader, pkg *build.Package) {
 
 		//actually plausible metadata
 		modes = append(modes, int16(node.FileModeForArchive(true)))
-		mtimes = append(mtimes, 0)
+		mtimes = append(mtimes, int32(node.ModTime().Unix()))
 
 		//type-dependent metadata
 		switch n := node.(type) {
@@ -152,34 +209,74 @@ func addFileInformationTags(h *rpmHeader, pkg *build.Package) {
 			md5s = append(md5s, "")
 			linktos = append(linktos, "")
 			flags = append(flags, 0)
+			verifyFlags = append(verifyFlags, rpmverifyAll)
 			ownerNames = append(ownerNames, idToString(n.Metadata.UID()))
 			groupNames = append(groupNames, idToString(n.Metadata.GID()))
 		case *filesystem.RegularFile:
-			sizes = append(sizes, int32(len(n.Content)))
-			md5s = append(md5s, n.MD5Digest())
+			sizes = append(sizes, n.ContentSize())
+			digest, err := n.MD5Digest()
+			if err != nil {
+				return err
+			}
+			md5s = append(md5s, digest)
 			linktos = append(linktos, "")
-			flags = append(flags, rpmfileNoReplace)
+			flag := int32(rpmfileNoReplace)
+			if n.Documentation {
+				flag |= rpmfileDoc
+			}
+			if n.License {
+				flag |= rpmfileLicense
+			}
+			if n.Config {
+				flag |= rpmfileConfig
+			}
+			flags = append(flags, flag)
+			if n.VerifyAttributes == nil {
+				verifyFlags = append(verifyFlags, rpmverifyAll)
+			} else {
+				var verifyFlag int32
+				for _, attr := range n.VerifyAttributes {
+					verifyFlag |= rpmverifyFlags[attr]
+				}
+				verifyFlags = append(verifyFlags, verifyFlag)
+				hasVerifyFlags = true
+			}
 			ownerNames = append(ownerNames, idToString(n.Metadata.UID()))
 			groupNames = append(groupNames, idToString(n.Metadata.GID()))
 		case *filesystem.Symlink:
-			sizes = append(sizes, int32(len(n.Target)))
+			sizes = append(sizes, int64(len(n.Target)))
 			md5s = append(md5s, "")
 			linktos = append(linktos, n.Target)
 			flags = append(flags, 0)
-			ownerNames = append(ownerNames, "root")
-			groupNames = append(groupNames, "root")
+			verifyFlags = append(verifyFlags, rpmverifyAll)
+			ownerNames = append(ownerNames, idToString(n.Metadata.UID()))
+			groupNames = append(groupNames, idToString(n.Metadata.GID()))
 		}
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
 
-	h.AddInt32Value(rpmtagFileSizes, sizes)
+	if needsLongSizes(pkg) {
+		h.AddInt64Value(rpmtagLongFileSizes, sizes)
+	} else {
+		sizes32 := make([]int32, len(sizes))
+		for idx, size := range sizes {
+			sizes32[idx] = int32(uint32(size))
+		}
+		h.AddInt32Value(rpmtagFileSizes, sizes32)
+	}
 	h.AddInt16Value(rpmtagFileModes, modes)
 	h.AddInt16Value(rpmtagFileRdevs, rdevs)
 	h.AddInt32Value(rpmtagFileMtimes, mtimes)
 	h.AddStringArrayValue(rpmtagFileMD5s, md5s)
 	h.AddStringArrayValue(rpmtagFileLinktos, linktos)
 	h.AddInt32Value(rpmtagFileFlags, flags)
+	if hasVerifyFlags {
+		h.AddInt32Value(rpmtagFileVerifyFlags, verifyFlags)
+	}
 	h.AddStringArrayValue(rpmtagFileUserName, ownerNames)
 	h.AddStringArrayValue(rpmtagFileGroupName, groupNames)
 	h.AddInt32Value(rpmtagFileDevices, devices)
@@ -188,6 +285,13 @@ func addFileInformationTags(h *rpmHeader, pkg *build.Package) {
 	h.AddInt32Value(rpmtagDirIndexes, dirIndexes)
 	h.AddStringArrayValue(rpmtagBasenames, basenames)
 	h.AddStringArrayValue(rpmtagDirNames, dirnames)
+	return nil
+}
+
+//Like rpmbuild, we use the INT64 tags LONGSIZE and LONGFILESIZES instead of
+//SIZE and FILESIZES if the total size does not fit into 32 bits.
+func needsLongSizes(pkg *build.Package) bool {
+	return pkg.FSRoot.InstalledSizeInBytes() > math.MaxUint32
 }
 
 //If `list` contains `value`, otherwise append `value` to `list`.
@@ -213,13 +317,13 @@ func idToString(id uint32) string {
 
 //see [LSB,25.2.4.4]
 func addDependencyInformationTags(h *rpmHeader, pkg *build.Package) {
-	serializeRelations(h, pkg.Requires,
+	serializeRelations(h, pkg, pkg.Requires,
 		rpmtagRequireName, rpmtagRequireFlags, rpmtagRequireVersion)
-	serializeRelations(h, pkg.Provides,
+	serializeRelations(h, pkg, pkg.Provides,
 		rpmtagProvideName, rpmtagProvideFlags, rpmtagProvideVersion)
-	serializeRelations(h, pkg.Conflicts,
+	serializeRelations(h, pkg, pkg.Conflicts,
 		rpmtagConflictName, rpmtagConflictFlags, rpmtagConflictVersion)
-	serializeRelations(h, pkg.Replaces,
+	serializeRelations(h, pkg, pkg.Replaces,
 		rpmtagObsoleteName, rpmtagObsoleteFlags, rpmtagObsoleteVersion)
 }
 
@@ -245,6 +349,12 @@ var rpmlibPseudoDependencies = []rpmlibPseudoDependency{
 	{"PayloadFilesHavePrefix", "4.0-1"},
 }
 
+//indicates that the LONGSIZE and LONGFILESIZES tags are used
+var rpmlibLargeFilesDependency = rpmlibPseudoDependency{"LargeFiles", "4.12.0-1"}
+
+//indicates that the TRANSFILETRIGGER* tags are used
+var rpmlibFileTriggersDependency = rpmlibPseudoDependency{"FileTriggers", "4.13.0-1"}
+
 var flagsForConstraintRelation = map[string]int32{
 	"<":      rpmsenseLess,
 	"<=":     rpmsenseLess | rpmsenseEqual,
@@ -254,13 +364,20 @@ var flagsForConstraintRelation = map[string]int32{
 	"rpmlib": rpmsenseRpmlib | rpmsenseLess | rpmsenseEqual,
 }
 
-func serializeRelations(h *rpmHeader, rels []build.PackageRelation, namesTag, flagsTag, versionsTag uint32) {
+func serializeRelations(h *rpmHeader, pkg *build.Package, rels []build.PackageRelation, namesTag, flagsTag, versionsTag uint32) {
 	//for the Requires list, we need to add pseudo-dependencies to describe the
 	//structure of our package (because apparently a custom key-value database
 	//wasn't enough, so they built a second key-value database inside the
 	//requirements array -- BRILLIANT!)
 	if namesTag == rpmtagRequireName {
-		for _, dep := range rpmlibPseudoDependencies {
+		deps := rpmlibPseudoDependencies
+		if needsLongSizes(pkg) {
+			deps = append(deps, rpmlibLargeFilesDependency)
+		}
+		if hasFileTriggers(pkg) {
+			deps = append(deps, rpmlibFileTriggersDependency)
+		}
+		for _, dep := range deps {
 			rels = append(rels, build.PackageRelation{
 				RelatedPackage: "rpmlib(" + dep.Name + ")",
 				Constraints: []build.VersionConstraint{
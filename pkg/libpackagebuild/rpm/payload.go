@@ -22,18 +22,21 @@ package rpm
 import (
 	"bytes"
 	"encoding/binary"
-	"os"
-	"os/exec"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
 
-	build "github.com/holocm/libpackagebuild"
-	"github.com/holocm/libpackagebuild/filesystem"
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
 )
 
 //rpmPayload represents the compressed CPIO payload of the package.
 type rpmPayload struct {
 	Binary           []byte
-	CompressedSize   uint32
-	UncompressedSize uint32
+	CompressedSize   uint64
+	UncompressedSize uint64
 }
 
 type cpioHeader struct {
@@ -53,9 +56,30 @@ type cpioHeader struct {
 	Checksum         [8]byte
 }
 
-//MakePayload generates the Payload for the given package.
-func makePayload(pkg *build.Package) (*rpmPayload, error) {
-	var buf bytes.Buffer
+//MakePayload generates the Payload containing the given directory tree.
+func makePayload(root *filesystem.Directory) (*rpmPayload, error) {
+	//the CPIO archive is streamed into the compressor, so only the compressed
+	//payload needs to be held in memory
+	var compressed bytes.Buffer
+	var uncompressedSize uint64
+	err := filesystem.CompressWithProgram(&compressed, func(w io.Writer) error {
+		cw := &cpioWriter{Writer: w}
+		err := writeCPIOArchive(cw, root)
+		uncompressedSize = cw.Offset
+		return err
+	}, "xz", "--format=lzma", "--compress")
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpmPayload{
+		Binary:           compressed.Bytes(),
+		CompressedSize:   uint64(compressed.Len()),
+		UncompressedSize: uncompressedSize,
+	}, nil
+}
+
+func writeCPIOArchive(cw *cpioWriter, root *filesystem.Directory) error {
 	inodeNumber := uint32(0)
 
 	//some fixed values that we can reuse
@@ -65,7 +89,7 @@ func makePayload(pkg *build.Package) (*rpmPayload, error) {
 
 	//assemble the CPIO archive
 	//(NOTE: This traversal works in the same way as the one in addFileInformationTags.)
-	pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+	err := root.Walk("/", func(path string, node filesystem.Node) error {
 		//skip implicitly created directories (as rpmbuild-constructed CPIO
 		//archives apparently do)
 		if n, ok := node.(*filesystem.Directory); ok {
@@ -83,7 +107,7 @@ func makePayload(pkg *build.Package) (*rpmPayload, error) {
 			Mode:        cpioFormatInt(node.FileModeForArchive(true)),
 			//UID, GID depend on the node type; see below
 			NumberOfLinks:    cpioOne,
-			ModificationTime: cpioZero, //fixed for reproducability
+			ModificationTime: cpioFormatInt(uint32(node.ModTime().Unix())),
 			//FileSize depends on the node type; see below
 			DevMajor:  cpioZero,
 			DevMinor:  cpioZero,
@@ -93,33 +117,59 @@ func makePayload(pkg *build.Package) (*rpmPayload, error) {
 			Checksum:  cpioZero,
 		}
 
-		var data []byte
+		var (
+			size int64
+			data io.ReadCloser
+		)
 
 		switch n := node.(type) {
 		case *filesystem.Directory:
 			header.UID = cpioFormatInt(n.Metadata.UID())
 			header.GID = cpioFormatInt(n.Metadata.GID())
-			header.FileSize = cpioZero
 		case *filesystem.RegularFile:
 			header.UID = cpioFormatInt(n.Metadata.UID())
 			header.GID = cpioFormatInt(n.Metadata.GID())
-			data = []byte(n.Content)
+			size = n.ContentSize()
+		case *filesystem.Symlink:
+			header.UID = cpioFormatInt(n.Metadata.UID())
+			header.GID = cpioFormatInt(n.Metadata.GID())
+			size = int64(len(n.Target))
+		}
+
+		//the "newc" CPIO format has only 32 bits for the file size
+		if size > math.MaxUint32 {
+			return fmt.Errorf("cannot put %s into RPM payload: files larger than 4 GiB are not supported", path)
+		}
+		header.FileSize = cpioFormatInt(uint32(size))
+
+		switch n := node.(type) {
+		case *filesystem.RegularFile:
+			var err error
+			data, err = n.OpenContent()
+			if err != nil {
+				return err
+			}
 		case *filesystem.Symlink:
-			header.UID = cpioZero
-			header.GID = cpioZero
-			data = []byte(n.Target)
+			data = ioutil.NopCloser(strings.NewReader(n.Target))
 		}
-		header.FileSize = cpioFormatInt(uint32(len(data)))
-		binary.Write(&buf, binary.BigEndian, &header)
-		cpioWriteData(&buf, name)
-		cpioWriteData(&buf, data)
 
-		return nil
+		err := binary.Write(cw, binary.BigEndian, &header)
+		if err == nil {
+			err = cw.WritePadded(bytes.NewReader(name))
+		}
+		if err == nil && data != nil {
+			err = cw.WritePadded(data)
+			data.Close()
+		}
+		return err
 	})
+	if err != nil {
+		return err
+	}
 
 	//write trailer record to indicate the end of the CPIO archive
 	trailerName := []byte("TRAILER!!!\000")
-	binary.Write(&buf, binary.BigEndian, &cpioHeader{
+	err = binary.Write(cw, binary.BigEndian, &cpioHeader{
 		Magic:            cpioMagic,
 		InodeNumber:      cpioZero,
 		Mode:             cpioZero,
@@ -135,20 +185,34 @@ func makePayload(pkg *build.Package) (*rpmPayload, error) {
 		NameSize:         cpioFormatInt(uint32(len(trailerName))),
 		Checksum:         cpioZero,
 	})
-	cpioWriteData(&buf, trailerName)
-
-	//compress the archive with LZMA
-	uncompressed := buf.Bytes()
-	cmd := exec.Command("xz", "--format=lzma", "--compress")
-	cmd.Stdin = bytes.NewReader(uncompressed)
-	cmd.Stderr = os.Stderr
-	compressed, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+	return cw.WritePadded(bytes.NewReader(trailerName))
+}
 
-	return &rpmPayload{
-		Binary:           compressed,
-		CompressedSize:   uint32(len(compressed)),
-		UncompressedSize: uint32(len(uncompressed)),
-	}, err
+//cpioArchiveSize computes the size of the CPIO archive that writeCPIOArchive
+//produces for the given archive members.
+func cpioArchiveSize(archive build.PlanArchive) uint64 {
+	var size uint64
+	addPadded := func(length uint64) {
+		size += length
+		size += (4 - size%4) % 4
+	}
+	for _, member := range archive.Members {
+		size += uint64(binary.Size(cpioHeader{}))
+		addPadded(uint64(len("."+member.Path) + 1))
+		switch member.Type {
+		case "file":
+			addPadded(uint64(member.Size))
+		case "symlink":
+			addPadded(uint64(len(member.Target)))
+		}
+	}
+	//trailer record
+	size += uint64(binary.Size(cpioHeader{}))
+	addPadded(uint64(len("TRAILER!!!\000")))
+	return size
 }
 
 var hexDigits = []byte("0123456789ABCDEF")
@@ -162,12 +226,33 @@ func cpioFormatInt(value uint32) [8]byte {
 	return str
 }
 
-func cpioWriteData(buf *bytes.Buffer, data []byte) {
-	buf.Write(data)
+//cpioWriter is an io.Writer that keeps track of how many bytes were written.
+type cpioWriter struct {
+	Writer io.Writer
+	Offset uint64
+}
+
+//Write implements the io.Writer interface.
+func (cw *cpioWriter) Write(buf []byte) (int, error) {
+	n, err := cw.Writer.Write(buf)
+	cw.Offset += uint64(n)
+	return n, err
+}
+
+//WritePadded copies the given data into the archive.
+func (cw *cpioWriter) WritePadded(r io.Reader) error {
+	_, err := io.Copy(cw, r)
+	if err != nil {
+		return err
+	}
 	//file names, contents, link targets need to end with padding to 4-byte
-	//alignment (note that we cannot compute the padding size from len(data)
-	//since the stream is not necessarily 4-byte-aligned before data)
-	for buf.Len()%4 != 0 {
-		buf.Write([]byte{'\000'})
+	//alignment (note that we cannot compute the padding size from the data
+	//size since the stream is not necessarily 4-byte-aligned before data)
+	for cw.Offset%4 != 0 {
+		_, err := cw.Write([]byte{'\000'})
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
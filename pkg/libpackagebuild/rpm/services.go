@@ -0,0 +1,89 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package rpm
+
+import (
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//The snippets in this file follow the expansions of the %systemd_post,
+//%systemd_preun and %systemd_postun_with_restart macros. In all scriptlets, $1
+//is the number of instances of this package that remain installed after the
+//transaction.
+
+//servicesPost returns the %post snippet for the package's systemd units, or ""
+//if there are none. Units that shall not be enabled explicitly are subject to
+//the distribution's presets instead.
+func servicesPost(pkg *build.Package) string {
+	if len(pkg.Services) == 0 {
+		return ""
+	}
+
+	lines := []string{"if [ $1 -eq 1 ]; then"}
+	for _, svc := range pkg.Services {
+		if svc.Enable {
+			lines = append(lines, fmt.Sprintf("    systemctl enable --now '%s' >/dev/null 2>&1 || :", svc.Unit))
+		} else {
+			lines = append(lines, fmt.Sprintf("    systemctl --no-reload preset '%s' >/dev/null 2>&1 || :", svc.Unit))
+		}
+	}
+	lines = append(lines, "fi")
+	return strings.Join(lines, "\n")
+}
+
+//servicesPreun returns the %preun snippet for the package's systemd units, or
+//"" if there are none.
+func servicesPreun(pkg *build.Package) string {
+	if len(pkg.Services) == 0 {
+		return ""
+	}
+
+	lines := []string{"if [ $1 -eq 0 ]; then"}
+	for _, svc := range pkg.Services {
+		lines = append(lines, fmt.Sprintf("    systemctl --no-reload disable --now '%s' >/dev/null 2>&1 || :", svc.Unit))
+	}
+	lines = append(lines, "fi")
+	return strings.Join(lines, "\n")
+}
+
+//servicesPostun returns the %postun snippet for the package's systemd units,
+//or "" if there are none.
+func servicesPostun(pkg *build.Package) string {
+	if len(pkg.Services) == 0 {
+		return ""
+	}
+
+	lines := []string{"systemctl daemon-reload >/dev/null 2>&1 || :"}
+	var restartLines []string
+	for _, svc := range pkg.Services {
+		if svc.RestartOnUpgrade {
+			restartLines = append(restartLines, fmt.Sprintf("    systemctl try-restart '%s' >/dev/null 2>&1 || :", svc.Unit))
+		}
+	}
+	if len(restartLines) > 0 {
+		lines = append(lines, "if [ $1 -ge 1 ]; then")
+		lines = append(lines, restartLines...)
+		lines = append(lines, "fi")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -23,23 +23,32 @@ import (
 	"crypto/md5"
 	"crypto/sha1"
 	"encoding/hex"
+	"fmt"
+	"math"
 )
 
-//makeSignatureSection produces the signature section of an RPM header.
-func makeSignatureSection(headerSection []byte, payload *rpmPayload) []byte {
+//makeSignatureSection produces the signature section of an RPM header. If a
+//signer is given, it is used to add an OpenPGP signature of the header section.
+func makeSignatureSection(headerSection []byte, payload *rpmPayload, signer HeaderSigner) ([]byte, error) {
 	h := &rpmHeader{}
 
 	//NOTE that some fields validate both header+payload, some only the
 	//payload, and some only the header. This is all according to the
 	//specification, no matter how insane. [LSB, 25.2.3]
 
-	//size information
-	h.AddInt32Value(rpmsigtagSize, []int32{
-		int32(uint32(len(headerSection)) + payload.CompressedSize),
-	})
-	h.AddInt32Value(rpmsigtagPayloadSize, []int32{
-		int32(payload.UncompressedSize),
-	})
+	//size information (the INT32 tags are interpreted as unsigned, and the
+	//INT64 tags are used instead if necessary)
+	size := uint64(len(headerSection)) + payload.CompressedSize
+	if size > math.MaxUint32 {
+		h.AddInt64Value(rpmsigtagLongSize, []int64{int64(size)})
+	} else {
+		h.AddInt32Value(rpmsigtagSize, []int32{int32(uint32(size))})
+	}
+	if payload.UncompressedSize > math.MaxUint32 {
+		h.AddInt64Value(rpmsigtagLongArchSize, []int64{int64(payload.UncompressedSize)})
+	} else {
+		h.AddInt32Value(rpmsigtagPayloadSize, []int32{int32(uint32(payload.UncompressedSize))})
+	}
 
 	//SHA1 digest of header section
 	sha1digest := sha1.New()
@@ -54,5 +63,18 @@ func makeSignatureSection(headerSection []byte, payload *rpmPayload) []byte {
 	md5sum := md5digest.Sum(nil)
 	h.AddBinaryValue(rpmsigtagMD5, md5sum)
 
-	return h.ToBinary(rpmtagHeaderSignatures)
+	//OpenPGP signature of header section
+	if signer != nil {
+		signature, err := signer(headerSection)
+		if err != nil {
+			return nil, fmt.Errorf("cannot sign RPM header: %s", err.Error())
+		}
+		tag, err := signatureTagFor(signature)
+		if err != nil {
+			return nil, fmt.Errorf("cannot sign RPM header: %s", err.Error())
+		}
+		h.AddBinaryValue(tag, signature)
+	}
+
+	return h.ToBinary(rpmtagHeaderSignatures), nil
 }
@@ -0,0 +1,115 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package rpm
+
+import (
+	"errors"
+	"fmt"
+)
+
+//HeaderSigner produces a detached binary OpenPGP signature (as produced e.g.
+//by `gpg --detach-sign`) for the given header section of an RPM package.
+type HeaderSigner func(headerSection []byte) ([]byte, error)
+
+//OpenPGP packet tag for signature packets [RFC 4880, 4.3]
+const pgpPacketTagSignature = 2
+
+//signatureTagFor checks that the given data is a binary OpenPGP signature
+//packet, and returns the signature tag that it goes into (RSA signatures
+//into RPMSIGTAG_RSA, all others into RPMSIGTAG_DSA, like `rpmsign` does).
+func signatureTagFor(signature []byte) (uint32, error) {
+	if len(signature) == 0 {
+		return 0, errors.New("signature is empty")
+	}
+
+	//parse packet header [RFC 4880, 4.2]
+	var (
+		tag    byte
+		offset int
+	)
+	switch header := signature[0]; {
+	case header&0x80 == 0:
+		return 0, errors.New("signature is not a binary OpenPGP packet (ASCII armor is not supported)")
+	case header&0x40 == 0:
+		//old packet format: the lowest two bits select the length of the length
+		tag = (header >> 2) & 0x0F
+		switch header & 0x03 {
+		case 0:
+			offset = 2
+		case 1:
+			offset = 3
+		case 2:
+			offset = 5
+		default:
+			offset = 1
+		}
+	default:
+		//new packet format: the first length octet selects the length of the length
+		tag = header & 0x3F
+		if len(signature) < 2 {
+			return 0, errors.New("signature is truncated")
+		}
+		switch length := signature[1]; {
+		case length < 192:
+			offset = 2
+		case length < 224:
+			offset = 3
+		case length == 255:
+			offset = 6
+		default:
+			return 0, errors.New("signature packet uses partial body lengths")
+		}
+	}
+	if tag != pgpPacketTagSignature {
+		return 0, fmt.Errorf("expected an OpenPGP signature packet, but found packet type %d", tag)
+	}
+
+	//find public-key algorithm in packet body [RFC 4880, 5.2.2 and 5.2.3]
+	body := signature[minInt(offset, len(signature)):]
+	if len(body) == 0 {
+		return 0, errors.New("signature is truncated")
+	}
+	var algoOffset int
+	switch body[0] {
+	case 3:
+		algoOffset = 15
+	case 4, 5, 6:
+		algoOffset = 2
+	default:
+		return 0, fmt.Errorf("unsupported OpenPGP signature version %d", body[0])
+	}
+	if len(body) <= algoOffset {
+		return 0, errors.New("signature is truncated")
+	}
+
+	switch body[algoOffset] {
+	case 1, 2, 3: //RSA
+		return rpmsigtagRSA, nil
+	default: //DSA, ECDSA, EdDSA etc.
+		return rpmsigtagDSA, nil
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
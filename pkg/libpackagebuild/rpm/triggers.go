@@ -0,0 +1,122 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package rpm
+
+import (
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//rpmTriggerTags lists the tags that make up one kind of trigger. Since there
+//are no file triggers for single packages, Names contains the package names
+//for package triggers, and path prefixes for file triggers.
+type rpmTriggerTags struct {
+	Scripts, ScriptProgs, Names, Versions, Flags, Indexes, Priorities uint32
+}
+
+var (
+	packageTriggerTags = rpmTriggerTags{
+		Scripts:     rpmtagTriggerScripts,
+		ScriptProgs: rpmtagTriggerScriptProg,
+		Names:       rpmtagTriggerName,
+		Versions:    rpmtagTriggerVersion,
+		Flags:       rpmtagTriggerFlags,
+		Indexes:     rpmtagTriggerIndex,
+	}
+	//we use transaction file triggers, which run once per transaction (like
+	//dpkg triggers and alpm hooks) instead of once per package
+	fileTriggerTags = rpmTriggerTags{
+		Scripts:     rpmtagTransFileTriggerScripts,
+		ScriptProgs: rpmtagTransFileTriggerScriptProg,
+		Names:       rpmtagTransFileTriggerName,
+		Versions:    rpmtagTransFileTriggerVersion,
+		Flags:       rpmtagTransFileTriggerFlags,
+		Indexes:     rpmtagTransFileTriggerIndex,
+		Priorities:  rpmtagTransFileTriggerPriorities,
+	}
+)
+
+//the default priority of file triggers in rpmbuild
+const rpmDefaultTriggerPriority = 1000000
+
+//addTriggerTags serializes the package's triggers. Each trigger becomes two
+//trigger scripts in RPM: one that runs after the watched packages (or files)
+//were installed or upgraded, and one that runs after they were removed.
+func addTriggerTags(h *rpmHeader, pkg *build.Package) {
+	addTriggerTagsOfKind(h, pkg, packageTriggerTags, func(t build.PackageTrigger) []string { return t.Packages })
+	addTriggerTagsOfKind(h, pkg, fileTriggerTags, func(t build.PackageTrigger) []string { return t.Paths })
+}
+
+func addTriggerTagsOfKind(h *rpmHeader, pkg *build.Package, tags rpmTriggerTags, getNames func(build.PackageTrigger) []string) {
+	var (
+		scripts     []string
+		scriptProgs []string
+		priorities  []int32
+		names       []string
+		versions    []string
+		flags       []int32
+		indexes     []int32
+	)
+	for _, trigger := range pkg.Triggers {
+		triggerNames := getNames(trigger)
+		if len(triggerNames) == 0 {
+			continue
+		}
+		interpreter := trigger.Interpreter
+		if interpreter == "" {
+			interpreter = "/bin/sh"
+		}
+		for _, sense := range []int32{rpmsenseTriggerIn, rpmsenseTriggerPostUn} {
+			index := int32(len(scripts))
+			scripts = append(scripts, trigger.Content)
+			scriptProgs = append(scriptProgs, interpreter)
+			priorities = append(priorities, rpmDefaultTriggerPriority)
+			for _, name := range triggerNames {
+				names = append(names, name)
+				versions = append(versions, "")
+				flags = append(flags, sense)
+				indexes = append(indexes, index)
+			}
+		}
+	}
+	if len(scripts) == 0 {
+		return
+	}
+
+	h.AddStringArrayValue(tags.Scripts, scripts)
+	h.AddStringArrayValue(tags.ScriptProgs, scriptProgs)
+	h.AddStringArrayValue(tags.Names, names)
+	h.AddStringArrayValue(tags.Versions, versions)
+	h.AddInt32Value(tags.Flags, flags)
+	h.AddInt32Value(tags.Indexes, indexes)
+	if tags.Priorities != 0 {
+		h.AddInt32Value(tags.Priorities, priorities)
+	}
+}
+
+//hasFileTriggers returns whether addTriggerTags writes file triggers, which
+//require a pseudo-dependency on rpmlib(FileTriggers).
+func hasFileTriggers(pkg *build.Package) bool {
+	for _, trigger := range pkg.Triggers {
+		if len(trigger.Paths) > 0 {
+			return true
+		}
+	}
+	return false
+}
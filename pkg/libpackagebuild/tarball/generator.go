@@ -0,0 +1,161 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package tarball provides build.Generator implementations for hosts without a
+//package manager: a plain tarball of the package contents, and a
+//self-extracting installer script that embeds such a tarball.
+package tarball
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//Generator is the build.Generator for plain tarballs. The tarball contains
+//the package contents rooted at /, compressed with XZ. Since there is no
+//package manager involved, package relations are ignored, and packages with
+//setup or cleanup scripts cannot be built (use InstallerGenerator instead).
+type Generator struct {
+	Package *build.Package
+	//Jobs is the number of threads for compressing the tarball. The result is
+	//the same for all values greater than 1 (see filesystem.XZArguments).
+	Jobs int
+}
+
+//GeneratorFactory spawns Generator instances. It satisfies the build.GeneratorFactory type.
+func GeneratorFactory(pkg *build.Package) build.Generator {
+	return &Generator{Package: pkg}
+}
+
+var archMap = map[build.Architecture]string{
+	build.ArchitectureAny:     "any",
+	build.ArchitectureI386:    "i686",
+	build.ArchitectureX86_64:  "x86_64",
+	build.ArchitectureARMv5:   "armv5",
+	build.ArchitectureARMv6h:  "armv6h",
+	build.ArchitectureARMv7h:  "armv7h",
+	build.ArchitectureAArch64: "aarch64",
+}
+
+//SupportedArchitectures implements the build.Generator interface.
+func (g *Generator) SupportedArchitectures() map[build.Architecture]string {
+	return archMap
+}
+
+//Capabilities implements the build.CapabilityReporter interface.
+func (g *Generator) Capabilities() build.Capabilities {
+	return build.Capabilities{
+		Compressions: []string{"xz"},
+	}
+}
+
+//RecommendedFileName implements the build.Generator interface.
+func (g *Generator) RecommendedFileName() string {
+	c := g.RecommendedFileNameComponents()
+	return fmt.Sprintf("%s-%s-%s%s", c.Name, c.FullVersion, c.ArchString, c.Extension)
+}
+
+//RecommendedFileNameComponents implements the build.Generator interface.
+func (g *Generator) RecommendedFileNameComponents() build.FileNameComponents {
+	//this is called after Build(), so we can assume that package name,
+	//version, etc. were already validated
+	pkg := g.Package
+	return build.FileNameComponents{
+		Name:        pkg.Name,
+		FullVersion: fullVersionString(pkg),
+		ArchString:  archMap[pkg.Architecture],
+		Extension:   ".tar.xz",
+	}
+}
+
+func fullVersionString(pkg *build.Package) string {
+	var b strings.Builder
+
+	if pkg.Epoch > 0 {
+		fmt.Fprintf(&b, "%d:", pkg.Epoch)
+	}
+
+	b.WriteString(pkg.Version)
+
+	if pkg.PrereleaseType != build.PrereleaseTypeNone {
+		fmt.Fprintf(&b, "~%s.%d", pkg.PrereleaseType.String(), pkg.PrereleaseVersion)
+	}
+
+	fmt.Fprintf(&b, "-%d", pkg.Release)
+	return b.String()
+}
+
+//Validate implements the build.Generator interface.
+func (g *Generator) Validate() []error {
+	errs := validate(g.Package)
+
+	//there is nothing that could execute scripts
+	if len(g.Package.Actions) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "action", Format: "tarball", Message: "tarballs cannot contain setup or cleanup scripts"})
+	}
+	if len(g.Package.Triggers) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "trigger", Format: "tarball", Message: "tarballs cannot contain triggers"})
+	}
+	if len(g.Package.Services) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "service", Format: "tarball", Message: "tarballs cannot manage systemd units"})
+	}
+	return errs
+}
+
+func validate(pkg *build.Package) []error {
+	return pkg.ValidateWith(build.RegexSet{
+		PackageName:    `[a-zA-Z0-9][a-zA-Z0-9._+-]*`,
+		PackageVersion: `[a-zA-Z0-9._+~]+`,
+		//relations are ignored, so accept anything that the parser accepts
+		RelatedName:    `.+`,
+		RelatedVersion: `.+`,
+		FormatName:     "tarball",
+	}, archMap)
+}
+
+//Build implements the build.Generator interface.
+func (g *Generator) Build() ([]byte, error) {
+	pkg := g.Package
+	//there is no alternatives system, so install the preferred alternatives
+	//as plain symlinks
+	err := pkg.InsertAlternativeSymlinks()
+	if err != nil {
+		return nil, err
+	}
+	err = pkg.PrepareBuild()
+	if err != nil {
+		return nil, err
+	}
+
+	//PrepareBuild() may have added a setup script for file ownership that
+	//cannot be represented in the archive
+	if len(pkg.Actions) > 0 {
+		return nil, errors.New("tarballs cannot contain setup or cleanup scripts (note that owners and groups must be given as numeric IDs)")
+	}
+
+	var buf bytes.Buffer
+	endPhase := pkg.BeginPhase(build.PhaseCompress)
+	err = pkg.FSRoot.ToParallelTarXZArchive(&buf, false, true, g.Jobs)
+	endPhase()
+	return buf.Bytes(), err
+}
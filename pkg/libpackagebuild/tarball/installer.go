@@ -0,0 +1,186 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package tarball
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//InstallerGenerator is the build.Generator for self-extracting installers (in
+//the style of makeself). The result is a shell script that runs the pre-setup
+//script, extracts the embedded tarball (the same one that Generator produces)
+//into the root directory, and runs the setup script.
+//
+//Since the installed files are not tracked by anything, there is no way to
+//uninstall them, and cleanup scripts are ignored.
+type InstallerGenerator struct {
+	Package *build.Package
+	//Jobs is like in Generator.
+	Jobs int
+}
+
+//InstallerGeneratorFactory spawns InstallerGenerator instances. It satisfies
+//the build.GeneratorFactory type.
+func InstallerGeneratorFactory(pkg *build.Package) build.Generator {
+	return &InstallerGenerator{Package: pkg}
+}
+
+//SupportedArchitectures implements the build.Generator interface.
+func (g *InstallerGenerator) SupportedArchitectures() map[build.Architecture]string {
+	return archMap
+}
+
+//Capabilities implements the build.CapabilityReporter interface.
+func (g *InstallerGenerator) Capabilities() build.Capabilities {
+	//cleanup scripts are accepted, but ignored since the installer cannot
+	//uninstall anything
+	return build.Capabilities{
+		Compressions: []string{"xz"},
+		Actions:      true,
+	}
+}
+
+//RecommendedFileName implements the build.Generator interface.
+func (g *InstallerGenerator) RecommendedFileName() string {
+	c := g.RecommendedFileNameComponents()
+	return fmt.Sprintf("%s-%s-%s%s", c.Name, c.FullVersion, c.ArchString, c.Extension)
+}
+
+//RecommendedFileNameComponents implements the build.Generator interface.
+func (g *InstallerGenerator) RecommendedFileNameComponents() build.FileNameComponents {
+	//this is called after Build(), so we can assume that package name,
+	//version, etc. were already validated
+	pkg := g.Package
+	return build.FileNameComponents{
+		Name:        pkg.Name,
+		FullVersion: fullVersionString(pkg),
+		ArchString:  archMap[pkg.Architecture],
+		Extension:   ".run",
+	}
+}
+
+//Validate implements the build.Generator interface.
+func (g *InstallerGenerator) Validate() []error {
+	errs := validate(g.Package)
+
+	//the installer runs only once, so it cannot react to later changes
+	if len(g.Package.Triggers) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "trigger", Format: "makeself", Message: "self-extracting installers cannot contain triggers"})
+	}
+	if len(g.Package.Services) > 0 {
+		errs = append(errs, &build.ValidationError{Field: "service", Format: "makeself", Message: "self-extracting installers cannot manage systemd units"})
+	}
+	return errs
+}
+
+//Build implements the build.Generator interface.
+func (g *InstallerGenerator) Build() ([]byte, error) {
+	pkg := g.Package
+	//there is no alternatives system, so install the preferred alternatives
+	//as plain symlinks
+	err := pkg.InsertAlternativeSymlinks()
+	if err != nil {
+		return nil, err
+	}
+	//there are no transaction scripts, so run these actions together with
+	//the other setup actions
+	pkg.FoldTransactionActions()
+	err = pkg.PrepareBuild()
+	if err != nil {
+		return nil, err
+	}
+
+	var archive bytes.Buffer
+	endPhase := pkg.BeginPhase(build.PhaseCompress)
+	err = pkg.FSRoot.ToParallelTarXZArchive(&archive, false, true, g.Jobs)
+	endPhase()
+	if err != nil {
+		return nil, err
+	}
+
+	//the script needs to know where the archive starts, so render it once to
+	//count its lines, then render it again with the correct line number
+	data := installerData{
+		Name:        pkg.Name,
+		Version:     fullVersionString(pkg),
+		PreSetup:    pkg.Script(build.PreSetupAction),
+		Setup:       pkg.Script(build.SetupAction),
+		ArchiveSize: archive.Len(),
+	}
+	var script bytes.Buffer
+	for pass := 0; pass < 2; pass++ {
+		script.Reset()
+		err := installerTemplate.Execute(&script, data)
+		if err != nil {
+			return nil, err
+		}
+		data.ArchiveLine = bytes.Count(script.Bytes(), []byte("\n")) + 1
+	}
+
+	script.Write(archive.Bytes())
+	return script.Bytes(), nil
+}
+
+type installerData struct {
+	Name        string
+	Version     string
+	PreSetup    string
+	Setup       string
+	ArchiveLine int
+	ArchiveSize int
+}
+
+//The scripts run in subshells, so that an `exit` in them does not skip the
+//remaining steps. The installer must end with `exit` to prevent the shell from
+//reading the archive as commands.
+var installerTemplate = template.Must(template.New("installer").Funcs(template.FuncMap{
+	"quote": shellQuote,
+}).Parse(strings.TrimPrefix(`
+#!/bin/sh
+# Self-extracting installer for {{.Name}} {{.Version}}, generated by holo-build.
+set -e
+if [ "$(id -u)" != 0 ]; then
+    echo "This installer must be run as root." >&2
+    exit 1
+fi
+echo {{quote (printf "Installing %s %s..." .Name .Version)}}
+{{- if .PreSetup}}
+(
+{{.PreSetup}}
+)
+{{- end}}
+tail -n +{{.ArchiveLine}} "$0" | head -c {{.ArchiveSize}} | xz --decompress --stdout | tar -x -p -f - -C /
+{{- if .Setup}}
+(
+{{.Setup}}
+)
+{{- end}}
+exit 0
+`, "\n")))
+
+//shellQuote quotes a string for use as a single shell word.
+func shellQuote(str string) string {
+	return "'" + strings.Replace(str, "'", `'\''`, -1) + "'"
+}
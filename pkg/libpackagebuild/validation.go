@@ -0,0 +1,200 @@
+/*******************************************************************************
+*
+* Copyright 2015-2018 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package build
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//Severity is used for ValidationError.Severity.
+type Severity int
+
+const (
+	//SeverityError marks problems that prevent the package from being built.
+	//This is the default for ValidationError.Severity.
+	SeverityError Severity = iota
+	//SeverityWarning marks problems that do not prevent the package from
+	//being built.
+	SeverityWarning
+)
+
+//String implements the fmt.Stringer interface.
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+//MarshalText implements the encoding.TextMarshaler interface, so that
+//severities appear as strings in JSON.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+//ValidationError is the type of the errors returned by Generator.Validate().
+//Besides the human-readable message, it identifies the part of the package
+//definition that the problem refers to, so that callers can group, filter or
+//deduplicate problems (e.g. when validating with multiple generators).
+type ValidationError struct {
+	//Field identifies the offending field of the package definition, e.g.
+	//"package.name" or "package.requires". Empty if the problem concerns a
+	//file system entry (see Path) or the package as a whole.
+	Field string `json:"field,omitempty"`
+	//Path is the path of the offending file system entry, if any.
+	Path string `json:"path,omitempty"`
+	//Severity defaults to SeverityError.
+	Severity Severity `json:"severity"`
+	//Message is the human-readable description of the problem.
+	Message string `json:"message"`
+	//Format is the name of the package format that imposes the restriction
+	//that was violated, e.g. "Debian".
+	Format string `json:"format,omitempty"`
+}
+
+//Error implements the builtin/error interface.
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+//RegexSet is a collection of regular expressions for validating a package.
+//A RegexSet is typically constructed by a common.Generator for calling
+//common.Package.ValidateWith() inside its Validate() method.
+type RegexSet struct {
+	PackageName    string
+	PackageVersion string
+	RelatedName    string
+	RelatedVersion string
+	FormatName     string //used for error messages only
+}
+
+type compiledRegexSet struct {
+	PackageName    *regexp.Regexp
+	PackageVersion *regexp.Regexp
+	RelatedName    *regexp.Regexp
+	RelatedVersion *regexp.Regexp
+	FormatName     string
+}
+
+//ValidateWith is a helper function provided for generators.
+//
+//It validates the package name, version and related packages with
+//the given set of regexes, and returns a non-empty list of errors if
+//validation fails.
+func (pkg *Package) ValidateWith(r RegexSet, archMap map[Architecture]string) []error {
+	ec := errorCollector{}
+
+	cr := &compiledRegexSet{
+		PackageName:    regexp.MustCompile("^" + r.PackageName + "$"),
+		PackageVersion: regexp.MustCompile("^" + r.PackageVersion + "$"),
+		RelatedName:    regexp.MustCompile("^" + r.RelatedName + "$"),
+		RelatedVersion: regexp.MustCompile("^" + r.RelatedVersion + "$"),
+		FormatName:     r.FormatName,
+	}
+
+	//if name or version is empty, it was already rejected by the parser and we
+	//don't need to complain about it again
+	if pkg.Name != "" && !cr.PackageName.MatchString(pkg.Name) {
+		ec.addValidationError("package.name", "", cr.FormatName, "Package name \"%s\" is not acceptable for %s packages", pkg.Name, cr.FormatName)
+	}
+	if pkg.Version != "" && !cr.PackageVersion.MatchString(pkg.Version) {
+		//this check is only some Defense in Depth; a stricter version format
+		//is already enforced by the generator-independent validation
+		ec.addValidationError("package.version", "", cr.FormatName, "Package version \"%s\" is not acceptable for %s packages", pkg.Version, cr.FormatName)
+	}
+
+	if pkg.Release == 0 {
+		ec.addValidationError("package.release", "", cr.FormatName, "Package release may not be zero (numbering of releases starts at 1)")
+	}
+
+	//check if architecture is supported by this generator
+	if _, ok := archMap[pkg.Architecture]; !ok {
+		ec.addValidationError("package.architecture", "", cr.FormatName, "Architecture \"%s\" is not acceptable for %s packages", pkg.ArchitectureInput, cr.FormatName)
+	}
+
+	validatePackageRelations(cr, "requires", pkg.Requires, &ec)
+	validatePackageRelations(cr, "provides", pkg.Provides, &ec)
+	validatePackageRelations(cr, "conflicts", pkg.Conflicts, &ec)
+	validatePackageRelations(cr, "replaces", pkg.Replaces, &ec)
+	validatePackageRelations(cr, "supersedes", pkg.Supersedes, &ec)
+
+	return ec.Errors
+}
+
+func validatePackageRelations(r *compiledRegexSet, relType string, rels []PackageRelation, ec *errorCollector) {
+	for _, rel := range rels {
+		if !r.RelatedName.MatchString(rel.RelatedPackage) {
+			ec.addValidationError("package."+relType, "", r.FormatName, "Package name \"%s\" is not acceptable for %s packages (found in %s)", rel.RelatedPackage, r.FormatName, relType)
+		}
+		for _, constraint := range rel.Constraints {
+			if !r.RelatedVersion.MatchString(constraint.Version) {
+				ec.addValidationError("package."+relType, "", r.FormatName, "Version in \"%s %s %s\" is not acceptable for %s packages (found in %s)",
+					rel.RelatedPackage, constraint.Relation, constraint.Version, r.FormatName, relType,
+				)
+			}
+		}
+	}
+}
+
+//ValidateReservedPaths is a helper function provided for generators.
+//
+//It returns an error for each entry in the package's file system whose path
+//is reserved by the package format (e.g. for metadata files), as decided by
+//the given callback. The paths given to the callback include the PathPrefix,
+//so they are the same as in the final package.
+func (pkg *Package) ValidateReservedPaths(formatName string, isReserved func(absolutePath string) bool) []error {
+	ec := errorCollector{}
+	prefix := "/"
+	if !pkg.isRelocated {
+		prefix = pkg.cleanPathPrefix()
+	}
+
+	//the directories containing the PathPrefix end up in the package as well
+	for dir := prefix; dir != "/"; dir = path.Dir(dir) {
+		if isReserved(dir) {
+			ec.addValidationError("", dir, formatName, "Path \"%s\" is reserved for %s package metadata (found in path prefix)", dir, formatName)
+		}
+	}
+
+	pkg.WalkFSWithAbsolutePaths(func(absolutePath string, node filesystem.Node) error {
+		if absolutePath == "/" {
+			return nil
+		}
+		fullPath := path.Join(prefix, absolutePath)
+		if isReserved(fullPath) {
+			if fullPath == absolutePath {
+				ec.addValidationError("", absolutePath, formatName, "Path \"%s\" is reserved for %s package metadata", absolutePath, formatName)
+			} else {
+				ec.addValidationError("", absolutePath, formatName, "Path \"%s\" is reserved for %s package metadata (relocated to \"%s\")", absolutePath, formatName, fullPath)
+			}
+		}
+		return nil
+	})
+
+	return ec.Errors
+}
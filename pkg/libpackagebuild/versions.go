@@ -0,0 +1,374 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package build
+
+import (
+	"fmt"
+	"strings"
+)
+
+//CompareVersions compares two version strings according to the rules of the
+//given package format ("debian", "pacman" or "rpm"). The versions may include
+//an epoch and a release (e.g. "1:2.0-3"). The result is negative if a is older
+//than b, zero if both are equal, and positive if a is newer than b.
+//
+//The implementations follow dpkg's verrevcmp(), RPM's rpmvercmp() and
+//pacman's alpm_pkg_vercmp(), respectively.
+func CompareVersions(format, a, b string) (int, error) {
+	switch format {
+	case "debian":
+		return compareDebianVersions(a, b), nil
+	case "pacman":
+		return comparePacmanVersions(a, b), nil
+	case "rpm":
+		return compareRPMVersions(a, b), nil
+	default:
+		return 0, fmt.Errorf("cannot compare versions for unknown package format \"%s\"", format)
+	}
+}
+
+//versionParts is a version string split into epoch, version and release.
+type versionParts struct {
+	Epoch      string
+	Version    string
+	Release    string
+	HasRelease bool
+}
+
+//splitVersion splits a version string of the form "epoch:version-release",
+//where both epoch and release are optional. If epochMustBeNumeric is set, a
+//colon only separates the epoch if it is preceded by digits only (as in RPM
+//and pacman).
+func splitVersion(str string, epochMustBeNumeric bool) (result versionParts) {
+	result.Epoch = "0"
+	if idx := strings.Index(str, ":"); idx >= 0 {
+		if !epochMustBeNumeric || strings.Trim(str[:idx], "0123456789") == "" {
+			if idx > 0 {
+				result.Epoch = str[:idx]
+			}
+			str = str[idx+1:]
+		}
+	}
+	if idx := strings.LastIndex(str, "-"); idx >= 0 {
+		result.Release = str[idx+1:]
+		result.HasRelease = true
+		str = str[:idx]
+	}
+	result.Version = str
+	return
+}
+
+func sign(val int) int {
+	switch {
+	case val < 0:
+		return -1
+	case val > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+//compareNumericSegments compares two strings of digits by their numeric
+//value, without overflowing on long strings.
+func compareNumericSegments(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return sign(len(a) - len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Debian
+
+func compareDebianVersions(a, b string) int {
+	pa := splitVersion(a, false)
+	pb := splitVersion(b, false)
+	if cmp := compareNumericSegments(pa.Epoch, pb.Epoch); cmp != 0 {
+		return cmp
+	}
+	if cmp := debianVerrevcmp(pa.Version, pb.Version); cmp != 0 {
+		return cmp
+	}
+	return debianVerrevcmp(pa.Release, pb.Release)
+}
+
+//debianOrder is order() from dpkg's lib/dpkg/version.c. The end of the string
+//is represented by c = 0.
+func debianOrder(c byte) int {
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	case c != 0:
+		return int(c) + 256
+	default:
+		return 0
+	}
+}
+
+//debianVerrevcmp is verrevcmp() from dpkg's lib/dpkg/version.c.
+func debianVerrevcmp(a, b string) int {
+	at := func(s string, idx int) byte {
+		if idx < len(s) {
+			return s[idx]
+		}
+		return 0
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		//compare non-digit prefixes
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac := debianOrder(at(a, i))
+			bc := debianOrder(at(b, j))
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+
+		//compare numeric segments
+		starti := i
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		startj := j
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		if cmp := compareNumericSegments(a[starti:i], b[startj:j]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RPM
+
+func compareRPMVersions(a, b string) int {
+	pa := splitVersion(a, true)
+	pb := splitVersion(b, true)
+	if cmp := compareNumericSegments(pa.Epoch, pb.Epoch); cmp != 0 {
+		return cmp
+	}
+	if cmp := rpmvercmp(pa.Version, pb.Version); cmp != 0 {
+		return cmp
+	}
+	//a missing release matches any release (as in dependency constraints)
+	if !pa.HasRelease || !pb.HasRelease {
+		return 0
+	}
+	return rpmvercmp(pa.Release, pb.Release)
+}
+
+//rpmvercmp is rpmvercmp() from RPM's rpmio/rpmvercmp.c (including the
+//handling of "~" and "^" from RPM 4.15).
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	isSeparator := func(c byte) bool {
+		return !isDigit(c) && !isAlpha(c) && c != '~' && c != '^'
+	}
+
+	for len(a) > 0 || len(b) > 0 {
+		for len(a) > 0 && isSeparator(a[0]) {
+			a = a[1:]
+		}
+		for len(b) > 0 && isSeparator(b[0]) {
+			b = b[1:]
+		}
+
+		//a tilde sorts before everything else, even the end of the string
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		//a caret sorts after the end of the string, but before everything else
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if a == "" || b == "" {
+			break
+		}
+
+		cmp, aRest, bRest, done := compareRPMSegments(a, b)
+		if done {
+			return cmp
+		}
+		a, b = aRest, bRest
+	}
+
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+//compareRPMSegments compares the leading numeric or alphabetic segments of a
+//and b (both non-empty and starting with a digit or letter). If done is true,
+//the comparison is decided with the result cmp. Otherwise the comparison
+//continues with aRest and bRest.
+func compareRPMSegments(a, b string) (cmp int, aRest, bRest string, done bool) {
+	isNumeric := isDigit(a[0])
+	matches := isAlpha
+	if isNumeric {
+		matches = isDigit
+	}
+
+	i := 0
+	for i < len(a) && matches(a[i]) {
+		i++
+	}
+	j := 0
+	for j < len(b) && matches(b[j]) {
+		j++
+	}
+
+	//numeric segments are always newer than alphabetic segments
+	if j == 0 {
+		if isNumeric {
+			return 1, "", "", true
+		}
+		return -1, "", "", true
+	}
+
+	if isNumeric {
+		cmp = compareNumericSegments(a[:i], b[:j])
+	} else {
+		cmp = strings.Compare(a[:i], b[:j])
+	}
+	if cmp != 0 {
+		return cmp, "", "", true
+	}
+	return 0, a[i:], b[j:], false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// pacman
+
+func comparePacmanVersions(a, b string) int {
+	if a == b {
+		return 0
+	}
+	pa := splitVersion(a, true)
+	pb := splitVersion(b, true)
+	if cmp := alpmRpmvercmp(pa.Epoch, pb.Epoch); cmp != 0 {
+		return cmp
+	}
+	if cmp := alpmRpmvercmp(pa.Version, pb.Version); cmp != 0 {
+		return cmp
+	}
+	if !pa.HasRelease || !pb.HasRelease {
+		return 0
+	}
+	return alpmRpmvercmp(pa.Release, pb.Release)
+}
+
+//alpmRpmvercmp is rpmvercmp() from pacman's lib/libalpm/version.c, which
+//predates the "~" and "^" handling in RPM, but considers the length of the
+//separators between segments.
+func alpmRpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	isSeparator := func(c byte) bool {
+		return !isDigit(c) && !isAlpha(c)
+	}
+
+	for len(a) > 0 && len(b) > 0 {
+		i := 0
+		for i < len(a) && isSeparator(a[i]) {
+			i++
+		}
+		j := 0
+		for j < len(b) && isSeparator(b[j]) {
+			j++
+		}
+		a, b = a[i:], b[j:]
+
+		if a == "" || b == "" {
+			break
+		}
+		//if the separator lengths were different, we are also finished
+		if i != j {
+			return sign(i - j)
+		}
+
+		cmp, aRest, bRest, done := compareRPMSegments(a, b)
+		if done {
+			return cmp
+		}
+		a, b = aRest, bRest
+	}
+
+	//all segments compared identically, but the separators may have differed
+	if a == "" && b == "" {
+		return 0
+	}
+	//a remaining alphabetic segment should never beat an empty string
+	if (a == "" && !(len(b) > 0 && isAlpha(b[0]))) || (len(a) > 0 && isAlpha(a[0])) {
+		return -1
+	}
+	return 1
+}
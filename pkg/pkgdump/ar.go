@@ -0,0 +1,180 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package pkgdump
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+//arHeader contains the metadata of a single member of an ar archive.
+type arHeader struct {
+	Name string
+	UID  int
+	GID  int
+	Mode int64
+	Size int64
+}
+
+//arReader reads ar archives in the common format (as used by Debian
+//packages), including GNU-style long names. It works like tar.Reader: Next()
+//advances to the next member, and Read() reads the current member's contents.
+type arReader struct {
+	r         io.Reader
+	remaining int64 //unread bytes of current member
+	padding   int64 //padding bytes after current member
+	nameTable []byte
+}
+
+const arHeaderSize = 60
+
+var errNotAnArArchive = errors.New("missing ar archive magic")
+
+func newArReader(r io.Reader) (*arReader, error) {
+	magic := make([]byte, 8)
+	_, err := io.ReadFull(r, magic)
+	if err != nil {
+		return nil, err
+	}
+	if string(magic) != "!<arch>\n" {
+		return nil, errNotAnArArchive
+	}
+	return &arReader{r: r}, nil
+}
+
+//Next advances to the next member. The special members "/" (symbol table) and
+//"//" (GNU long name table) are consumed internally and never returned.
+func (ar *arReader) Next() (*arHeader, error) {
+	for {
+		//skip the rest of the current member
+		_, err := io.CopyN(ioutil.Discard, ar.r, ar.remaining+ar.padding)
+		if err != nil {
+			return nil, err
+		}
+		ar.remaining, ar.padding = 0, 0
+
+		header, err := ar.readHeader()
+		if err != nil {
+			return nil, err
+		}
+
+		switch header.Name {
+		case "/", "/SYM64/":
+			continue //symbol table
+		case "//":
+			ar.nameTable, err = ioutil.ReadAll(ar)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		header.Name, err = ar.resolveName(header.Name)
+		return header, err
+	}
+}
+
+func (ar *arReader) readHeader() (*arHeader, error) {
+	buf := make([]byte, arHeaderSize)
+	_, err := io.ReadFull(ar.r, buf)
+	if err != nil {
+		return nil, err //including io.EOF at the end of the archive
+	}
+	if string(buf[58:60]) != "\x60\n" {
+		return nil, fmt.Errorf("ar archive member header has invalid terminator %q", buf[58:60])
+	}
+
+	field := func(start, end int) string {
+		return strings.TrimRight(string(buf[start:end]), " ")
+	}
+	number := func(start, end, base int) (int64, error) {
+		str := field(start, end)
+		if str == "" {
+			return 0, nil //GNU ar leaves fields blank for special members
+		}
+		return strconv.ParseInt(str, base, 64)
+	}
+
+	header := &arHeader{Name: field(0, 16)}
+	//field(16, 28) is the modification time, which we don't show
+	uid, err := number(28, 34, 10)
+	if err != nil {
+		return nil, fmt.Errorf("ar archive member %q has invalid owner: %s", header.Name, err.Error())
+	}
+	gid, err := number(34, 40, 10)
+	if err != nil {
+		return nil, fmt.Errorf("ar archive member %q has invalid group: %s", header.Name, err.Error())
+	}
+	header.UID, header.GID = int(uid), int(gid)
+	header.Mode, err = number(40, 48, 8)
+	if err != nil {
+		return nil, fmt.Errorf("ar archive member %q has invalid mode: %s", header.Name, err.Error())
+	}
+	//only the permission bits are interesting
+	header.Mode &= 0777
+	header.Size, err = number(48, 58, 10)
+	if err != nil || header.Size < 0 {
+		return nil, fmt.Errorf("ar archive member %q has invalid size %q", header.Name, field(48, 58))
+	}
+
+	ar.remaining = header.Size
+	ar.padding = header.Size % 2
+	return header, nil
+}
+
+//resolveName resolves GNU-style member names: "/123" refers to the name at
+//offset 123 in the name table, and short names may have a trailing slash.
+func (ar *arReader) resolveName(name string) (string, error) {
+	if !strings.HasPrefix(name, "/") {
+		return strings.TrimSuffix(name, "/"), nil
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(name, "/"))
+	if err != nil || offset < 0 || offset >= len(ar.nameTable) {
+		return "", fmt.Errorf("ar archive member has invalid name reference %q", name)
+	}
+	longName := ar.nameTable[offset:]
+	end := bytes.Index(longName, []byte("/\n"))
+	if end < 0 {
+		return "", fmt.Errorf("ar archive member has invalid name reference %q", name)
+	}
+	return string(longName[:end]), nil
+}
+
+//Read implements the io.Reader interface.
+func (ar *arReader) Read(buf []byte) (int, error) {
+	if ar.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(buf)) > ar.remaining {
+		buf = buf[:ar.remaining]
+	}
+	n, err := ar.r.Read(buf)
+	ar.remaining -= int64(n)
+	if err == io.EOF && ar.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
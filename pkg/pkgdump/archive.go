@@ -0,0 +1,345 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package pkgdump
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	cpio "github.com/surma/gocpio"
+)
+
+//EntryType describes the file type of an Entry.
+type EntryType string
+
+const (
+	//EntryDirectory is a directory.
+	EntryDirectory EntryType = "directory"
+	//EntryRegularFile is a regular file. Its contents are in Entry.Content.
+	EntryRegularFile EntryType = "regular file"
+	//EntrySymlink is a symlink. Its target is in Entry.Target.
+	EntrySymlink EntryType = "symlink"
+	//EntrySocket is a socket (only in cpio archives).
+	EntrySocket EntryType = "socket"
+	//EntryBlockDevice is a block device (only in cpio archives).
+	EntryBlockDevice EntryType = "block special devices"
+	//EntryCharDevice is a character device (only in cpio archives).
+	EntryCharDevice EntryType = "character special device"
+	//EntryFIFO is a named pipe (only in cpio archives).
+	EntryFIFO EntryType = "named pipe (FIFO)"
+)
+
+//Entry is an entry in an archive. For FormatMtree, only Name and Attributes
+//are filled.
+type Entry struct {
+	//Name is the path of the entry, as given in the archive.
+	Name string
+	//Type is the file type of the entry.
+	Type EntryType
+	//Mode contains the permission bits of the entry.
+	Mode os.FileMode
+	//UID and GID are the numeric owner and group of the entry.
+	UID int
+	GID int
+	//Target is the target of a symlink.
+	Target string
+	//Position is the index of the entry in the archive.
+	Position int
+	//Content is the recognized content of a regular file.
+	Content *Tree
+	//Attributes contains the keywords of an mtree entry (e.g. "mode" or
+	//"sha256digest"), including those set with "/set".
+	Attributes map[string]string
+}
+
+//readTar reads the entries of tar archives.
+func readTar(data []byte) ([]Entry, error) {
+	//use "archive/tar" package to read the tar archive
+	tr := tar.NewReader(bytes.NewReader(data))
+	return readArchiveGeneric(tr, func() (*Entry, error) {
+		header, err := tr.Next()
+		if err != nil {
+			return nil, err
+		}
+		info := header.FileInfo()
+		entry := &Entry{
+			Name: header.Name,
+			Mode: info.Mode() & os.ModePerm,
+			UID:  header.Uid,
+			GID:  header.Gid,
+		}
+
+		//recognize entry type
+		switch info.Mode() & os.ModeType {
+		case os.ModeDir:
+			entry.Type = EntryDirectory
+		case os.ModeSymlink:
+			entry.Type = EntrySymlink
+			entry.Target = header.Linkname
+		case 0:
+			entry.Type = EntryRegularFile
+		default:
+			return nil, fmt.Errorf("tar entry %s has unrecognized file mode (%o)", header.Name, info.Mode())
+		}
+		return entry, nil
+	})
+}
+
+//readAr reads the entries of ar archives.
+func readAr(data []byte) ([]Entry, error) {
+	ar, err := newArReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return readArchiveGeneric(ar, func() (*Entry, error) {
+		header, err := ar.Next()
+		if err != nil {
+			return nil, err
+		}
+		//ar archives do not store file types (except for the special
+		//members that our reader handles internally), so everything is
+		//a regular file
+		return &Entry{
+			Name: header.Name,
+			Type: EntryRegularFile,
+			Mode: os.FileMode(header.Mode),
+			UID:  header.UID,
+			GID:  header.GID,
+		}, nil
+	})
+}
+
+//readCpio reads the entries of cpio archives.
+func readCpio(data []byte) ([]Entry, error) {
+	err := checkCpioHeaders(data)
+	if err != nil {
+		return nil, err
+	}
+
+	//use "github.com/surma/gocpio" package to read the ar archive
+	cr := cpio.NewReader(bytes.NewReader(data))
+
+	return readArchiveGeneric(cr, func() (*Entry, error) {
+		header, err := cr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if header.IsTrailer() {
+			return nil, io.EOF
+		}
+		entry := &Entry{
+			Name: header.Name,
+			Mode: os.FileMode(header.Mode),
+			UID:  header.Uid,
+			GID:  header.Gid,
+		}
+
+		//recognize entry type
+		switch header.Type {
+		case cpio.TYPE_SOCK:
+			entry.Type = EntrySocket
+		case cpio.TYPE_SYMLINK:
+			entry.Type = EntrySymlink
+		case cpio.TYPE_REG:
+			entry.Type = EntryRegularFile
+		case cpio.TYPE_BLK:
+			entry.Type = EntryBlockDevice
+		case cpio.TYPE_DIR:
+			entry.Type = EntryDirectory
+		case cpio.TYPE_CHAR:
+			entry.Type = EntryCharDevice
+		case cpio.TYPE_FIFO:
+			entry.Type = EntryFIFO
+		}
+		return entry, nil
+	})
+}
+
+//checkCpioHeaders walks through the headers of a cpio archive (in the "newc"
+//format) and checks that the name and file sizes fit into the archive. The
+//cpio library trusts these values, and would panic or allocate absurd amounts
+//of memory on malformed archives. Other problems (e.g. a missing trailer) are
+//left for the cpio library to report.
+func checkCpioHeaders(data []byte) error {
+	const headerSize = 110
+	align := func(offset uint64) uint64 { return (offset + 3) &^ 3 }
+
+	offset := uint64(0)
+	for offset < uint64(len(data)) {
+		if offset+headerSize > uint64(len(data)) {
+			return fmt.Errorf("cpio entry at offset %d has truncated header", offset)
+		}
+		header := data[offset : offset+headerSize]
+		fileSize, err := strconv.ParseUint(string(header[54:62]), 16, 32)
+		if err != nil {
+			return fmt.Errorf("cpio entry at offset %d has invalid file size: %s", offset, err.Error())
+		}
+		nameSize, err := strconv.ParseUint(string(header[94:102]), 16, 32)
+		if err != nil {
+			return fmt.Errorf("cpio entry at offset %d has invalid name size: %s", offset, err.Error())
+		}
+		nameStart := offset + headerSize
+		if nameSize == 0 || nameStart+nameSize > uint64(len(data)) {
+			return fmt.Errorf("cpio entry at offset %d has invalid name size %d", offset, nameSize)
+		}
+		name := string(data[nameStart : nameStart+nameSize-1])
+
+		offset = align(nameStart + nameSize)
+		if offset+fileSize > uint64(len(data)) {
+			return fmt.Errorf("cpio entry %q has invalid file size %d", name, fileSize)
+		}
+		if name == "TRAILER!!!" {
+			break
+		}
+		offset = align(offset + fileSize)
+	}
+	return nil
+}
+
+//The generic parts of readTar, readAr and readCpio. The nextEntry callback
+//advances the reader to the next entry and returns its metadata.
+func readArchiveGeneric(reader io.Reader, nextEntry func() (*Entry, error)) ([]Entry, error) {
+	var entries []Entry
+
+	//iterate through the entries in the archive
+	for idx := 0; ; idx++ {
+		//get next entry
+		entry, err := nextEntry()
+		if err == io.EOF {
+			break //end of archive
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry.Position = idx
+
+		//get contents of entry
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		switch entry.Type {
+		case EntryRegularFile:
+			entry.Content, err = recognize(data)
+			if err != nil {
+				return nil, err
+			}
+		case EntrySymlink:
+			//in cpio archives, the data contains the symlink target
+			if entry.Target == "" {
+				entry.Target = string(data)
+			}
+		}
+		entries = append(entries, *entry)
+	}
+
+	//sort entries by name (duplicate entries are kept in archive order)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+//readMtree reads the entries of mtree metadata archives.
+func readMtree(data []byte) []Entry {
+	//We don't have a library for the mtree(5) format, but it's relatively simple.
+	//NOTE: We don't support absolute paths ("mtree v2.0") and we don't track the cwd.
+	//All we do is resolve duplicate entries and "/set" and "/unset" commands.
+	lines := strings.Split(string(data), "\n")
+
+	//go through each entry and resolve "/set"
+	globalOpts := make(map[string]string)
+	entries := make(map[string]map[string]string)
+
+	for _, line := range lines {
+		//ignore comments
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+
+		//lines look like "name option option option"
+		options := strings.Split(line, " ")
+		name := options[0]
+		options = options[1:]
+
+		//parse options (option = "key=value")
+		opts := make(map[string]string, len(options))
+		for _, option := range options {
+			pair := strings.SplitN(option, "=", 2)
+			if len(pair) == 1 {
+				opts[pair[0]] = ""
+			} else {
+				opts[pair[0]] = pair[1]
+			}
+		}
+
+		//name can either be a special command or a filename
+		switch name {
+		case "/set":
+			//set the opts globally
+			for key, value := range opts {
+				globalOpts[key] = value
+			}
+		case "/unset":
+			//unset the opts globally
+			for key := range opts {
+				delete(globalOpts, key)
+			}
+		default:
+			//create (if missing) an entry for this file and add the opts to it
+			entry, ok := entries[name]
+			if !ok {
+				entry = make(map[string]string, len(opts)+len(globalOpts))
+				//apply globalOpts
+				for key, value := range globalOpts {
+					entry[key] = value
+				}
+				entries[name] = entry
+			}
+			for key, value := range opts {
+				entry[key] = value
+			}
+		}
+	}
+
+	//sort entries by name
+	entryNames := make([]string, 0, len(entries))
+	for name := range entries {
+		entryNames = append(entryNames, name)
+	}
+	sort.Strings(entryNames)
+
+	result := make([]Entry, len(entryNames))
+	for idx, name := range entryNames {
+		result[idx] = Entry{Name: name, Attributes: entries[name]}
+	}
+	return result
+}
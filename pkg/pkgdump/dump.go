@@ -0,0 +1,404 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package pkgdump
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+//DumpOptions selects which parts of a Tree are rendered by DumpWithOptions()
+//and Summary(). The zero value renders everything.
+type DumpOptions struct {
+	//WithChecksums includes the SHA-256 checksum of each piece of data (see
+	//Dump).
+	WithChecksums bool
+	//MaxDepth limits how deeply nested data is rendered. Each compression
+	//layer, archive and package counts as one level. Data below this level
+	//is only described by its format and size. 0 means no limit.
+	MaxDepth int
+	//Paths restricts the archive entries that are shown to those matching
+	//one of these glob patterns (as understood by path.Match), or located
+	//below a directory matching one of them. A leading "./" or "/" is
+	//ignored on both sides. Entries containing further archives or
+	//compressed data are always shown, so that matching entries within them
+	//can be found. If empty, all entries are shown.
+	Paths []string
+	//NoContent omits plain data (e.g. the contents of regular files in
+	//archives) and only shows its size. Compressed data, archives and
+	//packages are still decoded.
+	NoContent bool
+	//RedactRestricted omits the contents of regular files in archives that
+	//are not readable by other users, since these may contain secrets (e.g.
+	//holo-build's `sensitive = true`), and only shows their size and
+	//checksum. This does not apply to files containing further archives or
+	//packages.
+	RedactRestricted bool
+}
+
+//formatDescriptions is used to describe data without showing it (see
+//DumpOptions).
+var formatDescriptions = map[Format]string{
+	FormatEmpty: "empty file",
+	FormatData:  "data",
+	FormatGZip:  "GZip-compressed data",
+	FormatBZip2: "BZip2-compressed data",
+	FormatXZ:    "XZ-compressed data",
+	FormatLZMA:  "LZMA-compressed data",
+	FormatZstd:  "Zstandard-compressed data",
+	FormatTar:   "POSIX tar archive",
+	FormatAr:    "ar archive",
+	FormatCpio:  "cpio archive",
+	FormatMtree: "mtree metadata archive",
+	FormatRPM:   "RPM package",
+	FormatELF:   "ELF file",
+}
+
+//Dump renders the tree in the textual format that the dump-package tool
+//prints, for example:
+//
+//	XZ-compressed POSIX tar archive
+//	    >> foo/ is directory (mode: 755, owner: 1000, group: 1000)
+//	    >> foo/bar is regular file (mode: 600, owner: 1000, group: 1000), content is data as shown below
+//	        Hello World!
+//	    >> foo/baz is symlink to bar
+//
+//With `withChecksums = true`, the SHA-256 checksum of each piece of data is
+//included (to check the reproducibility of packages in the holo-build test
+//suites).
+func (t *Tree) Dump(withChecksums bool) string {
+	return t.DumpWithOptions(DumpOptions{WithChecksums: withChecksums})
+}
+
+//DumpWithOptions is like Dump, but can leave out parts of the tree (see
+//DumpOptions).
+func (t *Tree) DumpWithOptions(opts DumpOptions) string {
+	return t.dump(opts, 1)
+}
+
+//String implements the fmt.Stringer interface.
+func (t *Tree) String() string {
+	return t.Dump(false)
+}
+
+func (t *Tree) dump(opts DumpOptions, depth int) string {
+	//data below the depth limit (and plain data with NoContent) is only
+	//described
+	if (opts.MaxDepth > 0 && depth > opts.MaxDepth) || (opts.NoContent && t.Format == FormatData) {
+		return t.withChecksum(opts, fmt.Sprintf("%s (%d bytes, not shown)\n", formatDescriptions[t.Format], len(t.Data)))
+	}
+
+	var result string
+	switch t.Format {
+	case FormatEmpty:
+		return "empty file\n"
+	case FormatData:
+		result = "data as shown below\n" + Indent(string(t.Data))
+	case FormatGZip:
+		result = "GZip-compressed " + t.Inner.dump(opts, depth+1)
+	case FormatBZip2:
+		result = "BZip2-compressed " + t.Inner.dump(opts, depth+1)
+	case FormatXZ:
+		result = "XZ-compressed " + t.Inner.dump(opts, depth+1)
+	case FormatLZMA:
+		result = "LZMA-compressed " + t.Inner.dump(opts, depth+1)
+	case FormatZstd:
+		result = "Zstandard-compressed " + t.Inner.dump(opts, depth+1)
+	case FormatTar:
+		result = "POSIX tar archive\n" + Indent(t.dumpEntries(opts, depth))
+	case FormatAr:
+		result = "ar archive\n" + Indent(t.dumpEntries(opts, depth))
+	case FormatCpio:
+		result = "cpio archive\n" + Indent(t.dumpEntries(opts, depth))
+	case FormatMtree:
+		result = "mtree metadata archive\n" + Indent(t.dumpMtreeEntries(opts))
+	case FormatRPM:
+		result = "RPM package\n"
+		for _, section := range t.Sections {
+			result += Indent(section.dump())
+		}
+		result += Indent(">> payload: " + t.Inner.dump(opts, depth+1))
+	case FormatELF:
+		//binary contents are not useful in a textual dump
+		result = fmt.Sprintf("ELF file (%d bytes)\n", len(t.Data))
+	}
+	return t.withChecksum(opts, result)
+}
+
+func (t *Tree) withChecksum(opts DumpOptions, result string) string {
+	//include checksum (to check reproducability of output in holo-build testcases)
+	if !opts.WithChecksums {
+		return result
+	}
+	return "(sha256:" + hex.EncodeToString(t.Checksum[:]) + ") " + result
+}
+
+//isContainer returns whether the tree contains further data that can be
+//decoded (i.e. it is not plain data or an ELF file).
+func (t *Tree) isContainer() bool {
+	switch t.Format {
+	case FormatEmpty, FormatData, FormatELF:
+		return false
+	default:
+		return true
+	}
+}
+
+//isPlainData returns whether the tree contains plain data, possibly below
+//some layers of compression.
+func (t *Tree) isPlainData() bool {
+	switch t.Format {
+	case FormatEmpty, FormatData:
+		return true
+	case FormatGZip, FormatBZip2, FormatXZ, FormatLZMA, FormatZstd:
+		return t.Inner.isPlainData()
+	default:
+		return false
+	}
+}
+
+//showsEntry implements the filter described for DumpOptions.Paths.
+func (opts DumpOptions) showsEntry(entry Entry) bool {
+	if len(opts.Paths) == 0 {
+		return true
+	}
+	if entry.Type == EntryRegularFile && entry.Content != nil && entry.Content.isContainer() {
+		return true
+	}
+
+	name := normalizeEntryName(entry.Name)
+	for _, pattern := range opts.Paths {
+		pattern = normalizeEntryName(pattern)
+		//check the entry itself and all its parent directories
+		for candidate := name; candidate != "." && candidate != ""; candidate = path.Dir(candidate) {
+			//errors are ignored since the patterns were validated by the caller
+			if matches, _ := path.Match(pattern, candidate); matches {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//normalizeEntryName removes the parts of an entry name (or a pattern in
+//DumpOptions.Paths) that differ between archive formats, e.g. "./etc/foo/"
+//becomes "etc/foo".
+func normalizeEntryName(name string) string {
+	name = strings.TrimPrefix(name, "./")
+	return strings.Trim(name, "/")
+}
+
+func (t *Tree) dumpEntries(opts DumpOptions, depth int) string {
+	dump := ""
+	for _, entry := range t.Entries {
+		if !opts.showsEntry(entry) {
+			continue
+		}
+		dump += fmt.Sprintf(">> %s is %s", entry.Name, entry.Type)
+
+		//add metadata
+		if entry.Type == EntrySymlink {
+			dump += " to " + entry.Target
+			if entry.UID != 0 || entry.GID != 0 { //symlinks are usually owned by root
+				dump += fmt.Sprintf(" (owner: %d, group: %d)", entry.UID, entry.GID)
+			}
+		} else {
+			dump += fmt.Sprintf(" (mode: %o, owner: %d, group: %d)", entry.Mode, entry.UID, entry.GID)
+		}
+		if t.Format == FormatAr {
+			dump += describeArPosition(entry)
+		}
+
+		//for regular files, include a dump of the contents (unless they may
+		//contain secrets, see DumpOptions.RedactRestricted)
+		switch {
+		case entry.Type != EntryRegularFile:
+			dump += "\n"
+		case opts.RedactRestricted && entry.Mode&0004 == 0 && entry.Content != nil && entry.Content.isPlainData():
+			dump += fmt.Sprintf(", content is not shown (not readable by other users; %d bytes, sha256:%s)\n",
+				len(entry.Content.Data), hex.EncodeToString(entry.Content.Checksum[:]))
+		default:
+			dump += ", content is " + entry.Content.dump(opts, depth+1)
+		}
+	}
+	if dump == "" && len(opts.Paths) > 0 {
+		return "no entries matching the given paths\n"
+	}
+	return dump
+}
+
+func describeArPosition(entry Entry) string {
+	//for Debian packages, we need to check that the file "debian-binary"
+	//is the first entry
+	if entry.Name == "debian-binary" {
+		return fmt.Sprintf(" at archive position %d", entry.Position)
+	}
+
+	//the control and data members must follow in this order, too
+	//(their positions are only reported if they are wrong, since the
+	//member names vary with the compression method)
+	for expectedIdx, prefix := range []string{"control.tar", "data.tar"} {
+		if entry.Name == prefix || strings.HasPrefix(entry.Name, prefix+".") {
+			if entry.Position != expectedIdx+1 {
+				return fmt.Sprintf(" at unexpected archive position %d (expected %d)", entry.Position, expectedIdx+1)
+			}
+		}
+	}
+	return ""
+}
+
+func (t *Tree) dumpMtreeEntries(opts DumpOptions) string {
+	lines := make([]string, 0, len(t.Entries))
+	for _, entry := range t.Entries {
+		if !opts.showsEntry(entry) {
+			continue
+		}
+		//sort options for entry by key
+		keys := make([]string, 0, len(entry.Attributes))
+		for key := range entry.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		options := ""
+		for _, key := range keys {
+			options += fmt.Sprintf(" %s=%s", key, entry.Attributes[key])
+		}
+		lines = append(lines, ">> "+entry.Name+options)
+	}
+	if len(lines) == 0 && len(opts.Paths) > 0 {
+		return "no entries matching the given paths\n"
+	}
+	return strings.Join(lines, "\n")
+}
+
+//Summary renders one line for each layer of the tree (compressed data,
+//archives and packages) with its size and the number of entries, instead of
+//the full dump, for example:
+//
+//	ar archive (1302 bytes): 3 entries (regular file: 3), 1056 bytes of file content
+//	    >> control.tar.gz: GZip-compressed data (390 bytes)
+//	        POSIX tar archive (10240 bytes): 3 entries (directory: 1, regular file: 2), 224 bytes of file content
+//	    >> data.tar.xz: XZ-compressed data (652 bytes)
+//	        POSIX tar archive (10240 bytes): 4 entries (directory: 2, regular file: 2), 21 bytes of file content
+//
+//Only the archive entries containing further layers are listed. All fields
+//of the options except for NoContent are respected.
+func (t *Tree) Summary(opts DumpOptions) string {
+	return t.summary(opts, 1)
+}
+
+func (t *Tree) summary(opts DumpOptions, depth int) string {
+	line := t.withChecksum(opts, fmt.Sprintf("%s (%d bytes)", formatDescriptions[t.Format], len(t.Data)))
+	if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+		return line + "\n"
+	}
+
+	var children []string
+	switch t.Format {
+	case FormatGZip, FormatBZip2, FormatXZ, FormatLZMA, FormatZstd:
+		children = append(children, t.Inner.summary(opts, depth+1))
+	case FormatTar, FormatAr, FormatCpio, FormatMtree:
+		var (
+			entryCount  int
+			typeCounts  = make(map[EntryType]int)
+			contentSize int
+		)
+		for _, entry := range t.Entries {
+			if !opts.showsEntry(entry) {
+				continue
+			}
+			entryCount++
+			if entry.Type != "" {
+				typeCounts[entry.Type]++
+			}
+			if entry.Type == EntryRegularFile {
+				contentSize += len(entry.Content.Data)
+				if entry.Content.isContainer() {
+					children = append(children, ">> "+entry.Name+": "+entry.Content.summary(opts, depth+1))
+				}
+			}
+		}
+
+		line += fmt.Sprintf(": %d entries", entryCount)
+		if len(typeCounts) > 0 {
+			types := make([]string, 0, len(typeCounts))
+			for entryType, count := range typeCounts {
+				types = append(types, fmt.Sprintf("%s: %d", entryType, count))
+			}
+			sort.Strings(types)
+			line += " (" + strings.Join(types, ", ") + ")"
+		}
+		if typeCounts[EntryRegularFile] > 0 {
+			line += fmt.Sprintf(", %d bytes of file content", contentSize)
+		}
+	case FormatRPM:
+		var sections []string
+		for _, section := range t.Sections {
+			if section.Summary != "" {
+				sections = append(sections, fmt.Sprintf("%s: %d entries", section.Name, len(section.Fields)))
+			}
+		}
+		line += ": " + strings.Join(sections, ", ")
+		children = append(children, ">> payload: "+t.Inner.summary(opts, depth+1))
+	}
+
+	result := line + "\n"
+	for _, child := range children {
+		result += Indent(child)
+	}
+	return result
+}
+
+func (s Section) dump() string {
+	if s.Summary == "" {
+		return fmt.Sprintf(">> %s section:\n", s.Name) + Indent(strings.Join(s.Lines, "\n"))
+	}
+
+	lines := make([]string, len(s.Fields))
+	for idx, field := range s.Fields {
+		//identify entry by its tag name
+		tagName := fmt.Sprintf("tag %d", field.Tag)
+		if field.TagName != "" {
+			tagName = fmt.Sprintf("tag %d (%s)", field.Tag, field.TagName)
+		}
+
+		lines[idx] = fmt.Sprintf("%s: length %d", tagName, field.Count)
+		if len(field.Values) > 0 {
+			lines[idx] += "\n" + strings.TrimSuffix(Indent(strings.Join(field.Values, "\n")), "\n")
+		}
+	}
+	return fmt.Sprintf(">> %s section: %s\n", s.Name, s.Summary) + Indent(strings.Join(lines, "\n"))
+}
+
+//Indent is a general-purpose helper function for pretty-printing of nested data.
+func Indent(dump string) string {
+	//indent the first line and all subsequent lines except for the trailing newline
+	//(and also ensure a trailing newline, which means that in total we can
+	//trim the trailing newline at the start, and put it back at the end)
+	dump = strings.TrimSuffix(dump, "\n")
+	indent := "    "
+	dump = indent + strings.Replace(dump, "\n", "\n"+indent, -1)
+	return dump + "\n"
+}
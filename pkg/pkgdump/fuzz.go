@@ -0,0 +1,35 @@
+//go:build gofuzz
+// +build gofuzz
+
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package pkgdump
+
+//Fuzz is the entry point for go-fuzz (see "Fuzzing" in test/README.md). It
+//recognizes and dumps the input like `dump-package` does.
+func Fuzz(data []byte) int {
+	_, tree, err := Recognize(data)
+	if err != nil {
+		return 0
+	}
+	tree.Dump(true)
+	return 1
+}
@@ -0,0 +1,224 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+//Package pkgdump decodes packages (and the compressed files and archives
+//contained within them) into a Tree that describes their structure, so that
+//tests and other tools can inspect packages programmatically. The textual
+//rendering of a Tree (see Tree.Dump) is what the dump-package tool prints,
+//and what the holo-build test suites compare against.
+package pkgdump
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+//Format identifies a data format that Recognize() can decode.
+type Format string
+
+const (
+	//FormatEmpty is an empty file.
+	FormatEmpty Format = "empty"
+	//FormatData is data in an unrecognized format (usually text).
+	FormatData Format = "data"
+	//FormatGZip is GZip-compressed data.
+	FormatGZip Format = "gzip"
+	//FormatBZip2 is BZip2-compressed data.
+	FormatBZip2 Format = "bzip2"
+	//FormatXZ is XZ-compressed data.
+	FormatXZ Format = "xz"
+	//FormatLZMA is LZMA-compressed data (as used in RPM payloads).
+	FormatLZMA Format = "lzma"
+	//FormatZstd is Zstandard-compressed data.
+	FormatZstd Format = "zstd"
+	//FormatTar is a POSIX tar archive.
+	FormatTar Format = "tar"
+	//FormatMtree is an mtree(5) metadata archive (as used by pacman).
+	FormatMtree Format = "mtree"
+	//FormatAr is an ar archive (as used by Debian packages).
+	FormatAr Format = "ar"
+	//FormatCpio is a cpio archive (as used in RPM payloads).
+	FormatCpio Format = "cpio"
+	//FormatRPM is an RPM package.
+	FormatRPM Format = "rpm"
+	//FormatELF is an ELF binary or shared library. Its contents are not
+	//decoded any further.
+	FormatELF Format = "elf"
+)
+
+//IsCompression returns whether this format is a compression format, i.e.
+//whether Tree.Inner contains the decompressed data.
+func (f Format) IsCompression() bool {
+	switch f {
+	case FormatGZip, FormatBZip2, FormatXZ, FormatLZMA, FormatZstd:
+		return true
+	default:
+		return false
+	}
+}
+
+//Tree describes the structure of a piece of data, as decoded by Recognize().
+type Tree struct {
+	//Format is the format of the data.
+	Format Format
+	//Checksum is the SHA-256 checksum of the data.
+	Checksum [sha256.Size]byte
+	//Data is the data itself.
+	Data []byte
+	//Inner contains the decompressed data for compression formats, and the
+	//payload for FormatRPM.
+	Inner *Tree
+	//Entries contains the entries of archives (FormatTar, FormatAr,
+	//FormatCpio and FormatMtree), sorted by name.
+	Entries []Entry
+	//Sections contains the lead, signature and header sections for
+	//FormatRPM.
+	Sections []Section
+}
+
+//Recognize decodes the given data recursively: Compressed data is
+//decompressed, and the contents of archives and packages are recognized in
+//the same way.
+func Recognize(data []byte) (Format, *Tree, error) {
+	tree, err := recognize(data)
+	if tree == nil {
+		return "", nil, err
+	}
+	return tree.Format, tree, err
+}
+
+func recognize(data []byte) (*Tree, error) {
+	tree := &Tree{
+		Checksum: sha256.Sum256(data),
+		Data:     data,
+	}
+	if len(data) == 0 {
+		tree.Format = FormatEmpty
+		return tree, nil
+	}
+
+	//Thanks to https://stackoverflow.com/a/19127748/334761 for
+	//listing all the magic numbers of the usual compression formats.
+
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b, 0x08}):
+		tree.Format = FormatGZip
+		tree.Inner, err = decompress(FormatGZip, data)
+	case bytes.HasPrefix(data, []byte{0x42, 0x5a, 0x68}):
+		tree.Format = FormatBZip2
+		tree.Inner, err = decompress(FormatBZip2, data)
+	case bytes.HasPrefix(data, []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}):
+		tree.Format = FormatXZ
+		tree.Inner, err = decompress(FormatXZ, data)
+	case bytes.HasPrefix(data, []byte{0x5d, 0x00, 0x00}):
+		tree.Format = FormatLZMA
+		tree.Inner, err = decompress(FormatLZMA, data)
+	case bytes.HasPrefix(data, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		tree.Format = FormatZstd
+		tree.Inner, err = decompress(FormatZstd, data)
+	case len(data) >= 512 && bytes.Equal(data[257:262], []byte("ustar")):
+		tree.Format = FormatTar
+		tree.Entries, err = readTar(data)
+	case bytes.HasPrefix(data, []byte("#mtree")):
+		tree.Format = FormatMtree
+		tree.Entries = readMtree(data)
+	case bytes.HasPrefix(data, []byte("!<arch>\n")):
+		tree.Format = FormatAr
+		tree.Entries, err = readAr(data)
+	case bytes.HasPrefix(data, []byte("070701")):
+		tree.Format = FormatCpio
+		tree.Entries, err = readCpio(data)
+	case bytes.HasPrefix(data, []byte{0xed, 0xab, 0xee, 0xdb}):
+		tree.Format = FormatRPM
+		tree.Sections, tree.Inner, err = readRpm(data)
+	case bytes.HasPrefix(data, []byte{0x7f, 0x45, 0x4c, 0x46}):
+		tree.Format = FormatELF
+	default:
+		tree.Format = FormatData
+	}
+	return tree, err
+}
+
+//decompress decompresses data in one of the compression formats, and
+//recognizes the decompressed data.
+func decompress(format Format, data []byte) (*Tree, error) {
+	switch format {
+	case FormatGZip:
+		return decompressGZ(data)
+	case FormatBZip2:
+		return decompressBZ2(data)
+	case FormatXZ:
+		return decompressUsingProgram(data, "xz", "-d")
+	case FormatLZMA:
+		return decompressUsingProgram(data, "xz", "--format=lzma", "--decompress", "--stdout")
+	case FormatZstd:
+		return decompressUsingProgram(data, "zstd", "--decompress", "--stdout", "--quiet")
+	default:
+		return nil, fmt.Errorf("%s is not a compression format", format)
+	}
+}
+
+func decompressGZ(data []byte) (*Tree, error) {
+	//use "compress/gzip" package to decompress the data
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	data2, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	//`data2` now contains the decompressed data
+	return recognize(data2)
+}
+
+func decompressBZ2(data []byte) (*Tree, error) {
+	//use "compress/bzip2" package to decompress the data
+	r := bzip2.NewReader(bytes.NewReader(data))
+	data2, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	//`data2` now contains the decompressed data
+	return recognize(data2)
+}
+
+func decompressUsingProgram(data []byte, command string, args ...string) (*Tree, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	//`output` now contains the decompressed data
+	return recognize(output)
+}
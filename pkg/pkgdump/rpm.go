@@ -18,10 +18,11 @@
 *
 *******************************************************************************/
 
-package impl
+package pkgdump
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -31,8 +32,42 @@ import (
 	"strings"
 )
 
-//DumpRpm dumps RPM packages.
-func DumpRpm(data []byte, withChecksums bool) (string, error) {
+//Section is a section of an RPM package (the lead, the signature or the
+//header).
+type Section struct {
+	//Name is "lead", "signature" or "header".
+	Name string
+	//Summary describes the structure of header sections (format version,
+	//number of entries, size of the data store). It is empty for the lead.
+	Summary string
+	//Lines describes the fields of the lead. It is empty for header sections.
+	Lines []string
+	//Fields contains the entries of header sections, sorted by tag.
+	Fields []Field
+}
+
+//Field is an entry in the signature or header section of an RPM package.
+type Field struct {
+	//Tag identifies the field.
+	Tag uint32
+	//TagName is the symbolic name of the tag (e.g. "NAME"), or empty if the
+	//tag is not known.
+	TagName string
+	//Count is the number of values, or the number of bytes for binary values.
+	Count uint32
+	//Values contains a description of each value (e.g. "string: foo"). For
+	//binary values, it contains a single hex dump.
+	Values []string
+	//Strings contains the raw values of string fields.
+	Strings []string
+	//Integers contains the raw values of integer fields.
+	Integers []int64
+	//Binary contains the raw value of binary fields.
+	Binary []byte
+}
+
+//readRpm reads RPM packages.
+func readRpm(data []byte) ([]Section, *Tree, error) {
 	//We don't have a library for the RPM format, and unfortunately, it's an utter mess.
 	//The main reference that I used (apart from sample RPMs from Fedora, Mageia, and Suse)
 	//is <http://www.rpm.org/max-rpm/s1-rpm-file-format-rpm-file-format.html> and
@@ -40,33 +75,81 @@ func DumpRpm(data []byte, withChecksums bool) (string, error) {
 	reader := bytes.NewReader(data)
 
 	//decode the various header structures
-	leadDump, err := dumpRpmLead(reader)
+	lead, signatureType, err := readRpmLead(reader)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
-	signatureDump, err := dumpRpmHeader(reader, "signature", true, rpmtagDictForSignatureHeader)
-	if err != nil {
-		return "", err
+	sections := []Section{lead}
+	switch signatureType {
+	case 0:
+		//no signature (only found in ancient packages)
+	case 5:
+		//signature in the same format as the header (used by all rpm
+		//versions since 3.0)
+		signature, err := readRpmHeader(reader, "signature", true, rpmtagDictForSignatureHeader)
+		if err != nil {
+			return nil, nil, err
+		}
+		sections = append(sections, signature)
+	default:
+		return nil, nil, fmt.Errorf("cannot decode RPM signature of type %d (only type 5 is supported)", signatureType)
 	}
-	headerDump, err := dumpRpmHeader(reader, "header", false, rpmtagDictForMetadataHeader)
+	header, err := readRpmHeader(reader, "header", false, rpmtagDictForMetadataHeader)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
+	sections = append(sections, header)
 
 	//decode payload
 	payloadData, err := ioutil.ReadAll(reader)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
-	payloadDump, err := RecognizeAndDump(payloadData, withChecksums)
-	if err != nil {
-		return "", err
+	payload, err := readRpmPayload(payloadData, header)
+	return sections, payload, err
+}
+
+//rpmPayloadCompressors maps the values of the PAYLOADCOMPRESSOR tag to the
+//respective compression formats.
+var rpmPayloadCompressors = map[string]Format{
+	"gzip":  FormatGZip,
+	"bzip2": FormatBZip2,
+	"xz":    FormatXZ,
+	"lzma":  FormatLZMA,
+	"zstd":  FormatZstd,
+}
+
+//readRpmPayload decodes the payload of an RPM package. The compression format
+//is taken from the PAYLOADCOMPRESSOR tag, since not every compressed payload
+//can be recognized by its magic number (e.g. LZMA streams with non-default
+//settings). If the tag is missing or has an unknown value, the payload is
+//recognized like any other data.
+func readRpmPayload(data []byte, header Section) (*Tree, error) {
+	var compressor string
+	for _, field := range header.Fields {
+		if field.TagName == "PAYLOADCOMPRESSOR" && len(field.Strings) == 1 {
+			compressor = field.Strings[0]
+		}
+	}
+	format, exists := rpmPayloadCompressors[compressor]
+	if !exists || len(data) == 0 {
+		return recognize(data)
 	}
 
-	return "RPM package\n" + Indent(leadDump) + Indent(signatureDump) + Indent(headerDump) + Indent(">> payload: "+payloadDump), nil
+	tree := &Tree{
+		Format:   format,
+		Checksum: sha256.Sum256(data),
+		Data:     data,
+	}
+	var err error
+	tree.Inner, err = decompress(format, data)
+	if err != nil {
+		return tree, fmt.Errorf("cannot decompress RPM payload with %s: %s", compressor, err.Error())
+	}
+	return tree, nil
 }
 
-func dumpRpmLead(reader io.Reader) (string, error) {
+func readRpmLead(reader io.Reader) (Section, uint16, error) {
 	//read the lead (the initial fixed-size header)
 	var lead struct {
 		Magic         uint32
@@ -81,19 +164,21 @@ func dumpRpmLead(reader io.Reader) (string, error) {
 	}
 	err := binary.Read(reader, binary.BigEndian, &lead)
 	if err != nil {
-		return "", err
+		return Section{}, 0, err
 	}
 
-	lines := []string{
-		fmt.Sprintf("RPM format version %d.%d", lead.MajorVersion, lead.MinorVersion),
-		fmt.Sprintf("Type: %d (0 = binary, 1 = source)", lead.Type),
-		fmt.Sprintf("Architecture: %d (0 = noarch, 1 = x86 (also x86-64), 2 = Alpha, 3 = Sparc, 4 = MIPS, 5 = PPC, ..., 9 = IA-64, 12 = ARM, ...)", lead.Architecture),
-		//lead.Name is a NUL-terminated (and NUL-padded) string; trim all the NULs at the end
-		fmt.Sprintf("Name: %s", strings.TrimRight(string(lead.Name[:]), "\x00")),
-		fmt.Sprintf("Built for OS: %d (1 = Linux, ...)", lead.OSNum),
-		fmt.Sprintf("Signature type: %d", lead.SignatureType),
-	}
-	return ">> lead section:\n" + Indent(strings.Join(lines, "\n")), nil
+	return Section{
+		Name: "lead",
+		Lines: []string{
+			fmt.Sprintf("RPM format version %d.%d", lead.MajorVersion, lead.MinorVersion),
+			fmt.Sprintf("Type: %d (0 = binary, 1 = source)", lead.Type),
+			fmt.Sprintf("Architecture: %d (0 = noarch, 1 = x86 (also x86-64), 2 = Alpha, 3 = Sparc, 4 = MIPS, 5 = PPC, ..., 9 = IA-64, 12 = ARM, ...)", lead.Architecture),
+			//lead.Name is a NUL-terminated (and NUL-padded) string; trim all the NULs at the end
+			fmt.Sprintf("Name: %s", strings.TrimRight(string(lead.Name[:]), "\x00")),
+			fmt.Sprintf("Built for OS: %d (1 = Linux, ...)", lead.OSNum),
+			fmt.Sprintf("Signature type: %d", lead.SignatureType),
+		},
+	}, lead.SignatureType, nil
 }
 
 //IndexEntry represents an entry in the index of an RPM header.
@@ -104,7 +189,7 @@ type IndexEntry struct {
 	Count  uint32 //number of data items in this field
 }
 
-func dumpRpmHeader(reader io.Reader, sectionIdent string, readAligned bool, tagDict map[uint32]string) (string, error) {
+func readRpmHeader(reader *bytes.Reader, sectionIdent string, readAligned bool, tagDict map[uint32]string) (Section, error) {
 	//the header has a header (I'm So Meta, Even This Acronym)
 	var header struct {
 		Magic      [3]byte
@@ -115,17 +200,28 @@ func dumpRpmHeader(reader io.Reader, sectionIdent string, readAligned bool, tagD
 	}
 	err := binary.Read(reader, binary.BigEndian, &header)
 	if err != nil {
-		return "", err
+		return Section{}, err
 	}
 	if header.Magic != [3]byte{0x8e, 0xad, 0xe8} {
-		return "", fmt.Errorf(
+		return Section{}, fmt.Errorf(
 			"did not find RPM header structure header at expected position (saw 0x%s instead of 0x8eade8)",
 			hex.EncodeToString(header.Magic[:]),
 		)
 	}
-	identifier := fmt.Sprintf(">> %s section: format version %d, %d entries, %d bytes of data\n",
-		sectionIdent, header.Version, header.EntryCount, header.DataSize,
-	)
+	//the sizes are not trustworthy, so check them before allocating anything
+	//(each index entry has 16 bytes)
+	if uint64(header.EntryCount)*16+uint64(header.DataSize) > uint64(reader.Len()) {
+		return Section{}, fmt.Errorf(
+			"RPM %s section claims %d entries and %d bytes of data, but only %d bytes are left",
+			sectionIdent, header.EntryCount, header.DataSize, reader.Len(),
+		)
+	}
+	section := Section{
+		Name: sectionIdent,
+		Summary: fmt.Sprintf("format version %d, %d entries, %d bytes of data",
+			header.Version, header.EntryCount, header.DataSize,
+		),
+	}
 
 	//read index of fields
 	indexEntries := make([]IndexEntry, 0, header.EntryCount)
@@ -133,7 +229,7 @@ func dumpRpmHeader(reader io.Reader, sectionIdent string, readAligned bool, tagD
 		var entry IndexEntry
 		err := binary.Read(reader, binary.BigEndian, &entry)
 		if err != nil {
-			return "", err
+			return Section{}, err
 		}
 		indexEntries = append(indexEntries, entry)
 	}
@@ -142,7 +238,7 @@ func dumpRpmHeader(reader io.Reader, sectionIdent string, readAligned bool, tagD
 	buffer := make([]byte, header.DataSize)
 	_, err = io.ReadFull(reader, buffer)
 	if err != nil {
-		return "", err
+		return Section{}, err
 	}
 	bufferedReader := bytes.NewReader(buffer)
 
@@ -152,116 +248,126 @@ func dumpRpmHeader(reader io.Reader, sectionIdent string, readAligned bool, tagD
 		if modulo != 0 {
 			_, err = io.ReadFull(reader, make([]byte, 8-modulo))
 			if err != nil {
-				return "", err
+				return Section{}, err
 			}
 		}
 	}
 
-	//decode and dump entries
-	dumpForTag := make(map[uint32]string)
-	tags := make([]uint32, 0, len(indexEntries))
+	//decode entries
 	for _, entry := range indexEntries {
-		//seek to start of entry
+		//seek to start of entry (the offset already includes the alignment
+		//for INT16/INT32/INT64 values, so the values can be read right away)
+		if entry.Offset > header.DataSize {
+			return Section{}, fmt.Errorf(
+				"RPM %s entry for tag %d starts at offset %d, but the data store only has %d bytes",
+				sectionIdent, entry.Tag, entry.Offset, header.DataSize,
+			)
+		}
 		_, err := bufferedReader.Seek(int64(entry.Offset), 0)
 		if err != nil {
-			return "", err
+			return Section{}, err
 		}
 
-		var sublines []string
-		if entry.Type == 7 {
+		//each value takes at least one byte in the data store
+		if uint64(entry.Count) > uint64(header.DataSize) {
+			return Section{}, fmt.Errorf(
+				"RPM %s entry for tag %d claims %d values, but the data store only has %d bytes",
+				sectionIdent, entry.Tag, entry.Count, header.DataSize,
+			)
+		}
+		field := Field{
+			Tag:     entry.Tag,
+			TagName: tagDict[entry.Tag],
+			Count:   entry.Count,
+		}
+		switch {
+		case entry.Type > 9:
+			//unknown data type (e.g. from a newer rpm version), so the size of
+			//the values is unknown; show the field anyway since the other
+			//fields can still be decoded
+			field.Values = []string{fmt.Sprintf("don't know how to decode data type %d", entry.Type)}
+		case entry.Type == 7:
 			//for entry.Type = 7 (BIN), entry.Count is the number of bytes to be read
 			data := make([]byte, entry.Count)
 			_, err = io.ReadFull(bufferedReader, data)
 			if err != nil {
-				return "", err
+				return Section{}, err
 			}
-			sublines = []string{hex.Dump(data)}
-		} else {
+			field.Values = []string{hex.Dump(data)}
+			field.Binary = data
+		default:
 			//for all other types, entry.Count tells the number of records to read
-			sublines = make([]string, 0, entry.Count)
+			field.Values = make([]string, 0, entry.Count)
 			for idx := uint32(0); idx < entry.Count; idx++ {
-				repr, err := decodeIndexEntry(entry.Type, bufferedReader)
+				repr, value, err := decodeIndexEntry(entry.Type, bufferedReader)
 				if err != nil {
-					return "", err
+					return Section{}, err
+				}
+				//show the index of array elements, since other fields refer
+				//to them by index (e.g. DIRINDEXES refers to DIRNAMES)
+				if entry.Type == 8 {
+					repr = fmt.Sprintf("[%d] %s", idx, repr)
+				}
+				field.Values = append(field.Values, repr)
+				switch value := value.(type) {
+				case string:
+					field.Strings = append(field.Strings, value)
+				case int64:
+					field.Integers = append(field.Integers, value)
 				}
-				sublines = append(sublines, repr)
 			}
 		}
-
-		//identify entry by looking up the tag name
-		tagName, isKnownTag := tagDict[entry.Tag]
-		if isKnownTag {
-			tagName = fmt.Sprintf("tag %d (%s)", entry.Tag, tagName)
-		} else {
-			tagName = fmt.Sprintf("tag %d", entry.Tag)
-		}
-
-		dump := fmt.Sprintf("%s: length %d", tagName, entry.Count)
-		if len(sublines) > 0 {
-			dump += "\n" + strings.TrimSuffix(Indent(strings.Join(sublines, "\n")), "\n")
-		}
-
-		//the same tag should not appear multiple times; but if it does, report
-		//both instead of overwriting the first occurrence with the second one
-		if _, duplicateTag := dumpForTag[entry.Tag]; duplicateTag {
-			dumpForTag[entry.Tag] += "\n" + dump
-		} else {
-			dumpForTag[entry.Tag] = dump
-			tags = append(tags, entry.Tag)
-		}
+		section.Fields = append(section.Fields, field)
 	}
+	annotateRpmFields(section.Fields)
 
-	//sort entry dumps by tag value, because order should not matter
-	sort.Sort(byUint32(tags))
-	lines := make([]string, 0, len(tags))
-	for _, tag := range tags {
-		lines = append(lines, dumpForTag[tag])
-	}
-
-	return identifier + Indent(strings.Join(lines, "\n")), nil
+	//sort entries by tag value, because order should not matter (the same
+	//tag should not appear multiple times; but if it does, report all
+	//occurrences in their original order)
+	sort.SliceStable(section.Fields, func(i, j int) bool {
+		return section.Fields[i].Tag < section.Fields[j].Tag
+	})
+	return section, nil
 }
 
-type byUint32 []uint32
-
-func (b byUint32) Len() int           { return len(b) }
-func (b byUint32) Less(i, j int) bool { return b[i] < b[j] }
-func (b byUint32) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
-
-func decodeIndexEntry(dataType uint32, reader io.Reader) (string, error) {
+//decodeIndexEntry reads one value of the given data type, and returns a
+//description of it along with the raw value (a string or an int64, or nil for
+//NULL values).
+func decodeIndexEntry(dataType uint32, reader io.Reader) (string, interface{}, error) {
 	//check data type
 	switch dataType {
 	case 0: //NULL
-		return "null", nil
+		return "null", nil, nil
 	case 1: //CHAR
 		var value uint8
 		err := binary.Read(reader, binary.BigEndian, &value)
-		return fmt.Sprintf("char: %c = 0x%X = 0o%o", rune(value), value, value), err
+		return fmt.Sprintf("char: %q = 0x%X = 0o%o", rune(value), value, value), int64(value), err
 	case 2: //INT8
 		var value int8
 		err := binary.Read(reader, binary.BigEndian, &value)
-		return fmt.Sprintf("int8: %d = 0x%X = 0o%o", value, uint8(value), uint8(value)), err
+		return fmt.Sprintf("int8: %d = 0x%X = 0o%o", value, uint8(value), uint8(value)), int64(value), err
 	case 3: //INT16
 		var value int16
 		err := binary.Read(reader, binary.BigEndian, &value)
-		return fmt.Sprintf("int16: %d = 0x%X = 0o%o", value, uint16(value), uint16(value)), err
+		return fmt.Sprintf("int16: %d = 0x%X = 0o%o", value, uint16(value), uint16(value)), int64(value), err
 	case 4: //INT32
 		var value int32
 		err := binary.Read(reader, binary.BigEndian, &value)
-		return fmt.Sprintf("int32: %d = 0x%X = 0o%o", value, uint32(value), uint32(value)), err
+		return fmt.Sprintf("int32: %d = 0x%X = 0o%o", value, uint32(value), uint32(value)), int64(value), err
 	case 5: //INT64
 		var value int64
 		err := binary.Read(reader, binary.BigEndian, &value)
-		return fmt.Sprintf("int64: %d = 0x%X = 0o%o", value, uint64(value), uint64(value)), err
+		return fmt.Sprintf("int64: %d = 0x%X = 0o%o", value, uint64(value), uint64(value)), value, err
 	case 7: //BIN
 		panic("Cannot be reached")
 	case 6, 8: //STRING or STRING_ARRAY or I18NSTRING (not different at this point)
 		str, err := readNulTerminatedString(reader)
-		return fmt.Sprintf("string: %s", str), err
+		return fmt.Sprintf("string: %s", str), str, err
 	case 9: //I18N_STRING
 		str, err := readNulTerminatedString(reader)
-		return fmt.Sprintf("translatable string: %s", str), err
+		return fmt.Sprintf("translatable string: %s", str), str, err
 	default:
-		return fmt.Sprintf("don't know how to decode data type %d", dataType), nil
+		panic("Cannot be reached")
 	}
 }
 
@@ -304,11 +410,29 @@ var rpmtagDictForSignatureHeader = map[uint32]string{
 	269:  "SHA1",
 	270:  "LONGSIZE",
 	271:  "LONGARCHIVESIZE",
+	273:  "SHA256",
+	274:  "FILESIGNATURES",
+	275:  "FILESIGNATURELENGTH",
+	276:  "VERITYSIGNATURES",
+	277:  "VERITYSIGNATUREALGO",
+	278:  "OPENPGP",
+	279:  "SHA3_256",
+	999:  "RESERVED",
 }
 
 var rpmtagDictForMetadataHeader = map[uint32]string{
 	63:   "HEADERIMMUTABLE",
 	100:  "HEADERI18NTABLE",
+	267:  "DSAHEADER", //signature tags (up to 279) can also appear in the header
+	268:  "RSAHEADER",
+	269:  "SHA1HEADER",
+	270:  "LONGSIGSIZE",
+	271:  "LONGARCHIVESIZE",
+	273:  "SHA256HEADER",
+	276:  "VERITYSIGNATURES",
+	277:  "VERITYSIGNATUREALGO",
+	278:  "OPENPGP",
+	279:  "SHA3_256HEADER",
 	1000: "NAME",
 	1001: "VERSION",
 	1002: "RELEASE",
@@ -558,4 +682,52 @@ var rpmtagDictForMetadataHeader = map[uint32]string{
 	5059: "SUGGESTNEVRS",
 	5060: "SUPPLEMENTNEVRS",
 	5061: "ENHANCENEVRS",
+	5062: "ENCODING",
+	5063: "FILETRIGGERIN",
+	5064: "FILETRIGGERUN",
+	5065: "FILETRIGGERPOSTUN",
+	5066: "FILETRIGGERSCRIPTS",
+	5067: "FILETRIGGERSCRIPTPROG",
+	5068: "FILETRIGGERSCRIPTFLAGS",
+	5069: "FILETRIGGERNAME",
+	5070: "FILETRIGGERINDEX",
+	5071: "FILETRIGGERVERSION",
+	5072: "FILETRIGGERFLAGS",
+	5073: "TRANSFILETRIGGERIN",
+	5074: "TRANSFILETRIGGERUN",
+	5075: "TRANSFILETRIGGERPOSTUN",
+	5076: "TRANSFILETRIGGERSCRIPTS",
+	5077: "TRANSFILETRIGGERSCRIPTPROG",
+	5078: "TRANSFILETRIGGERSCRIPTFLAGS",
+	5079: "TRANSFILETRIGGERNAME",
+	5080: "TRANSFILETRIGGERINDEX",
+	5081: "TRANSFILETRIGGERVERSION",
+	5082: "TRANSFILETRIGGERFLAGS",
+	5083: "REMOVEPATHPOSTFIXES",
+	5084: "FILETRIGGERPRIORITIES",
+	5085: "TRANSFILETRIGGERPRIORITIES",
+	5086: "FILETRIGGERCONDS",
+	5087: "FILETRIGGERTYPE",
+	5088: "TRANSFILETRIGGERCONDS",
+	5089: "TRANSFILETRIGGERTYPE",
+	5090: "FILESIGNATURES",
+	5091: "FILESIGNATURELENGTH",
+	5092: "PAYLOADDIGEST",
+	5093: "PAYLOADDIGESTALGO",
+	5094: "AUTOINSTALLED",
+	5095: "IDENTITY",
+	5096: "MODULARITYLABEL",
+	5097: "PAYLOADDIGESTALT",
+	5098: "ARCHSUFFIX",
+	5099: "SPEC",
+	5100: "TRANSLATIONURL",
+	5101: "UPSTREAMRELEASES",
+	5102: "SOURCELICENSE",
+	5103: "PREUNTRANS",
+	5104: "POSTUNTRANS",
+	5105: "PREUNTRANSPROG",
+	5106: "POSTUNTRANSPROG",
+	5107: "PREUNTRANSFLAGS",
+	5108: "POSTUNTRANSFLAGS",
+	5109: "SYSUSERS",
 }
@@ -0,0 +1,211 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package pkgdump
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+//rpmtagValueDescribers explains the integer values of the tags with enum or
+//bitmask semantics. The keys are tag names instead of tag IDs because the
+//signature and header sections use the same tag IDs for different tags.
+var rpmtagValueDescribers = map[string]func(int64) string{
+	"REQUIREFLAGS":          describeBits(rpmsenseNames, "RPMSENSE_ANY"),
+	"PROVIDEFLAGS":          describeBits(rpmsenseNames, "RPMSENSE_ANY"),
+	"CONFLICTFLAGS":         describeBits(rpmsenseNames, "RPMSENSE_ANY"),
+	"OBSOLETEFLAGS":         describeBits(rpmsenseNames, "RPMSENSE_ANY"),
+	"TRIGGERFLAGS":          describeBits(rpmsenseNames, "RPMSENSE_ANY"),
+	"FILETRIGGERFLAGS":      describeBits(rpmsenseNames, "RPMSENSE_ANY"),
+	"TRANSFILETRIGGERFLAGS": describeBits(rpmsenseNames, "RPMSENSE_ANY"),
+	"FILEFLAGS":             describeBits(rpmfileNames, "none"),
+	"FILEVERIFYFLAGS":       describeBits(rpmverifyNames, "RPMVERIFY_NONE"),
+	"FILEDIGESTALGO":        describeEnum(pgphashalgoNames),
+	"PAYLOADDIGESTALGO":     describeEnum(pgphashalgoNames),
+	"FILEMODES":             describeFileMode,
+}
+
+//rpmsenseNames contains the names of the bits in dependency flags (see
+//rpmsenseFlags_e in /usr/include/rpm/rpmds.h), indexed by bit position.
+var rpmsenseNames = []string{
+	"", "RPMSENSE_LESS", "RPMSENSE_GREATER", "RPMSENSE_EQUAL",
+	"", "RPMSENSE_POSTTRANS", "RPMSENSE_PREREQ", "RPMSENSE_PRETRANS",
+	"RPMSENSE_INTERP", "RPMSENSE_SCRIPT_PRE", "RPMSENSE_SCRIPT_POST", "RPMSENSE_SCRIPT_PREUN",
+	"RPMSENSE_SCRIPT_POSTUN", "RPMSENSE_SCRIPT_VERIFY", "RPMSENSE_FIND_REQUIRES", "RPMSENSE_FIND_PROVIDES",
+	"RPMSENSE_TRIGGERIN", "RPMSENSE_TRIGGERUN", "RPMSENSE_TRIGGERPOSTUN", "RPMSENSE_MISSINGOK",
+	"RPMSENSE_PREUNTRANS", "RPMSENSE_POSTUNTRANS", "", "",
+	"RPMSENSE_RPMLIB", "RPMSENSE_TRIGGERPREIN", "RPMSENSE_KEYRING", "",
+	"RPMSENSE_CONFIG",
+}
+
+//rpmfileNames contains the names of the bits in FILEFLAGS (see
+//rpmfileAttrs_e in /usr/include/rpm/rpmfiles.h), indexed by bit position.
+var rpmfileNames = []string{
+	"RPMFILE_CONFIG", "RPMFILE_DOC", "RPMFILE_ICON", "RPMFILE_MISSINGOK",
+	"RPMFILE_NOREPLACE", "RPMFILE_SPECFILE", "RPMFILE_GHOST", "RPMFILE_LICENSE",
+	"RPMFILE_README", "", "", "RPMFILE_PUBKEY",
+	"RPMFILE_ARTIFACT",
+}
+
+//rpmverifyNames contains the names of the bits in FILEVERIFYFLAGS (see
+//rpmVerifyAttrs_e in /usr/include/rpm/rpmfiles.h), indexed by bit position.
+var rpmverifyNames = []string{
+	"RPMVERIFY_FILEDIGEST", "RPMVERIFY_FILESIZE", "RPMVERIFY_LINKTO", "RPMVERIFY_USER",
+	"RPMVERIFY_GROUP", "RPMVERIFY_MTIME", "RPMVERIFY_MODE", "RPMVERIFY_RDEV",
+	"RPMVERIFY_CAPS",
+}
+
+//pgphashalgoNames contains the names of the digest algorithms (see
+//pgpHashAlgo_e in /usr/include/rpm/rpmpgp.h).
+var pgphashalgoNames = map[int64]string{
+	1:  "PGPHASHALGO_MD5",
+	2:  "PGPHASHALGO_SHA1",
+	3:  "PGPHASHALGO_RIPEMD160",
+	5:  "PGPHASHALGO_MD2",
+	6:  "PGPHASHALGO_TIGER192",
+	7:  "PGPHASHALGO_HAVAL_5_160",
+	8:  "PGPHASHALGO_SHA256",
+	9:  "PGPHASHALGO_SHA384",
+	10: "PGPHASHALGO_SHA512",
+	11: "PGPHASHALGO_SHA224",
+}
+
+//describeBits returns a describer for bitmasks that joins the names of all set
+//bits. Bits without a name are shown in hex.
+func describeBits(names []string, zeroName string) func(int64) string {
+	return func(value int64) string {
+		bits := uint32(value)
+		if bits == 0 {
+			return zeroName
+		}
+		var result []string
+		for idx := uint(0); idx < 32; idx++ {
+			if bits&(1<<idx) == 0 {
+				continue
+			}
+			if int(idx) < len(names) && names[idx] != "" {
+				result = append(result, names[idx])
+			} else {
+				result = append(result, fmt.Sprintf("0x%X", uint32(1)<<idx))
+			}
+		}
+		return strings.Join(result, "|")
+	}
+}
+
+//describeEnum returns a describer for enumerations.
+func describeEnum(names map[int64]string) func(int64) string {
+	return func(value int64) string {
+		if name, exists := names[value]; exists {
+			return name
+		}
+		return "unknown"
+	}
+}
+
+//describeFileMode shows a file mode like ls(1) does.
+func describeFileMode(value int64) string {
+	mode := uint16(value)
+	var typeChar byte
+	switch mode & 0170000 {
+	case 0140000:
+		typeChar = 's'
+	case 0120000:
+		typeChar = 'l'
+	case 0100000:
+		typeChar = '-'
+	case 0060000:
+		typeChar = 'b'
+	case 0040000:
+		typeChar = 'd'
+	case 0020000:
+		typeChar = 'c'
+	case 0010000:
+		typeChar = 'p'
+	default:
+		typeChar = '?'
+	}
+
+	result := []byte{typeChar}
+	for idx, char := range []byte("rwxrwxrwx") {
+		if mode&(0400>>uint(idx)) != 0 {
+			result = append(result, char)
+		} else {
+			result = append(result, '-')
+		}
+	}
+	//setuid, setgid and sticky bits replace the respective "x"
+	for _, special := range []struct {
+		Bit      uint16
+		Position int
+		Char     byte
+	}{{04000, 3, 's'}, {02000, 6, 's'}, {01000, 9, 't'}} {
+		if mode&special.Bit == 0 {
+			continue
+		}
+		if result[special.Position] == 'x' {
+			result[special.Position] = special.Char
+		} else {
+			result[special.Position] = special.Char - 'a' + 'A'
+		}
+	}
+	return string(result)
+}
+
+//annotateRpmFields adds the meaning of values to the descriptions in
+//field.Values where it is not obvious from the value itself: Enum and bitmask
+//values are shown symbolically, and the entries of BASENAMES are shown with
+//their full path (by looking up their directory via DIRINDEXES and
+//DIRNAMES).
+func annotateRpmFields(fields []Field) {
+	fieldsByName := make(map[string]*Field, len(fields))
+	for idx := range fields {
+		field := &fields[idx]
+		fieldsByName[field.TagName] = field
+
+		describe, exists := rpmtagValueDescribers[field.TagName]
+		if !exists || len(field.Integers) != len(field.Values) {
+			continue
+		}
+		for idx, value := range field.Integers {
+			field.Values[idx] += " (" + describe(value) + ")"
+		}
+	}
+
+	basenames := fieldsByName["BASENAMES"]
+	dirIndexes := fieldsByName["DIRINDEXES"]
+	dirNames := fieldsByName["DIRNAMES"]
+	if basenames == nil || dirIndexes == nil || dirNames == nil {
+		return
+	}
+	if len(basenames.Strings) != len(basenames.Values) || len(dirIndexes.Integers) != len(basenames.Strings) {
+		return
+	}
+	for idx, basename := range basenames.Strings {
+		dirIndex := dirIndexes.Integers[idx]
+		if dirIndex < 0 || dirIndex >= int64(len(dirNames.Strings)) {
+			basenames.Values[idx] += " (invalid directory index)"
+			continue
+		}
+		basenames.Values[idx] += " (path: " + path.Join(dirNames.Strings[dirIndex], basename) + ")"
+	}
+}
@@ -0,0 +1,230 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package pkgimport
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/debian"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+	"github.com/holocm/holo-build/pkg/pkgdump"
+)
+
+func importDebian(tree *pkgdump.Tree) (Result, error) {
+	result := Result{Format: "debian", Package: newPackage()}
+	pkg := result.Package
+
+	var controlTar, dataTar *pkgdump.Tree
+	for _, entry := range tree.Entries {
+		switch {
+		case strings.HasPrefix(entry.Name, "control.tar"):
+			controlTar = uncompressed(entry.Content)
+		case strings.HasPrefix(entry.Name, "data.tar"):
+			dataTar = uncompressed(entry.Content)
+		}
+	}
+	if controlTar == nil || controlTar.Format != pkgdump.FormatTar {
+		return result, errors.New("not a Debian package: control.tar not found")
+	}
+	if dataTar == nil || dataTar.Format != pkgdump.FormatTar {
+		return result, errors.New("not a Debian package: data.tar not found")
+	}
+
+	//read control archive
+	hasControlFile := false
+	var conffiles, templates, config string
+	for _, entry := range controlTar.Entries {
+		if entry.Content == nil {
+			continue
+		}
+		content := string(entry.Content.Data)
+		switch strings.TrimPrefix(entry.Name, "./") {
+		case "control":
+			err := readDebianControlFile(pkg, content)
+			if err != nil {
+				return result, err
+			}
+			hasControlFile = true
+		case "preinst":
+			addDebianMaintainerScript(pkg, build.PreSetupAction, content)
+		case "postinst":
+			addDebianMaintainerScript(pkg, build.SetupAction, content)
+		case "postrm":
+			addDebianMaintainerScript(pkg, build.CleanupAction, content)
+		case "prerm":
+			addDebianMaintainerScript(pkg, build.PreCleanupAction, content)
+		case "conffiles":
+			conffiles = content
+		case "templates":
+			templates = content
+		case "config":
+			config = content
+		case "triggers":
+			result.Warnings = append(result.Warnings, "skipping triggers: package triggers cannot be imported")
+		}
+	}
+	if !hasControlFile {
+		return result, errors.New("not a Debian package: control file not found")
+	}
+
+	//these are read after the control file, which resets pkg.Debian
+	pkg.Debian.Templates = strings.TrimSuffix(templates, "\n")
+	pkg.Debian.Config = strings.TrimSuffix(config, "\n")
+
+	//read data archive
+	err := importEntries(pkg, dataTar.Entries, func(string) bool { return false })
+	markImplicitDirectories(pkg.FSRoot)
+	if err == nil {
+		markConffiles(pkg, conffiles)
+	}
+	return result, err
+}
+
+//markConffiles sets the Config flag on the files listed in the conffiles
+//control file.
+func markConffiles(pkg *build.Package, conffiles string) {
+	isConffile := make(map[string]bool)
+	for _, line := range strings.Split(conffiles, "\n") {
+		isConffile[line] = true
+	}
+	pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+		if file, ok := node.(*filesystem.RegularFile); ok && isConffile[path] {
+			file.Config = true
+		}
+		return nil
+	})
+}
+
+func readDebianControlFile(pkg *build.Package, contents string) error {
+	//collect fields (continuation lines start with a space and are only used
+	//for the extended description, which we do not need)
+	fields := make(map[string]string)
+	for _, line := range strings.Split(contents, "\n") {
+		if line == "" || strings.HasPrefix(line, " ") {
+			continue
+		}
+		fieldSplit := strings.SplitN(line, ":", 2)
+		if len(fieldSplit) != 2 {
+			return fmt.Errorf("malformed line in control file: %q", line)
+		}
+		fields[fieldSplit[0]] = strings.TrimSpace(fieldSplit[1])
+	}
+
+	pkg.Name = fields["Package"]
+	pkg.Author = fields["Maintainer"]
+	pkg.Debian = build.DebianOptions{
+		MultiArch: fields["Multi-Arch"],
+		Essential: fields["Essential"] == "yes",
+		Protected: fields["Protected"] == "yes",
+	}
+	//the generator uses the package name as description if there is none
+	if fields["Description"] != pkg.Name {
+		pkg.Description = fields["Description"]
+	}
+	err := setVersion(pkg, fields["Version"], "~")
+	if err != nil {
+		return err
+	}
+	err = setArchitecture(pkg, debian.GeneratorFactory, fields["Architecture"])
+	if err != nil {
+		return err
+	}
+
+	pkg.Requires, err = parseDebianRelations(fields["Depends"])
+	if err != nil {
+		return err
+	}
+	pkg.Provides, err = parseDebianRelations(fields["Provides"])
+	if err != nil {
+		return err
+	}
+	pkg.Conflicts, err = parseDebianRelations(fields["Conflicts"])
+	if err != nil {
+		return err
+	}
+	pkg.Replaces, err = parseDebianRelations(fields["Replaces"])
+	return err
+}
+
+var debianRelationRx = regexp.MustCompile(`^(\S+)(?:\s*\((<<|<=|=|>=|>>)\s*(\S+)\))?$`)
+
+//debianRelationOperators maps Debian's operators to the ones used in
+//build.VersionConstraint.
+var debianRelationOperators = map[string]string{
+	"":   "",
+	"<<": "<",
+	"<=": "<=",
+	"=":  "=",
+	">=": ">=",
+	">>": ">",
+}
+
+//parseDebianRelations parses a relation field like "foo (>= 1.0), bar".
+func parseDebianRelations(field string) ([]build.PackageRelation, error) {
+	if field == "" {
+		return nil, nil
+	}
+
+	var rels []build.PackageRelation
+	for _, entry := range strings.Split(field, ",") {
+		match := debianRelationRx.FindStringSubmatch(strings.TrimSpace(entry))
+		if match == nil {
+			return nil, fmt.Errorf("cannot parse package relation %q", strings.TrimSpace(entry))
+		}
+		rels = addRelation(rels, match[1], debianRelationOperators[match[2]], match[3])
+	}
+	return rels, nil
+}
+
+//debianScriptSkeletonRx matches the skeleton that the generator puts around
+//the actions in a maintainer script (after the shebang line).
+var debianScriptSkeletonRx = regexp.MustCompile(`(?s)^set -e\n\nif \[ "\$1" = [a-z-]+ \](?: \|\| \[ "\$1" = [a-z-]+ \])*; then\n(.*)\nfi\n\nexit 0\n$`)
+
+//addDebianMaintainerScript imports a maintainer script. The generator puts
+//a shebang line in front of each script, which is "#!/bin/bash" unless the
+//actions chose a different interpreter (in packages built by older versions).
+//The skeleton around the actions is removed if the script contains nothing
+//else.
+func addDebianMaintainerScript(pkg *build.Package, actionType uint, content string) {
+	interpreter := ""
+	if strings.HasPrefix(content, "#!") {
+		lineSplit := strings.SplitN(content, "\n", 2)
+		interpreter = strings.TrimSpace(strings.TrimPrefix(lineSplit[0], "#!"))
+		content = ""
+		if len(lineSplit) == 2 {
+			content = lineSplit[1]
+		}
+	}
+	if interpreter == "/bin/bash" {
+		interpreter = ""
+		//if the match contains "fi\n\nif", there are generated snippets after
+		//the actions, so the script cannot be separated reliably
+		match := debianScriptSkeletonRx.FindStringSubmatch(content)
+		if match != nil && !strings.Contains(match[1], "\nfi\n\nif ") {
+			content = match[1]
+		}
+	}
+	addAction(pkg, actionType, content, interpreter)
+}
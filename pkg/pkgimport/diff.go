@@ -0,0 +1,292 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package pkgimport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+)
+
+//Difference describes a property that differs between two packages.
+type Difference struct {
+	//Section is "metadata", "relations", "actions" or "files".
+	Section string
+	//Key identifies the property within its section, e.g. "version",
+	//"requires foo", "setup" or "/etc/foo.conf".
+	Key string
+	//Old and New are the values of the property in the first and second
+	//package. Except for metadata, the value is empty if the property does
+	//not exist in that package.
+	Old, New string
+}
+
+//sections lists the sections of properties in the order in which they are
+//compared.
+var sections = []string{"metadata", "relations", "actions", "files"}
+
+//names for build.Architecture that do not depend on the package format
+var architectureNames = map[build.Architecture]string{
+	build.ArchitectureAny:     "any",
+	build.ArchitectureI386:    "i386",
+	build.ArchitectureX86_64:  "x86_64",
+	build.ArchitectureARMv5:   "armv5",
+	build.ArchitectureARMv6h:  "armv6h",
+	build.ArchitectureARMv7h:  "armv7h",
+	build.ArchitectureAArch64: "aarch64",
+}
+
+var actionNames = map[uint]string{
+	build.SetupAction:           "setup",
+	build.CleanupAction:         "cleanup",
+	build.PreSetupAction:        "pre-setup",
+	build.PreCleanupAction:      "pre-cleanup",
+	build.PreTransactionAction:  "pre-transaction",
+	build.PostTransactionAction: "post-transaction",
+	build.VerifyAction:          "verify",
+}
+
+//Compare compares two packages at the logical level, i.e. independently of
+//their package formats: metadata, relations, actions and the file system
+//(including modes, owners and content hashes). The differences are sorted by
+//section and key.
+func Compare(a, b *build.Package) ([]Difference, error) {
+	propsA, err := properties(a)
+	if err != nil {
+		return nil, err
+	}
+	propsB, err := properties(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []Difference
+	for _, section := range sections {
+		//collect keys from both packages
+		keys := make([]string, 0, len(propsA[section]))
+		for key := range propsA[section] {
+			keys = append(keys, key)
+		}
+		for key := range propsB[section] {
+			if _, exists := propsA[section][key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			oldValue, newValue := propsA[section][key], propsB[section][key]
+			if oldValue != newValue {
+				diffs = append(diffs, Difference{section, key, oldValue, newValue})
+			}
+		}
+	}
+	return diffs, nil
+}
+
+//properties describes the package as a set of key-value pairs per section.
+func properties(pkg *build.Package) (map[string]map[string]string, error) {
+	props := make(map[string]map[string]string, len(sections))
+	for _, section := range sections {
+		props[section] = make(map[string]string)
+	}
+
+	metadata := props["metadata"]
+	metadata["name"] = pkg.Name
+	metadata["version"] = pkg.Version
+	metadata["prerelease"] = ""
+	if pkg.PrereleaseType != build.PrereleaseTypeNone {
+		metadata["prerelease"] = fmt.Sprintf("%s.%d", pkg.PrereleaseType.String(), pkg.PrereleaseVersion)
+	}
+	metadata["release"] = fmt.Sprintf("%d", pkg.Release)
+	metadata["epoch"] = fmt.Sprintf("%d", pkg.Epoch)
+	metadata["architecture"] = architectureNames[pkg.Architecture]
+	metadata["author"] = pkg.Author
+	metadata["description"] = pkg.Description
+	metadata["debian.multiArch"] = pkg.Debian.MultiArch
+	metadata["debian.essential"] = fmt.Sprintf("%t", pkg.Debian.Essential)
+	metadata["debian.protected"] = fmt.Sprintf("%t", pkg.Debian.Protected)
+	metadata["pacman.pkgbase"] = pkg.Pacman.PackageBase
+	metadata["pacman.pkgtype"] = pkg.Pacman.PackageType
+	metadata["pacman.xdata"] = fmt.Sprintf("%t", pkg.Pacman.XData)
+
+	addRelationProperties(props["relations"], "requires", pkg.Requires)
+	addRelationProperties(props["relations"], "provides", pkg.Provides)
+	addRelationProperties(props["relations"], "conflicts", pkg.Conflicts)
+	addRelationProperties(props["relations"], "replaces", pkg.Replaces)
+	addRelationProperties(props["relations"], "supersedes", pkg.Supersedes)
+
+	for actionType, name := range actionNames {
+		if script := pkg.Script(actionType); script != "" {
+			props["actions"][name] = script
+		}
+	}
+
+	err := pkg.WalkFSWithAbsolutePaths(func(path string, node filesystem.Node) error {
+		if path == "/" {
+			return nil
+		}
+		switch n := node.(type) {
+		case *filesystem.Directory:
+			props["files"][path] = "directory " + describeMetadata(n.Metadata)
+		case *filesystem.RegularFile:
+			digests, err := n.Digests()
+			if err != nil {
+				return fmt.Errorf("cannot read %s: %s", path, err.Error())
+			}
+			props["files"][path] = fmt.Sprintf("regular file %s, sha256: %s", describeMetadata(n.Metadata), digests.SHA256)
+		case *filesystem.Symlink:
+			props["files"][path] = "symlink to " + n.Target
+			if n.Metadata.Owner != nil || n.Metadata.Group != nil {
+				props["files"][path] += fmt.Sprintf(" (owner: %s, group: %s)", describeID(n.Metadata.Owner), describeID(n.Metadata.Group))
+			}
+		}
+		return nil
+	})
+	return props, err
+}
+
+func addRelationProperties(props map[string]string, relType string, rels []build.PackageRelation) {
+	for _, rel := range rels {
+		key := relType + " " + rel.RelatedPackage
+		var constraints []string
+		if props[key] != "" && props[key] != "any version" {
+			constraints = []string{props[key]}
+		}
+		for _, c := range rel.Constraints {
+			constraints = append(constraints, c.Relation+" "+c.Version)
+		}
+		if len(constraints) == 0 {
+			props[key] = "any version"
+		} else {
+			props[key] = strings.Join(constraints, ", ")
+		}
+	}
+}
+
+func describeMetadata(m filesystem.NodeMetadata) string {
+	return fmt.Sprintf("(mode: %o, owner: %s, group: %s)", m.Mode, describeID(m.Owner), describeID(m.Group))
+}
+
+func describeID(id *filesystem.IntOrString) string {
+	switch {
+	case id == nil:
+		return "0"
+	case id.Str != "":
+		return id.Str
+	default:
+		return fmt.Sprintf("%d", id.Int)
+	}
+}
+
+//RenderDifferences renders the differences from Compare() in a structured
+//text format, for example:
+//
+//	metadata:
+//	    ~ version: 1.0 -> 1.1
+//	files:
+//	    + /etc/foo.conf: regular file (mode: 644, owner: 0, group: 0), sha256: ...
+//	    - /etc/bar.conf: symlink to foo.conf
+//
+//Multi-line values (i.e. action scripts) are shown as a line-based diff.
+func RenderDifferences(diffs []Difference) string {
+	var lines []string
+	section := ""
+	for _, d := range diffs {
+		if d.Section != section {
+			section = d.Section
+			lines = append(lines, section+":")
+		}
+
+		switch {
+		case strings.Contains(d.Old+d.New, "\n"):
+			marker := "~"
+			switch {
+			case d.Old == "" && d.Section != "metadata":
+				marker = "+"
+			case d.New == "" && d.Section != "metadata":
+				marker = "-"
+			}
+			lines = append(lines, fmt.Sprintf("    %s %s:", marker, d.Key))
+			for _, line := range DiffLines(splitLines(d.Old), splitLines(d.New)) {
+				lines = append(lines, "        "+line)
+			}
+		case d.Section == "metadata":
+			lines = append(lines, fmt.Sprintf("    ~ %s: %q -> %q", d.Key, d.Old, d.New))
+		case d.Old == "":
+			lines = append(lines, fmt.Sprintf("    + %s: %s", d.Key, d.New))
+		case d.New == "":
+			lines = append(lines, fmt.Sprintf("    - %s: %s", d.Key, d.Old))
+		default:
+			lines = append(lines, fmt.Sprintf("    ~ %s: %s -> %s", d.Key, d.Old, d.New))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+//DiffLines computes a line-based diff using the longest common subsequence.
+//Each line of the result is prefixed with "  ", "- " or "+ ".
+func DiffLines(a, b []string) []string {
+	//lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var result []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			result = append(result, "  "+a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			result = append(result, "- "+a[i])
+			i++
+		default:
+			result = append(result, "+ "+b[j])
+			j++
+		}
+	}
+	return result
+}
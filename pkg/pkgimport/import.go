@@ -0,0 +1,273 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+//Package pkgimport reads packages that were generated by holo-build back into
+//a build.Package, e.g. to convert them into a different package format or to
+//compare two packages independently of their package formats.
+//
+//The import is lossy where the package formats are: Maintainer scripts are
+//imported as plain actions (including the snippets that holo-build generated
+//for Holo integration, systemd units or alternatives), owners and groups are
+//imported as numeric IDs, and triggers and pre-removal scripts are skipped
+//with a warning.
+package pkgimport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/filesystem"
+	"github.com/holocm/holo-build/pkg/pkgdump"
+)
+
+//Result is returned by Import().
+type Result struct {
+	//Format is the package format that was recognized ("debian", "pacman"
+	//or "rpm").
+	Format string
+	//Package is the imported package.
+	Package *build.Package
+	//Warnings describes parts of the package that could not be imported.
+	Warnings []string
+}
+
+//Import reads a package that was generated by holo-build. Debian packages,
+//Pacman packages and RPM packages are supported.
+func Import(data []byte) (Result, error) {
+	_, tree, err := pkgdump.Recognize(data)
+	if err != nil {
+		return Result{}, err
+	}
+
+	switch tree.Format {
+	case pkgdump.FormatAr:
+		return importDebian(tree)
+	case pkgdump.FormatRPM:
+		return importRPM(tree)
+	case pkgdump.FormatXZ, pkgdump.FormatZstd:
+		tree = uncompressed(tree)
+		if tree.Format == pkgdump.FormatTar {
+			return importPacman(tree)
+		}
+	}
+	return Result{}, errors.New("not a Debian, Pacman or RPM package")
+}
+
+//newPackage initializes a build.Package like the package definition parser
+//does.
+func newPackage() *build.Package {
+	pkg := &build.Package{
+		Release: 1,
+		Actions: []build.PackageAction{},
+		FSRoot:  filesystem.NewDirectory(),
+	}
+	pkg.FSRoot.Implicit = true
+	return pkg
+}
+
+//uncompressed returns the innermost tree below any compression layers.
+func uncompressed(tree *pkgdump.Tree) *pkgdump.Tree {
+	for tree.Format.IsCompression() && tree.Inner != nil {
+		tree = tree.Inner
+	}
+	return tree
+}
+
+//setVersion fills the version fields of the package from a full version
+//string like "2:1.0~beta.3-1". The separator before the prerelease type is
+//"~" for Debian and RPM, and empty for Pacman.
+func setVersion(pkg *build.Package, version, prereleaseSeparator string) error {
+	rx := regexp.MustCompile(`^(?:(\d+):)?(.+?)(?:` + regexp.QuoteMeta(prereleaseSeparator) + `(alpha|beta)\.(\d+))?-(\d+)$`)
+	match := rx.FindStringSubmatch(version)
+	if match == nil {
+		return fmt.Errorf("cannot parse version %q", version)
+	}
+
+	if match[1] != "" {
+		epoch, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("cannot parse version %q: %s", version, err.Error())
+		}
+		pkg.Epoch = uint(epoch)
+	}
+	pkg.Version = match[2]
+	switch match[3] {
+	case "alpha":
+		pkg.PrereleaseType = build.PrereleaseTypeAlpha
+	case "beta":
+		pkg.PrereleaseType = build.PrereleaseTypeBeta
+	}
+	if match[3] != "" {
+		prereleaseVersion, err := strconv.ParseUint(match[4], 10, 32)
+		if err != nil {
+			return fmt.Errorf("cannot parse version %q: %s", version, err.Error())
+		}
+		pkg.PrereleaseVersion = uint(prereleaseVersion)
+	}
+	release, err := strconv.ParseUint(match[5], 10, 32)
+	if err != nil {
+		return fmt.Errorf("cannot parse version %q: %s", version, err.Error())
+	}
+	pkg.Release = uint(release)
+	return nil
+}
+
+//setArchitecture fills the architecture fields of the package from the
+//format-specific architecture name, as listed by the generator's
+//SupportedArchitectures().
+func setArchitecture(pkg *build.Package, factory build.GeneratorFactory, archName string) error {
+	//if several architectures share a name, choose the first one
+	var candidates []build.Architecture
+	for arch, name := range factory(nil).SupportedArchitectures() {
+		if name == archName {
+			candidates = append(candidates, arch)
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("unknown architecture %q", archName)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+
+	pkg.Architecture = candidates[0]
+	pkg.ArchitectureInput = archName
+	return nil
+}
+
+//addRelation appends a relation to the given list. Consecutive constraints on
+//the same package are merged into one relation, since the generators render
+//each constraint separately.
+func addRelation(rels []build.PackageRelation, name, relation, version string) []build.PackageRelation {
+	if relation == "" {
+		return append(rels, build.PackageRelation{RelatedPackage: name})
+	}
+	constraint := build.VersionConstraint{Relation: relation, Version: version}
+	if len(rels) > 0 {
+		last := &rels[len(rels)-1]
+		if last.RelatedPackage == name && len(last.Constraints) > 0 {
+			last.Constraints = append(last.Constraints, constraint)
+			return rels
+		}
+	}
+	return append(rels, build.PackageRelation{
+		RelatedPackage: name,
+		Constraints:    []build.VersionConstraint{constraint},
+	})
+}
+
+//wrappedScriptRx matches a script that build.Package.Script() has wrapped into
+//a here-document for its interpreter.
+var wrappedScriptRx = regexp.MustCompile(`(?s)^(/\S+) <<'(HOLO_SCRIPT_END_*)'\n(.*)\n(HOLO_SCRIPT_END_*)$`)
+
+//addAction appends an action to the package, unless the script is empty.
+//If the interpreter is the format's default shell, it must be given as "".
+func addAction(pkg *build.Package, actionType uint, script, interpreter string) {
+	script = strings.TrimSpace(script)
+	if script == "" {
+		return
+	}
+	if interpreter == "" {
+		match := wrappedScriptRx.FindStringSubmatch(script)
+		if match != nil && match[2] == match[4] && !strings.Contains(match[3], "\n"+match[2]+"\n") {
+			interpreter, script = match[1], match[3]
+		}
+	}
+	pkg.Actions = append(pkg.Actions, build.PackageAction{
+		Type:        actionType,
+		Content:     script,
+		Interpreter: interpreter,
+	})
+}
+
+//importEntries inserts the entries of an archive into the package's file
+//system. Entries for which skip() returns true are ignored.
+func importEntries(pkg *build.Package, entries []pkgdump.Entry, skip func(path string) bool) error {
+	for _, entry := range entries {
+		//names look like "./etc/foo" or "etc/foo" (with a trailing slash for
+		//directories in tar archives)
+		path := strings.Trim(strings.TrimPrefix(entry.Name, "./"), "/")
+		if path == "" || skip(path) {
+			continue
+		}
+
+		metadata := filesystem.NodeMetadata{Mode: entry.Mode & os.ModePerm}
+		if entry.UID != 0 {
+			metadata.Owner = &filesystem.IntOrString{Int: uint32(entry.UID)}
+		}
+		if entry.GID != 0 {
+			metadata.Group = &filesystem.IntOrString{Int: uint32(entry.GID)}
+		}
+
+		var node filesystem.Node
+		switch entry.Type {
+		case pkgdump.EntryDirectory:
+			node = &filesystem.Directory{
+				Entries:  make(map[string]filesystem.Node),
+				Metadata: metadata,
+			}
+		case pkgdump.EntryRegularFile:
+			var content []byte
+			if entry.Content != nil {
+				content = entry.Content.Data
+			}
+			node = &filesystem.RegularFile{
+				Content:  content,
+				Metadata: metadata,
+			}
+		case pkgdump.EntrySymlink:
+			node = &filesystem.Symlink{
+				Target:   entry.Target,
+				Metadata: metadata,
+			}
+		default:
+			return fmt.Errorf("cannot import /%s: unsupported file type (%s)", path, entry.Type)
+		}
+
+		err := pkg.InsertFSNode("/"+path, node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//markImplicitDirectories marks directories as implicit if they look like
+//holo-build created them to hold other entries (i.e. they are not empty and
+//have the default mode and owner). This is only a guess for package formats
+//that list all directories, like Debian and Pacman. RPM packages do not list
+//implicit directories.
+func markImplicitDirectories(dir *filesystem.Directory) {
+	for _, entry := range dir.Entries {
+		subdir, ok := entry.(*filesystem.Directory)
+		if !ok {
+			continue
+		}
+		markImplicitDirectories(subdir)
+		m := subdir.Metadata
+		if len(subdir.Entries) > 0 && m.Mode == 0755 && m.Owner == nil && m.Group == nil {
+			subdir.Implicit = true
+		}
+	}
+}
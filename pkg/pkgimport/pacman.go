@@ -0,0 +1,173 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package pkgimport
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/pacman"
+	"github.com/holocm/holo-build/pkg/pkgdump"
+)
+
+func importPacman(tree *pkgdump.Tree) (Result, error) {
+	result := Result{Format: "pacman", Package: newPackage()}
+	pkg := result.Package
+
+	//read metadata files
+	hasPKGINFO := false
+	for _, entry := range tree.Entries {
+		if entry.Content == nil {
+			continue
+		}
+		switch entry.Name {
+		case ".PKGINFO":
+			err := readPKGINFO(pkg, string(entry.Content.Data))
+			if err != nil {
+				return result, err
+			}
+			hasPKGINFO = true
+		case ".INSTALL":
+			result.Warnings = append(result.Warnings, readINSTALL(pkg, string(entry.Content.Data))...)
+		}
+	}
+	if !hasPKGINFO {
+		return result, errors.New("not a Pacman package: .PKGINFO not found")
+	}
+
+	//read files (the metadata files are in the top level, and all names in
+	//the top level starting with a dot are reserved for them)
+	err := importEntries(pkg, tree.Entries, func(path string) bool {
+		return strings.HasPrefix(path, ".") && !strings.Contains(path, "/")
+	})
+	markImplicitDirectories(pkg.FSRoot)
+	return result, err
+}
+
+func readPKGINFO(pkg *build.Package, contents string) error {
+	var err error
+	for _, line := range strings.Split(contents, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lineSplit := strings.SplitN(line, " = ", 2)
+		if len(lineSplit) != 2 {
+			return fmt.Errorf("malformed line in .PKGINFO: %q", line)
+		}
+		key, value := lineSplit[0], lineSplit[1]
+
+		switch key {
+		case "pkgname":
+			pkg.Name = value
+		case "pkgbase":
+			pkg.Pacman.PackageBase = value
+		case "xdata":
+			if strings.HasPrefix(value, "pkgtype=") {
+				pkg.Pacman.XData = true
+				pkg.Pacman.PackageType = strings.TrimPrefix(value, "pkgtype=")
+			}
+		case "pkgver":
+			err = setVersion(pkg, value, "")
+		case "pkgdesc":
+			pkg.Description = value
+		case "packager":
+			//the generator uses this placeholder if there is no author
+			if value != "Unknown Packager" {
+				pkg.Author = value
+			}
+		case "arch":
+			err = setArchitecture(pkg, pacman.GeneratorFactory, value)
+		case "depend":
+			pkg.Requires, err = addPacmanRelation(pkg.Requires, value)
+		case "provides":
+			pkg.Provides, err = addPacmanRelation(pkg.Provides, value)
+		case "conflict":
+			pkg.Conflicts, err = addPacmanRelation(pkg.Conflicts, value)
+		case "replaces":
+			pkg.Replaces, err = addPacmanRelation(pkg.Replaces, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	//only keep the pkgbase if it differs from what the generator writes by
+	//default (see pacman.Generator)
+	defaultBase := pkg.Name
+	if pkg.Pacman.PackageType == "debug" {
+		defaultBase = strings.TrimSuffix(pkg.Name, "-debug")
+	}
+	if pkg.Pacman.PackageBase == defaultBase {
+		pkg.Pacman.PackageBase = ""
+	}
+	return nil
+}
+
+var pacmanRelationRx = regexp.MustCompile(`^([^<>=]+)(?:(<=|>=|<|>|=)(.+))?$`)
+
+//addPacmanRelation parses a relation like "foo>=1.0" and appends it to the
+//given list.
+func addPacmanRelation(rels []build.PackageRelation, value string) ([]build.PackageRelation, error) {
+	match := pacmanRelationRx.FindStringSubmatch(value)
+	if match == nil {
+		return nil, fmt.Errorf("cannot parse package relation %q", value)
+	}
+	return addRelation(rels, match[1], match[2], match[3]), nil
+}
+
+var installFunctionRx = regexp.MustCompile(`^([a-z_]+)\(\) \{$`)
+
+//readINSTALL imports the functions in the .INSTALL file as actions. Since
+//scripts may contain lines with a single "}", a function only ends at such a
+//line if the next line starts another function (or there is no next line).
+func readINSTALL(pkg *build.Package, contents string) (warnings []string) {
+	lines := strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+	functions := make(map[string]string)
+	currentFunction := ""
+	var body []string
+	for idx, line := range lines {
+		if currentFunction == "" {
+			match := installFunctionRx.FindStringSubmatch(line)
+			if match != nil {
+				currentFunction = match[1]
+				body = nil
+			}
+			continue
+		}
+		if line == "}" && (idx+1 == len(lines) || installFunctionRx.MatchString(lines[idx+1])) {
+			functions[currentFunction] = strings.Join(body, "\n")
+			currentFunction = ""
+			continue
+		}
+		body = append(body, line)
+	}
+
+	//pre_upgrade and post_upgrade repeat the corresponding install functions
+	//(only systemd units are handled differently on upgrade)
+	addAction(pkg, build.PreSetupAction, functions["pre_install"], "")
+	addAction(pkg, build.SetupAction, functions["post_install"], "")
+	addAction(pkg, build.PreCleanupAction, functions["pre_remove"], "")
+	addAction(pkg, build.CleanupAction, functions["post_remove"], "")
+	return warnings
+}
@@ -0,0 +1,203 @@
+/*******************************************************************************
+*
+* Copyright 2020 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package pkgimport
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/rpm"
+	"github.com/holocm/holo-build/pkg/pkgdump"
+)
+
+//Tags in the RPM header, see [LSB,25.2.4].
+const (
+	rpmtagName                    = 1000
+	rpmtagVersion                 = 1001
+	rpmtagRelease                 = 1002
+	rpmtagEpoch                   = 1003
+	rpmtagDescription             = 1005
+	rpmtagPackager                = 1015
+	rpmtagArch                    = 1022
+	rpmtagPreIn                   = 1023
+	rpmtagPostIn                  = 1024
+	rpmtagPreUn                   = 1025
+	rpmtagPostUn                  = 1026
+	rpmtagProvideName             = 1047
+	rpmtagRequireFlags            = 1048
+	rpmtagRequireName             = 1049
+	rpmtagRequireVersion          = 1050
+	rpmtagConflictFlags           = 1053
+	rpmtagConflictName            = 1054
+	rpmtagConflictVersion         = 1055
+	rpmtagTriggerScripts          = 1065
+	rpmtagVerifyScript            = 1079
+	rpmtagPreInProg               = 1085
+	rpmtagPostInProg              = 1086
+	rpmtagPreUnProg               = 1087
+	rpmtagPostUnProg              = 1088
+	rpmtagObsoleteName            = 1090
+	rpmtagVerifyScriptProg        = 1091
+	rpmtagProvideFlags            = 1112
+	rpmtagProvideVersion          = 1113
+	rpmtagObsoleteFlags           = 1114
+	rpmtagObsoleteVersion         = 1115
+	rpmtagPreTrans                = 1151
+	rpmtagPostTrans               = 1152
+	rpmtagPreTransProg            = 1153
+	rpmtagPostTransProg           = 1154
+	rpmtagTransFileTriggerScripts = 5076
+)
+
+//rpmHeader provides access to the fields of the header section.
+type rpmHeader map[uint32]pkgdump.Field
+
+func (h rpmHeader) String(tag uint32) string {
+	if len(h[tag].Strings) == 0 {
+		return ""
+	}
+	return h[tag].Strings[0]
+}
+
+func importRPM(tree *pkgdump.Tree) (Result, error) {
+	result := Result{Format: "rpm", Package: newPackage()}
+	pkg := result.Package
+
+	h := make(rpmHeader)
+	for _, section := range tree.Sections {
+		if section.Name != "header" {
+			continue
+		}
+		for _, field := range section.Fields {
+			h[field.Tag] = field
+		}
+	}
+	if h.String(rpmtagName) == "" {
+		return result, errors.New("not an RPM package: NAME tag not found")
+	}
+
+	//read metadata
+	pkg.Name = h.String(rpmtagName)
+	pkg.Description = h.String(rpmtagDescription)
+	pkg.Author = h.String(rpmtagPackager)
+	version := h.String(rpmtagVersion) + "-" + h.String(rpmtagRelease)
+	if epochs := h[rpmtagEpoch].Integers; len(epochs) > 0 {
+		version = fmt.Sprintf("%d:%s", epochs[0], version)
+	}
+	err := setVersion(pkg, version, "~")
+	if err != nil {
+		return result, err
+	}
+	err = setArchitecture(pkg, rpm.GeneratorFactory, h.String(rpmtagArch))
+	if err != nil {
+		return result, err
+	}
+
+	//read relations
+	pkg.Requires, err = h.Relations(rpmtagRequireName, rpmtagRequireFlags, rpmtagRequireVersion)
+	if err != nil {
+		return result, err
+	}
+	pkg.Provides, err = h.Relations(rpmtagProvideName, rpmtagProvideFlags, rpmtagProvideVersion)
+	if err != nil {
+		return result, err
+	}
+	pkg.Conflicts, err = h.Relations(rpmtagConflictName, rpmtagConflictFlags, rpmtagConflictVersion)
+	if err != nil {
+		return result, err
+	}
+	pkg.Replaces, err = h.Relations(rpmtagObsoleteName, rpmtagObsoleteFlags, rpmtagObsoleteVersion)
+	if err != nil {
+		return result, err
+	}
+
+	//read scripts
+	h.AddAction(pkg, build.PreSetupAction, rpmtagPreIn, rpmtagPreInProg)
+	h.AddAction(pkg, build.SetupAction, rpmtagPostIn, rpmtagPostInProg)
+	h.AddAction(pkg, build.PreCleanupAction, rpmtagPreUn, rpmtagPreUnProg)
+	h.AddAction(pkg, build.CleanupAction, rpmtagPostUn, rpmtagPostUnProg)
+	h.AddAction(pkg, build.PreTransactionAction, rpmtagPreTrans, rpmtagPreTransProg)
+	h.AddAction(pkg, build.PostTransactionAction, rpmtagPostTrans, rpmtagPostTransProg)
+	h.AddAction(pkg, build.VerifyAction, rpmtagVerifyScript, rpmtagVerifyScriptProg)
+	if len(h[rpmtagTriggerScripts].Strings) > 0 || len(h[rpmtagTransFileTriggerScripts].Strings) > 0 {
+		result.Warnings = append(result.Warnings, "skipping triggers: package triggers cannot be imported")
+	}
+
+	//read payload
+	payload := tree.Inner
+	if payload != nil {
+		payload = uncompressed(payload)
+	}
+	if payload == nil || payload.Format != pkgdump.FormatCpio {
+		return result, errors.New("not an RPM package: cpio payload not found")
+	}
+	err = importEntries(pkg, payload.Entries, func(string) bool { return false })
+	return result, err
+}
+
+//rpmRelationOperators maps the comparison bits of the RPMSENSE flags (LESS =
+//0x02, GREATER = 0x04, EQUAL = 0x08) to the operators used in
+//build.VersionConstraint.
+var rpmRelationOperators = map[int64]string{
+	0x00: "",
+	0x02: "<",
+	0x0A: "<=",
+	0x08: "=",
+	0x0C: ">=",
+	0x04: ">",
+}
+
+//Relations reads relations from RPM's multi-array format, skipping the
+//"rpmlib(...)" pseudo-dependencies.
+func (h rpmHeader) Relations(namesTag, flagsTag, versionsTag uint32) ([]build.PackageRelation, error) {
+	names := h[namesTag].Strings
+	flags := h[flagsTag].Integers
+	versions := h[versionsTag].Strings
+	if len(flags) != len(names) || len(versions) != len(names) {
+		return nil, fmt.Errorf("mismatching number of entries in %s, %s and %s",
+			h[namesTag].TagName, h[flagsTag].TagName, h[versionsTag].TagName)
+	}
+
+	var rels []build.PackageRelation
+	for idx, name := range names {
+		if strings.HasPrefix(name, "rpmlib(") {
+			continue
+		}
+		relation, ok := rpmRelationOperators[flags[idx]&0x0E]
+		if !ok {
+			return nil, fmt.Errorf("cannot parse flags of package relation %q: 0x%X", name, flags[idx])
+		}
+		rels = addRelation(rels, name, relation, versions[idx])
+	}
+	return rels, nil
+}
+
+//AddAction imports a script and its interpreter, which is /bin/sh by
+//default.
+func (h rpmHeader) AddAction(pkg *build.Package, actionType uint, scriptTag, progTag uint32) {
+	interpreter := h.String(progTag)
+	if interpreter == "/bin/sh" {
+		interpreter = ""
+	}
+	addAction(pkg, actionType, h.String(scriptTag), interpreter)
+}
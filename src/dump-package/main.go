@@ -20,14 +20,16 @@
 
 package main
 
-// #include <locale.h>
-import "C"
 import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"strings"
 
-	"github.com/holocm/holo-build/src/dump-package/impl"
+	"github.com/holocm/holo-build/pkg/pkgdump"
+	"github.com/holocm/holo-build/pkg/pkgimport"
+	"github.com/ogier/pflag"
 )
 
 //This program is used by the holo-build tests to extract generated packages and render
@@ -48,17 +50,61 @@ import (
 //                Hello World!
 //            >> foo/baz is symlink to bar
 //
-//The program is deliberately written very generically so as to make it easy to
-//add support for new package formats in the future (when holo-build gains new
-//generators).
+//The actual work is done by the pkgdump package, which can also be used to
+//inspect packages programmatically.
+//
+//For large packages, the output can be reduced with the following options
+//(see pkgdump.DumpOptions for details):
+//
+//    --max-depth N     only decode N levels of compression, archives and packages
+//    --paths GLOB      only show archive entries matching GLOB (can be given multiple times)
+//    --no-content      do not show the contents of regular files
+//    --summary         only show the size and number of entries of each level
+//
+//With `--redact-restricted`, the contents of regular files that are not
+//readable by other users (e.g. files declared with `sensitive = true` in
+//holo-build) are not shown. Only their size and checksum are shown.
+//
+//With `--diff`, two packages built by holo-build (possibly in different
+//package formats) are compared at the logical level instead:
+//
+//    ./build/dump-package --diff $old_package $new_package
+//
+//Like diff(1), the exit code is 0 if the packages are equivalent, 1 if they
+//differ, and 2 if they could not be read.
 
 func main() {
-	//Holo requires a neutral locale, esp. for deterministic sorting of file paths
-	lcAll := C.int(0)
-	C.setlocale(lcAll, C.CString("C"))
+	if len(os.Args) > 1 && os.Args[1] == "--diff" {
+		os.Exit(diffPackages(os.Args[2:]))
+	}
 
 	//check arguments
-	withChecksums := len(os.Args) > 1 && os.Args[1] == "--with-checksums"
+	var opts pkgdump.DumpOptions
+	var paths stringList
+	pflag.BoolVar(&opts.WithChecksums, "with-checksums", false, "Show the SHA-256 checksum of each piece of data")
+	pflag.IntVar(&opts.MaxDepth, "max-depth", 0, "Only decode this many levels of compression, archives and packages (0 = no limit)")
+	pflag.Var(&paths, "paths", "Only show archive entries matching this glob pattern, or below a directory matching it (can be given multiple times)")
+	pflag.BoolVar(&opts.NoContent, "no-content", false, "Do not show the contents of regular files (except for nested archives)")
+	pflag.BoolVar(&opts.RedactRestricted, "redact-restricted", false, "Only show the size and checksum of regular files that are not readable by other users")
+	summary := pflag.Bool("summary", false, "Only show the size and number of entries of each level")
+	pflag.Parse()
+	opts.Paths = paths
+
+	if opts.MaxDepth < 0 {
+		fmt.Fprintln(os.Stderr, "--max-depth may not be negative")
+		os.Exit(1)
+	}
+	for _, pattern := range opts.Paths {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid pattern for --paths: %q\n", pattern)
+			os.Exit(1)
+		}
+	}
+	if pflag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: dump-package [options] < <package>")
+		os.Exit(1)
+	}
 
 	//read the input from stdin
 	data, err := ioutil.ReadAll(os.Stdin)
@@ -68,10 +114,59 @@ func main() {
 	}
 
 	//recognize the input, while deconstructing it recursively
-	dump, err := impl.RecognizeAndDump(data, withChecksums)
+	_, tree, err := pkgdump.Recognize(data)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
-	fmt.Println(dump)
+	if *summary {
+		fmt.Print(tree.Summary(opts))
+	} else {
+		fmt.Println(tree.DumpWithOptions(opts))
+	}
+}
+
+//stringList is a pflag.Value for options that can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func diffPackages(fileNames []string) int {
+	if len(fileNames) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: dump-package --diff <old-package> <new-package>")
+		return 2
+	}
+
+	var results []pkgimport.Result
+	for _, fileName := range fileNames {
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 2
+		}
+		result, err := pkgimport.Import(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot import %s: %s\n", fileName, err.Error())
+			return 2
+		}
+		results = append(results, result)
+	}
+
+	diffs, err := pkgimport.Compare(results[0].Package, results[1].Package)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	if len(diffs) == 0 {
+		return 0
+	}
+	fmt.Println(pkgimport.RenderDifferences(diffs))
+	return 1
 }
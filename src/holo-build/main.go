@@ -21,140 +21,387 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
-	"path/filepath"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 
-	build "github.com/holocm/libpackagebuild"
-	"github.com/holocm/libpackagebuild/debian"
-	"github.com/holocm/libpackagebuild/pacman"
-	"github.com/holocm/libpackagebuild/rpm"
+	"github.com/holocm/holo-build/pkg/holobuild"
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+	"github.com/holocm/holo-build/pkg/libpackagebuild/pacman"
 	"github.com/ogier/pflag"
 )
 
 type options struct {
-	generatorFactory build.GeneratorFactory
-	inputFileName    string //or "" for stdin
-	outputFileName   string //or "" for automatic or "-" for stdout
-	filenameOnly     bool
-	withForce        bool
+	formatName     string
+	archName       string   //or "" for the architecture from the package definition
+	inputFileNames []string //or empty for stdin
+	baseDirectory  string   //or "" for the directory of the input file
+	convert        bool     //if inputFileNames contains a package to convert
+	outputFileName string   //or "" for automatic or "-" for stdout
+	filenameOnly   bool
+	filenameFormat string //or "" for the plain filename
+	validateOnly   bool
+	planOnly       bool
+	fromPlan       *build.Plan //or nil for the plan computed from the package definition
+	withForce      bool
+	outputMode     os.FileMode //or 0 for holobuild.DefaultOutputMode
+	atomicWrite    bool
+	ifChanged      bool
+	outputByDigest bool
+	pathPrefix     string //or "" for no relocation
+	checkOutput    bool
+	repoDirectory  string //or "" for no repository
+	jobs           int
+	verbose        bool
+	progressFormat string //or "" for no progress output
+	errorFormat    string //or "" for human-readable error messages
+	pacmanGroupDB  string //or "" to resolve package groups with pacman
+	execAfter      []string
+	checksums      []string
+	provenance     bool
+	cacheDirectory string //or "" for no build cache
+	sizeReport     bool
+	repoMetadata   bool
+	allowExec      bool
+	allowNetwork   bool
+	quiet          bool
+	holoPlugins    []string //in addition to holobuild.KnownHoloPlugins
+	defines        map[string]string
+	normalizeHolo  bool
+	versionFromGit bool
+	inputSHA256    string //or "" for no checksum verification
+	signCommand    string //or "" for unsigned packages
+	hologramProv   bool
 }
 
+//Exit codes of holo-build (see "EXIT STATUS" in the man page).
+const (
+	exitSuccess         = 0
+	exitDefinitionError = 1 //package definition could not be parsed
+	exitBuildError      = 2 //package could not be built (or other errors)
+	exitValidationError = 3 //package definition is not valid for the selected format
+	exitWriteError      = 4 //package could not be written
+	exitNothingToDo     = 5 //package file already existed with identical contents
+	exitCheckError      = 6 //package does not satisfy a [[check]] section
+	exitArgumentError   = 64
+)
+
+//sha256Rx matches the checksums accepted by --input-sha256.
+var sha256Rx = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+//stringList is a pflag.Value for options that can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+//quiet is set by --quiet to suppress warnings and informational messages.
+var quiet bool
+
 var opts = parseArgs()
 
 func main() {
-	//read package definition from stdin
-	input := io.Reader(os.Stdin)
-	baseDirectory := "."
-	if opts.inputFileName != "" {
-		var err error
-		input, err = os.Open(opts.inputFileName)
-		if err != nil {
-			showError(err)
-			os.Exit(1)
-		}
-		baseDirectory = filepath.Dir(opts.inputFileName)
+	//read package definition from stdin, unless a file is given
+	var (
+		input                    io.Reader
+		inputFileName            string
+		additionalInputFileNames []string
+	)
+	if len(opts.inputFileNames) == 0 {
+		input = os.Stdin
+	} else {
+		inputFileName = opts.inputFileNames[0]
+		additionalInputFileNames = opts.inputFileNames[1:]
 	}
-	pkg, errs := ParsePackageDefinition(input, baseDirectory)
 
-	//initialize generator
-	generator := opts.generatorFactory(pkg)
+	runOpts := holobuild.Options{
+		Format:         opts.formatName,
+		Architecture:   opts.archName,
+		Input:          input,
+		InputFileName:  inputFileName,
+		OutputFileName: opts.outputFileName,
+		FilenameOnly:   opts.filenameOnly,
+		ValidateOnly:   opts.validateOnly,
+		PlanOnly:       opts.planOnly,
+		Plan:           opts.fromPlan,
+		Force:          opts.withForce,
+		OutputMode:     opts.outputMode,
+		AtomicWrite:    opts.atomicWrite,
+		IfChanged:      opts.ifChanged,
+		OutputByDigest: opts.outputByDigest,
+		PathPrefix:     opts.pathPrefix,
+		CheckOutput:    opts.checkOutput,
+		Jobs:           opts.jobs,
 
-	//try to validate package
-	var validateErrs []error
-	if pkg != nil {
-		validateErrs = generator.Validate()
+		RepositoryDirectory:      opts.repoDirectory,
+		AdditionalInputFileNames: additionalInputFileNames,
+		BaseDirectory:            opts.baseDirectory,
+		PacmanGroupDatabase:      opts.pacmanGroupDB,
+		ExecAfter:                opts.execAfter,
+		Checksums:                opts.checksums,
+		Provenance:               opts.provenance,
+		BuilderVersion:           VersionString(),
+		CacheDirectory:           opts.cacheDirectory,
+		AllowExec:                opts.allowExec,
+		AllowNetwork:             opts.allowNetwork,
+		HoloPlugins:              opts.holoPlugins,
+		Defines:                  opts.defines,
+		NormalizeHoloResources:   opts.normalizeHolo,
+		VersionFromGit:           opts.versionFromGit,
+		InputSHA256:              opts.inputSHA256,
+		SignCommand:              opts.signCommand,
+		HologramProvides:         opts.hologramProv,
 	}
-	errs = append(errs, validateErrs...)
-
-	//did that go wrong?
-	if len(errs) > 0 {
-		for _, err := range errs {
-			showError(err)
+	switch {
+	case opts.verbose:
+		runOpts.Progress = holobuild.NewVerboseReporter(os.Stderr)
+	case opts.progressFormat == "json":
+		runOpts.Progress = holobuild.NewJSONProgressReporter(os.Stderr)
+	}
+	var (
+		results []holobuild.Result
+		err     error
+	)
+	switch {
+	case opts.convert:
+		var result holobuild.Result
+		result, err = holobuild.Convert(runOpts)
+		results = []holobuild.Result{result}
+	case opts.formatName == "all":
+		var warnings []string
+		warnings, err = holobuild.ValidateAllFormats(runOpts)
+		for _, warning := range warnings {
+			showWarning(warning)
 		}
-		os.Exit(1)
+	case opts.archName == "all-supported":
+		results, err = holobuild.RunAllArchitectures(runOpts)
+	default:
+		var result holobuild.Result
+		result, err = holobuild.Run(runOpts)
+		results = []holobuild.Result{result}
 	}
 
-	//print filename instead of building package, if requested
-	pkgFile := generator.RecommendedFileName()
-	if opts.filenameOnly {
-		fmt.Println(pkgFile)
-		return
-	}
-	if opts.outputFileName != "" {
-		if opts.outputFileName == "-" {
-			pkgFile = "-"
-		} else {
-			//use opts.outputFileName directly if a file, or choose it inside there if a directory
-			fi, err := os.Stat(opts.outputFileName)
-			if err == nil && fi.Mode().IsDir() {
-				pkgFile = filepath.Join(opts.outputFileName, pkgFile)
+	for _, result := range results {
+		for _, warning := range result.Warnings {
+			showWarning(warning)
+		}
+		//print filename instead of building package, if requested
+		if opts.filenameOnly && err == nil {
+			printFileName(result)
+		}
+		//print plan instead of building package, if requested
+		if opts.planOnly && err == nil {
+			printPlan(result)
+		}
+		//print size report after building package (even if the package is too
+		//large, since that is when the report is most useful)
+		if opts.sizeReport && result.Contents != nil {
+			fmt.Printf("size report for %s:\n%s", result.FileName, holobuild.NewSizeReport(result, 10))
+		}
+		//print repository metadata as derived from the package file
+		if opts.repoMetadata && result.Contents != nil && err == nil {
+			metadata, metadataErr := holobuild.RepositoryMetadata(result.Contents, result.FileName)
+			if metadataErr != nil {
+				err = metadataErr
 			} else {
-				pkgFile = opts.outputFileName
+				fmt.Print(metadata)
 			}
 		}
+		//print checksums in the format of `sha256sum --tag`
+		if opts.quiet {
+			continue
+		}
+		for _, checksum := range result.Checksums {
+			fmt.Printf("%s (%s) = %s\n", checksum.Tag, result.FileName, checksum.Digest)
+		}
 	}
-
-	//build package
-	DoMagicalHoloIntegration(pkg)
-	pkgBytes, err := generator.Build()
 	if err != nil {
-		showErrorMsg("cannot build %s: %s", pkgFile, err.Error())
-		os.Exit(2)
+		//did the package definition contain errors?
+		if defErr, ok := err.(holobuild.DefinitionError); ok {
+			reportErrors(defErr.Errors, opts.errorFormat)
+			if defErr.Validation {
+				os.Exit(exitValidationError)
+			}
+			os.Exit(exitDefinitionError)
+		}
+		//or did the package fail its checks?
+		if checkErr, ok := err.(holobuild.CheckError); ok {
+			reportErrors(checkErr.Failures, opts.errorFormat)
+			os.Exit(exitCheckError)
+		}
+		//or did the build fail?
+		reportErrors([]error{err}, opts.errorFormat)
+		var groupErr *pacman.GroupResolutionError
+		if errors.As(err, &groupErr) && groupErr.PacmanMissing {
+			showErrorMsg("To build Pacman packages with package group requirements without pacman, use --pacman-group-db.")
+		}
+		var writeErr holobuild.WriteError
+		if errors.As(err, &writeErr) {
+			os.Exit(exitWriteError)
+		}
+		os.Exit(exitBuildError)
 	}
 
-	wasWritten, err := WriteOutput(pkgBytes, pkgFile, opts.withForce)
-	if err != nil {
-		showErrorMsg("cannot write %s: %s", pkgFile, err.Error())
-		os.Exit(2)
+	if nothingWritten(results) {
+		os.Exit(exitNothingToDo)
 	}
+	os.Exit(exitSuccess)
+}
 
-	if !wasWritten {
-		os.Exit(0)
+//nothingWritten returns true if packages were built, but none of them was
+//written because each package file already existed with identical contents.
+//With --if-changed, this is not reported.
+func nothingWritten(results []holobuild.Result) bool {
+	if opts.filenameOnly || opts.validateOnly || opts.planOnly || opts.ifChanged || opts.outputFileName == "-" || len(results) == 0 {
+		return false
 	}
-
-	//TODO: more stuff coming
+	for _, result := range results {
+		if result.WasWritten {
+			return false
+		}
+	}
+	return true
 }
 
 func parseArgs() options {
 	//TODO: remove everything that is flagged as deprecated
 	withForce := pflag.BoolP("force", "f", false, "Overwrite existing output file")
-	formatString := pflag.String("format", "", "Output file format (\"debian\", \"pacman\" or \"rpm\")")
+	formatString := pflag.String("format", "", "Output file format (\"debian\", \"pacman\", \"rpm\", \"freebsd\", \"oci-layer\", \"tar\", \"makeself\" or \"nix\", or \"all\" with --validate)")
 	formatDebian := pflag.Bool("debian", false, "Generate Debian package (deprecated, use \"--format debian\" instead)")
 	formatPacman := pflag.Bool("pacman", false, "Generate Pacman package (deprecated, use \"--format pacman\" instead)")
 	formatRPM := pflag.Bool("rpm", false, "Generate RPM package (deprecated, use \"--format rpm\" instead)")
+	archName := pflag.String("arch", "", "Override the architecture from the package definition (or \"all-supported\" to build for each architecture)")
 	outputFileName := pflag.StringP("output", "o", "", "Output file name (or \"-\" for standard output)")
+	outputModeString := pflag.String("output-mode", "", "Mode of the package file and the files written next to it, as an octal number (default \"0644\", regardless of the umask)")
+	atomicWrite := pflag.Bool("atomic-write", false, "Write the package into a temporary file first and rename it afterwards, so that no truncated package is left behind if holo-build is interrupted")
+	ifChanged := pflag.Bool("if-changed", false, "Overwrite an existing output file if its contents differ, but leave it untouched (and exit with status 0) if they are identical")
+	outputByDigest := pflag.Bool("output-by-digest", false, "Name the package file after the SHA-256 digest of its contents (for content-addressed artifact stores)")
 	outputStdout := pflag.Bool("stdout", false, "Write package to standard output (deprecated, use \"-o -\" instead)")
 	noOutputStdout := pflag.Bool("no-stdout", false, "Revert --stdout (deprecated, use \"-o\" instead)")
 	reproducible := pflag.Bool("reproducible", false, "Deprecated, no effect")
 	noReproducible := pflag.Bool("no-reproducible", false, "Deprecated, no effect")
 	suggestFileName := pflag.Bool("suggest-filename", false, "Only print the suggested filename for this package")
+	filenameFormat := pflag.String("filename-format", "", "Print the suggested filename in a machine-readable format (\"json\", requires --suggest-filename)")
+	validateOnly := pflag.Bool("validate", false, "Only check the package definition for errors, without building the package")
+	planOnly := pflag.Bool("plan", false, "Only print a description of the package's archive members and metadata (as JSON), without building the package")
+	fromPlanFileName := pflag.String("from-plan", "", "Build the package from this plan (as printed by --plan, possibly with changes) instead of the plan computed from the package definition")
+	pathPrefix := pflag.String("prefix", "", "Relocate all files in the package below this absolute path")
+	checkOutput := pflag.Bool("check-output", false, "Check the action scripts with \"sh -n\" and the generated package with native tools (if installed)")
+	repoDirectory := pflag.String("repo", "", "Place the package in this local repository and update its index")
+	jobs := pflag.IntP("jobs", "j", 1, "Number of threads for reading files and for xz compression (the package is the same for all values greater than 1)")
+	verbose := pflag.BoolP("verbose", "v", false, "Report each phase of the build with timings and file counts on standard error")
+	progressFormat := pflag.String("progress", "", "Report each phase of the build on standard error in a machine-readable format (\"json\")")
+	errorFormat := pflag.String("error-format", "", "Report errors on standard error in a machine-readable format (\"json\")")
+	pacmanGroupDB := pflag.String("pacman-group-db", "", "Resolve package groups for Pacman packages from this file (in the format of \"pacman -Sg\") instead of calling pacman")
+	emitChecksums := pflag.String("emit-checksums", "", "Write checksum files next to the package (comma-separated list of \"sha256\", \"md5\" and \"b2\")")
+	provenance := pflag.Bool("provenance", false, "Write a provenance attestation (in-toto statement with SLSA provenance) next to the package")
+	signCommand := pflag.String("sign-cmd", "", "Sign the package with this shell command, which reads the package (or the header of an RPM package) on standard input and prints the signature")
+	cacheDirectory := pflag.String("cache-dir", "", "Reuse packages from this directory if the package definition and all files referenced by it are unchanged, and cache newly built packages there")
+	sizeReport := pflag.Bool("print-size-report", false, "Print the installed size and file size of the package, and its largest files")
+	repoMetadata := pflag.Bool("print-repo-metadata", false, "Print the entry that a repository index would contain for the package (Debian, Pacman and RPM only)")
+	baseDirectory := pflag.String("base-dir", "", "Resolve relative paths in the package definition (contentFrom, include etc.) relative to this directory instead of the directory of the package definition")
+	allowExec := pflag.Bool("allow-exec", false, "Allow [[file]] sections to generate their content with contentFromCommand")
+	allowNetwork := pflag.Bool("allow-network", false, "Allow contentFrom in [[file]] sections to refer to an HTTP(S) URL")
+	pflag.BoolVarP(&quiet, "quiet", "q", false, "Do not show warnings and informational messages (errors are still shown)")
+	var execAfter stringList
+	pflag.Var(&execAfter, "exec-after", "Run this shell command after the package has been written, with \"{}\" replaced by its path (can be given multiple times)")
+	var holoPlugins stringList
+	pflag.Var(&holoPlugins, "holo-plugin", "Do not warn about files below /usr/share/holo for this Holo plugin ID (can be given multiple times)")
+	var defineArgs stringList
+	pflag.Var(&defineArgs, "define", "Define a variable for \"when\" conditions in the package definition, as NAME=VALUE (can be given multiple times)")
+	hologramProvides := pflag.Bool("hologram-provides", false, "Add a virtual Provides entry like \"hologram(name) = version\" to the package (like hologramProvides in the package definition)")
+	normalizeHolo := pflag.Bool("normalize-holo-resources", false, "Make all files and directories below /usr/share/holo owned by root:root with mode 0644 (or 0755 for directories and executables)")
+	inputSHA256 := pflag.String("input-sha256", "", "Fail if the SHA-256 checksum of the package definition (e.g. when fetched from a URL) does not match this one")
+	versionFromGit := pflag.Bool("version-from-git", false, "Derive version, prerelease version and release from \"git describe\" in the repository containing the package definition")
+	noAutodetect := pflag.Bool("no-autodetect", false, "Do not choose the package format for the current distribution if --format is not given")
 	showVersion := pflag.BoolP("version", "V", false, "Show program version")
+	explainSchema := pflag.Bool("explain-schema", false, "Show the accepted format of package definitions")
+	checkInstalled := pflag.Bool("installed", false, "With \"check-conflicts\", also check for conflicts with installed packages (in the package database for --format)")
+	updateGolden := pflag.Bool("update-golden", false, "With \"self-test\", write the golden files instead of comparing against them")
+	migrate := pflag.Bool("migrate", false, "Rewrite the given package definitions to replace deprecated keys, and show the changes")
 
 	pflag.Parse()
 
 	if *noOutputStdout {
-		showErrorMsg("--no-stdout is deprecated - use \"--output ''\" instead")
+		showDeprecationMsg("--no-stdout is deprecated - use \"--output ''\" instead")
 		*outputStdout = false
 	}
 	if *noReproducible {
-		showErrorMsg("--no-reproducible is deprecated and can safely be removed")
+		showDeprecationMsg("--no-reproducible is deprecated and can safely be removed")
 		*reproducible = false
 	}
 
 	if *showVersion {
-		fmt.Println(VersionString())
-		os.Exit(0)
+		printVersion()
+		os.Exit(exitSuccess)
+	}
+
+	if *explainSchema {
+		err := holobuild.ExplainSchema(os.Stdout)
+		if err != nil {
+			showError(err)
+			os.Exit(exitBuildError)
+		}
+		os.Exit(exitSuccess)
+	}
+
+	if *migrate {
+		os.Exit(migrateDefinitions(pflag.Args()))
+	}
+
+	defines, ok := parseDefines(defineArgs)
+	if !ok {
+		os.Exit(exitArgumentError)
+	}
+
+	//"holo-build check-conflicts a.pkg.toml b.deb" checks for file conflicts
+	//between packages instead of building one
+	if args := pflag.Args(); len(args) > 0 && args[0] == "check-conflicts" {
+		if *checkInstalled && *formatString == "" && !*noAutodetect {
+			var err error
+			*formatString, err = holobuild.DetectFormat()
+			if err != nil {
+				showError(err)
+				os.Exit(exitArgumentError)
+			}
+		}
+		os.Exit(checkConflicts(args[1:], *checkInstalled, *formatString, *archName, defines))
+	}
+	if *checkInstalled {
+		showErrorMsg("--installed can only be used with \"check-conflicts\"")
+		os.Exit(exitArgumentError)
+	}
+
+	//"holo-build self-test test/compiler" builds test cases and compares the
+	//results against their golden files
+	if args := pflag.Args(); len(args) > 0 && args[0] == "self-test" {
+		os.Exit(selfTest(args[1:], *updateGolden, *formatString))
+	}
+	if *updateGolden {
+		showErrorMsg("--update-golden can only be used with \"self-test\"")
+		os.Exit(exitArgumentError)
 	}
 
 	if *reproducible {
-		showErrorMsg("--reproducible is deprecated and can safely be removed")
+		showDeprecationMsg("--reproducible is deprecated and can safely be removed")
 	}
 
 	var hasArgsError bool
 	if *outputStdout {
-		showErrorMsg("--stdout is deprecated - use \"--output -\" instead")
+		showDeprecationMsg("--stdout is deprecated - use \"--output -\" instead")
 		if *outputFileName != "" {
 			showErrorMsg("--output and --stdout may not be used at the same time")
 			hasArgsError = true
@@ -164,21 +411,21 @@ func parseArgs() options {
 
 	switch {
 	case *formatDebian:
-		showErrorMsg("--debian is deprecated - use \"--format debian\" instead")
+		showDeprecationMsg("--debian is deprecated - use \"--format debian\" instead")
 		if *formatString != "" {
 			showErrorMsg("--debian and --format may not be used at the same time")
 			hasArgsError = true
 		}
 		*formatString = "debian"
 	case *formatPacman:
-		showErrorMsg("--pacman is deprecated - use \"--format pacman\" instead")
+		showDeprecationMsg("--pacman is deprecated - use \"--format pacman\" instead")
 		if *formatString != "" {
 			showErrorMsg("--pacman and --format may not be used at the same time")
 			hasArgsError = true
 		}
 		*formatString = "pacman"
 	case *formatRPM:
-		showErrorMsg("--rpm is deprecated - use \"--format rpm\" instead")
+		showDeprecationMsg("--rpm is deprecated - use \"--format rpm\" instead")
 		if *formatString != "" {
 			showErrorMsg("--rpm and --format may not be used at the same time")
 			hasArgsError = true
@@ -186,42 +433,628 @@ func parseArgs() options {
 		*formatString = "rpm"
 	}
 
-	var generatorFactory build.GeneratorFactory
-	switch *formatString {
-	case "debian":
-		generatorFactory = debian.GeneratorFactory
-	case "pacman":
-		generatorFactory = pacman.GeneratorFactory
-	case "rpm":
-		generatorFactory = rpm.GeneratorFactory
-	case "":
-		showErrorMsg("No package format specified. Use the wrapper script at /usr/bin/holo-build to autoselect a package format.")
-		hasArgsError = true
-	default:
+	if *formatString == "" && !*noAutodetect {
+		var err error
+		*formatString, err = holobuild.DetectFormat()
+		if err != nil {
+			showError(err)
+			hasArgsError = true
+		}
+	}
+
+	switch {
+	case *formatString == "":
+		if !hasArgsError {
+			showErrorMsg("No package format specified.")
+			hasArgsError = true
+		}
+	case *formatString == "all":
+		if !*validateOnly {
+			showErrorMsg("--format=all can only be used with --validate")
+			hasArgsError = true
+		}
+		if *archName == "all-supported" {
+			showErrorMsg("--format=all and --arch=all-supported may not be used at the same time")
+			hasArgsError = true
+		}
+	case holobuild.GeneratorFactoryFor(*formatString) == nil:
 		showErrorMsg("Invalid package format: '%s'", *formatString)
 		hasArgsError = true
 	}
 
-	var inputFileName string
-	switch len(pflag.Args()) {
-	case 0:
-		inputFileName = "" //use stdin
-	case 1:
-		inputFileName = pflag.Arg(0)
-	default:
-		showErrorMsg("Multiple input files specified.")
+	if *pathPrefix != "" {
+		switch {
+		case !strings.HasPrefix(*pathPrefix, "/"):
+			showErrorMsg("Invalid prefix '%s': must be an absolute path", *pathPrefix)
+			hasArgsError = true
+		case path.Clean(*pathPrefix) != *pathPrefix:
+			showErrorMsg("Invalid prefix '%s': must not contain trailing slashes, \".\" or \"..\"", *pathPrefix)
+			hasArgsError = true
+		}
+	}
+
+	if *baseDirectory != "" {
+		fi, err := os.Stat(*baseDirectory)
+		switch {
+		case err != nil:
+			showErrorMsg("Invalid base directory '%s': %s", *baseDirectory, err.Error())
+			hasArgsError = true
+		case !fi.IsDir():
+			showErrorMsg("Invalid base directory '%s': not a directory", *baseDirectory)
+			hasArgsError = true
+		}
+	}
+
+	if *repoDirectory != "" && *outputFileName != "" {
+		showErrorMsg("--output and --repo may not be used at the same time")
+		hasArgsError = true
+	}
+
+	if *validateOnly {
+		switch {
+		case *suggestFileName:
+			showErrorMsg("--validate and --suggest-filename may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName != "":
+			showErrorMsg("--validate and --output may not be used at the same time")
+			hasArgsError = true
+		case *repoDirectory != "":
+			showErrorMsg("--validate and --repo may not be used at the same time")
+			hasArgsError = true
+		}
+	}
+
+	if *planOnly {
+		switch {
+		case *validateOnly:
+			showErrorMsg("--validate and --plan may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --plan may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName != "":
+			showErrorMsg("--plan and --output may not be used at the same time")
+			hasArgsError = true
+		case *repoDirectory != "":
+			showErrorMsg("--plan and --repo may not be used at the same time")
+			hasArgsError = true
+		case *emitChecksums != "" || *provenance || len(execAfter) > 0:
+			showErrorMsg("--plan may not be used with --emit-checksums, --provenance or --exec-after")
+			hasArgsError = true
+		}
+	}
+
+	var fromPlan *build.Plan
+	if *fromPlanFileName != "" {
+		switch {
+		case *validateOnly:
+			showErrorMsg("--validate and --from-plan may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --from-plan may not be used at the same time")
+			hasArgsError = true
+		case *planOnly:
+			showErrorMsg("--plan and --from-plan may not be used at the same time")
+			hasArgsError = true
+		case *cacheDirectory != "":
+			showErrorMsg("--cache-dir and --from-plan may not be used at the same time")
+			hasArgsError = true
+		case *archName == "all-supported":
+			showErrorMsg("--arch=all-supported and --from-plan may not be used at the same time")
+			hasArgsError = true
+		default:
+			var err error
+			fromPlan, err = readPlan(*fromPlanFileName)
+			if err != nil {
+				showErrorMsg("Invalid plan in --from-plan=%s: %s", *fromPlanFileName, err.Error())
+				hasArgsError = true
+			}
+		}
+	}
+
+	if *sizeReport {
+		switch {
+		case *validateOnly:
+			showErrorMsg("--validate and --print-size-report may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --print-size-report may not be used at the same time")
+			hasArgsError = true
+		case *planOnly:
+			showErrorMsg("--plan and --print-size-report may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName == "-":
+			showErrorMsg("--print-size-report may not be used when writing the package to standard output")
+			hasArgsError = true
+		}
+	}
+
+	if *repoMetadata {
+		switch {
+		case *validateOnly:
+			showErrorMsg("--validate and --print-repo-metadata may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --print-repo-metadata may not be used at the same time")
+			hasArgsError = true
+		case *planOnly:
+			showErrorMsg("--plan and --print-repo-metadata may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName == "-":
+			showErrorMsg("--print-repo-metadata may not be used when writing the package to standard output")
+			hasArgsError = true
+		}
+	}
+
+	var checksums []string
+	if *emitChecksums != "" {
+		checksums = strings.Split(*emitChecksums, ",")
+		err := holobuild.ValidateChecksumAlgorithms(checksums)
+		switch {
+		case err != nil:
+			showErrorMsg("Invalid checksum algorithm in --emit-checksums=%s (must be \"sha256\", \"md5\" or \"b2\")", *emitChecksums)
+			hasArgsError = true
+		case *validateOnly:
+			showErrorMsg("--validate and --emit-checksums may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --emit-checksums may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName == "-":
+			showErrorMsg("--emit-checksums may not be used when writing the package to standard output")
+			hasArgsError = true
+		}
+	}
+
+	if *provenance {
+		switch {
+		case *validateOnly:
+			showErrorMsg("--validate and --provenance may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --provenance may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName == "-":
+			showErrorMsg("--provenance may not be used when writing the package to standard output")
+			hasArgsError = true
+		}
+	}
+
+	if len(execAfter) > 0 {
+		switch {
+		case *validateOnly:
+			showErrorMsg("--validate and --exec-after may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --exec-after may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName == "-":
+			showErrorMsg("--exec-after may not be used when writing the package to standard output")
+			hasArgsError = true
+		}
+	}
+
+	if *signCommand != "" {
+		switch {
+		case *validateOnly:
+			showErrorMsg("--validate and --sign-cmd may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --sign-cmd may not be used at the same time")
+			hasArgsError = true
+		case *planOnly:
+			showErrorMsg("--plan and --sign-cmd may not be used at the same time")
+			hasArgsError = true
+		}
+	}
+
+	var outputMode os.FileMode
+	if *outputModeString != "" {
+		mode, err := strconv.ParseUint(*outputModeString, 8, 32)
+		switch {
+		case err != nil || mode > 0777:
+			showErrorMsg("Invalid mode in --output-mode=%s (must be an octal number like 0644)", *outputModeString)
+			hasArgsError = true
+		case *validateOnly:
+			showErrorMsg("--validate and --output-mode may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --output-mode may not be used at the same time")
+			hasArgsError = true
+		case *planOnly:
+			showErrorMsg("--plan and --output-mode may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName == "-":
+			showErrorMsg("--output-mode may not be used when writing the package to standard output")
+			hasArgsError = true
+		}
+		outputMode = os.FileMode(mode)
+	}
+
+	if *atomicWrite {
+		switch {
+		case *validateOnly:
+			showErrorMsg("--validate and --atomic-write may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --atomic-write may not be used at the same time")
+			hasArgsError = true
+		case *planOnly:
+			showErrorMsg("--plan and --atomic-write may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName == "-":
+			showErrorMsg("--atomic-write may not be used when writing the package to standard output")
+			hasArgsError = true
+		}
+	}
+
+	if *ifChanged {
+		switch {
+		case *withForce:
+			showErrorMsg("--force and --if-changed may not be used at the same time")
+			hasArgsError = true
+		case *validateOnly:
+			showErrorMsg("--validate and --if-changed may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --if-changed may not be used at the same time")
+			hasArgsError = true
+		case *planOnly:
+			showErrorMsg("--plan and --if-changed may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName == "-":
+			showErrorMsg("--if-changed may not be used when writing the package to standard output")
+			hasArgsError = true
+		}
+	}
+
+	if *outputByDigest {
+		switch {
+		case *validateOnly:
+			showErrorMsg("--validate and --output-by-digest may not be used at the same time")
+			hasArgsError = true
+		case *suggestFileName:
+			showErrorMsg("--suggest-filename and --output-by-digest may not be used at the same time")
+			hasArgsError = true
+		case *planOnly:
+			showErrorMsg("--plan and --output-by-digest may not be used at the same time")
+			hasArgsError = true
+		case *repoDirectory != "":
+			showErrorMsg("--repo and --output-by-digest may not be used at the same time")
+			hasArgsError = true
+		case *outputFileName == "-":
+			showErrorMsg("--output-by-digest may not be used when writing the package to standard output")
+			hasArgsError = true
+		}
+	}
+
+	for _, pluginID := range holoPlugins {
+		if pluginID == "" || strings.ContainsAny(pluginID, "/ ") {
+			showErrorMsg("Invalid Holo plugin ID: '%s'", pluginID)
+			hasArgsError = true
+		}
+	}
+
+	if *jobs < 1 {
+		showErrorMsg("Invalid number of jobs: %d", *jobs)
+		hasArgsError = true
+	}
+
+	switch {
+	case *progressFormat != "" && *progressFormat != "json":
+		showErrorMsg("Invalid progress format: '%s'", *progressFormat)
+		hasArgsError = true
+	case *progressFormat != "" && *verbose:
+		showErrorMsg("--progress and --verbose may not be used at the same time")
+		hasArgsError = true
+	}
+	switch {
+	case *filenameFormat != "" && *filenameFormat != "json":
+		showErrorMsg("Invalid filename format: '%s'", *filenameFormat)
 		hasArgsError = true
+	case *filenameFormat != "" && !*suggestFileName:
+		showErrorMsg("--filename-format can only be used with --suggest-filename")
+		hasArgsError = true
+	}
+	if *errorFormat != "" && *errorFormat != "json" {
+		showErrorMsg("Invalid error format: '%s'", *errorFormat)
+		hasArgsError = true
+	}
+
+	//"holo-build convert foo.deb" converts an existing package instead of
+	//building one from a package definition
+	inputFileNames := pflag.Args() //multiple input files are merged into one package
+	convert := len(inputFileNames) > 0 && inputFileNames[0] == "convert"
+	if convert {
+		inputFileNames = inputFileNames[1:]
+		switch {
+		case len(inputFileNames) != 1:
+			showErrorMsg("\"convert\" needs exactly one package file")
+			hasArgsError = true
+		case *formatString == "all" || *validateOnly:
+			showErrorMsg("--validate may not be used with \"convert\"")
+			hasArgsError = true
+		case *archName == "all-supported":
+			showErrorMsg("--arch=all-supported may not be used with \"convert\"")
+			hasArgsError = true
+		case *baseDirectory != "":
+			showErrorMsg("--base-dir may not be used with \"convert\"")
+			hasArgsError = true
+		case *versionFromGit:
+			showErrorMsg("--version-from-git may not be used with \"convert\"")
+			hasArgsError = true
+		case *inputSHA256 != "":
+			showErrorMsg("--input-sha256 may not be used with \"convert\"")
+			hasArgsError = true
+		case *fromPlanFileName != "":
+			showErrorMsg("--from-plan may not be used with \"convert\"")
+			hasArgsError = true
+		}
+	}
+	if *inputSHA256 != "" {
+		switch {
+		case !sha256Rx.MatchString(*inputSHA256):
+			showErrorMsg("Invalid checksum in --input-sha256=%s (must be 64 hexadecimal digits)", *inputSHA256)
+			hasArgsError = true
+		case len(inputFileNames) > 1:
+			showErrorMsg("--input-sha256 may not be used with multiple input files")
+			hasArgsError = true
+		}
 	}
 
 	if hasArgsError {
-		os.Exit(1)
+		os.Exit(exitArgumentError)
 	}
 	return options{
-		generatorFactory: generatorFactory,
-		inputFileName:    inputFileName,
-		outputFileName:   *outputFileName,
-		filenameOnly:     *suggestFileName,
-		withForce:        *withForce,
+		formatName:     *formatString,
+		archName:       *archName,
+		inputFileNames: inputFileNames,
+		baseDirectory:  *baseDirectory,
+		convert:        convert,
+		outputFileName: *outputFileName,
+		filenameOnly:   *suggestFileName,
+		filenameFormat: *filenameFormat,
+		validateOnly:   *validateOnly,
+		planOnly:       *planOnly,
+		fromPlan:       fromPlan,
+		withForce:      *withForce,
+		outputMode:     outputMode,
+		atomicWrite:    *atomicWrite,
+		ifChanged:      *ifChanged,
+		outputByDigest: *outputByDigest,
+		pathPrefix:     *pathPrefix,
+		checkOutput:    *checkOutput,
+		repoDirectory:  *repoDirectory,
+		jobs:           *jobs,
+		verbose:        *verbose,
+		progressFormat: *progressFormat,
+		errorFormat:    *errorFormat,
+		pacmanGroupDB:  *pacmanGroupDB,
+		execAfter:      execAfter,
+		checksums:      checksums,
+		provenance:     *provenance,
+		cacheDirectory: *cacheDirectory,
+		sizeReport:     *sizeReport,
+		repoMetadata:   *repoMetadata,
+		allowExec:      *allowExec,
+		allowNetwork:   *allowNetwork,
+		quiet:          quiet,
+		holoPlugins:    holoPlugins,
+		defines:        defines,
+		normalizeHolo:  *normalizeHolo,
+		versionFromGit: *versionFromGit,
+		inputSHA256:    *inputSHA256,
+		signCommand:    *signCommand,
+		hologramProv:   *hologramProvides,
+	}
+}
+
+//parseDefines parses the arguments of --define. Errors are reported on
+//stderr, in which case false is returned.
+func parseDefines(args []string) (map[string]string, bool) {
+	defines := make(map[string]string, len(args))
+	ok := true
+	for _, arg := range args {
+		idx := strings.IndexByte(arg, '=')
+		if idx < 0 {
+			showErrorMsg("Invalid argument for --define: '%s' (must look like NAME=VALUE)", arg)
+			ok = false
+			continue
+		}
+		name := arg[:idx]
+		if err := holobuild.ValidateDefineName(name); err != nil {
+			showError(err)
+			ok = false
+			continue
+		}
+		if _, exists := defines[name]; exists {
+			showErrorMsg("Variable '%s' is given more than once in --define", name)
+			ok = false
+			continue
+		}
+		defines[name] = arg[idx+1:]
+	}
+	return defines, ok
+}
+
+//migrateDefinitions implements `--migrate`. Each given package definition is
+//rewritten in place, and the changes are shown as a unified diff. A package
+//definition from standard input is written to standard output after migration.
+//Returns the exit code.
+func migrateDefinitions(fileNames []string) int {
+	if len(fileNames) == 0 {
+		blob, err := ioutil.ReadAll(os.Stdin)
+		if err == nil {
+			blob, err = migrateDefinition(blob)
+		}
+		if err == nil {
+			_, err = os.Stdout.Write(blob)
+		}
+		if err != nil {
+			showError(err)
+			return 1
+		}
+		return 0
+	}
+
+	exitCode := 0
+	for _, fileName := range fileNames {
+		err := migrateDefinitionFile(fileName)
+		if err != nil {
+			showError(err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+func migrateDefinitionFile(fileName string) error {
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	blob, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	newBlob, err := migrateDefinition(blob)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fileName, err.Error())
+	}
+	if string(newBlob) == string(blob) {
+		return nil
+	}
+
+	err = ioutil.WriteFile(fileName, newBlob, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Println(holobuild.RenderMigrationDiff(fileName, blob, newBlob))
+	}
+	return nil
+}
+
+func migrateDefinition(blob []byte) ([]byte, error) {
+	newBlob, warnings, err := holobuild.MigrateDefinition(blob)
+	for _, warning := range warnings {
+		showWarning(warning)
+	}
+	return newBlob, err
+}
+
+//checkConflicts implements `holo-build check-conflicts`. The paths that are
+//claimed by more than one package are printed on stdout. Returns the exit code.
+func checkConflicts(fileNames []string, withInstalled bool, format, arch string, defines map[string]string) int {
+	switch {
+	case len(fileNames) == 0:
+		showErrorMsg("\"check-conflicts\" needs at least one package definition or package file")
+		return exitArgumentError
+	case arch == "all-supported":
+		showErrorMsg("--arch=all-supported may not be used with \"check-conflicts\"")
+		return exitArgumentError
+	case withInstalled && format == "":
+		showErrorMsg("No package format specified.")
+		return exitArgumentError
+	}
+
+	var (
+		candidates []holobuild.ConflictCandidate
+		hasErrors  bool
+	)
+	for _, fileName := range fileNames {
+		candidate, errs := holobuild.ReadConflictCandidate(fileName, holobuild.ParseOptions{Architecture: arch, Format: format, Defines: defines})
+		for _, err := range errs {
+			showErrorMsg("%s: %s", fileName, err.Error())
+			hasErrors = true
+		}
+		if len(errs) == 0 {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if hasErrors {
+		return exitDefinitionError
+	}
+
+	conflicts := holobuild.CheckConflicts(candidates)
+	if withInstalled {
+		installedConflicts, err := holobuild.CheckInstalledConflicts(candidates, format)
+		if err != nil {
+			showError(err)
+			return exitBuildError
+		}
+		conflicts = append(conflicts, installedConflicts...)
+	}
+	for _, conflict := range conflicts {
+		fmt.Println(conflict.String())
+	}
+	if len(conflicts) > 0 {
+		return exitValidationError
+	}
+	return exitSuccess
+}
+
+//printFileName prints the suggested filename for the given Result, either
+//plainly or as a JSON object with `--filename-format=json`. For example:
+//
+//	{"filename":"foo_1.0-1_all.deb","name":"foo","version":"1.0-1","arch":"all","extension":".deb"}
+func printFileName(result holobuild.Result) {
+	if opts.filenameFormat != "json" {
+		fmt.Println(result.FileName)
+		return
+	}
+
+	json.NewEncoder(os.Stdout).Encode(struct {
+		FileName string `json:"filename"`
+		build.FileNameComponents
+	}{result.FileName, result.FileNameComponents})
+}
+
+//printPlan prints the plan for the given Result as an indented JSON object
+//(see build.Plan).
+//readPlan reads a plan (as printed by printPlan) from the given file.
+func readPlan(fileName string) (*build.Plan, error) {
+	buf, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var plan build.Plan
+	err = json.Unmarshal(buf, &plan)
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func printPlan(result holobuild.Result) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(result.Plan)
+}
+
+//reportErrors shows the given errors either as human-readable messages, or
+//as one JSON object per line with `--error-format=json`. For example:
+//
+//	{"field":"package.name","severity":"error","message":"Package name \"foo bar\" is not acceptable for Debian packages","format":"Debian"}
+//
+//Errors that are not a *build.ValidationError only have a severity and a
+//message in JSON.
+func reportErrors(errs []error, errorFormat string) {
+	if errorFormat != "json" {
+		for _, err := range errs {
+			showError(err)
+		}
+		return
+	}
+
+	enc := json.NewEncoder(os.Stderr)
+	for _, err := range errs {
+		valErr, ok := err.(*build.ValidationError)
+		if !ok {
+			valErr = &build.ValidationError{Message: err.Error()}
+		}
+		enc.Encode(valErr)
 	}
 }
 
@@ -229,6 +1062,21 @@ func showError(err error) {
 	showErrorMsg(err.Error())
 }
 
+//showDeprecationMsg is like showErrorMsg, but for messages about deprecated
+//options, which are not errors and are therefore suppressed by --quiet.
+func showDeprecationMsg(msg string) {
+	if !quiet {
+		showErrorMsg(msg)
+	}
+}
+
+//showWarning prints a warning message on stderr, unless --quiet was given.
+func showWarning(msg string) {
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "\x1b[33m\x1b[1m>>\x1b[0m %s\n", msg)
+	}
+}
+
 func showErrorMsg(msg string, args ...interface{}) {
 	if len(args) > 0 {
 		msg = fmt.Sprintf(msg, args...)
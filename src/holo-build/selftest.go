@@ -0,0 +1,350 @@
+/*******************************************************************************
+*
+* Copyright 2015 Stefan Majewsky <majewsky@gmx.net>
+*
+* This file is part of Holo.
+*
+* Holo is free software: you can redistribute it and/or modify it under the
+* terms of the GNU General Public License as published by the Free Software
+* Foundation, either version 3 of the License, or (at your option) any later
+* version.
+*
+* Holo is distributed in the hope that it will be useful, but WITHOUT ANY
+* WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR
+* A PARTICULAR PURPOSE. See the GNU General Public License for more details.
+*
+* You should have received a copy of the GNU General Public License along with
+* Holo. If not, see <http://www.gnu.org/licenses/>.
+*
+*******************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/holocm/holo-build/pkg/holobuild"
+	"github.com/holocm/holo-build/pkg/pkgdump"
+	"github.com/holocm/holo-build/pkg/pkgimport"
+)
+
+//This file implements `holo-build self-test`, which builds test cases like
+//the ones in test/compiler/ and compares the results against their golden
+//files. A test case is a directory containing an input.toml, and the golden
+//files next to it are (with FORMAT being one of holobuild.Formats):
+//
+//    expected-suggested-filenames   "FORMAT: filename" for each tested format
+//    expected-FORMAT-output         the package, as shown by dump-package
+//    expected-FORMAT-error-output   the error output of holo-build
+//    expected-FORMAT-plan           the output of `holo-build --plan` (optional)
+//
+//Plans are only compared and updated in the test cases that already have a
+//golden file for them. To add one, create it as an empty file and run with
+//--update-golden.
+//
+//The test cases are built by running this executable in a subprocess (with
+//HOLO_MOCK=1 and the test case directory as working directory), so that the
+//error output is exactly what a user would see.
+
+//ansiColorRx matches the color codes in the error output of holo-build.
+var ansiColorRx = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+//selfTestCase is a test case for `holo-build self-test`.
+type selfTestCase struct {
+	Name      string
+	Directory string
+	//Formats contains the formats that are covered by golden files.
+	Formats []string
+}
+
+//selfTest implements `holo-build self-test`. If `format` is not empty, only
+//this format is tested. Returns the exit code.
+func selfTest(dirNames []string, updateGolden bool, format string) int {
+	switch {
+	case len(dirNames) == 0:
+		showErrorMsg("\"self-test\" needs at least one directory containing test cases")
+		return exitArgumentError
+	case format != "" && holobuild.GeneratorFactoryFor(format) == nil:
+		showErrorMsg("Invalid package format: '%s'", format)
+		return exitArgumentError
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		showError(err)
+		return exitBuildError
+	}
+
+	var testCases []selfTestCase
+	for _, dirName := range dirNames {
+		found, err := findSelfTestCases(dirName)
+		if err != nil {
+			showError(err)
+			return exitBuildError
+		}
+		testCases = append(testCases, found...)
+	}
+
+	hasDeviations := false
+	uncovered := make(map[string]int)
+	for _, tc := range testCases {
+		//choose formats: when updating, new test cases are covered for all
+		//formats, and --format adds a format to existing test cases
+		formats := tc.Formats
+		switch {
+		case format != "" && updateGolden:
+			formats = []string{format}
+		case format != "":
+			formats = nil
+			if hasFormat(tc.Formats, format) {
+				formats = []string{format}
+			}
+		case updateGolden && len(formats) == 0:
+			formats = holobuild.Formats
+		}
+		for _, f := range holobuild.Formats {
+			if !updateGolden && !hasFormat(formats, f) && (format == "" || format == f) {
+				uncovered[f]++
+			}
+		}
+		if len(formats) == 0 {
+			continue
+		}
+
+		outputs, err := runSelfTestCase(executable, tc, formats)
+		if err != nil {
+			showError(err)
+			return exitBuildError
+		}
+		if !updateGolden {
+			//with --format, only the suggested filename for that format is
+			//compared
+			buf, _ := ioutil.ReadFile(filepath.Join(tc.Directory, "expected-suggested-filenames"))
+			expectedFileNames := string(buf)
+			if format != "" {
+				outputs["suggested-filenames"] = filterSuggestedFilenames(outputs["suggested-filenames"], formats)
+				expectedFileNames = filterSuggestedFilenames(expectedFileNames, formats)
+			}
+			for _, name := range sortedKeys(outputs) {
+				expected := expectedFileNames
+				if name != "suggested-filenames" {
+					buf, _ := ioutil.ReadFile(filepath.Join(tc.Directory, "expected-"+name))
+					expected = string(buf)
+				}
+				if outputs[name] == expected {
+					continue
+				}
+				hasDeviations = true
+				fmt.Printf("%s: %s deviates from expected-%s:\n", tc.Name, name, name)
+				for _, line := range trimDiffContext(pkgimport.DiffLines(splitGoldenLines(expected), splitGoldenLines(outputs[name])), 3) {
+					fmt.Println("    " + line)
+				}
+			}
+			continue
+		}
+
+		for _, name := range sortedKeys(outputs) {
+			path := filepath.Join(tc.Directory, "expected-"+name)
+			old, err := ioutil.ReadFile(path)
+			if err == nil && string(old) == outputs[name] {
+				continue
+			}
+			err = ioutil.WriteFile(path, []byte(outputs[name]), 0644)
+			if err != nil {
+				showError(err)
+				return exitWriteError
+			}
+			fmt.Printf("%s: updated expected-%s\n", tc.Name, name)
+		}
+	}
+
+	for _, f := range holobuild.Formats {
+		if uncovered[f] > 0 {
+			showWarning(fmt.Sprintf("%d test case(s) have no golden files for format %q (use --update-golden --format=%s to create them)", uncovered[f], f, f))
+		}
+	}
+	if hasDeviations {
+		return exitValidationError
+	}
+	return exitSuccess
+}
+
+//findSelfTestCases returns the test cases in the given directory, or the
+//directory itself if it contains an input.toml.
+func findSelfTestCases(dirName string) ([]selfTestCase, error) {
+	candidates := []string{dirName}
+	if _, err := os.Stat(filepath.Join(dirName, "input.toml")); err != nil {
+		fis, err := ioutil.ReadDir(dirName)
+		if err != nil {
+			return nil, err
+		}
+		candidates = nil
+		for _, fi := range fis {
+			if fi.IsDir() {
+				candidates = append(candidates, filepath.Join(dirName, fi.Name()))
+			}
+		}
+	}
+
+	var result []selfTestCase
+	for _, dir := range candidates {
+		if _, err := os.Stat(filepath.Join(dir, "input.toml")); err != nil {
+			continue
+		}
+		tc := selfTestCase{Name: filepath.Base(filepath.Clean(dir)), Directory: dir}
+		for _, f := range holobuild.Formats {
+			if _, err := os.Stat(filepath.Join(dir, "expected-"+f+"-output")); err == nil {
+				tc.Formats = append(tc.Formats, f)
+			}
+		}
+		result = append(result, tc)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no test cases found in %s (test cases are directories containing an input.toml)", dirName)
+	}
+	return result, nil
+}
+
+//runSelfTestCase builds the given test case for each of the given formats,
+//and returns the contents of the golden files, indexed by their name without
+//the "expected-" prefix. The suggested filenames are returned for all formats
+//that are covered by golden files after the update.
+func runSelfTestCase(executable string, tc selfTestCase, formats []string) (map[string]string, error) {
+	input, err := ioutil.ReadFile(filepath.Join(tc.Directory, "input.toml"))
+	if err != nil {
+		return nil, err
+	}
+	run := func(args ...string) (stdout, stderr []byte, err error) {
+		var outBuf, errBuf bytes.Buffer
+		cmd := exec.Command(executable, args...)
+		cmd.Dir = tc.Directory
+		cmd.Env = append(os.Environ(), "HOLO_MOCK=1")
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stdout = &outBuf
+		cmd.Stderr = &errBuf
+		err = cmd.Run()
+		//a failing build is part of the expected output; only report errors
+		//that prevented holo-build from running at all
+		if _, ok := err.(*exec.ExitError); ok {
+			err = nil
+		}
+		return outBuf.Bytes(), errBuf.Bytes(), err
+	}
+
+	outputs := make(map[string]string)
+	var fileNames []string
+	for _, f := range holobuild.Formats {
+		if !hasFormat(formats, f) && !hasFormat(tc.Formats, f) {
+			continue
+		}
+		stdout, _, err := run("--suggest-filename", "--format="+f)
+		if err != nil {
+			return nil, err
+		}
+		fileName := strings.TrimSpace(string(stdout))
+		if fileName == "" {
+			fileName = "no output"
+		}
+		fileNames = append(fileNames, fmt.Sprintf("%s: %s\n", f, fileName))
+
+		if !hasFormat(formats, f) {
+			continue
+		}
+		stdout, stderr, err := run("-o", "-", "--format="+f)
+		if err != nil {
+			return nil, err
+		}
+		outputs[f+"-output"] = dumpForSelfTest(stdout)
+		outputs[f+"-error-output"] = ansiColorRx.ReplaceAllString(string(stderr), "")
+
+		if _, err := os.Stat(filepath.Join(tc.Directory, "expected-"+f+"-plan")); err == nil {
+			stdout, _, err := run("--plan", "--format="+f)
+			if err != nil {
+				return nil, err
+			}
+			outputs[f+"-plan"] = string(stdout)
+		}
+	}
+	outputs["suggested-filenames"] = strings.Join(fileNames, "")
+	return outputs, nil
+}
+
+//dumpForSelfTest renders the package like dump-package does.
+func dumpForSelfTest(data []byte) string {
+	_, tree, err := pkgdump.Recognize(data)
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	return tree.DumpWithOptions(pkgdump.DumpOptions{}) + "\n"
+}
+
+//filterSuggestedFilenames restricts the contents of a suggested-filenames
+//golden file to the lines for the given formats.
+func filterSuggestedFilenames(contents string, formats []string) string {
+	var result []string
+	for _, line := range splitGoldenLines(contents) {
+		f := strings.SplitN(line, ":", 2)[0]
+		if hasFormat(formats, f) {
+			result = append(result, line+"\n")
+		}
+	}
+	return strings.Join(result, "")
+}
+
+//trimDiffContext removes unchanged lines from the output of
+//pkgimport.DiffLines that are more than `context` lines away from a change.
+func trimDiffContext(lines []string, context int) []string {
+	keep := make([]bool, len(lines))
+	for idx, line := range lines {
+		if strings.HasPrefix(line, "  ") {
+			continue
+		}
+		for offset := -context; offset <= context; offset++ {
+			if idx+offset >= 0 && idx+offset < len(lines) {
+				keep[idx+offset] = true
+			}
+		}
+	}
+	var result []string
+	for idx, line := range lines {
+		switch {
+		case keep[idx]:
+			result = append(result, line)
+		case idx == 0 || keep[idx-1]:
+			result = append(result, "  ...")
+		}
+	}
+	return result
+}
+
+func splitGoldenLines(contents string) []string {
+	if contents == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+}
+
+func hasFormat(formats []string, format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
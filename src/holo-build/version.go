@@ -20,10 +20,54 @@
 
 package main
 
-//this is populated at compile time, see Makefile
-var version string
+import (
+	"fmt"
+	"strings"
 
-//VersionString returns the version string for holo-build.
+	"github.com/holocm/holo-build/pkg/holobuild"
+	build "github.com/holocm/holo-build/pkg/libpackagebuild"
+)
+
+//VersionString returns the version string for holo-build, or an empty string
+//if it is not known.
 func VersionString() string {
-	return version
+	return build.Version()
+}
+
+//printVersion implements --version. After the version string, the optional
+//features of each package format are listed like this:
+//
+//	debian: compression=gzip,xz,zstd actions triggers services alternatives
+func printVersion() {
+	version := VersionString()
+	if version == "" {
+		version = "unknown"
+	}
+	fmt.Println(version)
+	for _, format := range holobuild.SupportedFormats() {
+		caps, err := holobuild.Capabilities(format)
+		if err != nil {
+			fmt.Printf("%s:\n", format)
+			continue
+		}
+		var features []string
+		if len(caps.Compressions) > 0 {
+			features = append(features, "compression="+strings.Join(caps.Compressions, ","))
+		}
+		for _, feature := range []struct {
+			Name      string
+			Supported bool
+		}{
+			{"actions", caps.Actions},
+			{"triggers", caps.Triggers},
+			{"services", caps.Services},
+			{"alternatives", caps.Alternatives},
+			{"embedded-signature", caps.EmbeddedSignature},
+		} {
+			if feature.Supported {
+				features = append(features, feature.Name)
+			}
+		}
+		fmt.Printf("%s: %s\n", format, strings.Join(features, " "))
+	}
 }
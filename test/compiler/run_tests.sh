@@ -3,6 +3,12 @@
 # find the directory containing the test cases
 TESTS_DIR="$(readlink -f "$(dirname $0)")"
 
+# every testcase must have golden files for these generators...
+REQUIRED_GENERATORS="debian pacman rpm"
+# ...while these are only checked in the testcases that have golden files for
+# them (see `holo-build self-test`)
+OPTIONAL_GENERATORS="freebsd oci-layer tar makeself nix"
+
 run_testcase() {
     local TEST_NAME="$1"
     echo ">> Running compiler testcase $TEST_NAME..."
@@ -20,12 +26,21 @@ run_testcase() {
     export HOLO_MOCK=1
 
     # run test for all available generators
+    local EXIT_CODE=0
     local FILES_TO_DIFF="suggested-filenames"
     rm -f -- suggested-filenames
-    for GENERATOR in debian pacman rpm; do
+    for GENERATOR in $REQUIRED_GENERATORS; do
+        if [ ! -f expected-$GENERATOR-output ]; then
+            echo "!! Missing expected-$GENERATOR-output (use \`holo-build self-test --update-golden --format=$GENERATOR\` to create it)"
+            EXIT_CODE=1
+        fi
+    done
+    for GENERATOR in $REQUIRED_GENERATORS $OPTIONAL_GENERATORS; do
+        [ -f expected-$GENERATOR-output ] || continue
+
         # check suggested filename
         (
-            FILENAME="$(../../../build/holo-build --suggest-filename --$GENERATOR < input.toml 2>/dev/null)"
+            FILENAME="$(../../../build/holo-build --suggest-filename --format=$GENERATOR < input.toml 2>/dev/null)"
             echo "$GENERATOR: ${FILENAME:-no output}"
         ) >> suggested-filenames
 
@@ -39,10 +54,16 @@ run_testcase() {
 
         # remember output files
         FILES_TO_DIFF="$FILES_TO_DIFF $GENERATOR-error-output $GENERATOR-output"
+
+        # if the testcase has a golden file for the plan, check the output of
+        # `holo-build --plan` as well
+        if [ -f expected-$GENERATOR-plan ]; then
+            ../../../build/holo-build --plan --format=$GENERATOR < input.toml > $GENERATOR-plan 2>/dev/null
+            FILES_TO_DIFF="$FILES_TO_DIFF $GENERATOR-plan"
+        fi
     done
 
     # use diff to check the actual run with our expectations
-    local EXIT_CODE=0
     for FILE in $FILES_TO_DIFF; do
         if [ -f $FILE ]; then
             if diff -w -q expected-$FILE $FILE >/dev/null; then true; else
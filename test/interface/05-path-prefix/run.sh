@@ -0,0 +1,52 @@
+#!/bin/sh
+
+# check that --prefix relocates all files below the given path, and that
+# absolute symlink targets are only rewritten if they point into the package
+
+cat > prefixed.toml <<-EOT
+[package]
+name = "prefixed"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/foo.conf"
+content = "foo"
+
+[[symlink]]
+path = "/etc/foo-link.conf"
+target = "/etc/foo.conf"
+
+[[symlink]]
+path = "/etc/passwd-link"
+target = "/etc/passwd"
+
+[[symlink]]
+path = "/etc/relative-link.conf"
+target = "foo.conf"
+EOT
+
+echo checking relocation
+echo checking relocation >&2
+${HOLO_BUILD} --format=pacman --prefix=/opt/myorg -o - prefixed.toml | ${DUMP_PACKAGE}
+
+echo checking invalid prefixes
+echo checking invalid prefixes >&2
+${HOLO_BUILD} --format=pacman --prefix=opt/myorg -o - prefixed.toml
+${HOLO_BUILD} --format=pacman --prefix=/opt/myorg/ -o - prefixed.toml
+
+echo checking Holo resources
+echo checking Holo resources >&2
+cat > holo.toml <<-EOT
+[package]
+name = "prefixed-holo"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/usr/share/holo/files/01-foo/etc/foo.conf"
+content = "foo"
+EOT
+${HOLO_BUILD} --format=pacman --prefix=/opt/myorg -o - holo.toml
+
+rm -f prefixed.toml holo.toml
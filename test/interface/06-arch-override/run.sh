@@ -0,0 +1,56 @@
+#!/bin/sh
+
+# check that --arch overrides the architecture from the package definition,
+# and that entries are only included if their "architectures" filter matches
+
+cat > multiarch.toml <<-EOT
+[package]
+name = "multiarch"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+architecture = "x86_64"
+
+[[file]]
+path = "/usr/share/multiarch/common.txt"
+content = "common"
+
+[[file]]
+path = "/usr/lib/multiarch/x86_64.so"
+content = "x86_64"
+architectures = ["x86_64"]
+
+[[file]]
+path = "/usr/lib/multiarch/aarch64.so"
+content = "aarch64"
+architectures = ["aarch64", "arm64"]
+
+[[symlink]]
+path = "/usr/lib/multiarch/native.so"
+target = "aarch64.so"
+architectures = ["aarch64"]
+
+[[directory]]
+path = "/usr/lib/multiarch/any"
+architectures = ["any"]
+EOT
+
+echo checking architecture from definition
+echo checking architecture from definition >&2
+${HOLO_BUILD} --format=pacman -o - multiarch.toml | ${DUMP_PACKAGE}
+
+echo checking --arch=aarch64
+echo checking --arch=aarch64 >&2
+${HOLO_BUILD} --format=debian --arch=aarch64 --suggest-filename multiarch.toml
+${HOLO_BUILD} --format=pacman --arch=aarch64 -o - multiarch.toml | ${DUMP_PACKAGE}
+
+echo checking --arch=all
+echo checking --arch=all >&2
+${HOLO_BUILD} --format=rpm --arch=all --suggest-filename multiarch.toml
+
+echo checking invalid architectures
+echo checking invalid architectures >&2
+${HOLO_BUILD} --format=pacman --arch=sparc -o - multiarch.toml
+sed -i 's/"arm64"/"sparc"/' multiarch.toml
+${HOLO_BUILD} --format=pacman -o - multiarch.toml
+
+rm -f multiarch.toml
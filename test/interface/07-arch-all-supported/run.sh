@@ -0,0 +1,41 @@
+#!/bin/sh
+
+# check that --arch=all-supported builds one package per architecture
+
+cat > multiarch.toml <<-EOT
+[package]
+name = "multiarch"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/usr/lib/multiarch/aarch64.so"
+content = "aarch64"
+architectures = ["aarch64"]
+EOT
+
+for FORMAT in debian pacman rpm; do
+    echo checking suggested filenames for $FORMAT
+    echo checking suggested filenames for $FORMAT >&2
+    ${HOLO_BUILD} --format=$FORMAT --arch=all-supported --suggest-filename multiarch.toml
+done
+
+echo checking output into directory
+echo checking output into directory >&2
+mkdir -p packages
+${HOLO_BUILD} --format=pacman --arch=all-supported -o packages multiarch.toml
+ls packages
+${DUMP_PACKAGE} < packages/multiarch-1.0-1-aarch64.pkg.tar.xz | grep 'aarch64.so is'
+rm -rf packages
+
+echo checking invalid output targets
+echo checking invalid output targets >&2
+${HOLO_BUILD} --format=pacman --arch=all-supported -o - multiarch.toml
+${HOLO_BUILD} --format=pacman --arch=all-supported -o multiarch.pkg.tar.xz multiarch.toml
+
+echo checking errors
+echo checking errors >&2
+printf '[[file]]\npath = "/usr/lib/multiarch/sparc.so"\ncontent = "sparc"\narchitectures = ["sparc"]\n' >> multiarch.toml
+${HOLO_BUILD} --format=debian --arch=all-supported --suggest-filename multiarch.toml
+
+rm -f multiarch.toml
@@ -0,0 +1,38 @@
+#!/bin/sh
+
+# check that the package format is chosen for the current distribution if
+# --format is not given
+
+check() {
+    DESCRIPTION="$1"
+    shift
+    echo "checking $DESCRIPTION"
+    echo "checking $DESCRIPTION" >&2
+    env HOLO_ROOT_DIR=$PWD/root ${HOLO_BUILD} --suggest-filename "$@" ${INPUT_TOML}
+}
+
+rm -rf root
+mkdir -p root/etc root/usr/bin root/usr/lib
+
+echo 'ID=arch' > root/etc/os-release
+check "ID from /etc/os-release"
+
+echo 'ID="ubuntu"' > root/etc/os-release
+echo 'ID_LIKE=debian' >> root/etc/os-release
+check "ID_LIKE from /etc/os-release"
+
+rm root/etc/os-release
+printf '# CentOS\nID="centos"\nID_LIKE="rhel fedora"\n' > root/usr/lib/os-release
+check "ID_LIKE with multiple values from /usr/lib/os-release"
+
+echo 'ID=gentoo' > root/usr/lib/os-release
+check "unknown distribution"
+
+touch root/usr/bin/rpm root/usr/bin/dpkg
+check "unknown distribution with package managers"
+
+echo 'ID=arch' > root/usr/lib/os-release
+check "--no-autodetect" --no-autodetect
+check "--format overriding the autodetection" --format=rpm
+
+rm -rf root
@@ -0,0 +1,56 @@
+#!/bin/sh
+
+# check that --repo places Debian packages in a flat repository and maintains
+# its Packages index (the pacman and RPM repositories are maintained by
+# external tools, so they are not tested here)
+
+make_package() {
+    cat > repotest.toml <<-EOT
+[package]
+name = "$1"
+version = "$2"
+author = "Holo Build <holo.build@example.org>"
+requires = ["foo >= 1.0"]
+
+[[file]]
+path = "/etc/$1.conf"
+content = "$1 $2"
+EOT
+}
+
+# print the index, but check the size and checksums of the packages instead of
+# printing them since they depend on the xz version
+show_index() {
+    grep -v '^\(Size\|MD5sum\|SHA1\|SHA256\):' repo/Packages
+    awk '/^Filename:/ { file = $2 } /^SHA256:/ { print $2 "  repo/" file }' repo/Packages | sha256sum -c --quiet && echo SHA256 checksums are correct
+    awk '/^Filename:/ { file = $2 } /^Size:/ { print $2, file }' repo/Packages | while read SIZE FILE; do
+        [ "$(stat -c %s "repo/$FILE")" = "$SIZE" ] || echo "wrong size for $FILE"
+    done
+}
+
+rm -rf repo
+
+echo checking new repository
+echo checking new repository >&2
+make_package bar 1.0
+${HOLO_BUILD} --format=debian --repo=repo repotest.toml
+ls repo
+show_index
+
+echo checking update of repository
+echo checking update of repository >&2
+make_package bar 2.0
+${HOLO_BUILD} --format=debian --repo=repo repotest.toml
+make_package aaa 1.0
+${HOLO_BUILD} --format=debian --repo=repo repotest.toml
+# rebuilding the same package does not duplicate its entry
+${HOLO_BUILD} --format=debian --repo=repo repotest.toml
+ls repo
+show_index
+gzip -dc repo/Packages.gz | cmp - repo/Packages && echo Packages.gz is consistent
+
+echo checking invalid options
+echo checking invalid options >&2
+${HOLO_BUILD} --format=debian --repo=repo -o foo.deb repotest.toml
+
+rm -rf repo repotest.toml
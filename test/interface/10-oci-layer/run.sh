@@ -0,0 +1,33 @@
+#!/bin/sh
+
+# check that --format=oci-layer produces an OCI image layout containing the
+# package contents as a single layer
+
+cat > layer.toml <<-EOT
+[package]
+name = "layer"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+description = "contents for a container image"
+architecture = "aarch64"
+
+[[file]]
+path = "/etc/layer.conf"
+content = "foo = bar"
+
+[[symlink]]
+path = "/usr/lib/layer.conf"
+target = "/etc/layer.conf"
+EOT
+
+echo checking image layout
+echo checking image layout >&2
+${HOLO_BUILD} --format=oci-layer --suggest-filename layer.toml
+${HOLO_BUILD} --format=oci-layer -o - layer.toml | ${DUMP_PACKAGE}
+
+echo checking named owners
+echo checking named owners >&2
+printf '[[directory]]\npath = "/var/lib/layer"\nowner = "layer"\n' >> layer.toml
+${HOLO_BUILD} --format=oci-layer -o - layer.toml
+
+rm -f layer.toml
@@ -0,0 +1,48 @@
+#!/bin/sh
+
+# check that --format=tar and --format=makeself produce a plain tarball and a
+# self-extracting installer with the same contents
+
+cat > tarball.toml <<-EOT
+[package]
+name = "tarball"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+[[file]]
+path = "/etc/tarball.conf"
+content = "foo = bar"
+
+[[directory]]
+path = "/var/lib/tarball"
+owner = "daemon"
+
+[[action]]
+on = "setup"
+script = "echo it's set up"
+
+[[action]]
+on = "cleanup"
+script = "echo cleaning up"
+EOT
+
+echo checking installer
+echo checking installer >&2
+${HOLO_BUILD} --format=makeself --suggest-filename tarball.toml
+${HOLO_BUILD} --format=makeself -o tarball.run tarball.toml
+# show the script part, then extract the archive in the same way as the script
+sed '/^exit 0$/q' tarball.run
+ARCHIVE_CMD="$(grep -a '^tail ' tarball.run | sed 's/"$0"/tarball.run/; s/| tar .*$//')"
+sh -c "${ARCHIVE_CMD}" | ${DUMP_PACKAGE}
+
+echo checking tarball
+echo checking tarball >&2
+# setup scripts cannot be run, so this fails
+${HOLO_BUILD} --format=tar -o - tarball.toml
+sed -i '/^\[\[action\]\]$/,$d' tarball.toml
+# owners given by name require a setup script, so this fails as well
+${HOLO_BUILD} --format=tar -o - tarball.toml
+sed -i '/^owner =/d' tarball.toml
+${HOLO_BUILD} --format=tar --suggest-filename tarball.toml
+${HOLO_BUILD} --format=tar -o - tarball.toml | ${DUMP_PACKAGE}
+
+rm -f tarball.toml tarball.run
@@ -0,0 +1,58 @@
+#!/bin/sh
+
+# check that --format=nix renders the package definition as a NixOS module
+
+cat > nixos.toml <<-EOT
+[package]
+name = "nixos"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+description = "a \${strange} \"description\""
+architecture = "x86_64"
+
+[[file]]
+path = "/etc/nixos.conf"
+content = "foo = bar\nbaz = \${qux}\n"
+owner = "nixos"
+mode = "0600"
+
+[[file]]
+path = "/usr/lib/nixos/hook.sh"
+content = "#!/bin/sh\necho hook"
+mode = "0755"
+
+[[directory]]
+path = "/var/lib/nixos"
+owner = "nixos"
+group = 42
+
+[[symlink]]
+path = "/usr/lib/nixos/nixos.conf"
+target = "/etc/nixos.conf"
+
+[[group]]
+name = "nixgroup"
+gid = 42
+
+[[user]]
+name = "nixos"
+system = true
+home = "/var/lib/nixos"
+groups = ["nixgroup"]
+
+[[action]]
+on = "setup"
+script = "systemctl daemon-reload"
+EOT
+
+echo checking module
+echo checking module >&2
+${HOLO_BUILD} --format=nix --suggest-filename nixos.toml
+${HOLO_BUILD} --format=nix -o - nixos.toml
+
+echo checking binary content
+echo checking binary content >&2
+printf '[[file]]\npath = "/usr/share/nixos/blob"\ncontent = "\\u0000"\n' >> nixos.toml
+${HOLO_BUILD} --format=nix -o - nixos.toml
+
+rm -f nixos.toml
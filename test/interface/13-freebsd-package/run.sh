@@ -0,0 +1,54 @@
+#!/bin/sh
+
+# check that --format=freebsd produces a package for pkg(8)
+
+cat > freebsd.toml <<-EOT
+[package]
+name = "freebsd"
+version = "1.0"
+release = 2
+epoch = 1
+author = "Holo Build <holo.build@example.org>"
+description = "package for pkg(8)"
+architecture = "x86_64"
+requires = ["foo", "bar = 2.0_1", "baz >= 1.0"]
+provides = ["qux"]
+conflicts = ["quux < 1.0"]
+replaces = ["corge"]
+
+[[file]]
+path = "/usr/local/etc/freebsd.conf"
+content = "foo = bar"
+owner = "daemon"
+
+[[directory]]
+path = "/var/db/freebsd"
+mode = "0700"
+
+[[symlink]]
+path = "/usr/local/lib/freebsd.conf"
+target = "../etc/freebsd.conf"
+
+[[action]]
+on = "cleanup"
+script = "rm -rf /var/db/freebsd"
+EOT
+
+echo checking package
+echo checking package >&2
+${HOLO_BUILD} --format=freebsd --suggest-filename freebsd.toml
+${HOLO_BUILD} --format=freebsd -o - freebsd.toml | ${DUMP_PACKAGE}
+
+# version constraints are not checked for formats without version ordering
+echo checking relations in other formats
+echo checking relations in other formats >&2
+sed -i 's/"foo", /"foo", "foo < 1.0", "foo > 2.0", /' freebsd.toml
+${HOLO_BUILD} --format=freebsd --suggest-filename freebsd.toml
+${HOLO_BUILD} --format=nix --suggest-filename freebsd.toml
+
+echo checking reserved paths
+echo checking reserved paths >&2
+printf '[[file]]\npath = "/+MANIFEST"\ncontent = "{}"\n' >> freebsd.toml
+${HOLO_BUILD} --format=freebsd -o - freebsd.toml
+
+rm -f freebsd.toml
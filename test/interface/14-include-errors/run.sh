@@ -0,0 +1,54 @@
+#!/bin/sh
+
+# check error reporting for package definitions with `include`
+
+rm -rf defs
+mkdir -p defs/sub
+
+check() {
+    echo "checking $1"
+    echo "checking $1" >&2
+    ${HOLO_BUILD} --format=pacman -o - defs/main.toml | ${DUMP_PACKAGE}
+}
+
+cat > defs/main.toml <<-EOT
+include = ["sub/base.toml"]
+
+[package]
+name = "main"
+version = "1.0"
+EOT
+
+check "missing include"
+
+cat > defs/sub/base.toml <<-EOT
+include = ["../main.toml"]
+EOT
+check "include cycle"
+
+cat > defs/sub/base.toml <<-EOT
+[package
+EOT
+check "syntax error in included file"
+
+cat > defs/sub/base.toml <<-EOT
+[[file]]
+path = "/etc/base.conf"
+contentFrom = "missing.conf"
+mode = "0o644"
+
+[[directory]]
+path = "relative/path"
+EOT
+check "invalid sections in included file"
+
+cat > defs/sub/base.toml <<-EOT
+[[file]]
+path = "/etc/base.conf"
+mode = "0644"
+contentFrom = "missing.conf"
+EOT
+printf 'base = true\n' > defs/sub/missing.conf
+check "contentFrom relative to included file"
+
+rm -rf defs
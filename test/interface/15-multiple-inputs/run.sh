@@ -0,0 +1,59 @@
+#!/bin/sh
+
+# check that multiple input files are merged into one package
+
+rm -rf defs
+mkdir -p defs/files
+
+cat > defs/package.toml <<-EOT
+[package]
+name = "multi"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+requires = ["foo"]
+EOT
+
+cat > defs/files/files.toml <<-EOT
+[package]
+name = "multi"
+requires = ["foo", "bar"]
+
+[[file]]
+path = "/etc/multi.conf"
+contentFrom = "multi.conf"
+EOT
+printf 'multi = true\n' > defs/files/multi.conf
+
+cat > defs/users.toml <<-EOT
+[[group]]
+name = "multi"
+
+[[user]]
+name = "multi"
+group = "multi"
+EOT
+
+echo checking merged package
+echo checking merged package >&2
+${HOLO_BUILD} --format=pacman -o - defs/package.toml defs/files/files.toml defs/users.toml | ${DUMP_PACKAGE}
+
+echo checking conflicts
+echo checking conflicts >&2
+cat > defs/conflicts.toml <<-EOT
+[package]
+name = "other"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/multi.conf"
+content = "multi = false"
+
+[[user]]
+name = "multi"
+EOT
+${HOLO_BUILD} --format=pacman -o - defs/package.toml defs/files/files.toml defs/users.toml defs/conflicts.toml
+sed -i '/^\[package\]$/,/^$/d; /^\[\[user\]\]$/,$d' defs/conflicts.toml
+${HOLO_BUILD} --format=pacman -o - defs/package.toml defs/files/files.toml defs/conflicts.toml
+
+rm -rf defs
@@ -0,0 +1,51 @@
+#!/bin/sh
+
+# check that action scripts can be read from external files with `scriptFrom`
+
+rm -rf defs
+mkdir -p defs/scripts
+
+printf '#!/bin/sh\n# set up the example\necho "setting up"\n' > defs/scripts/setup.sh
+printf 'if true; then\n    echo "cleaning up"\n' > defs/scripts/broken.sh
+
+cat > defs/package.toml <<-EOT
+[package]
+name = "script-from"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[action]]
+on = "setup"
+scriptFrom = "scripts/setup.sh"
+EOT
+
+echo checking scriptFrom
+echo checking scriptFrom >&2
+${HOLO_BUILD} --format=pacman -o - defs/package.toml | ${DUMP_PACKAGE}
+
+echo checking invalid scriptFrom
+echo checking invalid scriptFrom >&2
+cat >> defs/package.toml <<-EOT
+
+[[action]]
+on = "cleanup"
+script = "echo cleaning up"
+scriptFrom = "scripts/setup.sh"
+
+[[action]]
+on = "cleanup"
+scriptFrom = "scripts/missing.sh"
+EOT
+${HOLO_BUILD} --format=pacman -o - defs/package.toml
+
+echo checking shell syntax validation
+echo checking shell syntax validation >&2
+sed -i '/^\[\[action\]\]$/,$d' defs/package.toml
+cat >> defs/package.toml <<-EOT
+[[action]]
+on = "cleanup"
+scriptFrom = "scripts/broken.sh"
+EOT
+${HOLO_BUILD} --format=makeself --check-output -o - defs/package.toml > /dev/null
+
+rm -rf defs
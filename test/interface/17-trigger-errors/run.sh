@@ -0,0 +1,49 @@
+#!/bin/sh
+
+# check validation of [[trigger]] sections
+
+cat > trigger-errors.toml <<-EOT
+[package]
+name = "trigger-errors"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[trigger]]
+script = "echo nothing to watch"
+
+[[trigger]]
+paths = ["usr/share/fonts", "/usr/share/my fonts"]
+packages = ["foo bar"]
+script = "fc-cache"
+
+[[trigger]]
+packages = ["systemd"]
+interpreter = "python3"
+script = "print('hello')"
+EOT
+
+echo checking invalid triggers
+echo checking invalid triggers >&2
+${HOLO_BUILD} --format=pacman --suggest-filename trigger-errors.toml
+
+cat > trigger-errors.toml <<-EOT
+[package]
+name = "trigger-errors"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[trigger]]
+packages = ["systemd"]
+script = "if systemctl daemon-reload; then"
+EOT
+
+echo checking unsupported formats
+echo checking unsupported formats >&2
+${HOLO_BUILD} --format=tar --suggest-filename trigger-errors.toml
+${HOLO_BUILD} --format=nix --suggest-filename trigger-errors.toml
+
+echo checking shell syntax validation
+echo checking shell syntax validation >&2
+${HOLO_BUILD} --format=pacman --check-output -o - trigger-errors.toml > /dev/null
+
+rm -f trigger-errors.toml
@@ -0,0 +1,47 @@
+#!/bin/sh
+
+# check validation of [[service]] sections
+
+cat > service-errors.toml <<-EOT
+[package]
+name = "service-errors"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[service]]
+enable = true
+
+[[service]]
+unit = "foo"
+
+[[service]]
+unit = "foo bar.service"
+
+[[service]]
+unit = "foo.service"
+
+[[service]]
+unit = "foo.service"
+restartOnUpgrade = true
+EOT
+
+echo checking invalid services
+echo checking invalid services >&2
+${HOLO_BUILD} --format=rpm --suggest-filename service-errors.toml
+
+cat > service-errors.toml <<-EOT
+[package]
+name = "service-errors"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[service]]
+unit = "foo.service"
+EOT
+
+echo checking unsupported formats
+echo checking unsupported formats >&2
+${HOLO_BUILD} --format=makeself --suggest-filename service-errors.toml
+${HOLO_BUILD} --format=freebsd --suggest-filename service-errors.toml
+
+rm -f service-errors.toml
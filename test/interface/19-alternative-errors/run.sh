@@ -0,0 +1,55 @@
+#!/bin/sh
+
+# check validation of [[alternative]] sections
+
+cat > alternative-errors.toml <<-EOT
+[package]
+name = "alternative-errors"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[alternative]]
+path = "/usr/bin/foo"
+
+[[alternative]]
+link = "usr/bin/editor"
+path = "/usr/bin/foo bar"
+
+[[alternative]]
+link = "/usr/bin/editor/"
+path = "/usr/bin/it's"
+
+[[alternative]]
+name = "-editor"
+link = "/usr/bin/editor"
+path = "/usr/bin/foo"
+
+[[alternative]]
+link = "/usr/bin/editor"
+path = "/usr/bin/editor"
+
+[[alternative]]
+link = "/usr/bin/editor"
+path = "/usr/bin/foo"
+priority = 10
+
+[[alternative]]
+link = "/usr/bin/editor"
+path = "/usr/bin/foo"
+priority = 20
+
+[[alternative]]
+name = "editor"
+link = "/usr/local/bin/editor"
+path = "/usr/bin/bar"
+
+[[symlink]]
+path = "/usr/bin/editor"
+target = "foo"
+EOT
+
+echo checking invalid alternatives
+echo checking invalid alternatives >&2
+${HOLO_BUILD} --format=debian --suggest-filename alternative-errors.toml
+
+rm -f alternative-errors.toml
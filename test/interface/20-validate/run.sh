@@ -0,0 +1,49 @@
+#!/bin/sh
+
+# check that --validate only checks the package definition
+
+cat > validate.toml <<-EOT
+[package]
+name = "validate"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/validate.conf"
+content = "foo = bar"
+EOT
+
+echo checking valid package definition
+echo checking valid package definition >&2
+${HOLO_BUILD} --format=debian --validate validate.toml && echo "exit code 0"
+${HOLO_BUILD} --format=all --validate < validate.toml && echo "exit code 0"
+ls *.deb 2>/dev/null
+
+cat > validate.toml <<-EOT
+[package]
+name = "validate"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+architecture = "i686"
+
+[[file]]
+path = "/etc/validate.conf"
+contentFrom = "does-not-exist.conf"
+
+[[service]]
+unit = "validate.service"
+EOT
+
+echo checking invalid package definition
+echo checking invalid package definition >&2
+${HOLO_BUILD} --format=rpm --validate validate.toml || echo "exit code $?"
+${HOLO_BUILD} --format=all --validate validate.toml || echo "exit code $?"
+
+echo checking invalid usage
+echo checking invalid usage >&2
+${HOLO_BUILD} --format=all validate.toml || echo "exit code $?"
+${HOLO_BUILD} --format=all --validate --arch=all-supported validate.toml || echo "exit code $?"
+${HOLO_BUILD} --format=debian --validate --suggest-filename validate.toml || echo "exit code $?"
+${HOLO_BUILD} --format=debian --validate -o foo.deb validate.toml || echo "exit code $?"
+
+rm -f validate.toml
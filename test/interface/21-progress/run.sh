@@ -0,0 +1,38 @@
+#!/bin/sh
+
+# check progress reporting with --verbose and --progress=json (timings are
+# removed from the output since they are not reproducible)
+
+cat > progress.toml <<-EOT
+[package]
+name = "progress"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/progress.conf"
+content = "foo = bar"
+
+[[file]]
+path = "/usr/share/progress/data"
+content = "data"
+EOT
+
+echo checking verbose output
+echo checking verbose output >&2
+${HOLO_BUILD} --format=debian --verbose -o - progress.toml 2>&1 >/dev/null | sed 's/after [0-9.]*[mµn]*s/after XXX/'
+
+echo checking JSON output
+echo checking JSON output >&2
+${HOLO_BUILD} --format=rpm --progress=json -o - progress.toml 2>&1 >/dev/null | sed 's/"seconds":[0-9.e-]*/"seconds":XXX/'
+
+echo checking validation
+echo checking validation >&2
+${HOLO_BUILD} --format=pacman --progress=json --validate progress.toml 2>&1 | sed 's/"seconds":[0-9.e-]*/"seconds":XXX/'
+
+echo checking invalid usage
+echo checking invalid usage >&2
+${HOLO_BUILD} --format=debian --progress=xml progress.toml
+${HOLO_BUILD} --format=debian --progress=json --verbose progress.toml
+
+rm -f progress.toml
@@ -0,0 +1,50 @@
+#!/bin/sh
+
+# check that parallel compression with --jobs is reproducible, and that the
+# number of jobs does not affect the package (as long as it is greater than 1;
+# a single job uses plain single-threaded xz)
+
+yes "holo-build parallel compression" | head -c 20000000 > big.txt
+
+cat > parallel.toml <<-EOT
+[package]
+name = "parallel"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/usr/share/parallel/big.txt"
+contentFrom = "big.txt"
+EOT
+
+for FORMAT in debian pacman freebsd tar makeself; do
+    echo "checking $FORMAT package"
+    echo "checking $FORMAT package" >&2
+    ${HOLO_BUILD} --format=$FORMAT --jobs=2 -o parallel-2.out parallel.toml
+    ${HOLO_BUILD} --format=$FORMAT --jobs=4 -o parallel-4.out parallel.toml
+    ${HOLO_BUILD} --format=$FORMAT -o parallel-1.out parallel.toml
+    cmp -s parallel-2.out parallel-4.out && echo "--jobs=2 and --jobs=4 produce identical packages"
+    cmp -s parallel-1.out parallel-4.out || echo "--jobs=1 and --jobs=4 produce different packages"
+    rm -f parallel-*.out
+done
+
+cat > parallel.toml <<-EOT
+[package]
+name = "parallel"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/parallel.conf"
+content = "foo = bar"
+EOT
+
+echo checking package contents
+echo checking package contents >&2
+${HOLO_BUILD} --format=pacman --jobs=2 -o - parallel.toml | ${DUMP_PACKAGE}
+
+echo checking invalid usage
+echo checking invalid usage >&2
+${HOLO_BUILD} --format=pacman --jobs=0 parallel.toml
+
+rm -f big.txt parallel.toml
@@ -0,0 +1,74 @@
+#!/bin/sh
+
+# check that "holo-build convert" reads generated packages back in
+
+cat > convert.toml <<-EOT
+[package]
+name = "convert"
+version = "2.1"
+beta = 3
+epoch = 1
+release = 2
+description = "package for conversion"
+author = "Holo Build <holo.build@example.org>"
+architecture = "x86_64"
+requires = ["foo>=1.0", "foo<2.0", "bar"]
+provides = ["convert-tool"]
+conflicts = ["qux<=1.2"]
+replaces = ["old-convert<2.0"]
+
+[[file]]
+path = "/etc/convert.conf"
+content = "foo = bar"
+
+[[file]]
+path = "/usr/bin/convert-tool"
+content = "#!/bin/sh\necho converted"
+mode = "0755"
+
+[[directory]]
+path = "/var/lib/convert"
+mode = "0700"
+owner = 4242
+group = 2323
+
+[[symlink]]
+path = "/usr/bin/ct"
+target = "convert-tool"
+
+[[action]]
+on = "setup"
+script = "echo setup"
+
+[[action]]
+on = "cleanup"
+script = "print('cleanup')"
+interpreter = "/usr/bin/python3"
+EOT
+
+for FORMAT in debian pacman rpm; do
+    ${HOLO_BUILD} --format=$FORMAT -o direct.$FORMAT convert.toml
+done
+
+for FROM in debian pacman rpm; do
+    for TO in debian pacman rpm; do
+        echo "checking conversion from $FROM to $TO"
+        echo "checking conversion from $FROM to $TO" >&2
+        ${HOLO_BUILD} convert direct.$FROM --format=$TO -o converted.$TO
+        cmp -s direct.$TO converted.$TO && echo "converted package is identical to direct build"
+        rm -f converted.$TO
+    done
+done
+
+echo checking conversion to stdout
+echo checking conversion to stdout >&2
+${HOLO_BUILD} convert direct.rpm --format=pacman --arch=aarch64 -o - | ${DUMP_PACKAGE} | grep -E "pkgver|arch ="
+
+echo checking invalid usage
+echo checking invalid usage >&2
+${HOLO_BUILD} convert --format=rpm || echo "exit code $?"
+${HOLO_BUILD} convert direct.debian direct.rpm --format=rpm || echo "exit code $?"
+${HOLO_BUILD} convert direct.debian --format=rpm --validate || echo "exit code $?"
+${HOLO_BUILD} convert convert.toml --format=rpm || echo "exit code $?"
+
+rm -f convert.toml direct.*
@@ -0,0 +1,86 @@
+#!/bin/sh
+
+# check that "dump-package --diff" compares packages at the logical level
+
+cat > old.toml <<-EOT
+[package]
+name = "diff"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+requires = ["foo>=1.0", "bar"]
+
+[[file]]
+path = "/etc/diff.conf"
+content = "foo = bar"
+
+[[file]]
+path = "/etc/removed.conf"
+content = "removed"
+
+[[directory]]
+path = "/var/lib/diff"
+mode = "0700"
+
+[[action]]
+on = "setup"
+script = """
+echo one
+echo two
+echo three
+"""
+EOT
+
+cat > new.toml <<-EOT
+[package]
+name = "diff"
+version = "1.1"
+beta = 1
+author = "Holo Build <holo.build@example.org>"
+requires = ["foo>=1.0", "foo<2.0", "baz"]
+
+[[file]]
+path = "/etc/diff.conf"
+content = "foo = baz"
+
+[[symlink]]
+path = "/etc/added.conf"
+target = "diff.conf"
+
+[[directory]]
+path = "/var/lib/diff"
+mode = "0750"
+owner = 4242
+
+[[action]]
+on = "setup"
+script = """
+echo one
+echo 2
+echo three
+"""
+
+[[action]]
+on = "cleanup"
+script = "echo cleanup"
+EOT
+
+for FORMAT in debian pacman rpm; do
+    ${HOLO_BUILD} --format=$FORMAT -o old.$FORMAT old.toml
+    ${HOLO_BUILD} --format=$FORMAT -o new.$FORMAT new.toml
+done
+
+echo checking identical packages in different formats
+echo checking identical packages in different formats >&2
+${DUMP_PACKAGE} --diff old.debian old.rpm && echo "exit code 0"
+${DUMP_PACKAGE} --diff old.pacman old.debian && echo "exit code 0"
+
+echo checking different packages
+echo checking different packages >&2
+${DUMP_PACKAGE} --diff old.debian new.pacman || echo "exit code $?"
+
+echo checking invalid usage
+echo checking invalid usage >&2
+${DUMP_PACKAGE} --diff old.debian || echo "exit code $?"
+${DUMP_PACKAGE} --diff old.debian old.toml || echo "exit code $?"
+
+rm -f old.* new.*
@@ -0,0 +1,37 @@
+#!/bin/sh
+
+# check that --pacman-group-db resolves package groups without pacman
+
+cat > groups.toml <<-EOT
+[package]
+name = "groups"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+requires = ["group:base-devel", "except:make", "holo"]
+EOT
+
+cat > groups.txt <<-EOT
+# generated with "pacman -Sg"
+base-devel autoconf
+base-devel gcc
+base-devel make
+
+xorg xorg-server
+EOT
+
+echo checking group resolution
+echo checking group resolution >&2
+${HOLO_BUILD} --format=pacman --pacman-group-db=groups.txt -o - groups.toml | ${DUMP_PACKAGE} | grep "depend ="
+
+echo checking unknown group
+echo checking unknown group >&2
+sed -i 's/base-devel/base/' groups.toml
+${HOLO_BUILD} --format=pacman --pacman-group-db=groups.txt -o - groups.toml || echo "exit code $?"
+
+echo checking invalid group database
+echo checking invalid group database >&2
+echo "base-devel" > groups.txt
+${HOLO_BUILD} --format=pacman --pacman-group-db=groups.txt -o - groups.toml || echo "exit code $?"
+${HOLO_BUILD} --format=pacman --pacman-group-db=does-not-exist.txt -o - groups.toml || echo "exit code $?"
+
+rm -f groups.toml groups.txt
@@ -0,0 +1,32 @@
+#!/bin/sh
+
+# check that Pacman packages can be built on hosts without pacman
+
+mkdir -p bin
+ln -sf "$(command -v xz)" bin/xz
+
+cat > nopacman.toml <<-EOT
+[package]
+name = "nopacman"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+requires = ["foo>=1.0"]
+
+[[file]]
+path = "/etc/nopacman.conf"
+content = "foo = bar"
+EOT
+
+echo checking package without group requirements
+echo checking package without group requirements >&2
+PATH="$PWD/bin" ${HOLO_BUILD} --format=pacman -o - nopacman.toml | ${DUMP_PACKAGE} | grep "depend ="
+
+echo checking package with group requirements
+echo checking package with group requirements >&2
+sed -i 's/"foo>=1.0"/"group:base-devel"/' nopacman.toml
+PATH="$PWD/bin" ${HOLO_BUILD} --format=pacman -o - nopacman.toml || echo "exit code $?"
+
+echo "base-devel make" > groups.txt
+PATH="$PWD/bin" ${HOLO_BUILD} --format=pacman --pacman-group-db=groups.txt -o - nopacman.toml | ${DUMP_PACKAGE} | grep "depend ="
+
+rm -rf bin nopacman.toml groups.txt
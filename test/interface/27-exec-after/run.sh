@@ -0,0 +1,35 @@
+#!/bin/sh
+
+# check that --exec-after runs commands after a successful build
+
+cat > hooks.toml <<-EOT
+[package]
+name = "hooks"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+EOT
+
+echo checking hooks in order
+echo checking hooks in order >&2
+${HOLO_BUILD} --format=pacman --exec-after='echo "first: {}"' --exec-after='test -f {} && echo second' hooks.toml; echo "exit code $?"
+
+echo checking file name substitution with output directory
+echo checking file name substitution with output directory >&2
+mkdir -p "out dir"
+${HOLO_BUILD} --format=pacman -o "out dir" --exec-after='ls {}' hooks.toml; echo "exit code $?"
+
+echo checking failing hook
+echo checking failing hook >&2
+${HOLO_BUILD} --format=pacman --force --exec-after='echo first; false' --exec-after='echo never' hooks.toml; echo "exit code $?"
+
+echo checking no hooks after failed build
+echo checking no hooks after failed build >&2
+sed -i 's/1.0/broken/' hooks.toml
+${HOLO_BUILD} --format=pacman --exec-after='echo never' hooks.toml; echo "exit code $?"
+
+echo checking invalid combinations
+echo checking invalid combinations >&2
+${HOLO_BUILD} --format=pacman --exec-after='echo never' -o - hooks.toml; echo "exit code $?"
+${HOLO_BUILD} --format=pacman --exec-after='echo never' --validate hooks.toml; echo "exit code $?"
+
+rm -rf hooks.toml hooks-1.0-1-any.pkg.tar.xz "out dir"
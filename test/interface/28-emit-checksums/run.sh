@@ -0,0 +1,28 @@
+#!/bin/sh
+
+# check that --emit-checksums writes sidecar files that coreutils accept
+
+cat > checksums.toml <<-EOT
+[package]
+name = "checksums"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/checksums.conf"
+content = "foo"
+EOT
+
+echo checking checksum files
+echo checking checksum files >&2
+mkdir -p out
+${HOLO_BUILD} --format=pacman -o out --emit-checksums=sha256,md5,b2 checksums.toml | sed 's/= [0-9a-f]*$/= XXX/'
+ls out
+(cd out && sha256sum -c checksums-1.0-1-any.pkg.tar.xz.sha256 && md5sum -c checksums-1.0-1-any.pkg.tar.xz.md5 && b2sum -c checksums-1.0-1-any.pkg.tar.xz.b2)
+
+echo checking invalid arguments
+echo checking invalid arguments >&2
+${HOLO_BUILD} --format=pacman --emit-checksums=sha256,crc32 checksums.toml; echo "exit code $?"
+${HOLO_BUILD} --format=pacman --emit-checksums=sha256 -o - checksums.toml; echo "exit code $?"
+
+rm -rf checksums.toml out
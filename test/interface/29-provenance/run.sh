@@ -0,0 +1,52 @@
+#!/bin/sh
+
+# check that --provenance writes an attestation with the digests of all inputs
+
+cat > common.toml <<-EOT
+[package]
+author = "Holo Build <holo.build@example.org>"
+EOT
+
+cat > provenance.toml <<-EOT
+include = ["common.toml"]
+
+[package]
+name = "provenance"
+version = "1.0"
+
+[[file]]
+path = "/etc/provenance.conf"
+contentFrom = "provenance.conf"
+
+[[action]]
+on = "setup"
+scriptFrom = "setup.sh"
+EOT
+
+echo foo > provenance.conf
+echo "echo hello" > setup.sh
+
+# the builder ID contains the holo-build version
+normalize() {
+    sed 's|"id": "https://github.com/holocm/holo-build[^"]*"|"id": "https://github.com/holocm/holo-build@VERSION"|;s|"sha256": "[0-9a-f]*"|"sha256": "XXX"|'
+}
+
+echo checking provenance attestation
+echo checking provenance attestation >&2
+${HOLO_BUILD} --format=pacman --provenance provenance.toml
+normalize < provenance-1.0-1-any.pkg.tar.xz.intoto.json
+for FILE in provenance-1.0-1-any.pkg.tar.xz common.toml provenance.toml provenance.conf setup.sh; do
+    grep -q "\"sha256\": \"$(sha256sum $FILE | cut -d' ' -f1)\"" provenance-1.0-1-any.pkg.tar.xz.intoto.json && echo "digest for $FILE: OK"
+done
+
+echo checking provenance attestation for stdin
+echo checking provenance attestation for stdin >&2
+sed -i 's/^include.*//' provenance.toml
+${HOLO_BUILD} --format=pacman --provenance --force < provenance.toml
+normalize < provenance-1.0-1-any.pkg.tar.xz.intoto.json | grep -A4 '"materials"'
+
+echo checking invalid arguments
+echo checking invalid arguments >&2
+${HOLO_BUILD} --format=pacman --provenance -o - provenance.toml; echo "exit code $?"
+
+rm -f common.toml provenance.toml provenance.conf setup.sh provenance-1.0-1-any.pkg.tar.xz.intoto.json
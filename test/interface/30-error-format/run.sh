@@ -0,0 +1,33 @@
+#!/bin/sh
+
+# check that --error-format=json reports each error as a JSON object
+
+cat > errors.toml <<-EOT
+[package]
+name = "Foo Bar"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+requires = ["Bad Name"]
+
+[[file]]
+path = "/.PKGINFO"
+content = "foo"
+EOT
+
+echo checking validation errors
+echo checking validation errors >&2
+${HOLO_BUILD} --format=pacman --error-format=json errors.toml; echo "exit code $?"
+
+echo checking validation errors for all formats
+echo checking validation errors for all formats >&2
+${HOLO_BUILD} --format=all --validate --error-format=json errors.toml; echo "exit code $?"
+
+echo checking build errors
+echo checking build errors >&2
+${HOLO_BUILD} --format=pacman --error-format=json does-not-exist.toml; echo "exit code $?"
+
+echo checking invalid arguments
+echo checking invalid arguments >&2
+${HOLO_BUILD} --format=pacman --error-format=xml errors.toml; echo "exit code $?"
+
+rm -f errors.toml
@@ -0,0 +1,17 @@
+#!/bin/sh
+
+# check that --filename-format=json prints the components of the suggested filename
+
+for FORMAT in debian pacman rpm freebsd; do
+    echo "checking format $FORMAT"
+    echo "checking format $FORMAT" >&2
+    ${HOLO_BUILD} --format=$FORMAT --suggest-filename --filename-format=json < ${INPUT_TOML}; echo "exit code $?"
+done
+
+echo checking without --suggest-filename
+echo checking without --suggest-filename >&2
+${HOLO_BUILD} --format=debian --filename-format=json < ${INPUT_TOML}; echo "exit code $?"
+
+echo checking invalid format
+echo checking invalid format >&2
+${HOLO_BUILD} --format=debian --suggest-filename --filename-format=xml < ${INPUT_TOML}; echo "exit code $?"
@@ -0,0 +1,4 @@
+#!/bin/sh
+
+# check that --explain-schema describes the package definition format
+${HOLO_BUILD} --explain-schema; echo "exit code $?"
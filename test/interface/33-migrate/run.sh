@@ -0,0 +1,46 @@
+#!/bin/sh
+
+# check that --migrate replaces deprecated keys and normalizes architectures
+
+cat > migrate.toml <<-EOT
+# comments are preserved
+[package]
+name = "migrate"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+architecture = "amd64"
+setupScript = """
+    echo first
+"""
+cleanupScript = "echo cleanup" # trailing comment
+
+[[file]]
+path = "/etc/migrate.conf"
+content = "foo"
+architectures = [ "amd64", "i386" ]
+
+[[action]]
+on = "setup"
+script = "echo second"
+EOT
+cp migrate.toml original.toml
+
+echo checking migration
+echo checking migration >&2
+${HOLO_BUILD} --migrate migrate.toml; echo "exit code $?"
+
+echo checking that the package is unchanged
+echo checking that the package is unchanged >&2
+${HOLO_BUILD} --format=pacman -o original.pkg.tar.xz original.toml 2>/dev/null
+${HOLO_BUILD} --format=pacman -o migrate.pkg.tar.xz migrate.toml
+cmp original.pkg.tar.xz migrate.pkg.tar.xz && echo identical
+
+echo checking repeated migration
+echo checking repeated migration >&2
+${HOLO_BUILD} --migrate migrate.toml; echo "exit code $?"
+
+echo checking migration from stdin
+echo checking migration from stdin >&2
+${HOLO_BUILD} --migrate < original.toml | diff - migrate.toml && echo identical
+
+rm -f migrate.toml original.toml migrate.pkg.tar.xz original.pkg.tar.xz
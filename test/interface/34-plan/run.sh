@@ -0,0 +1,38 @@
+#!/bin/sh
+
+# check that --plan describes the archive members and metadata of the package
+# (including the marker for sensitive files)
+
+cat > plan-input.toml <<'TOML'
+[package]
+name = "package"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+description = "example package"
+
+[[file]]
+path = "/etc/foo.conf"
+content = "foo\n"
+mode = "0600"
+sensitive = true
+
+[[symlink]]
+path = "/etc/bar.conf"
+target = "foo.conf"
+TOML
+
+for FORMAT in debian pacman rpm; do
+    echo "checking format $FORMAT"
+    echo "checking format $FORMAT" >&2
+    ${HOLO_BUILD} --format=$FORMAT --plan plan-input.toml; echo "exit code $?"
+done
+
+echo checking unsupported format
+echo checking unsupported format >&2
+${HOLO_BUILD} --format=tar --plan plan-input.toml; echo "exit code $?"
+
+echo checking --plan with --output
+echo checking --plan with --output >&2
+${HOLO_BUILD} --format=debian --plan -o - plan-input.toml; echo "exit code $?"
+
+rm -f plan-input.toml
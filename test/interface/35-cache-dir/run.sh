@@ -0,0 +1,39 @@
+#!/bin/sh
+
+# check that --cache-dir reuses packages when the inputs are unchanged
+
+rm -rf cache-test
+mkdir cache-test
+printf 'first\n' > cache-test/data.txt
+cat > cache-test/input.toml <<-EOT
+[package]
+name = "package"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/usr/share/package/data.txt"
+contentFrom = "data.txt"
+EOT
+
+echo checking first build
+${HOLO_BUILD} --format=debian --cache-dir=cache-test/cache -o cache-test/first.deb cache-test/input.toml; echo "exit code $?"
+ls cache-test/cache | wc -l
+
+echo checking rebuild with unchanged inputs
+# a corrupted cache entry shows that the cached package is used as-is
+for ENTRY in cache-test/cache/*; do printf 'cached\n' > "${ENTRY}"; done
+${HOLO_BUILD} --format=debian --cache-dir=cache-test/cache -o cache-test/second.deb cache-test/input.toml; echo "exit code $?"
+cat cache-test/second.deb
+
+echo checking rebuild with changed contentFrom file
+printf 'second\n' > cache-test/data.txt
+${HOLO_BUILD} --format=debian --cache-dir=cache-test/cache -o cache-test/third.deb cache-test/input.toml; echo "exit code $?"
+ls cache-test/cache | wc -l
+cmp -s cache-test/first.deb cache-test/third.deb && echo "unexpected: packages are identical"
+
+echo checking rebuild for other format
+${HOLO_BUILD} --format=pacman --cache-dir=cache-test/cache -o cache-test/fourth.pkg.tar.xz cache-test/input.toml; echo "exit code $?"
+ls cache-test/cache | wc -l
+
+rm -rf cache-test
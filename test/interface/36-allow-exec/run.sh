@@ -0,0 +1,36 @@
+#!/bin/sh
+
+# check that contentFromCommand works with --allow-exec, and that the command
+# is recorded in the provenance attestation
+
+rm -rf exec-test
+mkdir exec-test
+printf 'from file\n' > exec-test/source.txt
+cat > exec-test/input.toml <<-EOT
+[package]
+name = "package"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/generated.conf"
+contentFromCommand = "tr a-z A-Z < source.txt"
+EOT
+
+echo checking without --allow-exec
+echo checking without --allow-exec >&2
+${HOLO_BUILD} --format=debian -o exec-test/package.deb exec-test/input.toml; echo "exit code $?"
+
+echo checking with --allow-exec
+echo checking with --allow-exec >&2
+${HOLO_BUILD} --format=debian --allow-exec --provenance -o exec-test/package.deb exec-test/input.toml; echo "exit code $?"
+grep -A3 '"exec:' exec-test/package.deb.intoto.json
+# the digest of the file content matches the digest of the command's output
+${HOLO_BUILD} --format=debian --allow-exec --plan exec-test/input.toml | grep -A8 '"/etc/generated.conf"'
+
+echo checking failing command
+echo checking failing command >&2
+sed -i 's/tr a-z A-Z < source.txt/echo broken >\&2; exit 3/' exec-test/input.toml
+${HOLO_BUILD} --format=debian --allow-exec -o exec-test/package.deb exec-test/input.toml; echo "exit code $?"
+
+rm -rf exec-test
@@ -0,0 +1,53 @@
+#!/bin/sh
+
+# check the exit codes documented in the man page, and that --quiet suppresses
+# warnings, but not errors
+
+rm -rf exit-test
+mkdir exit-test
+
+echo checking success
+echo checking success >&2
+${HOLO_BUILD} --format=debian -o exit-test/package.deb ${INPUT_TOML}; echo "exit code $?"
+
+echo checking nothing to do
+echo checking nothing to do >&2
+${HOLO_BUILD} --format=debian -o exit-test/package.deb ${INPUT_TOML}; echo "exit code $?"
+${HOLO_BUILD} --format=debian -o - ${INPUT_TOML} > /dev/null; echo "exit code $?"
+
+echo checking write error
+echo checking write error >&2
+echo garbage > exit-test/package.deb
+${HOLO_BUILD} --format=debian -o exit-test/package.deb ${INPUT_TOML}; echo "exit code $?"
+
+echo checking build error
+echo checking build error >&2
+${HOLO_BUILD} --format=debian --force --exec-after=false -o exit-test/package.deb ${INPUT_TOML}; echo "exit code $?"
+
+echo checking parse error
+echo checking parse error >&2
+printf '[package]\nname = "package"\n' | ${HOLO_BUILD} --format=debian --validate; echo "exit code $?"
+
+echo checking validation error
+echo checking validation error >&2
+sed 's/name = "package"/name = "Package"/' ${INPUT_TOML} | ${HOLO_BUILD} --format=debian --validate; echo "exit code $?"
+sed 's/name = "package"/name = "Package"/' ${INPUT_TOML} | ${HOLO_BUILD} --format=all --validate; echo "exit code $?"
+
+echo checking argument error
+echo checking argument error >&2
+${HOLO_BUILD} --format=debian --jobs=0 ${INPUT_TOML}; echo "exit code $?"
+
+echo checking --quiet
+echo checking --quiet >&2
+cat > exit-test/input.toml <<-EOT
+[package]
+name = "package"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+requires = ["foo", "foo"]
+EOT
+${HOLO_BUILD} --quiet --debian --emit-checksums=sha256 -o exit-test/quiet.deb exit-test/input.toml; echo "exit code $?"
+ls exit-test/quiet.deb.sha256
+${HOLO_BUILD} -q --format=rpm --validate exit-test/input.toml --jobs=0; echo "exit code $?"
+
+rm -rf exit-test
@@ -0,0 +1,37 @@
+#!/bin/sh
+
+# check that --base-dir sets where relative paths in a package definition from
+# standard input are resolved
+
+rm -rf base-test
+mkdir -p base-test/src
+printf 'from base directory\n' > base-test/src/foo.conf
+printf '[[file]]\npath = "/etc/included.conf"\ncontentFrom = "foo.conf"\n' > base-test/src/include.toml
+cat > base-test/input.toml <<-EOT
+include = ["include.toml"]
+
+[package]
+name = "package"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/foo.conf"
+contentFrom = "foo.conf"
+EOT
+
+echo checking without --base-dir
+echo checking without --base-dir >&2
+${HOLO_BUILD} --format=debian --validate < base-test/input.toml; echo "exit code $?"
+
+echo checking with --base-dir
+echo checking with --base-dir >&2
+${HOLO_BUILD} --format=debian --base-dir=base-test/src --plan < base-test/input.toml | grep '"path": "/etc/'
+${HOLO_BUILD} --format=debian --base-dir=base-test/src --validate base-test/input.toml; echo "exit code $?"
+
+echo checking invalid usage
+echo checking invalid usage >&2
+${HOLO_BUILD} --format=debian --base-dir=base-test/missing --validate < base-test/input.toml; echo "exit code $?"
+${HOLO_BUILD} --format=debian --base-dir=base-test/input.toml --validate < base-test/input.toml; echo "exit code $?"
+
+rm -rf base-test
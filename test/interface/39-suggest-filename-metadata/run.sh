@@ -0,0 +1,46 @@
+#!/bin/sh
+
+# check that --suggest-filename only needs the package metadata: files that are
+# referenced by the package definition need not exist, and problems with the
+# file contents are not reported
+
+cat > metadata.toml <<-EOT
+[package]
+name = "metadata"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+maxInstalledSize = "1 KiB"
+
+[[file]]
+path = "/etc/metadata.conf"
+contentFrom = "does-not-exist.conf"
+
+[[file]]
+path = "/usr/share/metadata/large.txt"
+content = "$(head -c 4096 /dev/zero | tr '\0' x)"
+compress = "gzip"
+
+[[action]]
+on = "setup"
+scriptFrom = "does-not-exist.sh"
+
+[[user]]
+name = "metadata"
+system = true
+EOT
+
+echo checking --suggest-filename
+echo checking --suggest-filename >&2
+${HOLO_BUILD} --format=debian --suggest-filename metadata.toml; echo "exit code $?"
+${HOLO_BUILD} --format=rpm --suggest-filename < metadata.toml; echo "exit code $?"
+
+echo checking --validate
+echo checking --validate >&2
+${HOLO_BUILD} --format=debian --validate metadata.toml; echo "exit code $?"
+
+echo checking invalid metadata
+echo checking invalid metadata >&2
+sed -i 's/version = "1.0"/version = "foo"/' metadata.toml
+${HOLO_BUILD} --format=debian --suggest-filename metadata.toml; echo "exit code $?"
+
+rm -f metadata.toml
@@ -0,0 +1,43 @@
+#!/bin/sh
+
+# check that the output of dump-package can be reduced with --max-depth,
+# --paths, --no-content and --summary
+
+cat > dump.toml <<-EOT
+[package]
+name = "dump"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/dump/foo.conf"
+content = "foo = 1"
+
+[[file]]
+path = "/etc/dump/bar.conf"
+content = "bar = 2"
+
+[[file]]
+path = "/usr/share/doc/dump/README"
+content = "This is the README."
+compress = "gzip"
+EOT
+
+${HOLO_BUILD} --format=debian -o dump.deb dump.toml
+
+echo "--- --max-depth=1"
+${DUMP_PACKAGE} --max-depth=1 < dump.deb
+echo "--- --max-depth=3"
+${DUMP_PACKAGE} --max-depth=3 < dump.deb
+echo "--- --paths=/etc/dump/foo.conf --paths='usr/share/*'"
+${DUMP_PACKAGE} --paths=/etc/dump/foo.conf --paths='usr/share/*' < dump.deb
+echo "--- --no-content --paths=./usr"
+${DUMP_PACKAGE} --no-content --paths=./usr < dump.deb
+echo "--- --summary"
+${DUMP_PACKAGE} --summary < dump.deb
+echo "--- --summary --max-depth=2"
+${DUMP_PACKAGE} --summary --max-depth=2 < dump.deb
+
+# errors
+${DUMP_PACKAGE} --max-depth=-1 < dump.deb || echo "exit code $?"
+${DUMP_PACKAGE} --paths='[' < dump.deb || echo "exit code $?"
@@ -0,0 +1,27 @@
+#!/bin/sh
+
+# check that dump-package does not show the contents of files that are not
+# readable by other users when --redact-restricted is given
+
+cat > secret.toml <<-EOT
+[package]
+name = "secret"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/secret/password"
+content = "hunter2"
+sensitive = true
+
+[[file]]
+path = "/etc/secret/public.conf"
+content = "password_file = /etc/secret/password"
+EOT
+
+${HOLO_BUILD} --format=debian -o secret.deb secret.toml
+
+echo "--- default"
+${DUMP_PACKAGE} --paths=/etc/secret < secret.deb
+echo "--- --redact-restricted"
+${DUMP_PACKAGE} --redact-restricted --paths=/etc/secret < secret.deb
@@ -0,0 +1,40 @@
+#!/bin/sh
+
+# check that files below /usr/share/holo with unknown plugin IDs produce
+# warnings (with suggestions for typos), unless the plugin ID is declared with
+# --holo-plugin or required explicitly
+
+cat > plugins.toml <<-EOT
+[package]
+name = "plugins"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+requires = ["holo-custom-required"]
+
+[[file]]
+path = "/usr/share/holo/files/01-plugins/etc/foo.conf"
+content = "foo"
+
+[[file]]
+path = "/usr/share/holo/file/01-plugins/etc/bar.conf"
+content = "bar"
+
+[[file]]
+path = "/usr/share/holo/ssh-key/plugins.pub"
+content = "ssh-ed25519 AAAA"
+
+[[file]]
+path = "/usr/share/holo/custom/plugins.toml"
+content = "custom"
+
+[[file]]
+path = "/usr/share/holo/custom-required/plugins.toml"
+content = "custom"
+EOT
+
+echo "--- without --holo-plugin"
+${HOLO_BUILD} --format=debian --suggest-filename plugins.toml
+echo "--- with --holo-plugin=custom --holo-plugin=file"
+${HOLO_BUILD} --format=debian --suggest-filename --holo-plugin=custom --holo-plugin=file plugins.toml
+echo "--- with --holo-plugin=a/b"
+${HOLO_BUILD} --format=debian --suggest-filename --holo-plugin=a/b plugins.toml || echo "exit code $?"
@@ -0,0 +1,42 @@
+#!/bin/sh
+
+# check that files below /usr/share/holo with unusual ownership or modes
+# produce warnings, or are fixed with --normalize-holo-resources
+
+cat > resources.toml <<-EOT
+[package]
+name = "resources"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[directory]]
+path = "/usr/share/holo/files/01-resources"
+mode = "0750"
+
+[[file]]
+path = "/usr/share/holo/files/01-resources/etc/foo.conf"
+content = "foo"
+owner = "foo"
+group = 42
+mode = "0600"
+
+[[file]]
+path = "/usr/share/holo/files/01-resources/etc/bar.conf.holoscript"
+content = "#!/bin/sh\ncat"
+mode = "0700"
+
+[[file]]
+path = "/usr/share/holo/files/01-resources/etc/baz.conf"
+content = "baz"
+
+[[symlink]]
+path = "/usr/share/holo/files/01-resources/etc/qux.conf"
+target = "baz.conf"
+EOT
+
+echo "--- without --normalize-holo-resources"
+${HOLO_BUILD} --format=debian -o resources.deb resources.toml
+${DUMP_PACKAGE} --paths=usr/share/holo < resources.deb
+echo "--- with --normalize-holo-resources"
+${HOLO_BUILD} --format=debian -o resources.deb --force --normalize-holo-resources resources.toml
+${DUMP_PACKAGE} --paths=usr/share/holo < resources.deb
@@ -0,0 +1,62 @@
+#!/bin/sh
+
+# check that --version-from-git derives the version from `git describe`
+
+rm -rf repo
+mkdir repo
+cat > repo/foo.toml <<-EOT
+[package]
+name = "foo"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/foo.conf"
+content = "foo"
+EOT
+
+git_in_repo() {
+    git -C repo -c user.name="Holo Build" -c user.email="holo.build@example.org" -c commit.gpgsign=false -c tag.gpgsign=false "$@" >/dev/null
+}
+suggest_filename() {
+    ${HOLO_BUILD} --format=debian --suggest-filename --version-from-git repo/foo.toml
+}
+
+echo "--- no repository"
+GIT_CEILING_DIRECTORIES="$PWD" suggest_filename || echo "exit code $?"
+
+git_in_repo init -q
+git_in_repo add foo.toml
+git_in_repo commit -q -m "initial commit"
+echo "--- no tags"
+suggest_filename || echo "exit code $?"
+
+git_in_repo tag v1.2.0
+echo "--- at tag v1.2.0"
+suggest_filename
+git_in_repo commit -q --allow-empty -m "second commit"
+git_in_repo commit -q --allow-empty -m "third commit"
+echo "--- 2 commits after tag v1.2.0"
+suggest_filename
+
+git_in_repo tag 2.0-beta.2
+git_in_repo commit -q --allow-empty -m "fourth commit"
+echo "--- 1 commit after tag 2.0-beta.2"
+suggest_filename
+
+git_in_repo tag v3.0-alpha
+git_in_repo commit -q --allow-empty -m "fifth commit"
+git_in_repo commit -q --allow-empty -m "sixth commit"
+echo "--- 2 commits after tag v3.0-alpha"
+suggest_filename
+${HOLO_BUILD} --format=rpm --suggest-filename --version-from-git repo/foo.toml
+
+echo "--- uncommitted changes"
+echo "# changed" >> repo/foo.toml
+suggest_filename
+
+echo "--- tag that is not a version"
+git_in_repo commit -q -a -m "seventh commit"
+git_in_repo tag 4.0-rc1
+suggest_filename || echo "exit code $?"
+
+rm -rf repo
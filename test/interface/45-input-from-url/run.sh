@@ -0,0 +1,70 @@
+#!/bin/sh
+
+# check that package definitions can be fetched over HTTP, with paths in them
+# resolved relative to the URL (this test needs python3 for the HTTP server)
+
+rm -rf htdocs
+mkdir -p htdocs/defs/scripts htdocs/files
+cat > htdocs/defs/foo.toml <<-EOT
+[package]
+name = "foo"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/foo.conf"
+contentFrom = "foo.conf"
+
+[[file]]
+path = "/etc/bar.conf"
+contentFrom = "/files/bar.conf"
+
+[[action]]
+on = "setup"
+scriptFrom = "scripts/setup.sh"
+EOT
+echo "foo = 1" > htdocs/defs/foo.conf
+echo "bar = 2" > htdocs/files/bar.conf
+echo "echo setup" > htdocs/defs/scripts/setup.sh
+cat > htdocs/defs/exec.toml <<-EOT
+[package]
+name = "exec"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/exec.conf"
+contentFromCommand = "cat /etc/hostname"
+EOT
+
+# start an HTTP server on a random port
+python3 -m http.server --bind 127.0.0.1 --directory htdocs 0 > server.log 2>&1 &
+SERVER_PID=$!
+while ! grep -q 'port [0-9]*' server.log; do sleep 0.1; done
+URL="http://127.0.0.1:$(sed -n 's/.*port \([0-9]*\).*/\1/p' server.log | head -n1)"
+
+# error messages contain the random port
+without_url() {
+    sed "s|${URL}|\$URL|g" >&2
+}
+
+SHA256="$(sha256sum htdocs/defs/foo.toml | cut -d' ' -f1)"
+echo "--- fetch from URL"
+${HOLO_BUILD} --format=debian -o foo.deb --input-sha256="${SHA256}" "${URL}/defs/foo.toml"
+${DUMP_PACKAGE} --paths=etc --paths=postinst < foo.deb
+
+echo "--- checksum mismatch"
+${HOLO_BUILD} --format=debian --validate --input-sha256=0000000000000000000000000000000000000000000000000000000000000000 "${URL}/defs/foo.toml" 2>&1 >/dev/null | without_url
+echo "--- invalid checksum"
+${HOLO_BUILD} --format=debian --validate --input-sha256=1234 "${URL}/defs/foo.toml" || echo "exit code $?"
+echo "--- missing definition"
+${HOLO_BUILD} --format=debian --validate "${URL}/defs/missing.toml" 2>&1 >/dev/null | without_url
+echo "--- missing referenced file"
+rm htdocs/files/bar.conf
+${HOLO_BUILD} --format=debian --validate "${URL}/defs/foo.toml" 2>&1 >/dev/null | without_url
+echo "--- contentFromCommand"
+${HOLO_BUILD} --format=debian --validate --allow-exec "${URL}/defs/exec.toml" 2>&1 >/dev/null | without_url
+
+kill ${SERVER_PID}
+wait ${SERVER_PID} 2>/dev/null
+rm -rf htdocs server.log
@@ -0,0 +1,41 @@
+#!/bin/sh
+
+# check that --sign-cmd writes a signature file next to the package, or embeds
+# the signature of the header in RPM packages
+
+cat > signed.toml <<-EOT
+[package]
+name = "signed"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/signed.conf"
+content = "foo"
+EOT
+
+echo checking signature file
+echo checking signature file >&2
+mkdir -p out
+${HOLO_BUILD} --format=debian -o out --sign-cmd='sha256sum | cut -d" " -f1' signed.toml
+ls out
+(cd out && sha256sum signed_1.0-1_all.deb | cut -d" " -f1 | cmp - signed_1.0-1_all.deb.sig && echo signature matches)
+
+echo checking embedded signature
+echo checking embedded signature >&2
+# a minimal v4 signature packet (old format, type 2, length 6) with the RSA public-key algorithm
+${HOLO_BUILD} --format=rpm -o - --sign-cmd="printf '\210\006\004\000\001\010ab'" signed.toml | ${DUMP_PACKAGE} | grep -A2 'RSA'
+ls out
+
+echo checking invalid signatures
+echo checking invalid signatures >&2
+${HOLO_BUILD} --format=rpm -o out --sign-cmd='echo not a signature' signed.toml; echo "exit code $?"
+${HOLO_BUILD} --format=rpm -o out --sign-cmd='true' signed.toml; echo "exit code $?"
+${HOLO_BUILD} --format=debian -o out --force --sign-cmd='echo key not found >&2; false' signed.toml; echo "exit code $?"
+
+echo checking invalid arguments
+echo checking invalid arguments >&2
+${HOLO_BUILD} --format=debian -o - --sign-cmd=cat signed.toml; echo "exit code $?"
+${HOLO_BUILD} --format=debian --plan --sign-cmd=cat signed.toml; echo "exit code $?"
+
+rm -rf signed.toml out
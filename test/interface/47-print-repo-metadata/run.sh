@@ -0,0 +1,42 @@
+#!/bin/sh
+
+# check that --print-repo-metadata shows the repository index entries for the
+# built package
+
+cat > meta.toml <<-EOT
+[package]
+name = "meta"
+version = "1.0"
+description = "Metadata <preview> & test"
+author = "Holo Build <holo.build@example.org>"
+requires = ["foo >= 2.0", "bar"]
+conflicts = ["baz < 1:1.0-2"]
+provides = ["qux"]
+
+[[file]]
+path = "/etc/meta.conf"
+content = "foo"
+
+[[file]]
+path = "/usr/bin/meta"
+content = "#!/bin/sh"
+mode = "0755"
+
+[[file]]
+path = "/usr/share/meta/data"
+content = "data"
+EOT
+
+mkdir -p out
+for FORMAT in debian pacman rpm; do
+    echo "--- $FORMAT"
+    echo "--- $FORMAT" >&2
+    ${HOLO_BUILD} --format=$FORMAT -o out --print-repo-metadata meta.toml
+done
+
+echo "--- unsupported formats and invalid arguments"
+echo "--- unsupported formats and invalid arguments" >&2
+${HOLO_BUILD} --format=tar -o out --print-repo-metadata meta.toml; echo "exit code $?"
+${HOLO_BUILD} --format=debian -o - --print-repo-metadata meta.toml; echo "exit code $?"
+
+rm -rf meta.toml out
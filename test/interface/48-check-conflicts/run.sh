@@ -0,0 +1,89 @@
+#!/bin/sh
+
+# check that `holo-build check-conflicts` reports paths that are claimed by more
+# than one package definition or package
+
+cat > foo.toml <<-EOT
+[package]
+name = "foo"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/shared.conf"
+content = "foo"
+
+[[file]]
+path = "/usr/bin/foo"
+content = "#!/bin/sh"
+mode = "0755"
+
+[[directory]]
+path = "/var/lib/shared"
+EOT
+
+cat > bar.toml <<-EOT
+[package]
+name = "bar"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/shared.conf"
+content = "bar"
+
+[[directory]]
+path = "/var/lib/shared"
+
+[[symlink]]
+path = "/usr/bin/foo"
+target = "bar"
+EOT
+
+cat > baz.toml <<-EOT
+[package]
+name = "baz"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+supersedes = ["foo"]
+
+[[file]]
+path = "/etc/shared.conf"
+content = "baz"
+EOT
+
+cat > other.toml <<-EOT
+[package]
+name = "other"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/other.conf"
+content = "other"
+EOT
+
+echo "--- package definitions"
+echo "--- package definitions" >&2
+${HOLO_BUILD} check-conflicts foo.toml bar.toml; echo "exit code $?"
+${HOLO_BUILD} check-conflicts foo.toml other.toml; echo "exit code $?"
+
+echo "--- declared conflicts"
+echo "--- declared conflicts" >&2
+${HOLO_BUILD} check-conflicts foo.toml baz.toml; echo "exit code $?"
+${HOLO_BUILD} check-conflicts bar.toml baz.toml; echo "exit code $?"
+
+echo "--- packages"
+echo "--- packages" >&2
+${HOLO_BUILD} --format=debian -o bar.deb bar.toml
+${HOLO_BUILD} check-conflicts foo.toml bar.deb other.toml; echo "exit code $?"
+
+echo "--- invalid arguments"
+echo "--- invalid arguments" >&2
+${HOLO_BUILD} check-conflicts; echo "exit code $?"
+${HOLO_BUILD} check-conflicts --arch=all-supported foo.toml; echo "exit code $?"
+${HOLO_BUILD} check-conflicts foo.toml missing.toml; echo "exit code $?"
+${HOLO_BUILD} check-conflicts --installed --format=tar foo.toml; echo "exit code $?"
+${HOLO_BUILD} --installed --format=debian foo.toml; echo "exit code $?"
+
+rm -rf foo.toml bar.toml baz.toml other.toml bar.deb
@@ -0,0 +1,41 @@
+#!/bin/sh
+
+# check that --output-mode sets the mode of the package file regardless of the
+# umask, and that --atomic-write replaces the package file in one step
+
+umask 077
+mkdir -p out
+
+echo "--- default mode"
+echo "--- default mode" >&2
+${HOLO_BUILD} --format=debian -o out/default.deb --emit-checksums=sha256 ${INPUT_TOML}
+stat -c '%a %n' out/default.deb out/default.deb.sha256
+
+echo "--- explicit mode"
+echo "--- explicit mode" >&2
+${HOLO_BUILD} --format=debian -o out/explicit.deb --output-mode=0640 ${INPUT_TOML}
+stat -c '%a %n' out/explicit.deb
+
+echo "--- mode of overwritten file"
+echo "--- mode of overwritten file" >&2
+chmod 0600 out/default.deb
+${HOLO_BUILD} --force --format=debian -o out/default.deb ${INPUT_TOML}
+stat -c '%a %n' out/default.deb
+
+echo "--- atomic write"
+echo "--- atomic write" >&2
+dd if=/dev/zero of=out/atomic.deb bs=4K count=1 status=none
+${HOLO_BUILD} --force --atomic-write --output-mode=0664 --format=debian -o out/atomic.deb ${INPUT_TOML}
+stat -c '%a %n' out/atomic.deb
+${DUMP_PACKAGE} < out/atomic.deb | head -n 1
+ls -A out
+
+echo "--- invalid arguments"
+echo "--- invalid arguments" >&2
+${HOLO_BUILD} --format=debian -o out --output-mode=0855 ${INPUT_TOML}; echo "exit code $?"
+${HOLO_BUILD} --format=debian -o out --output-mode=01777 ${INPUT_TOML}; echo "exit code $?"
+${HOLO_BUILD} --format=debian -o - --output-mode=0644 ${INPUT_TOML} > /dev/null; echo "exit code $?"
+${HOLO_BUILD} --format=debian -o - --atomic-write ${INPUT_TOML} > /dev/null; echo "exit code $?"
+${HOLO_BUILD} --format=debian --validate --atomic-write ${INPUT_TOML}; echo "exit code $?"
+
+rm -rf out
@@ -0,0 +1,34 @@
+#!/bin/sh
+
+# check that --if-changed only rewrites the package file if its contents
+# differ, and that --output-by-digest names the package file after its digest
+
+echo "--- if-changed with identical contents"
+echo "--- if-changed with identical contents" >&2
+${HOLO_BUILD} --format=debian -o package.deb ${INPUT_TOML}
+touch --date='@0' package.deb
+${HOLO_BUILD} --if-changed --format=debian -o package.deb ${INPUT_TOML}; echo "exit code $?"
+find . -name \*.deb -mtime 0 # should output nothing
+
+echo "--- if-changed with different contents"
+echo "--- if-changed with different contents" >&2
+dd if=/dev/zero of=package.deb bs=4K count=1 status=none
+${HOLO_BUILD} --if-changed --format=debian -o package.deb ${INPUT_TOML}; echo "exit code $?"
+${DUMP_PACKAGE} < package.deb | head -n 1
+
+echo "--- output by digest"
+echo "--- output by digest" >&2
+mkdir -p out
+${HOLO_BUILD} --output-by-digest --emit-checksums=sha256 --format=debian -o out ${INPUT_TOML}; echo "exit code $?"
+ls out
+cat out/*.sha256
+
+echo "--- invalid arguments"
+echo "--- invalid arguments" >&2
+${HOLO_BUILD} --force --if-changed --format=debian -o package.deb ${INPUT_TOML}; echo "exit code $?"
+${HOLO_BUILD} --if-changed --format=debian -o - ${INPUT_TOML} > /dev/null; echo "exit code $?"
+${HOLO_BUILD} --output-by-digest --format=debian -o - ${INPUT_TOML} > /dev/null; echo "exit code $?"
+${HOLO_BUILD} --output-by-digest --format=debian --repo=out ${INPUT_TOML}; echo "exit code $?"
+${HOLO_BUILD} --output-by-digest --format=debian -o package.deb ${INPUT_TOML}; echo "exit code $?"
+
+rm -rf package.deb out
@@ -0,0 +1,45 @@
+#!/bin/sh
+
+# check that contentFromSha256 verifies the file referenced by contentFrom
+
+rm -rf sha-test
+mkdir sha-test
+printf 'foo' > sha-test/data.txt
+
+write_definition() {
+    cat > sha-test/input.toml <<-EOT
+[package]
+name = "package"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/usr/share/package/data.txt"
+$1
+compress = "gzip"
+EOT
+}
+
+echo "--- matching checksum"
+echo "--- matching checksum" >&2
+write_definition 'contentFrom = "data.txt"
+contentFromSha256 = "2C26B46B68FFC68FF99B453C1D30413413422D706483BFA0F98A5E886266E7AE"'
+${HOLO_BUILD} --format=pacman -o - sha-test/input.toml | ${DUMP_PACKAGE} | grep -A1 "data.txt.gz is regular file"
+
+echo "--- mismatching checksum"
+echo "--- mismatching checksum" >&2
+printf 'bar' > sha-test/data.txt
+${HOLO_BUILD} --format=pacman -o - sha-test/input.toml > /dev/null; echo "exit code $?"
+# the file contents are not read with --suggest-filename
+${HOLO_BUILD} --format=pacman --suggest-filename sha-test/input.toml; echo "exit code $?"
+
+echo "--- invalid usage"
+echo "--- invalid usage" >&2
+write_definition 'contentFrom = "data.txt"
+contentFromSha256 = "0123"'
+${HOLO_BUILD} --format=pacman --suggest-filename sha-test/input.toml; echo "exit code $?"
+write_definition 'content = "bar"
+contentFromSha256 = "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"'
+${HOLO_BUILD} --format=pacman -o - sha-test/input.toml > /dev/null; echo "exit code $?"
+
+rm -rf sha-test
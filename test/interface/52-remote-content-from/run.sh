@@ -0,0 +1,64 @@
+#!/bin/sh
+
+# check that contentFrom can refer to a URL with --allow-network, and that
+# downloads with contentFromSha256 are cached in --cache-dir (this test needs
+# python3 for the HTTP server)
+
+rm -rf htdocs cache
+mkdir -p htdocs
+printf 'foo' > htdocs/foo.bin
+
+# start an HTTP server on a random port
+python3 -m http.server --bind 127.0.0.1 --directory htdocs 0 > server.log 2>&1 &
+SERVER_PID=$!
+while ! grep -q 'port [0-9]*' server.log; do sleep 0.1; done
+URL="http://127.0.0.1:$(sed -n 's/.*port \([0-9]*\).*/\1/p' server.log | head -n1)"
+
+# error messages contain the random port
+without_url() {
+    sed "s|${URL}|\$URL|g" >&2
+}
+
+write_definition() {
+    cat > remote.toml <<-EOT
+[package]
+name = "remote"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/usr/share/remote/foo.bin"
+contentFrom = "${URL}/foo.bin"
+$1
+EOT
+}
+
+echo "--- without --allow-network"
+echo "--- without --allow-network" >&2
+write_definition ''
+${HOLO_BUILD} --format=debian --validate remote.toml 2>&1 >/dev/null | without_url
+
+echo "--- with --allow-network"
+echo "--- with --allow-network" >&2
+${HOLO_BUILD} --format=debian --allow-network -o - remote.toml | ${DUMP_PACKAGE} --paths=usr/share/remote/foo.bin
+
+echo "--- checksum mismatch"
+echo "--- checksum mismatch" >&2
+write_definition 'contentFromSha256 = "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"'
+${HOLO_BUILD} --format=debian --allow-network --cache-dir=cache --validate remote.toml 2>&1 >/dev/null | without_url
+ls cache 2>/dev/null # should output nothing
+
+echo "--- download cache"
+echo "--- download cache" >&2
+write_definition 'contentFromSha256 = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"'
+${HOLO_BUILD} --format=debian --allow-network --cache-dir=cache --validate remote.toml; echo "exit code $?"
+ls cache/downloads | wc -l
+# the second build does not need the server anymore
+rm htdocs/foo.bin
+${HOLO_BUILD} --format=debian --allow-network --cache-dir=cache -o - remote.toml | ${DUMP_PACKAGE} --paths=usr/share/remote/foo.bin
+# without the cache, the download fails
+${HOLO_BUILD} --format=debian --allow-network --validate remote.toml 2>&1 >/dev/null | without_url
+
+kill ${SERVER_PID}
+wait ${SERVER_PID} 2>/dev/null
+rm -rf htdocs cache server.log remote.toml
@@ -0,0 +1,59 @@
+#!/bin/sh
+
+# check that tar archives are written in the PAX format with deterministic PAX
+# records, and that they are reproducible byte for byte (this test needs
+# python3 to show the PAX records)
+
+LONG_DIR="/usr/share/pax-test/this-directory-name-is-long-enough-to-push-the-path-over-the-limit-of-ustar"
+
+cat > pax.toml <<-EOT
+[package]
+name = "pax"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "${LONG_DIR}/file.conf"
+content = "foo"
+mtime = "2023-01-01T00:00:00.25Z"
+
+[[file]]
+path = "/usr/share/pax-test/big-ids"
+content = "bar"
+owner = 3000000
+group = 3000000
+
+[[symlink]]
+path = "/usr/share/pax-test/link"
+target = "${LONG_DIR}/file.conf"
+EOT
+
+show_pax_records() {
+    python3 -c '
+import sys, tarfile
+with tarfile.open(fileobj=sys.stdin.buffer, mode="r|") as archive:
+    for member in archive:
+        records = ", ".join("%s=%s" % item for item in sorted(member.pax_headers.items()))
+        print("%s: %s" % (member.name, records or "no PAX records"))
+'
+}
+
+echo "--- PAX records"
+echo "--- PAX records" >&2
+${HOLO_BUILD} --format=tar -o - pax.toml | xz -d | show_pax_records
+
+echo "--- reproducibility"
+echo "--- reproducibility" >&2
+for FORMAT in debian pacman tar freebsd oci-layer; do
+    ${HOLO_BUILD} --format=$FORMAT -o first.pkg pax.toml
+    sleep 1
+    ${HOLO_BUILD} --format=$FORMAT -o second.pkg pax.toml
+    if cmp -s first.pkg second.pkg; then
+        echo "$FORMAT: identical"
+    else
+        echo "$FORMAT: different"
+    fi
+    rm -f first.pkg second.pkg
+done
+
+rm -f pax.toml
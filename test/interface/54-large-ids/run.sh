@@ -0,0 +1,65 @@
+#!/bin/sh
+
+# check that user and group IDs that do not fit into the octal fields of tar
+# headers are encoded such that the respective package manager can read them
+# (this test needs python3 to show the tar headers)
+
+cat > ids.toml <<-EOT
+[package]
+name = "ids"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/usr/share/ids-test/small-ids"
+content = "foo"
+owner = 2097151
+group = 2097151
+
+[[file]]
+path = "/usr/share/ids-test/large-ids"
+content = "bar"
+owner = 4294967294
+group = 3000000
+EOT
+
+show_tar_headers() {
+    python3 -c '
+import sys, tarfile
+with tarfile.open(fileobj=sys.stdin.buffer, mode="r|") as archive:
+    for member in archive:
+        if member.isfile():
+            kind = "PAX records" if member.pax_headers else "no PAX records"
+            print("%s: uid=%d gid=%d, %s" % (member.name, member.uid, member.gid, kind))
+'
+}
+
+echo "--- debian (GNU format)"
+echo "--- debian (GNU format)" >&2
+${HOLO_BUILD} --format=debian -o ids.deb ids.toml
+ar p ids.deb data.tar.xz | xz -d | show_tar_headers
+ar p ids.deb data.tar.xz | xz -d | python3 -c '
+import sys
+data = sys.stdin.buffer.read()
+magics = sorted(set(data[offset+257:offset+265] for offset in range(0, len(data), 512) if data[offset+257:offset+262] == b"ustar"))
+print("magics: %s" % ", ".join(repr(m) for m in magics))
+'
+rm -f ids.deb
+
+echo "--- tar (PAX format)"
+echo "--- tar (PAX format)" >&2
+${HOLO_BUILD} --format=tar -o - ids.toml | xz -d | show_tar_headers
+
+echo "--- dump-package"
+echo "--- dump-package" >&2
+for FORMAT in debian pacman rpm; do
+    ${HOLO_BUILD} --format=$FORMAT -o - ids.toml | ${DUMP_PACKAGE} | grep -E 'ids-test/.*-ids'
+done
+
+echo "--- reserved ID"
+echo "--- reserved ID" >&2
+sed 's/owner = 4294967294/owner = 4294967295/' ids.toml > reserved.toml
+${HOLO_BUILD} --format=tar -o - reserved.toml > /dev/null
+echo "exit code: $?"
+
+rm -f ids.toml reserved.toml
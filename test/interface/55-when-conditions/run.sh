@@ -0,0 +1,76 @@
+#!/bin/sh
+
+# check that `when` conditions select entries based on the package format, the
+# architecture and variables given with --define, and that errors in conditions
+# are reported with their column
+
+cat > when.toml <<-EOT
+[package]
+name         = "when"
+version      = "1.0"
+author       = "Holo Build <holo.build@example.org>"
+architecture = "x86_64"
+
+[[file]]
+path    = "/usr/share/when/rpm-on-amd64"
+content = "foo"
+when    = 'format == "rpm" && arch == "amd64"'
+
+[[file]]
+path    = "/usr/share/when/not-pacman"
+content = "foo"
+when    = "!(format == 'pacman')"
+
+[[file]]
+path    = "/usr/share/when/fips-or-debian"
+content = "foo"
+when    = 'variant == "fips" || format == "debian"'
+
+[[directory]]
+path = "/usr/share/when/never"
+when = 'false && variant == "fips"'
+
+[[symlink]]
+path   = "/usr/share/when/link"
+target = "rpm-on-amd64"
+when   = 'format == "rpm"'
+
+[[action]]
+on     = "setup"
+script = "echo variant is fips"
+when   = 'variant == "fips"'
+EOT
+
+list_entries() {
+    ${DUMP_PACKAGE} | grep -oE 'usr/share/when/[a-z0-9-]+|echo variant is fips' | sort -u | tr '\n' ' '
+    echo
+}
+
+echo "--- entries"
+echo "--- entries" >&2
+for FORMAT in debian pacman rpm; do
+    for VARIANT in fips standard; do
+        echo -n "$FORMAT/$VARIANT: "
+        ${HOLO_BUILD} --format=$FORMAT --define=variant=$VARIANT -o - when.toml | list_entries
+    done
+done
+
+echo "--- errors in conditions"
+echo "--- errors in conditions" >&2
+for CONDITION in 'format = "rpm"' 'format == "rpm" &&' '(arch == "x86_64"' 'format == "deb"' 'arch == "sparc"' 'flavor == "fips"' 'format == "rpm" variant' 'format == "rpm'; do
+    sed "/^\[\[directory\]\]/,\$d" when.toml > broken.toml
+    printf '[[file]]\npath = "/etc/broken"\ncontent = "x"\nwhen = %s\n' "'$CONDITION'" >> broken.toml
+    ${HOLO_BUILD} --format=rpm --define=variant=fips -o /dev/null broken.toml
+    echo "exit code: $?"
+done
+
+echo "--- invalid --define"
+echo "--- invalid --define" >&2
+for DEFINE in variant 1variant=x format=rpm; do
+    ${HOLO_BUILD} --format=rpm --define=$DEFINE -o /dev/null when.toml
+    echo "exit code: $?"
+done
+${HOLO_BUILD} --format=rpm --define=variant=a --define=variant=b -o /dev/null when.toml
+echo "exit code: $?"
+
+rm -f when.toml broken.toml
@@ -0,0 +1,96 @@
+#!/bin/sh
+
+# check that [[check]] sections are verified against the generated package, and
+# that the package is not written when a check fails
+
+cat > checks.toml <<-EOT
+[package]
+name         = "checks"
+version      = "1.0"
+author       = "Holo Build <holo.build@example.org>"
+architecture = "x86_64"
+
+[[file]]
+path    = "/etc/checks.conf"
+content = "foo"
+mode    = "0600"
+
+[[symlink]]
+path   = "/etc/checks.link"
+target = "checks.conf"
+
+[[action]]
+on     = "setup"
+script = "echo checks are installed"
+
+[[check]]
+pathExists = "/etc/checks.conf"
+mode       = "0600"
+
+[[check]]
+pathExists     = "/etc/checks.link"
+pathMissing    = "/etc/checks.d"
+scriptContains = "checks are installed"
+
+[[check]]
+pathExists = "/etc/checks.d"
+when       = 'variant == "broken"'
+
+[[check]]
+pathExists     = "/etc/checks.conf"
+mode           = "0644"
+pathMissing    = "/etc/checks.link"
+scriptContains = "checks are removed"
+when           = 'variant == "broken" && format != "debian"'
+EOT
+
+echo "--- passing checks"
+echo "--- passing checks" >&2
+for FORMAT in debian pacman rpm; do
+    ${HOLO_BUILD} --format=$FORMAT --define=variant=ok -o checks.pkg checks.toml
+    echo "$FORMAT: exit code $?, package written: $(test -f checks.pkg && echo yes || echo no)"
+    rm -f checks.pkg
+done
+${HOLO_BUILD} --format=rpm --define=variant=ok --prefix=/opt/checks -o checks.pkg checks.toml
+echo "rpm with --prefix: exit code $?"
+rm -f checks.pkg
+
+echo "--- failing checks"
+echo "--- failing checks" >&2
+for FORMAT in debian pacman rpm; do
+    ${HOLO_BUILD} --format=$FORMAT --define=variant=broken -o checks.pkg checks.toml
+    echo "$FORMAT: exit code $?, package written: $(test -f checks.pkg && echo yes || echo no)"
+    rm -f checks.pkg
+done
+
+echo "--- formats that cannot be checked"
+echo "--- formats that cannot be checked" >&2
+sed '/^\[\[action\]\]/,/^$/d; /^scriptContains/d' checks.toml > tarball.toml
+${HOLO_BUILD} --format=tar --define=variant=broken -o checks.pkg tarball.toml
+echo "exit code: $?"
+
+echo "--- invalid checks"
+echo "--- invalid checks" >&2
+cat > broken.toml <<-EOT
+[package]
+name    = "checks"
+version = "1.0"
+
+[[check]]
+when = "true"
+
+[[check]]
+pathExists = "etc/checks.conf"
+
+[[check]]
+pathMissing = "/etc/checks.conf"
+mode        = "0600"
+
+[[check]]
+pathExists = "/etc/checks.conf"
+mode       = "0999"
+EOT
+${HOLO_BUILD} --format=pacman -o checks.pkg broken.toml
+echo "exit code: $?"
+
+rm -f checks.pkg checks.toml tarball.toml broken.toml
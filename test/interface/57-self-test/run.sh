@@ -0,0 +1,58 @@
+#!/bin/sh
+
+# check that `holo-build self-test` writes golden files with --update-golden,
+# and reports deviations from them otherwise
+
+mkdir -p cases/01-first cases/02-second
+cat > cases/01-first/input.toml <<-EOT
+[package]
+name    = "first"
+version = "1.0"
+author  = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path    = "/etc/first.conf"
+content = "foo"
+EOT
+sed 's/first/second/' cases/01-first/input.toml > cases/02-second/input.toml
+
+echo "--- new test cases get golden files for all formats"
+echo "--- new test cases get golden files for all formats" >&2
+${HOLO_BUILD} self-test --update-golden cases
+echo "exit code: $?"
+${HOLO_BUILD} self-test cases
+echo "exit code: $?"
+cat cases/01-first/expected-suggested-filenames
+
+echo "--- deviations"
+echo "--- deviations" >&2
+sed -i 's/content = "foo"/content = "bar"/' cases/02-second/input.toml
+${HOLO_BUILD} self-test --format=tar cases
+echo "exit code: $?"
+${HOLO_BUILD} self-test --update-golden --format=tar cases
+echo "exit code: $?"
+${HOLO_BUILD} self-test --format=tar cases
+echo "exit code: $?"
+
+echo "--- adding a format to existing test cases"
+echo "--- adding a format to existing test cases" >&2
+rm cases/01-first/expected-nix-* cases/01-first/expected-makeself-*
+${HOLO_BUILD} self-test cases/01-first
+echo "exit code: $?"
+${HOLO_BUILD} self-test --update-golden --format=nix cases/01-first
+echo "exit code: $?"
+${HOLO_BUILD} self-test cases/01-first
+echo "exit code: $?"
+
+echo "--- invalid usage"
+echo "--- invalid usage" >&2
+${HOLO_BUILD} self-test
+echo "exit code: $?"
+${HOLO_BUILD} self-test --format=foo cases
+echo "exit code: $?"
+${HOLO_BUILD} self-test .
+echo "exit code: $?"
+${HOLO_BUILD} --update-golden input.toml
+echo "exit code: $?"
+
+rm -rf cases
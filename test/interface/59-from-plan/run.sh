@@ -0,0 +1,49 @@
+#!/bin/sh
+
+# check that --from-plan builds the package from a plan printed by --plan,
+# including changes to metadata values and archive members
+
+cat > plan-input.toml <<'TOML'
+[package]
+name = "package"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+description = "original description"
+
+[[file]]
+path = "/etc/foo.conf"
+content = "foo\n"
+mode = "0600"
+TOML
+
+for FORMAT in debian pacman rpm; do
+    echo "checking format $FORMAT"
+    echo "checking format $FORMAT" >&2
+    ${HOLO_BUILD} --format=$FORMAT --plan plan-input.toml > plan.json
+    # change a metadata value and the mode of a file (for RPM, the mode is
+    # also recorded in the header)
+    sed -i 's/original description/edited description/g; s/"0600"/"0640"/; s/"33152"/"33184"/' plan.json
+    ${HOLO_BUILD} --format=$FORMAT --from-plan=plan.json -o - plan-input.toml | ${DUMP_PACKAGE}; echo "exit code $?"
+done
+
+echo "checking changed file contents"
+echo "checking changed file contents" >&2
+${HOLO_BUILD} --format=debian --plan plan-input.toml > plan.json
+sed -i 's/content = "foo\\n"/content = "bar\\n"/' plan-input.toml
+${HOLO_BUILD} --format=debian --from-plan=plan.json -o - plan-input.toml; echo "exit code $?"
+
+echo "checking plan for another format"
+echo "checking plan for another format" >&2
+${HOLO_BUILD} --format=pacman --plan plan-input.toml > plan.json
+${HOLO_BUILD} --format=rpm --from-plan=plan.json -o - plan-input.toml; echo "exit code $?"
+
+echo "checking invalid plan"
+echo "checking invalid plan" >&2
+echo '{"format":' > plan.json
+${HOLO_BUILD} --format=debian --from-plan=plan.json -o - plan-input.toml; echo "exit code $?"
+
+echo "checking --from-plan with --plan"
+echo "checking --from-plan with --plan" >&2
+${HOLO_BUILD} --format=debian --plan --from-plan=plan.json plan-input.toml; echo "exit code $?"
+
+rm -f plan-input.toml plan.json
@@ -0,0 +1,47 @@
+#!/bin/sh
+
+# check that RPM header tags of type CHAR (here: FILESTATES) can be added in a
+# plan for --from-plan, and are decoded by dump-package
+
+cat > char-input.toml <<'TOML'
+[package]
+name = "char"
+version = "1.0"
+author = "Holo Build <holo.build@example.org>"
+
+[[file]]
+path = "/etc/char/a.conf"
+content = "a\n"
+
+[[file]]
+path = "/etc/char/b.conf"
+content = "b\n"
+TOML
+
+# insert FILESTATES (tag 1029) with one value per file after FILESIZES (tag
+# 1028), since the plan lists the tags in order
+add_filestates() {
+    python3 -c '
+import json, sys
+plan = json.load(open("plan.json"))
+values = plan["metadata"]
+index = max(i for i, v in enumerate(values) if v["key"] == "FILESIZES") + 1
+values[index:index] = [{"key": "FILESTATES", "value": v} for v in sys.argv[1:]]
+json.dump(plan, open("plan.json", "w"), indent=2)
+' "$@"
+}
+
+echo "checking FILESTATES in plan"
+echo "checking FILESTATES in plan" >&2
+${HOLO_BUILD} --format=rpm --plan char-input.toml > plan.json
+add_filestates 0 65
+${HOLO_BUILD} --format=rpm --from-plan=plan.json -o char.rpm char-input.toml; echo "exit code $?"
+${DUMP_PACKAGE} < char.rpm | grep -A2 FILESTATES
+
+echo "checking invalid FILESTATES value"
+echo "checking invalid FILESTATES value" >&2
+${HOLO_BUILD} --format=rpm --plan char-input.toml > plan.json
+add_filestates 0 256
+${HOLO_BUILD} --format=rpm --from-plan=plan.json -o - char-input.toml; echo "exit code $?"
+
+rm -f char-input.toml plan.json char.rpm
@@ -3,10 +3,24 @@ _holo_build() {
     local cur="${COMP_WORDS[COMP_CWORD]}"
     local prev="${COMP_WORDS[COMP_CWORD-1]}"
     if [[ $cur = -* ]]; then
-        COMPREPLY=( $(compgen -W "-f --force --format --help -o --output --suggest-filename -V --version" -- "$cur") )
+        COMPREPLY=( $(compgen -W "--allow-exec --allow-network --arch --atomic-write --base-dir --cache-dir --check-output --define --emit-checksums --error-format --exec-after --explain-schema --filename-format -f --force --format --help --holo-plugin --hologram-provides --if-changed --input-sha256 --installed -j --jobs --migrate --no-autodetect --normalize-holo-resources -o --output --output-by-digest --output-mode --pacman-group-db --plan --prefix --print-repo-metadata --print-size-report --progress --provenance -q --quiet --repo --sign-cmd --suggest-filename --update-golden --validate -v --verbose -V --version --version-from-git" -- "$cur") )
     elif [ "$COMP_CWORD" -gt 0 ]; then
         if [[ $prev = --format ]]; then
-            COMPREPLY=( $(compgen -W "debian pacman rpm" -- "$cur") )
+            COMPREPLY=( $(compgen -W "debian pacman rpm freebsd oci-layer tar makeself nix all" -- "$cur") )
+        elif [[ $prev = --emit-checksums ]]; then
+            COMPREPLY=( $(compgen -W "sha256 md5 b2" -- "$cur") )
+        elif [[ $prev = --pacman-group-db ]]; then
+            COMPREPLY=( $(compgen -f -- "$cur") )
+        elif [[ $prev = --filename-format ]]; then
+            COMPREPLY=( $(compgen -W "json" -- "$cur") )
+        elif [[ $prev = --error-format ]]; then
+            COMPREPLY=( $(compgen -W "json" -- "$cur") )
+        elif [[ $prev = --progress ]]; then
+            COMPREPLY=( $(compgen -W "json" -- "$cur") )
+        elif [[ $prev = --arch ]]; then
+            COMPREPLY=( $(compgen -W "all-supported all any noarch i386 i686 x86_64 amd64 arm armel armv5tl armv6h armv6hl armhf armv7h armv7hl arm64 aarch64" -- "$cur") )
+        elif [ "$COMP_CWORD" -eq 1 ]; then
+            COMPREPLY=( $(compgen -W "check-conflicts convert self-test" -f -- "$cur") )
         fi
     fi
 }